@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// actionsErrorRe matches the errors of the compiler that name a file, such
+// as "./main.go:12:5: undefined: foo".
+var actionsErrorRe = regexp.MustCompile(`^(\S+\.(?:go|s|c|h|cc|cpp)):(\d+)(?::(\d+))?: (.+)$`)
+
+// GitHubActions reports the builds in the terms of GitHub Actions when
+// gox runs in a workflow: a group of its output and error annotations for
+// each platform, and a table of the artifacts in the job summary.
+type GitHubActions struct {
+	Out io.Writer
+
+	// SummaryPath is the job summary that the table is added to, from
+	// GITHUB_STEP_SUMMARY. There is no table if it is empty.
+	SummaryPath string
+}
+
+// DetectGitHubActions returns the GitHubActions of the workflow that gox
+// runs in, or nil outside of GitHub Actions.
+func DetectGitHubActions() *GitHubActions {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return nil
+	}
+
+	return &GitHubActions{
+		Out:         os.Stdout,
+		SummaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+	}
+}
+
+// Report writes a group for each of results, with an annotation for each
+// error that the compiler gave, and then adds the table of artifacts to
+// the job summary.
+func (g *GitHubActions) Report(results []BuildResult) error {
+	results = append([]BuildResult{}, results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if a, b := results[i].Platform.String(), results[j].Platform.String(); a != b {
+			return a < b
+		}
+		return results[i].Path < results[j].Path
+	})
+
+	for _, r := range results {
+		title := r.Platform.String() + " " + r.Path
+		if r.Variant != "" {
+			title += " (" + r.Variant + ")"
+		}
+
+		fmt.Fprintf(g.Out, "::group::%s\n", actionsEscape(title))
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(g.Out, "%s\n", strings.TrimSpace(r.Err.Error()))
+		case r.UpToDate:
+			fmt.Fprintf(g.Out, "%s is up to date\n", r.Output)
+		default:
+			fmt.Fprintf(g.Out, "Built %s\n", r.Output)
+		}
+		fmt.Fprintf(g.Out, "::endgroup::\n")
+
+		if r.Err != nil {
+			g.annotate(title, r.Err)
+		}
+	}
+
+	if g.SummaryPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(g.SummaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writeActionsSummary(f, results)
+	return nil
+}
+
+// annotate writes an error annotation for each line of err that names a
+// file, or one for the whole build if none do.
+func (g *GitHubActions) annotate(title string, err error) {
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(err.Error()))
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "Stderr: ")
+		m := actionsErrorRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		props := fmt.Sprintf("file=%s,line=%s", actionsEscapeProperty(strings.TrimPrefix(m[1], "./")), m[2])
+		if m[3] != "" {
+			props += ",col=" + m[3]
+		}
+		fmt.Fprintf(g.Out, "::error %s,title=%s::%s\n", props, actionsEscapeProperty(title), actionsEscape(m[4]))
+		found = true
+	}
+
+	if !found {
+		fmt.Fprintf(g.Out, "::error title=%s::%s\n", actionsEscapeProperty(title),
+			actionsEscape(strings.TrimSpace(err.Error())))
+	}
+}
+
+// writeActionsSummary writes the Markdown table of results for the job
+// summary.
+func writeActionsSummary(w io.Writer, results []BuildResult) {
+	fmt.Fprintf(w, "### Gox builds\n\n")
+	fmt.Fprintf(w, "| Platform | Package | Artifact | Size | Status |\n")
+	fmt.Fprintf(w, "| --- | --- | --- | ---: | --- |\n")
+	for _, r := range results {
+		platform := r.Platform.String()
+		if r.Variant != "" {
+			platform += " (" + r.Variant + ")"
+		}
+
+		status, size := "built", ""
+		switch {
+		case r.Err != nil:
+			status = "failed"
+		case r.UpToDate:
+			status = "up to date"
+		}
+		if r.Err == nil {
+			if n, err := fileSize(r.Output); err == nil {
+				size = formatSize(n)
+			}
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", platform, markdownCode(r.Path),
+			markdownCode(r.Output), size, status)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// markdownCode formats s as inline code in a Markdown table.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.Replace(s, "|", `\|`, -1) + "`"
+}
+
+// actionsEscape escapes the message of a workflow command.
+func actionsEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// actionsEscapeProperty escapes a property of a workflow command, such as
+// its file or title.
+func actionsEscapeProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(actionsEscape(s))
+}
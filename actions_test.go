@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHubActionsReport(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	binary := filepath.Join(td, "app_linux_amd64")
+	if err := ioutil.WriteFile(binary, make([]byte, 2048), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := []BuildResult{
+		{
+			Platform: Platform{OS: "windows", Arch: "amd64"},
+			Path:     "example.com/app",
+			Err:      errors.New("exit status 1\nStderr: # example.com/app\n./main.go:12:5: undefined: foo, bar\n"),
+		},
+		{
+			Platform: Platform{OS: "linux", Arch: "amd64"},
+			Path:     "example.com/app",
+			Output:   binary,
+		},
+		{
+			Platform: Platform{OS: "linux", Arch: "arm64"},
+			Path:     "example.com/app",
+			Err:      errors.New("app_linux_arm64 is dynamically linked"),
+		},
+	}
+
+	var out strings.Builder
+	summary := filepath.Join(td, "summary.md")
+	g := &GitHubActions{Out: &out, SummaryPath: summary}
+	if err := g.Report(results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "::group::linux/amd64 example.com/app\n" +
+		"Built " + binary + "\n" +
+		"::endgroup::\n" +
+		"::group::linux/arm64 example.com/app\n" +
+		"app_linux_arm64 is dynamically linked\n" +
+		"::endgroup::\n" +
+		"::error title=linux/arm64 example.com/app::app_linux_arm64 is dynamically linked\n" +
+		"::group::windows/amd64 example.com/app\n" +
+		"exit status 1\nStderr: # example.com/app\n./main.go:12:5: undefined: foo, bar\n" +
+		"::endgroup::\n" +
+		"::error file=main.go,line=12,col=5,title=windows/amd64 example.com/app::undefined: foo, bar\n"
+	if out.String() != expected {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	data, err := ioutil.ReadFile(summary)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(data), "| linux/amd64 | `example.com/app` | `"+binary+"` | 2.0 KiB | built |\n") ||
+		!strings.Contains(string(data), "| windows/amd64 | `example.com/app` |  |  | failed |\n") {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestActionsEscapeProperty(t *testing.T) {
+	actual := actionsEscapeProperty("C:\\src,1\n100%")
+	if actual != "C%3A\\src%2C1%0A100%25" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AllowFailures are the os/arch patterns of -allow-failures, such as
+// "android/*" or "linux/mips*": the platforms whose builds are best
+// effort, so that their failures are reported but don't fail the run.
+type AllowFailures []string
+
+// ParseAllowFailures parses a comma or space separated list of patterns.
+func ParseAllowFailures(s string) (AllowFailures, error) {
+	var result AllowFailures
+	for _, pattern := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if strings.Count(pattern, "/") != 1 {
+			return nil, fmt.Errorf("Invalid -allow-failures pattern %q: must be os/arch", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid -allow-failures pattern %q: %s", pattern, err)
+		}
+		result = append(result, pattern)
+	}
+
+	return result, nil
+}
+
+// Allowed reports whether a failed build for the platform is allowed. A
+// pattern matches the arch with its GOARM or level, such as linux/armv7,
+// or the arch alone.
+func (a AllowFailures) Allowed(p Platform) bool {
+	for _, pattern := range a {
+		for _, name := range []string{p.String(), p.OS + "/" + p.Arch} {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAllowFailures(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output AllowFailures
+		Err    bool
+	}{
+		{"", nil, false},
+		{"android/*,plan9/*", AllowFailures{"android/*", "plan9/*"}, false},
+		{"android/* linux/mips*", AllowFailures{"android/*", "linux/mips*"}, false},
+		{"android", nil, true},
+		{"linux/[", nil, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseAllowFailures(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("bad: %s: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestAllowFailuresAllowed(t *testing.T) {
+	allow := AllowFailures{"android/*", "linux/arm"}
+	cases := []struct {
+		Platform Platform
+		Allowed  bool
+	}{
+		{Platform{OS: "android", Arch: "arm64"}, true},
+		{Platform{OS: "linux", Arch: "arm", ARM: "7"}, true},
+		{Platform{OS: "linux", Arch: "arm64"}, false},
+		{Platform{OS: "plan9", Arch: "amd64"}, false},
+	}
+
+	for _, tc := range cases {
+		if allow.Allowed(tc.Platform) != tc.Allowed {
+			t.Fatalf("bad: %s", tc.Platform.String())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// androidDefaultAPI is the default -android-api, the oldest API level
+// that the NDKs since r26 can build for.
+const androidDefaultAPI = 21
+
+// androidTargets are the target triples of the clang of the Android NDK,
+// by arch. The clang of a triple and an API level, such as
+// aarch64-linux-android21-clang, builds for that ABI and Android version
+// without any other flags.
+var androidTargets = map[string]string{
+	"386":   "i686-linux-android",
+	"amd64": "x86_64-linux-android",
+	"arm":   "armv7a-linux-androideabi",
+	"arm64": "aarch64-linux-android",
+}
+
+// FindAndroidNDK returns the root of the Android NDK: ANDROID_NDK_HOME,
+// ANDROID_NDK_ROOT, or else the newest NDK that the SDK manager installed
+// in the ndk directory of ANDROID_HOME or ANDROID_SDK_ROOT. It is "" if
+// there is none.
+func FindAndroidNDK() string {
+	for _, key := range []string{"ANDROID_NDK_HOME", "ANDROID_NDK_ROOT"} {
+		if dir := os.Getenv(key); dir != "" {
+			return dir
+		}
+	}
+
+	for _, key := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		sdk := os.Getenv(key)
+		if sdk == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(sdk, "ndk"))
+		if err != nil {
+			continue
+		}
+		var versions []*version.Version
+		for _, e := range entries {
+			if v, err := version.NewVersion(e.Name()); err == nil && e.IsDir() {
+				versions = append(versions, v)
+			}
+		}
+		if len(versions) > 0 {
+			sort.Sort(version.Collection(versions))
+			return filepath.Join(sdk, "ndk", versions[len(versions)-1].Original())
+		}
+	}
+
+	return ""
+}
+
+// androidClang returns the clang and clang++ of the NDK at ndk that build
+// for platform at the API level api.
+func androidClang(ndk string, platform Platform, api int) (string, string, error) {
+	target, ok := androidTargets[platform.Arch]
+	if !ok {
+		return "", "", fmt.Errorf("the Android NDK can't build for %s", platform.String())
+	}
+
+	// There is one prebuilt toolchain, for the host that the NDK is for
+	hosts, _ := filepath.Glob(filepath.Join(ndk, "toolchains", "llvm", "prebuilt", "*"))
+	if len(hosts) == 0 {
+		return "", "", fmt.Errorf("%s isn't an Android NDK: it has no toolchains/llvm/prebuilt", ndk)
+	}
+	var ext string
+	if runtime.GOOS == "windows" {
+		ext = ".cmd"
+	}
+	prefix := filepath.Join(hosts[0], "bin", fmt.Sprintf("%s%d-clang", target, api))
+	if _, err := os.Stat(prefix + ext); err != nil {
+		return "", "", fmt.Errorf("the Android NDK at %s can't build for API level %d of %s: %s",
+			ndk, api, platform.String(), err)
+	}
+
+	return prefix + ext, prefix + "++" + ext, nil
+}
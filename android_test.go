@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAndroidClang(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the NDK clang of windows hosts is a .cmd")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	bin := filepath.Join(td, "toolchains", "llvm", "prebuilt", "linux-x86_64", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cc := filepath.Join(bin, "aarch64-linux-android21-clang")
+	if err := ioutil.WriteFile(cc, nil, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	platform := Platform{OS: "android", Arch: "arm64"}
+	actualCC, actualCXX, err := androidClang(td, platform, 21)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actualCC != cc || actualCXX != cc+"++" {
+		t.Fatalf("bad: %s %s", actualCC, actualCXX)
+	}
+
+	if _, _, err := androidClang(td, platform, 30); err == nil {
+		t.Fatal("should err for a missing API level")
+	}
+	if _, _, err := androidClang(td, Platform{OS: "android", Arch: "mips"}, 21); err == nil {
+		t.Fatal("should err for an unsupported arch")
+	}
+	if _, _, err := androidClang(filepath.Join(td, "bin"), platform, 21); err == nil {
+		t.Fatal("should err for a dir that isn't an NDK")
+	}
+
+	opts := &CompileOpts{
+		Platform:   platform,
+		Cgo:        true,
+		AndroidNDK: td,
+		AndroidAPI: 21,
+	}
+	found := 0
+	for _, e := range opts.buildEnv() {
+		if e == "CC="+cc || e == "CXX="+cc+"++" {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("bad: %#v", opts.buildEnv())
+	}
+}
+
+func TestFindAndroidNDK(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	for _, v := range []string{"25.1.8937393", "26.1.10909125", "not-a-version"} {
+		if err := os.MkdirAll(filepath.Join(td, "ndk", v), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	for _, key := range []string{"ANDROID_NDK_HOME", "ANDROID_NDK_ROOT", "ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+	if v := FindAndroidNDK(); v != "" {
+		t.Fatalf("bad: %s", v)
+	}
+
+	os.Setenv("ANDROID_HOME", td)
+	if v := FindAndroidNDK(); v != filepath.Join(td, "ndk", "26.1.10909125") {
+		t.Fatalf("bad: %s", v)
+	}
+
+	os.Setenv("ANDROID_NDK_HOME", "/opt/ndk")
+	if v := FindAndroidNDK(); v != "/opt/ndk" {
+		t.Fatalf("bad: %s", v)
+	}
+}
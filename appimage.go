@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AppImageConfig is the "appimage" section of the config file. It packs
+// each linux/amd64 and linux/arm64 binary into an AppImage with
+// appimagetool (https://appimage.github.io/appimagetool), which must be
+// installed. The desktop entry and icon come from the "desktop" section.
+type AppImageConfig struct {
+	// Command is the appimagetool executable, defaults to
+	// "appimagetool".
+	Command string `json:"command,omitempty"`
+
+	// Output is the directory AppImages are written to, defaults to the
+	// directory of each binary.
+	Output string `json:"output,omitempty"`
+
+	// Name is the name of the AppImage, defaults to the name of the
+	// binary. Version defaults to the release version.
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// appImageArches maps GOARCH to the ARCH that appimagetool takes.
+var appImageArches = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+func (c *AppImageConfig) command() string {
+	if c.Command == "" {
+		return "appimagetool"
+	}
+	return c.Command
+}
+
+// writeAppDir lays out the AppDir of binary in dir: the binary in
+// usr/bin, the desktop entry and icon at the root, and an AppRun link to
+// the binary.
+func writeAppDir(dir string, desktop *DesktopConfig, binary string) error {
+	name := filepath.Base(binary)
+	if err := copyFile(binary, filepath.Join(dir, "usr", "bin", name), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(filepath.Join("usr", "bin", name), filepath.Join(dir, "AppRun")); err != nil {
+		return err
+	}
+
+	icon := filepath.Join(dir, name+filepath.Ext(desktop.Icon))
+	if err := copyFile(desktop.Icon, icon, 0644); err != nil {
+		return err
+	}
+	if err := os.Symlink(filepath.Base(icon), filepath.Join(dir, ".DirIcon")); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name+".desktop"), desktop.entry(name, name, name), 0644)
+}
+
+// AppImagePackage packs binary into an AppImage and returns its path.
+func AppImagePackage(c *AppImageConfig, desktop *DesktopConfig, binary string, platform Platform, version string) (string, error) {
+	arch, ok := appImageArches[platform.Arch]
+	if !ok {
+		return "", fmt.Errorf("AppImages can't be made for %s", platform.String())
+	}
+	if c.Version != "" {
+		version = c.Version
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(td)
+	appDir := filepath.Join(td, "AppDir")
+	if err := writeAppDir(appDir, desktop, binary); err != nil {
+		return "", err
+	}
+
+	outDir := c.Output
+	if outDir == "" {
+		outDir = filepath.Dir(binary)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", err
+	}
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(binary)
+	}
+	target := filepath.Join(outDir, fmt.Sprintf("%s-%s-%s.AppImage", name, version, arch))
+
+	env := append(os.Environ(), "ARCH="+arch)
+	if _, err := execGo(c.command(), env, "", "--no-appstream", appDir, target); err != nil {
+		return "", fmt.Errorf("appimagetool failed: %s", strings.TrimSpace(err.Error()))
+	}
+
+	return target, nil
+}
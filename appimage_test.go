@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAppDir(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	binary := filepath.Join(td, "mytool")
+	icon := filepath.Join(td, "icon.png")
+	ioutil.WriteFile(binary, []byte("binary"), 0755)
+	ioutil.WriteFile(icon, []byte("png"), 0644)
+
+	dir := filepath.Join(td, "AppDir")
+	desktop := &DesktopConfig{Name: "My Tool", Icon: icon, Terminal: true}
+	if err := writeAppDir(dir, desktop, binary); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(dir, "AppRun")); err != nil || link != filepath.Join("usr", "bin", "mytool") {
+		t.Fatalf("bad: %s %s", link, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, ".DirIcon")); err != nil || link != "mytool.png" {
+		t.Fatalf("bad: %s %s", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usr", "bin", "mytool")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mytool.desktop"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "[Desktop Entry]\nType=Application\nName=My Tool\nExec=mytool\nIcon=mytool\n" +
+		"Categories=Utility;\nTerminal=true\n"
+	if string(data) != expected {
+		t.Fatalf("bad:\n%s", data)
+	}
+}
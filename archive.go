@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveFile is a file to put in an archive or directory. The contents
+// come from Src if set, and from Data otherwise.
+type archiveFile struct {
+	Name string
+	Src  string
+	Data []byte
+	Mode os.FileMode
+}
+
+func (f *archiveFile) open() (io.ReadCloser, int64, error) {
+	if f.Src == "" {
+		return ioutil.NopCloser(bytes.NewReader(f.Data)), int64(len(f.Data)), nil
+	}
+
+	r, err := os.Open(f.Src)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := r.Stat()
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	return r, info.Size(), nil
+}
+
+// archiveFormat returns the archive format for path from its extension:
+// "zip", "tar.gz" or "tar".
+func archiveFormat(path string) (string, error) {
+	switch {
+	case strings.HasSuffix(path, ".zip"), strings.HasSuffix(path, ".whl"), strings.HasSuffix(path, ".nupkg"):
+		// Python wheels and NuGet packages are zip files
+		return "zip", nil
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(path, ".tar"):
+		return "tar", nil
+	}
+
+	return "", fmt.Errorf("unknown archive format for %s: must be .zip, .tar.gz, .tgz or .tar", path)
+}
+
+// writeArchive writes files to an archive at path, in the format given by
+// its extension. Every file is put under the root directory, if set.
+func writeArchive(path string, root string, files []archiveFile) error {
+	format, err := archiveFormat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Sort the files and give them all the same timestamp, so that the
+	// archive only depends on their names and contents. That makes it
+	// reproducible when SOURCE_DATE_EPOCH is set.
+	files = append([]archiveFile(nil), files...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	now := artifactTime()
+	switch format {
+	case "zip":
+		zw := zip.NewWriter(out)
+		for _, f := range files {
+			if err := writeZipFile(zw, root, &f, now); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	default:
+		var w io.Writer = out
+		var gz *gzip.Writer
+		if format == "tar.gz" {
+			gz = gzip.NewWriter(out)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		for _, f := range files {
+			if err := writeTarFile(tw, root, &f, now); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return out.Close()
+}
+
+func writeZipFile(zw *zip.Writer, root string, f *archiveFile, modTime time.Time) error {
+	r, _, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hdr := &zip.FileHeader{
+		Name:   archiveName(root, f.Name),
+		Method: zip.Deflate,
+	}
+	hdr.Modified = modTime
+	hdr.SetMode(f.Mode)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, root string, f *archiveFile, modTime time.Time) error {
+	r, size, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hdr := &tar.Header{
+		Name:    archiveName(root, f.Name),
+		Mode:    int64(f.Mode.Perm()),
+		Size:    size,
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+func archiveName(root, name string) string {
+	name = filepath.ToSlash(name)
+	if root == "" {
+		return name
+	}
+	return root + "/" + name
+}
+
+// writeFiles writes files to the directory dir.
+func writeFiles(dir string, files []archiveFile) error {
+	for _, f := range files {
+		dst := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if f.Src != "" {
+			if err := copyFile(f.Src, dst, f.Mode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, f.Data, f.Mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dirFiles returns every file under dir as files to archive, named by
+// their slash-separated path relative to dir under prefix.
+func dirFiles(dir string, prefix string) ([]archiveFile, error) {
+	var files []archiveFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, archiveFile{
+			Name: prefix + filepath.ToSlash(rel),
+			Src:  path,
+			Mode: info.Mode().Perm(),
+		})
+		return nil
+	})
+
+	return files, err
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ArchiveConfig is the "archives" section of the config file. It packs
+// each binary into an archive of its own, named for its platform, which
+// is what releases usually ship.
+type ArchiveConfig struct {
+	// Name is the template for the file name of each archive, without
+	// the extension. See archiveData for the fields. Defaults to
+	// "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}".
+	Name string `json:"name,omitempty"`
+
+	// Binary is the template for the name of the binary in the archive,
+	// defaults to "{{.Dir}}". ".exe" is added for windows.
+	Binary string `json:"binary,omitempty"`
+
+	// Format is "tar.gz", "zip" or "tar", defaults to "tar.gz".
+	// FormatOverrides sets it per GOOS, such as {"windows": "zip"}.
+	Format          string            `json:"format,omitempty"`
+	FormatOverrides map[string]string `json:"format_overrides,omitempty"`
+
+	// Output is the directory archives are written to, defaults to
+	// "dist".
+	Output string `json:"output,omitempty"`
+
+	// Files are put in every archive along with the binary, such as the
+	// LICENSE, README.md and shell completions.
+	Files []ArchiveFiles `json:"files,omitempty"`
+}
+
+// ArchiveFiles are files that go into the archives.
+type ArchiveFiles struct {
+	// Src is a glob of the files, such as "LICENSE*" or "completions/*",
+	// relative to the current directory. Directories that match go in
+	// with everything in them.
+	Src string `json:"src"`
+
+	// Dst is the directory in the archive that they go into, defaults to
+	// the top.
+	Dst string `json:"dst,omitempty"`
+
+	// OS limits the files to the archives of these GOOS, such as "linux"
+	// for systemd units, and ExcludeOS leaves them out of those.
+	OS        []string `json:"os,omitempty"`
+	ExcludeOS []string `json:"exclude_os,omitempty"`
+}
+
+// archiveData is what the Name and Binary templates are executed with.
+// Arch includes the GOARM version or micro-architecture level, GOARCH
+// doesn't, for names that must use GOARCH values.
+type archiveData struct {
+	Dir     string
+	OS      string
+	Arch    string
+	GOARCH  string
+	ARM     string
+	Version string
+}
+
+// Validate checks the templates and formats.
+func (c *ArchiveConfig) Validate() error {
+	for _, tpl := range []string{c.Name, c.Binary} {
+		if _, err := template.New("archive").Parse(tpl); err != nil {
+			return fmt.Errorf("archives: %s", err)
+		}
+	}
+
+	formats := []string{c.format("")}
+	for _, f := range c.FormatOverrides {
+		formats = append(formats, f)
+	}
+	for _, f := range formats {
+		if _, err := archiveFormat("archive." + f); err != nil {
+			return fmt.Errorf("archives: unknown format %q", f)
+		}
+	}
+
+	for _, f := range c.Files {
+		if f.Src == "" {
+			return fmt.Errorf("archives: files: src is required")
+		}
+		if _, err := filepath.Match(f.Src, ""); err != nil {
+			return fmt.Errorf("archives: files: invalid src %q: %s", f.Src, err)
+		}
+		if filepath.IsAbs(f.Dst) || strings.HasPrefix(filepath.Clean(f.Dst), "..") {
+			return fmt.Errorf("archives: files: dst %q must be a relative path in the archive", f.Dst)
+		}
+	}
+
+	return nil
+}
+
+func (c *ArchiveConfig) format(goos string) string {
+	if f, ok := c.FormatOverrides[goos]; ok {
+		return f
+	}
+	if c.Format == "" {
+		return "tar.gz"
+	}
+	return c.Format
+}
+
+func (c *ArchiveConfig) output() string {
+	if c.Output == "" {
+		return "dist"
+	}
+	return c.Output
+}
+
+// Path returns the path of the archive for the binary of r.
+func (c *ArchiveConfig) Path(r BuildResult, version string) (string, error) {
+	name := c.Name
+	if name == "" {
+		name = "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}"
+	}
+	name, err := executeArchiveTemplate(name, r, version)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(c.output(), name+"."+c.format(r.Platform.OS)), nil
+}
+
+// BuildArchive writes the archive for the binary of r, with the extra
+// files after it, and returns its path.
+func (c *ArchiveConfig) BuildArchive(r BuildResult, version string, extra []archiveFile) (string, error) {
+	path, err := c.Path(r, version)
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := c.binaryName(r, version)
+	if err != nil {
+		return "", err
+	}
+
+	files := []archiveFile{{
+		Name: binary + outputExt(r.Platform.OS, ""),
+		Src:  r.Output,
+		Mode: 0755,
+	}}
+	more, err := c.files(r.Platform.OS)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, more...)
+	files = append(files, extra...)
+	if err := writeArchive(path, "", files); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// files returns the Files that go into the archives of goos.
+func (c *ArchiveConfig) files(goos string) ([]archiveFile, error) {
+	has := func(oses []string) bool {
+		for _, o := range oses {
+			if o == goos {
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []archiveFile
+	for _, f := range c.Files {
+		if len(f.OS) > 0 && !has(f.OS) || has(f.ExcludeOS) {
+			continue
+		}
+
+		matches, err := filepath.Glob(f.Src)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", f.Src)
+		}
+		for _, match := range matches {
+			// Files are named relative to the directory of the match, so
+			// a matched directory keeps its name
+			base := filepath.Dir(match)
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(base, path)
+				if err != nil {
+					return err
+				}
+				files = append(files, archiveFile{
+					Name: filepath.ToSlash(filepath.Join(f.Dst, rel)),
+					Src:  path,
+					Mode: info.Mode().Perm(),
+				})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// binaryName returns the name of the binary of r in its archive, without
+// the extension.
+func (c *ArchiveConfig) binaryName(r BuildResult, version string) (string, error) {
+	binary := c.Binary
+	if binary == "" {
+		binary = "{{.Dir}}"
+	}
+	return executeArchiveTemplate(binary, r, version)
+}
+
+func executeArchiveTemplate(tpl string, r BuildResult, version string) (string, error) {
+	t, err := template.New("archive").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, &archiveData{
+		Dir:     filepath.Base(r.Path),
+		OS:      r.Platform.OS,
+		Arch:    r.Platform.GetArch(),
+		GOARCH:  r.Platform.Arch,
+		ARM:     r.Platform.ARM,
+		Version: version,
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ChecksumConfig is the "checksums" section of the config file. It writes
+// a file with the SHA-256 of every archive, or of every binary if there
+// are no archives, in the format of sha256sum.
+type ChecksumConfig struct {
+	// Name is the template for the file name, with {{.Version}}.
+	// Defaults to "SHA256SUMS".
+	Name string `json:"name,omitempty"`
+
+	// Output is the directory it is written to, defaults to that of the
+	// archives, or the current directory.
+	Output string `json:"output,omitempty"`
+}
+
+// Validate checks the name template.
+func (c *ChecksumConfig) Validate() error {
+	if _, err := template.New("checksums").Parse(c.Name); err != nil {
+		return fmt.Errorf("checksums: %s", err)
+	}
+
+	return nil
+}
+
+// WriteChecksums writes the checksums of files to the checksums file in
+// dir, unless Output is set, and returns its path.
+func (c *ChecksumConfig) WriteChecksums(dir string, files []string, version string) (string, error) {
+	name, err := c.FileName(version)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Output != "" {
+		dir = c.Output
+	}
+	path := filepath.Join(dir, name)
+
+	sums, err := checksums(files)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, sums, 0644)
+}
+
+// FileName returns the name of the checksums file for version. It is nil
+// safe, for the default name.
+func (c *ChecksumConfig) FileName(version string) (string, error) {
+	name := "SHA256SUMS"
+	if c != nil && c.Name != "" {
+		name = c.Name
+	}
+	t, err := template.New("checksums").Parse(name)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]string{"Version": version}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// checksums returns the lines of sha256sum for files, sorted by name.
+func checksums(files []string) ([]byte, error) {
+	sorted := make([]string, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool {
+		return filepath.Base(sorted[i]) < filepath.Base(sorted[j])
+	})
+
+	var buf bytes.Buffer
+	for _, path := range sorted {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&buf, "%s  %s\n", sum, filepath.Base(path))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	if sum, ok := cachedSHA256(path); ok {
+		return sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
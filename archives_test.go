@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config ArchiveConfig
+		Err    bool
+	}{
+		{ArchiveConfig{}, false},
+		{ArchiveConfig{Format: "zip", FormatOverrides: map[string]string{"linux": "tar"}}, false},
+		{ArchiveConfig{Format: "rar"}, true},
+		{ArchiveConfig{FormatOverrides: map[string]string{"windows": "7z"}}, true},
+		{ArchiveConfig{Name: "{{.Dir"}, true},
+		{ArchiveConfig{Binary: "{{.Dir"}, true},
+		{ArchiveConfig{Files: []ArchiveFiles{{Src: "LICENSE", Dst: "doc"}}}, false},
+		{ArchiveConfig{Files: []ArchiveFiles{{Dst: "doc"}}}, true},
+		{ArchiveConfig{Files: []ArchiveFiles{{Src: "[LICENSE"}}}, true},
+		{ArchiveConfig{Files: []ArchiveFiles{{Src: "LICENSE", Dst: "../doc"}}}, true},
+	}
+
+	for _, tc := range cases {
+		if err := tc.Config.Validate(); (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestArchiveConfigPath(t *testing.T) {
+	cases := []struct {
+		Config   ArchiveConfig
+		Platform Platform
+		Output   string
+	}{
+		{
+			ArchiveConfig{},
+			Platform{OS: "linux", Arch: "amd64"},
+			"dist/app_1.2.3_linux_amd64.tar.gz",
+		},
+		{
+			ArchiveConfig{FormatOverrides: map[string]string{"windows": "zip"}, Output: "out"},
+			Platform{OS: "windows", Arch: "arm64"},
+			"out/app_1.2.3_windows_arm64.zip",
+		},
+		{
+			ArchiveConfig{Name: "app_{{.OS}}_{{.GOARCH}}", Format: "zip"},
+			Platform{OS: "linux", Arch: "arm", ARM: "6"},
+			"dist/app_linux_arm.zip",
+		},
+		{
+			ArchiveConfig{},
+			Platform{OS: "linux", Arch: "arm", ARM: "7"},
+			"dist/app_1.2.3_linux_armv7.tar.gz",
+		},
+	}
+
+	for _, tc := range cases {
+		path, err := tc.Config.Path(BuildResult{
+			Platform: tc.Platform,
+			Path:     "example.com/app",
+		}, "1.2.3")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if path != filepath.FromSlash(tc.Output) {
+			t.Fatalf("%s: bad: %s", tc.Platform.String(), path)
+		}
+	}
+}
+
+func TestArchiveConfigBuildArchive(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "app_windows_amd64.exe")
+	if err := ioutil.WriteFile(output, []byte("binary"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := &ArchiveConfig{
+		Binary: "{{.Dir}}_v{{.Version}}",
+		Format: "zip",
+		Output: filepath.Join(td, "dist"),
+	}
+	path, err := c.BuildArchive(BuildResult{
+		Platform: Platform{OS: "windows", Arch: "amd64"},
+		Path:     "example.com/app",
+		Output:   output,
+	}, "1.2.3", []archiveFile{{Name: notesName, Data: []byte("Fixes"), Mode: 0644}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filepath.Base(path) != "app_1.2.3_windows_amd64.zip" {
+		t.Fatalf("bad: %s", path)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer zr.Close()
+	// The files are sorted by name
+	if len(zr.File) != 2 || zr.File[0].Name != notesName || zr.File[1].Name != "app_v1.2.3.exe" {
+		t.Fatalf("bad: %#v", zr.File)
+	}
+}
+
+func TestChecksumConfigWriteChecksums(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var files []string
+	for _, name := range []string{"b.zip", "a.zip"} {
+		path := filepath.Join(td, name)
+		if err := ioutil.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		files = append(files, path)
+	}
+
+	c := &ChecksumConfig{Name: "app_{{.Version}}_SHA256SUMS"}
+	path, err := c.WriteChecksums(td, files, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != filepath.Join(td, "app_1.2.3_SHA256SUMS") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	expected := sum + "  a.zip\n" + sum + "  b.zip\n"
+	if string(data) != expected {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestArchiveConfigFiles(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	for _, name := range []string{"LICENSE", "completions/app.bash", "completions/app.fish", "deploy/app.service"} {
+		path := filepath.Join(td, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(name), 0644)
+	}
+
+	c := &ArchiveConfig{Files: []ArchiveFiles{
+		{Src: filepath.Join(td, "LICENSE")},
+		{Src: filepath.Join(td, "completions"), ExcludeOS: []string{"windows"}},
+		{Src: filepath.Join(td, "deploy", "*.service"), Dst: "systemd", OS: []string{"linux"}},
+	}}
+	cases := map[string][]string{
+		"linux":   {"LICENSE", "completions/app.bash", "completions/app.fish", "systemd/app.service"},
+		"darwin":  {"LICENSE", "completions/app.bash", "completions/app.fish"},
+		"windows": {"LICENSE"},
+	}
+	for goos, expected := range cases {
+		files, err := c.files(goos)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("bad: %s: %#v", goos, names)
+		}
+	}
+
+	c.Files = append(c.Files, ArchiveFiles{Src: filepath.Join(td, "README*")})
+	if _, err := c.files("linux"); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AurConfig is the "aur" section of the config file. It writes the
+// PKGBUILD and .SRCINFO of a -bin package for the AUR that installs the
+// linux archives of a binary, and can push them to its AUR git remote.
+type AurConfig struct {
+	// Name is the name of the package, defaults to the directory of the
+	// main package with "-bin" added. It provides and conflicts with the
+	// name without "-bin". Package picks the main package when several
+	// are built.
+	Name    string `json:"name,omitempty"`
+	Package string `json:"package,omitempty"`
+
+	Description string   `json:"description,omitempty"`
+	Homepage    string   `json:"homepage,omitempty"`
+	License     string   `json:"license,omitempty"`
+	Maintainer  string   `json:"maintainer,omitempty"`
+	Depends     []string `json:"depends,omitempty"`
+
+	// Release is the pkgrel, defaults to 1.
+	Release int `json:"release,omitempty"`
+
+	// URL is the template for where each archive is downloaded from, as
+	// in HomebrewConfig.
+	URL string `json:"url"`
+
+	// Output is the directory the files are written to, defaults to
+	// "aur" in that of the archives.
+	Output string `json:"output,omitempty"`
+
+	// Repository, if set, is the AUR remote that -publish pushes to, such
+	// as "ssh://aur@aur.archlinux.org/myapp-bin.git".
+	Repository *RepoConfig `json:"repository,omitempty"`
+}
+
+// aurArch returns the Arch Linux architecture of platform, or "" if Arch
+// Linux or Arch Linux ARM doesn't run on it.
+func aurArch(platform Platform) string {
+	switch platform.Arch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		// Go builds for GOARM=7 when cross compiling without it
+		switch platform.ARM {
+		case "", "7":
+			return "armv7h"
+		case "6":
+			return "armv6h"
+		}
+	}
+	return ""
+}
+
+// aurSource is the archive of the package for one architecture.
+type aurSource struct {
+	Arch   string
+	Source string
+	SHA256 string
+}
+
+// Validate checks the url template, that release is positive and the
+// repository, if any.
+func (c *AurConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("aur: url is required")
+	}
+	if err := validateURLTemplate("aur", c.URL); err != nil {
+		return err
+	}
+	if c.Release < 0 {
+		return fmt.Errorf("aur: release must be positive")
+	}
+	if c.Repository != nil {
+		if err := c.Repository.Validate("aur: repository"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *AurConfig) release() int {
+	if c.Release == 0 {
+		return 1
+	}
+	return c.Release
+}
+
+// aurVersion makes version a pkgver, which can't have hyphens.
+func aurVersion(version string) string {
+	return strings.Replace(version, "-", "_", -1)
+}
+
+// WriteAurPackage writes the PKGBUILD and .SRCINFO for the linux archives
+// of results and returns their paths.
+func WriteAurPackage(c *AurConfig, archives *ArchiveConfig, results []BuildResult, version string) ([]string, error) {
+	builds, err := releaseBuilds(c.Package, results, "linux")
+	if err != nil {
+		return nil, err
+	}
+
+	binary, err := archives.binaryName(builds[0], version)
+	if err != nil {
+		return nil, err
+	}
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(builds[0].Path) + "-bin"
+	}
+	provides := strings.TrimSuffix(name, "-bin")
+
+	// Each of arm v6 and v7 is an architecture of its own, the other
+	// arches are picked like for every package manager
+	picked := pickBuilds("linux", []string{"amd64", "386", "arm64"}, builds)
+	arm := make(map[string]bool)
+	for _, r := range builds {
+		if arch := aurArch(r.Platform); r.Platform.Arch == "arm" && arch != "" && !arm[arch] {
+			arm[arch] = true
+			picked = append(picked, r)
+		}
+	}
+
+	var sources []aurSource
+	for _, r := range picked {
+		arch := aurArch(r.Platform)
+		if arch == "" {
+			continue
+		}
+		path, err := archives.Path(r, version)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		url, err := releaseURL(c.URL, path, r, version)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, aurSource{arch, filepath.Base(path) + "::" + url, sum})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no linux binaries for an architecture of Arch Linux")
+	}
+
+	release := c.release()
+	pkgver := aurVersion(version)
+
+	var pkgbuild bytes.Buffer
+	if c.Maintainer != "" {
+		fmt.Fprintf(&pkgbuild, "# Maintainer: %s\n", c.Maintainer)
+	}
+	fmt.Fprintf(&pkgbuild, "# Generated by gox, do not edit.\n\n")
+	fmt.Fprintf(&pkgbuild, "pkgname=%s\npkgver=%s\npkgrel=%d\n", name, pkgver, release)
+	if c.Description != "" {
+		fmt.Fprintf(&pkgbuild, "pkgdesc=%s\n", shellQuote(c.Description))
+	}
+	var arches []string
+	for _, s := range sources {
+		arches = append(arches, s.Arch)
+	}
+	fmt.Fprintf(&pkgbuild, "arch=%s\n", bashArray(arches))
+	if c.Homepage != "" {
+		fmt.Fprintf(&pkgbuild, "url=%s\n", shellQuote(c.Homepage))
+	}
+	if c.License != "" {
+		fmt.Fprintf(&pkgbuild, "license=%s\n", bashArray([]string{c.License}))
+	}
+	if len(c.Depends) > 0 {
+		fmt.Fprintf(&pkgbuild, "depends=%s\n", bashArray(c.Depends))
+	}
+	fmt.Fprintf(&pkgbuild, "provides=%s\nconflicts=%s\n", bashArray([]string{provides}), bashArray([]string{provides}))
+	for _, s := range sources {
+		fmt.Fprintf(&pkgbuild, "source_%s=%s\n", s.Arch, bashArray([]string{s.Source}))
+		fmt.Fprintf(&pkgbuild, "sha256sums_%s=%s\n", s.Arch, bashArray([]string{s.SHA256}))
+	}
+	fmt.Fprintf(&pkgbuild, "\npackage() {\n  install -Dm755 \"${srcdir}/%s\" \"${pkgdir}/usr/bin/%s\"\n}\n",
+		binary, binary)
+
+	var srcinfo bytes.Buffer
+	fields := func(key string, values ...string) {
+		for _, v := range values {
+			if v != "" {
+				fmt.Fprintf(&srcinfo, "\t%s = %s\n", key, v)
+			}
+		}
+	}
+	fmt.Fprintf(&srcinfo, "pkgbase = %s\n", name)
+	fields("pkgdesc", c.Description)
+	fields("pkgver", pkgver)
+	fields("pkgrel", fmt.Sprint(release))
+	fields("url", c.Homepage)
+	fields("arch", arches...)
+	fields("license", c.License)
+	fields("depends", c.Depends...)
+	fields("provides", provides)
+	fields("conflicts", provides)
+	for _, s := range sources {
+		fields("source_"+s.Arch, s.Source)
+		fields("sha256sums_"+s.Arch, s.SHA256)
+	}
+	fmt.Fprintf(&srcinfo, "\npkgname = %s\n", name)
+
+	dir := c.Output
+	if dir == "" {
+		dir = filepath.Join(archives.output(), "aur")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range []struct {
+		Name string
+		Data []byte
+	}{{"PKGBUILD", pkgbuild.Bytes()}, {".SRCINFO", srcinfo.Bytes()}} {
+		path := filepath.Join(dir, f.Name)
+		if err := ioutil.WriteFile(path, f.Data, 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// bashArray writes values as a bash array.
+func bashArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.Replace(v, "'", `'\''`, -1) + "'"
+	}
+	return "(" + strings.Join(quoted, " ") + ")"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAurArch(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Arch     string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "x86_64"},
+		{Platform{OS: "linux", Arch: "amd64", Level: "v3"}, "x86_64"},
+		{Platform{OS: "linux", Arch: "arm64"}, "aarch64"},
+		{Platform{OS: "linux", Arch: "arm"}, "armv7h"},
+		{Platform{OS: "linux", Arch: "arm", ARM: "6"}, "armv6h"},
+		{Platform{OS: "linux", Arch: "arm", ARM: "5"}, ""},
+		{Platform{OS: "linux", Arch: "riscv64"}, ""},
+	}
+
+	for _, tc := range cases {
+		if actual := aurArch(tc.Platform); actual != tc.Arch {
+			t.Fatalf("%#v: bad: %s", tc.Platform, actual)
+		}
+	}
+}
+
+func TestWriteAurPackage(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td}
+	var results []BuildResult
+	for _, p := range []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "6"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "linux", Arch: "riscv64"},
+		{OS: "darwin", Arch: "arm64"},
+	} {
+		r := BuildResult{Platform: p, Path: "example.com/app"}
+		path, _ := archives.Path(r, "1.2.3-rc1")
+		if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, r)
+	}
+
+	c := &AurConfig{
+		Description: "Don't panic",
+		License:     "MIT",
+		URL:         "https://example.com/{{.Name}}",
+	}
+	paths, err := WriteAurPackage(c, archives, results, "1.2.3-rc1")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(paths) != 2 || paths[0] != filepath.Join(td, "aur", "PKGBUILD") {
+		t.Fatalf("bad: %#v", paths)
+	}
+
+	sum, _ := fileSHA256(filepath.Join(td, "app_1.2.3-rc1_linux_amd64.tar.gz"))
+	pkgbuild, _ := ioutil.ReadFile(paths[0])
+	for _, expected := range []string{
+		"pkgname=app-bin\npkgver=1.2.3_rc1\npkgrel=1\n",
+		`pkgdesc='Don'\''t panic'` + "\n",
+		"arch=('x86_64' 'armv6h' 'armv7h')\n",
+		"provides=('app')\nconflicts=('app')\n",
+		"source_x86_64=('app_1.2.3-rc1_linux_amd64.tar.gz::https://example.com/app_1.2.3-rc1_linux_amd64.tar.gz')\n" +
+			"sha256sums_x86_64=('" + sum + "')\n",
+		`install -Dm755 "${srcdir}/app" "${pkgdir}/usr/bin/app"`,
+	} {
+		if !strings.Contains(string(pkgbuild), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, pkgbuild)
+		}
+	}
+
+	srcinfo, _ := ioutil.ReadFile(paths[1])
+	for _, expected := range []string{
+		"pkgbase = app-bin\n\tpkgdesc = Don't panic\n\tpkgver = 1.2.3_rc1\n\tpkgrel = 1\n",
+		"\tarch = x86_64\n\tarch = armv6h\n\tarch = armv7h\n",
+		"\tsha256sums_armv7h = " + sum + "\n\npkgname = app-bin\n",
+	} {
+		if !strings.Contains(string(srcinfo), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, srcinfo)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// AuthenticodeConfig is the "authenticode" section of the config file.
+// It signs windows binaries, either with osslsigncode and a local
+// certificate, or with an arbitrary command such as a client for a remote
+// signing service.
+type AuthenticodeConfig struct {
+	// Command, if set, is run to sign each binary in place instead of
+	// osslsigncode. Each argument is a Go text template with the fields
+	// {{.Path}}, {{.Name}} and {{.Timestamp}}.
+	Command []string `json:"command,omitempty"`
+
+	// PKCS12 is a .pfx/.p12 file with the certificate and key. Otherwise
+	// Cert and Key are the PEM or DER certificate chain and key files.
+	PKCS12 string `json:"pkcs12,omitempty"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+
+	// PasswordEnv is the environment variable that holds the password of
+	// the key, so that it doesn't have to be in the config file.
+	PasswordEnv string `json:"password_env,omitempty"`
+
+	// Name and URL describe the signed program.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	// Timestamp is the URL of an RFC 3161 timestamping server, such as
+	// http://timestamp.digicert.com. Without a timestamp, signatures
+	// stop validating when the certificate expires.
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// AuthenticodeTemplateData is the data for custom signing commands.
+type AuthenticodeTemplateData struct {
+	Path      string
+	Name      string
+	Timestamp string
+}
+
+// Validate checks that exactly one way of signing is configured.
+func (c *AuthenticodeConfig) Validate() error {
+	n := 0
+	if len(c.Command) > 0 {
+		n++
+	}
+	if c.PKCS12 != "" {
+		n++
+	}
+	if c.Cert != "" || c.Key != "" {
+		if c.Cert == "" || c.Key == "" {
+			return fmt.Errorf("authenticode: cert and key must both be set")
+		}
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("authenticode: exactly one of command, pkcs12, or cert and key must be set")
+	}
+
+	return nil
+}
+
+// osslsigncodeArgs are the arguments for signing in to out. passFile is
+// the file holding the key password, if any.
+func (c *AuthenticodeConfig) osslsigncodeArgs(in, out, passFile string) []string {
+	args := []string{"sign", "-h", "sha256"}
+	if c.PKCS12 != "" {
+		args = append(args, "-pkcs12", c.PKCS12)
+	} else {
+		args = append(args, "-certs", c.Cert, "-key", c.Key)
+	}
+	if passFile != "" {
+		args = append(args, "-readpass", passFile)
+	}
+	if c.Name != "" {
+		args = append(args, "-n", c.Name)
+	}
+	if c.URL != "" {
+		args = append(args, "-i", c.URL)
+	}
+	if c.Timestamp != "" {
+		args = append(args, "-ts", c.Timestamp)
+	}
+
+	return append(args, "-in", in, "-out", out)
+}
+
+// Authenticode signs the windows binary at path in place.
+func Authenticode(c *AuthenticodeConfig, path string) error {
+	if len(c.Command) > 0 {
+		return authenticodeCommand(c, path)
+	}
+
+	// osslsigncode can't sign in place, so sign to a temporary file in
+	// the same directory and move it over the original.
+	out := path + ".signed"
+	defer os.Remove(out)
+
+	// Pass the password in a file so it doesn't show up in ps
+	var passFile string
+	if c.PasswordEnv != "" {
+		td, err := ioutil.TempDir("", "gox")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(td)
+
+		passFile = filepath.Join(td, "pass")
+		if err := ioutil.WriteFile(passFile, []byte(getenvSecret(c.PasswordEnv)), 0600); err != nil {
+			return err
+		}
+	}
+
+	if _, err := execGo("osslsigncode", nil, "", c.osslsigncodeArgs(path, out, passFile)...); err != nil {
+		return fmt.Errorf("osslsigncode: %s", err)
+	}
+
+	return os.Rename(out, path)
+}
+
+func authenticodeCommand(c *AuthenticodeConfig, path string) error {
+	data := &AuthenticodeTemplateData{
+		Path:      path,
+		Name:      c.Name,
+		Timestamp: c.Timestamp,
+	}
+
+	args := make([]string, len(c.Command))
+	for i, v := range c.Command {
+		tpl, err := template.New("command").Parse(v)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		args[i] = buf.String()
+	}
+
+	if _, err := execGo(args[0], secretEnviron(), "", args[1:]...); err != nil {
+		return fmt.Errorf("%s: %s", args[0], err)
+	}
+
+	return nil
+}
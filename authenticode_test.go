@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticodeConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config AuthenticodeConfig
+		Err    bool
+	}{
+		{AuthenticodeConfig{}, true},
+		{AuthenticodeConfig{PKCS12: "a.pfx"}, false},
+		{AuthenticodeConfig{Cert: "a.pem", Key: "a.key"}, false},
+		{AuthenticodeConfig{Cert: "a.pem"}, true},
+		{AuthenticodeConfig{Command: []string{"sign", "{{.Path}}"}}, false},
+		{AuthenticodeConfig{Command: []string{"sign"}, PKCS12: "a.pfx"}, true},
+	}
+
+	for i, tc := range cases {
+		err := tc.Config.Validate()
+		if (err != nil) != tc.Err {
+			t.Errorf("%d: err: %v", i, err)
+		}
+	}
+}
+
+func TestAuthenticodeConfigOsslsigncodeArgs(t *testing.T) {
+	c := &AuthenticodeConfig{
+		PKCS12:    "a.pfx",
+		Name:      "App",
+		Timestamp: "http://ts.example.com",
+	}
+	expected := []string{
+		"sign", "-h", "sha256",
+		"-pkcs12", "a.pfx",
+		"-readpass", "/tmp/pass",
+		"-n", "App",
+		"-ts", "http://ts.example.com",
+		"-in", "app.exe", "-out", "app.exe.signed",
+	}
+	actual := c.osslsigncodeArgs("app.exe", "app.exe.signed", "/tmp/pass")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadLimiter limits the bandwidth of every upload of -publish together,
+// or is nil without -bandwidth-limit. It covers the "uploads" and the
+// assets of the "release", but not the pushes of git, which run in a
+// process of their own, or those of "gox image".
+var uploadLimiter *rateLimiter
+
+// uploadChunk is the most that a limited upload reads at once, so that
+// the parallel uploads take turns rather than one sending a whole file.
+const uploadChunk = 32 * 1024
+
+// parseBandwidth parses a -bandwidth-limit in bytes per second, such as
+// "512K", "10M" or "1G" (powers of 1024, with an optional B), or a number
+// of bytes. It returns 0 for "" or "0", no limit.
+func parseBandwidth(value string) (int64, error) {
+	n, err := parseSize(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a bandwidth such as 512K, 10M or 1G", value)
+	}
+	return n, nil
+}
+
+// parseSize parses a number of bytes, such as "512K", "10M" or "1G"
+// (powers of 1024, with an optional B). It returns 0 for "".
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	s = strings.TrimSuffix(s, "B")
+	if i := strings.IndexAny(s, "KMG"); i >= 0 && i == len(s)-1 {
+		unit = map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30}[s[i]]
+		s = s[:i]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q isn't a size such as 512K, 10M or 1G", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// rateLimiter hands out bytes at a rate to the readers that share it.
+type rateLimiter struct {
+	rate int64
+
+	lock sync.Mutex
+	next time.Time
+}
+
+// newRateLimiter returns a limiter of rate bytes per second, or nil when
+// rate is 0.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// wait waits for the turn of n bytes.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.lock.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// limitedReader is a reader whose reads wait for a rateLimiter.
+type limitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > uploadChunk {
+		p = p[:uploadChunk]
+	}
+	n, err := r.r.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
+
+// limitUpload returns r limited by uploadLimiter, if there is one.
+func limitUpload(r io.Reader) io.Reader {
+	if uploadLimiter == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: uploadLimiter}
+}
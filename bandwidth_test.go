@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output int64
+		Err    bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1000", 1000, false},
+		{"512K", 512 << 10, false},
+		{"10M", 10 << 20, false},
+		{"10mb", 10 << 20, false},
+		{"1.5M/s", 3 << 19, false},
+		{"1G", 1 << 30, false},
+		{"fast", 0, true},
+		{"-1M", 0, true},
+		{"M", 0, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := parseBandwidth(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %s", tc.Input, err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%q: bad: %d", tc.Input, actual)
+		}
+	}
+}
+
+func TestLimitUpload(t *testing.T) {
+	defer func(l *rateLimiter) { uploadLimiter = l }(uploadLimiter)
+
+	data := bytes.Repeat([]byte("x"), 3*uploadChunk)
+	uploadLimiter = nil
+	if r := bytes.NewReader(data); limitUpload(r) != r {
+		t.Fatal("should not be limited")
+	}
+
+	// 3 chunks at 20 chunks a second wait for the turns of the 2 after
+	// the first
+	uploadLimiter = newRateLimiter(20 * uploadChunk)
+	start := time.Now()
+	actual, err := ioutil.ReadAll(limitUpload(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Fatalf("bad: %d bytes", len(actual))
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Fatal("0 should be no limit")
+	}
+}
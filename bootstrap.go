@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// bootstrapRetries is how many times a build that failed while downloading
+// a toolchain or modules is retried.
+const bootstrapRetries = 3
+
+// bootstrapRaceRe matches the errors of go commands that collided with
+// each other while filling the module cache or downloading a toolchain
+// for GOTOOLCHAIN, which succeed when run again. An unexpected EOF only
+// counts on the line of a download, since the compiler reports one for
+// source files that end early.
+var bootstrapRaceRe = regexp.MustCompile(`(?i)` +
+	`text file busy|` +
+	`zip: not a valid zip file|` +
+	`(https?://|go: \S+@\S+: |verifying )[^\n]*unexpected EOF|` +
+	`rename .*: file exists|` +
+	`go: downloading go[0-9.]+.*(error|failed)|` +
+	`toolchain not available`)
+
+// bootstrapBackoff is the delay before the first retry of a build, which
+// grows by as much again for each retry after it.
+var bootstrapBackoff = time.Second
+
+// Bootstrapper serializes the work that builds share through the module
+// cache: modules are downloaded once before the builds start, and a build
+// that still fails on a download is retried, one at a time.
+type Bootstrapper struct {
+	lock sync.Mutex
+}
+
+// Warm downloads the toolchain that GOTOOLCHAIN or go.mod asks for, and
+// the modules of the module in the current directory, or of every module
+// of the workspace, before any build runs, with the GOFLAGS and
+// -modcacherw of opts. Errors are left for the builds to report, since
+// they may not need the downloads at all.
+func (b *Bootstrapper) Warm(opts *CompileOpts, workspace *Workspace) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Running go at all switches to the toolchain, so this downloads it
+	// once even when there are no modules to download.
+	env := append(os.Environ(), opts.goFlagsEnv()...)
+	execGo(opts.GoCmd, env, "", "version")
+
+	if _, err := os.Stat("go.mod"); (err != nil && workspace == nil) || opts.ModMode == "vendor" {
+		return
+	}
+	args := []string{"mod", "download"}
+	if opts.ModCacheRW {
+		args = append(args, "-modcacherw")
+	}
+	execGo(opts.GoCmd, env, "", args...)
+}
+
+// Retry runs fn and, for as long as it fails with an error from a download
+// race, runs it again on its own up to bootstrapRetries more times. The
+// delay before a retry is waited out before taking the lock, so that it
+// doesn't hold up the retries of other builds.
+func (b *Bootstrapper) Retry(platform Platform, fn func() error) error {
+	err := fn()
+	for i := 0; err != nil && bootstrapRaceRe.MatchString(err.Error()) && i < bootstrapRetries; i++ {
+		ui.Infof("--> %15s: retrying after a download error\n", platform.String())
+
+		time.Sleep(time.Duration(i+1) * bootstrapBackoff)
+		b.lock.Lock()
+		err = fn()
+		b.lock.Unlock()
+	}
+
+	return err
+}
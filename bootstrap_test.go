@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBootstrapperRetry(t *testing.T) {
+	cases := []struct {
+		Errs  []error
+		Calls int
+		Err   bool
+	}{
+		{[]error{nil}, 1, false},
+		{[]error{errors.New("exit status 1\nStderr: undefined: foo")}, 1, true},
+		{[]error{errors.New("exit status 1\nStderr: zip: not a valid zip file"), nil}, 2, false},
+		{[]error{errors.New("open /bin/go: text file busy"), errors.New("undefined: foo")}, 2, true},
+		{[]error{errors.New("exit status 1\nStderr: # example.com/app\n./main.go:3:1: syntax error: unexpected EOF")}, 1, true},
+		{[]error{errors.New("exit status 1\nStderr: go: example.com/lib@v1.2.0: Get \"https://proxy.golang.org/example.com/lib/@v/v1.2.0.zip\": unexpected EOF"), nil}, 2, false},
+		{[]error{errors.New("exit status 1\nStderr: go: downloading example.com/lib v1.2.0\ngo: example.com/lib@v1.2.0: read tcp 10.0.0.1:5000: unexpected EOF"), nil}, 2, false},
+		{[]error{errors.New("exit status 1\nStderr: verifying example.com/lib@v1.2.0: checksum mismatch")}, 1, true},
+	}
+
+	defer func(d time.Duration) { bootstrapBackoff = d }(bootstrapBackoff)
+	bootstrapBackoff = 0
+
+	for i, tc := range cases {
+		var b Bootstrapper
+		calls := 0
+		err := b.Retry(Platform{OS: "linux", Arch: "amd64"}, func() error {
+			calls++
+			return tc.Errs[calls-1]
+		})
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if calls != tc.Calls {
+			t.Fatalf("%d: bad: %d", i, calls)
+		}
+	}
+}
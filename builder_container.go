@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isContainerBuilder returns true if the builder name refers to a
+// container engine rather than the local Go installation.
+func isContainerBuilder(builder string) bool {
+	return builder == "docker" || builder == "podman"
+}
+
+// defaultBuilderImage returns the official golang image matching the
+// given Go version string, as returned by GoVersion.
+func defaultBuilderImage(goVersion string) string {
+	if !strings.HasPrefix(goVersion, "go") {
+		return "golang:latest"
+	}
+
+	// Strip anything after the version itself, such as the
+	// " X:boringcrypto" suffix some toolchains report.
+	v := strings.Fields(goVersion[2:])
+	if len(v) == 0 {
+		return "golang:latest"
+	}
+
+	return "golang:" + v[0]
+}
+
+// containerArgs builds the arguments to the container engine for running
+// `go` with args inside image. The working directory and the other mounts,
+// such as the output directory, are bind-mounted at the same paths inside
+// the container so that the paths given to `go build` are valid on both
+// sides.
+func containerArgs(engine, image string, env []string, workDir string, mounts []string, args ...string) []string {
+	result := []string{
+		"run", "--rm",
+		"-v", workDir + ":" + workDir,
+		"-w", workDir,
+	}
+	mounted := []string{workDir}
+	for _, dir := range mounts {
+		covered := false
+		for _, m := range mounted {
+			covered = covered || dir == m || strings.HasPrefix(dir, m+string(filepath.Separator))
+		}
+		if !covered {
+			result = append(result, "-v", dir+":"+dir)
+			mounted = append(mounted, dir)
+		}
+	}
+
+	// Run as the invoking user so the binaries aren't owned by root. Podman
+	// does this for us with keep-id, docker needs the explicit IDs.
+	switch engine {
+	case "podman":
+		result = append(result, "--userns=keep-id")
+	case "docker":
+		if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+			result = append(result, "--user", fmt.Sprintf("%d:%d", uid, gid))
+		}
+	}
+
+	// The user we run as may not have a writable home directory in the
+	// image, so keep the build and module caches in /tmp.
+	env = append([]string{
+		"HOME=/tmp",
+		"GOCACHE=/tmp/.cache/go-build",
+		"GOPATH=/tmp/go",
+	}, env...)
+	for _, v := range env {
+		result = append(result, "-e", v)
+	}
+
+	result = append(result, image, "go")
+	return append(result, args...)
+}
+
+// execContainer runs `go` with the given arguments inside a container
+// using the engine and image configured in opts. The env is the complete
+// set of variables to set within the container; the host environment is
+// intentionally not passed through.
+func execContainer(opts *CompileOpts, env []string, dir string, outDir string, args ...string) (string, error) {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		dir = wd
+	}
+
+	// The workspace is mounted too, since it is usually above the
+	// directory of the module that is built, and so are the files of the
+	// overlay.
+	mounts := []string{outDir}
+	if opts.GoWork != "" {
+		mounts = append(mounts, filepath.Dir(opts.GoWork))
+	}
+	if opts.Overlay != "" {
+		files, err := overlayFiles(opts.Overlay)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			mounts = append(mounts, filepath.Dir(f))
+		}
+	}
+
+	return execGoOutput(opts.Builder, nil, "", opts.Output,
+		containerArgs(opts.Builder, opts.BuilderImage, env, dir, mounts, args...)...)
+}
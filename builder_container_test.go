@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultBuilderImage(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"go1.18", "golang:1.18"},
+		{"go1.22.4", "golang:1.22.4"},
+		{"go1.20.1 X:boringcrypto", "golang:1.20.1"},
+		{"devel +abcdef", "golang:latest"},
+	}
+
+	for _, tc := range cases {
+		actual := defaultBuilderImage(tc.Input)
+		if actual != tc.Output {
+			t.Errorf("input: %s\nexpected: %s\nactual: %s", tc.Input, tc.Output, actual)
+		}
+	}
+}
+
+func TestContainerArgs(t *testing.T) {
+	args := containerArgs("podman", "golang:1.18",
+		[]string{"GOOS=linux"}, "/src", []string{"/src/bin"}, "build", "-o", "/src/bin/foo")
+	expected := []string{
+		"run", "--rm",
+		"-v", "/src:/src",
+		"-w", "/src",
+		"--userns=keep-id",
+		"-e", "HOME=/tmp",
+		"-e", "GOCACHE=/tmp/.cache/go-build",
+		"-e", "GOPATH=/tmp/go",
+		"-e", "GOOS=linux",
+		"golang:1.18", "go",
+		"build", "-o", "/src/bin/foo",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("bad: %#v", args)
+	}
+
+	// An output directory outside of the working directory is mounted too
+	args = containerArgs("podman", "golang:1.18", nil, "/src", []string{"/dist"}, "build")
+	if args[6] != "-v" || args[7] != "/dist:/dist" {
+		t.Fatalf("bad: %#v", args)
+	}
+
+	// As is a workspace above it
+	args = containerArgs("podman", "golang:1.18", nil, "/ws/src",
+		[]string{"/ws/src/bin", "/ws", "/ws/dist"}, "build")
+	if args[6] != "-v" || args[7] != "/ws:/ws" || args[8] != "--userns=keep-id" {
+		t.Fatalf("bad: %#v", args)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// With -build-id, gox links a build ID into each binary: a hash of the
+// sources it was built from, which is the same on every machine, and the
+// settings of the build. It is the string variable main.goxBuildID, set
+// with -X, which Go records in the build info of the binary with the rest
+// of -ldflags. -trimpath, which -reproducible builds with, leaves -ldflags
+// out of the build info, so those binaries only keep the build ID if
+// package main declares the variable and uses it, such as in its version
+// output. `gox verify` finds the build ID in a binary and checks it
+// against the manifest of the build.
+const (
+	buildIDVar    = "main.goxBuildID"
+	buildIDPrefix = "goxbuild1."
+)
+
+// BuildID is what a binary was built from.
+type BuildID struct {
+	// Sources is the hash of the source files of the package and its
+	// dependencies outside of the standard library, and of their go.mod.
+	Sources string `json:"sources"`
+
+	Platform  string `json:"platform"`
+	Package   string `json:"package"`
+	Variant   string `json:"variant,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+	Tags      string `json:"tags,omitempty"`
+	BuildMode string `json:"buildmode,omitempty"`
+	Cgo       bool   `json:"cgo"`
+	Race      bool   `json:"race,omitempty"`
+	Trimpath  bool   `json:"trimpath,omitempty"`
+	Static    bool   `json:"static,omitempty"`
+	Strip     bool   `json:"strip,omitempty"`
+}
+
+// NewBuildID returns the encoded build ID of opts, built with the given
+// version of Go.
+func NewBuildID(opts *CompileOpts, goVersion string) (string, error) {
+	sources, err := opts.SourceHash()
+	if err != nil {
+		return "", fmt.Errorf("hashing the sources for the build ID: %s", err)
+	}
+	id := &BuildID{
+		Sources:   sources,
+		Platform:  opts.Platform.String(),
+		Package:   opts.PackagePath,
+		Version:   opts.Version,
+		Commit:    opts.Commit,
+		GoVersion: goVersion,
+		Tags:      opts.Tags,
+		BuildMode: opts.BuildMode,
+		Cgo:       opts.Cgo,
+		Race:      opts.Race,
+		Trimpath:  opts.Trimpath,
+		Static:    opts.Static,
+		Strip:     opts.Strip,
+	}
+	if opts.FIPS != "" {
+		id.Variant = fipsVariant
+	}
+	return id.Encode()
+}
+
+// SourceHash returns the hash of the sources of opts, like Fingerprint
+// but without what differs between machines: files are named by the
+// import path of their package rather than where they are, and go.mod by
+// the path of its module.
+func (opts *CompileOpts) SourceHash() (string, error) {
+	pkgs, err := opts.listDeps()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	goMods := make(map[string]string)
+	for _, p := range pkgs {
+		if p.Module != nil && p.Module.GoMod != "" {
+			goMods[p.Module.Path] = p.Module.GoMod
+		}
+
+		fmt.Fprintf(h, "package %s\n", p.ImportPath)
+		for _, f := range opts.sourceFiles(p) {
+			if err := hashFileAs(h, p.ImportPath+"/"+filepath.ToSlash(f), filepath.Join(p.Dir, f)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	mods := make([]string, 0, len(goMods))
+	for m := range goMods {
+		mods = append(mods, m)
+	}
+	sort.Strings(mods)
+	for _, m := range mods {
+		if err := hashFileAs(h, m+"/go.mod", goMods[m]); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Encode returns the build ID as it is linked into the binary, which
+// can't have spaces, since it is part of -ldflags.
+func (id *BuildID) Encode() (string, error) {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return "", err
+	}
+	return buildIDPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeBuildID decodes a build ID that Encode returned.
+func DecodeBuildID(s string) (*BuildID, error) {
+	if len(s) <= len(buildIDPrefix) || s[:len(buildIDPrefix)] != buildIDPrefix {
+		return nil, fmt.Errorf("not a build ID: %q", s)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s[len(buildIDPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("bad build ID: %s", err)
+	}
+	id := &BuildID{}
+	if err := json.Unmarshal(data, id); err != nil {
+		return nil, fmt.Errorf("bad build ID: %s", err)
+	}
+	if id.Sources == "" {
+		return nil, fmt.Errorf("bad build ID: no sources hash")
+	}
+	return id, nil
+}
+
+// ReadBuildID finds the build ID in the binary at path, and returns it
+// decoded and as it is in the binary.
+func ReadBuildID(path string) (*BuildID, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := []byte(buildIDPrefix)
+	for len(data) > 0 {
+		i := bytes.Index(data, prefix)
+		if i < 0 {
+			break
+		}
+		end := i + len(prefix)
+		for end < len(data) && isBase64URL(data[end]) {
+			end++
+		}
+		if id, err := DecodeBuildID(string(data[i:end])); err == nil {
+			return id, string(data[i:end]), nil
+		}
+		data = data[i+len(prefix):]
+	}
+	return nil, "", fmt.Errorf("%s has no build ID", path)
+}
+
+func isBase64URL(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// Fields returns the names and values of the build ID to print, leaving
+// out those that are empty.
+func (id *BuildID) Fields() [][2]string {
+	all := [][2]string{
+		{"platform", id.Platform},
+		{"package", id.Package},
+		{"variant", id.Variant},
+		{"version", id.Version},
+		{"commit", id.Commit},
+		{"go", id.GoVersion},
+		{"sources", id.Sources},
+		{"tags", id.Tags},
+		{"buildmode", id.BuildMode},
+		{"cgo", strconv.FormatBool(id.Cgo)},
+		{"race", strconv.FormatBool(id.Race)},
+		{"trimpath", strconv.FormatBool(id.Trimpath)},
+		{"static", strconv.FormatBool(id.Static)},
+		{"strip", strconv.FormatBool(id.Strip)},
+	}
+	var fields [][2]string
+	for _, f := range all {
+		if f[1] != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// VerifyBuildID checks the binary at path, whose build ID is encoded,
+// against the manifest m: that m recorded the binary, by its path or its
+// checksum, with the same checksum and build ID. It returns what doesn't
+// match.
+func VerifyBuildID(path, encoded string, m *ArtifactManifest) ([]string, error) {
+	id, err := DecodeBuildID(encoded)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var match *Artifact
+	paths := m.Paths()
+	for i, a := range m.Artifacts {
+		if a.Kind != artifactBinary {
+			continue
+		}
+		if p, err := filepath.Abs(paths[i]); err == nil && p == abs {
+			match = &m.Artifacts[i]
+			break
+		}
+		if a.SHA256 == sum && match == nil {
+			match = &m.Artifacts[i]
+		}
+	}
+	if match == nil {
+		return []string{"the manifest has no binary at this path or with this checksum"}, nil
+	}
+
+	var problems []string
+	if match.SHA256 != sum {
+		problems = append(problems, fmt.Sprintf("sha256 is %s, the manifest has %s", sum, match.SHA256))
+	}
+	if match.Platform != id.Platform {
+		problems = append(problems, fmt.Sprintf("platform is %s, the manifest has %s", id.Platform, match.Platform))
+	}
+	if match.Build == nil || match.Build.BuildID == "" {
+		return append(problems, "the manifest has no build ID for it"), nil
+	}
+	if match.Build.BuildID == encoded {
+		return problems, nil
+	}
+
+	recorded, err := DecodeBuildID(match.Build.BuildID)
+	if err != nil {
+		return append(problems, fmt.Sprintf("the manifest has a %s", err)), nil
+	}
+	values := make(map[string]string)
+	for _, f := range recorded.Fields() {
+		values[f[0]] = f[1]
+	}
+	for _, f := range id.Fields() {
+		if values[f[0]] != f[1] {
+			problems = append(problems, fmt.Sprintf("%s is %s, the manifest has %s", f[0], f[1], values[f[0]]))
+		}
+		delete(values, f[0])
+	}
+	for _, f := range recorded.Fields() {
+		if _, ok := values[f[0]]; ok {
+			problems = append(problems, fmt.Sprintf("%s is empty, the manifest has %s", f[0], f[1]))
+		}
+	}
+	return problems, nil
+}
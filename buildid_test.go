@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildIDEncode(t *testing.T) {
+	id := &BuildID{Sources: "abc", Platform: "linux/amd64", Package: "ex.com/a", Version: "1.0.0", Cgo: true}
+	encoded, err := id.Encode()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(encoded, buildIDPrefix) || strings.ContainsAny(encoded, " \t\"'") {
+		t.Fatalf("bad: %s", encoded)
+	}
+	decoded, err := DecodeBuildID(encoded)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *decoded != *id {
+		t.Fatalf("bad: %#v", decoded)
+	}
+
+	for _, s := range []string{"", buildIDPrefix, buildIDPrefix + "!!", buildIDPrefix + "e30", "abc"} {
+		if _, err := DecodeBuildID(s); err == nil {
+			t.Fatalf("%q: should error", s)
+		}
+	}
+}
+
+func TestReadBuildID(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	encoded, _ := (&BuildID{Sources: "abc", Platform: "linux/arm64"}).Encode()
+	path := filepath.Join(td, "app")
+	data := "\x7fELF\x00" + buildIDPrefix + "junk\x00" + encoded + "\x00more"
+	ioutil.WriteFile(path, []byte(data), 0755)
+
+	id, actual, err := ReadBuildID(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != encoded || id.Platform != "linux/arm64" {
+		t.Fatalf("bad: %s %#v", actual, id)
+	}
+
+	ioutil.WriteFile(path, []byte("\x7fELF\x00"+buildIDPrefix+"junk"), 0755)
+	if _, _, err := ReadBuildID(path); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCompileOptsSourceHash(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	// The same module in two places hashes the same
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		td, err := ioutil.TempDir("", "gox")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+		ioutil.WriteFile(filepath.Join(td, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n"), 0644)
+		ioutil.WriteFile(filepath.Join(td, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+
+		if err := os.Chdir(td); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		opts := &CompileOpts{PackagePath: "example.com/app", Platform: Platform{OS: "linux", Arch: "amd64"}, GoCmd: "go"}
+		hash, err := opts.SourceHash()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		hashes = append(hashes, hash)
+
+		if i == 1 {
+			ioutil.WriteFile(filepath.Join(td, "main.go"), []byte("package main\n\nfunc main() { println() }\n"), 0644)
+			if changed, err := opts.SourceHash(); err != nil || changed == hash {
+				t.Fatalf("bad: %s %s", changed, err)
+			}
+		}
+	}
+	if hashes[0] != hashes[1] {
+		t.Fatalf("bad: %#v", hashes)
+	}
+}
+
+func TestVerifyBuildID(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	id := &BuildID{Sources: "abc", Platform: "linux/amd64", Package: "ex.com/a", Version: "1.0.0"}
+	encoded, _ := id.Encode()
+	path := filepath.Join(td, "app_linux_amd64")
+	ioutil.WriteFile(path, []byte("binary "+encoded), 0755)
+	sum, _ := fileSHA256(path)
+
+	other := *id
+	other.Version = "1.0.1"
+	otherEncoded, _ := other.Encode()
+
+	cases := []struct {
+		Artifact Artifact
+		Problems []string
+	}{
+		{
+			Artifact{Kind: artifactBinary, Path: "app_linux_amd64", Platform: "linux/amd64", SHA256: sum,
+				Build: &ArtifactBuild{BuildID: encoded}},
+			nil,
+		},
+		{
+			// Copied elsewhere, it is found by its checksum
+			Artifact{Kind: artifactBinary, Path: "bin/app", Platform: "linux/amd64", SHA256: sum,
+				Build: &ArtifactBuild{BuildID: encoded}},
+			nil,
+		},
+		{
+			Artifact{Kind: artifactBinary, Path: "app_linux_amd64", Platform: "linux/amd64", SHA256: "0123",
+				Build: &ArtifactBuild{BuildID: otherEncoded}},
+			[]string{
+				"sha256 is " + sum + ", the manifest has 0123",
+				"version is 1.0.0, the manifest has 1.0.1",
+			},
+		},
+		{
+			Artifact{Kind: artifactBinary, Path: "app_linux_amd64", Platform: "linux/amd64", SHA256: sum},
+			[]string{"the manifest has no build ID for it"},
+		},
+		{
+			Artifact{Kind: artifactArchive, Path: "app_linux_amd64", SHA256: sum},
+			[]string{"the manifest has no binary at this path or with this checksum"},
+		},
+	}
+
+	for i, tc := range cases {
+		m := NewArtifactManifest(td)
+		m.Artifacts = []Artifact{tc.Artifact}
+		problems, err := VerifyBuildID(path, encoded, m)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if strings.Join(problems, "\n") != strings.Join(tc.Problems, "\n") {
+			t.Fatalf("%d: bad: %#v", i, problems)
+		}
+	}
+}
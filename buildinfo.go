@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BinaryInfo is the build information embedded in a Go binary, as
+// reported by `go version -m`.
+type BinaryInfo struct {
+	// GoVersion is the version of Go that built the binary.
+	GoVersion string
+
+	// Path is the import path of the main package and Main is the module
+	// it belongs to, as "path version".
+	Path string
+	Main string
+
+	// Deps are the module dependencies, as "path version" entries.
+	Deps []string
+
+	// Settings are the build settings, such as GOOS, GOARCH, GOARM, GOAMD64,
+	// CGO_ENABLED and -ldflags.
+	Settings map[string]string
+}
+
+// Platform returns the platform the binary was built for, according
+// to its build settings.
+func (i *BinaryInfo) Platform() (Platform, error) {
+	goos, goarch := i.Settings["GOOS"], i.Settings["GOARCH"]
+	if goos == "" || goarch == "" {
+		return Platform{}, fmt.Errorf("binary has no GOOS/GOARCH build settings")
+	}
+
+	platform := Platform{OS: goos, Arch: goarch, ARM: i.Settings["GOARM"]}
+
+	// The default level is recorded too, but isn't part of the platform.
+	// The float ABI of arm is in GOARM, after its version.
+	if goarch == "arm" {
+		if parts := strings.SplitN(platform.ARM, ",", 2); len(parts) == 2 {
+			platform.ARM, platform.Level = parts[0], parts[1]
+		}
+	} else if l, ok := archLevels[goarch]; ok {
+		if v := i.Settings[l.Env]; v != "" && v != l.Levels[0] {
+			platform.Level = v
+		}
+	}
+	return platform, nil
+}
+
+// GoBinaryInfo reads the build information from the Go binary at path.
+// This shells out to `go version -m` rather than using debug/buildinfo so
+// that it works with the Go version gox itself was built with.
+func GoBinaryInfo(GoCmd string, path string) (*BinaryInfo, error) {
+	output, err := execGo(GoCmd, nil, "", "version", "-m", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBinaryInfo(output)
+}
+
+// parseBinaryInfo parses the output of `go version -m` for a single file.
+func parseBinaryInfo(output string) (*BinaryInfo, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("no build information found")
+	}
+
+	// The first line is "path: version"
+	idx := strings.LastIndex(lines[0], ": ")
+	if idx < 0 {
+		return nil, fmt.Errorf("unexpected go version output: %s", lines[0])
+	}
+
+	info := &BinaryInfo{
+		GoVersion: strings.TrimSpace(lines[0][idx+2:]),
+		Settings:  make(map[string]string),
+	}
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "path":
+			info.Path = parts[1]
+		case "mod":
+			info.Main = modLine(parts[1])
+		case "dep":
+			info.Deps = append(info.Deps, modLine(parts[1]))
+		case "build":
+			kv := strings.SplitN(parts[1], "=", 2)
+			if len(kv) == 2 {
+				info.Settings[kv[0]] = kv[1]
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// modLine turns the tab-separated "path version sum" of a mod or dep
+// line into "path version".
+func modLine(v string) string {
+	fields := strings.Fields(v)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+
+	return strings.Join(fields, " ")
+}
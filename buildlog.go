@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// buildLogTail is how many lines of a failed build's error are printed
+// with -log-dir, which has the rest.
+const buildLogTail = 10
+
+// buildLogName is the name of the -log-dir file of the build of opts,
+// such as linux_amd64.log. With more than one package the package's
+// directory goes in front, and FIPS variants end in _fips.
+func buildLogName(opts *CompileOpts, packages bool) string {
+	name := strings.Replace(opts.Platform.String(), "/", "_", -1)
+	if packages {
+		name = filepath.Base(opts.PackagePath) + "_" + name
+	}
+	if opts.FIPS != "" {
+		name += "_" + fipsVariant
+	}
+	return name + ".log"
+}
+
+// teeOutput adds w to the writers that the output of a build goes to.
+func teeOutput(output io.Writer, w io.Writer) io.Writer {
+	if output == nil {
+		return w
+	}
+	return io.MultiWriter(output, w)
+}
+
+// outputBuffer keeps the output of a build in memory. The go command's
+// stdout and stderr are copied to it at the same time, so writes are
+// serialized.
+type outputBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *outputBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// shortError cuts the error of a build down to its first line and the
+// last n lines, which is usually where the compiler says what went wrong.
+func shortError(err error, n int) string {
+	lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+	if len(lines) <= n+1 {
+		return strings.Join(lines, "\n")
+	}
+
+	tail := lines[len(lines)-n:]
+	return lines[0] + "\n...\n" + strings.Join(tail, "\n")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuildLogName(t *testing.T) {
+	cases := []struct {
+		Opts     CompileOpts
+		Packages bool
+		Expected string
+	}{
+		{
+			CompileOpts{PackagePath: "example.com/app", Platform: Platform{OS: "linux", Arch: "amd64"}},
+			false,
+			"linux_amd64.log",
+		},
+		{
+			CompileOpts{PackagePath: "example.com/app/cmd/server", Platform: Platform{OS: "linux", Arch: "arm", ARM: "7"}},
+			true,
+			"server_linux_armv7.log",
+		},
+		{
+			CompileOpts{PackagePath: "example.com/app", Platform: Platform{OS: "linux", Arch: "arm64"}, FIPS: "latest"},
+			false,
+			"linux_arm64_fips.log",
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := buildLogName(&tc.Opts, tc.Packages); actual != tc.Expected {
+			t.Fatalf("bad: %s", actual)
+		}
+	}
+}
+
+func TestShortError(t *testing.T) {
+	err := errors.New("exit status 2\nStderr: one\ntwo\nthree\nfour")
+	if actual := shortError(err, 2); actual != "exit status 2\n...\nthree\nfour" {
+		t.Fatalf("bad: %q", actual)
+	}
+	if actual := shortError(err, 4); actual != err.Error() {
+		t.Fatalf("bad: %q", actual)
+	}
+
+	var b strings.Builder
+	if teeOutput(nil, &b) != &b {
+		t.Fatal("should be the writer itself")
+	}
+}
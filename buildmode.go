@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+)
+
+// buildModes are the values of -buildmode that make something out of a
+// main package, and the platforms that support each of them, from
+// internal/platform of the Go distribution. A nil list is every platform.
+var buildModes = map[string][]string{
+	"default": nil,
+	"exe":     nil,
+	"pie": {
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64",
+		"linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"android/386", "android/amd64", "android/arm", "android/arm64",
+		"freebsd/amd64", "darwin/amd64", "darwin/arm64", "ios/amd64", "ios/arm64",
+		"aix/ppc64", "openbsd/arm64",
+		"windows/386", "windows/amd64", "windows/arm", "windows/arm64",
+	},
+	"c-archive": {
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64",
+		"linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"freebsd/amd64", "darwin/amd64", "darwin/arm64", "ios/amd64", "ios/arm64",
+		"aix/ppc64", "windows/386", "windows/amd64", "windows/arm", "windows/arm64",
+	},
+	"c-shared": {
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64",
+		"linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"android/386", "android/amd64", "android/arm", "android/arm64",
+		"freebsd/amd64", "darwin/amd64", "darwin/arm64",
+		"windows/386", "windows/amd64", "windows/arm64",
+	},
+	"plugin": {
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64",
+		"linux/ppc64le", "linux/s390x", "android/386", "android/amd64",
+		"freebsd/amd64", "darwin/amd64", "darwin/arm64",
+	},
+}
+
+// ValidateBuildMode checks a value of -buildmode.
+func ValidateBuildMode(mode string) error {
+	if _, ok := buildModes[mode]; !ok && mode != "" {
+		return fmt.Errorf("Invalid -buildmode value %q: must be exe, pie, c-archive, c-shared, or plugin", mode)
+	}
+
+	return nil
+}
+
+// buildModeSupported reports whether mode can be built for platform.
+func buildModeSupported(mode string, platform Platform) bool {
+	platforms, ok := buildModes[mode]
+	if mode == "" || ok && platforms == nil {
+		return true
+	}
+
+	for _, p := range platforms {
+		if p == platform.OS+"/"+platform.Arch {
+			return true
+		}
+	}
+	return false
+}
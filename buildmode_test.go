@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateBuildMode(t *testing.T) {
+	for _, mode := range []string{"", "exe", "pie", "c-archive", "c-shared", "plugin"} {
+		if err := ValidateBuildMode(mode); err != nil {
+			t.Fatalf("%s: err: %s", mode, err)
+		}
+	}
+	for _, mode := range []string{"shared", "archive", "dll"} {
+		if err := ValidateBuildMode(mode); err == nil {
+			t.Fatalf("%s: should err", mode)
+		}
+	}
+}
+
+func TestBuildModeSupported(t *testing.T) {
+	cases := []struct {
+		Mode      string
+		Platform  Platform
+		Supported bool
+	}{
+		{"", Platform{OS: "plan9", Arch: "386"}, true},
+		{"exe", Platform{OS: "plan9", Arch: "386"}, true},
+		{"c-shared", Platform{OS: "linux", Arch: "amd64", Level: "v3"}, true},
+		{"c-shared", Platform{OS: "linux", Arch: "arm", ARM: "7"}, true},
+		{"c-shared", Platform{OS: "openbsd", Arch: "amd64"}, false},
+		{"c-archive", Platform{OS: "ios", Arch: "arm64"}, true},
+		{"c-shared", Platform{OS: "ios", Arch: "arm64"}, false},
+		{"pie", Platform{OS: "linux", Arch: "mips"}, false},
+		{"plugin", Platform{OS: "windows", Arch: "amd64"}, false},
+	}
+
+	for _, tc := range cases {
+		if actual := buildModeSupported(tc.Mode, tc.Platform); actual != tc.Supported {
+			t.Fatalf("%s %s: bad: %t", tc.Mode, tc.Platform.String(), actual)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "strings"
+
+// cgoPorts are the ports that support cgo, as `go tool dist list -json`
+// has them, and darwin/386 and darwin/arm from before they were dropped.
+var cgoPorts = map[string]bool{
+	"aix/ppc64":       true,
+	"android/386":     true,
+	"android/amd64":   true,
+	"android/arm":     true,
+	"android/arm64":   true,
+	"darwin/386":      true,
+	"darwin/amd64":    true,
+	"darwin/arm":      true,
+	"darwin/arm64":    true,
+	"dragonfly/amd64": true,
+	"freebsd/386":     true,
+	"freebsd/amd64":   true,
+	"freebsd/arm":     true,
+	"freebsd/arm64":   true,
+	"illumos/amd64":   true,
+	"ios/amd64":       true,
+	"ios/arm64":       true,
+	"linux/386":       true,
+	"linux/amd64":     true,
+	"linux/arm":       true,
+	"linux/arm64":     true,
+	"linux/loong64":   true,
+	"linux/mips":      true,
+	"linux/mips64":    true,
+	"linux/mips64le":  true,
+	"linux/mipsle":    true,
+	"linux/ppc64":     true,
+	"linux/ppc64le":   true,
+	"linux/riscv64":   true,
+	"linux/s390x":     true,
+	"netbsd/386":      true,
+	"netbsd/amd64":    true,
+	"netbsd/arm":      true,
+	"netbsd/arm64":    true,
+	"openbsd/386":     true,
+	"openbsd/amd64":   true,
+	"openbsd/arm":     true,
+	"openbsd/arm64":   true,
+	"openbsd/riscv64": true,
+	"solaris/amd64":   true,
+	"windows/386":     true,
+	"windows/amd64":   true,
+	"windows/arm64":   true,
+}
+
+// portCgo reports whether the Go port of goos and goarch supports cgo.
+func portCgo(goos, goarch string) bool {
+	return cgoPorts[goos+"/"+goarch]
+}
+
+// splitCgo splits platforms into those that can be built with cgo and
+// those that can't.
+func splitCgo(platforms []Platform) ([]Platform, []Platform) {
+	var cgo, noCgo []Platform
+	for _, p := range platforms {
+		if portCgo(p.OS, p.Arch) {
+			cgo = append(cgo, p)
+		} else {
+			noCgo = append(noCgo, p)
+		}
+	}
+	return cgo, noCgo
+}
+
+// platformNames returns the names of platforms, joined by commas.
+func platformNames(platforms []Platform) string {
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		names[i] = p.String()
+	}
+	return strings.Join(names, ", ")
+}
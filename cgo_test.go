@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCgo(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "js", Arch: "wasm"},
+		{OS: "windows", Arch: "arm64"},
+		{OS: "plan9", Arch: "386"},
+	}
+
+	cgo, noCgo := splitCgo(platforms)
+	if !reflect.DeepEqual(cgo, []Platform{platforms[0], platforms[2]}) {
+		t.Fatalf("bad: %#v", cgo)
+	}
+	if !reflect.DeepEqual(noCgo, []Platform{platforms[1], platforms[3]}) {
+		t.Fatalf("bad: %#v", noCgo)
+	}
+	if names := platformNames(noCgo); names != "js/wasm, plan9/386" {
+		t.Fatalf("bad: %s", names)
+	}
+}
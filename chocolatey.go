@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChocolateyConfig is the "chocolatey" section of the config file. It
+// builds a Chocolatey package whose install script downloads the windows
+// zip archive of a binary for the machine, checks its hash, and puts the
+// binary on the PATH.
+type ChocolateyConfig struct {
+	// ID is the id of the package, defaults to the directory of the main
+	// package. Package picks the main package when several are built.
+	ID      string `json:"id,omitempty"`
+	Package string `json:"package,omitempty"`
+
+	Title       string   `json:"title,omitempty"`
+	Authors     string   `json:"authors"`
+	Description string   `json:"description"`
+	Homepage    string   `json:"homepage,omitempty"`
+	LicenseURL  string   `json:"license_url,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// URL is the template for where each archive is downloaded from, as
+	// in HomebrewConfig.
+	URL string `json:"url"`
+
+	// Output is the directory the package is written to, defaults to
+	// that of the archives.
+	Output string `json:"output,omitempty"`
+}
+
+// nuspec is the manifest of a NuGet package, which Chocolatey packages
+// are.
+type nuspec struct {
+	XMLName  xml.Name `xml:"package"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Metadata struct {
+		ID          string `xml:"id"`
+		Version     string `xml:"version"`
+		Title       string `xml:"title,omitempty"`
+		Authors     string `xml:"authors"`
+		ProjectURL  string `xml:"projectUrl,omitempty"`
+		LicenseURL  string `xml:"licenseUrl,omitempty"`
+		Tags        string `xml:"tags,omitempty"`
+		Description string `xml:"description"`
+	} `xml:"metadata"`
+}
+
+// nupkgContentTypes and nupkgRels make the package an Open Packaging
+// Conventions file, which NuGet reads packages as.
+const nupkgContentTypes = `<?xml version="1.0" encoding="utf-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="nuspec" ContentType="application/octet"/>
+  <Default Extension="ps1" ContentType="application/octet"/>
+</Types>
+`
+
+const nupkgRels = `<?xml version="1.0" encoding="utf-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Type="http://schemas.microsoft.com/packaging/2010/07/manifest" Target="/%s.nuspec" Id="R1"/>
+</Relationships>
+`
+
+// Validate checks that authors, description and the url template are set.
+func (c *ChocolateyConfig) Validate() error {
+	for _, v := range []struct{ Key, Value string }{
+		{"authors", c.Authors},
+		{"description", c.Description},
+		{"url", c.URL},
+	} {
+		if v.Value == "" {
+			return fmt.Errorf("chocolatey: %s is required", v.Key)
+		}
+	}
+
+	return validateURLTemplate("chocolatey", c.URL)
+}
+
+// chocolateyInstall returns the tools/chocolateyinstall.ps1 of the
+// package. args are the arguments of Install-ChocolateyZipPackage, in
+// pairs of names and values.
+func chocolateyInstall(args []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("$ErrorActionPreference = 'Stop'\n")
+	buf.WriteString("$toolsDir = Split-Path -Parent $MyInvocation.MyCommand.Definition\n\n")
+	buf.WriteString("$packageArgs = @{\n")
+	buf.WriteString("  packageName   = $env:ChocolateyPackageName\n")
+	buf.WriteString("  unzipLocation = $toolsDir\n")
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&buf, "  %-13s = '%s'\n", args[i], strings.Replace(args[i+1], "'", "''", -1))
+	}
+	buf.WriteString("}\n\nInstall-ChocolateyZipPackage @packageArgs\n")
+	return buf.Bytes()
+}
+
+// BuildChocolateyPackage writes the .nupkg for the windows archives of
+// results and returns its path.
+func BuildChocolateyPackage(c *ChocolateyConfig, archives *ArchiveConfig, results []BuildResult, version string) (string, error) {
+	builds, err := releaseBuilds(c.Package, results, "windows")
+	if err != nil {
+		return "", err
+	}
+
+	// Chocolatey only has a URL for 32-bit and one for 64-bit machines
+	var args []string
+	for _, r := range pickBuilds("windows", []string{"386", "amd64"}, builds) {
+		path, err := archives.Path(r, version)
+		if err != nil {
+			return "", err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		url, err := releaseURL(c.URL, path, r, version)
+		if err != nil {
+			return "", err
+		}
+
+		if r.Platform.Arch == "386" {
+			args = append(args, "url", url, "checksum", sum, "checksumType", "sha256")
+		} else {
+			args = append(args, "url64bit", url, "checksum64", sum, "checksumType64", "sha256")
+		}
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("no windows/386 or windows/amd64 binaries to publish")
+	}
+
+	id := c.ID
+	if id == "" {
+		id = strings.ToLower(filepath.Base(builds[0].Path))
+	}
+	spec := &nuspec{Xmlns: "http://schemas.microsoft.com/packaging/2015/06/nuspec.xsd"}
+	spec.Metadata.ID = id
+	spec.Metadata.Version = version
+	spec.Metadata.Title = c.Title
+	spec.Metadata.Authors = c.Authors
+	spec.Metadata.ProjectURL = c.Homepage
+	spec.Metadata.LicenseURL = c.LicenseURL
+	spec.Metadata.Tags = strings.Join(c.Tags, " ")
+	spec.Metadata.Description = c.Description
+	data, err := xml.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	dir := c.Output
+	if dir == "" {
+		dir = archives.output()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%s.nupkg", id, version))
+	files := []archiveFile{
+		{Name: "[Content_Types].xml", Data: []byte(nupkgContentTypes), Mode: 0644},
+		{Name: "_rels/.rels", Data: []byte(fmt.Sprintf(nupkgRels, id)), Mode: 0644},
+		{Name: id + ".nuspec", Data: append([]byte(xml.Header), append(data, '\n')...), Mode: 0644},
+		{Name: "tools/chocolateyinstall.ps1", Data: chocolateyInstall(args), Mode: 0644},
+	}
+	if err := writeArchive(path, "", files); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildChocolateyPackage(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td, Format: "zip"}
+	var results []BuildResult
+	for _, arch := range []string{"386", "amd64", "arm64"} {
+		r := BuildResult{Platform: Platform{OS: "windows", Arch: arch}, Path: "example.com/MyTool"}
+		path, _ := archives.Path(r, "1.2.3")
+		if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, r)
+	}
+
+	c := &ChocolateyConfig{
+		Authors:     "Smith & Sons",
+		Description: "My tool",
+		URL:         "https://example.com/{{.Name}}",
+	}
+	path, err := BuildChocolateyPackage(c, archives, results, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != filepath.Join(td, "mytool.1.2.3.nupkg") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if len(files) != 4 || files["[Content_Types].xml"] == "" || !strings.Contains(files["_rels/.rels"], `Target="/mytool.nuspec"`) {
+		t.Fatalf("bad: %#v", files)
+	}
+	if !strings.Contains(files["mytool.nuspec"], "<id>mytool</id>\n    <version>1.2.3</version>\n    <authors>Smith &amp; Sons</authors>") {
+		t.Fatalf("bad:\n%s", files["mytool.nuspec"])
+	}
+
+	sum, _ := fileSHA256(filepath.Join(td, "MyTool_1.2.3_windows_386.zip"))
+	install := files["tools/chocolateyinstall.ps1"]
+	for _, expected := range []string{
+		"  url           = 'https://example.com/MyTool_1.2.3_windows_386.zip'\n  checksum      = '" + sum + "'\n",
+		"  url64bit      = 'https://example.com/MyTool_1.2.3_windows_amd64.zip'\n",
+		"Install-ChocolateyZipPackage @packageArgs\n",
+	} {
+		if !strings.Contains(install, expected) {
+			t.Fatalf("missing %q in:\n%s", expected, install)
+		}
+	}
+	if strings.Contains(install, "arm64") {
+		t.Fatalf("bad:\n%s", install)
+	}
+}
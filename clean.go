@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CleanPaths removes the files at paths that exist, and then the
+// directories under dir that are left empty, and returns what it removed.
+// With dryRun nothing is removed.
+func CleanPaths(dir string, paths []string, dryRun bool) ([]string, error) {
+	seen := make(map[string]bool)
+	var removed []string
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if info, err := os.Lstat(path); err != nil || info.IsDir() {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return removed, err
+			}
+			removeEmptyParents(filepath.Dir(path), dir)
+		}
+		removed = append(removed, path)
+	}
+
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// removeEmptyParents removes dir, and its parents up to but not including
+// stop, for as long as they are empty.
+func removeEmptyParents(dir, stop string) {
+	stop, err := filepath.Abs(stop)
+	if err != nil {
+		return
+	}
+	for {
+		abs, err := filepath.Abs(dir)
+		if err != nil || abs == stop || !strings.HasPrefix(abs, stop+string(filepath.Separator)) {
+			return
+		}
+
+		// Remove fails on directories that aren't empty
+		if os.Remove(abs) != nil {
+			return
+		}
+		dir = filepath.Dir(abs)
+	}
+}
+
+// wipeableDir returns an error if dir isn't a directory of its own that
+// everything in can be removed: the current directory, one of its
+// parents, and the home directory all have more than what gox built.
+func wipeableDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if abs == cwd || strings.HasPrefix(cwd, abs+string(filepath.Separator)) || abs == filepath.Dir(abs) {
+		return fmt.Errorf("%s has the sources in it", dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil && abs == filepath.Clean(home) {
+		return fmt.Errorf("%s is the home directory", dir)
+	}
+	return nil
+}
+
+// WipeDir removes everything in the output directory dir, if wipeableDir
+// allows it.
+func WipeDir(dir string) error {
+	if err := wipeableDir(dir); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanPaths(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	old := filepath.Join(td, "dist", "plan9", "app")
+	kept := filepath.Join(td, "dist", "README")
+	for _, path := range []string{old, kept} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	dir := filepath.Join(td, "dist")
+	paths := []string{old, old, filepath.Join(dir, "missing")}
+	removed, err := CleanPaths(dir, paths, true)
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("bad: %#v %v", removed, err)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("dry run removed %s", old)
+	}
+
+	if removed, err = CleanPaths(dir, paths, false); err != nil || len(removed) != 1 || removed[0] != old {
+		t.Fatalf("bad: %#v %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Dir(old)); !os.IsNotExist(err) {
+		t.Fatalf("empty directory wasn't removed: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestWipeDir(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	dist := filepath.Join(td, "dist")
+	if err := os.MkdirAll(filepath.Join(dist, "linux"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	for _, dir := range []string{".", "..", "/"} {
+		if err := WipeDir(dir); err == nil {
+			t.Fatalf("%s: should error", dir)
+		}
+	}
+	if err := WipeDir("dist"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if entries, err := ioutil.ReadDir(dist); err != nil || len(entries) != 0 {
+		t.Fatalf("bad: %#v %v", entries, err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// CodesignConfig is the "codesign" section of the config file. It signs
+// darwin binaries with codesign and optionally notarizes them with
+// notarytool. Both tools only exist on macOS.
+type CodesignConfig struct {
+	// Identity is the signing identity, such as
+	// "Developer ID Application: Example, Inc. (ABCDE12345)".
+	Identity string `json:"identity"`
+
+	// Keychain is the keychain to find the identity in, if not the
+	// default search list.
+	Keychain string `json:"keychain,omitempty"`
+
+	// Entitlements is the path to an entitlements plist.
+	Entitlements string `json:"entitlements,omitempty"`
+
+	// Notarize, if set, submits each signed binary for notarization and
+	// waits for the result.
+	Notarize *NotarizeConfig `json:"notarize,omitempty"`
+}
+
+// NotarizeConfig holds the credentials for notarytool. Exactly one of a
+// keychain profile, an App Store Connect API key, or an Apple ID must be
+// configured.
+type NotarizeConfig struct {
+	// Profile is a keychain profile created with
+	// `xcrun notarytool store-credentials`.
+	Profile string `json:"profile,omitempty"`
+
+	// Key, KeyID and Issuer are an App Store Connect API key.
+	Key    string `json:"key,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+	Issuer string `json:"issuer,omitempty"`
+
+	// AppleID, TeamID and Password are an Apple ID with an app-specific
+	// password. The password may be given as "@env:NAME" to read it from
+	// the environment, as notarytool itself supports.
+	AppleID  string `json:"apple_id,omitempty"`
+	TeamID   string `json:"team_id,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validate checks that the config is usable on this machine.
+func (c *CodesignConfig) Validate() error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("codesign: signing darwin binaries requires a macOS host")
+	}
+	if c.Identity == "" {
+		return fmt.Errorf("codesign: identity is required")
+	}
+	if c.Notarize != nil {
+		return c.Notarize.Validate()
+	}
+
+	return nil
+}
+
+// Validate checks that exactly one set of credentials is configured.
+func (c *NotarizeConfig) Validate() error {
+	n := 0
+	if c.Profile != "" {
+		n++
+	}
+	if c.Key != "" || c.KeyID != "" || c.Issuer != "" {
+		if c.Key == "" || c.KeyID == "" || c.Issuer == "" {
+			return fmt.Errorf("codesign: notarize key, key_id and issuer must all be set")
+		}
+		n++
+	}
+	if c.AppleID != "" || c.TeamID != "" || c.Password != "" {
+		if c.AppleID == "" || c.TeamID == "" || c.Password == "" {
+			return fmt.Errorf("codesign: notarize apple_id, team_id and password must all be set")
+		}
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("codesign: notarize needs exactly one of profile, key, or apple_id")
+	}
+
+	return nil
+}
+
+// authArgs are the notarytool arguments for the configured credentials.
+func (c *NotarizeConfig) authArgs() []string {
+	switch {
+	case c.Profile != "":
+		return []string{"--keychain-profile", c.Profile}
+	case c.Key != "":
+		return []string{"--key", c.Key, "--key-id", c.KeyID, "--issuer", c.Issuer}
+	default:
+		return []string{"--apple-id", c.AppleID, "--team-id", c.TeamID, "--password", c.Password}
+	}
+}
+
+// signArgs are the codesign arguments for signing path. The hardened
+// runtime and a secure timestamp are required for notarization.
+func (c *CodesignConfig) signArgs(path string) []string {
+	args := []string{"--force", "--timestamp", "--options", "runtime", "--sign", c.Identity}
+	if c.Keychain != "" {
+		args = append(args, "--keychain", c.Keychain)
+	}
+	if c.Entitlements != "" {
+		args = append(args, "--entitlements", c.Entitlements)
+	}
+
+	return append(args, path)
+}
+
+// Codesign signs the darwin binary at path and, if configured, notarizes
+// it. Notarization blocks until Apple has processed the submission.
+//
+// Apple can't staple a ticket to a bare executable, so notarized binaries
+// are validated online by Gatekeeper the first time they're run.
+func Codesign(c *CodesignConfig, path string) error {
+	if _, err := execGo("codesign", nil, "", c.signArgs(path)...); err != nil {
+		return fmt.Errorf("codesign: %s", err)
+	}
+	if c.Notarize == nil {
+		return nil
+	}
+
+	// notarytool only accepts zip, pkg and dmg files
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+	zipPath := filepath.Join(td, filepath.Base(path)+".zip")
+	if err := zipFile(zipPath, path); err != nil {
+		return err
+	}
+
+	args := append([]string{"notarytool", "submit", zipPath,
+		"--wait", "--output-format", "json"}, c.Notarize.authArgs()...)
+	output, err := execGo("xcrun", nil, "", args...)
+	if err != nil {
+		return fmt.Errorf("notarytool: %s", err)
+	}
+
+	var result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return fmt.Errorf("notarytool: unexpected output: %s", output)
+	}
+	if result.Status != "Accepted" {
+		// The log explains why, so include it if we can get it
+		args := append([]string{"notarytool", "log", result.ID}, c.Notarize.authArgs()...)
+		log, _ := execGo("xcrun", nil, "", args...)
+		return fmt.Errorf("notarization %s: %s\n%s", result.ID, result.Status, log)
+	}
+
+	return nil
+}
+
+// zipFile writes a zip archive to dst containing only the file src,
+// preserving its mode.
+func zipFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Method = zip.Deflate
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
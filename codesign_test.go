@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNotarizeConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config NotarizeConfig
+		Err    bool
+	}{
+		{NotarizeConfig{}, true},
+		{NotarizeConfig{Profile: "gox"}, false},
+		{NotarizeConfig{Key: "key.p8", KeyID: "ABC", Issuer: "123"}, false},
+		{NotarizeConfig{Key: "key.p8"}, true},
+		{NotarizeConfig{AppleID: "a@example.com", TeamID: "T", Password: "@env:PW"}, false},
+		{NotarizeConfig{Profile: "gox", AppleID: "a@example.com", TeamID: "T", Password: "p"}, true},
+	}
+
+	for i, tc := range cases {
+		err := tc.Config.Validate()
+		if (err != nil) != tc.Err {
+			t.Errorf("%d: err: %v", i, err)
+		}
+	}
+}
+
+func TestCodesignConfigSignArgs(t *testing.T) {
+	c := &CodesignConfig{Identity: "Developer ID", Entitlements: "app.plist"}
+	expected := []string{
+		"--force", "--timestamp", "--options", "runtime",
+		"--sign", "Developer ID",
+		"--entitlements", "app.plist",
+		"/out/app",
+	}
+	if actual := c.signArgs("/out/app"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
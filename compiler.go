@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The compilers of -compiler. The default, "gc", is the Go toolchain.
+const (
+	compilerGc     = "gc"
+	compilerGccgo  = "gccgo"
+	compilerTinygo = "tinygo"
+)
+
+// tinygoTargetOS is the OS of the platforms that are TinyGo targets, such
+// as "target/pico", which are built with `tinygo build -target`.
+const tinygoTargetOS = "target"
+
+// gccgoPlatforms are the platforms that gccgo builds for beyond those of
+// gc. Cross-compiling needs a gccgo for the platform, set with
+// GOX_[OS]_[ARCH]_GCCGO.
+var gccgoPlatforms = []Platform{
+	{OS: "linux", Arch: "ppc", Default: false},
+	{OS: "linux", Arch: "s390", Default: false},
+	{OS: "linux", Arch: "sparc", Default: false},
+	{OS: "linux", Arch: "sparc64", Default: false},
+	{OS: "solaris", Arch: "sparc64", Default: false},
+}
+
+// tinygoPlatforms are the platforms that TinyGo builds for: some of the
+// usual ones, WebAssembly, and a selection of its microcontroller boards,
+// which are never built by default.
+var tinygoPlatforms = []Platform{
+	{OS: "darwin", Arch: "amd64", Default: true},
+	{OS: "darwin", Arch: "arm64", Default: true},
+	{OS: "linux", Arch: "386", Default: true},
+	{OS: "linux", Arch: "amd64", Default: true},
+	{OS: "linux", Arch: "arm", Default: true},
+	{OS: "linux", Arch: "arm64", Default: true},
+	{OS: "windows", Arch: "amd64", Default: true},
+	{OS: "windows", Arch: "arm64", Default: true},
+	{OS: "js", Arch: "wasm", Default: true},
+	{OS: "wasip1", Arch: "wasm", Default: true},
+	{OS: tinygoTargetOS, Arch: "arduino", Default: false},
+	{OS: tinygoTargetOS, Arch: "arduino-nano33", Default: false},
+	{OS: tinygoTargetOS, Arch: "esp32", Default: false},
+	{OS: tinygoTargetOS, Arch: "feather-m4", Default: false},
+	{OS: tinygoTargetOS, Arch: "microbit", Default: false},
+	{OS: tinygoTargetOS, Arch: "nano-rp2040", Default: false},
+	{OS: tinygoTargetOS, Arch: "pico", Default: false},
+	{OS: tinygoTargetOS, Arch: "wasip2", Default: false},
+	{OS: tinygoTargetOS, Arch: "wasm-unknown", Default: false},
+	{OS: tinygoTargetOS, Arch: "wioterminal", Default: false},
+}
+
+// ValidateCompiler checks a value of -compiler.
+func ValidateCompiler(compiler string) error {
+	switch compiler {
+	case compilerGc, compilerGccgo, compilerTinygo:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid -compiler value %q: must be gc, gccgo, or tinygo", compiler)
+}
+
+// CompilerPlatforms returns the platforms that compiler supports with the
+// Go version v.
+func CompilerPlatforms(compiler, v string) []Platform {
+	switch compiler {
+	case compilerGccgo:
+		platforms, err := PlatformSet(SupportedPlatforms(v)).Merge(gccgoPlatforms...)
+		if err != nil {
+			return SupportedPlatforms(v)
+		}
+		return platforms
+	case compilerTinygo:
+		return tinygoPlatforms
+	}
+
+	return SupportedPlatforms(v)
+}
+
+// isTinygoTarget reports whether p is a TinyGo target rather than a
+// GOOS/GOARCH pair.
+func isTinygoTarget(p Platform) bool {
+	return p.OS == tinygoTargetOS
+}
+
+// checkCompiler returns an error if opts use features that the compiler
+// doesn't have, before anything is built.
+func (opts *CompileOpts) checkCompiler() error {
+	var unsupported []string
+	switch opts.Compiler {
+	case compilerGccgo:
+		if opts.Race {
+			unsupported = append(unsupported, "-race")
+		}
+		if opts.Asmflags != "" {
+			unsupported = append(unsupported, "-asmflags")
+		}
+		if opts.Static {
+			unsupported = append(unsupported, "-static")
+		}
+		if opts.PGO != "" {
+			unsupported = append(unsupported, "-pgo")
+		}
+		if opts.Garble != "" {
+			unsupported = append(unsupported, "-obfuscate")
+		}
+		if _, err := gccgoLdflags(opts.Ldflags); err != nil {
+			return err
+		}
+	case compilerTinygo:
+		for flag, set := range map[string]bool{
+			"-race":       opts.Race,
+			"-mod":        opts.ModMode != "",
+			"-modcacherw": opts.ModCacheRW,
+			"-pgo":        opts.PGO != "",
+			"-obfuscate":  opts.Garble != "",
+			"-buildmode":  opts.BuildMode != "",
+			"-gcflags":    opts.Gcflags != "",
+			"-asmflags":   opts.Asmflags != "",
+			"-rebuild":    opts.Rebuild,
+			"-trimpath":   opts.Trimpath,
+			"-static":     opts.Static,
+			"-strip":      opts.Strip,
+		} {
+			if set {
+				unsupported = append(unsupported, flag)
+			}
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	sort.Strings(unsupported)
+	return fmt.Errorf("-compiler=%s doesn't support %s", opts.Compiler, strings.Join(unsupported, ", "))
+}
+
+// compilerFlags returns the arguments of `go build` that pass the flags of
+// opts to the compiler. gccgo takes the -gcflags, and -s of the -ldflags,
+// as -gccgoflags.
+func (opts *CompileOpts) compilerFlags(ldflags string) []string {
+	if opts.Compiler != compilerGccgo {
+		return []string{
+			"-gcflags", opts.Gcflags,
+			"-ldflags", ldflags,
+			"-asmflags", opts.Asmflags,
+		}
+	}
+
+	flags, _ := gccgoLdflags(ldflags)
+	flags = append(strings.Fields(opts.Gcflags), flags...)
+	return []string{"-compiler", compilerGccgo, "-gccgoflags", strings.Join(flags, " ")}
+}
+
+// gccgoLdflags translates the linker flags of gc to gccgo flags. Only
+// stripping translates, gccgo has no -X.
+func gccgoLdflags(ldflags string) ([]string, error) {
+	var result []string
+	for _, f := range strings.Fields(ldflags) {
+		switch f {
+		case "-s", "-w":
+			if len(result) == 0 {
+				result = append(result, "-s")
+			}
+		case "-buildid=":
+			// Reproducible builds ask for it, gccgo has no build ID
+		default:
+			return nil, fmt.Errorf("-compiler=gccgo doesn't support the linker flag %s", f)
+		}
+	}
+
+	return result, nil
+}
+
+// tinygoArgs returns the arguments of `tinygo build` for opts.
+func (opts *CompileOpts) tinygoArgs(ldflags, output, pkg string) []string {
+	args := []string{"build"}
+	if isTinygoTarget(opts.Platform) {
+		args = append(args, "-target", opts.Platform.Arch)
+	}
+	if opts.Tags != "" {
+		args = append(args, "-tags", opts.Tags)
+	}
+	if ldflags != "" && ldflags != "-buildid=" {
+		args = append(args, "-ldflags", ldflags)
+	}
+
+	return append(args, "-o", output, pkg)
+}
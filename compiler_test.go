@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompilerPlatforms(t *testing.T) {
+	has := func(platforms []Platform, s string) bool {
+		for _, p := range platforms {
+			if p.String() == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	gc := CompilerPlatforms("gc", "go1.21")
+	if !reflect.DeepEqual(gc, SupportedPlatforms("go1.21")) || has(gc, "linux/sparc64") {
+		t.Fatalf("bad: %#v", gc)
+	}
+
+	gccgo := CompilerPlatforms("gccgo", "go1.21")
+	if !has(gccgo, "linux/amd64") || !has(gccgo, "linux/sparc64") {
+		t.Fatalf("bad: %#v", gccgo)
+	}
+
+	tinygo := CompilerPlatforms("tinygo", "go1.21")
+	if !has(tinygo, "wasip1/wasm") || !has(tinygo, "target/pico") || has(tinygo, "plan9/386") {
+		t.Fatalf("bad: %#v", tinygo)
+	}
+	for _, p := range tinygo {
+		if isTinygoTarget(p) && p.Default {
+			t.Fatalf("bad: %#v", p)
+		}
+	}
+}
+
+func TestCompileOptsCheckCompiler(t *testing.T) {
+	cases := []struct {
+		Opts CompileOpts
+		Err  bool
+	}{
+		{CompileOpts{Race: true}, false},
+		{CompileOpts{Compiler: "gccgo", Gcflags: "-O2", Ldflags: "-s -w"}, false},
+		{CompileOpts{Compiler: "gccgo", Race: true}, true},
+		{CompileOpts{Compiler: "gccgo", Ldflags: "-X main.version=1"}, true},
+		{CompileOpts{Compiler: "tinygo", Tags: "foo", Ldflags: "-X main.version=1"}, false},
+		{CompileOpts{Compiler: "tinygo", Trimpath: true}, true},
+		{CompileOpts{Compiler: "tinygo", ModMode: "vendor"}, true},
+	}
+
+	for i, tc := range cases {
+		if err := tc.Opts.checkCompiler(); (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+}
+
+func TestCompileOptsCompilerFlags(t *testing.T) {
+	opts := &CompileOpts{Compiler: "gccgo", Gcflags: "-O2"}
+	actual := opts.compilerFlags("-s -w -buildid=")
+	expected := []string{"-compiler", "gccgo", "-gccgoflags", "-O2 -s"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	opts = &CompileOpts{
+		Compiler: "tinygo",
+		Platform: Platform{OS: "target", Arch: "pico"},
+		Tags:     "foo",
+	}
+	actual = opts.tinygoArgs("", "out/app", "./cmd/app")
+	expected = []string{"build", "-target", "pico", "-tags", "foo", "-o", "out/app", "./cmd/app"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	for _, e := range opts.buildEnv() {
+		if e == "GOOS=target" {
+			t.Fatalf("bad: %s", e)
+		}
+	}
+}
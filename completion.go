@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// completionShells are the shells that `gox completion` writes scripts
+// for.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionCommand is a subcommand of gox and its flags.
+type completionCommand struct {
+	Name  string
+	Flags []string
+}
+
+// completionFlagRe matches a flag listed in the options of a help text.
+var completionFlagRe = regexp.MustCompile(`^  (-[a-z0-9][a-z0-9-]*)`)
+
+// helpFlags returns the flags listed in the Options sections of a help
+// text, such as "Options:" or "Options for bundle:", in order.
+func helpFlags(help string) []string {
+	var flags []string
+	seen := make(map[string]bool)
+	options := false
+	for _, line := range strings.Split(help, "\n") {
+		// Sections start with a heading that isn't indented
+		if line != "" && line[0] != ' ' {
+			options = strings.HasPrefix(line, "Options") && strings.HasSuffix(line, ":")
+			continue
+		}
+		if m := completionFlagRe.FindStringSubmatch(line); options && m != nil && !seen[m[1]] {
+			seen[m[1]] = true
+			flags = append(flags, m[1])
+		}
+	}
+	return flags
+}
+
+// completionCommands returns gox itself, with no name, and each of its
+// subcommands with their flags, from their help texts.
+func completionCommands() []completionCommand {
+	helps := []struct{ Name, Help string }{
+		{"", helpText},
+		{"clean", cleanHelpText},
+		{"completion", completionHelpText},
+		{"doctor", doctorHelpText},
+		{"image", imageHelpText},
+		{"import", importHelpText},
+		{"init", initHelpText()},
+		{"inspect", inspectHelpText},
+		{"list", listHelpText},
+		{"matrix", matrixHelpText},
+		{"promote", promoteHelpText},
+		{"serve", serveHelpText},
+		{"sizes", sizesHelpText},
+		{"toolchains", toolchainsHelpText},
+		{"verify", verifyHelpText},
+		// verify-reproducible takes the options of a build
+		{"verify-reproducible", helpText},
+		{"worker", workerHelpText},
+	}
+
+	commands := make([]completionCommand, len(helps))
+	for i, h := range helps {
+		commands[i] = completionCommand{Name: h.Name, Flags: helpFlags(h.Help)}
+	}
+	return commands
+}
+
+// completionPlatforms returns what the -osarch, -os or -arch flags take
+// for the platforms, sorted, which the scripts complete them with.
+func completionPlatforms(kind string, platforms []Platform) ([]string, error) {
+	seen := make(map[string]bool)
+	var values []string
+	for _, p := range platforms {
+		var v string
+		switch kind {
+		case "osarch":
+			v = p.String()
+		case "os":
+			v = p.OS
+		case "arch":
+			v = p.Arch
+		default:
+			return nil, fmt.Errorf("Invalid -platforms value %q: must be osarch, os, or arch", kind)
+		}
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// WriteCompletion writes the completion script for shell. The flags are
+// those of this gox, and the platforms are asked of gox when they are
+// completed, for the Go installed then.
+func WriteCompletion(w io.Writer, shell string) error {
+	commands := completionCommands()
+	var names []string
+	for _, c := range commands[1:] {
+		names = append(names, c.Name)
+	}
+
+	var buf bytes.Buffer
+	switch shell {
+	case "bash":
+		buf.WriteString(bashCompletionHead)
+		for _, c := range commands[1:] {
+			fmt.Fprintf(&buf, "    %s) flags=%q ;;\n", c.Name, strings.Join(c.Flags, " "))
+		}
+		fmt.Fprintf(&buf, "    *) flags=%q ;;\n", strings.Join(commands[0].Flags, " "))
+		fmt.Fprintf(&buf, bashCompletionTail, strings.Join(names, " "))
+
+	case "zsh":
+		buf.WriteString(zshCompletionHead)
+		for _, c := range commands[1:] {
+			fmt.Fprintf(&buf, "  %s) flags=(%s) ;;\n", c.Name, strings.Join(c.Flags, " "))
+		}
+		fmt.Fprintf(&buf, "  *) flags=(%s) ;;\n", strings.Join(commands[0].Flags, " "))
+		fmt.Fprintf(&buf, zshCompletionTail, strings.Join(names, " "))
+
+	case "fish":
+		fmt.Fprintf(&buf, fishCompletionHead, strings.Join(names, " "))
+		for _, c := range commands {
+			cond := fmt.Sprintf("__fish_seen_subcommand_from %s", c.Name)
+			if c.Name == "" {
+				cond = "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+			}
+			for _, f := range c.Flags {
+				fmt.Fprintf(&buf, "complete -c gox -n '%s' -o %s", cond, f[1:])
+				if f == "-osarch" || f == "-os" || f == "-arch" {
+					fmt.Fprintf(&buf, " -x -a '(__gox_platforms %s)'", f[1:])
+				}
+				buf.WriteString("\n")
+			}
+		}
+
+	case "powershell":
+		buf.WriteString(powershellCompletionHead)
+		for _, c := range commands {
+			fmt.Fprintf(&buf, "        '%s' = @('%s')\n", c.Name, strings.Join(c.Flags, "', '"))
+		}
+		fmt.Fprintf(&buf, powershellCompletionTail, strings.Join(names, "', '"))
+
+	default:
+		return fmt.Errorf("unknown shell %q: must be %s", shell, strings.Join(completionShells, ", "))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// The scripts complete subcommands, the flags of each command, platforms
+// for -osarch, -os and -arch, as "-osarch=VALUE" or "-osarch VALUE", and
+// directories for the packages.
+
+const bashCompletionHead = `# bash completion for gox, from "gox completion bash"
+_gox() {
+    local cur prev cmd flags prefix=""
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    cmd=""
+    if [ "$COMP_CWORD" -gt 1 ]; then
+        cmd="${COMP_WORDS[1]}"
+    fi
+
+    # "=" breaks words in bash, so "-osarch=linux" is "-osarch" "=" "linux"
+    if [ "$cur" = "=" ]; then
+        prefix="="
+        cur=""
+    elif [ "$prev" = "=" ]; then
+        prev="${COMP_WORDS[COMP_CWORD-2]}"
+    elif [[ "$cur" == -*=* ]]; then
+        prev="${cur%%=*}"
+        prefix="$prev="
+        cur="${cur#*=}"
+    fi
+    case "$prev" in
+    -osarch|-os|-arch)
+        COMPREPLY=($(compgen -P "$prefix" -W "$(gox completion -platforms="${prev#-}" 2>/dev/null)" -- "$cur"))
+        return
+        ;;
+    esac
+
+    case "$cmd" in
+`
+
+const bashCompletionTail = `    esac
+    if [ "$COMP_CWORD" -eq 1 ] && [[ "$cur" != -* ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    elif [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -d -- "$cur"))
+    fi
+}
+complete -F _gox gox
+`
+
+const zshCompletionHead = `#compdef gox
+# zsh completion for gox, from "gox completion zsh"
+_gox() {
+  local cmd flag
+  local -a flags
+  if (( CURRENT > 2 )); then
+    cmd=$words[2]
+  fi
+
+  flag=$words[CURRENT-1]
+  if [[ $words[CURRENT] == -*=* ]]; then
+    flag=${words[CURRENT]%%=*}
+    compset -P '*='
+  fi
+  case $flag in
+  -osarch|-os|-arch)
+    compadd -- ${(f)"$(gox completion -platforms=${flag#-} 2>/dev/null)"}
+    return
+    ;;
+  esac
+
+  case $cmd in
+`
+
+const zshCompletionTail = `  esac
+  if (( CURRENT == 2 )) && [[ $words[CURRENT] != -* ]]; then
+    compadd -- %s
+  elif [[ $words[CURRENT] == -* ]]; then
+    compadd -- $flags
+  else
+    _files -/
+  fi
+}
+
+if [ "$funcstack[1]" = "_gox" ]; then
+  _gox "$@"
+else
+  compdef _gox gox
+fi
+`
+
+const fishCompletionHead = `# fish completion for gox, from "gox completion fish"
+function __gox_platforms
+    gox completion -platforms=$argv[1] 2>/dev/null
+end
+
+complete -c gox -n __fish_use_subcommand -x -a '%s'
+`
+
+const powershellCompletionHead = `# PowerShell completion for gox, from "gox completion powershell"
+Register-ArgumentCompleter -Native -CommandName gox -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $flags = @{
+`
+
+const powershellCompletionTail = `    }
+    $commands = @('%s')
+
+    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $command = ''
+    if ($words.Count -gt 1 -and $commands -contains $words[1]) {
+        $command = $words[1]
+    }
+    $prev = if ($wordToComplete) { $words[$words.Count - 2] } else { $words[$words.Count - 1] }
+
+    $prefix = ''
+    $value = $wordToComplete
+    if ($wordToComplete -match '^(-[a-z]+)=(.*)$') {
+        $prev = $Matches[1]
+        $prefix = $Matches[1] + '='
+        $value = $Matches[2]
+    }
+    if (@('-osarch', '-os', '-arch') -contains $prev) {
+        $values = gox completion "-platforms=$($prev.Substring(1))" 2>$null
+    } elseif ($words.Count -le 2 -and -not $wordToComplete.StartsWith('-')) {
+        $values = $commands
+    } else {
+        $values = $flags[$command]
+    }
+
+    $values | Where-Object { $_ -like "$value*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($prefix + $_, $_, 'ParameterValue', $_)
+    }
+}
+`
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHelpFlags(t *testing.T) {
+	help := `Usage: gox example [options]
+
+  Does things. With -force it does them
+  anyway.
+
+Options:
+
+  -output="foo"       Output path
+  -os=""              Operating systems, also
+                      -os="linux darwin"
+  -dry-run            Print instead
+
+Examples:
+
+  -not-a-flag
+
+Options for restore:
+
+  -dir="gox"          Directory
+  -output             Again
+`
+	expected := []string{"-output", "-os", "-dry-run", "-dir"}
+	if actual := helpFlags(help); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestCompletionPlatforms(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+	cases := map[string][]string{
+		"osarch": {"darwin/arm64", "linux/amd64", "linux/armv7"},
+		"os":     {"darwin", "linux"},
+		"arch":   {"amd64", "arm", "arm64"},
+	}
+	for kind, expected := range cases {
+		actual, err := completionPlatforms(kind, platforms)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("bad: %s: %#v", kind, actual)
+		}
+	}
+
+	if _, err := completionPlatforms("compiler", platforms); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := WriteCompletion(&buf, shell); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		script := buf.String()
+		for _, s := range []string{"osarch", "dry-run", "verify-reproducible", "-platforms="} {
+			if !strings.Contains(script, s) {
+				t.Fatalf("%s: no %s in:\n%s", shell, s, script)
+			}
+		}
+	}
+
+	if err := WriteCompletion(ioutil.Discard, "tcsh"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestWriteCompletion_bash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "gox.bash")
+	var buf bytes.Buffer
+	if err := WriteCompletion(&buf, "bash"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Complete "gox clean -dr" with the script
+	output, err := exec.Command("bash", "-c", `source "$0"; COMP_WORDS=(gox clean -dr); COMP_CWORD=2; _gox; echo "${COMPREPLY[@]}"`, path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("err: %s\n%s", err, output)
+	}
+	if strings.TrimSpace(string(output)) != "-dry-run" {
+		t.Fatalf("bad: %s", output)
+	}
+}
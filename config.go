@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// DefaultConfigFile is the config file that is loaded, if it exists,
+// when no -config flag is given.
+const DefaultConfigFile = "gox.json"
+
+// Config is the gox configuration file. Flags cover the build itself;
+// the config file holds the settings for everything that happens to the
+// binaries afterwards, which are too structured to fit in flags. Every
+// section is optional.
+type Config struct {
+	// Concurrency limits how many operations of each stage run at once.
+	Concurrency ConcurrencyConfig `json:"concurrency"`
+
+	// OSArch are the os/arch pairs to build when none of -os, -arch and
+	// -osarch are given.
+	OSArch []string `json:"osarch,omitempty"`
+
+	// Annotations are key/value pairs, such as {"team": "payments"},
+	// attached to every artifact so that inventory systems downstream can
+	// classify them. They are in the -json summary and are set as OCI
+	// annotations by `gox image`. Packages can add to and override them.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Packages overrides the build of individual main packages, keyed by
+	// import path. See PackageConfig.
+	Packages map[string]*PackageConfig `json:"packages,omitempty"`
+
+	// Static lists the platforms that -static lets link dynamically. See
+	// StaticConfig.
+	Static *StaticConfig `json:"static,omitempty"`
+
+	// Version, if set, picks where the release version comes from. See
+	// VersionConfig.
+	Version *VersionConfig `json:"version,omitempty"`
+
+	// Archives and Checksums, if set, pack each binary into an archive
+	// and write a checksums file. See ArchiveConfig and ChecksumConfig.
+	Archives  *ArchiveConfig  `json:"archives,omitempty"`
+	Checksums *ChecksumConfig `json:"checksums,omitempty"`
+
+	// Homebrew, Scoop, Winget, Aur and Chocolatey, if set, write the
+	// packages of those package managers for the archives. See
+	// HomebrewConfig, ScoopConfig, WingetConfig, AurConfig and
+	// ChocolateyConfig.
+	Homebrew   *HomebrewConfig   `json:"homebrew,omitempty"`
+	Scoop      *ScoopConfig      `json:"scoop,omitempty"`
+	Winget     *WingetConfig     `json:"winget,omitempty"`
+	Aur        *AurConfig        `json:"aur,omitempty"`
+	Chocolatey *ChocolateyConfig `json:"chocolatey,omitempty"`
+
+	// Uploads are the HTTP endpoints that -publish uploads artifacts to.
+	// See UploadConfig.
+	Uploads []*UploadConfig `json:"uploads,omitempty"`
+
+	// Notes is where the release notes come from. See NotesConfig.
+	Notes *NotesConfig `json:"notes,omitempty"`
+
+	// Release is the release on GitHub, GitLab, Gitea or Forgejo that
+	// -publish attaches artifacts to. See ReleaseConfig.
+	Release *ReleaseConfig `json:"release,omitempty"`
+
+	// Channels are where releases are published, for `gox promote`. See
+	// ChannelConfig.
+	Channels map[string]*ChannelConfig `json:"channels,omitempty"`
+
+	// Workers are the remote build workers of -builder=remote. See
+	// WorkersConfig.
+	Workers *WorkersConfig `json:"workers,omitempty"`
+
+	// Nfpm, if set, packages linux binaries as deb, rpm, and apk
+	// packages. See NfpmConfig.
+	Nfpm *NfpmConfig `json:"nfpm,omitempty"`
+
+	// Snap and AppImage, if set, pack linux binaries as snaps and
+	// AppImages, with the desktop entry of Desktop. See SnapConfig,
+	// AppImageConfig and DesktopConfig.
+	Snap     *SnapConfig     `json:"snap,omitempty"`
+	AppImage *AppImageConfig `json:"appimage,omitempty"`
+	Desktop  *DesktopConfig  `json:"desktop,omitempty"`
+
+	// Installer, if set, builds MSI and DMG installers. See
+	// InstallerConfig.
+	Installer *InstallerConfig `json:"installer,omitempty"`
+
+	// Codesign, if set, signs and optionally notarizes darwin binaries.
+	// See CodesignConfig.
+	Codesign *CodesignConfig `json:"codesign,omitempty"`
+
+	// Authenticode, if set, signs windows binaries. See
+	// AuthenticodeConfig.
+	Authenticode *AuthenticodeConfig `json:"authenticode,omitempty"`
+
+	// Vault, if set, fetches the credentials that the other sections read
+	// from the environment from HashiCorp Vault. See VaultConfig.
+	Vault *VaultConfig `json:"vault,omitempty"`
+
+	// Sign, if set, signs artifacts with a key of a cloud KMS. See
+	// SignConfig.
+	Sign *SignConfig `json:"sign,omitempty"`
+
+	// VersionInfo, if set, embeds version details and an icon into
+	// windows binaries. See VersionInfoConfig.
+	VersionInfo *VersionInfoConfig `json:"versioninfo,omitempty"`
+
+	// CShared describes the packages built from c-shared libraries. See
+	// CSharedConfig.
+	CShared *CSharedConfig `json:"cshared,omitempty"`
+
+	// Wheel and Npm, if set, wrap c-shared libraries in Python wheels and
+	// npm packages. See WheelConfig and NpmConfig.
+	Wheel *WheelConfig `json:"wheel,omitempty"`
+	Npm   *NpmConfig   `json:"npm,omitempty"`
+}
+
+// Validate checks every section of the config.
+func (c *Config) Validate() error {
+	if err := c.Concurrency.Validate(); err != nil {
+		return err
+	}
+	for _, v := range c.OSArch {
+		if parts := strings.Split(v, "/"); len(parts) != 2 || strings.TrimPrefix(parts[0], "!") == "" || parts[1] == "" {
+			return fmt.Errorf("osarch: %s should be os/arch", v)
+		}
+	}
+	if err := validateAnnotations("annotations", c.Annotations); err != nil {
+		return err
+	}
+	for key, p := range c.Packages {
+		if p == nil {
+			continue
+		}
+		if err := p.Validate(key); err != nil {
+			return err
+		}
+	}
+	if c.Static != nil {
+		if err := c.Static.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Version != nil {
+		if err := c.Version.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Archives != nil {
+		if err := c.Archives.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Checksums != nil {
+		if err := c.Checksums.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Homebrew != nil {
+		if c.Archives == nil {
+			return fmt.Errorf("homebrew: the archives section is required")
+		}
+		if err := c.Homebrew.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Scoop != nil {
+		if c.Archives == nil {
+			return fmt.Errorf("scoop: the archives section is required")
+		}
+		if err := c.Scoop.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Winget != nil {
+		if c.Archives == nil || c.Archives.format("windows") != "zip" {
+			return fmt.Errorf(`winget: the archives section is required, with "zip" archives for windows`)
+		}
+		if err := c.Winget.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Aur != nil {
+		if c.Archives == nil || c.Archives.format("linux") == "zip" {
+			return fmt.Errorf(`aur: the archives section is required, with tar archives for linux`)
+		}
+		if err := c.Aur.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Chocolatey != nil {
+		if c.Archives == nil || c.Archives.format("windows") != "zip" {
+			return fmt.Errorf(`chocolatey: the archives section is required, with "zip" archives for windows`)
+		}
+		if err := c.Chocolatey.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, u := range c.Uploads {
+		if u == nil {
+			continue
+		}
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Notes != nil {
+		if err := c.Notes.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Workers != nil {
+		if err := c.Workers.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Release != nil {
+		if err := c.Release.Validate(); err != nil {
+			return err
+		}
+	}
+	for name, ch := range c.Channels {
+		if ch == nil {
+			continue
+		}
+		if err := ch.Validate(name); err != nil {
+			return err
+		}
+	}
+	if c.Nfpm != nil {
+		if err := c.Nfpm.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Snap != nil {
+		if err := c.Snap.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.AppImage != nil && (c.Desktop == nil || c.Desktop.Icon == "") {
+		return fmt.Errorf("appimage: the desktop section is required, with an icon")
+	}
+	if c.Desktop != nil {
+		if err := c.Desktop.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Installer != nil {
+		if err := c.Installer.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Codesign != nil {
+		if err := c.Codesign.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Authenticode != nil {
+		if err := c.Authenticode.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Vault != nil {
+		if err := c.Vault.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sign != nil {
+		if err := c.Sign.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.VersionInfo != nil {
+		if err := c.VersionInfo.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Wheel != nil {
+		if err := c.Wheel.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Npm != nil {
+		if err := c.Npm.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ArtifactAnnotations returns the annotations of the artifacts of the main
+// package with the import path: those of the config, with those of its
+// entry in "packages" on top.
+func (c *Config) ArtifactAnnotations(path string) map[string]string {
+	var pkg map[string]string
+	if p := packageConfig(c.Packages, path); p != nil {
+		pkg = p.Annotations
+	}
+	return mergeAnnotations(c.Annotations, pkg)
+}
+
+// Versioned reports whether the config names or publishes anything with
+// the release version: archives, checksums, packages or a release.
+func (c *Config) Versioned() bool {
+	return c.Archives != nil || c.Checksums != nil || c.Release != nil || len(c.Uploads) > 0 ||
+		c.Homebrew != nil || c.Scoop != nil || c.Winget != nil || c.Aur != nil || c.Chocolatey != nil ||
+		c.Nfpm != nil || c.Snap != nil || c.AppImage != nil || c.Installer != nil ||
+		c.CShared != nil || c.Wheel != nil || c.Npm != nil
+}
+
+// mergeAnnotations returns the annotations of base with those of
+// overrides on top. It returns overrides itself when there's nothing to
+// merge.
+func mergeAnnotations(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 {
+		return overrides
+	}
+
+	result := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overrides {
+		result[k] = v
+	}
+	return result
+}
+
+func validateAnnotations(section string, annotations map[string]string) error {
+	for k := range annotations {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("%s: empty annotation key", section)
+		}
+	}
+
+	return nil
+}
+
+// LoadSecrets fetches the secrets of the "vault" section, if there is one,
+// and returns a func that removes the files it wrote.
+func (c *Config) LoadSecrets() (func(), error) {
+	if c.Vault == nil {
+		return func() {}, nil
+	}
+	files, err := c.Vault.Load()
+	return func() { removeFiles(files) }, err
+}
+
+// LoadConfig loads the config file at path. If path is empty the default
+// config file is loaded if it exists, and an empty config is returned if
+// it doesn't.
+func LoadConfig(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigFile
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err)
+	}
+
+	return &config, nil
+}
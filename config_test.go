@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "gox.json")
+	if err := ioutil.WriteFile(path, []byte(`{"nfpm": {"version": "1.0.0"}}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Nfpm == nil || c.Nfpm.Version != "1.0.0" {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	// An explicit path must exist
+	if _, err := LoadConfig(filepath.Join(td, "missing.json")); err == nil {
+		t.Fatal("should err")
+	}
+
+	// Bad JSON is an error
+	if err := ioutil.WriteFile(path, []byte(`{`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestConfigArtifactAnnotations(t *testing.T) {
+	c := &Config{
+		Annotations: map[string]string{"team": "payments", "tier": "1"},
+		Packages: map[string]*PackageConfig{
+			"cmd/debug": {Annotations: map[string]string{"tier": "3"}},
+			"cmd/other": {Tags: "netgo"},
+		},
+	}
+
+	cases := []struct {
+		Path   string
+		Output map[string]string
+	}{
+		{"example.com/app/cmd/server", map[string]string{"team": "payments", "tier": "1"}},
+		{"example.com/app/cmd/debug", map[string]string{"team": "payments", "tier": "3"}},
+		{"example.com/app/cmd/other", map[string]string{"team": "payments", "tier": "1"}},
+	}
+
+	for _, tc := range cases {
+		if actual := c.ArtifactAnnotations(tc.Path); !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("%s: bad: %#v", tc.Path, actual)
+		}
+	}
+
+	if actual := (&Config{}).ArtifactAnnotations("example.com/app"); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	c.Packages["cmd/bad"] = &PackageConfig{Annotations: map[string]string{" ": "x"}}
+	if err := c.Validate(); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// listedPackage is the part of a package in `go list -json` that says
+// whether it can be built.
+type listedPackage struct {
+	ImportPath string
+	Error      *struct {
+		Err string
+	}
+}
+
+// CheckBuildConstraints lists the package of opts, and every package that
+// it imports, as they would be for its platform, and returns why they
+// can't be built there, such as a dependency whose build constraints
+// leave out all of its files, or "" if they can. Errors that only the
+// compiler finds, such as a use of syscall.EpollWait outside of linux,
+// are still left for the build.
+func CheckBuildConstraints(opts *CompileOpts) (string, error) {
+	chdir, pkg := splitPackagePath(opts.PackagePath)
+	args := []string{"list", "-e", "-deps", "-json", "-tags", opts.buildTags()}
+	if opts.ModMode != "" {
+		args = append(args, "-mod", opts.ModMode)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay", opts.Overlay)
+	}
+	args = append(args, pkg)
+
+	output, err := execGo(opts.GoCmd, append(os.Environ(), opts.buildEnv()...), chdir, args...)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(output))
+	for dec.More() {
+		var p listedPackage
+		if err := dec.Decode(&p); err != nil {
+			return "", err
+		}
+		if p.Error != nil {
+			return fmt.Sprintf("%s: %s", p.ImportPath, strings.TrimSpace(p.Error.Err)), nil
+		}
+	}
+
+	return "", nil
+}
+
+// UnsupportedPlatforms calls check for each of platforms, parallel at a
+// time, and returns why those that can't be built can't be, keyed by the
+// name of the platform.
+func UnsupportedPlatforms(platforms []Platform, parallel int, check func(Platform) (string, error)) (map[string]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	semaphore := make(chan int, parallel)
+	result := make(map[string]string)
+	for _, p := range platforms {
+		wg.Add(1)
+		go func(p Platform) {
+			defer wg.Done()
+			semaphore <- 1
+			reason, err := check(p)
+			<-semaphore
+
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case err != nil && firstErr == nil:
+				firstErr = fmt.Errorf("%s: %s", p.String(), err)
+			case reason != "":
+				result[p.String()] = reason
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	return result, firstErr
+}
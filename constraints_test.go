@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckBuildConstraints(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(name, data string) {
+		path := filepath.Join(td, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.17\n")
+	write("main.go", "package main\n\nimport \"example.com/app/poll\"\n\nfunc main() { poll.Wait() }\n")
+	write("poll/poll_linux.go", "package poll\n\nfunc Wait() {}\n")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	opts := &CompileOpts{
+		PackagePath: "example.com/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		GoCmd:       "go",
+	}
+	if reason, err := CheckBuildConstraints(opts); err != nil || reason != "" {
+		t.Fatalf("bad: %q %v", reason, err)
+	}
+
+	opts.Platform = Platform{OS: "windows", Arch: "amd64"}
+	reason, err := CheckBuildConstraints(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(reason, "example.com/app/poll: build constraints exclude all Go files") {
+		t.Fatalf("bad: %q", reason)
+	}
+}
+
+func TestUnsupportedPlatforms(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "windows", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+
+	unsupported, err := UnsupportedPlatforms(platforms, 2, func(p Platform) (string, error) {
+		if p.OS == "linux" {
+			return "", nil
+		}
+		return "no " + p.OS, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]string{"windows/amd64": "no windows", "darwin/arm64": "no darwin"}
+	if !reflect.DeepEqual(unsupported, expected) {
+		t.Fatalf("bad: %#v", unsupported)
+	}
+
+	_, err = UnsupportedPlatforms(platforms[:1], 1, func(Platform) (string, error) {
+		return "", fmt.Errorf("broken")
+	})
+	if err == nil || err.Error() != "linux/amd64: broken" {
+		t.Fatalf("bad: %v", err)
+	}
+}
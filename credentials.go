@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// The credentials that other tools of the machine already keep are used
+// when none are given to gox: those of .netrc for every host, the
+// credential helpers of docker for registries, and the logins of gh and
+// glab for GitHub and GitLab.
+
+// storedTokens caches the tokens that storedForgeToken found, by forge
+// and host, as every request to a forge asks for one.
+var storedTokens = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// netrcFile returns the path of the .netrc file: $NETRC, or .netrc in the
+// home directory, which is _netrc on windows, as curl and git look for.
+func netrcFile() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(home, ".netrc")
+	if runtime.GOOS == "windows" {
+		if _, err := os.Stat(path); err != nil {
+			path = filepath.Join(home, "_netrc")
+		}
+	}
+	return path
+}
+
+// netrcLogin returns the login and password of host in the .netrc file,
+// or of its "default" entry.
+func netrcLogin(host string) (string, string, bool) {
+	f, err := os.Open(netrcFile())
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+
+	type entry struct{ machine, login, password string }
+	var entries []*entry
+	current := &entry{}
+	var key string
+	macro := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// A macro goes on to the next empty line
+		if macro {
+			macro = len(fields) > 0
+			continue
+		}
+		for _, field := range fields {
+			// Values can be on the line after their keyword
+			if key != "" {
+				switch key {
+				case "machine":
+					current.machine = field
+				case "login":
+					current.login = field
+				case "password":
+					current.password = field
+				}
+				key = ""
+				continue
+			}
+
+			switch field {
+			case "machine", "default":
+				current = &entry{}
+				entries = append(entries, current)
+			case "macdef":
+				macro = true
+			}
+			if macro {
+				break
+			}
+			if field != "default" {
+				key = field
+			}
+		}
+	}
+
+	// The default entry is only for hosts that no machine is
+	for _, machine := range []string{host, ""} {
+		for _, e := range entries {
+			if e.machine == machine && e.password != "" {
+				return e.login, e.password, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// urlHost returns the host of the URL u, without a port.
+func urlHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// storedForgeToken returns the token of the forge at host that gh or
+// glab logged in with, or the password of host in the .netrc file.
+func storedForgeToken(forge, host string, hosts ...string) string {
+	key := forge + " " + host
+	storedTokens.Lock()
+	defer storedTokens.Unlock()
+	if token, ok := storedTokens.m[key]; ok {
+		return token
+	}
+
+	var token string
+	var args []string
+	switch forge {
+	case "github":
+		args = []string{"gh", "auth", "token", "--hostname", host}
+	case "gitlab":
+		args = []string{"glab", "config", "get", "token", "--host", host}
+	}
+	if len(args) > 0 {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			if output, err := exec.Command(args[0], args[1:]...).Output(); err == nil {
+				token = strings.TrimSpace(string(output))
+			}
+		}
+		if token != "" {
+			ui.Debugf("using the token of %s for %s", args[0], host)
+		}
+	}
+	for _, h := range append([]string{host}, hosts...) {
+		if token != "" {
+			break
+		}
+		if _, password, ok := netrcLogin(h); ok {
+			ui.Debugf("using the password of %s in .netrc", h)
+			token = password
+		}
+	}
+
+	storedTokens.m[key] = token
+	return token
+}
+
+// dockerCredentialHelper asks the docker credential helper of the name
+// for the credentials of the registry at serverURL.
+func dockerCredentialHelper(name, serverURL string) (RegistryAuth, bool) {
+	cmd := exec.Command("docker-credential-"+name, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return RegistryAuth{}, false
+	}
+
+	var out struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil || out.Secret == "" {
+		return RegistryAuth{}, false
+	}
+	return RegistryAuth{Username: out.Username, Password: out.Secret}, true
+}
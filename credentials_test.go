@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const testNetrc = `machine example.com login ci password secret
+macdef init
+  machine ignored.com login x password y
+
+machine
+  gitea.example.com
+  login bot password
+  gitea-token
+default login anonymous password guest
+`
+
+func TestNetrcLogin(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "netrc")
+	ioutil.WriteFile(path, []byte(testNetrc), 0600)
+
+	defer os.Setenv("NETRC", os.Getenv("NETRC"))
+	os.Setenv("NETRC", path)
+
+	cases := []struct {
+		Host     string
+		Login    string
+		Password string
+	}{
+		{"example.com", "ci", "secret"},
+		{"gitea.example.com", "bot", "gitea-token"},
+		{"ignored.com", "anonymous", "guest"},
+		{"other.com", "anonymous", "guest"},
+	}
+	for _, tc := range cases {
+		login, password, ok := netrcLogin(tc.Host)
+		if !ok || login != tc.Login || password != tc.Password {
+			t.Fatalf("%s: bad: %s %s %t", tc.Host, login, password, ok)
+		}
+	}
+
+	os.Setenv("NETRC", filepath.Join(td, "missing"))
+	if _, _, ok := netrcLogin("example.com"); ok {
+		t.Fatal("should have no login")
+	}
+}
+
+func TestUploadConfigHeader_netrc(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "netrc")
+	ioutil.WriteFile(path, []byte("machine example.com login ci password secret\n"), 0600)
+
+	defer os.Setenv("NETRC", os.Getenv("NETRC"))
+	os.Setenv("NETRC", path)
+
+	req, _ := http.NewRequest("PUT", "https://example.com:8443/app.zip", nil)
+	(&UploadConfig{}).header(req)
+	if user, pass, ok := req.BasicAuth(); !ok || user != "ci" || pass != "secret" {
+		t.Fatalf("bad: %#v", req.Header)
+	}
+
+	// Headers of the config win
+	req, _ = http.NewRequest("PUT", "https://example.com/app.zip", nil)
+	(&UploadConfig{Headers: map[string]string{"Authorization": "Token abc"}}).header(req)
+	if req.Header.Get("Authorization") != "Token abc" {
+		t.Fatalf("bad: %#v", req.Header)
+	}
+}
+
+func TestRegistryAuthFor_credentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the credential helper")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// The fake helper answers for the registry it is asked about
+	script := "#!/bin/sh\nread server\n" +
+		"echo \"{\\\"ServerURL\\\": \\\"$server\\\", \\\"Username\\\": \\\"$1-$server\\\", \\\"Secret\\\": \\\"s\\\"}\"\n"
+	for _, name := range []string{"docker-credential-ecr-login", "docker-credential-desktop"} {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(script), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	config := `{
+  "auths": {"ghcr.io": {"auth": "dXNlcjpwYXNz"}},
+  "credHelpers": {"123.dkr.ecr.us-east-1.amazonaws.com": "ecr-login"},
+  "credsStore": "desktop"
+}`
+	ioutil.WriteFile(filepath.Join(td, "config.json"), []byte(config), 0644)
+
+	for _, key := range []string{"PATH", "DOCKER_CONFIG", "NETRC", "GOX_REGISTRY_USERNAME"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	os.Setenv("PATH", td+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv("DOCKER_CONFIG", td)
+	os.Setenv("NETRC", filepath.Join(td, "netrc"))
+	os.Unsetenv("GOX_REGISTRY_USERNAME")
+
+	cases := []struct {
+		Registry string
+		Auth     RegistryAuth
+	}{
+		{"ghcr.io", RegistryAuth{"user", "pass"}},
+		{"123.dkr.ecr.us-east-1.amazonaws.com", RegistryAuth{"get-123.dkr.ecr.us-east-1.amazonaws.com", "s"}},
+		{"registry-1.docker.io", RegistryAuth{"get-https://index.docker.io/v1/", "s"}},
+	}
+	for _, tc := range cases {
+		if actual := RegistryAuthFor(tc.Registry); actual != tc.Auth {
+			t.Fatalf("%s: bad: %#v", tc.Registry, actual)
+		}
+	}
+
+	// Without a helper for it, the .netrc login of the registry is next
+	ioutil.WriteFile(filepath.Join(td, "config.json"), []byte(`{}`), 0644)
+	ioutil.WriteFile(filepath.Join(td, "netrc"), []byte("machine quay.io login robot password token\n"), 0600)
+	if actual := RegistryAuthFor("quay.io"); actual != (RegistryAuth{"robot", "token"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestReleaseConfigHeader_stored(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as gh")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	script := "#!/bin/sh\n[ \"$4\" = github.example.com ] && echo gh-token\n"
+	if err := ioutil.WriteFile(filepath.Join(td, "gh"), []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ioutil.WriteFile(filepath.Join(td, "netrc"), []byte("machine gitea.example.com password netrc-token\n"), 0600)
+
+	for _, key := range []string{"PATH", "NETRC", "GITHUB_TOKEN", "GITEA_TOKEN"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+	os.Setenv("PATH", td)
+	os.Setenv("NETRC", filepath.Join(td, "netrc"))
+	defer func(m map[string]string) { storedTokens.m = m }(storedTokens.m)
+	storedTokens.m = make(map[string]string)
+
+	cases := []struct {
+		Config ReleaseConfig
+		Header string
+	}{
+		{ReleaseConfig{Forge: "github", URL: "https://github.example.com"}, "Bearer gh-token"},
+		{ReleaseConfig{Forge: "gitea", URL: "https://gitea.example.com"}, "token netrc-token"},
+		{ReleaseConfig{Forge: "github"}, "Bearer "},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", "https://example.com", nil)
+		tc.Config.header(req)
+		if actual := req.Header.Get("Authorization"); actual != tc.Header {
+			t.Fatalf("%s: bad: %s", tc.Config.URL, actual)
+		}
+	}
+
+	// A token in the environment comes first
+	os.Setenv("GITHUB_TOKEN", "env-token")
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	(&ReleaseConfig{Forge: "github", URL: "https://github.example.com"}).header(req)
+	if actual := req.Header.Get("Authorization"); actual != "Bearer env-token" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
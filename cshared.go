@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// CSharedConfig is the "cshared" section of the config file. It describes
+// the packages built from -buildmode=c-shared libraries for use from other
+// languages.
+type CSharedConfig struct {
+	// Name is the name of the library, defaults to the package directory.
+	Name string `json:"name,omitempty"`
+
+	// Version and Description go in the pkg-config file. The version
+	// defaults to `git describe --tags`, or 0 outside of git.
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Dlltool is the command used to make windows import libraries. It
+	// defaults to the MinGW dlltool for the arch, or llvm-dlltool.
+	Dlltool string `json:"dlltool,omitempty"`
+}
+
+// dlltoolMachine is the dlltool machine name for each windows GOARCH.
+var dlltoolMachine = map[string]string{
+	"386":   "i386",
+	"amd64": "i386:x86-64",
+	"arm64": "arm64",
+}
+
+// dlltoolPrefix is the MinGW target prefix for each windows GOARCH.
+var dlltoolPrefix = map[string]string{
+	"386":   "i686-w64-mingw32-",
+	"amd64": "x86_64-w64-mingw32-",
+	"arm64": "aarch64-w64-mingw32-",
+}
+
+// dllExportRe matches the names of the functions exported in a cgo header.
+var dllExportRe = regexp.MustCompile(`(?m)^extern __declspec\(dllexport\) [^(]*?(\w+)\(`)
+
+// sharedLibExt is the file extension of shared libraries on goos.
+func sharedLibExt(goos string) string {
+	switch goos {
+	case "windows":
+		return ".dll"
+	case "darwin", "ios":
+		return ".dylib"
+	}
+
+	return ".so"
+}
+
+// sharedLibName is the conventional file name of the shared library name
+// on goos, which is what linkers look for with -l.
+func sharedLibName(name, goos string) string {
+	if goos == "windows" {
+		return name + ".dll"
+	}
+	return "lib" + name + sharedLibExt(goos)
+}
+
+// pkgConfigTpl is the pkg-config file for a library, relative to the
+// package so that it can be unpacked anywhere.
+const pkgConfigTpl = `prefix=${pcfiledir}/../..
+libdir=${prefix}/lib
+includedir=${prefix}/include
+
+Name: {{.Name}}
+Description: {{.Description}}
+Version: {{.Version}}
+Libs: -L${libdir} -l{{.Name}}
+Cflags: -I${includedir}
+`
+
+// pkgConfig renders the pkg-config file for the library.
+func (c *CSharedConfig) pkgConfig(name string) ([]byte, error) {
+	data := struct {
+		Name        string
+		Description string
+		Version     string
+	}{name, c.Description, c.Version}
+	if data.Description == "" {
+		data.Description = "The " + name + " library"
+	}
+
+	tpl, err := template.New("pc").Parse(pkgConfigTpl)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// moduleDef returns a module definition listing the functions exported by
+// the dll named dll, from the header cgo generated for it.
+func moduleDef(dll string, header []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "LIBRARY %s\nEXPORTS\n", dll)
+	for _, m := range dllExportRe.FindAllSubmatch(header, -1) {
+		fmt.Fprintf(&buf, "    %s\n", m[1])
+	}
+
+	return buf.Bytes()
+}
+
+// resolveVersion fills in the version from git if it isn't configured.
+// pkg-config requires a version, so it is 0 outside of a git repository.
+func (c *CSharedConfig) resolveVersion() {
+	if c.Version != "" {
+		return
+	}
+
+	v, err := gitDescribe()
+	if err != nil {
+		v = "0"
+	}
+	c.Version = v
+}
+
+// dlltool returns the dlltool command for arch.
+func (c *CSharedConfig) dlltool(arch string) string {
+	if c.Dlltool != "" {
+		return c.Dlltool
+	}
+	if prefix, ok := dlltoolPrefix[arch]; ok {
+		if _, err := exec.LookPath(prefix + "dlltool"); err == nil {
+			return prefix + "dlltool"
+		}
+	}
+	return "llvm-dlltool"
+}
+
+// CSharedPackage emits the files that go with the c-shared library built
+// for r: the header cgo generated next to it, a pkg-config file, and on
+// windows a module definition and an import library. All of them are then
+// packaged with the library as include/, lib/ and lib/pkgconfig/ in an
+// archive next to the library, whose path is returned.
+func CSharedPackage(c *CSharedConfig, r BuildResult) (string, error) {
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(r.Path)
+	}
+	base := strings.TrimSuffix(r.Output, sharedLibExt(r.Platform.OS))
+	header, err := ioutil.ReadFile(base + ".h")
+	if err != nil {
+		return "", err
+	}
+
+	pc, err := c.pkgConfig(name)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(base+".pc", pc, 0644); err != nil {
+		return "", err
+	}
+
+	libName := sharedLibName(name, r.Platform.OS)
+	files := []archiveFile{
+		{Name: "include/" + name + ".h", Data: header, Mode: 0644},
+		{Name: "lib/" + libName, Src: r.Output, Mode: 0755},
+		{Name: "lib/pkgconfig/" + name + ".pc", Data: pc, Mode: 0644},
+	}
+
+	archive := base + ".tar.gz"
+	if r.Platform.OS == "windows" {
+		machine, ok := dlltoolMachine[r.Platform.Arch]
+		if !ok {
+			return "", fmt.Errorf("import libraries are not supported on %s", r.Platform.Arch)
+		}
+
+		def := moduleDef(libName, header)
+		if err := ioutil.WriteFile(base+".def", def, 0644); err != nil {
+			return "", err
+		}
+		if _, err := execGo(c.dlltool(r.Platform.Arch), nil, "",
+			"-m", machine, "-d", base+".def", "-D", libName, "-l", base+".lib"); err != nil {
+			return "", fmt.Errorf("dlltool: %s", err)
+		}
+
+		files = append(files,
+			archiveFile{Name: "lib/" + name + ".def", Data: def, Mode: 0644},
+			archiveFile{Name: "lib/" + name + ".lib", Src: base + ".lib", Mode: 0644})
+		archive = base + ".zip"
+	}
+
+	root := filepath.Base(base)
+	if err := writeArchive(archive, root, files); err != nil {
+		os.Remove(archive)
+		return "", err
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputExt(t *testing.T) {
+	cases := []struct {
+		OS, BuildMode, Ext string
+	}{
+		{"linux", "", ""},
+		{"windows", "", ".exe"},
+		{"windows", "c-shared", ".dll"},
+		{"darwin", "c-shared", ".dylib"},
+		{"linux", "c-shared", ".so"},
+		{"linux", "c-archive", ".a"},
+	}
+
+	for _, tc := range cases {
+		if ext := outputExt(tc.OS, tc.BuildMode); ext != tc.Ext {
+			t.Fatalf("%s %s: bad: %s", tc.OS, tc.BuildMode, ext)
+		}
+	}
+}
+
+func TestModuleDef(t *testing.T) {
+	header := []byte(`
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+extern __declspec(dllexport) GoInt Add(GoInt a, GoInt b);
+extern __declspec(dllexport) char* Hello(char* name);
+
+#ifdef __cplusplus
+}
+#endif
+`)
+
+	expected := "LIBRARY app.dll\nEXPORTS\n    Add\n    Hello\n"
+	if def := string(moduleDef("app.dll", header)); def != expected {
+		t.Fatalf("bad: %q", def)
+	}
+}
+
+func TestCSharedPackage(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "app_linux_amd64.so")
+	if err := ioutil.WriteFile(output, []byte("lib"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(td, "app_linux_amd64.h"), []byte("header"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := &CSharedConfig{Version: "1.2.3"}
+	archive, err := CSharedPackage(c, BuildResult{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		Path:     "example.com/app",
+		Output:   output,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	pc, err := ioutil.ReadFile(filepath.Join(td, "app_linux_amd64.pc"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(pc), "Version: 1.2.3\n") || !strings.Contains(string(pc), "-lapp\n") {
+		t.Fatalf("bad: %s", pc)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{
+		"app_linux_amd64/include/app.h",
+		"app_linux_amd64/lib/libapp.so",
+		"app_linux_amd64/lib/pkgconfig/app.pc",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad: %#v", names)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DesktopConfig is the "desktop" section of the config file. It is the
+// desktop entry of the application, which snaps and AppImages install so
+// that it shows up in menus.
+type DesktopConfig struct {
+	// Name is the name in menus, defaults to that of the binary, and
+	// Comment its tooltip.
+	Name    string `json:"name,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	// Icon is the path to a .png or .svg icon.
+	Icon string `json:"icon,omitempty"`
+
+	// Categories default to Utility. Terminal is set for command line
+	// applications.
+	Categories []string `json:"categories,omitempty"`
+	Terminal   bool     `json:"terminal,omitempty"`
+}
+
+// Validate checks the icon.
+func (c *DesktopConfig) Validate() error {
+	switch filepath.Ext(c.Icon) {
+	case "", ".png", ".svg":
+	default:
+		return fmt.Errorf("desktop: icon must be a .png or .svg")
+	}
+
+	return nil
+}
+
+// entry returns the desktop entry that runs exec, with the icon named
+// icon.
+func (c *DesktopConfig) entry(name, exec, icon string) []byte {
+	if c.Name != "" {
+		name = c.Name
+	}
+	categories := c.Categories
+	if len(categories) == 0 {
+		categories = []string{"Utility"}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[Desktop Entry]\nType=Application\nName=%s\n", name)
+	if c.Comment != "" {
+		fmt.Fprintf(&buf, "Comment=%s\n", c.Comment)
+	}
+	fmt.Fprintf(&buf, "Exec=%s\n", exec)
+	if icon != "" {
+		fmt.Fprintf(&buf, "Icon=%s\n", icon)
+	}
+	fmt.Fprintf(&buf, "Categories=%s;\nTerminal=%t\n", strings.Join(categories, ";"), c.Terminal)
+	return buf.Bytes()
+}
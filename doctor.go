@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// doctorDiskPerPlatform is roughly the space that the build of one
+// platform needs, with its binary and its share of the build cache.
+const doctorDiskPerPlatform = 200 << 20
+
+// doctorTimeout is how long the network check waits for the module proxy.
+var doctorTimeout = 10 * time.Second
+
+// crossCCs are the usual names of the C cross compilers of the ports, as
+// Debian and Homebrew package them, to suggest when one isn't set.
+var crossCCs = map[string]string{
+	"darwin/amd64":  "o64-clang",
+	"darwin/arm64":  "oa64-clang",
+	"linux/386":     "i686-linux-gnu-gcc",
+	"linux/amd64":   "x86_64-linux-gnu-gcc",
+	"linux/arm":     "arm-linux-gnueabihf-gcc",
+	"linux/arm64":   "aarch64-linux-gnu-gcc",
+	"linux/ppc64le": "powerpc64le-linux-gnu-gcc",
+	"linux/riscv64": "riscv64-linux-gnu-gcc",
+	"linux/s390x":   "s390x-linux-gnu-gcc",
+	"windows/386":   "i686-w64-mingw32-gcc",
+	"windows/amd64": "x86_64-w64-mingw32-gcc",
+	"windows/arm64": "aarch64-w64-mingw32-clang",
+}
+
+// doctorStatus is how a DoctorCheck went.
+type doctorStatus int
+
+const (
+	doctorOK doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorWarn:
+		return "warn"
+	case doctorFail:
+		return "FAIL"
+	}
+	return "ok"
+}
+
+// DoctorCheck is the result of one check of `gox doctor`. Fix, if set,
+// says what to do about a warning or failure.
+type DoctorCheck struct {
+	Name   string
+	Status doctorStatus
+	Detail string
+	Fix    string
+}
+
+// Doctor checks that the environment can build Platforms, before a long
+// build finds out halfway through that it can't.
+type Doctor struct {
+	GoCmd     string
+	Platforms []Platform
+	Host      Platform
+
+	// Cgo is whether the build uses cgo, and so needs a C compiler for
+	// every platform.
+	Cgo bool
+
+	// OutputDir is where the binaries will be written.
+	OutputDir string
+
+	// Offline skips the check of the module proxy.
+	Offline bool
+}
+
+// Run runs every check, in order.
+func (d *Doctor) Run() []DoctorCheck {
+	checks := []DoctorCheck{d.checkGo()}
+	if checks[0].Status == doctorFail {
+		// Everything else asks the go command
+		return checks
+	}
+
+	checks = append(checks, d.checkGopath()...)
+	checks = append(checks, d.checkModules())
+	checks = append(checks, d.checkCC()...)
+	checks = append(checks, d.checkDisk())
+	checks = append(checks, d.checkNetwork())
+	return checks
+}
+
+func (d *Doctor) checkGo() DoctorCheck {
+	check := DoctorCheck{Name: "Go"}
+	output, err := execGo(d.GoCmd, nil, "", "version")
+	if err != nil {
+		check.Status = doctorFail
+		check.Detail = fmt.Sprintf("%s can't be run: %s", d.GoCmd,
+			strings.SplitN(strings.TrimSpace(err.Error()), "\n", 2)[0])
+		check.Fix = "install Go from https://go.dev/dl/, or point -gocmd at it"
+		return check
+	}
+	goroot, _ := goEnv(d.GoCmd, "GOROOT")
+	goVersion, _ := goEnv(d.GoCmd, "GOVERSION")
+	if goVersion == "" {
+		goVersion = strings.TrimSpace(output)
+	}
+	check.Detail = fmt.Sprintf("%s in %s", goVersion, goroot)
+
+	// A module that needs a newer Go fails every build with the same error
+	if need, err := goModVersion(); err == nil {
+		have, err1 := version.NewVersion(strings.TrimPrefix(goVersion, "go"))
+		want, err2 := version.NewVersion(strings.TrimPrefix(need, "go"))
+		if err1 == nil && err2 == nil && have.LessThan(want) {
+			check.Status = doctorWarn
+			check.Detail += fmt.Sprintf(", but the module needs %s", need)
+			check.Fix = "build with -go-version=mod to download it, or upgrade Go"
+		}
+	}
+	return check
+}
+
+func (d *Doctor) checkGopath() []DoctorCheck {
+	gopath, _ := goEnv(d.GoCmd, "GOPATH")
+	gobin, _ := goEnv(d.GoCmd, "GOBIN")
+
+	check := DoctorCheck{Name: "GOPATH", Detail: gopath}
+	if dirs := filepath.SplitList(gopath); len(dirs) == 0 {
+		check.Status = doctorFail
+		check.Detail = "GOPATH isn't set and has no default"
+		check.Fix = "set GOPATH, or HOME for its default of $HOME/go"
+	} else if err := writableDir(dirs[0]); err != nil {
+		check.Status = doctorFail
+		check.Detail = fmt.Sprintf("%s can't be written: %s", dirs[0], err)
+		check.Fix = "set GOPATH to a directory that you can write to"
+	} else if gobin == "" {
+		gobin = filepath.Join(dirs[0], "bin")
+	}
+
+	bin := DoctorCheck{Name: "GOBIN", Detail: gobin}
+	if gobin != "" && !inPath(gobin) {
+		bin.Status = doctorWarn
+		bin.Detail = fmt.Sprintf("%s isn't on the PATH", gobin)
+		bin.Fix = fmt.Sprintf("add it to the PATH, so that tools installed with `go install` can be found: "+
+			"export PATH=\"$PATH:%s\"", gobin)
+	}
+	return []DoctorCheck{check, bin}
+}
+
+func (d *Doctor) checkModules() DoctorCheck {
+	check := DoctorCheck{Name: "Modules"}
+	mode, _ := goEnv(d.GoCmd, "GO111MODULE")
+	gomod, _ := goEnv(d.GoCmd, "GOMOD")
+	switch {
+	case mode == "off":
+		check.Status = doctorWarn
+		check.Detail = "GO111MODULE=off builds in GOPATH mode"
+		check.Fix = "unset GO111MODULE, unless the packages really are in GOPATH"
+	case gomod == "" || gomod == os.DevNull:
+		check.Status = doctorFail
+		check.Detail = "the current directory isn't in a module"
+		check.Fix = "run gox from the module to build, or create one with `go mod init`"
+	default:
+		check.Detail = gomod
+		if gowork, _ := goEnv(d.GoCmd, "GOWORK"); gowork != "" && gowork != "off" {
+			check.Detail += ", in the workspace " + gowork
+		}
+	}
+	return check
+}
+
+func (d *Doctor) checkCC() []DoctorCheck {
+	if !d.Cgo {
+		return []DoctorCheck{{Name: "C compilers", Detail: "not needed without -cgo"}}
+	}
+
+	var checks []DoctorCheck
+	for _, p := range d.Platforms {
+		check := DoctorCheck{Name: "C compiler for " + p.String()}
+		key := envOverrideKey(p, "CC")
+		var cc string
+		envOverride(&cc, p, "CC")
+		native := p.OS == d.Host.OS && p.Arch == d.Host.Arch
+		if cc == "" && native {
+			cc, _ = goEnv(d.GoCmd, "CC")
+		}
+
+		suggestion := crossCCs[p.OS+"/"+p.Arch]
+		switch {
+		case !isTinygoTarget(p) && !portCgo(p.OS, p.Arch):
+			check.Status = doctorFail
+			check.Detail = "the port doesn't support cgo"
+			check.Fix = "leave it out, or build with -skip-cgo-unsupported"
+		case cc == "":
+			check.Status = doctorFail
+			check.Detail = key + " isn't set"
+			if path, err := exec.LookPath(suggestion); suggestion != "" && err == nil {
+				check.Fix = fmt.Sprintf("set %s=%s, which is at %s", key, suggestion, path)
+			} else if suggestion != "" {
+				check.Fix = fmt.Sprintf("install a cross compiler such as %s and set %s to it", suggestion, key)
+			} else {
+				check.Fix = fmt.Sprintf("set %s to a C cross compiler for %s", key, p.String())
+			}
+		default:
+			fields := strings.Fields(cc)
+			if path, err := exec.LookPath(fields[0]); err != nil {
+				check.Status = doctorFail
+				check.Detail = fmt.Sprintf("%s isn't on the PATH", fields[0])
+				check.Fix = fmt.Sprintf("install it, or set %s to the one to use", key)
+			} else {
+				check.Detail = path
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (d *Doctor) checkDisk() DoctorCheck {
+	check := DoctorCheck{Name: "Disk space"}
+	dir := existingDir(d.OutputDir)
+	free, err := freeSpace(dir)
+	if err != nil {
+		check.Status = doctorWarn
+		check.Detail = fmt.Sprintf("the free space in %s can't be read: %s", dir, err)
+		return check
+	}
+
+	need := int64(doctorDiskPerPlatform) * int64(len(d.Platforms))
+	check.Detail = fmt.Sprintf("%s free in %s", formatSize(free), dir)
+	if free < need {
+		check.Status = doctorWarn
+		check.Detail += fmt.Sprintf(", and %d platforms may need about %s", len(d.Platforms), formatSize(need))
+		check.Fix = "free up space, or write the binaries elsewhere with -output"
+	}
+	return check
+}
+
+func (d *Doctor) checkNetwork() DoctorCheck {
+	check := DoctorCheck{Name: "Network"}
+	if d.Offline {
+		check.Detail = "not checked with -offline"
+		return check
+	}
+
+	goflags, _ := goEnv(d.GoCmd, "GOFLAGS")
+	if strings.Contains(goflags, "-mod=vendor") {
+		check.Detail = "not needed with -mod=vendor"
+		return check
+	}
+
+	goproxy, _ := goEnv(d.GoCmd, "GOPROXY")
+	proxy := firstProxy(goproxy)
+	switch proxy {
+	case "off":
+		check.Detail = "GOPROXY=off, so modules must already be in the module cache"
+		return check
+	case "direct", "":
+		check.Detail = "modules are downloaded from their hosts directly, which aren't checked"
+		return check
+	}
+
+	client := &http.Client{Timeout: doctorTimeout}
+	resp, err := client.Head(strings.TrimSuffix(proxy, "/") + "/")
+	if err != nil {
+		check.Status = doctorFail
+		check.Detail = fmt.Sprintf("the module proxy %s can't be reached: %s", proxy, err)
+		check.Fix = "check the network and proxy settings, or vendor the modules with `go mod vendor` " +
+			"or bundle them with `gox toolchains bundle`"
+		return check
+	}
+	resp.Body.Close()
+	check.Detail = fmt.Sprintf("the module proxy %s can be reached", proxy)
+	return check
+}
+
+// WriteDoctor writes checks to w, and returns how many of them failed.
+func WriteDoctor(w io.Writer, checks []DoctorCheck) int {
+	failed := 0
+	for _, c := range checks {
+		if c.Status == doctorFail {
+			failed++
+		}
+		fmt.Fprintf(w, "%-4s  %s: %s\n", c.Status, c.Name, c.Detail)
+		if c.Fix != "" {
+			fmt.Fprintf(w, "      fix: %s\n", c.Fix)
+		}
+	}
+	return failed
+}
+
+// firstProxy is the first entry of GOPROXY, which is the one that the go
+// command tries first.
+func firstProxy(goproxy string) string {
+	if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+		goproxy = goproxy[:i]
+	}
+	return strings.TrimSpace(goproxy)
+}
+
+// existingDir returns dir, or the closest of its parents that exists.
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// writableDir returns an error if files can't be created in dir, or in
+// the parent that it would be created in.
+func writableDir(dir string) error {
+	f, err := ioutil.TempFile(existingDir(dir), ".gox-doctor")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// inPath reports whether dir is one of the directories of PATH.
+func inPath(dir string) bool {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if p != "" && filepath.Clean(p) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// freeSpace returns the bytes free in dir, from df.
+func freeSpace(dir string) (int64, error) {
+	output, err := exec.Command("df", "-Pk", dir).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	// The second line is the filesystem of dir, with the kilobytes that
+	// are available in its fourth column
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	var fields []string
+	if len(lines) >= 2 {
+		fields = strings.Fields(lines[1])
+	}
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected output of df: %q", output)
+	}
+	kb, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return kb * 1024, nil
+}
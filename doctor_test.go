@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFirstProxy(t *testing.T) {
+	cases := map[string]string{
+		"https://proxy.golang.org,direct": "https://proxy.golang.org",
+		"https://a.example|https://b":     "https://a.example",
+		"off":                             "off",
+		"":                                "",
+	}
+	for goproxy, expected := range cases {
+		if proxy := firstProxy(goproxy); proxy != expected {
+			t.Fatalf("%s: bad: %s", goproxy, proxy)
+		}
+	}
+}
+
+func TestDoctorCheckCC(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	defer os.Setenv("GOX_LINUX_ARM_CC", os.Getenv("GOX_LINUX_ARM_CC"))
+	os.Setenv("GOX_LINUX_ARM_CC", "gox-no-such-cc -march=armv7")
+	d := &Doctor{
+		GoCmd: "go",
+		Host:  Platform{OS: "linux", Arch: "amd64"},
+		Cgo:   true,
+		Platforms: []Platform{
+			{OS: "linux", Arch: "arm"},
+			{OS: "windows", Arch: "amd64"},
+			{OS: "plan9", Arch: "386"},
+		},
+	}
+
+	checks := d.checkCC()
+	if len(checks) != 3 {
+		t.Fatalf("bad: %#v", checks)
+	}
+	for _, c := range checks {
+		if c.Status != doctorFail {
+			t.Fatalf("bad: %#v", c)
+		}
+	}
+	if !strings.Contains(checks[0].Detail, "gox-no-such-cc isn't on the PATH") {
+		t.Fatalf("bad: %#v", checks[0])
+	}
+	if !strings.Contains(checks[1].Fix, "x86_64-w64-mingw32-gcc") ||
+		!strings.Contains(checks[1].Fix, "GOX_WINDOWS_AMD64_CC") {
+		t.Fatalf("bad: %#v", checks[1])
+	}
+
+	d.Cgo = false
+	if checks := d.checkCC(); len(checks) != 1 || checks[0].Status != doctorOK {
+		t.Fatalf("bad: %#v", checks)
+	}
+}
+
+func TestDoctorCheckNetwork(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer os.Setenv("GOPROXY", os.Getenv("GOPROXY"))
+	os.Setenv("GOPROXY", server.URL+",direct")
+
+	d := &Doctor{GoCmd: "go"}
+	if c := d.checkNetwork(); c.Status != doctorOK {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	server.Close()
+	if c := d.checkNetwork(); c.Status != doctorFail || c.Fix == "" {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	os.Setenv("GOPROXY", "off")
+	if c := d.checkNetwork(); c.Status != doctorOK {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
+func TestWriteDoctor(t *testing.T) {
+	checks := []DoctorCheck{
+		{Name: "Go", Detail: "go1.22.4 in /usr/local/go"},
+		{Name: "GOBIN", Status: doctorWarn, Detail: "/go/bin isn't on the PATH", Fix: "add it"},
+		{Name: "Network", Status: doctorFail, Detail: "down"},
+	}
+
+	var b strings.Builder
+	if failed := WriteDoctor(&b, checks); failed != 1 {
+		t.Fatalf("bad: %d", failed)
+	}
+	expected := "ok    Go: go1.22.4 in /usr/local/go\n" +
+		"warn  GOBIN: /go/bin isn't on the PATH\n" +
+		"      fix: add it\n" +
+		"FAIL  Network: down\n"
+	if b.String() != expected {
+		t.Fatalf("bad: %q", b.String())
+	}
+}
@@ -9,9 +9,14 @@ import (
 // envOverride overrides the given target based on if there is a
 // env var in the format of GOX_{OS}_{ARCH}_{KEY}.
 func envOverride(target *string, platform Platform, key string) {
-	key = strings.ToUpper(fmt.Sprintf(
-		"GOX_%s_%s_%s", platform.OS, platform.Arch, key))
-	if v := os.Getenv(key); v != "" {
+	if v := os.Getenv(envOverrideKey(platform, key)); v != "" {
 		*target = v
 	}
 }
+
+// envOverrideKey is the name of the variable that overrides key for
+// platform.
+func envOverrideKey(platform Platform, key string) string {
+	return strings.ToUpper(fmt.Sprintf(
+		"GOX_%s_%s_%s", platform.OS, platform.Arch, key))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ExistingOutputs returns the outputs of builds that are already there but
+// that gox didn't write: they aren't recorded in previous, the manifest of
+// the output directory, or in the -incremental state, and aren't a copy of
+// an artifact of previous either. Those are replaced only with -overwrite,
+// so that a run with a new template doesn't clobber binaries that were
+// published before.
+func ExistingOutputs(builds []*CompileOpts, previous *ArtifactManifest, state *IncrementalState) []string {
+	written := make(map[string]bool)
+	for _, path := range previous.Paths() {
+		if abs, err := filepath.Abs(path); err == nil {
+			written[abs] = true
+		}
+	}
+	sums := make(map[string]bool)
+	for _, a := range previous.Artifacts {
+		if a.SHA256 != "" {
+			sums[a.SHA256] = true
+		}
+	}
+	if state != nil {
+		for path := range state.Targets {
+			written[path] = true
+		}
+	}
+
+	var existing []string
+	seen := make(map[string]bool)
+	for _, opts := range builds {
+		path, err := opts.OutputPath()
+		if err != nil || written[path] || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if sum, err := fileSHA256(path); err == nil && sums[sum] {
+			continue
+		}
+		existing = append(existing, path)
+	}
+	sort.Strings(existing)
+	return existing
+}
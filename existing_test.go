@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExistingOutputs(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var builds []*CompileOpts
+	for _, arch := range []string{"amd64", "arm64", "386", "arm"} {
+		builds = append(builds, &CompileOpts{
+			PackagePath: "example.com/app",
+			Platform:    Platform{OS: "linux", Arch: arch},
+			OutputTpl:   filepath.Join(td, "{{.Dir}}_{{.OS}}_{{.Arch}}"),
+		})
+	}
+	for _, name := range []string{"app_linux_amd64", "app_linux_arm64", "app_linux_386"} {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte("bin"), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	previous := NewArtifactManifest(td)
+	previous.Artifacts = []Artifact{{Kind: artifactBinary, Path: "app_linux_amd64"}}
+	state := &IncrementalState{Targets: map[string]string{filepath.Join(td, "app_linux_386"): "abc"}}
+
+	actual := ExistingOutputs(builds, previous, state)
+	expected := []string{filepath.Join(td, "app_linux_arm64")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	actual = ExistingOutputs(builds, NewArtifactManifest(td), nil)
+	if len(actual) != 3 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestExistingOutputs_runs(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Runs of -osarch="linux/amd64 linux/arm64", then linux/amd64, then
+	// linux/arm64 only ever replace what gox wrote
+	for i, archs := range [][]string{{"amd64", "arm64"}, {"amd64"}, {"arm64"}} {
+		previous, err := LoadArtifactManifest(td)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var builds []*CompileOpts
+		for _, arch := range archs {
+			builds = append(builds, &CompileOpts{
+				PackagePath: "example.com/hello",
+				Platform:    Platform{OS: "linux", Arch: arch},
+				OutputTpl:   filepath.Join(td, "{{.Dir}}_1.2.3_{{.OS}}_{{.Arch}}"),
+			})
+		}
+		if existing := ExistingOutputs(builds, previous, nil); len(existing) != 0 {
+			t.Fatalf("%d: bad: %#v", i, existing)
+		}
+
+		m := NewArtifactManifest(td)
+		m.Keep(previous)
+		for _, opts := range builds {
+			output, _ := opts.OutputPath()
+			ioutil.WriteFile(output, []byte(opts.Platform.String()+string(rune('0'+i))), 0755)
+			m.AddResult(BuildResult{Platform: opts.Platform, Path: opts.PackagePath, Output: output}, opts)
+		}
+		if _, err := m.Write(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// A copy of a binary that gox wrote is its own too, as with manifests
+	// that only have the last run
+	previous, _ := LoadArtifactManifest(td)
+	data, _ := ioutil.ReadFile(filepath.Join(td, "hello_1.2.3_linux_arm64"))
+	ioutil.WriteFile(filepath.Join(td, "hello_1.2.3_linux_386"), data, 0755)
+	ioutil.WriteFile(filepath.Join(td, "hello_1.2.3_linux_arm"), []byte("other"), 0755)
+	var builds []*CompileOpts
+	for _, arch := range []string{"386", "arm"} {
+		builds = append(builds, &CompileOpts{
+			PackagePath: "example.com/hello",
+			Platform:    Platform{OS: "linux", Arch: arch},
+			OutputTpl:   filepath.Join(td, "{{.Dir}}_1.2.3_{{.OS}}_{{.Arch}}"),
+		})
+	}
+	actual := ExistingOutputs(builds, previous, nil)
+	expected := []string{filepath.Join(td, "hello_1.2.3_linux_arm")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// The exit statuses of a run of gox, so that CI can tell why it failed.
+// exitUpToDate isn't a failure: an incremental run found every binary up
+// to date, so that CI can skip the jobs that come after it.
+const (
+	exitError     = 1 // any other error, such as a failed signing or packaging step
+	exitFlags     = 2 // bad flags or config file
+	exitUpToDate  = 3
+	exitToolchain = 4 // go, or a tool that the flags need, is missing or too old
+	exitPartial   = 5 // some of the builds failed
+	exitAllFailed = 6 // every build failed
+	exitPublish   = 7 // the builds worked but publishing them didn't
+)
+
+// exitCodes name the exit statuses in the "error" of the -json summary.
+var exitCodes = map[int]string{
+	exitError:     "error",
+	exitFlags:     "flags",
+	exitToolchain: "toolchain",
+	exitPartial:   "partial_failure",
+	exitAllFailed: "all_failed",
+	exitPublish:   "publish",
+}
+
+// RunError is why a run of gox failed, as the "error" of the -json
+// summary. Code names ExitStatus, and Message is the error that was
+// printed, if it was one error.
+type RunError struct {
+	Code       string `json:"code"`
+	ExitStatus int    `json:"exit_status"`
+	Message    string `json:"message,omitempty"`
+}
+
+func newRunError(status int, message string) *RunError {
+	code, ok := exitCodes[status]
+	if !ok {
+		code = exitCodes[exitError]
+	}
+	return &RunError{
+		Code:       code,
+		ExitStatus: status,
+		Message:    strings.TrimSuffix(strings.TrimSpace(message), ":"),
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestNewRunError(t *testing.T) {
+	cases := []struct {
+		Status  int
+		Message string
+		Result  RunError
+	}{
+		{exitFlags, "-quiet and -debug can't be used together\n",
+			RunError{"flags", exitFlags, "-quiet and -debug can't be used together"}},
+		{exitPartial, "\n2 errors occurred:\n",
+			RunError{"partial_failure", exitPartial, "2 errors occurred"}},
+		{exitPublish, "", RunError{"publish", exitPublish, ""}},
+		{42, "boom", RunError{"error", 42, "boom"}},
+	}
+
+	for _, tc := range cases {
+		if actual := newRunError(tc.Status, tc.Message); *actual != tc.Result {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
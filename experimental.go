@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// Experiment is a platform or behavior of Gox that isn't considered stable
+// yet. Experiments are off unless enabled with -enable-experimental or the
+// GOX_EXPERIMENTAL environment variable, so that new Go ports can be tried
+// out without changing the defaults for everyone.
+type Experiment struct {
+	Name        string
+	Description string
+
+	// GoVersion, if set, is the constraint on the Go version that the
+	// experiment needs, such as ">= 1.21".
+	GoVersion string
+
+	// Platforms are added to the supported platforms while the experiment
+	// is enabled. They are never built by default, only when asked for
+	// with -os or -osarch.
+	Platforms []Platform
+}
+
+// Experiments is the registry of every experiment.
+var Experiments = []Experiment{
+	{
+		Name:        "ios",
+		Description: "ios/arm64 and ios/amd64, which need cgo and an Xcode toolchain",
+		GoVersion:   ">= 1.16",
+		Platforms: []Platform{
+			{OS: "ios", Arch: "arm64"},
+			{OS: "ios", Arch: "amd64"},
+		},
+	},
+	{
+		Name:        "wasip1",
+		Description: "wasip1/wasm, WebAssembly for WASI runtimes",
+		GoVersion:   ">= 1.21",
+		Platforms:   []Platform{{OS: "wasip1", Arch: "wasm"}},
+	},
+}
+
+// graduatedExperiments are the experiments whose platforms are in the
+// platform tables now, with the Go version they are supported from.
+// Enabling them does nothing, so that old GOX_EXPERIMENTAL values still
+// work.
+var graduatedExperiments = map[string]string{
+	"openbsd-riscv64": "1.23",
+}
+
+// ExperimentSet is the set of enabled experiments, by name.
+type ExperimentSet map[string]*Experiment
+
+// ParseExperiments returns the experiments enabled by the comma-separated
+// names in each of values, failing on names that aren't in the registry.
+func ParseExperiments(values ...string) (ExperimentSet, error) {
+	result := make(ExperimentSet)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			if v, ok := graduatedExperiments[name]; ok {
+				ui.Warnf("The %s experiment isn't needed anymore: its platforms are supported from Go %s\n", name, v)
+				continue
+			}
+			e := lookupExperiment(name)
+			if e == nil {
+				return nil, fmt.Errorf("Unknown experiment %q, must be one of: %s",
+					name, strings.Join(experimentNames(), ", "))
+			}
+			result[name] = e
+		}
+	}
+
+	return result, nil
+}
+
+// EnabledExperiments returns the experiments enabled by the flag value
+// and the GOX_EXPERIMENTAL environment variable.
+func EnabledExperiments(flag string) (ExperimentSet, error) {
+	return ParseExperiments(os.Getenv("GOX_EXPERIMENTAL"), flag)
+}
+
+// Enabled reports whether the experiment name is enabled.
+func (s ExperimentSet) Enabled(name string) bool {
+	_, ok := s[name]
+	return ok
+}
+
+// Platforms returns the supported platforms for the Go version v, with the
+// platforms of the enabled experiments that v supports.
+func (s ExperimentSet) Platforms(v string, supported []Platform) []Platform {
+	result := make([]Platform, len(supported), len(supported)+len(s))
+	copy(result, supported)
+	for _, e := range Experiments {
+		if s.Enabled(e.Name) && e.supports(v) {
+			result = append(result, e.Platforms...)
+		}
+	}
+
+	return result
+}
+
+// Hints returns a message for each platform asked for with the flag that
+// is only available with an experiment that isn't enabled.
+func (s ExperimentSet) Hints(p *PlatformFlag) []string {
+	var result []string
+	seen := make(map[string]struct{})
+	hint := func(platform Platform) {
+		e := platformExperiment(platform)
+		if e == nil || s.Enabled(e.Name) {
+			return
+		}
+		if _, ok := seen[e.Name]; ok {
+			return
+		}
+
+		seen[e.Name] = struct{}{}
+		result = append(result, fmt.Sprintf(
+			"%s is experimental: enable it with -enable-experimental=%s",
+			platform.String(), e.Name))
+	}
+
+	for _, v := range p.OSArch {
+		if !strings.HasPrefix(v.OS, "!") {
+			hint(v)
+		}
+	}
+	for _, v := range p.OS {
+		if strings.HasPrefix(v, "!") {
+			continue
+		}
+		for _, e := range Experiments {
+			for _, platform := range e.Platforms {
+				if platform.OS == v {
+					hint(platform)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// supports reports whether the experiment works with the Go version v.
+// Versions that can't be parsed are assumed to be recent enough.
+func (e *Experiment) supports(v string) bool {
+	if e.GoVersion == "" || !strings.HasPrefix(v, "go") {
+		return true
+	}
+
+	current, err := version.NewVersion(strings.TrimPrefix(v, "go"))
+	if err != nil {
+		return true
+	}
+	constraint, err := version.NewConstraint(e.GoVersion)
+	if err != nil {
+		panic(err)
+	}
+	return constraint.Check(current)
+}
+
+func lookupExperiment(name string) *Experiment {
+	for i := range Experiments {
+		if Experiments[i].Name == name {
+			return &Experiments[i]
+		}
+	}
+
+	return nil
+}
+
+// platformExperiment returns the experiment that adds platform, if any.
+func platformExperiment(platform Platform) *Experiment {
+	for i := range Experiments {
+		for _, p := range Experiments[i].Platforms {
+			if p.String() == platform.String() {
+				return &Experiments[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func experimentNames() []string {
+	names := make([]string, len(Experiments))
+	for i, e := range Experiments {
+		names[i] = e.Name
+	}
+	sort.Strings(names)
+	return names
+}
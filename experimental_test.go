@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExperiments(t *testing.T) {
+	cases := []struct {
+		Input []string
+		Names []string
+		Err   bool
+	}{
+		{[]string{""}, []string{}, false},
+		{[]string{"ios,wasip1"}, []string{"ios", "wasip1"}, false},
+		{[]string{"ios", " wasip1 ,"}, []string{"ios", "wasip1"}, false},
+		{[]string{"ios,nope"}, nil, true},
+		{[]string{"wasip1,openbsd-riscv64"}, []string{"wasip1"}, false},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseExperiments(tc.Input...)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Input, err)
+		}
+		if tc.Err {
+			continue
+		}
+
+		names := []string{}
+		for _, name := range experimentNames() {
+			if actual.Enabled(name) {
+				names = append(names, name)
+			}
+		}
+		if !reflect.DeepEqual(names, tc.Names) {
+			t.Fatalf("%#v: bad: %#v", tc.Input, names)
+		}
+	}
+}
+
+func TestExperimentSetPlatforms(t *testing.T) {
+	set, err := ParseExperiments("wasip1")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	supported := []Platform{{OS: "linux", Arch: "amd64", Default: true}}
+
+	cases := []struct {
+		Version string
+		Output  []Platform
+	}{
+		{"go1.20.5", supported},
+		{"go1.21.0", append(supported, Platform{OS: "wasip1", Arch: "wasm"})},
+		{"devel +abc", append(supported, Platform{OS: "wasip1", Arch: "wasm"})},
+	}
+
+	for _, tc := range cases {
+		actual := set.Platforms(tc.Version, supported)
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("%s: bad: %#v", tc.Version, actual)
+		}
+	}
+	if len(supported) != 1 {
+		t.Fatalf("supported was modified: %#v", supported)
+	}
+}
+
+func TestExperimentSetHints(t *testing.T) {
+	set, err := ParseExperiments("wasip1")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Flag   PlatformFlag
+		Output []string
+	}{
+		{PlatformFlag{OS: []string{"linux"}}, nil},
+		{PlatformFlag{OS: []string{"!ios"}}, nil},
+		{PlatformFlag{OSArch: []Platform{{OS: "wasip1", Arch: "wasm"}}}, nil},
+		{
+			PlatformFlag{OS: []string{"ios"}, OSArch: []Platform{{OS: "ios", Arch: "amd64"}}},
+			[]string{"ios/amd64 is experimental: enable it with -enable-experimental=ios"},
+		},
+	}
+
+	for _, tc := range cases {
+		actual := set.Hints(&tc.Flag)
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("%#v: bad: %#v", tc.Flag, actual)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fipsBoring is the -fips mode that links in BoringCrypto with
+// GOEXPERIMENT=boringcrypto. The others are values of GOFIPS140, which
+// selects the Go Cryptographic Module of Go 1.24 and later.
+const fipsBoring = "boringcrypto"
+
+// fipsVariant is the Variant of the results of FIPS builds.
+const fipsVariant = "fips"
+
+// gofips140Re matches the values of GOFIPS140 that select a module.
+var gofips140Re = regexp.MustCompile(`^(latest|inprocess|certified|v[0-9]+\.[0-9]+\.[0-9]+)$`)
+
+// boringPlatforms are the platforms that BoringCrypto is linked in on.
+// Elsewhere Go quietly keeps its own crypto, so the binary isn't FIPS.
+var boringPlatforms = map[string]bool{
+	"linux/amd64": true,
+	"linux/arm64": true,
+}
+
+// ValidateFIPS checks a value of -fips.
+func ValidateFIPS(v string) error {
+	if v == "" || v == fipsBoring || gofips140Re.MatchString(v) {
+		return nil
+	}
+
+	return fmt.Errorf("Invalid -fips value %q: must be boringcrypto, or a GOFIPS140 "+
+		"value such as latest or v1.0.0", v)
+}
+
+// fipsSupported reports whether a FIPS build with mode can be made for
+// platform.
+func fipsSupported(mode string, platform Platform) bool {
+	if mode != fipsBoring {
+		return true
+	}
+	return boringPlatforms[platform.OS+"/"+platform.Arch]
+}
+
+// goExperiment is the GOEXPERIMENT of the build, with boringcrypto added
+// for its FIPS mode.
+func (opts *CompileOpts) goExperiment() string {
+	if opts.FIPS != fipsBoring {
+		return opts.GoExperiment
+	}
+
+	for _, e := range strings.Split(opts.GoExperiment, ",") {
+		if e == fipsBoring {
+			return opts.GoExperiment
+		}
+	}
+	if opts.GoExperiment == "" {
+		return fipsBoring
+	}
+	return opts.GoExperiment + "," + fipsBoring
+}
+
+// checkGoExperiment returns an error if the experiments of opts can't do
+// what they are asked to on its platform.
+func (opts *CompileOpts) checkGoExperiment() error {
+	for _, e := range strings.Split(opts.goExperiment(), ",") {
+		if e == fipsBoring && !fipsSupported(fipsBoring, opts.Platform) {
+			return fmt.Errorf("GOEXPERIMENT=boringcrypto is only supported on linux/amd64 and linux/arm64, not %s",
+				opts.Platform.String())
+		}
+	}
+
+	return nil
+}
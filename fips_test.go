@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateFIPS(t *testing.T) {
+	for _, v := range []string{"", "boringcrypto", "latest", "inprocess", "v1.0.0"} {
+		if err := ValidateFIPS(v); err != nil {
+			t.Fatalf("%s: err: %s", v, err)
+		}
+	}
+	for _, v := range []string{"on", "1.0.0", "boring"} {
+		if err := ValidateFIPS(v); err == nil {
+			t.Fatalf("%s: should err", v)
+		}
+	}
+}
+
+func TestCompileOptsGoExperiment(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "arm64"}
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	cases := []struct {
+		Opts     CompileOpts
+		Expected string
+		Err      bool
+	}{
+		{CompileOpts{Platform: darwin}, "", false},
+		{CompileOpts{Platform: darwin, GoExperiment: "loopvar"}, "loopvar", false},
+		{CompileOpts{Platform: linux, FIPS: "boringcrypto"}, "boringcrypto", false},
+		{CompileOpts{Platform: linux, FIPS: "boringcrypto", GoExperiment: "loopvar"}, "loopvar,boringcrypto", false},
+		{CompileOpts{Platform: linux, FIPS: "boringcrypto", GoExperiment: "boringcrypto"}, "boringcrypto", false},
+		{CompileOpts{Platform: darwin, FIPS: "latest", GoExperiment: "loopvar"}, "loopvar", false},
+		{CompileOpts{Platform: darwin, GoExperiment: "boringcrypto"}, "boringcrypto", true},
+	}
+
+	for i, tc := range cases {
+		if actual := tc.Opts.goExperiment(); actual != tc.Expected {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+		if err := tc.Opts.checkGoExperiment(); (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	// A GOFIPS140 build sets it, BoringCrypto turns cgo on
+	opts := &CompileOpts{Platform: darwin, Host: linux, FIPS: "latest"}
+	found := false
+	for _, e := range opts.buildEnv() {
+		found = found || e == "GOFIPS140=latest"
+	}
+	if !found {
+		t.Fatal("GOFIPS140 should be set")
+	}
+	opts = &CompileOpts{Platform: linux, Host: darwin, FIPS: "boringcrypto"}
+	opts.buildEnv()
+	if !opts.Cgo {
+		t.Fatal("boringcrypto should use cgo")
+	}
+}
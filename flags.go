@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// mapStringValue is a flag.Value that collects repeated key=value flags
+// into a map, such as -label "org.opencontainers.image.source=...".
+type mapStringValue map[string]string
+
+func (m *mapStringValue) String() string {
+	keys := make([]string, 0, len(*m))
+	for k := range *m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + (*m)[k]
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+func (m *mapStringValue) Set(value string) error {
+	idx := strings.Index(value, "=")
+	if idx <= 0 {
+		return fmt.Errorf("Invalid syntax: %s should be key=value", value)
+	}
+
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[value[:idx]] = value[idx+1:]
+	return nil
+}
+
+// buildFlagValue is a flag.Value for -gcflags, -ldflags and -asmflags. A
+// plain value is for every platform, while "os/arch=value" is only for that
+// platform, so the flag can be repeated to set it for several.
+type buildFlagValue struct {
+	Value     string
+	Platforms map[string]string
+}
+
+// buildFlagPlatformRe matches the os/arch= prefix of a platform's value.
+// Values of the flags themselves start with a "-".
+var buildFlagPlatformRe = regexp.MustCompile(`^([a-z0-9]+/[a-z0-9_-]+)=(.*)$`)
+
+func (v *buildFlagValue) String() string {
+	return v.Value
+}
+
+func (v *buildFlagValue) Set(value string) error {
+	m := buildFlagPlatformRe.FindStringSubmatch(value)
+	if m == nil {
+		v.Value = value
+		return nil
+	}
+
+	if v.Platforms == nil {
+		v.Platforms = make(map[string]string)
+	}
+	v.Platforms[m[1]] = m[2]
+	return nil
+}
+
+// override sets target to the value for platform, if there is one. The
+// value for an arch with its GOARM or level, such as linux/armv7, comes
+// before that for the arch, such as linux/arm.
+func (v *buildFlagValue) override(target *string, platform Platform) {
+	for _, key := range []string{platform.String(), platform.OS + "/" + platform.Arch} {
+		if value, ok := v.Platforms[key]; ok {
+			*target = value
+			return
+		}
+	}
+}
+
+// values returns the value for every platform and those for each of
+// them.
+func (v *buildFlagValue) values() []string {
+	values := []string{v.Value}
+	for _, value := range v.Platforms {
+		values = append(values, value)
+	}
+	return values
+}
+
+// stringSliceValue is a flag.Value that collects repeated flags into a
+// slice, such as -gocmd go1.21.0 -gocmd go1.22.0.
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringSliceValue) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
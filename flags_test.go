@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBuildFlagValue(t *testing.T) {
+	var v buildFlagValue
+	for _, s := range []string{
+		"-s -w",
+		"windows/amd64=-s -w -H windowsgui",
+		"linux/arm=-X main.arm=1",
+		"linux/armv7=",
+	} {
+		if err := v.Set(s); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if v.String() != "-s -w" {
+		t.Fatalf("bad: %s", v.String())
+	}
+
+	cases := []struct {
+		Platform Platform
+		Expected string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "-s -w"},
+		{Platform{OS: "windows", Arch: "amd64"}, "-s -w -H windowsgui"},
+		{Platform{OS: "linux", Arch: "arm", ARM: "6"}, "-X main.arm=1"},
+		{Platform{OS: "linux", Arch: "arm", ARM: "7"}, ""},
+	}
+	for _, tc := range cases {
+		actual := v.Value
+		v.override(&actual, tc.Platform)
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Platform.String(), actual)
+		}
+	}
+
+	// Flags with an "=" of their own are not platforms
+	v = buildFlagValue{}
+	v.Set("-X main.version=1.2.3")
+	if v.Value != "-X main.version=1.2.3" || len(v.Platforms) != 0 {
+		t.Fatalf("bad: %#v", v)
+	}
+}
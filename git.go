@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gitDescribe returns `git describe --tags` of the current directory, such
+// as "v1.2.3-4-gdeadbee". Without tags it is the abbreviated commit.
+func gitDescribe() (string, error) {
+	output, err := execGo("git", nil, "", "describe", "--tags", "--always", "--dirty")
+	if err != nil {
+		return "", fmt.Errorf("git describe failed: %s", strings.TrimSpace(err.Error()))
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// gitReason returns the last line of the error of a git command, which is
+// where git says what went wrong, such as "fatal: not a git repository".
+func gitReason(err error) string {
+	lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+	return strings.TrimPrefix(lines[len(lines)-1], "Stderr: ")
+}
+
+// gitCommitTime returns the commit time of HEAD as a Unix timestamp.
+func gitCommitTime() (string, error) {
+	output, err := execGo("git", nil, "", "log", "-1", "--format=%ct")
+	if err != nil {
+		return "", fmt.Errorf("git log failed: %s", strings.TrimSpace(err.Error()))
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// gitTags returns the git tags that start with prefix, with or without a
+// "v" in front of it. Outside of git there are none.
+func gitTags(prefix string) []string {
+	output, err := execGo("git", nil, "", "tag", "--list", prefix+"*", "v"+prefix+"*")
+	if err != nil {
+		return nil
+	}
+
+	return strings.Fields(output)
+}
+
+// releaseVersion is the version that release artifacts are named with:
+// `git describe --tags` without the "v" of the tag, or 0 outside of git.
+func releaseVersion() string {
+	v, err := gitDescribe()
+	if err != nil {
+		return "0"
+	}
+
+	return strings.TrimPrefix(v, "v")
+}
+
+// gitCommit returns the abbreviated commit of HEAD, or "" outside of git.
+func gitCommit() string {
+	output, err := execGo("git", nil, "", "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(output)
+}
+
+// gitPreviousTag returns the latest tag reachable from HEAD other than the
+// one of version, or "" if there is none.
+func gitPreviousTag(version string) string {
+	output, err := execGo("git", nil, "", "tag", "--merged", "HEAD", "--sort=-v:refname")
+	if err != nil {
+		return ""
+	}
+
+	for _, tag := range strings.Fields(output) {
+		if strings.TrimPrefix(tag, "v") != version {
+			return tag
+		}
+	}
+	return ""
+}
+
+// gitChanges returns the subjects of the commits after the tag since, or
+// of all commits if it is "", as a Markdown list.
+func gitChanges(since string) (string, error) {
+	args := []string{"log", "--no-merges", "--format=- %s (%h)"}
+	if since != "" {
+		args = append(args, since+"..HEAD")
+	}
+	output, err := execGo("git", nil, "", args...)
+	if err != nil {
+		return "", fmt.Errorf("git log failed: %s", strings.TrimSpace(err.Error()))
+	}
+
+	return strings.TrimSpace(output), nil
+}
@@ -2,51 +2,297 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
+
+	version "github.com/hashicorp/go-version"
 )
 
 type OutputTemplateData struct {
-	Dir  string
-	OS   string
-	Arch string
-	ARM  string
+	Dir   string
+	OS    string
+	Arch  string
+	ARM   string
+	Level string
+
+	// ARMVersion is the GOARM of the platform without the "v" of ARM,
+	// such as "7".
+	ARMVersion string
+
+	// Version and Commit are the release version and the abbreviated git
+	// commit that is being built.
+	Version string
+	Commit  string
+
+	// Ext is the extension of the binary, such as ".exe". It is added to
+	// the path unless the template already ends with it.
+	Ext string
 }
 
 type CompileOpts struct {
 	PackagePath string
 	Platform    Platform
 	OutputTpl   string
-	Ldflags     string
-	Gcflags     string
-	Asmflags    string
-	Tags        string
-	ModMode     string
-	Cgo         bool
-	Rebuild     bool
-	GoCmd       string
-	Race        bool
+
+	// OutputLayout is the -output-layout that OutputTpl is laid out with,
+	// outputLayoutFlat if empty. See output_template.go.
+	OutputLayout string
+
+	Ldflags    string
+	Gcflags    string
+	Asmflags   string
+	Tags       string
+	ModMode    string
+	ModCacheRW bool
+	Cgo        bool
+	Rebuild    bool
+	GoCmd      string
+	Race       bool
+	Trimpath   bool
+	BuildMode  string
+
+	// Garble, if set, is the garble command that obfuscates the build,
+	// with GarbleFlags such as "-literals" and the seed GarbleSeed. See
+	// obfuscate.go.
+	Garble      string
+	GarbleFlags string
+	GarbleSeed  string
+
+	// GoExperiment is the GOEXPERIMENT of the build. FIPS, if set, makes
+	// this the FIPS variant of the binary: "boringcrypto" or a GOFIPS140
+	// value. See fips.go.
+	GoExperiment string
+	FIPS         string
+
+	// PGO is the -pgo of go build: "auto", "off" or the absolute path of
+	// a CPU profile. Empty leaves it to go build.
+	PGO string
+
+	// GoFlags, if set, replaces the user's GOFLAGS for the build, and
+	// NoGoEnv leaves out the settings of `go env -w`. Overlay is the
+	// absolute path of the -overlay of go build. See goflags.go.
+	GoFlags *string
+	NoGoEnv bool
+	Overlay string
+
+	// Static links the binary statically: without cgo, or with cgo and a
+	// static external link, with musl-gcc if it is there. See -static.
+	Static bool
+
+	// Strip leaves the symbol table and debug info out of the binary. With
+	// SplitDebug, ELF binaries keep the debug info in a separate file. See
+	// StripBuild.
+	Strip      bool
+	SplitDebug bool
+
+	// Builder selects where `go build` runs: "local" (or empty) runs the
+	// Go command on this machine, "docker" and "podman" run it inside a
+	// container using BuilderImage, and "remote" on a worker of Remote.
+	Builder      string
+	BuilderImage string
+
+	// Remote sends the builds of the "remote" builder to the workers.
+	Remote *remotePool
+
+	// Test builds the test binary of the package with `go test -c`
+	// instead of the package itself.
+	Test bool
+
+	// Compiler is "gc" (or empty), "gccgo" or "tinygo". See checkCompiler
+	// for what each of them supports.
+	Compiler string
+
+	// GoWork is the go.work file of the workspace being built, if any,
+	// which is set for the build as GOWORK.
+	GoWork string
+
+	// Host is the platform we're building on. If unset, it is taken from
+	// the runtime package.
+	Host Platform
+
+	// AndroidNDK, if set, is the root of the Android NDK whose clang builds
+	// android with cgo, for the API level AndroidAPI. See android.go.
+	AndroidNDK string
+	AndroidAPI int
+
+	// IOSSDK, if set, is the Xcode SDK that ios builds with, for iOS
+	// IOSVersion and up. See ios.go.
+	IOSSDK     *xcodeSDK
+	IOSVersion string
+
+	// Output, if set, receives the output of the build as it runs.
+	Output io.Writer
+
+	// Version and Commit are the release version and git commit, for the
+	// output template.
+	Version string
+	Commit  string
+
+	// BuildID, if set, is the encoded build ID that is linked into the
+	// binary as main.goxBuildID. See buildid.go.
+	BuildID string
+}
+
+// BuildResult is the outcome of building a single package for a single
+// platform.
+type BuildResult struct {
+	Platform Platform
+	Path     string
+
+	// Output is the path to the built binary.
+	Output string
+	Err    error
+
+	// UpToDate is true if the binary was not rebuilt because incremental
+	// mode found its inputs unchanged.
+	UpToDate bool
+
+	// AllowedFailure is true if the platform is one of -allow-failures,
+	// so that Err doesn't fail the run.
+	AllowedFailure bool
+
+	// Annotations are the artifact's annotations from the config file.
+	Annotations map[string]string
+
+	// Duration is how long the build took.
+	Duration time.Duration
+
+	// Variant is "fips" for the FIPS variant of a binary, and empty
+	// otherwise.
+	Variant string
+
+	// Log is the file that the output of the build went to, with
+	// -log-dir.
+	Log string
+
+	// BuildOutput is what a failed build wrote, kept for the logs of the
+	// -triage bundle.
+	BuildOutput string
 }
 
 // GoCrossCompile
 func GoCrossCompile(opts *CompileOpts) error {
-	env := append(os.Environ(),
-		"GOOS="+opts.Platform.OS,
-		"GOARCH="+opts.Platform.Arch)
+	env := opts.buildEnv()
+
+	// Determine the full path to the output so that we can change our
+	// working directory when executing go build.
+	outputPathReal, err := opts.OutputPath()
+	if err != nil {
+		return err
+	}
+
+	chdir, pkg := splitPackagePath(opts.PackagePath)
+
+	ldflags := opts.Ldflags
+	if opts.Strip && !opts.splitsDebug() {
+		ldflags = stripLdflags(ldflags)
+	}
+	if opts.Static && opts.Cgo && canLinkStatic(opts.Platform.OS) {
+		ldflags = staticLdflags(ldflags)
+	}
+	if opts.BuildID != "" {
+		ldflags = strings.TrimSpace(ldflags + " -X " + buildIDVar + "=" + opts.BuildID)
+	}
+
+	if opts.Compiler == compilerTinygo {
+		_, err = execGoOutput(compilerTinygo, append(os.Environ(), env...), chdir, opts.Output,
+			opts.tinygoArgs(ldflags, outputPathReal, pkg)...)
+		return err
+	}
+
+	// Workers make the go command themselves
+	if opts.Builder == "remote" {
+		if chdir != "" {
+			return fmt.Errorf("-builder=remote can only build packages of a module, not %s", opts.PackagePath)
+		}
+		build, err := newRemoteBuild(opts, env, ldflags, pkg)
+		if err != nil {
+			return err
+		}
+		return opts.Remote.Build(build, outputPathReal, opts.Output)
+	}
+
+	args := []string{"build"}
+	if opts.Test {
+		args = []string{"test", "-c"}
+	}
+	if opts.Rebuild {
+		args = append(args, "-a")
+	}
+	if opts.ModMode != "" {
+		args = append(args, "-mod", opts.ModMode)
+	}
+	if opts.ModCacheRW {
+		args = append(args, "-modcacherw")
+	}
+	if opts.Race {
+		args = append(args, "-race")
+	}
+	if opts.Trimpath {
+		args = append(args, "-trimpath")
+	}
+	if opts.BuildMode != "" {
+		args = append(args, "-buildmode", opts.BuildMode)
+	}
+	if opts.PGO != "" {
+		args = append(args, "-pgo", opts.PGO)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay", opts.Overlay)
+	}
+	args = append(args, opts.compilerFlags(ldflags)...)
+	args = append(args, "-tags", opts.buildTags())
+	args = append(args, "-o", outputPathReal, pkg)
+
+	if isContainerBuilder(opts.Builder) {
+		_, err = execContainer(opts, env, chdir, filepath.Dir(outputPathReal), args...)
+		return err
+	}
+
+	goCmd := opts.GoCmd
+	if opts.Garble != "" {
+		goCmd, args = opts.Garble, append(opts.garbleArgs(), args...)
+	}
+	_, err = execGoOutput(goCmd, append(os.Environ(), env...), chdir, opts.Output, args...)
+	return err
+}
+
+// buildEnv returns the environment variables we set for the build. The
+// local builder layers these on top of our own environment, while
+// container builders pass only these into the container.
+func (opts *CompileOpts) buildEnv() []string {
+	var env []string
+	if !isTinygoTarget(opts.Platform) {
+		env = append(env, "GOOS="+opts.Platform.OS, "GOARCH="+opts.Platform.Arch)
+	}
+
+	// Libraries for C programs are built with cgo, so it can't be off, and
+	// so is BoringCrypto linked in. ios is always linked by clang.
+	if opts.BuildMode == "c-shared" || opts.BuildMode == "c-archive" || opts.FIPS == fipsBoring || opts.Platform.OS == "ios" {
+		opts.Cgo = true
+	}
 
 	// If we're building for our own platform, then enable cgo always. We
 	// respect the CGO_ENABLED flag if that is explicitly set on the platform.
-	if !opts.Cgo && os.Getenv("CGO_ENABLED") != "0" {
-		opts.Cgo = runtime.GOOS == opts.Platform.OS &&
-			runtime.GOARCH == opts.Platform.Arch
+	// Static builds only use cgo when it's asked for.
+	host := opts.Host
+	if host.OS == "" {
+		host = Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	}
+	native := host.OS == opts.Platform.OS && host.Arch == opts.Platform.Arch
+	if !opts.Cgo && !opts.Static && os.Getenv("CGO_ENABLED") != "0" {
+		opts.Cgo = native
 	}
 
 	// If cgo is enabled then set that env var
@@ -56,81 +302,158 @@ func GoCrossCompile(opts *CompileOpts) error {
 		env = append(env, "CGO_ENABLED=0")
 	}
 
-	if len(opts.Platform.ARM) > 0 {
-		env = append(env, "GOARM="+opts.Platform.ARM)
+	if arm := opts.Platform.ARMEnv(); arm != "" {
+		env = append(env, arm)
+	}
+	if level := opts.Platform.LevelEnv(); level != "" {
+		env = append(env, level)
 	}
 
-	var outputPath bytes.Buffer
-	tpl, err := template.New("output").Parse(opts.OutputTpl)
-	if err != nil {
-		return err
+	if opts.GoWork != "" {
+		env = append(env, "GOWORK="+opts.GoWork)
 	}
-	tplData := OutputTemplateData{
-		Dir:  filepath.Base(opts.PackagePath),
-		OS:   opts.Platform.OS,
-		Arch: opts.Platform.GetArch(),
-		ARM:  opts.Platform.GetARMVersion(),
+	if exp := opts.goExperiment(); exp != "" {
+		env = append(env, "GOEXPERIMENT="+exp)
 	}
-	if err := tpl.Execute(&outputPath, &tplData); err != nil {
-		return err
+	if opts.FIPS != "" && opts.FIPS != fipsBoring {
+		env = append(env, "GOFIPS140="+opts.FIPS)
+	}
+	env = append(env, opts.goFlagsEnv()...)
+
+	// The C cross compilers for cgo, and gccgo, can be set per platform
+	var cc string
+	for _, key := range []string{"CC", "CXX", "GCCGO"} {
+		var v string
+		envOverride(&v, opts.Platform, key)
+		if v != "" {
+			env = append(env, key+"="+v)
+		}
+		if key == "CC" {
+			cc = v
+		}
 	}
 
-	if opts.Platform.OS == "windows" {
-		outputPath.WriteString(".exe")
+	// android builds with cgo use the clang of the NDK for their ABI, which
+	// main checked is there
+	if opts.Cgo && opts.Platform.OS == "android" && opts.AndroidNDK != "" && cc == "" {
+		if clang, clangxx, err := androidClang(opts.AndroidNDK, opts.Platform, opts.AndroidAPI); err == nil {
+			env = append(env, "CC="+clang, "CXX="+clangxx)
+		}
 	}
 
-	// Determine the full path to the output so that we can change our
-	// working directory when executing go build.
-	outputPathReal := outputPath.String()
-	outputPathReal, err = filepath.Abs(outputPathReal)
-	if err != nil {
-		return err
+	// ios builds use the clang and SDK of Xcode, which main looked up
+	if opts.Cgo && opts.Platform.OS == "ios" && opts.IOSSDK != nil && cc == "" {
+		env = append(env, opts.IOSSDK.cgoEnv(opts.Platform, opts.IOSVersion)...)
 	}
 
-	// Go prefixes the import directory with '_' when it is outside
-	// the GOPATH.For this, we just drop it since we move to that
-	// directory to build.
-	chdir := ""
-	if opts.PackagePath[0] == '_' {
-		if runtime.GOOS == "windows" {
-			// We have to replace weird paths like this:
-			//
-			//   _/c_/Users
-			//
-			// With:
-			//
-			//   c:\Users
-			//
-			re := regexp.MustCompile("^/([a-zA-Z])_/")
-			chdir = re.ReplaceAllString(opts.PackagePath[1:], "$1:\\")
-			chdir = strings.Replace(chdir, "/", "\\", -1)
-		} else {
-			chdir = opts.PackagePath[1:]
+	// glibc can't really be linked statically, musl can
+	if opts.Static && opts.Cgo && opts.Platform.OS == "linux" && native && cc == "" {
+		if _, err := exec.LookPath("musl-gcc"); err == nil {
+			env = append(env, "CC=musl-gcc")
 		}
+	}
+
+	return env
+}
 
-		opts.PackagePath = ""
+// splitPackagePath returns the directory to run the Go command in and the
+// package to pass to it for the given import path.
+//
+// Go prefixes the import directory with '_' when it is outside
+// the GOPATH.For this, we just drop it since we move to that
+// directory to build.
+func splitPackagePath(path string) (string, string) {
+	if path == "" || path[0] != '_' {
+		return "", path
 	}
 
-	args := []string{"build"}
-	if opts.Rebuild {
-		args = append(args, "-a")
+	if runtime.GOOS == "windows" {
+		// We have to replace weird paths like this:
+		//
+		//   _/c_/Users
+		//
+		// With:
+		//
+		//   c:\Users
+		//
+		re := regexp.MustCompile("^/([a-zA-Z])_/")
+		chdir := re.ReplaceAllString(path[1:], "$1:\\")
+		return strings.Replace(chdir, "/", "\\", -1), ""
 	}
-	if opts.ModMode != "" {
-		args = append(args, "-mod", opts.ModMode)
+
+	return path[1:], ""
+}
+
+// OutputPath returns the absolute path that the binary will be written
+// to, from the output template.
+func (opts *CompileOpts) OutputPath() (string, error) {
+	var outputPath bytes.Buffer
+	tpl, err := parseOutputTemplate(outputLayoutTemplate(opts.OutputTpl, opts.OutputLayout))
+	if err != nil {
+		return "", err
 	}
-	if opts.Race {
-		args = append(args, "-race")
+	ext := outputExt(opts.Platform.OS, opts.BuildMode)
+	if err := tpl.Execute(&outputPath, opts.templateData()); err != nil {
+		return "", err
 	}
-	args = append(args,
-		"-gcflags", opts.Gcflags,
-		"-ldflags", opts.Ldflags,
-		"-asmflags", opts.Asmflags,
-		"-tags", opts.Tags,
-		"-o", outputPathReal,
-		opts.PackagePath)
 
-	_, err = execGo(opts.GoCmd, env, chdir, args...)
-	return err
+	if !strings.HasSuffix(outputPath.String(), ext) {
+		outputPath.WriteString(ext)
+	}
+	return filepath.Abs(outputPath.String())
+}
+
+// templateData is what the output and ldflags templates of opts are
+// executed with.
+func (opts *CompileOpts) templateData() *OutputTemplateData {
+	return &OutputTemplateData{
+		Dir:        filepath.Base(opts.PackagePath),
+		OS:         opts.Platform.OS,
+		Arch:       opts.Platform.GetArch(),
+		ARM:        opts.Platform.GetARMVersion(),
+		Level:      opts.Platform.Level,
+		ARMVersion: opts.Platform.ARM,
+		Version:    opts.Version,
+		Commit:     opts.Commit,
+		Ext:        outputExt(opts.Platform.OS, opts.BuildMode),
+	}
+}
+
+// expandLdflags executes the ldflags as a template like the output path,
+// so that "-X main.version={{.Version}}" sets the release version.
+func (opts *CompileOpts) expandLdflags() error {
+	if !strings.Contains(opts.Ldflags, "{{") {
+		return nil
+	}
+	tpl, err := parseOutputTemplate(opts.Ldflags)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, opts.templateData()); err != nil {
+		return err
+	}
+	opts.Ldflags = buf.String()
+	return nil
+}
+
+// outputExt is the file extension of what `go build` produces for the
+// given GOOS and build mode.
+func outputExt(goos, buildMode string) string {
+	switch buildMode {
+	case "c-shared":
+		return sharedLibExt(goos)
+	case "c-archive":
+		return ".a"
+	case "plugin":
+		return ".so"
+	}
+
+	if goos == "windows" {
+		return ".exe"
+	}
+	return ""
 }
 
 // GoMainDirs returns the file paths to the packages that are "main"
@@ -154,7 +477,7 @@ func GoMainDirs(packages []string, GoCmd string) ([]string, error) {
 
 		parts := strings.SplitN(line, "|", 2)
 		if len(parts) != 2 {
-			log.Printf("Bad line reading packages: %s", line)
+			ui.Warnf("Bad line reading packages: %s\n", line)
 			continue
 		}
 
@@ -166,9 +489,46 @@ func GoMainDirs(packages []string, GoCmd string) ([]string, error) {
 	return results, nil
 }
 
+// GoTestDirs returns the packages that have tests, from the list of
+// packages given, in the same form as GoMainDirs.
+func GoTestDirs(packages []string, GoCmd string) ([]string, error) {
+	args := make([]string, 0, len(packages)+3)
+	args = append(args, "list", "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.ImportPath}}{{end}}")
+	args = append(args, packages...)
+
+	output, err := execGo(GoCmd, nil, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0, len(output))
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			results = append(results, line)
+		}
+	}
+
+	return results, nil
+}
+
 // GoRoot returns the GOROOT value for the compiled `go` binary.
 func GoRoot() (string, error) {
-	output, err := execGo("go", nil, "", "env", "GOROOT")
+	return goEnv("go", "GOROOT")
+}
+
+// goEnv returns the value of the variable key from `go env`, which is
+// read once with LoadGoToolchain. A variable that `go env -json` leaves
+// out still gets a `go env` of its own.
+func goEnv(GoCmd string, key string) (string, error) {
+	tc, err := LoadGoToolchain(GoCmd)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := tc.Env[key]; ok {
+		return v, nil
+	}
+
+	output, err := execGo(GoCmd, nil, "", "env", key)
 	if err != nil {
 		return "", err
 	}
@@ -176,10 +536,88 @@ func GoRoot() (string, error) {
 	return strings.TrimSpace(output), nil
 }
 
+// GoToolchain is a snapshot of `go env` for a go command, with the
+// variables that the builds depend on at hand.
+type GoToolchain struct {
+	GoCmd   string
+	GOROOT  string
+	GOPATH  string
+	GOFLAGS string
+	GOENV   string
+
+	// Env is every variable of `go env -json`.
+	Env map[string]string
+}
+
+// goToolchains caches the toolchains of LoadGoToolchain, so that the
+// builds running in parallel share one `go env` instead of each running
+// their own.
+var goToolchains = struct {
+	sync.Mutex
+	m map[string]*goToolchainEntry
+}{m: make(map[string]*goToolchainEntry)}
+
+type goToolchainEntry struct {
+	once sync.Once
+	tc   *GoToolchain
+	err  error
+}
+
+// LoadGoToolchain returns the snapshot of `go env` for GoCmd. It is read
+// once for each go command, environment and working directory, since
+// those are what `go env` depends on, and then comes from the cache.
+func LoadGoToolchain(GoCmd string) (*GoToolchain, error) {
+	wd, _ := os.Getwd()
+	key := []string{GoCmd, wd}
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "GO") || strings.HasPrefix(e, "CGO_") ||
+			strings.HasPrefix(e, "CC=") || strings.HasPrefix(e, "CXX=") ||
+			strings.HasPrefix(e, "HOME=") || strings.HasPrefix(e, "XDG_CONFIG_HOME=") ||
+			strings.HasPrefix(e, "PATH=") {
+			key = append(key, e)
+		}
+	}
+	sort.Strings(key[2:])
+
+	goToolchains.Lock()
+	entry, ok := goToolchains.m[strings.Join(key, "\x00")]
+	if !ok {
+		entry = &goToolchainEntry{}
+		goToolchains.m[strings.Join(key, "\x00")] = entry
+	}
+	goToolchains.Unlock()
+
+	entry.once.Do(func() {
+		var output string
+		if output, entry.err = execGo(GoCmd, nil, "", "env", "-json"); entry.err != nil {
+			return
+		}
+		env := make(map[string]string)
+		if entry.err = json.Unmarshal([]byte(output), &env); entry.err != nil {
+			return
+		}
+		entry.tc = &GoToolchain{
+			GoCmd:   GoCmd,
+			GOROOT:  env["GOROOT"],
+			GOPATH:  env["GOPATH"],
+			GOFLAGS: env["GOFLAGS"],
+			GOENV:   env["GOENV"],
+			Env:     env,
+		}
+	})
+
+	return entry.tc, entry.err
+}
+
 // GoVersion reads the version of `go` that is on the PATH. This is done
 // instead of `runtime.Version()` because it is possible to run gox against
-// another Go version.
+// another Go version. It is the GOVERSION of LoadGoToolchain when the go
+// command has one, as every go since 1.16 does.
 func GoVersion() (string, error) {
+	if tc, err := LoadGoToolchain("go"); err == nil && tc.Env["GOVERSION"] != "" {
+		return tc.Env["GOVERSION"], nil
+	}
+
 	// NOTE: We use `go run` instead of `go version` because the output
 	// of `go version` might change whereas the source is guaranteed to run
 	// for some time thanks to Go's compatibility guarantee.
@@ -212,11 +650,42 @@ func GoVersionParts() (result [2]int, err error) {
 	return
 }
 
+// goVersionSupports reports whether the Go version versionStr fits the
+// constraint, such as ">= 1.14", of a flag. Versions without the "go"
+// prefix, such as those of development builds, are assumed to.
+func goVersionSupports(versionStr, constraint string) (bool, error) {
+	if !strings.HasPrefix(versionStr, "go") {
+		return true, nil
+	}
+
+	// go-version only cares about version numbers
+	current, err := version.NewVersion(versionStr[2:])
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse current go version: %s\n%s", versionStr, err)
+	}
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		panic(err)
+	}
+	return c.Check(current), nil
+}
+
 func execGo(GoCmd string, env []string, dir string, args ...string) (string, error) {
+	return execGoOutput(GoCmd, env, dir, nil, args...)
+}
+
+// execGoOutput is like execGo, but also copies the command's stdout and
+// stderr to output as it runs, if output is non-nil.
+func execGoOutput(GoCmd string, env []string, dir string, output io.Writer, args ...string) (string, error) {
 	var stderr, stdout bytes.Buffer
+	ui.Command(dir, env, GoCmd, args...)
 	cmd := exec.Command(GoCmd, args...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if output != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, output)
+		cmd.Stderr = io.MultiWriter(&stderr, output)
+	}
 	if env != nil {
 		cmd.Env = env
 	}
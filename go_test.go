@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"os/exec"
 	"strings"
 	"testing"
 )
@@ -45,3 +47,55 @@ func TestGoVersion(t *testing.T) {
 		t.Fatalf("bad: %#v", v)
 	}
 }
+
+func TestGoVersionSupports(t *testing.T) {
+	cases := []struct {
+		Version    string
+		Constraint string
+		Supported  bool
+		Err        bool
+	}{
+		{"go1.14", ">= 1.14", true, false},
+		{"go1.13.15", ">= 1.14", false, false},
+		{"devel +abc", ">= 1.24", true, false},
+		{"gox", ">= 1.11", false, true},
+	}
+	for _, tc := range cases {
+		ok, err := goVersionSupports(tc.Version, tc.Constraint)
+		if (err != nil) != tc.Err || ok != tc.Supported {
+			t.Fatalf("%s: bad: %t %v", tc.Version, ok, err)
+		}
+	}
+}
+
+func TestLoadGoToolchain(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	defer os.Setenv("GOFLAGS", os.Getenv("GOFLAGS"))
+	os.Setenv("GOFLAGS", "-trimpath")
+	tc, err := LoadGoToolchain("go")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tc.GOROOT == "" || tc.GOFLAGS != "-trimpath" || tc.Env["GOOS"] == "" {
+		t.Fatalf("bad: %#v", tc)
+	}
+	if again, _ := LoadGoToolchain("go"); again != tc {
+		t.Fatal("the toolchain should come from the cache")
+	}
+
+	// A different environment gets a snapshot of its own
+	os.Setenv("GOFLAGS", "-mod=mod")
+	other, err := LoadGoToolchain("go")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if other == tc || other.GOFLAGS != "-mod=mod" {
+		t.Fatalf("bad: %#v", other)
+	}
+	if v, err := goEnv("go", "GOFLAGS"); err != nil || v != "-mod=mod" {
+		t.Fatalf("bad: %q %s", v, err)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// goDownloadURL is where Go releases and their listing are downloaded
+// from. It is a variable for the tests.
+var goDownloadURL = "https://go.dev/dl/"
+
+// goVersionRe matches the Go versions that can be pinned with -go-version,
+// with or without the "go" prefix.
+var goVersionRe = regexp.MustCompile(`^(?:go)?(1\.([0-9]+)(?:\.[0-9]+)?((?:rc|beta)[0-9]+)?)$`)
+
+// goModVersionRe and goModToolchainRe match the go and toolchain lines
+// of a go.mod or go.work file.
+var goModVersionRe = regexp.MustCompile(`(?m)^go\s+(\S+)\s*$`)
+var goModToolchainRe = regexp.MustCompile(`(?m)^toolchain\s+(\S+)\s*$`)
+
+// goRelease is an entry of the release listing of go.dev/dl.
+type goRelease struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		Sha256   string `json:"sha256"`
+	} `json:"files"`
+}
+
+// ResolveGoVersion returns the Go release that -go-version asks for, such
+// as "go1.22.4". "mod" takes it from the toolchain line of go.work or
+// go.mod, or failing that the go line, the way GOTOOLCHAIN does.
+func ResolveGoVersion(v string) (string, error) {
+	if v == "mod" {
+		var err error
+		if v, err = goModVersion(); err != nil {
+			return "", err
+		}
+	}
+
+	m := goVersionRe.FindStringSubmatch(v)
+	if m == nil {
+		return "", fmt.Errorf("Invalid Go version %q, should be like 1.22.4", v)
+	}
+
+	// Since Go 1.21 the first release of "1.N" is "1.N.0"
+	version := m[1]
+	minor, _ := strconv.Atoi(m[2])
+	if minor >= 21 && m[3] == "" && strings.Count(version, ".") == 1 {
+		version += ".0"
+	}
+	return "go" + version, nil
+}
+
+// goModVersion reads the Go version from the go.work or go.mod file of
+// the current directory.
+func goModVersion() (string, error) {
+	var path string
+	if os.Getenv("GOWORK") != "off" {
+		path = findUp("go.work")
+	}
+	if path == "" {
+		path = findUp("go.mod")
+	}
+	if path == "" {
+		return "", fmt.Errorf("-go-version=mod: no go.mod file found")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if m := goModToolchainRe.FindSubmatch(data); m != nil && string(m[1]) != "default" {
+		return string(m[1]), nil
+	}
+	if m := goModVersionRe.FindSubmatch(data); m != nil {
+		return string(m[1]), nil
+	}
+
+	return "", fmt.Errorf("-go-version=mod: %s has no go version", path)
+}
+
+// findUp returns the path of the file name in the current directory or
+// the closest of its parents, or "" if there is none.
+func findUp(name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// GoToolchainDir is the directory that pinned Go releases are kept in,
+// GOX_TOOLCHAIN_DIR or "gox/go" in the user's cache directory.
+func GoToolchainDir() (string, error) {
+	if dir := os.Getenv("GOX_TOOLCHAIN_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "gox", "go"), nil
+}
+
+// EnsureGoToolchain returns the path of the go command of the release
+// version for this machine, downloading it into GoToolchainDir if it isn't
+// there yet. Downloads are checked against the SHA-256 that go.dev lists.
+func EnsureGoToolchain(version string) (string, error) {
+	root, err := GoToolchainDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, version)
+	goCmd := filepath.Join(dir, "go", "bin", "go"+outputExt(runtime.GOOS, ""))
+	if _, err := os.Stat(goCmd); err == nil {
+		return goCmd, nil
+	}
+
+	filename := goArchiveName(version, runtime.GOOS, runtime.GOARCH)
+	sum, err := goArchiveSum(version, filename)
+	if err != nil {
+		return "", err
+	}
+
+	ui.Infof("--> Downloading %s\n", filename)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	archive, err := downloadGoArchive(root, filename, sum)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+
+	// Unpack next to the final directory and move it into place, so a
+	// failed or concurrent download never leaves half a toolchain there.
+	tmp, err := ioutil.TempDir(root, version+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if strings.HasSuffix(filename, ".zip") {
+		err = extractZip(archive, tmp)
+	} else {
+		err = extractBundle(archive, tmp)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(goCmd); statErr != nil {
+			return "", err
+		}
+	}
+
+	return goCmd, nil
+}
+
+// goArchiveName is the file name of the release archive of version for
+// goos/goarch.
+func goArchiveName(version, goos, goarch string) string {
+	if goarch == "arm" {
+		goarch = "armv6l"
+	}
+	ext := "tar.gz"
+	if goos == "windows" {
+		ext = "zip"
+	}
+
+	return fmt.Sprintf("%s.%s-%s.%s", version, goos, goarch, ext)
+}
+
+// goArchiveSum looks up the SHA-256 of the release archive filename in
+// the listing of go.dev/dl.
+func goArchiveSum(version, filename string) (string, error) {
+	resp, err := http.Get(goDownloadURL + "?mode=json&include=all")
+	if err != nil {
+		return "", fmt.Errorf("Error listing Go releases: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error listing Go releases: %s", resp.Status)
+	}
+
+	var releases []goRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", fmt.Errorf("Error listing Go releases: %s", err)
+	}
+	for _, r := range releases {
+		if r.Version != version {
+			continue
+		}
+		for _, f := range r.Files {
+			if f.Filename == filename {
+				return f.Sha256, nil
+			}
+		}
+		return "", fmt.Errorf("%s has no release for %s/%s", version, runtime.GOOS, runtime.GOARCH)
+	}
+
+	return "", fmt.Errorf("Unknown Go version %s", version)
+}
+
+// downloadGoArchive downloads the release archive filename into dir and
+// returns its path, if it matches sum.
+func downloadGoArchive(dir, filename, sum string) (string, error) {
+	resp, err := http.Get(goDownloadURL + filename)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error downloading %s: %s", filename, resp.Status)
+	}
+
+	f, err := ioutil.TempFile(dir, filename)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("Checksum mismatch downloading %s", filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// extractZip unpacks the zip at path into dir, refusing entries that
+// would be outside of it.
+func extractZip(path string, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		target, ok := bundlePath(dir, f.Name)
+		if !ok {
+			return fmt.Errorf("%s: entry %s is outside of the archive", path, f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(r, target, f.Mode().Perm()|0644)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolveGoVersion(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"1.22.4", "go1.22.4", false},
+		{"go1.22.4", "go1.22.4", false},
+		{"1.22", "go1.22.0", false},
+		{"1.20", "go1.20", false},
+		{"1.23rc1", "go1.23rc1", false},
+		{"latest", "", true},
+		{"2.0", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ResolveGoVersion(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, actual)
+		}
+	}
+}
+
+func TestResolveGoVersion_mod(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sub := filepath.Join(td, "cmd", "app")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(sub); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	cases := []struct {
+		GoMod  string
+		Output string
+	}{
+		{"module example.com/app\n\ngo 1.21\n", "go1.21.0"},
+		{"module example.com/app\n\ngo 1.21\n\ntoolchain go1.22.4\n", "go1.22.4"},
+		{"module example.com/app\n\ngo 1.20\ntoolchain default\n", "go1.20"},
+	}
+
+	for _, tc := range cases {
+		if err := ioutil.WriteFile(filepath.Join(td, "go.mod"), []byte(tc.GoMod), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		actual, err := ResolveGoVersion("mod")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%q: bad: %s", tc.GoMod, actual)
+		}
+	}
+}
+
+func TestGoArchiveName(t *testing.T) {
+	cases := []struct {
+		OS, Arch, Output string
+	}{
+		{"linux", "amd64", "go1.22.4.linux-amd64.tar.gz"},
+		{"linux", "arm", "go1.22.4.linux-armv6l.tar.gz"},
+		{"windows", "arm64", "go1.22.4.windows-arm64.zip"},
+	}
+
+	for _, tc := range cases {
+		if actual := goArchiveName("go1.22.4", tc.OS, tc.Arch); actual != tc.Output {
+			t.Fatalf("%s/%s: bad: %s", tc.OS, tc.Arch, actual)
+		}
+	}
+}
+
+func TestEnsureGoToolchain(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	filename := goArchiveName("go1.22.4", runtime.GOOS, runtime.GOARCH)
+	archive := filepath.Join(td, filename)
+	if err := writeArchive(archive, "go", []archiveFile{{
+		Name: "bin/go" + outputExt(runtime.GOOS, ""),
+		Data: []byte("#!/bin/sh\n"),
+		Mode: 0755,
+	}}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum := sha256.Sum256(data)
+
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `[{"version": "go1.22.4", "files": [{"filename": %q, "sha256": %q}]}]`,
+				filename, hex.EncodeToString(sum[:]))
+		case "/" + filename:
+			downloads++
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	oldURL := goDownloadURL
+	goDownloadURL = server.URL + "/"
+	defer func() { goDownloadURL = oldURL }()
+	os.Setenv("GOX_TOOLCHAIN_DIR", filepath.Join(td, "toolchains"))
+	defer os.Unsetenv("GOX_TOOLCHAIN_DIR")
+
+	// The second call reuses the first download
+	for i := 0; i < 2; i++ {
+		goCmd, err := EnsureGoToolchain("go1.22.4")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		expected := filepath.Join(td, "toolchains", "go1.22.4", "go", "bin", "go"+outputExt(runtime.GOOS, ""))
+		if goCmd != expected {
+			t.Fatalf("bad: %s", goCmd)
+		}
+		if _, err := os.Stat(goCmd); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if downloads != 1 {
+		t.Fatalf("bad: %d", downloads)
+	}
+
+	// Unknown versions and corrupted downloads are errors
+	if _, err := EnsureGoToolchain("go1.99.0"); err == nil {
+		t.Fatal("should error")
+	}
+	data = append(data, 0)
+	os.RemoveAll(filepath.Join(td, "toolchains"))
+	if _, err := EnsureGoToolchain("go1.22.4"); err == nil {
+		t.Fatal("should error")
+	}
+}
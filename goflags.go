@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goFlags returns the GOFLAGS that the builds of opts run with: those of
+// -goflags if it is set, and otherwise the user's, from the environment
+// and `go env -w` unless -no-goenv leaves the latter out.
+func (opts *CompileOpts) goFlags() string {
+	if opts.GoFlags != nil {
+		return *opts.GoFlags
+	}
+	if !opts.NoGoEnv {
+		if tc, err := LoadGoToolchain(opts.GoCmd); err == nil {
+			return tc.GOFLAGS
+		}
+	}
+	return os.Getenv("GOFLAGS")
+}
+
+// goFlagsEnv returns the GOFLAGS and GOENV variables of the builds of
+// opts. Local builds read the user's GOFLAGS themselves, but containers
+// and workers only get what is passed to them.
+func (opts *CompileOpts) goFlagsEnv() []string {
+	var env []string
+	if opts.GoFlags != nil || isContainerBuilder(opts.Builder) || opts.Builder == "remote" {
+		env = append(env, "GOFLAGS="+opts.goFlags())
+	}
+	if opts.NoGoEnv {
+		env = append(env, "GOENV=off")
+	}
+	return env
+}
+
+// buildTags returns the -tags of the builds of opts: those of -tags, after
+// those of the -tags in GOFLAGS, since the -tags that gox passes to go
+// would otherwise replace them.
+func (opts *CompileOpts) buildTags() string {
+	var tags []string
+	seen := make(map[string]bool)
+	add := func(list string) {
+		for _, tag := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	for _, f := range strings.Fields(opts.goFlags()) {
+		if strings.HasPrefix(f, "-tags=") || strings.HasPrefix(f, "--tags=") {
+			add(f[strings.Index(f, "=")+1:])
+		}
+	}
+	add(opts.Tags)
+
+	return strings.Join(tags, ",")
+}
+
+// overlayFile is the -overlay file of go build: files to build from, keyed
+// by the files that they replace. An empty path deletes the file.
+type overlayFile struct {
+	Replace map[string]string
+}
+
+// LoadOverlay reads and checks the -overlay file at path, and returns its
+// absolute path, since the builds run in the directories of the packages.
+func LoadOverlay(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	overlay, err := readOverlay(abs)
+	if err != nil {
+		return "", err
+	}
+	for _, src := range overlay.Replace {
+		if src == "" {
+			continue
+		}
+		if _, err := os.Stat(overlay.path(src)); err != nil {
+			return "", fmt.Errorf("Error reading -overlay %s: %s", path, err)
+		}
+	}
+
+	return abs, nil
+}
+
+func readOverlay(path string) (*overlayFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading -overlay: %s", err)
+	}
+	var overlay overlayFile
+	if err := json.Unmarshal(data, &overlay); err != nil {
+		return nil, fmt.Errorf("Error reading -overlay %s: %s", path, err)
+	}
+	return &overlay, nil
+}
+
+// path returns the path of src, which go resolves relative to the
+// directory that it runs in. gox runs the builds of a module in the
+// current directory, so relative paths are taken from there.
+func (o *overlayFile) path(src string) string {
+	if filepath.IsAbs(src) {
+		return src
+	}
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return src
+	}
+	return abs
+}
+
+// overlayFiles returns the overlay file at path and the files that it
+// replaces others with, sorted.
+func overlayFiles(path string) ([]string, error) {
+	overlay, err := readOverlay(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	for _, src := range overlay.Replace {
+		if src != "" {
+			files = append(files, overlay.path(src))
+		}
+	}
+	sort.Strings(files[1:])
+	return files, nil
+}
+
+// hashOverlay writes the contents of the overlay at path and of its
+// files to h.
+func hashOverlay(h io.Writer, path string) error {
+	files, err := overlayFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintf(h, "overlay %s\n", f)
+		if err := hashFile(h, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompileOptsGoFlags(t *testing.T) {
+	tagged := "-trimpath -tags=netgo,osusergo"
+	empty := ""
+	cases := []struct {
+		Opts CompileOpts
+		Tags string
+		Env  []string
+	}{
+		{CompileOpts{GoFlags: &tagged, Tags: "osusergo prod"}, "netgo,osusergo,prod", []string{"GOFLAGS=" + tagged}},
+		{CompileOpts{GoFlags: &empty, Tags: "prod", NoGoEnv: true}, "prod", []string{"GOFLAGS=", "GOENV=off"}},
+		{CompileOpts{GoFlags: &tagged, Builder: "docker"}, "netgo,osusergo", []string{"GOFLAGS=" + tagged}},
+	}
+
+	for _, tc := range cases {
+		if actual := tc.Opts.buildTags(); actual != tc.Tags {
+			t.Fatalf("bad: %#v: %s", tc.Opts, actual)
+		}
+		if actual := tc.Opts.goFlagsEnv(); !reflect.DeepEqual(actual, tc.Env) {
+			t.Fatalf("bad: %#v: %#v", tc.Opts, actual)
+		}
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	replacement := filepath.Join(td, "main_fake.go")
+	ioutil.WriteFile(replacement, []byte("package main\n"), 0644)
+	good := filepath.Join(td, "good.json")
+	ioutil.WriteFile(good, []byte(`{"Replace": {"main.go": "`+replacement+`", "gone.go": ""}}`), 0644)
+	missing := filepath.Join(td, "missing.json")
+	ioutil.WriteFile(missing, []byte(`{"Replace": {"main.go": "`+filepath.Join(td, "nope.go")+`"}}`), 0644)
+	bad := filepath.Join(td, "bad.json")
+	ioutil.WriteFile(bad, []byte(`{"Replace": [}`), 0644)
+
+	path, err := LoadOverlay(good)
+	if err != nil || path != good {
+		t.Fatalf("bad: %s %s", path, err)
+	}
+	files, err := overlayFiles(path)
+	if err != nil || !reflect.DeepEqual(files, []string{good, replacement}) {
+		t.Fatalf("bad: %#v %s", files, err)
+	}
+
+	for _, path := range []string{missing, bad, filepath.Join(td, "none.json")} {
+		if _, err := LoadOverlay(path); err == nil {
+			t.Fatalf("should fail: %s", path)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// goreleaserImported are the top-level sections of a goreleaser config
+// that `gox import goreleaser` translates, or that need no translation.
+var goreleaserImported = map[string]bool{
+	"version":      true,
+	"project_name": true,
+	"dist":         true,
+	"builds":       true,
+	"archives":     true,
+	"checksum":     true,
+}
+
+// goreleaserDefaultFiles are the files that goreleaser puts in archives
+// that don't list any.
+var goreleaserDefaultFiles = []string{"LICENSE*", "README*", "CHANGELOG*", "license*", "readme*", "changelog*"}
+
+// goreleaserImporter translates a goreleaser config, and notes what of it
+// doesn't carry over to gox.
+type goreleaserImporter struct {
+	name     string
+	module   string
+	ports    map[string]bool
+	warnings []string
+}
+
+func (g *goreleaserImporter) warnf(format string, args ...interface{}) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+// importGoreleaser translates the builds, archives and checksum sections
+// of the goreleaser config in data into a gox config, for the module at
+// the import path module. name is the project name when the config has
+// none, and ports are the GOOS/GOARCH that the builds are limited to, as
+// goreleaser does. It returns what wasn't translated as warnings.
+func importGoreleaser(data []byte, name, module string, ports map[string]bool) (*initConfig, []string, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a mapping at the top of the config")
+	}
+
+	g := &goreleaserImporter{name: name, module: module, ports: ports}
+	if v := grString(root["project_name"]); v != "" {
+		g.name = v
+	}
+	var skipped []string
+	for key := range root {
+		if !goreleaserImported[key] {
+			skipped = append(skipped, key)
+		}
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		g.warnf("not imported: %s", strings.Join(skipped, ", "))
+	}
+
+	dist := grString(root["dist"])
+	if dist == "" {
+		dist = "dist"
+	}
+	config := &initConfig{}
+	binaries := g.builds(config, root["builds"], dist)
+	config.Archives = g.archives(root["archives"], dist, binaries)
+	config.Checksums = g.checksum(root["checksum"])
+	return config, g.warnings, nil
+}
+
+// builds translates the builds into the platforms and packages of config,
+// and returns the gox template of the name of each binary.
+func (g *goreleaserImporter) builds(config *initConfig, v interface{}, dist string) []string {
+	builds := grMaps(v)
+	if v == nil {
+		// Without builds goreleaser builds the main package of the module
+		builds = []map[string]interface{}{{}}
+	}
+
+	type build struct {
+		key, binary string
+		platforms   []string
+		pkg         *PackageConfig
+	}
+	var result []build
+	seen := make(map[string]bool)
+	var platforms []string
+	for i, b := range builds {
+		id := grString(b["id"])
+		if id == "" {
+			id = fmt.Sprintf("%d", i+1)
+		}
+		if grBool(b["skip"]) {
+			continue
+		}
+		if builder := grString(b["builder"]); builder != "" && builder != "go" {
+			g.warnf("builds: %s: not imported, gox only builds go", id)
+			continue
+		}
+		for _, key := range []string{"hooks", "flags", "gcflags", "asmflags", "overrides", "gobinary", "mod_timestamp", "no_unique_dist_dir", "buildmode", "tool", "command", "dir"} {
+			if b[key] != nil {
+				g.warnf("builds: %s: %s is not imported", id, key)
+			}
+		}
+		for _, env := range grList(b["env"]) {
+			if env != "CGO_ENABLED=0" {
+				g.warnf("builds: %s: env %s is not imported, set it when running gox", id, env)
+			}
+		}
+
+		pkg := &PackageConfig{
+			Tags:    strings.Join(grList(b["tags"]), ","),
+			Ldflags: g.template("builds: "+id+": ldflags", strings.Join(grList(b["ldflags"]), " "), grOutputFields, ""),
+		}
+		if pkg.Ldflags != "" {
+			if _, err := parseOutputTemplate(pkg.Ldflags); err != nil {
+				g.warnf("builds: %s: ldflags %q is not imported: %s", id, pkg.Ldflags, err)
+				pkg.Ldflags = ""
+			}
+		}
+
+		binary := "{{.Dir}}"
+		if v := grString(b["binary"]); v != "" {
+			binary = g.template("builds: "+id+": binary", v, grOutputFields, binary)
+		} else if g.name != "" {
+			binary = g.name
+		}
+		pkg.Output = path.Join(dist, "{{.Dir}}_{{.OS}}_{{.Arch}}", binary)
+		if _, err := parseOutputTemplate(pkg.Output); err != nil {
+			g.warnf("builds: %s: binary %q is not imported: %s", id, binary, err)
+			binary = "{{.Dir}}"
+			pkg.Output = path.Join(dist, "{{.Dir}}_{{.OS}}_{{.Arch}}", binary)
+		}
+
+		bld := build{key: g.packageKey(b["main"]), binary: binary, platforms: g.platforms(id, b), pkg: pkg}
+		if seen[bld.key] {
+			g.warnf("builds: %s: %s is built by an earlier build, only the first is imported", id, bld.key)
+			continue
+		}
+		seen[bld.key] = true
+		result = append(result, bld)
+		for _, p := range bld.platforms {
+			if !grContains(platforms, p) {
+				platforms = append(platforms, p)
+			}
+		}
+	}
+	sort.Strings(platforms)
+
+	config.OSArch = platforms
+	var binaries []string
+	for _, b := range result {
+		if len(b.platforms) != len(platforms) {
+			b.pkg.OSArch = b.platforms
+		}
+		if config.Packages == nil {
+			config.Packages = make(map[string]*PackageConfig)
+		}
+		config.Packages[b.key] = b.pkg
+		binaries = append(binaries, b.binary)
+	}
+	return binaries
+}
+
+// packageKey returns the key in the packages section of the main package
+// of a build, which is "." or a directory such as "./cmd/app".
+func (g *goreleaserImporter) packageKey(v interface{}) string {
+	main := grString(v)
+	if strings.HasSuffix(main, ".go") {
+		main = path.Dir(main)
+	}
+	main = path.Clean(strings.TrimPrefix(main, "./"))
+	if main == "." || main == "" {
+		return g.module
+	}
+	return main
+}
+
+// platforms returns the platforms of the build in gox's os/arch form.
+func (g *goreleaserImporter) platforms(id string, b map[string]interface{}) []string {
+	var platforms []Platform
+	if targets := grList(b["targets"]); len(targets) > 0 {
+		for _, t := range targets {
+			if t == "go_first_class" || t == "go_118_first_class" {
+				for port := range firstClassPorts {
+					parts := strings.SplitN(port, "/", 2)
+					p := Platform{OS: parts[0], Arch: parts[1]}
+					if p.Arch == "arm" {
+						p.ARM = "6"
+					}
+					platforms = append(platforms, p)
+				}
+				continue
+			}
+			parts := strings.Split(t, "_")
+			if len(parts) < 2 || len(parts) > 3 {
+				g.warnf("builds: %s: target %s is not imported", id, t)
+				continue
+			}
+			p := Platform{OS: parts[0], Arch: parts[1]}
+			if len(parts) == 3 {
+				if p.Arch == "arm" {
+					p.ARM = parts[2]
+				} else {
+					p.Level = parts[2]
+				}
+			}
+			platforms = append(platforms, p)
+		}
+	} else {
+		goos := grListDefault(b["goos"], "linux", "darwin", "windows")
+		goarch := grListDefault(b["goarch"], "386", "amd64", "arm64")
+		levels := map[string][]string{
+			"arm":      grListDefault(b["goarm"], "6"),
+			"amd64":    grListDefault(b["goamd64"], "v1"),
+			"arm64":    grListDefault(b["goarm64"], "v8.0"),
+			"386":      grListDefault(b["go386"], "sse2"),
+			"mips":     grListDefault(b["gomips"], "hardfloat"),
+			"mipsle":   grListDefault(b["gomips"], "hardfloat"),
+			"mips64":   grListDefault(b["gomips"], "hardfloat"),
+			"mips64le": grListDefault(b["gomips"], "hardfloat"),
+			"ppc64":    grListDefault(b["goppc64"], "power8"),
+			"ppc64le":  grListDefault(b["goppc64"], "power8"),
+			"riscv64":  grListDefault(b["goriscv64"], "rva20u64"),
+		}
+		for _, o := range goos {
+			for _, arch := range goarch {
+				if !g.ports[o+"/"+arch] {
+					continue
+				}
+				if arch == "arm" {
+					for _, arm := range levels["arm"] {
+						platforms = append(platforms, Platform{OS: o, Arch: arch, ARM: arm})
+					}
+					continue
+				}
+				if l, ok := levels[arch]; ok {
+					for _, level := range l {
+						platforms = append(platforms, Platform{OS: o, Arch: arch, Level: level})
+					}
+					continue
+				}
+				platforms = append(platforms, Platform{OS: o, Arch: arch})
+			}
+		}
+	}
+
+	var result []string
+	for _, p := range platforms {
+		if g.ignored(b["ignore"], p) {
+			continue
+		}
+		// The default level is what gox builds without one
+		if l, ok := archLevels[p.Arch]; ok && p.Level == l.Levels[0] {
+			p.Level = ""
+		}
+		if s := p.String(); !grContains(result, s) {
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ignored reports whether an entry of the ignore list of a build matches
+// the platform.
+func (g *goreleaserImporter) ignored(v interface{}, p Platform) bool {
+	for _, ig := range grMaps(v) {
+		level := grString(ig["goamd64"]) + grString(ig["goarm64"]) + grString(ig["go386"]) +
+			grString(ig["gomips"]) + grString(ig["goppc64"]) + grString(ig["goriscv64"])
+		if (grString(ig["goos"]) == "" || grString(ig["goos"]) == p.OS) &&
+			(grString(ig["goarch"]) == "" || grString(ig["goarch"]) == p.Arch) &&
+			(grString(ig["goarm"]) == "" || grString(ig["goarm"]) == p.ARM) &&
+			(level == "" || level == p.Level) {
+			return true
+		}
+	}
+	return false
+}
+
+// archives translates the first of the archives. binaries are the names
+// of the binaries of the builds.
+func (g *goreleaserImporter) archives(v interface{}, dist string, binaries []string) *ArchiveConfig {
+	archives := grMaps(v)
+	if v == nil {
+		archives = []map[string]interface{}{{}}
+	}
+	if len(archives) == 0 {
+		return nil
+	}
+	if len(archives) > 1 {
+		g.warnf("archives: only the first of %d archives is imported", len(archives))
+	}
+	a := archives[0]
+	for _, key := range []string{"wrap_in_directory", "strip_binary_directory", "meta", "hooks", "builds_info", "allow_different_binary_count"} {
+		if a[key] != nil {
+			g.warnf("archives: %s is not imported", key)
+		}
+	}
+
+	format := grArchiveFormat(a)
+	switch format {
+	case "":
+		format = "tar.gz"
+	case "binary":
+		g.warnf("archives: the binary format is not imported, gox keeps the binaries in %s", dist)
+		return nil
+	}
+
+	c := &ArchiveConfig{Format: format, Output: dist}
+	def := g.name + "_{{.Version}}_{{.OS}}_{{.Arch}}"
+	if g.name == "" {
+		def = "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}"
+	}
+	c.Name = g.template("archives: name_template", grString(a["name_template"]), grArchiveFields, def)
+	if _, err := template.New("archive").Parse(c.Name); err != nil {
+		g.warnf("archives: name_template %q is not imported: %s", grString(a["name_template"]), err)
+		c.Name = def
+	}
+	if len(binaries) == 1 && binaries[0] != "{{.Dir}}" {
+		c.Binary = binaries[0]
+	}
+
+	for _, o := range grMaps(a["format_overrides"]) {
+		format := grArchiveFormat(o)
+		if goos := grString(o["goos"]); goos != "" && format != "" && format != c.Format {
+			if format == "binary" || format == "none" {
+				g.warnf("archives: format_overrides: the %s format for %s is not imported", format, goos)
+				continue
+			}
+			if c.FormatOverrides == nil {
+				c.FormatOverrides = make(map[string]string)
+			}
+			c.FormatOverrides[goos] = format
+		}
+	}
+
+	if a["files"] == nil {
+		for _, glob := range goreleaserDefaultFiles {
+			if matches, _ := filepath.Glob(glob); len(matches) > 0 {
+				c.Files = append(c.Files, ArchiveFiles{Src: glob})
+			}
+		}
+	}
+	for _, f := range grItems(a["files"]) {
+		switch f := f.(type) {
+		case map[string]interface{}:
+			if f["strip_parent"] != nil || f["info"] != nil {
+				g.warnf("archives: files: strip_parent and info of %s are not imported", grString(f["src"]))
+			}
+			c.Files = append(c.Files, ArchiveFiles{Src: grString(f["src"]), Dst: grString(f["dst"])})
+		default:
+			c.Files = append(c.Files, ArchiveFiles{Src: grString(f)})
+		}
+	}
+	return c
+}
+
+// checksum translates the checksum section.
+func (g *goreleaserImporter) checksum(v interface{}) *ChecksumConfig {
+	c, _ := v.(map[string]interface{})
+	if grBool(c["disable"]) {
+		return nil
+	}
+	if algo := grString(c["algorithm"]); algo != "" && algo != "sha256" {
+		g.warnf("checksum: the %s algorithm is not imported, gox writes sha256", algo)
+	}
+	for _, key := range []string{"extra_files", "ids", "split"} {
+		if c[key] != nil {
+			g.warnf("checksum: %s is not imported", key)
+		}
+	}
+
+	def := g.name + "_{{.Version}}_checksums.txt"
+	name := g.template("checksum: name_template", grString(c["name_template"]), grChecksumFields, def)
+	if _, err := template.New("checksums").Parse(name); err != nil {
+		g.warnf("checksum: name_template %q is not imported: %s", grString(c["name_template"]), err)
+		name = def
+	}
+	return &ChecksumConfig{Name: name}
+}
+
+// The fields of goreleaser templates and what they are in the templates
+// of gox, for the output path and ldflags, the archive names and the
+// checksums name. .ProjectName becomes the project name.
+var (
+	grOutputFields = map[string]string{
+		"Os": "OS", "Arch": "Arch", "Arm": "ARMVersion", "Version": "Version",
+		"ShortCommit": "Commit", "FullCommit": "Commit", "Commit": "Commit",
+		"Date": `(date "2006-01-02T15:04:05Z07:00")`,
+	}
+	grArchiveFields = map[string]string{
+		"Os": "OS", "Arch": "GOARCH", "Arm": "ARM", "Version": "Version",
+	}
+	grChecksumFields = map[string]string{
+		"Version": "Version",
+	}
+)
+
+var (
+	// grArchArmRe matches the usual "{{ .Arch }}{{ with .Arm }}v{{ . }}{{
+	// end }}", which is {{.Arch}} in gox. It is marked with grArchMark
+	// while the fields are translated.
+	grArchArmRe = regexp.MustCompile(`\{\{-?\s*\.Arch\s*-?\}\}\{\{-?\s*(?:with|if) \.Arm\s*-?\}\}v\{\{-?\s*\.(?:Arm)?\s*-?\}\}\{\{-?\s*end\s*-?\}\}`)
+
+	grActionRe = regexp.MustCompile(`\{\{(-?\s*)(.*?)(\s*-?)\}\}`)
+	grFieldRe  = regexp.MustCompile(`(^|[^\w.])\.([A-Z]\w*)`)
+)
+
+const grArchMark = "\x00arch\x00"
+
+// template translates a goreleaser template into one of gox with fields,
+// returning def if tpl is empty or uses what gox doesn't have.
+func (g *goreleaserImporter) template(what, tpl string, fields map[string]string, def string) string {
+	if tpl == "" {
+		return def
+	}
+	result := grArchArmRe.ReplaceAllString(tpl, grArchMark)
+
+	var unknown []string
+	result = grActionRe.ReplaceAllStringFunc(result, func(action string) string {
+		m := grActionRe.FindStringSubmatch(action)
+		left, right := "{{", "}}"
+		if strings.Contains(m[1], "-") {
+			left = "{{- "
+		}
+		if strings.Contains(m[3], "-") {
+			right = " -}}"
+		}
+		if m[2] == ".ProjectName" && left == "{{" && right == "}}" {
+			return g.name
+		}
+		pipeline := grFieldRe.ReplaceAllStringFunc(m[2], func(ref string) string {
+			f := grFieldRe.FindStringSubmatch(ref)
+			if f[2] == "ProjectName" {
+				return f[1] + fmt.Sprintf("%q", g.name)
+			}
+			if to, ok := fields[f[2]]; ok {
+				if strings.HasPrefix(to, "(") {
+					return f[1] + to
+				}
+				return f[1] + "." + to
+			}
+			if !grContains(unknown, "."+f[2]) {
+				unknown = append(unknown, "."+f[2])
+			}
+			return ref
+		})
+		return left + pipeline + right
+	})
+	result = strings.Replace(result, grArchMark, "{{.Arch}}", -1)
+	if len(unknown) > 0 {
+		g.warnf("%s: %s not imported, using %q instead of %q", what, strings.Join(unknown, ", "), def, tpl)
+		return def
+	}
+	return result
+}
+
+// grArchiveFormat returns the format of an archive or format override,
+// from its format or, since goreleaser v2, the first of its formats.
+func grArchiveFormat(m map[string]interface{}) string {
+	if f := grString(m["format"]); f != "" {
+		return f
+	}
+	if f := grList(m["formats"]); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// grString returns a scalar as a string, or "" for anything else.
+func grString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// grBool reports whether a scalar is true.
+func grBool(v interface{}) bool {
+	return grString(v) == "true"
+}
+
+// grItems returns the items of a sequence, or a scalar as the only one.
+func grItems(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case nil:
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// grList returns the scalars of a sequence, or a scalar as the only one.
+func grList(v interface{}) []string {
+	var result []string
+	for _, item := range grItems(v) {
+		if s := grString(item); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// grListDefault is grList, with def when the list is empty.
+func grListDefault(v interface{}, def ...string) []string {
+	if l := grList(v); len(l) > 0 {
+		return l
+	}
+	return def
+}
+
+// grMaps returns the mappings of a sequence.
+func grMaps(v interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, item := range grItems(v) {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func grContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
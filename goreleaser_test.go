@@ -0,0 +1,182 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testGoreleaserConfig = `version: 2
+project_name: app
+
+before:
+  hooks:
+    - go mod tidy
+
+builds:
+  - id: app
+    main: ./cmd/app
+    binary: app
+    env:
+      - CGO_ENABLED=0
+    goos: [linux, darwin, windows]
+    goarch: [amd64, arm, arm64]
+    goarm: ["6", "7"]
+    ignore:
+      - goos: windows
+        goarch: arm
+    ldflags:
+      - -s -w
+      - -X main.version={{ .Version }} -X main.commit={{.ShortCommit}}
+    tags: [netgo, osusergo]
+  - id: worker
+    main: .
+    targets: [linux_amd64_v3, linux_arm64]
+
+archives:
+  - formats: [tar.gz]
+    name_template: "{{ .ProjectName }}_{{ .Version }}_{{ .Os }}_{{ .Arch }}{{ with .Arm }}v{{ . }}{{ end }}"
+    format_overrides:
+      - goos: windows
+        formats: [zip]
+    files:
+      - LICENSE
+      - src: docs/*
+        dst: docs
+
+checksum:
+  name_template: 'checksums.txt'
+
+brews:
+  - name: app
+`
+
+// testPorts are the ports of a recent Go that the tests use.
+var testPorts = map[string]bool{
+	"darwin/amd64": true, "darwin/arm64": true,
+	"linux/386": true, "linux/amd64": true, "linux/arm": true, "linux/arm64": true,
+	"windows/386": true, "windows/amd64": true, "windows/arm": true, "windows/arm64": true,
+}
+
+func TestImportGoreleaser(t *testing.T) {
+	config, warnings, err := importGoreleaser([]byte(testGoreleaserConfig), "module", "example.com/app", testPorts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &initConfig{
+		OSArch: []string{
+			"darwin/amd64", "darwin/arm64",
+			"linux/amd64", "linux/amd64v3", "linux/arm64", "linux/armv6", "linux/armv7",
+			"windows/amd64", "windows/arm64",
+		},
+		Packages: map[string]*PackageConfig{
+			"cmd/app": {
+				Tags:    "netgo,osusergo",
+				Ldflags: "-s -w -X main.version={{.Version}} -X main.commit={{.Commit}}",
+				Output:  "dist/{{.Dir}}_{{.OS}}_{{.Arch}}/app",
+				OSArch: []string{
+					"darwin/amd64", "darwin/arm64",
+					"linux/amd64", "linux/arm64", "linux/armv6", "linux/armv7",
+					"windows/amd64", "windows/arm64",
+				},
+			},
+			"example.com/app": {
+				Output: "dist/{{.Dir}}_{{.OS}}_{{.Arch}}/app",
+				OSArch: []string{"linux/amd64v3", "linux/arm64"},
+			},
+		},
+		Archives: &ArchiveConfig{
+			Name:            "app_{{.Version}}_{{.OS}}_{{.Arch}}",
+			Format:          "tar.gz",
+			FormatOverrides: map[string]string{"windows": "zip"},
+			Output:          "dist",
+			Files:           []ArchiveFiles{{Src: "LICENSE"}, {Src: "docs/*", Dst: "docs"}},
+		},
+		Checksums: &ChecksumConfig{Name: "checksums.txt"},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v\n%#v\n%#v", config, config.Packages["cmd/app"], config.Archives)
+	}
+	if len(warnings) != 1 || warnings[0] != "not imported: before, brews" {
+		t.Fatalf("bad: %#v", warnings)
+	}
+}
+
+func TestImportGoreleaser_defaults(t *testing.T) {
+	config, warnings, err := importGoreleaser([]byte("archives:\n  - files: [LICENSE]\n"), "module", "example.com/module", testPorts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"darwin/amd64", "darwin/arm64",
+		"linux/386", "linux/amd64", "linux/arm64",
+		"windows/386", "windows/amd64", "windows/arm64",
+	}
+	if !reflect.DeepEqual(config.OSArch, expected) || len(warnings) != 0 {
+		t.Fatalf("bad: %#v %#v", config.OSArch, warnings)
+	}
+	if pkg := config.Packages["example.com/module"]; pkg == nil || pkg.Output != "dist/{{.Dir}}_{{.OS}}_{{.Arch}}/module" {
+		t.Fatalf("bad: %#v", config.Packages)
+	}
+	if config.Archives.Name != "module_{{.Version}}_{{.OS}}_{{.Arch}}" || config.Archives.Binary != "module" {
+		t.Fatalf("bad: %#v", config.Archives)
+	}
+	if config.Checksums.Name != "module_{{.Version}}_checksums.txt" {
+		t.Fatalf("bad: %#v", config.Checksums)
+	}
+}
+
+func TestImportGoreleaserTemplate(t *testing.T) {
+	cases := []struct {
+		Input   string
+		Fields  map[string]string
+		Output  string
+		Warning bool
+	}{
+		{"", grArchiveFields, "default", false},
+		{"{{ .ProjectName }}-{{ .Version }}_{{ .Os }}", grArchiveFields, "app-{{.Version}}_{{.OS}}", false},
+		{"{{ .ProjectName }}_{{- .Os }}", grArchiveFields, "app_{{- .OS}}", false},
+		{`{{ if eq .Arch "amd64" }}x86_64{{ else }}{{ .Arch }}{{ end }}`, grArchiveFields,
+			`{{if eq .GOARCH "amd64"}}x86_64{{else}}{{.GOARCH}}{{end}}`, false},
+		{"{{ .Arch }}{{ with .Arm }}v{{ . }}{{ end }}", grArchiveFields, "{{.Arch}}", false},
+		{"-X main.date={{ .Date }}", grOutputFields, `-X main.date={{(date "2006-01-02T15:04:05Z07:00")}}`, false},
+		{"{{ .Env.NAME }}", grArchiveFields, "default", true},
+		{"{{ .Tag }}", grChecksumFields, "default", true},
+	}
+
+	for _, tc := range cases {
+		g := &goreleaserImporter{name: "app"}
+		actual := g.template("test", tc.Input, tc.Fields, "default")
+		if actual != tc.Output || (len(g.warnings) > 0) != tc.Warning {
+			t.Fatalf("bad: %s: %s %#v", tc.Input, actual, g.warnings)
+		}
+	}
+}
+
+func TestImportGoreleaser_unsupported(t *testing.T) {
+	config, warnings, err := importGoreleaser([]byte(`builds:
+  - builder: rust
+  - hooks:
+      pre: make
+archives:
+  - format: binary
+    name_template: "{{ title .Os }}"
+checksum:
+  disable: true
+`), "app", "example.com/app", testPorts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Archives != nil || config.Checksums != nil || len(config.Packages) != 1 {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	all := strings.Join(warnings, "\n")
+	for _, w := range []string{"builds: 1: not imported", "builds: 2: hooks is not imported", "the binary format"} {
+		if !strings.Contains(all, w) {
+			t.Fatalf("bad: %s", all)
+		}
+	}
+}
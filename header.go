@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// elfArch is what the ELF header of a binary for a GOARCH looks like.
+type elfArch struct {
+	Machine elf.Machine
+	Class   elf.Class
+	Order   binary.ByteOrder
+}
+
+var elfArchs = map[string]elfArch{
+	"386":      {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian},
+	"loong64":  {elf.Machine(258), elf.ELFCLASS64, binary.LittleEndian},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, binary.LittleEndian},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, binary.BigEndian},
+}
+
+// elfOSABIs are the operating systems that an ELF OS ABI is only used by.
+// Most binaries have ELFOSABI_NONE, which could be any of them.
+var elfOSABIs = map[elf.OSABI][]string{
+	elf.ELFOSABI_LINUX:   {"linux", "android"},
+	elf.ELFOSABI_FREEBSD: {"freebsd"},
+	elf.ELFOSABI_NETBSD:  {"netbsd"},
+	elf.ELFOSABI_OPENBSD: {"openbsd"},
+	elf.ELFOSABI_SOLARIS: {"solaris", "illumos"},
+}
+
+var peMachines = map[string]uint16{
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm":   pe.IMAGE_FILE_MACHINE_ARMNT,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+var machoCpus = map[string]macho.Cpu{
+	"amd64": macho.CpuAmd64,
+	"arm64": macho.CpuArm64,
+}
+
+// wasmMagic starts every WebAssembly module.
+var wasmMagic = []byte("\x00asm")
+
+// CheckHeader reads the header of the binary at path, built with opts, and
+// returns an error if it isn't for the platform that was asked for, or is
+// dynamically linked when it can't be. Formats and platforms that it
+// doesn't know are not checked.
+func CheckHeader(opts *CompileOpts, path string) error {
+	if opts.BuildMode == "c-archive" || isTinygoTarget(opts.Platform) {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	format := binaryFormat(magic)
+	expected := headerFormat(opts.Platform.OS, opts.Platform.Arch)
+	if expected == "" {
+		return nil
+	}
+	if format != expected {
+		if format == "" {
+			format = "an unknown format"
+		}
+		return fmt.Errorf("%s is %s, not %s as %s needs", path, format, expected, opts.Platform.String())
+	}
+
+	switch format {
+	case "ELF":
+		return checkELF(opts, f, path)
+	case "PE":
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if m, ok := peMachines[opts.Platform.Arch]; ok && pf.Machine != m {
+			return fmt.Errorf("%s is for PE machine %#x, not %s", path, pf.Machine, opts.Platform.String())
+		}
+	case "Mach-O":
+		mf, err := macho.NewFile(f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if cpu, ok := machoCpus[opts.Platform.Arch]; ok && mf.Cpu != cpu {
+			return fmt.Errorf("%s is for %s, not %s", path, mf.Cpu, opts.Platform.String())
+		}
+	}
+
+	return nil
+}
+
+// binaryFormat returns the format of a binary that starts with the four
+// bytes of magic: "ELF", "PE", "Mach-O" or "WebAssembly", or "" if it is
+// none of them.
+func binaryFormat(magic []byte) string {
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		return "ELF"
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		return "PE"
+	case bytes.Equal(magic, wasmMagic):
+		return "WebAssembly"
+	}
+	for _, m := range []uint32{macho.Magic32, macho.Magic64} {
+		if binary.LittleEndian.Uint32(magic) == m || binary.BigEndian.Uint32(magic) == m {
+			return "Mach-O"
+		}
+	}
+	return ""
+}
+
+// headerFormat is the binary format of a platform, or "" if it isn't one
+// that we check.
+func headerFormat(goos, goarch string) string {
+	switch goos {
+	case "windows":
+		return "PE"
+	case "darwin", "ios":
+		return "Mach-O"
+	case "js", "wasip1":
+		return "WebAssembly"
+	case "aix", "plan9":
+		return ""
+	}
+
+	if _, ok := elfArchs[goarch]; ok {
+		return "ELF"
+	}
+	return ""
+}
+
+func checkELF(opts *CompileOpts, f io.ReaderAt, path string) error {
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	arch := elfArchs[opts.Platform.Arch]
+	if ef.Machine != arch.Machine || ef.Class != arch.Class || ef.ByteOrder != arch.Order {
+		return fmt.Errorf("%s is for %s %s %s, not %s", path,
+			ef.Machine, ef.Class, ef.ByteOrder, opts.Platform.String())
+	}
+	if oses, ok := elfOSABIs[ef.OSABI]; ok {
+		found := false
+		for _, goos := range oses {
+			found = found || goos == opts.Platform.OS
+		}
+		if !found {
+			return fmt.Errorf("%s has the OS ABI %s, not that of %s", path, ef.OSABI, opts.Platform.String())
+		}
+	}
+
+	// Go links linux executables statically unless cgo is on, so an
+	// interpreter means a C library got linked in anyways
+	var static string
+	switch {
+	case opts.Static && canLinkStatic(opts.Platform.OS):
+		static = "-static"
+	case opts.Platform.OS == "linux" && !opts.Cgo && !opts.Race &&
+		opts.Compiler != compilerGccgo &&
+		(opts.BuildMode == "" || opts.BuildMode == "exe"):
+		static = "CGO_ENABLED=0"
+	}
+	if static != "" {
+		for _, p := range ef.Progs {
+			if p.Type == elf.PT_INTERP {
+				return fmt.Errorf("%s is dynamically linked, but was built with %s", path, static)
+			}
+		}
+		if libs, _ := ef.ImportedLibraries(); len(libs) > 0 {
+			return fmt.Errorf("%s needs %s, but was built with %s", path, strings.Join(libs, ", "), static)
+		}
+	}
+
+	return nil
+}
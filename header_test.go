@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckHeader(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	build := func(goos, goarch string) string {
+		output := filepath.Join(td, goos+"_"+goarch)
+		cmd := exec.Command("go", "build", "-o", output, ".")
+		cmd.Dir = td
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("err: %s\n%s", err, out)
+		}
+		return output
+	}
+	binaries := map[string]string{
+		"linux/arm64":   build("linux", "arm64"),
+		"freebsd/amd64": build("freebsd", "amd64"),
+		"windows/386":   build("windows", "386"),
+		"darwin/arm64":  build("darwin", "arm64"),
+		"js/wasm":       build("js", "wasm"),
+	}
+
+	cases := []struct {
+		Binary   string
+		Platform Platform
+		Err      bool
+	}{
+		{"linux/arm64", Platform{OS: "linux", Arch: "arm64"}, false},
+		{"linux/arm64", Platform{OS: "linux", Arch: "amd64"}, true},
+		{"linux/arm64", Platform{OS: "windows", Arch: "arm64"}, true},
+		{"freebsd/amd64", Platform{OS: "freebsd", Arch: "amd64"}, false},
+		{"freebsd/amd64", Platform{OS: "linux", Arch: "amd64"}, true},
+		{"windows/386", Platform{OS: "windows", Arch: "386"}, false},
+		{"windows/386", Platform{OS: "windows", Arch: "amd64"}, true},
+		{"darwin/arm64", Platform{OS: "darwin", Arch: "arm64"}, false},
+		{"darwin/arm64", Platform{OS: "darwin", Arch: "amd64"}, true},
+		{"js/wasm", Platform{OS: "wasip1", Arch: "wasm"}, false},
+		{"js/wasm", Platform{OS: "plan9", Arch: "amd64"}, false},
+	}
+
+	for _, tc := range cases {
+		opts := &CompileOpts{Platform: tc.Platform}
+		if err := CheckHeader(opts, binaries[tc.Binary]); (err != nil) != tc.Err {
+			t.Fatalf("%s as %s: err: %s", tc.Binary, tc.Platform.String(), err)
+		}
+	}
+}
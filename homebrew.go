@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// HomebrewConfig is the "homebrew" section of the config file. It writes
+// a Homebrew formula that installs the darwin and linux archives of a
+// binary, with the URL and SHA-256 of the archive for each platform, and
+// can push it to a tap.
+type HomebrewConfig struct {
+	// Name is the name of the formula, defaults to the directory of the
+	// package. Package picks the main package when several are built.
+	Name    string `json:"name,omitempty"`
+	Package string `json:"package,omitempty"`
+
+	Description  string   `json:"description,omitempty"`
+	Homepage     string   `json:"homepage,omitempty"`
+	License      string   `json:"license,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// URL is the template for where each archive is downloaded from, with
+	// {{.Name}} (the file name of the archive), {{.Version}}, {{.OS}} and
+	// {{.Arch}}.
+	URL string `json:"url"`
+
+	// Test is the Ruby of the test block, defaults to running the binary
+	// with --version.
+	Test string `json:"test,omitempty"`
+
+	// Output is the directory the formula is written to, defaults to
+	// that of the archives.
+	Output string `json:"output,omitempty"`
+
+	// Tap, if set, is the tap that -publish pushes the formula to, in
+	// the directory "Formula" by default.
+	Tap *RepoConfig `json:"tap,omitempty"`
+}
+
+// homebrewBinary is the archive of the formula for one platform. Cond is
+// the Ruby condition on the machine that it is for, or empty if it is for
+// every machine of its OS.
+type homebrewBinary struct {
+	Cond   string
+	URL    string
+	SHA256 string
+}
+
+// homebrewConds are the conditions for the arches that Homebrew runs on,
+// in the order they are written.
+var homebrewConds = []struct {
+	Arch string
+	Cond string
+}{
+	{"universal", ""},
+	{"amd64", "Hardware::CPU.intel? && Hardware::CPU.is_64_bit?"},
+	{"arm64", "Hardware::CPU.arm? && Hardware::CPU.is_64_bit?"},
+	{"arm", "Hardware::CPU.arm? && !Hardware::CPU.is_64_bit?"},
+}
+
+// Validate checks the url template and the tap, if any.
+func (c *HomebrewConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("homebrew: url is required")
+	}
+	if err := validateURLTemplate("homebrew", c.URL); err != nil {
+		return err
+	}
+	if c.Tap != nil {
+		if err := c.Tap.Validate("homebrew: tap"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// name returns the name of the formula for the package at path.
+func (c *HomebrewConfig) name(path string) string {
+	if c.Name == "" {
+		return filepath.Base(path)
+	}
+	return c.Name
+}
+
+// homebrewClass returns the Ruby class of the formula name, the way
+// Homebrew makes it: "my-app" is MyApp and "my-app@2" is MyAppAT2.
+func homebrewClass(name string) string {
+	name = strings.Replace(name, "@", "AT", -1)
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// homebrewBinaries picks the builds of goos for the formula. A
+// universal darwin binary covers both arches.
+func homebrewBinaries(goos string, builds []BuildResult) []BuildResult {
+	if picked := pickBuilds(goos, []string{"universal"}, builds); len(picked) > 0 {
+		return picked
+	}
+
+	var arches []string
+	for _, c := range homebrewConds[1:] {
+		arches = append(arches, c.Arch)
+	}
+	return pickBuilds(goos, arches, builds)
+}
+
+// WriteHomebrewFormula writes the formula for the archives of results and
+// returns its path. Only the standard variants of successful darwin and
+// linux builds are in it.
+func WriteHomebrewFormula(c *HomebrewConfig, archives *ArchiveConfig, results []BuildResult, version string) (string, error) {
+	builds, err := releaseBuilds(c.Package, results, "darwin", "linux")
+	if err != nil {
+		return "", err
+	}
+
+	name := c.name(builds[0].Path)
+	binary, err := archives.binaryName(builds[0], version)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by gox, do not edit.\n")
+	fmt.Fprintf(&buf, "class %s < Formula\n", homebrewClass(name))
+	if c.Description != "" {
+		fmt.Fprintf(&buf, "  desc %s\n", rubyString(c.Description))
+	}
+	if c.Homepage != "" {
+		fmt.Fprintf(&buf, "  homepage %s\n", rubyString(c.Homepage))
+	}
+	fmt.Fprintf(&buf, "  version %s\n", rubyString(version))
+	if c.License != "" {
+		fmt.Fprintf(&buf, "  license %s\n", rubyString(c.License))
+	}
+	if len(c.Dependencies) > 0 {
+		buf.WriteString("\n")
+		for _, dep := range c.Dependencies {
+			fmt.Fprintf(&buf, "  depends_on %s\n", rubyString(dep))
+		}
+	}
+
+	for _, goos := range []string{"darwin", "linux"} {
+		var bins []homebrewBinary
+		for _, r := range homebrewBinaries(goos, builds) {
+			bin, err := c.binary(archives, r, version)
+			if err != nil {
+				return "", err
+			}
+			bins = append(bins, bin)
+		}
+		if len(bins) == 0 {
+			continue
+		}
+
+		block := "on_macos"
+		if goos == "linux" {
+			block = "on_linux"
+		}
+		fmt.Fprintf(&buf, "\n  %s do\n", block)
+		writeHomebrewBinaries(&buf, bins)
+		buf.WriteString("  end\n")
+	}
+
+	test := c.Test
+	if test == "" {
+		test = fmt.Sprintf(`system "#{bin}/%s", "--version"`, binary)
+	}
+	fmt.Fprintf(&buf, "\n  def install\n    bin.install %s\n  end\n", rubyString(binary))
+	fmt.Fprintf(&buf, "\n  test do\n")
+	for _, line := range strings.Split(strings.TrimSpace(test), "\n") {
+		fmt.Fprintf(&buf, "    %s\n", strings.TrimRight(line, " \t"))
+	}
+	buf.WriteString("  end\nend\n")
+
+	dir := c.Output
+	if dir == "" {
+		dir = archives.output()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name+".rb")
+	return path, ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// binary returns the URL and SHA-256 of the archive of r, and the
+// condition of its arch.
+func (c *HomebrewConfig) binary(archives *ArchiveConfig, r BuildResult, version string) (homebrewBinary, error) {
+	var bin homebrewBinary
+	for _, cond := range homebrewConds {
+		if cond.Arch == r.Platform.Arch {
+			bin.Cond = cond.Cond
+		}
+	}
+
+	path, err := archives.Path(r, version)
+	if err != nil {
+		return bin, err
+	}
+	if bin.SHA256, err = fileSHA256(path); err != nil {
+		return bin, err
+	}
+
+	bin.URL, err = releaseURL(c.URL, path, r, version)
+	return bin, err
+}
+
+// rubyString quotes s as a Ruby string, which is a Go string that
+// doesn't interpolate.
+func rubyString(s string) string {
+	return strings.Replace(strconv.Quote(s), "#", `\#`, -1)
+}
+
+// writeHomebrewBinaries writes the url and sha256 of each of bins, in an
+// if chain on their conditions.
+func writeHomebrewBinaries(buf *bytes.Buffer, bins []homebrewBinary) {
+	if len(bins) == 1 && bins[0].Cond == "" {
+		fmt.Fprintf(buf, "    url %s\n    sha256 %s\n", rubyString(bins[0].URL), rubyString(bins[0].SHA256))
+		return
+	}
+
+	for i, bin := range bins {
+		keyword := "elsif"
+		if i == 0 {
+			keyword = "if"
+		}
+		fmt.Fprintf(buf, "    %s %s\n", keyword, bin.Cond)
+		fmt.Fprintf(buf, "      url %s\n      sha256 %s\n", rubyString(bin.URL), rubyString(bin.SHA256))
+	}
+	buf.WriteString("    end\n")
+}
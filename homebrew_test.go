@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHomebrewClass(t *testing.T) {
+	cases := map[string]string{
+		"app":       "App",
+		"my-app":    "MyApp",
+		"my_app.io": "MyAppIo",
+		"my-app@2":  "MyAppAT2",
+	}
+
+	for name, expected := range cases {
+		if actual := homebrewClass(name); actual != expected {
+			t.Fatalf("%s: bad: %s", name, actual)
+		}
+	}
+}
+
+func TestWriteHomebrewFormula(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td}
+	var results []BuildResult
+	for _, p := range []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "6"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "windows", Arch: "amd64"},
+	} {
+		r := BuildResult{Platform: p, Path: "example.com/app"}
+		path, err := archives.Path(r, "1.2.3")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, r)
+	}
+
+	c := &HomebrewConfig{
+		Description: `Does "things"`,
+		License:     "MIT",
+		URL:         "https://example.com/{{.Version}}/{{.Name}}",
+	}
+	path, err := WriteHomebrewFormula(c, archives, results, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != filepath.Join(td, "app.rb") {
+		t.Fatalf("bad: %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	formula := string(data)
+
+	sum, err := fileSHA256(filepath.Join(td, "app_1.2.3_darwin_amd64.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, expected := range []string{
+		"class App < Formula\n",
+		`  desc "Does \"things\""` + "\n",
+		`  version "1.2.3"` + "\n",
+		"  on_macos do\n    if Hardware::CPU.intel? && Hardware::CPU.is_64_bit?\n" +
+			`      url "https://example.com/1.2.3/app_1.2.3_darwin_amd64.tar.gz"` + "\n" +
+			`      sha256 "` + sum + `"` + "\n" +
+			"    elsif Hardware::CPU.arm? && Hardware::CPU.is_64_bit?\n",
+		`      url "https://example.com/1.2.3/app_1.2.3_linux_armv7.tar.gz"`,
+		`    bin.install "app"`,
+		`    system "#{bin}/app", "--version"`,
+	} {
+		if !strings.Contains(formula, expected) {
+			t.Fatalf("missing %q in:\n%s", expected, formula)
+		}
+	}
+	for _, unexpected := range []string{"armv6", "windows", "homepage"} {
+		if strings.Contains(formula, unexpected) {
+			t.Fatalf("unexpected %q in:\n%s", unexpected, formula)
+		}
+	}
+}
+
+func TestWriteHomebrewFormula_universal(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td}
+	var results []BuildResult
+	for _, arch := range []string{"amd64", "arm64", "universal"} {
+		r := BuildResult{Platform: Platform{OS: "darwin", Arch: arch}, Path: "example.com/app"}
+		path, _ := archives.Path(r, "1.0.0")
+		ioutil.WriteFile(path, []byte(arch), 0644)
+		results = append(results, r)
+	}
+
+	c := &HomebrewConfig{Name: "tool", URL: "https://example.com/{{.Name}}"}
+	path, err := WriteHomebrewFormula(c, archives, results, "1.0.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	formula := string(data)
+	if !strings.Contains(formula, "  on_macos do\n    url \"https://example.com/app_1.0.0_darwin_universal.tar.gz\"\n") {
+		t.Fatalf("bad:\n%s", formula)
+	}
+	if strings.Contains(formula, "Hardware::CPU") || strings.Contains(formula, "on_linux") {
+		t.Fatalf("bad:\n%s", formula)
+	}
+}
+
+func TestWriteHomebrewFormula_packages(t *testing.T) {
+	results := []BuildResult{
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, Path: "example.com/cmd/a"},
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, Path: "example.com/cmd/b"},
+	}
+
+	c := &HomebrewConfig{URL: "https://example.com/{{.Name}}"}
+	if _, err := WriteHomebrewFormula(c, &ArchiveConfig{}, results, "1.0.0"); err == nil {
+		t.Fatal("should error")
+	}
+}
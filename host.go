@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// hostAliases are the -osarch values that refer to the host platform.
+var hostAliases = map[string]struct{}{
+	"host":   {},
+	"native": {},
+}
+
+// HostPlatform returns the platform that gox treats as the machine it is
+// building on. This is used for the "host" and "native" -osarch aliases
+// and to decide when cgo is enabled by default.
+//
+// runtime.GOOS and runtime.GOARCH are wrong when gox itself runs under
+// emulation (an amd64 container on an arm64 runner, for example), so the
+// platform can be declared explicitly with override, which takes
+// precedence, or the GOX_HOST_PLATFORM environment variable.
+func HostPlatform(override string) (Platform, error) {
+	v := override
+	if v == "" {
+		v = os.Getenv("GOX_HOST_PLATFORM")
+	}
+	if v == "" {
+		return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}, nil
+	}
+
+	parts := strings.Split(strings.ToLower(v), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf(
+			"Invalid host platform syntax: %s should be os/arch", v)
+	}
+
+	return PlatformFromString(parts[0], parts[1]), nil
+}
+
+// ResolveHost replaces any "host" or "native" entries in the -osarch list
+// with the given host platform.
+func (p *PlatformFlag) ResolveHost(host Platform) {
+	result := make(appendPlatformValue, 0, len(p.OSArch))
+	for _, v := range p.OSArch {
+		name, negate := v.OS, false
+		if strings.HasPrefix(name, "!") {
+			name, negate = name[1:], true
+		}
+
+		if _, ok := hostAliases[name]; ok && v.Arch == "" {
+			v = host
+			v.Default = false
+			if negate {
+				v.OS = "!" + v.OS
+			}
+		}
+
+		result.appendIfMissing(&v)
+	}
+
+	p.OSArch = []Platform(result)
+}
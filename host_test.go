@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestHostPlatform(t *testing.T) {
+	defer os.Setenv("GOX_HOST_PLATFORM", os.Getenv("GOX_HOST_PLATFORM"))
+	os.Setenv("GOX_HOST_PLATFORM", "")
+
+	p, err := HostPlatform("")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.OS != runtime.GOOS || p.Arch != runtime.GOARCH {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	os.Setenv("GOX_HOST_PLATFORM", "linux/armv7")
+	p, err = HostPlatform("")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p, Platform{OS: "linux", Arch: "arm", ARM: "7"}) {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// The explicit override wins over the environment
+	p, err = HostPlatform("Linux/AMD64")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p, Platform{OS: "linux", Arch: "amd64"}) {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	if _, err := HostPlatform("linux"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestPlatformFlagResolveHost(t *testing.T) {
+	var f PlatformFlag
+	if err := f.OSArchFlagValue().Set("host !native linux/386 linux/amd64"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f.ResolveHost(Platform{OS: "linux", Arch: "amd64"})
+	expected := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "!linux", Arch: "amd64"},
+		{OS: "linux", Arch: "386"},
+	}
+	if !reflect.DeepEqual(f.OSArch, expected) {
+		t.Fatalf("bad: %#v", f.OSArch)
+	}
+}
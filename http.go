@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpTimeout is how long a request waits to connect, for the TLS
+// handshake and, except for workers, for the headers of the response.
+var httpTimeout = 30 * time.Second
+
+// httpClient makes the requests to Vault, forges and upload targets, so
+// that a server that stops answering fails the release rather than
+// hanging it. The timeouts are those of the transport rather than of the
+// whole request, since uploading a large artifact under -bandwidth-limit
+// can take far longer than any fixed timeout.
+var httpClient = &http.Client{Transport: newHTTPTransport(httpTimeout)}
+
+// remoteClient makes the requests to workers, which only answer a build
+// once it is done, so the response has no timeout. The keepalives of the
+// connection notice a worker that went away.
+var remoteClient = &http.Client{Transport: newHTTPTransport(0)}
+
+func newHTTPTransport(responseTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: httpTimeout, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   httpTimeout,
+		ResponseHeaderTimeout: responseTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   8,
+	}
+}
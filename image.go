@@ -0,0 +1,312 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// ImageTemplateData is the data available to label and annotation
+// templates of `gox image`.
+type ImageTemplateData struct {
+	Repo    string
+	Tag     string
+	Name    string
+	OS      string
+	Arch    string
+	Variant string
+	Date    string
+}
+
+// imageConfig is the subset of the OCI image configuration gox writes.
+type imageConfig struct {
+	Created      string `json:"created,omitempty"`
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+	Config       struct {
+		Env        []string          `json:"Env,omitempty"`
+		Entrypoint []string          `json:"Entrypoint,omitempty"`
+		Cmd        []string          `json:"Cmd,omitempty"`
+		WorkingDir string            `json:"WorkingDir,omitempty"`
+		User       string            `json:"User,omitempty"`
+		Labels     map[string]string `json:"Labels,omitempty"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ImageOpts are the options for building a single-platform image.
+type ImageOpts struct {
+	Ref         ImageRef
+	Binary      string
+	Platform    Platform
+	Labels      map[string]string
+	Annotations map[string]string
+	Created     time.Time
+
+	// Base is the base image to put the binary on top of, or nil for
+	// scratch. BaseClient is used to read its layers.
+	Base       *ImageRef
+	BaseClient *RegistryClient
+}
+
+// imageVariant returns the OCI platform variant for a Go platform.
+func imageVariant(p Platform) string {
+	switch p.Arch {
+	case "arm":
+		if p.ARM != "" {
+			return "v" + p.ARM
+		}
+		return "v7"
+	case "arm64":
+		return "v8"
+	case "amd64":
+		// OCI names amd64 variants by their GOAMD64 level
+		if p.Level != "" && p.Level != "v1" {
+			return p.Level
+		}
+	}
+
+	return ""
+}
+
+// PushImage builds the image for a single binary and pushes its blobs and
+// manifest to the registry. The returned descriptor can be added to an
+// index.
+func PushImage(c *RegistryClient, opts *ImageOpts) (*Descriptor, error) {
+	name := filepath.Base(opts.Binary)
+	variant := imageVariant(opts.Platform)
+
+	var config imageConfig
+	config.Config.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin"}
+	config.RootFS.Type = "layers"
+	var layers []Descriptor
+
+	// Start from the base image, if there is one
+	if opts.Base != nil {
+		baseLayers, baseConfig, err := pullBase(opts.BaseClient, opts.Base, opts.Platform, variant)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range baseLayers {
+			data, err := opts.BaseClient.GetBlob(opts.Base.Repository, l.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := c.PutBlob(opts.Ref.Repository, data); err != nil {
+				return nil, err
+			}
+			layers = append(layers, l)
+		}
+		config = *baseConfig
+	}
+
+	// The binary layer itself
+	layer, diffID, err := binaryLayer(opts.Binary, name, opts.Created)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := c.PutBlob(opts.Ref.Repository, layer)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, Descriptor{
+		MediaType: mediaTypeOCILayer,
+		Digest:    digest,
+		Size:      int64(len(layer)),
+	})
+
+	config.Created = opts.Created.UTC().Format(time.RFC3339)
+	config.OS = opts.Platform.OS
+	config.Architecture = opts.Platform.Arch
+	config.Variant = variant
+	config.Config.Entrypoint = []string{"/" + name}
+	config.Config.Cmd = nil
+	config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	if len(opts.Labels) > 0 {
+		if config.Config.Labels == nil {
+			config.Config.Labels = make(map[string]string)
+		}
+		for k, v := range opts.Labels {
+			config.Config.Labels[k] = v
+		}
+	}
+
+	configData, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	configDigest, err := c.PutBlob(opts.Ref.Repository, configData)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config: &Descriptor{
+			MediaType: mediaTypeOCIConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configData)),
+		},
+		Layers:      layers,
+		Annotations: opts.Annotations,
+	}
+	manifestData, err := json.Marshal(&manifest)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest := sha256Digest(manifestData)
+	if err := c.PutManifest(opts.Ref.Repository, manifestDigest, mediaTypeOCIManifest, manifestData); err != nil {
+		return nil, err
+	}
+
+	return &Descriptor{
+		MediaType: mediaTypeOCIManifest,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestData)),
+		Platform: &ImagePlatform{
+			OS:           opts.Platform.OS,
+			Architecture: opts.Platform.Arch,
+			Variant:      variant,
+		},
+	}, nil
+}
+
+// PushIndex pushes a multi-platform index of the given manifests under
+// the reference's tag.
+func PushIndex(c *RegistryClient, ref ImageRef, manifests []Descriptor, annotations map[string]string) (string, error) {
+	index := Manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIIndex,
+		Manifests:     manifests,
+		Annotations:   annotations,
+	}
+	data, err := json.Marshal(&index)
+	if err != nil {
+		return "", err
+	}
+	if err := c.PutManifest(ref.Repository, ref.Tag, mediaTypeOCIIndex, data); err != nil {
+		return "", err
+	}
+
+	return sha256Digest(data), nil
+}
+
+// pullBase resolves the base image manifest for the platform, returning
+// its layers and configuration.
+func pullBase(c *RegistryClient, ref *ImageRef, p Platform, variant string) ([]Descriptor, *imageConfig, error) {
+	m, _, err := c.GetManifest(ref.Repository, ref.Tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList {
+		var found *Descriptor
+		for i, d := range m.Manifests {
+			if d.Platform == nil || d.Platform.OS != p.OS || d.Platform.Architecture != p.Arch {
+				continue
+			}
+			if variant != "" && d.Platform.Variant != "" && d.Platform.Variant != variant {
+				continue
+			}
+			found = &m.Manifests[i]
+			break
+		}
+		if found == nil {
+			return nil, nil, fmt.Errorf("base image %s has no %s variant", ref, p.String())
+		}
+
+		if m, _, err = c.GetManifest(ref.Repository, found.Digest); err != nil {
+			return nil, nil, err
+		}
+	}
+	if m.Config == nil {
+		return nil, nil, fmt.Errorf("base image %s has no config", ref)
+	}
+
+	data, err := c.GetBlob(ref.Repository, m.Config.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	var config imageConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+
+	return m.Layers, &config, nil
+}
+
+// binaryLayer returns a gzipped tar layer containing the binary at /name,
+// along with the layer's diff ID (the digest of the uncompressed tar).
+func binaryLayer(path, name string, created time.Time) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0755,
+		Size:    int64(len(data)),
+		ModTime: created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, "", err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(tarBuf.Bytes())
+	diffID := "sha256:" + hex.EncodeToString(sum[:])
+
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	if _, err := gz.Write(tarBuf.Bytes()); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return gzBuf.Bytes(), diffID, nil
+}
+
+// renderImageTemplates renders each value in tpls as a text/template.
+func renderImageTemplates(tpls map[string]string, data *ImageTemplateData) (map[string]string, error) {
+	if len(tpls) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(tpls))
+	for k, v := range tpls {
+		tpl, err := template.New(k).Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		result[k] = buf.String()
+	}
+
+	return result, nil
+}
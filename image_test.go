@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseImageRef(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output ImageRef
+	}{
+		{"alpine", ImageRef{"registry-1.docker.io", "library/alpine", "latest"}},
+		{"mitchellh/gox:1.0", ImageRef{"registry-1.docker.io", "mitchellh/gox", "1.0"}},
+		{"ghcr.io/mitchellh/gox", ImageRef{"ghcr.io", "mitchellh/gox", "latest"}},
+		{"localhost:5000/gox:dev", ImageRef{"localhost:5000", "gox", "dev"}},
+		{"localhost/gox", ImageRef{"localhost", "gox", "latest"}},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseImageRef(tc.Input)
+		if err != nil {
+			t.Fatalf("input: %s\nerr: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Errorf("input: %s\nbad: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestImageVariant(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Variant  string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, ""},
+		{Platform{OS: "linux", Arch: "arm64"}, "v8"},
+		{Platform{OS: "linux", Arch: "arm", ARM: "6"}, "v6"},
+		{Platform{OS: "linux", Arch: "arm"}, "v7"},
+		{Platform{OS: "linux", Arch: "amd64", Level: "v3"}, "v3"},
+	}
+
+	for _, tc := range cases {
+		if actual := imageVariant(tc.Platform); actual != tc.Variant {
+			t.Errorf("%s: bad: %s", tc.Platform.String(), actual)
+		}
+	}
+}
+
+func TestParseBinaryInfo(t *testing.T) {
+	output := "/tmp/app: go1.18.3\n" +
+		"\tpath\tgithub.com/mitchellh/gox\n" +
+		"\tmod\tgithub.com/mitchellh/gox\t(devel)\t\n" +
+		"\tdep\tgithub.com/hashicorp/go-version\tv1.0.0\th1:abc=\n" +
+		"\tbuild\tGOARCH=arm\n" +
+		"\tbuild\tGOOS=linux\n" +
+		"\tbuild\tGOARM=6\n"
+
+	info, err := parseBinaryInfo(output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.GoVersion != "go1.18.3" || info.Path != "github.com/mitchellh/gox" {
+		t.Fatalf("bad: %#v", info)
+	}
+	if !reflect.DeepEqual(info.Deps, []string{"github.com/hashicorp/go-version v1.0.0"}) {
+		t.Fatalf("bad: %#v", info.Deps)
+	}
+
+	p, err := info.Platform()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p, Platform{OS: "linux", Arch: "arm", ARM: "6"}) {
+		t.Fatalf("bad: %#v", p)
+	}
+}
+
+func TestPushImage(t *testing.T) {
+	reg := newTestRegistry()
+	defer reg.Close()
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	bin := filepath.Join(td, "app")
+	if err := ioutil.WriteFile(bin, []byte("binary"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ref := ImageRef{Registry: reg.Host, Repository: "test/app", Tag: "1.0"}
+	c := NewRegistryClient(ref.Registry, RegistryAuth{}, true)
+	desc, err := PushImage(c, &ImageOpts{
+		Ref:      ref,
+		Binary:   bin,
+		Platform: Platform{OS: "linux", Arch: "arm64"},
+		Labels:   map[string]string{"foo": "bar"},
+		Created:  time.Unix(0, 0),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if desc.Platform.Variant != "v8" {
+		t.Fatalf("bad: %#v", desc.Platform)
+	}
+
+	if _, err := PushIndex(c, ref, []Descriptor{*desc}, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	m, _, err := c.GetManifest(ref.Repository, ref.Tag)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(m.Manifests) != 1 || m.Manifests[0].Digest != desc.Digest {
+		t.Fatalf("bad: %#v", m)
+	}
+
+	// config + binary layer + manifest + index
+	if len(reg.Blobs) != 2 || len(reg.Manifests) != 2 {
+		t.Fatalf("bad: %d blobs, %d manifests", len(reg.Blobs), len(reg.Manifests))
+	}
+}
+
+// testRegistry is an in-memory registry implementing just enough of the
+// distribution API for the tests.
+type testRegistry struct {
+	*httptest.Server
+	Host      string
+	Blobs     map[string][]byte
+	Manifests map[string][]byte
+
+	lock sync.Mutex
+}
+
+func newTestRegistry() *testRegistry {
+	r := &testRegistry{
+		Blobs:     make(map[string][]byte),
+		Manifests: make(map[string][]byte),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	r.Host = strings.TrimPrefix(r.Server.URL, "http://")
+	return r
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		if req.Method == "POST" {
+			w.Header().Set("Location", "/v2/upload/1")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	case strings.HasPrefix(path, "/v2/upload/"):
+		data, _ := ioutil.ReadAll(req.Body)
+		r.Blobs[req.URL.Query().Get("digest")] = data
+		w.WriteHeader(http.StatusCreated)
+		return
+	case strings.Contains(path, "/blobs/"):
+		data, ok := r.Blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+		return
+	case strings.Contains(path, "/manifests/"):
+		ref := path[strings.LastIndex(path, "/")+1:]
+		if req.Method == "PUT" {
+			data, _ := ioutil.ReadAll(req.Body)
+			r.Manifests[ref] = data
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		data, ok := r.Manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IncrementalState records the fingerprint of the inputs that each binary
+// was last built from, keyed by the path of the binary.
+type IncrementalState struct {
+	Targets map[string]string `json:"targets"`
+
+	lock sync.Mutex
+}
+
+// LoadIncrementalState reads the state file at path. A missing file is an
+// empty state, so that the first incremental run builds everything.
+func LoadIncrementalState(path string) (*IncrementalState, error) {
+	s := &IncrementalState{Targets: make(map[string]string)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if s.Targets == nil {
+		s.Targets = make(map[string]string)
+	}
+
+	return s, nil
+}
+
+// UpToDate reports whether the binary at output was last built from inputs
+// with the given fingerprint and still exists.
+func (s *IncrementalState) UpToDate(output, fingerprint string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Targets[output] != fingerprint {
+		return false
+	}
+
+	_, err := os.Stat(output)
+	return err == nil
+}
+
+// Set records that the binary at output was built from inputs with the
+// given fingerprint.
+func (s *IncrementalState) Set(output, fingerprint string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Targets[output] = fingerprint
+}
+
+// Save writes the state to path.
+func (s *IncrementalState) Save(path string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// listPackage is the subset of `go list -json` output we fingerprint.
+type listPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	DepOnly    bool
+	Module     *struct {
+		Path  string
+		GoMod string
+	}
+
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	MFiles     []string
+	HFiles     []string
+	FFiles     []string
+	SFiles     []string
+	SwigFiles  []string
+	SysoFiles  []string
+	EmbedFiles []string
+
+	TestGoFiles  []string
+	XTestGoFiles []string
+}
+
+// Fingerprint returns a hash of everything that goes into building opts
+// with the given version of Go: the build settings, the GOROOT and GOFLAGS
+// of the go command, and the contents of every source file of the package
+// and its dependencies outside of the standard library for the target
+// platform. The standard library is covered by the Go version.
+func (opts *CompileOpts) Fingerprint(goVersion string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "go %s %s\n", opts.GoCmd, goVersion)
+	if tc, err := LoadGoToolchain(opts.GoCmd); err == nil {
+		fmt.Fprintf(h, "goenv %s %q\n", tc.GOROOT, tc.GOFLAGS)
+	}
+	for _, e := range opts.buildEnv() {
+		fmt.Fprintf(h, "env %s\n", e)
+	}
+	fmt.Fprintf(h, "flags %q %q %q %q %q %q %t %t %t %t\n",
+		opts.Gcflags, opts.Ldflags, opts.Asmflags, opts.Tags, opts.ModMode,
+		opts.BuildMode, opts.Race, opts.Trimpath, opts.Strip, opts.SplitDebug)
+	fmt.Fprintf(h, "builder %s %s\n", opts.Builder, opts.BuilderImage)
+	fmt.Fprintf(h, "compiler %s\n", opts.Compiler)
+	fmt.Fprintf(h, "test %t\n", opts.Test)
+	fmt.Fprintf(h, "static %t\n", opts.Static)
+	fmt.Fprintf(h, "pgo %s\n", opts.PGO)
+	fmt.Fprintf(h, "garble %s %q %s\n", opts.Garble, opts.GarbleFlags, opts.GarbleSeed)
+	if opts.BuildID != "" {
+		fmt.Fprintf(h, "buildid %s\n", opts.BuildID)
+	}
+	if filepath.IsAbs(opts.PGO) {
+		if err := hashFile(h, opts.PGO); err != nil {
+			return "", err
+		}
+	}
+	if opts.Overlay != "" {
+		if err := hashOverlay(h, opts.Overlay); err != nil {
+			return "", err
+		}
+	}
+
+	pkgs, err := opts.listDeps()
+	if err != nil {
+		return "", err
+	}
+	goMods := make(map[string]struct{})
+	for _, p := range pkgs {
+		if p.Module != nil && p.Module.GoMod != "" {
+			goMods[p.Module.GoMod] = struct{}{}
+		}
+
+		fmt.Fprintf(h, "package %s\n", p.ImportPath)
+
+		// -pgo=auto uses the default.pgo of the main package
+		if opts.PGO == "auto" && !p.DepOnly {
+			if _, err := os.Stat(filepath.Join(p.Dir, "default.pgo")); err == nil {
+				if err := hashFile(h, filepath.Join(p.Dir, "default.pgo")); err != nil {
+					return "", err
+				}
+			}
+		}
+		for _, f := range opts.sourceFiles(p) {
+			if err := hashFile(h, filepath.Join(p.Dir, f)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// go.mod decides the language version and replacements, among others
+	mods := make([]string, 0, len(goMods))
+	for m := range goMods {
+		mods = append(mods, m)
+	}
+	sort.Strings(mods)
+	for _, m := range mods {
+		if err := hashFile(h, m); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listDeps lists the package of opts and its dependencies outside of the
+// standard library for the target platform, with `go list -deps`.
+func (opts *CompileOpts) listDeps() ([]listPackage, error) {
+	chdir, pkg := splitPackagePath(opts.PackagePath)
+	if pkg == "" {
+		pkg = "."
+	}
+	args := []string{"list", "-deps", "-json", "-tags", opts.buildTags()}
+	if opts.ModMode != "" {
+		args = append(args, "-mod", opts.ModMode)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay", opts.Overlay)
+	}
+	if opts.Test {
+		args = append(args, "-test")
+	}
+	args = append(args, pkg)
+	output, err := execGo(opts.GoCmd, append(os.Environ(), opts.buildEnv()...), chdir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []listPackage
+	dec := json.NewDecoder(strings.NewReader(output))
+	for {
+		var p listPackage
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !p.Standard {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, nil
+}
+
+// sourceFiles returns the files of p that go into the build, relative to
+// the directory of p.
+func (opts *CompileOpts) sourceFiles(p listPackage) []string {
+	lists := [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles,
+		p.MFiles, p.HFiles, p.FFiles, p.SFiles, p.SwigFiles, p.SysoFiles,
+		p.EmbedFiles}
+	if opts.Test {
+		lists = append(lists, p.TestGoFiles, p.XTestGoFiles)
+	}
+	var result []string
+	for _, files := range lists {
+		for _, f := range files {
+			// The main of a test binary is generated into the build
+			// cache from the test files, which are hashed already
+			if !filepath.IsAbs(f) {
+				result = append(result, f)
+			}
+		}
+	}
+	return result
+}
+
+// hashFile writes the name and contents of the file at path to h.
+func hashFile(h io.Writer, path string) error {
+	return hashFileAs(h, path, path)
+}
+
+// hashFileAs writes the contents of the file at path to h under name.
+func hashFileAs(h io.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(h, "file %s\n", name)
+	_, err = io.Copy(h, f)
+	return err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncrementalState(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	statePath := filepath.Join(td, "state.json")
+	s, err := LoadIncrementalState(statePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	output := filepath.Join(td, "app")
+	s.Set(output, "abc")
+	if s.UpToDate(output, "abc") {
+		t.Fatal("missing binary should not be up to date")
+	}
+	if err := ioutil.WriteFile(output, []byte("bin"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := s.Save(statePath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s, err = LoadIncrementalState(statePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !s.UpToDate(output, "abc") {
+		t.Fatalf("bad: %#v", s.Targets)
+	}
+	if s.UpToDate(output, "def") {
+		t.Fatal("changed fingerprint should not be up to date")
+	}
+}
+
+func TestCompileOptsFingerprint(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.17\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	fingerprint := func(opts CompileOpts) string {
+		opts.PackagePath = "example.com/app"
+		opts.GoCmd = "go"
+		fp, err := opts.Fingerprint("go1.17")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return fp
+	}
+
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	base := fingerprint(CompileOpts{Platform: linux})
+	if fp := fingerprint(CompileOpts{Platform: linux}); fp != base {
+		t.Fatal("fingerprint should be stable")
+	}
+	if fp := fingerprint(CompileOpts{Platform: Platform{OS: "linux", Arch: "arm64"}}); fp == base {
+		t.Fatal("platform should change the fingerprint")
+	}
+	if fp := fingerprint(CompileOpts{Platform: linux, Ldflags: "-s"}); fp == base {
+		t.Fatal("ldflags should change the fingerprint")
+	}
+
+	write("main.go", "package main\n\nfunc main() { println() }\n")
+	if fp := fingerprint(CompileOpts{Platform: linux}); fp == base {
+		t.Fatal("source should change the fingerprint")
+	}
+
+	// Tests only change the fingerprint of test binaries
+	base = fingerprint(CompileOpts{Platform: linux})
+	test := fingerprint(CompileOpts{Platform: linux, Test: true})
+	if test == base {
+		t.Fatal("-test should change the fingerprint")
+	}
+	write("main_test.go", "package main\n\nimport \"testing\"\n\nfunc TestMain(t *testing.T) {}\n")
+	if fp := fingerprint(CompileOpts{Platform: linux}); fp != base {
+		t.Fatal("tests should not change the fingerprint")
+	}
+	if fp := fingerprint(CompileOpts{Platform: linux, Test: true}); fp == test {
+		t.Fatal("tests should change the test fingerprint")
+	}
+
+	// The contents of profiles count too
+	base = fingerprint(CompileOpts{Platform: linux})
+	write("cpu.pprof", "one")
+	pgo := fingerprint(CompileOpts{Platform: linux, PGO: filepath.Join(td, "cpu.pprof")})
+	if pgo == base {
+		t.Fatal("-pgo should change the fingerprint")
+	}
+	write("cpu.pprof", "two")
+	if fp := fingerprint(CompileOpts{Platform: linux, PGO: filepath.Join(td, "cpu.pprof")}); fp == pgo {
+		t.Fatal("the profile should change the fingerprint")
+	}
+	auto := fingerprint(CompileOpts{Platform: linux, PGO: "auto"})
+	write("default.pgo", "three")
+	if fp := fingerprint(CompileOpts{Platform: linux, PGO: "auto"}); fp == auto {
+		t.Fatal("default.pgo should change the fingerprint")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// initConfig is the config file written by `gox init`. It holds only the
+// sections the templates fill in, in the order they are read.
+type initConfig struct {
+	OSArch    []string                  `json:"osarch"`
+	Packages  map[string]*PackageConfig `json:"packages,omitempty"`
+	Archives  *ArchiveConfig            `json:"archives,omitempty"`
+	Checksums *ChecksumConfig           `json:"checksums,omitempty"`
+	Nfpm      *NfpmConfig               `json:"nfpm,omitempty"`
+}
+
+// initTemplate is a release shape that `gox init` can write a config for.
+// Config returns the config for the project name, and any files it
+// refers to that should be written with it.
+type initTemplate struct {
+	Description string
+	Config      func(name string) (*initConfig, map[string]string)
+}
+
+var initTemplates = map[string]initTemplate{
+	"cli": {
+		Description: "A command line tool for every common platform",
+		Config:      initCLI,
+	},
+	"service": {
+		Description: "A linux daemon with a systemd unit, as deb and rpm packages",
+		Config:      initService,
+	},
+	"terraform-provider": {
+		Description: "A Terraform provider, laid out for the Terraform registry",
+		Config:      initTerraformProvider,
+	},
+	"kubectl-plugin": {
+		Description: "A kubectl plugin, laid out for krew",
+		Config:      initKubectlPlugin,
+	},
+}
+
+func initCLI(name string) (*initConfig, map[string]string) {
+	return &initConfig{
+		OSArch: []string{
+			"darwin/amd64", "darwin/arm64",
+			"freebsd/amd64",
+			"linux/386", "linux/amd64", "linux/arm64", "linux/armv7",
+			"windows/386", "windows/amd64", "windows/arm64",
+		},
+		Archives: &ArchiveConfig{
+			Name:            "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}",
+			Format:          "tar.gz",
+			FormatOverrides: map[string]string{"windows": "zip"},
+			Output:          "dist",
+		},
+		Checksums: &ChecksumConfig{Name: name + "_{{.Version}}_checksums.txt"},
+	}, nil
+}
+
+func initService(name string) (*initConfig, map[string]string) {
+	unit := "packaging/" + name + ".service"
+	return &initConfig{
+		OSArch: []string{"linux/amd64", "linux/arm64"},
+		Archives: &ArchiveConfig{
+			Name:   "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}",
+			Format: "tar.gz",
+			Output: "dist",
+		},
+		Checksums: &ChecksumConfig{Name: name + "_{{.Version}}_checksums.txt"},
+		Nfpm: &NfpmConfig{
+			Version:      "0.1.0",
+			Description:  "The " + name + " service",
+			Formats:      []string{"deb", "rpm"},
+			Output:       "dist",
+			SystemdUnits: []string{unit},
+		},
+	}, map[string]string{
+		unit: fmt.Sprintf(serviceUnitTpl, name, name),
+	}
+}
+
+// serviceUnitTpl is the systemd unit of the service template.
+const serviceUnitTpl = `[Unit]
+Description=%s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=/usr/bin/%s
+Restart=on-failure
+DynamicUser=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// initTerraformProvider follows the registry's requirements for provider
+// releases: zip archives named terraform-provider-NAME_VERSION_OS_ARCH
+// using plain GOARCH values, and a matching SHA256SUMS file.
+func initTerraformProvider(name string) (*initConfig, map[string]string) {
+	provider := "terraform-provider-" + strings.TrimPrefix(name, "terraform-provider-")
+	return &initConfig{
+		OSArch: []string{
+			"darwin/amd64", "darwin/arm64",
+			"freebsd/386", "freebsd/amd64", "freebsd/armv6", "freebsd/arm64",
+			"linux/386", "linux/amd64", "linux/armv6", "linux/arm64",
+			"windows/386", "windows/amd64", "windows/arm64",
+		},
+		Archives: &ArchiveConfig{
+			Name:   provider + "_{{.Version}}_{{.OS}}_{{.GOARCH}}",
+			Binary: provider + "_v{{.Version}}",
+			Format: "zip",
+			Output: "dist",
+		},
+		Checksums: &ChecksumConfig{Name: provider + "_{{.Version}}_SHA256SUMS"},
+	}, nil
+}
+
+// initKubectlPlugin follows krew's conventions: the binary is named
+// kubectl-NAME, and every platform gets a .tar.gz that a krew manifest
+// can point to with its sha256.
+func initKubectlPlugin(name string) (*initConfig, map[string]string) {
+	plugin := "kubectl-" + strings.TrimPrefix(name, "kubectl-")
+	return &initConfig{
+		OSArch: []string{
+			"darwin/amd64", "darwin/arm64",
+			"linux/amd64", "linux/arm64",
+			"windows/amd64",
+		},
+		Archives: &ArchiveConfig{
+			Name:   plugin + "_{{.Version}}_{{.OS}}_{{.Arch}}",
+			Binary: plugin,
+			Format: "tar.gz",
+			Output: "dist",
+		},
+		Checksums: &ChecksumConfig{Name: plugin + "_{{.Version}}_checksums.txt"},
+	}, nil
+}
+
+func initTemplateNames() []string {
+	names := make([]string, 0, len(initTemplates))
+	for name := range initTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
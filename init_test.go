@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInitTemplates(t *testing.T) {
+	for _, name := range initTemplateNames() {
+		config, _ := initTemplates[name].Config("app")
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		var c Config
+		if err := json.Unmarshal(data, &c); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if len(c.OSArch) == 0 || c.Archives == nil || c.Checksums == nil {
+			t.Fatalf("%s: bad: %#v", name, c)
+		}
+	}
+}
+
+func TestInitTerraformProvider(t *testing.T) {
+	config, _ := initTerraformProvider("terraform-provider-example")
+	if config.Archives.Name != "terraform-provider-example_{{.Version}}_{{.OS}}_{{.GOARCH}}" {
+		t.Fatalf("bad: %s", config.Archives.Name)
+	}
+	if config.Checksums.Name != "terraform-provider-example_{{.Version}}_SHA256SUMS" {
+		t.Fatalf("bad: %s", config.Checksums.Name)
+	}
+}
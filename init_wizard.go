@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// goreleaserFiles are the names that goreleaser reads its config from.
+var goreleaserFiles = []string{".goreleaser.yml", ".goreleaser.yaml", "goreleaser.yml", "goreleaser.yaml"}
+
+// goreleaserProjectRe matches the project_name of a goreleaser config.
+var goreleaserProjectRe = regexp.MustCompile(`(?m)^project_name:\s*["']?([^"'\s#]+)`)
+
+// initInspection is what `gox init -interactive` finds out about the
+// module before it asks anything.
+type initInspection struct {
+	// Name is the project name, from the goreleaser config if there is
+	// one, or else as for -name.
+	Name string
+
+	// Mains are the import paths of the main packages, and Cgo those of
+	// them that depend on cgo outside of the standard library.
+	Mains []string
+	Cgo   []string
+
+	// Host is the platform of the machine, Goreleaser the path of a
+	// goreleaser config, if any.
+	Host       string
+	Goreleaser string
+}
+
+// inspectModule inspects the module in the current directory with the go
+// command.
+func inspectModule(goCmd string) *initInspection {
+	insp := &initInspection{Name: projectName()}
+	if host, err := HostPlatform(""); err == nil {
+		insp.Host = host.String()
+	}
+
+	for _, f := range goreleaserFiles {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		insp.Goreleaser = f
+		if m := goreleaserProjectRe.FindSubmatch(data); m != nil {
+			insp.Name = string(m[1])
+		}
+		break
+	}
+
+	insp.Mains, _ = GoMainDirs([]string{"./..."}, goCmd)
+	for _, main := range insp.Mains {
+		output, err := execGo(goCmd, nil, "", "list", "-deps",
+			"-f", "{{if and .CgoFiles (not .Standard)}}{{.ImportPath}}{{end}}", main)
+		if err == nil && strings.TrimSpace(output) != "" {
+			insp.Cgo = append(insp.Cgo, main)
+		}
+	}
+	return insp
+}
+
+// initPrompter asks the questions of `gox init -interactive`. At the end
+// of the input every question takes its default.
+type initPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask asks question and returns the answer, or def if there is none.
+func (p *initPrompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(p.out)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// choose asks question until the answer is one of choices.
+func (p *initPrompter) choose(question string, choices []string, def string) string {
+	question = fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", "))
+	for {
+		answer := p.ask(question, def)
+		for _, c := range choices {
+			if answer == c {
+				return answer
+			}
+		}
+		fmt.Fprintf(p.out, "Please answer one of: %s\n", strings.Join(choices, ", "))
+	}
+}
+
+// confirm asks a yes or no question.
+func (p *initPrompter) confirm(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		switch strings.ToLower(p.ask(question+" ("+choices+")", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// initWizard asks about the release of the module inspected as insp and
+// returns its config, and the files it refers to, as a template does.
+func initWizard(in io.Reader, out io.Writer, insp *initInspection) (*initConfig, map[string]string) {
+	p := &initPrompter{in: bufio.NewReader(in), out: out}
+
+	if insp.Goreleaser != "" {
+		fmt.Fprintf(out, "--> Found %s, using its project name (\"gox import goreleaser\" translates its builds)\n", insp.Goreleaser)
+	}
+	switch len(insp.Mains) {
+	case 0:
+		fmt.Fprintf(out, "--> No main packages found\n")
+	default:
+		fmt.Fprintf(out, "--> Main packages: %s\n", strings.Join(insp.Mains, ", "))
+	}
+	fmt.Fprintln(out)
+
+	name := p.ask("Project name", insp.Name)
+	kind := "cli"
+	switch {
+	case strings.HasPrefix(name, "terraform-provider-"):
+		kind = "terraform-provider"
+	case strings.HasPrefix(name, "kubectl-"):
+		kind = "kubectl-plugin"
+	}
+	kind = p.choose("Kind of release", initTemplateNames(), kind)
+	config, files := initTemplates[kind].Config(name)
+
+	// Cross-compiling cgo needs a C toolchain for every platform
+	if len(insp.Cgo) > 0 && insp.Host != "" {
+		fmt.Fprintf(out, "--> %s use cgo, which needs a C cross compiler for each platform (see \"gox doctor -cgo\")\n",
+			strings.Join(insp.Cgo, ", "))
+		if p.confirm("Only build for this machine, "+insp.Host+"?", true) {
+			config.OSArch = []string{insp.Host}
+		}
+	}
+	config.OSArch = strings.Fields(p.ask("Platforms", strings.Join(config.OSArch, " ")))
+
+	format := p.choose("Archive format", []string{"tar.gz", "zip", "tar"}, config.Archives.Format)
+	if format != config.Archives.Format {
+		config.Archives.Format = format
+		delete(config.Archives.FormatOverrides, "windows")
+		if format != "zip" && p.confirm("Use zip for windows?", true) {
+			config.Archives.FormatOverrides = map[string]string{"windows": "zip"}
+		}
+	}
+	config.Archives.Output = p.ask("Archive directory", config.Archives.Output)
+
+	// The binaries go in a directory of their own next to the archives
+	output := p.ask("Output path template", path.Join(config.Archives.Output, "{{.Dir}}_{{.OS}}_{{.Arch}}", "{{.Dir}}"))
+	if len(insp.Mains) > 0 {
+		config.Packages = make(map[string]*PackageConfig)
+		for _, main := range insp.Mains {
+			config.Packages[main] = &PackageConfig{Output: output}
+		}
+	}
+
+	return config, files
+}
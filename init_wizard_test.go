@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitWizard(t *testing.T) {
+	insp := &initInspection{
+		Name:  "myapp",
+		Mains: []string{"example.com/myapp/cmd/myapp"},
+		Host:  "linux/amd64",
+	}
+
+	// Every default is taken at the end of the input
+	var out bytes.Buffer
+	config, _ := initWizard(strings.NewReader(""), &out, insp)
+	cli, _ := initCLI("myapp")
+	if !reflect.DeepEqual(config.OSArch, cli.OSArch) || config.Archives.Format != "tar.gz" ||
+		config.Archives.FormatOverrides["windows"] != "zip" ||
+		config.Packages["example.com/myapp/cmd/myapp"].Output != "dist/{{.Dir}}_{{.OS}}_{{.Arch}}/{{.Dir}}" {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	answers := strings.Join([]string{
+		"terraform-provider-example", // name
+		"",                           // kind, guessed from the name
+		"linux/amd64 darwin/arm64",   // platforms
+		"rar",                        // not a format
+		"tar.gz",                     // format
+		"n",                          // no zip for windows
+		"out",                        // archive directory
+		"",                           // output template
+	}, "\n")
+	out.Reset()
+	config, _ = initWizard(strings.NewReader(answers), &out, insp)
+	if !reflect.DeepEqual(config.OSArch, []string{"linux/amd64", "darwin/arm64"}) ||
+		!strings.HasPrefix(config.Archives.Name, "terraform-provider-example_") ||
+		config.Archives.Format != "tar.gz" || len(config.Archives.FormatOverrides) != 0 ||
+		config.Archives.Output != "out" ||
+		config.Packages["example.com/myapp/cmd/myapp"].Output != "out/{{.Dir}}_{{.OS}}_{{.Arch}}/{{.Dir}}" {
+		t.Fatalf("bad: %#v", config.Archives)
+	}
+	if !strings.Contains(out.String(), "Please answer one of") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestInitWizard_cgo(t *testing.T) {
+	insp := &initInspection{
+		Name:  "myapp",
+		Mains: []string{"example.com/myapp"},
+		Cgo:   []string{"example.com/myapp"},
+		Host:  "darwin/arm64",
+	}
+
+	var out bytes.Buffer
+	config, _ := initWizard(strings.NewReader("\n\n\n"), &out, insp)
+	if !reflect.DeepEqual(config.OSArch, []string{"darwin/arm64"}) {
+		t.Fatalf("bad: %#v", config.OSArch)
+	}
+	if !strings.Contains(out.String(), "use cgo") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestGoreleaserProjectRe(t *testing.T) {
+	m := goreleaserProjectRe.FindStringSubmatch("version: 2\nproject_name: \"example\" # the name\nbuilds:\n")
+	if m == nil || m[1] != "example" {
+		t.Fatalf("bad: %#v", m)
+	}
+}
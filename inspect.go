@@ -0,0 +1,292 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Inspection is what `gox inspect` reads from a binary: its format and
+// architecture from its header, what it is dynamically linked against,
+// how its size splits up between its sections, and the build info that Go
+// recorded in it.
+type Inspection struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Arch   string `json:"arch,omitempty"`
+	Size   int64  `json:"size"`
+
+	// Sizes is the size of the kinds of sections, in the order of
+	// sectionKinds, and "other" for the headers and the rest of the file.
+	Sizes []SectionSize `json:"sizes,omitempty"`
+
+	// Libraries are the shared libraries the binary needs, and
+	// Interpreter the dynamic linker of ELF binaries.
+	Libraries   []string `json:"libraries"`
+	Interpreter string   `json:"interpreter,omitempty"`
+
+	// The build info, which binaries that Go didn't build have none of.
+	GoVersion string            `json:"go_version,omitempty"`
+	Package   string            `json:"package,omitempty"`
+	Module    string            `json:"module,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+	Deps      []string          `json:"deps,omitempty"`
+
+	// BuildID is the build ID of -build-id, if it has one.
+	BuildID *BuildID `json:"build_id,omitempty"`
+}
+
+// SectionSize is how many bytes of a binary are of a kind of section.
+type SectionSize struct {
+	Kind string `json:"kind"`
+	Size int64  `json:"size"`
+}
+
+// sectionKinds are what Inspection sizes sum sections up as, in order.
+var sectionKinds = []string{"code", "rodata", "pclntab", "data", "debug", "symbols"}
+
+// sectionKind returns which of sectionKinds the section of the name is,
+// or "other". Mach-O sections start with "__" rather than ".".
+func sectionKind(name string) string {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "."), "__")
+	switch {
+	case strings.HasPrefix(name, "debug_"), strings.HasPrefix(name, "zdebug_"):
+		return "debug"
+	case name == "gopclntab":
+		return "pclntab"
+	case strings.HasPrefix(name, "text"), name == "plt", name == "init", name == "fini", name == "stubs":
+		return "code"
+	case name == "rodata", name == "rdata", name == "typelink", name == "itablink",
+		name == "gosymtab", name == "go.buildinfo", name == "go.fipsinfo", name == "cstring", name == "const":
+		return "rodata"
+	case name == "data", name == "noptrdata", name == "got", name == "go.plt",
+		strings.HasPrefix(name, "data.rel.ro"), name == "nl_symbol_ptr", name == "la_symbol_ptr":
+		return "data"
+	case name == "symtab", name == "strtab", name == "dynsym", name == "dynstr":
+		return "symbols"
+	}
+	return "other"
+}
+
+// InspectBinary inspects the binary at path, reading its build info with
+// goCmd.
+func InspectBinary(goCmd, path string) (*Inspection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	i := &Inspection{Path: path, Format: binaryFormat(magic), Size: info.Size()}
+	sizes := make(map[string]int64)
+	switch i.Format {
+	case "ELF":
+		err = i.inspectELF(f, sizes)
+	case "PE":
+		err = i.inspectPE(f, sizes)
+	case "Mach-O":
+		err = i.inspectMachO(f, sizes)
+	case "WebAssembly":
+		i.Arch = "wasm"
+	default:
+		// A universal binary of darwin has a Mach-O for each architecture
+		ff, fatErr := macho.NewFatFile(f)
+		if fatErr != nil {
+			return nil, fmt.Errorf("%s is not an ELF, PE, Mach-O or WebAssembly binary", path)
+		}
+		i.Format = "Mach-O universal"
+		var archs []string
+		for _, a := range ff.Arches {
+			i.inspectMachOFile(a.File, sizes)
+			archs = append(archs, i.Arch)
+		}
+		i.Arch = strings.Join(archs, " ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(sizes) > 0 {
+		other := i.Size
+		for _, kind := range sectionKinds {
+			if sizes[kind] > 0 {
+				i.Sizes = append(i.Sizes, SectionSize{kind, sizes[kind]})
+				other -= sizes[kind]
+			}
+		}
+		if other > 0 {
+			i.Sizes = append(i.Sizes, SectionSize{"other", other})
+		}
+	}
+	sort.Strings(i.Libraries)
+	if i.Libraries == nil {
+		i.Libraries = []string{}
+	}
+
+	// Binaries that aren't Go's, or are C archives, have no build info
+	if bi, err := GoBinaryInfo(goCmd, path); err == nil {
+		i.GoVersion = bi.GoVersion
+		i.Package = bi.Path
+		i.Module = bi.Main
+		i.Settings = bi.Settings
+		i.Deps = bi.Deps
+	}
+	if id, _, err := ReadBuildID(path); err == nil {
+		i.BuildID = id
+	}
+
+	return i, nil
+}
+
+func (i *Inspection) inspectELF(f io.ReaderAt, sizes map[string]int64) error {
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return err
+	}
+	i.Arch = ef.Machine.String()
+	for goarch, a := range elfArchs {
+		if ef.Machine == a.Machine && ef.Class == a.Class && ef.ByteOrder == a.Order {
+			i.Arch = goarch
+		}
+	}
+
+	for _, s := range ef.Sections {
+		if s.Type != elf.SHT_NOBITS && s.Type != elf.SHT_NULL {
+			sizes[sectionKind(s.Name)] += int64(s.FileSize)
+		}
+	}
+	for _, p := range ef.Progs {
+		if p.Type == elf.PT_INTERP {
+			data, _ := ioutil.ReadAll(p.Open())
+			i.Interpreter = strings.TrimRight(string(data), "\x00")
+		}
+	}
+	i.Libraries, _ = ef.ImportedLibraries()
+	return nil
+}
+
+func (i *Inspection) inspectPE(f io.ReaderAt, sizes map[string]int64) error {
+	pf, err := pe.NewFile(f)
+	if err != nil {
+		return err
+	}
+	i.Arch = fmt.Sprintf("%#x", pf.Machine)
+	for goarch, m := range peMachines {
+		if pf.Machine == m {
+			i.Arch = goarch
+		}
+	}
+
+	for _, s := range pf.Sections {
+		sizes[sectionKind(s.Name)] += int64(s.Size)
+	}
+	i.Libraries, _ = pf.ImportedLibraries()
+	return nil
+}
+
+func (i *Inspection) inspectMachO(f io.ReaderAt, sizes map[string]int64) error {
+	mf, err := macho.NewFile(f)
+	if err != nil {
+		return err
+	}
+	i.inspectMachOFile(mf, sizes)
+	return nil
+}
+
+func (i *Inspection) inspectMachOFile(mf *macho.File, sizes map[string]int64) {
+	i.Arch = mf.Cpu.String()
+	for goarch, cpu := range machoCpus {
+		if mf.Cpu == cpu {
+			i.Arch = goarch
+		}
+	}
+
+	for _, s := range mf.Sections {
+		// Zero-filled sections, such as __bss, take no room in the file
+		if s.Offset != 0 {
+			sizes[sectionKind(s.Name)] += int64(s.Size)
+		}
+	}
+	libs, _ := mf.ImportedLibraries()
+	for _, lib := range libs {
+		found := false
+		for _, l := range i.Libraries {
+			found = found || l == lib
+		}
+		if !found {
+			i.Libraries = append(i.Libraries, lib)
+		}
+	}
+}
+
+// InspectArtifact inspects the binary at path, or the binaries in it if
+// it is a .tar.gz, .tar or .zip archive, which are named after the
+// archive and their path in it.
+func InspectArtifact(goCmd, path string) ([]*Inspection, error) {
+	var extract func(string, string) error
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		extract = extractBundle
+	case strings.HasSuffix(path, ".tar"):
+		extract = func(path, dir string) error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return extractTar(f, path, dir)
+		}
+	case strings.HasSuffix(path, ".zip"):
+		extract = extractZip
+	default:
+		i, err := InspectBinary(goCmd, path)
+		if err != nil {
+			return nil, err
+		}
+		return []*Inspection{i}, nil
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(td)
+	if err := extract(path, td); err != nil {
+		return nil, err
+	}
+
+	var result []*Inspection
+	err = filepath.Walk(td, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		i, err := InspectBinary(goCmd, p)
+		if err != nil {
+			// Archives have READMEs and licenses too
+			return nil
+		}
+		rel, _ := filepath.Rel(td, p)
+		i.Path = path + "!" + filepath.ToSlash(rel)
+		result = append(result, i)
+		return nil
+	})
+	if err == nil && len(result) == 0 {
+		err = fmt.Errorf("%s has no binaries in it", path)
+	}
+	return result, err
+}
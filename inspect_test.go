@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"debug/macho"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSectionKind(t *testing.T) {
+	cases := map[string]string{
+		".text":            "code",
+		"__text":           "code",
+		".gopclntab":       "pclntab",
+		"__gopclntab":      "pclntab",
+		".rdata":           "rodata",
+		".noptrdata":       "data",
+		".debug_info":      "debug",
+		"__zdebug_line":    "debug",
+		".symtab":          "symbols",
+		".note.go.buildid": "other",
+	}
+	for name, expected := range cases {
+		if actual := sectionKind(name); actual != expected {
+			t.Fatalf("%s: bad: %s", name, actual)
+		}
+	}
+}
+
+func TestInspectArtifact(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	ioutil.WriteFile(filepath.Join(td, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n"), 0644)
+	ioutil.WriteFile(filepath.Join(td, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+
+	build := func(goos, goarch string) string {
+		output := filepath.Join(td, goos+"_"+goarch)
+		cmd := exec.Command("go", "build", "-o", output, ".")
+		cmd.Dir = td
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("err: %s\n%s", err, out)
+		}
+		return output
+	}
+
+	cases := []struct {
+		GOOS, GOARCH string
+		Format       string
+	}{
+		{"linux", "arm64", "ELF"},
+		{"windows", "386", "PE"},
+		{"darwin", "arm64", "Mach-O"},
+	}
+	for _, tc := range cases {
+		path := build(tc.GOOS, tc.GOARCH)
+		result, err := InspectArtifact("go", path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+		i := result[0]
+		if len(result) != 1 || i.Format != tc.Format || i.Arch != tc.GOARCH {
+			t.Fatalf("%s: bad: %#v", path, i)
+		}
+		if i.Settings["GOOS"] != tc.GOOS || i.Package != "example.com/app" || i.GoVersion == "" {
+			t.Fatalf("%s: bad: %#v", path, i)
+		}
+		if tc.GOOS != "darwin" && len(i.Libraries) != 0 {
+			t.Fatalf("%s: bad: %#v", path, i.Libraries)
+		}
+		var total int64
+		for _, s := range i.Sizes {
+			total += s.Size
+		}
+		if total != i.Size || i.Sizes[0].Kind != "code" {
+			t.Fatalf("%s: bad: %#v", path, i.Sizes)
+		}
+	}
+
+	// The binaries of archives are inspected, and the rest is skipped
+	archive := filepath.Join(td, "app.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("README.md")
+	w.Write([]byte("# app\n"))
+	w, _ = zw.Create("bin/app")
+	data, _ := ioutil.ReadFile(filepath.Join(td, "linux_arm64"))
+	w.Write(data)
+	zw.Close()
+	f.Close()
+
+	result, err := InspectArtifact("go", archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(result) != 1 || result[0].Path != archive+"!bin/app" || result[0].Arch != "arm64" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Universal binaries have each of their architectures
+	amd64, arm64 := filepath.Join(td, "amd64"), filepath.Join(td, "arm64")
+	testMachO(t, amd64, macho.CpuAmd64)
+	testMachO(t, arm64, macho.CpuArm64)
+	universal := filepath.Join(td, "universal")
+	if err := MakeUniversal(universal, amd64, arm64); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result, err = InspectArtifact("go", universal)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result[0].Format != "Mach-O universal" || result[0].Arch != "amd64 arm64" || result[0].GoVersion != "" {
+		t.Fatalf("bad: %#v", result[0])
+	}
+
+	if _, err := InspectArtifact("go", filepath.Join(td, "go.mod")); err == nil {
+		t.Fatal("should error")
+	}
+}
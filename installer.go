@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// InstallerConfig is the "installer" section of the config file. It
+// describes the installers made for each binary: an MSI for windows
+// binaries, built from WiX source with wixl (from msitools) or another
+// WiX compiler that takes the same arguments, and a DMG of darwin
+// binaries, made with hdiutil.
+type InstallerConfig struct {
+	// Name is the product name, defaults to the name of the binary.
+	// Version defaults to the release version.
+	Name         string `json:"name,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+
+	// Output is the directory installers are written to, defaults to the
+	// directory of each binary.
+	Output string `json:"output,omitempty"`
+
+	MSI *MSIConfig `json:"msi,omitempty"`
+	DMG *DMGConfig `json:"dmg,omitempty"`
+}
+
+// MSIConfig is how MSIs are built.
+type MSIConfig struct {
+	// Command is the WiX compiler, defaults to "wixl".
+	Command string `json:"command,omitempty"`
+
+	// UpgradeCode is the GUID that every version of the product shares,
+	// so that installing one upgrades another.
+	UpgradeCode string `json:"upgrade_code"`
+
+	// AddToPath adds the install directory to the system PATH.
+	AddToPath bool `json:"add_to_path,omitempty"`
+}
+
+// DMGConfig is how DMGs are made.
+type DMGConfig struct {
+	// Command is hdiutil by default. VolumeName defaults to the product
+	// name.
+	Command    string `json:"command,omitempty"`
+	VolumeName string `json:"volume_name,omitempty"`
+}
+
+// guidRe matches a GUID, with or without braces.
+var guidRe = regexp.MustCompile(`^\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?$`)
+
+// msiArches are the arches that MSIs are built for, with the Platform of
+// their package and their Program Files folder.
+var msiArches = map[string][2]string{
+	"386":   {"x86", "ProgramFilesFolder"},
+	"amd64": {"x64", "ProgramFiles64Folder"},
+}
+
+// Validate checks that an msi has a manufacturer and an upgrade code, and
+// that a dmg can be made on this host.
+func (c *InstallerConfig) Validate() error {
+	if c.MSI != nil {
+		if c.Manufacturer == "" {
+			return fmt.Errorf("installer: manufacturer is required for msi")
+		}
+		if !guidRe.MatchString(c.MSI.UpgradeCode) {
+			return fmt.Errorf("installer: msi upgrade_code must be a GUID")
+		}
+	}
+	if c.DMG != nil && c.DMG.Command == "" && runtime.GOOS != "darwin" {
+		return fmt.Errorf("installer: making a dmg with hdiutil requires a macOS host")
+	}
+
+	return nil
+}
+
+func (c *InstallerConfig) name(binary string) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strings.TrimSuffix(filepath.Base(binary), filepath.Ext(binary))
+}
+
+func (c *InstallerConfig) target(binary string, platform Platform, version, ext string) (string, error) {
+	dir := c.Output
+	if dir == "" {
+		dir = filepath.Dir(binary)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s_%s_%s_%s.%s",
+		c.name(binary), version, platform.OS, platform.GetArch(), ext)), nil
+}
+
+// msiVersion returns the ProductVersion of version, which must be
+// numeric and can't be more than major.minor.build.
+func msiVersion(v string) (string, error) {
+	parsed, err := version.NewVersion(v)
+	if err != nil {
+		return "", fmt.Errorf("MSIs need a numeric version, not %q", v)
+	}
+	s := parsed.Segments()
+	return fmt.Sprintf("%d.%d.%d", s[0], s[1], s[2]), nil
+}
+
+// wxsTpl is the WiX source of an MSI that installs one binary into
+// Program Files.
+const wxsTpl = `<?xml version="1.0" encoding="utf-8"?>
+<Wix xmlns="http://schemas.microsoft.com/wix/2006/wi">
+  <Product Id="*" Name="{{xml .Name}}" Language="1033" Version="{{.Version}}" Manufacturer="{{xml .Manufacturer}}" UpgradeCode="{{.UpgradeCode}}">
+    <Package InstallerVersion="200" Compressed="yes" InstallScope="perMachine" Platform="{{.Platform}}"/>
+    <MajorUpgrade DowngradeErrorMessage="A newer version of {{xml .Name}} is already installed."/>
+    <Media Id="1" Cabinet="product.cab" EmbedCab="yes"/>
+    <Directory Id="TARGETDIR" Name="SourceDir">
+      <Directory Id="{{.ProgramFiles}}">
+        <Directory Id="INSTALLDIR" Name="{{xml .Name}}">
+          <Component Id="Binary" Guid="*"{{if eq .Platform "x64"}} Win64="yes"{{end}}>
+            <File Id="Binary" Name="{{xml .File}}" Source="{{xml .Source}}" KeyPath="yes"/>
+{{- if .AddToPath}}
+            <Environment Id="Path" Name="PATH" Value="[INSTALLDIR]" Action="set" Part="last" System="yes" Permanent="no"/>
+{{- end}}
+          </Component>
+        </Directory>
+      </Directory>
+    </Directory>
+    <Feature Id="Main" Level="1">
+      <ComponentRef Id="Binary"/>
+    </Feature>
+  </Product>
+</Wix>
+`
+
+// wxs returns the WiX source of the MSI of binary.
+func (c *InstallerConfig) wxs(binary string, platform Platform, v string) ([]byte, error) {
+	arch, ok := msiArches[platform.Arch]
+	if !ok {
+		return nil, fmt.Errorf("MSIs can't be built for %s", platform.String())
+	}
+	productVersion, err := msiVersion(v)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := template.New("wxs").Funcs(template.FuncMap{
+		"xml": func(s string) (string, error) {
+			var buf bytes.Buffer
+			err := xml.EscapeText(&buf, []byte(s))
+			return buf.String(), err
+		},
+	}).Parse(wxsTpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, map[string]interface{}{
+		"Name":         c.name(binary),
+		"Version":      productVersion,
+		"Manufacturer": c.Manufacturer,
+		"UpgradeCode":  strings.Trim(c.MSI.UpgradeCode, "{}"),
+		"Platform":     arch[0],
+		"ProgramFiles": arch[1],
+		"File":         filepath.Base(binary),
+		"Source":       binary,
+		"AddToPath":    c.MSI.AddToPath,
+	})
+	return buf.Bytes(), err
+}
+
+// BuildMSI builds the MSI of a windows binary and returns its path.
+func BuildMSI(c *InstallerConfig, binary string, platform Platform, version string) (string, error) {
+	if c.Version != "" {
+		version = c.Version
+	}
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.wxs(abs, platform, version)
+	if err != nil {
+		return "", err
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(td)
+	wxsPath := filepath.Join(td, "product.wxs")
+	if err := ioutil.WriteFile(wxsPath, data, 0644); err != nil {
+		return "", err
+	}
+
+	target, err := c.target(binary, platform, version, "msi")
+	if err != nil {
+		return "", err
+	}
+	cmd := c.MSI.Command
+	if cmd == "" {
+		cmd = "wixl"
+	}
+	if _, err := execGo(cmd, nil, "", "--arch", msiArches[platform.Arch][0], "-o", target, wxsPath); err != nil {
+		return "", fmt.Errorf("%s failed: %s", cmd, strings.TrimSpace(err.Error()))
+	}
+
+	return target, nil
+}
+
+// BuildDMG makes a compressed DMG with the darwin binary in it and
+// returns its path.
+func BuildDMG(c *InstallerConfig, binary string, platform Platform, version string) (string, error) {
+	if c.Version != "" {
+		version = c.Version
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(td)
+	if err := copyFile(binary, filepath.Join(td, filepath.Base(binary)), 0755); err != nil {
+		return "", err
+	}
+
+	target, err := c.target(binary, platform, version, "dmg")
+	if err != nil {
+		return "", err
+	}
+	volume := c.DMG.VolumeName
+	if volume == "" {
+		volume = c.name(binary)
+	}
+	cmd := c.DMG.Command
+	if cmd == "" {
+		cmd = "hdiutil"
+	}
+	if _, err := execGo(cmd, nil, "", "create", "-volname", volume, "-srcfolder", td,
+		"-ov", "-format", "UDZO", target); err != nil {
+		return "", fmt.Errorf("%s failed: %s", cmd, strings.TrimSpace(err.Error()))
+	}
+
+	return target, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMsiVersion(t *testing.T) {
+	cases := []struct {
+		Version  string
+		Expected string
+		Err      bool
+	}{
+		{"1.2.3", "1.2.3", false},
+		{"1.2", "1.2.0", false},
+		{"1.2.3-4-gdeadbee", "1.2.3", false},
+		{"deadbee", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := msiVersion(tc.Version)
+		if (err != nil) != tc.Err || actual != tc.Expected {
+			t.Fatalf("%s: bad: %s %s", tc.Version, actual, err)
+		}
+	}
+}
+
+func TestInstallerConfigWxs(t *testing.T) {
+	c := &InstallerConfig{
+		Manufacturer: "Smith & Sons",
+		MSI:          &MSIConfig{UpgradeCode: "{5A1B7C4E-3D2F-4E6A-9B8C-1D2E3F4A5B6C}", AddToPath: true},
+	}
+	data, err := c.wxs("/dist/windows_amd64/mytool.exe", Platform{OS: "windows", Arch: "amd64"}, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// It must be well formed XML
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		if _, err := d.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("err: %s\n%s", err, data)
+			}
+			break
+		}
+	}
+
+	for _, expected := range []string{
+		`Name="mytool" Language="1033" Version="1.2.3" Manufacturer="Smith &amp; Sons" UpgradeCode="5A1B7C4E-3D2F-4E6A-9B8C-1D2E3F4A5B6C"`,
+		`Platform="x64"`,
+		`<Directory Id="ProgramFiles64Folder">`,
+		`<File Id="Binary" Name="mytool.exe" Source="/dist/windows_amd64/mytool.exe" KeyPath="yes"/>`,
+		`<Environment Id="Path" Name="PATH" Value="[INSTALLDIR]"`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, data)
+		}
+	}
+
+	if _, err := c.wxs("mytool.exe", Platform{OS: "windows", Arch: "arm64"}, "1.2.3"); err == nil {
+		t.Fatal("should error")
+	}
+}
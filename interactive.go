@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/iochan"
+)
+
+// progressInterval is how often the progress view of -interactive is
+// redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progressPaneLines is how many lines of output the progress view shows
+// under a failed build, and progressLiveLines under a running one.
+const (
+	progressPaneLines = 8
+	progressLiveLines = 2
+)
+
+// spinnerFrames are drawn in turn next to the builds that are running.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stty runs stty on the terminal of stdin and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// terminalSize returns the rows and columns of the terminal, or 24 by 80
+// if they can't be read.
+func terminalSize() (int, int) {
+	var rows, cols int
+	if size, err := stty("size"); err == nil {
+		fmt.Sscanf(size, "%d %d", &rows, &cols)
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// captureStdout points os.Stdout at a pipe and calls fn with each line
+// written to it, so that what is printed can be drawn around a display
+// that is redrawn in place. The returned function gives stdout back, and
+// returns once every line has been handled.
+func captureStdout(fn func(line string)) (func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for line := range iochan.DelimReader(r, '\n') {
+			fn(strings.TrimSuffix(line, "\n"))
+		}
+	}()
+
+	return func() {
+		os.Stdout = stdout
+		w.Close()
+		<-doneCh
+	}, nil
+}
+
+// truncateLine cuts line down to width characters, so that it doesn't
+// wrap and throw off the lines that are redrawn.
+func truncateLine(line string, width int) string {
+	r := []rune(line)
+	if width <= 0 || len(r) <= width {
+		return line
+	}
+	if strings.Contains(line, "\x1b[") {
+		return string(r[:width-1]) + "…\x1b[0m"
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// platformPicker is the checklist of -interactive that platforms are
+// picked from.
+type platformPicker struct {
+	Platforms []Platform
+	Selected  []bool
+	Initial   []bool
+	Cursor    int
+	Top       int
+}
+
+// newPlatformPicker returns a picker of all, with selected checked. The
+// selected platforms that aren't in all, such as those with a level, are
+// added to the end.
+func newPlatformPicker(all, selected []Platform) *platformPicker {
+	p := &platformPicker{Platforms: append([]Platform{}, all...)}
+	p.Selected = make([]bool, len(p.Platforms))
+	for _, s := range selected {
+		found := false
+		for i, a := range p.Platforms {
+			if a.String() == s.String() {
+				p.Selected[i], found = true, true
+			}
+		}
+		if !found {
+			p.Platforms = append(p.Platforms, s)
+			p.Selected = append(p.Selected, true)
+		}
+	}
+	p.Initial = append([]bool{}, p.Selected...)
+	return p
+}
+
+// key handles a key press. It returns true once the picker is done, and
+// whether the platforms were confirmed rather than the picker quit.
+func (p *platformPicker) key(k string) (bool, bool) {
+	switch k {
+	case "\x1b[A", "k":
+		if p.Cursor > 0 {
+			p.Cursor--
+		}
+	case "\x1b[B", "j":
+		if p.Cursor < len(p.Platforms)-1 {
+			p.Cursor++
+		}
+	case " ", "x":
+		p.Selected[p.Cursor] = !p.Selected[p.Cursor]
+	case "a", "n":
+		for i := range p.Selected {
+			p.Selected[i] = k == "a"
+		}
+	case "d":
+		copy(p.Selected, p.Initial)
+	case "\r", "\n":
+		if len(p.picked()) > 0 {
+			return true, true
+		}
+	case "q", "\x1b", "\x03", "\x04":
+		return true, false
+	}
+
+	return false, false
+}
+
+// picked returns the checked platforms.
+func (p *platformPicker) picked() []Platform {
+	var result []Platform
+	for i, platform := range p.Platforms {
+		if p.Selected[i] {
+			result = append(result, platform)
+		}
+	}
+	return result
+}
+
+// render draws the picker to fit in height rows, scrolling the list to
+// keep the cursor on screen.
+func (p *platformPicker) render(w io.Writer, height int) {
+	rows := height - 4
+	if rows < 1 {
+		rows = 1
+	}
+	if p.Cursor < p.Top {
+		p.Top = p.Cursor
+	}
+	if p.Cursor >= p.Top+rows {
+		p.Top = p.Cursor - rows + 1
+	}
+
+	fmt.Fprintf(w, "Platforms to build: space toggles, a/n/d selects all/none/defaults, enter builds, q quits\n\n")
+	for i := p.Top; i < len(p.Platforms) && i < p.Top+rows; i++ {
+		cursor, check := " ", " "
+		if i == p.Cursor {
+			cursor = ">"
+		}
+		if p.Selected[i] {
+			check = "x"
+		}
+		fmt.Fprintf(w, "%s [%s] %s\n", cursor, check, p.Platforms[i].String())
+	}
+	fmt.Fprintf(w, "\n%d of %d selected", len(p.picked()), len(p.Platforms))
+}
+
+// PickPlatforms shows the checklist of all on the terminal, with selected
+// checked, and returns the platforms that were picked, or nil if it was
+// quit.
+func PickPlatforms(in io.Reader, out io.Writer, all, selected []Platform) ([]Platform, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("-interactive needs stty to read keys: %s", err)
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, fmt.Errorf("-interactive needs stty to read keys: %s", err)
+	}
+	defer stty(saved)
+
+	// The checklist is drawn on the alternate screen, so that it is gone
+	// once the builds start.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	p := newPlatformPicker(all, selected)
+	buf := make([]byte, 16)
+	for {
+		rows, _ := terminalSize()
+		fmt.Fprint(out, "\x1b[H\x1b[2J")
+		p.render(out, rows)
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if done, ok := p.key(string(buf[:n])); done {
+			if !ok {
+				return nil, nil
+			}
+			return p.picked(), nil
+		}
+	}
+}
+
+type progressState int
+
+const (
+	progressQueued progressState = iota
+	progressRunning
+	progressBuilt
+	progressUpToDate
+	progressFailed
+)
+
+// progressRow is a build in the progress view.
+type progressRow struct {
+	Name     string
+	State    progressState
+	Start    time.Time
+	Duration time.Duration
+
+	// Output is the last lines of the build's output while it runs, and
+	// of its error once it failed.
+	Output  []string
+	partial string
+}
+
+// ProgressView is the live view of the builds of -interactive: a line
+// for each build with a spinner while it runs and its duration once it is
+// done, and the end of the error of each one that failed. Anything else
+// printed to stdout while it runs is printed above it.
+type ProgressView struct {
+	Out    io.Writer
+	Rows   []*progressRow
+	Width  int
+	Height int
+	Color  bool
+
+	lock    sync.Mutex
+	start   time.Time
+	frame   int
+	drawn   int
+	logs    []string
+	restore func()
+	doneCh  chan struct{}
+	stopCh  chan struct{}
+}
+
+// NewProgressView returns a view of builds with the given names, in the
+// order that they are given.
+func NewProgressView(names []string) *ProgressView {
+	v := &ProgressView{}
+	for _, name := range names {
+		v.Rows = append(v.Rows, &progressRow{Name: name})
+	}
+	return v
+}
+
+// Run starts drawing the view to stdout, and takes over stdout until Stop
+// is called.
+func (v *ProgressView) Run() error {
+	if v.Out == nil {
+		v.Out = os.Stdout
+	}
+	if v.Height == 0 {
+		v.Height, v.Width = terminalSize()
+	}
+	restore, err := captureStdout(func(line string) {
+		v.lock.Lock()
+		v.logs = append(v.logs, line)
+		v.lock.Unlock()
+	})
+	if err != nil {
+		return err
+	}
+	v.start = time.Now()
+	v.restore = restore
+	v.doneCh = make(chan struct{})
+	v.stopCh = make(chan struct{})
+
+	go func() {
+		defer close(v.doneCh)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				v.lock.Lock()
+				v.frame++
+				v.draw(false)
+				v.lock.Unlock()
+			case <-v.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop gives stdout back and draws the view a last time, in full.
+func (v *ProgressView) Stop() {
+	v.restore()
+	close(v.stopCh)
+	<-v.doneCh
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.draw(true)
+}
+
+// Started marks build i as running.
+func (v *ProgressView) Started(i int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.Rows[i].State = progressRunning
+	v.Rows[i].Start = time.Now()
+}
+
+// Finished marks build i as done with result.
+func (v *ProgressView) Finished(i int, result BuildResult) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	row := v.Rows[i]
+	row.Duration = result.Duration
+	row.Output = nil
+	switch {
+	case result.Err != nil:
+		row.State = progressFailed
+		row.Output = tailLines(strings.Split(strings.TrimSpace(result.Err.Error()), "\n"), progressPaneLines)
+	case result.UpToDate:
+		row.State = progressUpToDate
+	default:
+		row.State = progressBuilt
+	}
+}
+
+// Writer returns a writer for the output of build i, the end of which is
+// shown under it while it runs.
+func (v *ProgressView) Writer(i int) io.Writer {
+	return &progressWriter{View: v, Row: v.Rows[i]}
+}
+
+type progressWriter struct {
+	View *ProgressView
+	Row  *progressRow
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.View.lock.Lock()
+	defer w.View.lock.Unlock()
+
+	lines := strings.Split(w.Row.partial+string(p), "\n")
+	w.Row.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if line = strings.TrimSpace(line); line != "" {
+			w.Row.Output = tailLines(append(w.Row.Output, line), progressLiveLines)
+		}
+	}
+	return len(p), nil
+}
+
+func tailLines(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// lines returns the lines of the view. Unless final, builds that are done
+// are folded into one line when the view doesn't fit on the terminal.
+func (v *ProgressView) lines(final bool, now time.Time) []string {
+	var lines []string
+	var built, upToDate, failed, done int
+	for _, row := range v.Rows {
+		switch row.State {
+		case progressBuilt:
+			built++
+		case progressUpToDate:
+			upToDate++
+		case progressFailed:
+			failed++
+		}
+	}
+	done = built + upToDate + failed
+
+	fold := false
+	if !final && v.Height > 0 {
+		count := 2
+		for _, row := range v.Rows {
+			count += 1 + len(row.Output)
+		}
+		fold = count > v.Height-1
+	}
+	if fold && built+upToDate > 0 {
+		lines = append(lines, fmt.Sprintf("  %s %d built, %d up to date", v.paint("\x1b[32m", "✓"), built, upToDate))
+	}
+
+	for _, row := range v.Rows {
+		var line string
+		switch row.State {
+		case progressQueued:
+			line = "  " + v.paint("\x1b[2m", "· "+row.Name)
+		case progressRunning:
+			line = fmt.Sprintf("  %s %s  %s", v.paint("\x1b[36m", spinnerFrames[v.frame%len(spinnerFrames)]),
+				row.Name, now.Sub(row.Start).Round(100*time.Millisecond))
+		case progressBuilt:
+			line = fmt.Sprintf("  %s %s  %s", v.paint("\x1b[32m", "✓"), row.Name, row.Duration.Round(100*time.Millisecond))
+		case progressUpToDate:
+			line = fmt.Sprintf("  %s %s  up to date", v.paint("\x1b[32m", "✓"), row.Name)
+		case progressFailed:
+			line = fmt.Sprintf("  %s %s  %s", v.paint("\x1b[31m", "✗"), row.Name, row.Duration.Round(100*time.Millisecond))
+		}
+		if fold && (row.State == progressBuilt || row.State == progressUpToDate) {
+			continue
+		}
+		lines = append(lines, line)
+		for _, output := range row.Output {
+			lines = append(lines, "    "+v.paint("\x1b[2m", "│")+" "+output)
+		}
+	}
+
+	summary := fmt.Sprintf("%d/%d done", done, len(v.Rows))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	lines = append(lines, "", fmt.Sprintf("%s in %s", summary, now.Sub(v.start).Round(100*time.Millisecond)))
+
+	// Whatever still doesn't fit is cut from the top
+	if !final && v.Height > 1 && len(lines) > v.Height-1 {
+		lines = lines[len(lines)-(v.Height-1):]
+	}
+	for i, line := range lines {
+		lines[i] = truncateLine(line, v.Width)
+	}
+	return lines
+}
+
+// paint colors s with the ANSI color code, unless the view has no color.
+func (v *ProgressView) paint(code, s string) string {
+	return colorize(v.Color, code, s)
+}
+
+// draw redraws the view in place, below the lines printed since the last
+// time. The lock must be held.
+func (v *ProgressView) draw(final bool) {
+	var b bytes.Buffer
+	if v.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", v.drawn)
+	}
+	b.WriteString("\r\x1b[J")
+	for _, line := range v.logs {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	v.logs = nil
+
+	lines := v.lines(final, time.Now())
+	for _, line := range lines {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	v.drawn = len(lines)
+	v.Out.Write(b.Bytes())
+}
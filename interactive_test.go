@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlatformPicker(t *testing.T) {
+	all := []Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "windows", Arch: "amd64"},
+	}
+	p := newPlatformPicker(all, []Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "amd64", Level: "v3"}})
+	if len(p.Platforms) != 4 {
+		t.Fatalf("bad: %#v", p.Platforms)
+	}
+
+	for _, k := range []string{" ", "\x1b[B", "\x1b[B", "x", "k", " "} {
+		if done, _ := p.key(k); done {
+			t.Fatalf("done after %q", k)
+		}
+	}
+	expected := []Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "windows", Arch: "amd64"},
+		{OS: "linux", Arch: "amd64", Level: "v3"},
+	}
+	if actual := p.picked(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Nothing picked can't be built
+	p.key("n")
+	if done, _ := p.key("\r"); done {
+		t.Fatal("done with nothing picked")
+	}
+	p.key("d")
+	if done, ok := p.key("\r"); !done || !ok {
+		t.Fatal("should be done")
+	}
+	if actual := p.picked(); len(actual) != 2 {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if done, ok := p.key("q"); !done || ok {
+		t.Fatal("should be quit")
+	}
+}
+
+func TestPlatformPicker_scroll(t *testing.T) {
+	var all []Platform
+	for _, arch := range []string{"386", "amd64", "arm", "arm64", "mips", "ppc64", "riscv64", "s390x"} {
+		all = append(all, Platform{OS: "linux", Arch: arch})
+	}
+	p := newPlatformPicker(all, nil)
+	for i := 0; i < 6; i++ {
+		p.key("j")
+	}
+
+	var b strings.Builder
+	p.render(&b, 7)
+	output := b.String()
+	if !strings.Contains(output, "> [ ] linux/riscv64") || strings.Contains(output, "linux/arm64") {
+		t.Fatalf("bad: %s", output)
+	}
+}
+
+func TestProgressView(t *testing.T) {
+	v := NewProgressView([]string{"linux/amd64 ./a", "linux/arm64 ./a", "windows/amd64 ./a", "darwin/arm64 ./a"})
+	v.Color = true
+	now := time.Now()
+	v.start = now.Add(-3 * time.Second)
+
+	v.Started(0)
+	v.Rows[0].Start = now.Add(-time.Second)
+	v.Writer(0).Write([]byte("one\ntwo\nthree\npart"))
+	v.Started(1)
+	v.Finished(1, BuildResult{Duration: 2 * time.Second})
+	v.Started(2)
+	v.Finished(2, BuildResult{Duration: time.Second, Err: errors.New("exit status 1\nStderr: main.go:3: oops")})
+
+	lines := v.lines(false, now)
+	expected := []string{
+		"  \x1b[36m⠋\x1b[0m linux/amd64 ./a  1s",
+		"    \x1b[2m│\x1b[0m two",
+		"    \x1b[2m│\x1b[0m three",
+		"  \x1b[32m✓\x1b[0m linux/arm64 ./a  2s",
+		"  \x1b[31m✗\x1b[0m windows/amd64 ./a  1s",
+		"    \x1b[2m│\x1b[0m exit status 1",
+		"    \x1b[2m│\x1b[0m Stderr: main.go:3: oops",
+		"  \x1b[2m· darwin/arm64 ./a\x1b[0m",
+		"",
+		"2/4 done, 1 failed in 3s",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("bad: %#v", lines)
+	}
+
+	// Builds that are done are folded when it doesn't fit
+	v.Started(3)
+	v.Finished(3, BuildResult{UpToDate: true})
+	v.Height = 10
+	lines = v.lines(false, now)
+	if lines[0] != "  \x1b[32m✓\x1b[0m 1 built, 1 up to date" || len(lines) != 9 {
+		t.Fatalf("bad: %#v", lines)
+	}
+	if lines = v.lines(true, now); len(lines) != len(expected) {
+		t.Fatalf("bad: %#v", lines)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// iosDefaultVersion is the default -ios-version, the oldest version of iOS
+// that the libraries are built to run on.
+const iosDefaultVersion = "12.0"
+
+// iosSDKs are the Xcode SDKs of the ios ports, by arch: arm64 is built for
+// devices, and amd64 for the simulator.
+var iosSDKs = map[string]string{
+	"arm64": "iphoneos",
+	"amd64": "iphonesimulator",
+}
+
+// xcodeSDK is an SDK of Xcode and the clang that builds with it.
+type xcodeSDK struct {
+	Name  string
+	Path  string
+	Clang string
+}
+
+// FindXcodeSDK asks xcrun for the SDK and clang that platform, an ios
+// port, is built with.
+func FindXcodeSDK(platform Platform) (*xcodeSDK, error) {
+	name, ok := iosSDKs[platform.Arch]
+	if !ok {
+		return nil, fmt.Errorf("Xcode has no SDK for %s", platform.String())
+	}
+
+	xcrun := func(args ...string) (string, error) {
+		output, err := exec.Command("xcrun", append([]string{"--sdk", name}, args...)...).Output()
+		if err != nil {
+			return "", fmt.Errorf("xcrun --sdk %s %s: %s", name, strings.Join(args, " "), err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+	path, err := xcrun("--show-sdk-path")
+	if err != nil {
+		return nil, err
+	}
+	clang, err := xcrun("--find", "clang")
+	if err != nil {
+		return nil, err
+	}
+
+	return &xcodeSDK{Name: name, Path: path, Clang: clang}, nil
+}
+
+// cgoEnv returns the environment that cgo builds for platform with the
+// SDK: its clang, and the flags for its sysroot, the arch and the oldest
+// iOS version to run on, after those of the user's CGO_ flags.
+func (s *xcodeSDK) cgoEnv(platform Platform, minVersion string) []string {
+	arch := platform.Arch
+	if arch == "amd64" {
+		arch = "x86_64"
+	}
+	target := "-miphoneos-version-min="
+	if s.Name == "iphonesimulator" {
+		target = "-mios-simulator-version-min="
+	}
+	flags := fmt.Sprintf("-isysroot %s -arch %s %s%s", s.Path, arch, target, minVersion)
+
+	env := []string{"CC=" + s.Clang, "CXX=" + s.Clang + "++"}
+	for _, key := range []string{"CGO_CFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS"} {
+		// Go builds C with -O2 -g unless the flags are set
+		user := os.Getenv(key)
+		if user == "" && key != "CGO_LDFLAGS" {
+			user = "-O2 -g"
+		}
+		env = append(env, key+"="+strings.TrimSpace(user+" "+flags))
+	}
+	return env
+}
+
+// platformBuildMode returns the -buildmode of the builds for platform.
+// ios apps can't run a Go binary, only embed a library, so ios builds are
+// static libraries unless another mode is asked for.
+func platformBuildMode(mode string, platform Platform, test bool) string {
+	if mode == "" && !test && platform.OS == "ios" {
+		return "c-archive"
+	}
+	return mode
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestXcodeSDKCgoEnv(t *testing.T) {
+	for _, key := range []string{"CGO_CFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+	os.Setenv("CGO_CFLAGS", "-O3")
+
+	sdk := &xcodeSDK{Name: "iphonesimulator", Path: "/sdk", Clang: "/bin/clang"}
+	actual := sdk.cgoEnv(Platform{OS: "ios", Arch: "amd64"}, "13.0")
+	expected := []string{
+		"CC=/bin/clang",
+		"CXX=/bin/clang++",
+		"CGO_CFLAGS=-O3 -isysroot /sdk -arch x86_64 -mios-simulator-version-min=13.0",
+		"CGO_CXXFLAGS=-O2 -g -isysroot /sdk -arch x86_64 -mios-simulator-version-min=13.0",
+		"CGO_LDFLAGS=-isysroot /sdk -arch x86_64 -mios-simulator-version-min=13.0",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	sdk = &xcodeSDK{Name: "iphoneos", Path: "/sdk", Clang: "/bin/clang"}
+	opts := &CompileOpts{
+		Platform:   Platform{OS: "ios", Arch: "arm64"},
+		IOSSDK:     sdk,
+		IOSVersion: "12.0",
+	}
+	found := false
+	for _, e := range opts.buildEnv() {
+		found = found || e == "CGO_LDFLAGS=-isysroot /sdk -arch arm64 -miphoneos-version-min=12.0"
+	}
+	if !found || !opts.Cgo {
+		t.Fatalf("bad: %#v", opts.buildEnv())
+	}
+}
+
+func TestPlatformBuildMode(t *testing.T) {
+	ios := Platform{OS: "ios", Arch: "arm64"}
+	cases := []struct {
+		Mode     string
+		Platform Platform
+		Test     bool
+		Expected string
+	}{
+		{"", ios, false, "c-archive"},
+		{"c-shared", ios, false, "c-shared"},
+		{"", ios, true, ""},
+		{"", Platform{OS: "darwin", Arch: "arm64"}, false, ""},
+	}
+	for _, tc := range cases {
+		if v := platformBuildMode(tc.Mode, tc.Platform, tc.Test); v != tc.Expected {
+			t.Fatalf("bad: %#v: %s", tc, v)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// LatestLink points link, the path of a binary without its version, at
+// the binary at target, so that download endpoints can use a name that
+// doesn't change between releases. It is a relative symlink, or a copy on
+// Windows and where symlinks can't be made.
+func LatestLink(link, target string) error {
+	if link == target {
+		return fmt.Errorf("%s is the binary itself, leave {{.Version}} out of -latest-link", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if runtime.GOOS != "windows" {
+		rel, err := filepath.Rel(filepath.Dir(link), target)
+		if err == nil && os.Symlink(rel, link) == nil {
+			return nil
+		}
+	}
+	return copyFile(target, link, 0755)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLatestLink(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	target := filepath.Join(td, "app_1.2.3_linux_amd64")
+	if err := ioutil.WriteFile(target, []byte("v1"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	link := filepath.Join(td, "app_linux_amd64")
+	if err := LatestLink(link, target); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if runtime.GOOS != "windows" {
+		if dest, err := os.Readlink(link); err != nil || dest != "app_1.2.3_linux_amd64" {
+			t.Fatalf("bad: %s %v", dest, err)
+		}
+	}
+
+	// A new release replaces the link
+	next := filepath.Join(td, "app_1.2.4_linux_amd64")
+	if err := ioutil.WriteFile(next, []byte("v2"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := LatestLink(link, next); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if data, err := ioutil.ReadFile(link); err != nil || string(data) != "v2" {
+		t.Fatalf("bad: %q %v", data, err)
+	}
+
+	if err := LatestLink(next, next); err == nil {
+		t.Fatal("should error")
+	}
+}
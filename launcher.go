@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// LauncherData is the data for rendering launcher scripts.
+type LauncherData struct {
+	// Name is the name of the binary being launched.
+	Name string
+
+	// Path is the path to the binary for a platform, relative to the
+	// directory the script is in. It may refer to the os and arch as
+	// $os and $arch in shell and PowerShell launchers, and to the arch as
+	// %arch% in cmd launchers, where the os is always windows.
+	Path string
+}
+
+// renderLauncher renders one of the launcher script templates.
+func renderLauncher(tpl string, data *LauncherData) ([]byte, error) {
+	t, err := template.New("launcher").Parse(tpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shLauncherTpl is a POSIX shell script that maps uname output to a GOOS
+// and GOARCH and executes the matching binary. ARM machines fall back to
+// older GOARM versions since those run on newer hardware.
+const shLauncherTpl = `#!/bin/sh
+# Generated by gox. Runs the {{.Name}} binary for this machine.
+dir=$(cd "$(dirname "$0")" && pwd)
+
+os=$(uname -s | tr '[:upper:]' '[:lower:]')
+case "$os" in
+  sunos) os=solaris ;;
+  mingw*|msys*|cygwin*) os=windows ;;
+esac
+
+machine=$(uname -m)
+case "$machine" in
+  x86_64|amd64) archs="amd64" ;;
+  i?86|x86) archs="386" ;;
+  aarch64|arm64) archs="arm64" ;;
+  armv7*) archs="armv7 armv6 armv5 arm" ;;
+  armv6*) archs="armv6 armv5 arm" ;;
+  armv5*|arm) archs="armv5 arm" ;;
+  *) archs="$machine" ;;
+esac
+
+for arch in $archs; do
+  bin="$dir/{{.Path}}"
+  if [ -x "$bin" ]; then
+    exec "$bin" "$@"
+  elif [ -x "$bin.exe" ]; then
+    exec "$bin.exe" "$@"
+  fi
+done
+
+echo "{{.Name}}: no binary for $os/$machine" >&2
+exit 1
+`
+
+// cmdLauncherTpl is the Windows batch equivalent of shLauncherTpl.
+const cmdLauncherTpl = `@echo off
+rem Generated by gox. Runs the {{.Name}} binary for this machine.
+setlocal
+set "arch=%PROCESSOR_ARCHITECTURE%"
+if defined PROCESSOR_ARCHITEW6432 set "arch=%PROCESSOR_ARCHITEW6432%"
+if /i "%arch%"=="AMD64" set "arch=amd64"
+if /i "%arch%"=="ARM64" set "arch=arm64"
+if /i "%arch%"=="x86" set "arch=386"
+set "bin=%~dp0{{.Path}}.exe"
+if not exist "%bin%" (
+  echo {{.Name}}: no binary for windows/%arch% 1>&2
+  exit /b 1
+)
+"%bin%" %*
+exit /b %errorlevel%
+`
+
+// ps1LauncherTpl is the PowerShell equivalent of shLauncherTpl. It works
+// with both Windows PowerShell and PowerShell on other platforms.
+const ps1LauncherTpl = `# Generated by gox. Runs the {{.Name}} binary for this machine.
+$dir = Split-Path -Parent $MyInvocation.MyCommand.Path
+
+if ($PSVersionTable.PSVersion.Major -lt 6 -or $IsWindows) { $os = "windows" }
+elseif ($IsMacOS) { $os = "darwin" }
+elseif ($IsLinux) { $os = "linux" }
+else { $os = (uname -s).ToLower() }
+
+try {
+  $machine = [System.Runtime.InteropServices.RuntimeInformation]::OSArchitecture.ToString()
+} catch {
+  $machine = $env:PROCESSOR_ARCHITECTURE
+}
+switch -regex ($machine) {
+  '^(X64|AMD64)$' { $archs = @("amd64"); break }
+  '^X86$' { $archs = @("386"); break }
+  '^(Arm64|ARM64)$' { $archs = @("arm64"); break }
+  '^Arm$' { $archs = @("armv7", "armv6", "armv5", "arm"); break }
+  default { $archs = @($machine.ToLower()) }
+}
+
+foreach ($arch in $archs) {
+  $bin = Join-Path $dir "{{.Path}}"
+  foreach ($candidate in @($bin, "$bin.exe")) {
+    if (Test-Path $candidate -PathType Leaf) {
+      & $candidate @args
+      exit $LASTEXITCODE
+    }
+  }
+}
+
+Write-Error "{{.Name}}: no binary for $os/$machine"
+exit 1
+`
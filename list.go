@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// ListedPlatform is a supported platform as `gox list` prints it.
+type ListedPlatform struct {
+	OSArch  string `json:"osarch"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	ARM     string `json:"arm,omitempty"`
+	Default bool   `json:"default"`
+	Tier    int    `json:"tier,omitempty"`
+	Cgo     bool   `json:"cgo"`
+
+	// Experiment is the experiment that the platform comes from, if any.
+	Experiment string `json:"experiment,omitempty"`
+}
+
+// distPlatform is a platform as `go tool dist list -json` prints it, which
+// cgoPorts and firstClassPorts are kept in line with.
+type distPlatform struct {
+	GOOS         string
+	GOARCH       string
+	CgoSupported bool
+	FirstClass   bool
+}
+
+// DistPlatforms returns the platforms that the go command knows about,
+// by GOOS/GOARCH.
+func DistPlatforms(GoCmd string) (map[string]distPlatform, error) {
+	output, err := execGo(GoCmd, nil, "", "tool", "dist", "list", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []distPlatform
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("reading go tool dist list: %s", err)
+	}
+	result := make(map[string]distPlatform, len(list))
+	for _, p := range list {
+		result[p.GOOS+"/"+p.GOARCH] = p
+	}
+	return result, nil
+}
+
+// ListPlatforms returns the platforms that the compiler supports at Go
+// version v, then those of the enabled experiments.
+func ListPlatforms(v, compiler string, experiments ExperimentSet) []ListedPlatform {
+	var result []ListedPlatform
+	add := func(p Platform, experiment string) {
+		l := ListedPlatform{
+			OSArch:     p.String(),
+			OS:         p.OS,
+			Arch:       p.Arch,
+			ARM:        p.ARM,
+			Default:    p.Default && experiment == "",
+			Tier:       p.Tier,
+			Cgo:        !isTinygoTarget(p) && portCgo(p.OS, p.Arch),
+			Experiment: experiment,
+		}
+		result = append(result, l)
+	}
+
+	for _, p := range CompilerPlatforms(compiler, v) {
+		add(p, "")
+	}
+	for _, e := range Experiments {
+		if experiments.Enabled(e.Name) && e.supports(v) {
+			for _, p := range e.Platforms {
+				add(p, e.Name)
+			}
+		}
+	}
+
+	return result
+}
+
+// WriteList writes platforms in format: text, json or csv.
+func WriteList(w io.Writer, format string, platforms []ListedPlatform) error {
+	tier := func(p ListedPlatform) string {
+		if p.Tier == 0 {
+			return ""
+		}
+		return strconv.Itoa(p.Tier)
+	}
+
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "OSARCH\tDEFAULT\tTIER\tCGO\tEXPERIMENT\n")
+		for _, p := range platforms {
+			fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\n", p.OSArch, p.Default, tier(p), strconv.FormatBool(p.Cgo), p.Experiment)
+		}
+		return tw.Flush()
+	case "json":
+		if platforms == nil {
+			platforms = []ListedPlatform{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(platforms)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"osarch", "os", "arch", "arm", "default", "tier", "cgo", "experiment"})
+		for _, p := range platforms {
+			cw.Write([]string{p.OSArch, p.OS, p.Arch, p.ARM, strconv.FormatBool(p.Default), tier(p), strconv.FormatBool(p.Cgo), p.Experiment})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return fmt.Errorf("Invalid -format value %q: must be text, json, or csv", format)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestListPlatforms(t *testing.T) {
+	experiments, err := EnabledExperiments("wasip1")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	platforms := ListPlatforms("go1.21", compilerGc, experiments)
+	found := map[string]ListedPlatform{}
+	for _, p := range platforms {
+		found[p.OSArch] = p
+	}
+	if p := found["linux/amd64"]; !p.Default || p.Tier != 1 || !p.Cgo {
+		t.Fatalf("bad: %#v", p)
+	}
+	if p := found["plan9/386"]; p.Cgo {
+		t.Fatalf("bad: %#v", p)
+	}
+	if p := found["wasip1/wasm"]; p.Experiment != "wasip1" || p.Default {
+		t.Fatalf("bad: %#v", p)
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	platforms := []ListedPlatform{
+		{OSArch: "linux/armv7", OS: "linux", Arch: "arm", ARM: "7", Default: true, Tier: 1, Cgo: true},
+		{OSArch: "wasip1/wasm", OS: "wasip1", Arch: "wasm", Experiment: "wasip1"},
+	}
+
+	cases := map[string]string{
+		"text": "OSARCH       DEFAULT  TIER  CGO    EXPERIMENT\n" +
+			"linux/armv7  true     1     true   \n" +
+			"wasip1/wasm  false          false  wasip1\n",
+		"csv": "osarch,os,arch,arm,default,tier,cgo,experiment\n" +
+			"linux/armv7,linux,arm,7,true,1,true,\n" +
+			"wasip1/wasm,wasip1,wasm,,false,,false,wasip1\n",
+	}
+	for format, expected := range cases {
+		var b strings.Builder
+		if err := WriteList(&b, format, platforms); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if b.String() != expected {
+			t.Fatalf("%s: bad: %q", format, b.String())
+		}
+	}
+
+	var b strings.Builder
+	if err := WriteList(&b, "json", nil); err != nil || b.String() != "[]\n" {
+		t.Fatalf("bad: %q %v", b.String(), err)
+	}
+}
+
+func TestDistPlatforms(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	dist, err := DistPlatforms("go")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p, ok := dist["linux/amd64"]; !ok || !p.CgoSupported || !p.FirstClass {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// The tables of gox should agree with the go command
+	for name, p := range dist {
+		if portCgo(p.GOOS, p.GOARCH) != p.CgoSupported {
+			t.Fatalf("%s: cgo: bad: %#v", name, p)
+		}
+	}
+}
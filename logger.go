@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// logLevel is how much of its output gox prints.
+type logLevel int
+
+const (
+	logQuiet logLevel = iota
+	logInfo
+	logDebug
+)
+
+// Logger prints the output of gox. With -quiet only failures and the
+// final summary are printed, and with -debug every command that is run is
+// too. Stdout and stderr are looked up on every call, since -json and the
+// progress displays point them elsewhere while gox runs.
+type Logger struct {
+	Level logLevel
+	Color bool
+
+	lock   sync.Mutex
+	failed *RunError
+}
+
+// ui is the Logger of the gox command.
+var ui = &Logger{Level: logInfo}
+
+// useColor reports whether output should be colored: always with -color,
+// and otherwise when stderr is a terminal and NO_COLOR isn't set.
+func useColor(force bool) bool {
+	if force {
+		return true
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stderr)
+}
+
+// colorize wraps s in the ANSI color code if on.
+func colorize(on bool, code, s string) string {
+	if !on {
+		return s
+	}
+	return code + s + "\x1b[0m"
+}
+
+// Printf prints to stdout at every level, for the summary of a build.
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	fmt.Fprintf(os.Stdout, format, args...)
+}
+
+// Infof prints the progress of a build to stdout, unless -quiet.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	if l.Level < logInfo {
+		return
+	}
+	l.Printf(format, args...)
+}
+
+// Warnf prints something that doesn't fail the build, such as a platform
+// that is skipped, to stderr, unless -quiet.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	if l.Level < logInfo {
+		return
+	}
+	l.Errorf(format, args...)
+}
+
+// Errorf prints an error to stderr at every level.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// Fail prints the error that ends a run to stderr, like Errorf, and
+// returns status, the exit status of the run, keeping both for Failed.
+func (l *Logger) Fail(status int, format string, args ...interface{}) int {
+	msg := fmt.Sprintf(format, args...)
+	l.Errorf("%s", msg)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.failed = newRunError(status, msg)
+	return status
+}
+
+// Failed returns the error of the last Fail, or nil.
+func (l *Logger) Failed() *RunError {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.failed
+}
+
+// Debugf prints to stderr with -debug.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.Level < logDebug {
+		return
+	}
+	l.Errorf("%s\n", colorize(l.Color, "\x1b[2m", "debug: "+fmt.Sprintf(format, args...)))
+}
+
+// Failure highlights the platform, or other name, of something that
+// failed.
+func (l *Logger) Failure(name string) string {
+	return colorize(l.Color, "\x1b[1;31m", name)
+}
+
+// Command prints a command that is about to run with -debug: the
+// directory it runs in, the variables that env adds to or changes in the
+// environment of gox, and its arguments.
+func (l *Logger) Command(dir string, env []string, name string, args ...string) {
+	if l.Level < logDebug {
+		return
+	}
+
+	parts := append(envChanges(env), shellQuote(name))
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	line := strings.Join(parts, " ")
+	if dir != "" {
+		line = "(cd " + shellQuote(dir) + " && " + line + ")"
+	}
+	l.Debugf("%s", line)
+}
+
+// envChanges returns the variables of env that aren't the same in the
+// environment of gox, sorted and quoted for a shell.
+func envChanges(env []string) []string {
+	current := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		current[kv] = true
+	}
+
+	var changes []string
+	for _, kv := range env {
+		if current[kv] {
+			continue
+		}
+		if i := strings.Index(kv, "="); i > 0 {
+			changes = append(changes, kv[:i+1]+shellQuote(kv[i+1:]))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// shellQuote quotes s for a POSIX shell if it needs it.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-_./:=,+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"build":             "build",
+		"-ldflags=-s -w":    "'-ldflags=-s -w'",
+		"":                  "''",
+		"it's":              `'it'\''s'`,
+		"./cmd/app_linux.o": "./cmd/app_linux.o",
+	}
+
+	for input, expected := range cases {
+		if actual := shellQuote(input); actual != expected {
+			t.Fatalf("%s: bad: %s", input, actual)
+		}
+	}
+}
+
+func TestEnvChanges(t *testing.T) {
+	os.Setenv("GOX_TEST_SAME", "1")
+	defer os.Unsetenv("GOX_TEST_SAME")
+
+	env := append(os.Environ(), "GOOS=plan9", "CGO_CFLAGS=-O2 -g", "GOX_TEST_SAME=1")
+	expected := []string{"CGO_CFLAGS='-O2 -g'", "GOOS=plan9"}
+	if actual := envChanges(env); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	os.Setenv("NO_COLOR", "")
+	defer os.Unsetenv("NO_COLOR")
+
+	if useColor(false) {
+		t.Fatal("NO_COLOR should turn off color")
+	}
+	if !useColor(true) {
+		t.Fatal("-color should turn on color")
+	}
+}
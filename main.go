@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	version "github.com/hashicorp/go-version"
 )
@@ -18,27 +21,110 @@ func main() {
 	os.Exit(realMain())
 }
 
-func realMain() int {
+func realMain() (code int) {
+	// Subcommands are dispatched before any flags are parsed since each
+	// has its own set of flags.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "clean":
+			return mainClean(os.Args[2:])
+		case "completion":
+			return mainCompletion(os.Args[2:])
+		case "doctor":
+			return mainDoctor(os.Args[2:])
+		case "image":
+			return mainImage(os.Args[2:])
+		case "import":
+			return mainImport(os.Args[2:])
+		case "init":
+			return mainInit(os.Args[2:])
+		case "inspect":
+			return mainInspect(os.Args[2:])
+		case "list":
+			return mainList(os.Args[2:])
+		case "matrix":
+			return mainMatrix(os.Args[2:])
+		case "promote":
+			return mainPromote(os.Args[2:])
+		case "serve":
+			return mainServe(os.Args[2:])
+		case "sizes":
+			return mainSizes(os.Args[2:])
+		case "toolchains":
+			return mainToolchains(os.Args[2:])
+		case "verify":
+			return mainVerify(os.Args[2:])
+		case "verify-reproducible":
+			return mainVerifyReproducible(os.Args[2:])
+		case "worker":
+			return mainWorker(os.Args[2:])
+		}
+	}
+
 	var buildToolchain bool
 	var ldflags string
-	var outputTpl string
+	var outputTpl, flagOutputLayout string
 	var parallel int
 	var platformFlag PlatformFlag
 	var tags string
 	var verbose bool
-	var flagGcflags, flagAsmflags string
-	var flagCgo, flagRebuild, flagListOSArch, flagRaceFlag bool
-	var flagGoCmd string
+	var flagLdflags, flagGcflags, flagAsmflags, flagPGO, flagGoExperiment buildFlagValue
+	var flagFIPS, flagFIPSOutput string
+	var flagObfuscate bool
+	var flagObfuscateFlags, flagObfuscateSeed string
+	var flagCgo, flagRebuild, flagListOSArch, flagRaceFlag, flagTest bool
+	var flagGoCmd, flagCompiler string
 	var modMode string
+	var flagBuilder, flagBuilderImage, flagWorkers string
+	var flagHost string
+	var flagTriage string
+	var flagStream, flagColor, flagInteractive, flagProgress bool
+	var flagQuiet, flagDebug bool
+	var flagConfig string
+	var flagDarwinUniversal bool
+	var flagDarwinUniversalOutput string
+	var flagTree, flagFatArchive string
+	var flagIncremental string
+	var flagJSON, flagOtel bool
+	var flagReproducible bool
+	var flagBuildMode string
+	var flagStrip, flagSplitDebug, flagStatic bool
+	var flagBuildID bool
+	var flagExperimental string
+	var flagWorkspaceModules stringSliceValue
+	var flagGoVersion, flagVersion string
+	var flagShard, flagShardTimings string
+	var flagAllowFailures string
+	var flagGoFlags, flagOverlay string
+	var flagNoGoEnv, flagModCacheRW bool
+	var flagPreflight bool
+	var flagPrintTargets bool
+	var flagOrder string
+	var flagPackageParallel int
+	var flagAndroidAPI int
+	var flagIOSVersion string
+	var flagSmokeTest string
+	var flagLogDir string
+	var flagTier int
+	var flagRequireCgo, flagSkipCgoUnsupported bool
+	var flagCheckUnsupported, flagSkipUnsupported bool
+	var flagLatestLink string
+	var flagPublish bool
+	var flagBandwidthLimit string
+	var flagClean bool
+	var flagOverwrite, flagSkipExisting bool
+	var flagOnlyFirstClass bool
 	flags := flag.NewFlagSet("gox", flag.ExitOnError)
 	flags.Usage = func() { printUsage() }
 	flags.Var(platformFlag.ArchFlagValue(), "arch", "arch to build for or skip")
 	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "os/arch pairs to build for or skip")
+	flags.Var(platformFlag.OSArchFileValue(), "osarch-file", "")
 	flags.Var(platformFlag.OSFlagValue(), "os", "os to build for or skip")
 	flags.Var(platformFlag.ARMArchFlagValue(), "armarch", "os to build for or skip")
-	flags.StringVar(&ldflags, "ldflags", "", "linker flags")
+	flags.Var(&flagLdflags, "ldflags", "linker flags")
 	flags.StringVar(&tags, "tags", "", "go build tags")
 	flags.StringVar(&outputTpl, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "output path")
+	flags.StringVar(&flagOutputLayout, "output-layout", outputLayoutFlat, "")
 	flags.IntVar(&parallel, "parallel", -1, "parallelization factor")
 	flags.BoolVar(&buildToolchain, "build-toolchain", false, "build toolchain")
 	flags.BoolVar(&verbose, "verbose", false, "verbose")
@@ -46,17 +132,185 @@ func realMain() int {
 	flags.BoolVar(&flagRebuild, "rebuild", false, "")
 	flags.BoolVar(&flagListOSArch, "osarch-list", false, "")
 	flags.BoolVar(&flagRaceFlag, "race", false, "")
-	flags.StringVar(&flagGcflags, "gcflags", "", "")
-	flags.StringVar(&flagAsmflags, "asmflags", "", "")
+	flags.BoolVar(&flagTest, "test", false, "")
+	flags.Var(&flagGcflags, "gcflags", "")
+	flags.Var(&flagAsmflags, "asmflags", "")
+	flags.Var(&flagPGO, "pgo", "")
+	flags.Var(&flagGoExperiment, "goexperiment", "")
+	flags.StringVar(&flagFIPS, "fips", "", "")
+	flags.StringVar(&flagFIPSOutput, "fips-output", "", "")
+	flags.BoolVar(&flagObfuscate, "obfuscate", false, "")
+	flags.StringVar(&flagObfuscateFlags, "obfuscate-flags", "", "")
+	flags.StringVar(&flagObfuscateSeed, "obfuscate-seed", "", "")
 	flags.StringVar(&flagGoCmd, "gocmd", "go", "")
+	flags.StringVar(&flagGoVersion, "go-version", "", "")
+	flags.StringVar(&flagVersion, "version", "", "")
+	flags.StringVar(&flagCompiler, "compiler", compilerGc, "")
+	flags.StringVar(&flagShard, "shard", "", "")
+	flags.StringVar(&flagAllowFailures, "allow-failures", "", "")
+	flags.StringVar(&flagGoFlags, "goflags", "", "")
+	flags.BoolVar(&flagNoGoEnv, "no-goenv", false, "")
+	flags.StringVar(&flagOverlay, "overlay", "", "")
+	flags.StringVar(&flagShardTimings, "shard-timings", "", "")
 	flags.StringVar(&modMode, "mod", "", "")
+	flags.BoolVar(&flagModCacheRW, "modcacherw", false, "")
+	flags.BoolVar(&flagPreflight, "preflight", false, "")
+	flags.BoolVar(&flagPrintTargets, "print-targets", false, "")
+	flags.StringVar(&flagOrder, "order", "", "")
+	flags.IntVar(&flagPackageParallel, "package-parallel", 0, "")
+	flags.IntVar(&flagAndroidAPI, "android-api", androidDefaultAPI, "")
+	flags.StringVar(&flagIOSVersion, "ios-version", iosDefaultVersion, "")
+	flags.StringVar(&flagBuilder, "builder", "local", "")
+	flags.StringVar(&flagBuilderImage, "builder-image", "", "")
+	flags.StringVar(&flagWorkers, "workers", "", "")
+	flags.StringVar(&flagHost, "host", "", "")
+	flags.StringVar(&flagTriage, "triage", "", "")
+	flags.BoolVar(&flagStream, "stream", false, "")
+	flags.BoolVar(&flagColor, "color", false, "")
+	flags.BoolVar(&flagInteractive, "interactive", false, "")
+	flags.BoolVar(&flagProgress, "progress", false, "")
+	flags.BoolVar(&flagQuiet, "quiet", false, "")
+	flags.BoolVar(&flagDebug, "debug", false, "")
+	flags.StringVar(&flagConfig, "config", "", "")
+	flags.BoolVar(&flagDarwinUniversal, "darwin-universal", false, "")
+	flags.StringVar(&flagDarwinUniversalOutput, "darwin-universal-output", "", "")
+	flags.StringVar(&flagTree, "tree", "", "")
+	flags.StringVar(&flagFatArchive, "fat-archive", "", "")
+	flags.StringVar(&flagIncremental, "incremental", "", "")
+	flags.BoolVar(&flagJSON, "json", false, "")
+	flags.BoolVar(&flagOtel, "otel", false, "")
+	flags.BoolVar(&flagReproducible, "reproducible", false, "")
+	flags.StringVar(&flagBuildMode, "buildmode", "", "")
+	flags.BoolVar(&flagStrip, "strip", false, "")
+	flags.BoolVar(&flagStatic, "static", false, "")
+	flags.BoolVar(&flagSplitDebug, "split-debug", false, "")
+	flags.BoolVar(&flagBuildID, "build-id", false, "")
+	flags.StringVar(&flagSmokeTest, "smoke-test", "", "")
+	flags.StringVar(&flagLogDir, "log-dir", "", "")
+	flags.IntVar(&flagTier, "tier", 0, "")
+	flags.BoolVar(&flagRequireCgo, "require-cgo", false, "")
+	flags.BoolVar(&flagSkipCgoUnsupported, "skip-cgo-unsupported", false, "")
+	flags.BoolVar(&flagCheckUnsupported, "check-unsupported", false, "")
+	flags.BoolVar(&flagSkipUnsupported, "skip-unsupported", false, "")
+	flags.StringVar(&flagLatestLink, "latest-link", "", "")
+	flags.BoolVar(&flagPublish, "publish", false, "")
+	flags.StringVar(&flagBandwidthLimit, "bandwidth-limit", "", "")
+	flags.BoolVar(&flagClean, "clean", false, "")
+	flags.BoolVar(&flagOverwrite, "overwrite", false, "")
+	flags.BoolVar(&flagSkipExisting, "skip-existing", false, "")
+	flags.BoolVar(&flagOnlyFirstClass, "only-first-class", false, "")
+	flags.StringVar(&flagExperimental, "enable-experimental", "", "")
+	flags.Var(&flagWorkspaceModules, "workspace-module", "")
+	started := time.Now()
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		flags.Usage()
-		return 1
+		return exitFlags
+	}
+	ldflags = flagLdflags.Value
+
+	// With -json, stdout is reserved for the summary so that it can be
+	// piped straight into another program. It is written however the run
+	// ends, with the error that ended it.
+	var summary *BuildSummary
+	if flagJSON {
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() {
+			if summary == nil {
+				summary = NewBuildSummary(nil)
+			}
+			if code != 0 && code != exitUpToDate {
+				summary.Error = ui.Failed()
+				switch {
+				case summary.Error == nil:
+					summary.Error = newRunError(code, "")
+				case summary.Error.ExitStatus != code:
+					summary.Error = newRunError(code, summary.Error.Message)
+				}
+			}
+			if err := summary.Write(stdout); err != nil {
+				ui.Errorf("Error writing summary: %s\n", err)
+				if code == 0 {
+					code = exitError
+				}
+			}
+		}()
+	}
+
+	switch {
+	case flagQuiet && flagDebug:
+		return ui.Fail(exitFlags, "-quiet and -debug can't be used together\n")
+	case flagQuiet:
+		ui.Level = logQuiet
+	case flagDebug:
+		ui.Level = logDebug
+	}
+	ui.Color = useColor(flagColor)
+
+	// With -otel the run is a trace, exported however it ends
+	var tracer *otelTracer
+	if flagOtel {
+		tracer = newOtelTracer("gox", started)
+		defer func() {
+			var err error
+			if code != 0 && code != exitUpToDate {
+				err = fmt.Errorf("exit status %d", code)
+			}
+			if err := tracer.Export(err); err != nil {
+				ui.Warnf("Error exporting the trace: %s\n", err)
+			}
+		}()
+	}
+
+	experiments, err := EnabledExperiments(flagExperimental)
+	if err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+
+	config, err := LoadConfig(flagConfig)
+	if err != nil {
+		return ui.Fail(exitFlags, "Error loading config: %s\n", err)
+	}
+	if err := config.Validate(); err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	cleanupSecrets, err := config.LoadSecrets()
+	defer cleanupSecrets()
+	if err != nil {
+		return ui.Fail(exitError, "%s\n", err)
+	}
+	if config.Nfpm != nil {
+		if _, err := exec.LookPath(config.Nfpm.command()); err != nil {
+			return ui.Fail(exitToolchain, "%s executable must be on the PATH to build packages\n",
+				config.Nfpm.command())
+		}
+	}
+	if config.Authenticode != nil && len(config.Authenticode.Command) == 0 {
+		if _, err := exec.LookPath("osslsigncode"); err != nil {
+			return ui.Fail(exitToolchain, "osslsigncode executable must be on the PATH to sign windows binaries\n")
+		}
+	}
+	if config.Sign != nil {
+		if _, err := exec.LookPath(config.Sign.command()); err != nil {
+			return ui.Fail(exitToolchain, "%s executable must be on the PATH to sign with %s\n",
+				config.Sign.command(), config.Sign.Key)
+		}
+	}
+
+	var objcopy string
+	if flagSplitDebug {
+		flagStrip = true
+		if objcopy, err = objcopyCommand(); err != nil {
+			return ui.Fail(exitToolchain, "%s\n", err)
+		}
 	}
 
 	// Determine what amount of parallelism we want Default to the current
-	// number of CPUs-1 is <= 0 is specified.
+	// number of CPUs-1 is <= 0 is specified. The flag takes precedence
+	// over the config file.
+	if parallel <= 0 {
+		parallel = config.Concurrency.Build
+	}
 	if parallel <= 0 {
 		cpus := runtime.NumCPU()
 		if cpus < 2 {
@@ -74,194 +328,2805 @@ func realMain() int {
 		}
 	}
 
+	host, err := HostPlatform(flagHost)
+	if err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	// The config file's targets are the defaults for when none are given
+	if len(platformFlag.OS) == 0 && len(platformFlag.Arch) == 0 && len(platformFlag.OSArch) == 0 {
+		platformFlag.OSArchFlagValue().Set(strings.Join(config.OSArch, " "))
+	}
+	platformFlag.ResolveHost(host)
+
 	if buildToolchain {
 		return mainBuildToolchain(parallel, platformFlag, verbose)
 	}
 
-	if _, err := exec.LookPath(flagGoCmd); err != nil {
-		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n",
+	// A pinned Go release replaces the go command on the PATH for every
+	// build, and is downloaded first if needed. Container builds get it
+	// from the builder image instead.
+	var pinnedVersion string
+	if flagGoVersion != "" {
+		if flagGoCmd != "go" {
+			return ui.Fail(exitFlags, "-go-version and -gocmd can't be used together\n")
+		}
+		if pinnedVersion, err = ResolveGoVersion(flagGoVersion); err != nil {
+			return ui.Fail(exitFlags, "%s\n", err)
+		}
+		if flagBuilder == "local" {
+			if flagGoCmd, err = EnsureGoToolchain(pinnedVersion); err != nil {
+				return ui.Fail(exitToolchain, "Error downloading %s: %s\n", pinnedVersion, err)
+			}
+
+			// Keep the pinned go from switching to another toolchain, or
+			// from using the GOROOT of the one on the PATH.
+			os.Setenv("GOTOOLCHAIN", "local")
+			os.Setenv("GOROOT", filepath.Dir(filepath.Dir(flagGoCmd)))
+		}
+	}
+
+	if _, err := exec.LookPath(flagGoCmd); err != nil && pinnedVersion == "" {
+		return ui.Fail(exitToolchain, "%s executable must be on the PATH\n",
 			flagGoCmd)
-		return 1
 	}
 
-	versionStr, err := GoVersion()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
-		return 1
+	versionStr := pinnedVersion
+	if versionStr == "" {
+		if versionStr, err = GoVersion(); err != nil {
+			return ui.Fail(exitToolchain, "error reading Go version: %s", err)
+		}
+	}
+
+	switch {
+	case flagBuilder == "local":
+	case isContainerBuilder(flagBuilder):
+		if _, err := exec.LookPath(flagBuilder); err != nil {
+			return ui.Fail(exitToolchain, "%s executable must be on the PATH to use -builder=%s\n",
+				flagBuilder, flagBuilder)
+		}
+		if flagBuilderImage == "" {
+			flagBuilderImage = defaultBuilderImage(versionStr)
+		}
+	case flagBuilder == "remote":
+	default:
+		return ui.Fail(exitFlags, "Invalid -builder value %q: must be local, docker, podman, or remote\n",
+			flagBuilder)
+	}
+
+	if err := ValidateBuildMode(flagBuildMode); err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	// Workers only send back the binary, not the header of a C library
+	if flagBuilder == "remote" && (flagBuildMode == "c-shared" || flagBuildMode == "c-archive") {
+		return ui.Fail(exitFlags, "-buildmode=%s can't be used with -builder=remote\n", flagBuildMode)
+	}
+	if err := ValidateFIPS(flagFIPS); err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	if flagFIPSOutput != "" && flagFIPS == "" {
+		return ui.Fail(exitFlags, "-fips-output needs -fips\n")
+	}
+
+	// gccgo and TinyGo are found on this machine, the builder images only
+	// have gc.
+	if err := ValidateCompiler(flagCompiler); err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	if flagCompiler != compilerGc && !flagListOSArch {
+		if flagBuilder != "local" {
+			return ui.Fail(exitFlags, "-compiler=%s can only be used with -builder=local\n", flagCompiler)
+		}
+		if _, err := exec.LookPath(flagCompiler); err != nil {
+			return ui.Fail(exitToolchain, "%s executable must be on the PATH to use -compiler=%s\n",
+				flagCompiler, flagCompiler)
+		}
+	}
+
+	if flagStatic {
+		switch {
+		case flagRaceFlag:
+			return ui.Fail(exitFlags, "-static and -race can't be used together\n")
+		case flagBuildMode != "" && flagBuildMode != "exe":
+			return ui.Fail(exitFlags, "-static can't be used with -buildmode=%s\n", flagBuildMode)
+		}
+	}
+
+	// gccgo has no -X to link the build ID with
+	if flagBuildID && flagCompiler == compilerGccgo {
+		return ui.Fail(exitFlags, "-build-id can't be used with -compiler=gccgo\n")
+	}
+
+	// Test binaries are named like those of `go test -c`, unless -output
+	// says otherwise.
+	if flagTest {
+		switch {
+		case flagBuildMode != "":
+			return ui.Fail(exitFlags, "-test and -buildmode can't be used together\n")
+		case flagCompiler == compilerTinygo:
+			return ui.Fail(exitFlags, "-test can't be used with -compiler=tinygo\n")
+		}
+		outputSet := false
+		flags.Visit(func(f *flag.Flag) { outputSet = outputSet || f.Name == "output" })
+		if !outputSet {
+			outputTpl = "{{.Dir}}_{{.OS}}_{{.Arch}}.test"
+		}
+	}
+	if flagOverwrite && flagSkipExisting {
+		return ui.Fail(exitFlags, "-overwrite and -skip-existing can't be used together\n")
+	}
+	if flagOutputLayout != outputLayoutFlat && flagOutputLayout != outputLayoutDir {
+		return ui.Fail(exitFlags, "Invalid -output-layout=%s, must be flat or dir\n", flagOutputLayout)
+	}
+
+	// The checklist reads keys from the terminal, and the progress view
+	// replaces the streamed output.
+	if flagInteractive && !flagListOSArch {
+		switch {
+		case !isTerminal(os.Stdin) || !isTerminal(os.Stdout):
+			return ui.Fail(exitFlags, "-interactive needs a terminal\n")
+		case flagStream:
+			return ui.Fail(exitFlags, "-interactive and -stream can't be used together\n")
+		case flagProgress:
+			return ui.Fail(exitFlags, "-interactive and -progress can't be used together\n")
+		}
 	}
 
 	if flagListOSArch {
-		return mainListOSArch(versionStr)
+		return mainListOSArch(versionStr, flagCompiler, experiments)
+	}
+
+	// Inside a go.work workspace packages are resolved across all of its
+	// modules, or those picked with -workspace-module.
+	workspace, err := FindWorkspace(flagGoCmd)
+	if err != nil {
+		return ui.Fail(exitError, "Error reading workspace: %s", err)
+	}
+	var goWork string
+	switch {
+	case workspace != nil:
+		if err := workspace.Filter(flagWorkspaceModules); err != nil {
+			return ui.Fail(exitFlags, "%s\n", err)
+		}
+		if modMode != "" && modMode != "readonly" && modMode != "vendor" {
+			return ui.Fail(exitFlags, "-mod=%s can't be used in a workspace, only readonly or vendor, "+
+				"or set GOWORK=off to build the current module on its own\n", modMode)
+		}
+		goWork = workspace.File
+		if flagBuilder == "remote" {
+			return ui.Fail(exitFlags, "-builder=remote can't build a go.work workspace\n")
+		}
+	case len(flagWorkspaceModules) > 0:
+		return ui.Fail(exitFlags, "-workspace-module can only be used in a go.work workspace\n")
 	}
 
 	// Determine the packages that we want to compile. Default to the
 	// current directory if none are specified.
-	packages := flags.Args()
-	if len(packages) == 0 {
-		packages = []string{"."}
+	packages, err := workspace.Patterns(flags.Args())
+	if err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
 	}
 
-	// Get the packages that are in the given paths
-	mainDirs, err := GoMainDirs(packages, flagGoCmd)
+	// Get the packages that are in the given paths, or those with tests
+	// for -test
+	findDirs := GoMainDirs
+	if flagTest {
+		findDirs = GoTestDirs
+	}
+	mainDirs, err := findDirs(packages, flagGoCmd)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
-		return 1
+		return ui.Fail(exitError, "Error reading packages: %s", err)
 	}
+	mainDirs = workspace.Packages(mainDirs)
 
 	// Determine the platforms we're building for
-	platforms := platformFlag.Platforms(SupportedPlatforms(versionStr))
-	if len(platforms) == 0 {
-		fmt.Println("No valid platforms to build for. If you specified a value")
-		fmt.Println("for the 'os', 'arch', or 'osarch' flags, make sure you're")
-		fmt.Println("using a valid value.")
-		return 1
+	supported := experiments.Platforms(versionStr, CompilerPlatforms(flagCompiler, versionStr))
+	platforms := platformFlag.Platforms(supported)
+	for _, hint := range experiments.Hints(&platformFlag) {
+		ui.Warnf("%s\n", hint)
 	}
 
-	// Assume -mod is supported when no version prefix is found
-	if modMode != "" && strings.HasPrefix(versionStr, "go") {
-		// go-version only cares about version numbers
-		current, err := version.NewVersion(versionStr[2:])
+	// -tier leaves out the ports below it in the Go porting policy
+	if flagOnlyFirstClass {
+		flagTier = 1
+	}
+	switch {
+	case flagTier < 0 || flagTier > 2:
+		return ui.Fail(exitFlags, "Invalid -tier value %d: must be 1 or 2\n", flagTier)
+	case flagTier > 0:
+		platforms = filterTier(platforms, flagTier)
+		supported = filterTier(supported, flagTier)
+	}
+	allowFailures, err := ParseAllowFailures(flagAllowFailures)
+	if err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+
+	// With -interactive they are picked from every supported platform,
+	// starting with those that would have been built
+	if flagInteractive {
+		picked, err := PickPlatforms(os.Stdin, os.Stdout, supported, platforms)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to parse current go version: %s\n%s", versionStr, err.Error())
-			return 1
+			return ui.Fail(exitError, "%s\n", err)
+		}
+		if picked == nil {
+			return ui.Fail(exitFlags, "No platforms were picked\n")
 		}
+		platforms = picked
+	}
+	if len(platforms) == 0 {
+		ui.Printf("No valid platforms to build for. If you specified a value\n")
+		ui.Printf("for the 'os', 'arch', or 'osarch' flags, make sure you're\n")
+		ui.Printf("using a valid value.\n")
+		return exitFlags
+	}
 
-		constraint, err := version.NewConstraint(">= 1.11")
-		if err != nil {
-			panic(err)
+	// Not every platform can build every -buildmode
+	var buildModePlatforms []Platform
+	for _, p := range platforms {
+		if buildModeSupported(flagBuildMode, p) {
+			buildModePlatforms = append(buildModePlatforms, p)
+		} else {
+			ui.Warnf("Skipping %s: it doesn't support -buildmode=%s\n", p.String(), flagBuildMode)
 		}
+	}
+	if len(buildModePlatforms) == 0 {
+		return ui.Fail(exitFlags, "None of the platforms support -buildmode=%s\n", flagBuildMode)
+	}
+	platforms = buildModePlatforms
 
-		if !constraint.Check(current) {
-			fmt.Printf("Go compiler version %s does not support the -mod flag\n", versionStr)
-			modMode = ""
+	// Ports without cgo would only fail once they are built, with an error
+	// from deep in the toolchain, so they are caught here
+	if flagRequireCgo {
+		flagCgo = true
+	}
+	if flagCgo && flagCompiler == compilerGc {
+		cgoPlatforms, noCgo := splitCgo(platforms)
+		switch {
+		case len(noCgo) == 0:
+		case flagSkipCgoUnsupported:
+			for _, p := range noCgo {
+				ui.Warnf("Skipping %s: it doesn't support cgo\n", p.String())
+			}
+			if len(cgoPlatforms) == 0 {
+				return ui.Fail(exitFlags, "None of the platforms support cgo\n")
+			}
+			platforms = cgoPlatforms
+		case flagRequireCgo:
+			return ui.Fail(exitFlags, "These platforms don't support cgo, which -require-cgo needs: %s\n", platformNames(noCgo))
 		}
 	}
 
-	// Build in parallel!
-	fmt.Printf("Number of parallel builds: %d\n\n", parallel)
-	var errorLock sync.Mutex
-	var wg sync.WaitGroup
-	errors := make([]string, 0)
-	semaphore := make(chan int, parallel)
-	for _, platform := range platforms {
-		for _, path := range mainDirs {
-			// Start the goroutine that will do the actual build
-			wg.Add(1)
-			go func(path string, platform Platform) {
-				defer wg.Done()
-				semaphore <- 1
-				fmt.Printf("--> %15s: %s\n", platform.String(), path)
+	// android builds with cgo need a C compiler for their ABI, which is
+	// the clang of the Android NDK unless GOX_ANDROID_[ARCH]_CC is set
+	var androidNDK string
+	if flagCgo && flagCompiler == compilerGc && flagBuilder == "local" {
+		androidNDK = FindAndroidNDK()
+		for _, p := range platforms {
+			if p.OS != "android" || os.Getenv(envOverrideKey(p, "CC")) != "" {
+				continue
+			}
+			if androidNDK == "" {
+				return ui.Fail(exitToolchain, "%s needs the Android NDK to build with cgo: set ANDROID_NDK_HOME, "+
+					"or %s to a C compiler\n", p.String(), envOverrideKey(p, "CC"))
+			}
+			if _, _, err := androidClang(androidNDK, p, flagAndroidAPI); err != nil {
+				return ui.Fail(exitToolchain, "%s\n", err)
+			}
+		}
+	}
+
+	// ios builds are linked by the clang of Xcode, with its SDK for the
+	// device or the simulator, unless GOX_IOS_[ARCH]_CC is set
+	if _, err := version.NewVersion(flagIOSVersion); err != nil {
+		return ui.Fail(exitFlags, "Invalid -ios-version=%s, must be a version of iOS such as %s\n", flagIOSVersion, iosDefaultVersion)
+	}
+	bandwidth, err := parseBandwidth(flagBandwidthLimit)
+	if err != nil {
+		return ui.Fail(exitFlags, "Invalid -bandwidth-limit: %s\n", err)
+	}
+	uploadLimiter = newRateLimiter(bandwidth)
+	xcodeSDKs := make(map[string]*xcodeSDK)
+	if flagCompiler == compilerGc && flagBuilder == "local" {
+		for _, p := range platforms {
+			if p.OS != "ios" || os.Getenv(envOverrideKey(p, "CC")) != "" {
+				continue
+			}
+			if runtime.GOOS != "darwin" {
+				return ui.Fail(exitToolchain, "%s can only be built on macOS, with Xcode, "+
+					"or with %s set to a C compiler for it\n", p.String(), envOverrideKey(p, "CC"))
+			}
+			sdk, err := FindXcodeSDK(p)
+			if err != nil {
+				return ui.Fail(exitToolchain, "%s needs Xcode to build: %s\n", p.String(), err)
+			}
+			xcodeSDKs[p.String()] = sdk
+		}
+	}
 
+	// A dependency that can't be built for a platform fails its build
+	// with the same error every time, so it can be found up front from
+	// the build constraints of the packages
+	if (flagCheckUnsupported || flagSkipUnsupported) && flagCompiler != compilerTinygo {
+		unsupported, err := UnsupportedPlatforms(platforms, parallel, func(p Platform) (string, error) {
+			for _, path := range mainDirs {
 				opts := &CompileOpts{
 					PackagePath: path,
-					Platform:    platform,
-					OutputTpl:   outputTpl,
-					Ldflags:     ldflags,
-					Gcflags:     flagGcflags,
-					Asmflags:    flagAsmflags,
+					Platform:    p,
 					Tags:        tags,
 					ModMode:     modMode,
 					Cgo:         flagCgo,
-					Rebuild:     flagRebuild,
 					GoCmd:       flagGoCmd,
-					Race:        flagRaceFlag,
+					GoWork:      goWork,
+					BuildMode:   platformBuildMode(flagBuildMode, p, flagTest),
+					Host:        host,
+				}
+				packageConfig(config.Packages, path).apply(opts)
+				if reason, err := CheckBuildConstraints(opts); err != nil || reason != "" {
+					return reason, err
 				}
+			}
+			return "", nil
+		})
+		if err != nil {
+			return ui.Fail(exitError, "Error checking the build constraints of the packages: %s\n", err)
+		}
 
-				// Determine if we have specific CFLAGS or LDFLAGS for this
-				// GOOS/GOARCH combo and override the defaults if so.
-				envOverride(&opts.Ldflags, platform, "LDFLAGS")
-				envOverride(&opts.Gcflags, platform, "GCFLAGS")
-				envOverride(&opts.Asmflags, platform, "ASMFLAGS")
+		var supportedPlatforms []Platform
+		for _, p := range platforms {
+			reason, ok := unsupported[p.String()]
+			switch {
+			case !ok:
+				supportedPlatforms = append(supportedPlatforms, p)
+			case flagSkipUnsupported:
+				ui.Warnf("Skipping %s: %s\n", p.String(), reason)
+			default:
+				ui.Warnf("%s won't build: %s\n", p.String(), reason)
+				supportedPlatforms = append(supportedPlatforms, p)
+			}
+		}
+		if len(supportedPlatforms) == 0 {
+			return ui.Fail(exitFlags, "None of the platforms can build the packages\n")
+		}
+		platforms = supportedPlatforms
+	}
 
-				if err := GoCrossCompile(opts); err != nil {
-					errorLock.Lock()
-					defer errorLock.Unlock()
-					errors = append(errors,
-						fmt.Sprintf("%s error: %s", platform.String(), err))
-				}
-				<-semaphore
-			}(path, platform)
+	// With -shard, this job only builds its part of the platforms
+	timings, err := LoadShardTimings(flagShardTimings)
+	if err != nil {
+		return ui.Fail(exitError, "Error loading shard timings: %s\n", err)
+	}
+	order, err := ParseBuildOrder(flagOrder)
+	if err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	if order.Preset == orderFastestFirst && flagShardTimings == "" {
+		return ui.Fail(exitFlags, "-order=%s needs the build times of -shard-timings\n", orderFastestFirst)
+	}
+	if flagShard != "" {
+		shard, err := ParseShard(flagShard)
+		if err != nil {
+			return ui.Fail(exitFlags, "%s\n", err)
+		}
+
+		// The halves of a universal binary are built by the same job
+		platforms = shard.Platforms(platforms, timings, func(p Platform) string {
+			if flagDarwinUniversal && p.OS == "darwin" && (p.Arch == "amd64" || p.Arch == "arm64") {
+				return "darwin/universal"
+			}
+			return p.String()
+		})
+		if len(platforms) == 0 {
+			ui.Printf("Shard %s has no platforms to build.\n", shard)
+			return 0
 		}
 	}
-	wg.Wait()
 
-	if len(errors) > 0 {
-		fmt.Fprintf(os.Stderr, "\n%d errors occurred:\n", len(errors))
-		for _, err := range errors {
-			fmt.Fprintf(os.Stderr, "--> %s\n", err)
+	// The platforms of -os, -arch and -osarch are deduplicated, so this
+	// is what gets built, in the order of -order
+	if flagPrintTargets {
+		order.SortPlatforms(platforms, timings)
+		for _, p := range platforms {
+			ui.Printf("%s\n", p.String())
 		}
-		return 1
+		return 0
 	}
 
-	return 0
-}
+	switch modMode {
+	case "", "mod", "readonly", "vendor":
+	default:
+		return ui.Fail(exitFlags, "Invalid -mod=%s, must be mod, readonly or vendor\n", modMode)
+	}
 
-func printUsage() {
-	fmt.Fprintf(os.Stderr, helpText)
-}
+	// Assume -mod is supported when no version prefix is found
+	if modMode != "" {
+		ok, err := goVersionSupports(versionStr, ">= 1.11")
+		if err != nil {
+			return ui.Fail(exitToolchain, "%s", err)
+		}
+		if !ok {
+			ui.Warnf("Go compiler version %s does not support the -mod flag\n", versionStr)
+			modMode = ""
+		}
+	}
 
-const helpText = `Usage: gox [options] [packages]
+	// -modcacherw is new in Go 1.14
+	if flagModCacheRW {
+		ok, err := goVersionSupports(versionStr, ">= 1.14")
+		if err != nil {
+			return ui.Fail(exitToolchain, "%s", err)
+		}
+		if !ok {
+			ui.Warnf("Go compiler version %s does not support the -modcacherw flag\n", versionStr)
+			flagModCacheRW = false
+		}
+	}
 
-  Gox cross-compiles Go applications in parallel.
+	// GOFIPS140 is new in Go 1.24
+	if flagFIPS != "" && flagFIPS != fipsBoring {
+		ok, err := goVersionSupports(versionStr, ">= 1.24")
+		if err != nil {
+			return ui.Fail(exitToolchain, "%s", err)
+		}
+		if !ok {
+			return ui.Fail(exitToolchain, "Go compiler version %s does not support -fips=%s, "+
+				"use -fips=boringcrypto\n", versionStr, flagFIPS)
+		}
+	}
 
-  If no specific operating systems or architectures are specified, Gox
-  will build for all pairs supported by your version of Go.
+	// Profiles are checked up front, rather than by every build
+	if flagPGO.Value != "" || len(flagPGO.Platforms) > 0 {
+		ok, err := goVersionSupports(versionStr, ">= 1.21")
+		if err != nil {
+			return ui.Fail(exitToolchain, "%s", err)
+		}
+		if !ok {
+			return ui.Fail(exitToolchain, "Go compiler version %s does not support the -pgo flag\n", versionStr)
+		}
 
-Options:
+		if flagPGO.Value, err = pgoProfile(flagPGO.Value); err != nil {
+			return ui.Fail(exitFlags, "%s\n", err)
+		}
+		for key, v := range flagPGO.Platforms {
+			if flagPGO.Platforms[key], err = pgoProfile(v); err != nil {
+				return ui.Fail(exitFlags, "%s: %s\n", key, err)
+			}
+		}
+	}
 
-  -arch=""            Space-separated list of architectures to build for
-  -build-toolchain    Build cross-compilation toolchain
-  -cgo                Sets CGO_ENABLED=1, requires proper C toolchain (advanced)
-  -gcflags=""         Additional '-gcflags' value to pass to go build
-  -ldflags=""         Additional '-ldflags' value to pass to go build
-  -asmflags=""        Additional '-asmflags' value to pass to go build
-  -tags=""            Additional '-tags' value to pass to go build
-  -mod=""             Additional '-mod' value to pass to go build
-  -os=""              Space-separated list of operating systems to build for
-  -osarch=""          Space-separated list of os/arch pairs to build for
-  -armarch=""         Space-separated list of GOARM arch version to build for when arch is "arm"
-  -osarch-list        List supported os/arch pairs for your Go version
-  -output="foo"       Output path template. See below for more info
-  -parallel=-1        Amount of parallelism, defaults to number of CPUs
-  -race               Build with the go race detector enabled, requires CGO
-  -gocmd="go"         Build command, defaults to Go
-  -rebuild            Force rebuilding of package that were up to date
-  -verbose            Verbose mode
+	// -goflags="" clears GOFLAGS, so whether it was given matters
+	var goFlags *string
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "goflags" {
+			goFlags = &flagGoFlags
+		}
+	})
 
-Output path template:
+	// A vendor directory is preferred over the module cache, unless -mod
+	// or GOFLAGS say otherwise. TinyGo has no -mod, and uses it anyway.
+	if flagCompiler != compilerTinygo {
+		detected := DetectModMode(modMode, (&CompileOpts{GoCmd: flagGoCmd, GoFlags: goFlags, NoGoEnv: flagNoGoEnv}).goFlags(), workspace)
+		if modMode == "" && detected != "" {
+			ui.Infof("--> Building with -mod=%s, since there is a vendor directory\n", detected)
+		}
+		modMode = detected
+	}
+	if flagOverlay != "" {
+		switch {
+		case flagBuilder == "remote":
+			return ui.Fail(exitFlags, "-overlay can't be used with -builder=remote\n")
+		case flagCompiler == compilerTinygo:
+			return ui.Fail(exitFlags, "-overlay can't be used with -compiler=tinygo\n")
+		}
+		ok, err := goVersionSupports(versionStr, ">= 1.16")
+		if err != nil {
+			return ui.Fail(exitToolchain, "%s", err)
+		}
+		if !ok {
+			return ui.Fail(exitToolchain, "Go compiler version %s does not support the -overlay flag\n", versionStr)
+		}
+		if flagOverlay, err = LoadOverlay(flagOverlay); err != nil {
+			return ui.Fail(exitFlags, "%s\n", err)
+		}
+	}
 
-  The output path for the compiled binaries is specified with the
-  "-output" flag. The value is a string that is a Go text template.
-  The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}". The variables and
-  their values should be self-explanatory.
+	// Windows resources are picked up by go build from the package
+	// directory, so they have to be there while building.
+	if config.VersionInfo != nil {
+		var archs []string
+		seen := make(map[string]bool)
+		for _, p := range platforms {
+			if _, ok := sysoMachine[p.Arch]; ok && p.OS == "windows" && !seen[p.Arch] {
+				archs = append(archs, p.Arch)
+				seen[p.Arch] = true
+			}
+		}
 
-Platforms (OS/Arch):
+		sysos, err := WriteVersionInfo(config.VersionInfo, flagGoCmd, mainDirs, archs)
+		defer func() {
+			for _, path := range sysos {
+				os.Remove(path)
+			}
+		}()
+		if err != nil {
+			return ui.Fail(exitError, "Error writing windows resources: %s\n", err)
+		}
+	}
 
-  The operating systems and architectures to cross-compile for may be
-  specified with the "-arch" and "-os" flags. These are space separated lists
-  of valid GOOS/GOARCH values to build for, respectively. You may prefix an
-  OS or Arch with "!" to negate and not build for that platform. If the list
-  is made up of only negations, then the negations will come from the default
-  list.
+	// Obfuscated builds run garble instead of go build, each platform
+	// with its own seed.
+	var garble string
+	garbleSeeds := make(map[string]string)
+	if flagObfuscate {
+		switch {
+		case flagBuilder != "local":
+			return ui.Fail(exitFlags, "-obfuscate can only be used with -builder=local\n")
+		case flagReproducible && flagObfuscateSeed == "":
+			return ui.Fail(exitFlags, "-obfuscate with -reproducible needs an -obfuscate-seed\n")
+		}
+		if garble, err = FindGarble(flagGoCmd); err != nil {
+			return ui.Fail(exitToolchain, "%s\n", err)
+		}
+		for _, p := range platforms {
+			if garbleSeeds[p.String()], err = garbleSeed(flagObfuscateSeed, p); err != nil {
+				return ui.Fail(exitError, "Error making a garble seed: %s\n", err)
+			}
+		}
+	}
 
-  Additionally, the "-osarch" flag may be used to specify complete os/arch
-  pairs that should be built or ignored. The syntax for this is what you would
-  expect: "darwin/amd64" would be a valid osarch value. Multiple can be space
-  separated. An os/arch pair can begin with "!" to not build for that platform.
+	if flagReproducible {
+		if err := setSourceDateEpoch(); err != nil {
+			return ui.Fail(exitFlags, "-reproducible: %s\n", err)
+		}
+		ldflags = reproducibleLdflags(ldflags)
+	}
 
-  The "-osarch" flag has the highest precedent when determing whether to
-  build for a platform. If it is included in the "-osarch" list, it will be
-  built even if the specific os and arch is negated in "-os" and "-arch",
-  respectively.
+	// The release version is resolved once SOURCE_DATE_EPOCH is set, for
+	// CalVer, and before building so that a bad one fails early.
+	appVersion, err := config.Version.Resolve(flagVersion)
+	if err != nil {
+		return ui.Fail(exitError, "Error reading version: %s\n", err)
+	}
+	if err := config.Version.GitFallback(flagVersion); err != nil {
+		// Outside of git the version is 0, which is no use in names
+		templates := append([]string{outputTpl, flagFIPSOutput, flagLatestLink}, flagLdflags.values()...)
+		for _, p := range config.Packages {
+			templates = append(templates, p.Output, p.Ldflags)
+		}
+		switch {
+		case usesVersion(templates...):
+			return ui.Fail(exitFlags, "{{.Version}} is used, but git has no version: %s\n"+
+				"Set -version or the \"version\" section of the config\n", err)
+		case config.Versioned():
+			ui.Warnf("Git has no version, so it is 0: %s\n", err)
+		default:
+			ui.Debugf("Git has no version, so it is 0: %s", err)
+		}
+	}
+	commit := gitCommit()
+	tracer.Attribute("gox.version", appVersion)
 
-Platform Overrides:
+	var state *IncrementalState
+	if flagIncremental != "" {
+		state, err = LoadIncrementalState(flagIncremental)
+		if err != nil {
+			return ui.Fail(exitError, "Error loading incremental state: %s\n", err)
+		}
+	}
 
-  The "-gcflags", "-ldflags" and "-asmflags" options can be overridden per-platform
-  by using environment variables. Gox will look for environment variables
-  in the following format and use those to override values if they exist:
+	// Downloads are shared by every build, so they are done up front
+	// rather than by each build at once.
+	hostOpts := &CompileOpts{
+		GoCmd:      flagGoCmd,
+		Tags:       tags,
+		ModMode:    modMode,
+		ModCacheRW: flagModCacheRW,
+		Test:       flagTest,
+		GoWork:     goWork,
+		GoFlags:    goFlags,
+		NoGoEnv:    flagNoGoEnv,
+		Overlay:    flagOverlay,
+	}
+	var bootstrap Bootstrapper
+	if flagBuilder == "local" {
+		bootstrap.Warm(hostOpts, workspace)
+	}
 
-    GOX_[OS]_[ARCH]_GCFLAGS
-    GOX_[OS]_[ARCH]_LDFLAGS
-    GOX_[OS]_[ARCH]_ASMFLAGS
+	// Code that doesn't build on the host won't build anywhere else, and
+	// finding out takes seconds rather than the whole matrix
+	if flagPreflight {
+		preflightStart := time.Now()
+		ui.Printf("--> Preflight: vetting and building on %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		err := Preflight(hostOpts, mainDirs)
+		tracer.Span("preflight", preflightStart, err, nil)
+		if err != nil {
+			return ui.Fail(exitAllFailed, "Preflight failed, so nothing was built: %s\n", err)
+		}
+	}
+
+	// Remote builds share the source that is sent to the workers
+	var remote *remotePool
+	if flagBuilder == "remote" {
+		workers := config.Workers
+		if workers == nil {
+			workers = &WorkersConfig{}
+		}
+		if flagWorkers != "" {
+			workers.URLs = strings.Split(flagWorkers, ",")
+			if err := workers.Validate(); err != nil {
+				return ui.Fail(exitFlags, "Invalid -workers: %s\n", err)
+			}
+		}
+		if remote, err = newRemotePool(workers); err != nil {
+			return ui.Fail(exitError, "%s\n", err)
+		}
+		defer remote.Close()
+	}
+
+	// The options of every build are worked out up front, so that builds
+	// that would overwrite each other are caught before any of them run.
+	newOpts := func(path string, platform Platform) (*CompileOpts, error) {
+		opts := &CompileOpts{
+			PackagePath:  path,
+			Platform:     platform,
+			OutputTpl:    outputTpl,
+			OutputLayout: flagOutputLayout,
+			Ldflags:      ldflags,
+			Gcflags:      flagGcflags.Value,
+			Asmflags:     flagAsmflags.Value,
+			Tags:         tags,
+			ModMode:      modMode,
+			ModCacheRW:   flagModCacheRW,
+			Cgo:          flagCgo,
+			Rebuild:      flagRebuild,
+			GoCmd:        flagGoCmd,
+			Compiler:     flagCompiler,
+			Test:         flagTest,
+			GoWork:       goWork,
+			Race:         flagRaceFlag,
+			Trimpath:     flagReproducible,
+			BuildMode:    platformBuildMode(flagBuildMode, platform, flagTest),
+			PGO:          flagPGO.Value,
+			GoFlags:      goFlags,
+			NoGoEnv:      flagNoGoEnv,
+			Overlay:      flagOverlay,
+			Static:       flagStatic && !config.Static.allowsDynamic(platform),
+			Strip:        flagStrip,
+			SplitDebug:   flagSplitDebug,
+
+			GoExperiment: flagGoExperiment.Value,
+			Garble:       garble,
+			GarbleFlags:  flagObfuscateFlags,
+			GarbleSeed:   garbleSeeds[platform.String()],
+			Builder:      flagBuilder,
+			BuilderImage: flagBuilderImage,
+			Remote:       remote,
+			Host:         host,
+			AndroidNDK:   androidNDK,
+			AndroidAPI:   flagAndroidAPI,
+			IOSSDK:       xcodeSDKs[platform.String()],
+			IOSVersion:   flagIOSVersion,
+			Version:      appVersion,
+			Commit:       commit,
+		}
+		packageConfig(config.Packages, path).apply(opts)
+		if flagReproducible && opts.Ldflags != ldflags {
+			opts.Ldflags = reproducibleLdflags(opts.Ldflags)
+		}
+
+		// Determine if we have specific CFLAGS or LDFLAGS for this
+		// GOOS/GOARCH combo and override the defaults if so. Those given
+		// on the command line come first.
+		baseLdflags := opts.Ldflags
+		envOverride(&opts.Ldflags, platform, "LDFLAGS")
+		flagLdflags.override(&opts.Ldflags, platform)
+		if flagReproducible && opts.Ldflags != baseLdflags {
+			opts.Ldflags = reproducibleLdflags(opts.Ldflags)
+		}
+		envOverride(&opts.Gcflags, platform, "GCFLAGS")
+		flagGcflags.override(&opts.Gcflags, platform)
+		envOverride(&opts.Asmflags, platform, "ASMFLAGS")
+		flagAsmflags.override(&opts.Asmflags, platform)
+		flagPGO.override(&opts.PGO, platform)
+		flagGoExperiment.override(&opts.GoExperiment, platform)
+		return opts, opts.expandLdflags()
+	}
+
+	// With -fips, each binary is also built as its FIPS variant, or only
+	// as that without -fips-output.
+	var builds []*CompileOpts
+	for _, platform := range platforms {
+		fips := flagFIPS != ""
+		if fips && !fipsSupported(flagFIPS, platform) {
+			ui.Warnf("Skipping the FIPS variant of %s: -fips=%s doesn't support it\n",
+				platform.String(), flagFIPS)
+			fips = false
+		}
+
+		for _, path := range mainDirs {
+			if !packageConfig(config.Packages, path).builds(platform) {
+				continue
+			}
+
+			opts, err := newOpts(path, platform)
+			if err != nil {
+				return ui.Fail(exitError, "Error in the ldflags of %s: %s\n", platform.String(), err)
+			}
+			if flagFIPS == "" || flagFIPSOutput != "" {
+				builds = append(builds, opts)
+			}
+			if fips {
+				variant := *opts
+				variant.FIPS = flagFIPS
+				if flagFIPSOutput != "" {
+					variant.OutputTpl = flagFIPSOutput
+				}
+				builds = append(builds, &variant)
+			}
+		}
+	}
+	if err := checkOutputs(builds); err != nil {
+		return ui.Fail(exitFlags, "%s\n", err)
+	}
+	buildOpts := make(map[string]*CompileOpts)
+	for _, opts := range builds {
+		if output, err := opts.OutputPath(); err == nil {
+			buildOpts[output] = opts
+		}
+	}
+	for _, opts := range builds {
+		err := opts.checkCompiler()
+		if err == nil {
+			err = opts.checkGoExperiment()
+		}
+		if err != nil {
+			return ui.Fail(exitError, "%s: %s\n", opts.PackagePath, err)
+		}
+	}
+	order.Sort(builds, timings)
+
+	// -clean starts the output directory over, so that the binaries of
+	// targets that are no longer built don't linger in it. A directory
+	// that has more than what gox built only loses what gox built into it
+	// last time.
+	outputDir := outputTemplateDir(outputTpl)
+	previous, err := LoadArtifactManifest(outputDir)
+	if err != nil {
+		return ui.Fail(exitError, "Error reading %s: %s\n", filepath.Join(outputDir, manifestName), err)
+	}
+	if flagClean {
+		if err := WipeDir(outputDir); err != nil {
+			ui.Warnf("Not wiping %s: %s, so only the artifacts of the last build are removed\n", outputDir, err)
+			paths := append(previous.Paths(), filepath.Join(outputDir, manifestName))
+			if _, err := CleanPaths(outputDir, paths, false); err != nil {
+				return ui.Fail(exitError, "Error cleaning %s: %s\n", outputDir, err)
+			}
+		}
+		previous = NewArtifactManifest(outputDir)
+	}
+
+	// Files that gox didn't write itself are only replaced with -overwrite,
+	// which removes them first since go build won't replace a file that
+	// isn't a binary, or kept as they are with -skip-existing.
+	skipExisting := make(map[string]bool)
+	if existing := ExistingOutputs(builds, previous, state); len(existing) > 0 {
+		switch {
+		case flagOverwrite:
+			for _, path := range existing {
+				if err := os.Remove(path); err != nil {
+					return ui.Fail(exitError, "Error replacing %s: %s\n", path, err)
+				}
+			}
+		case flagSkipExisting:
+			for _, path := range existing {
+				skipExisting[path] = true
+			}
+		default:
+			return ui.Fail(exitError, "These outputs already exist and weren't written by gox:\n\n  %s\n\n"+
+				"Build with -overwrite to replace them, or -skip-existing to keep them\n",
+				strings.Join(existing, "\n  "))
+		}
+	}
+
+	if flagLatestLink != "" {
+		if _, err := parseOutputTemplate(flagLatestLink); err != nil {
+			return ui.Fail(exitFlags, "Invalid -latest-link template: %s\n", err)
+		}
+	}
+
+	if flagLogDir != "" {
+		if err := os.MkdirAll(flagLogDir, 0755); err != nil {
+			return ui.Fail(exitError, "Error creating log directory: %s\n", err)
+		}
+	}
+
+	// Binaries are run after they are built, under an emulator if needed.
+	// Libraries can't be run.
+	var smoke *SmokeTest
+	if flagSmokeTest != "" && (flagBuildMode == "" || flagBuildMode == "exe" || flagBuildMode == "pie") {
+		smoke = &SmokeTest{Args: strings.Fields(flagSmokeTest), Host: host}
+	}
+
+	// c-shared libraries are already packaged with their headers
+	archives := config.Archives
+	if flagBuildMode == "c-shared" {
+		archives = nil
+	}
+	// The release notes go into the archives and the body of the release
+	var notes string
+	if config.Notes != nil {
+		notes, err = config.Notes.Notes(appVersion)
+		if err != nil {
+			return ui.Fail(exitError, "Error reading release notes: %s\n", err)
+		}
+	}
+	var extra []archiveFile
+	if notes != "" {
+		extra = append(extra, archiveFile{Name: notesName, Data: []byte(notes + "\n"), Mode: 0644})
+	}
+
+	// With -package-parallel, each binary is signed and archived while
+	// the rest are still building
+	var pipeline *PackagePipeline
+	if flagPackageParallel > 0 {
+		pipeline = NewPackagePipeline(flagPackageParallel, func(r BuildResult) ([]pipelineArtifact, error) {
+			var err error
+			switch {
+			case r.Platform.OS == "darwin" && config.Codesign != nil:
+				err = Codesign(config.Codesign, r.Output)
+			case r.Platform.OS == "windows" && config.Authenticode != nil:
+				err = Authenticode(config.Authenticode, r.Output)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var artifacts []pipelineArtifact
+			if archives != nil {
+				path, err := archives.BuildArchive(r, appVersion, extra)
+				if err != nil {
+					return nil, err
+				}
+				artifacts = append(artifacts, pipelineArtifact{Kind: artifactArchive, Path: path})
+				if err := warmSHA256(path); err != nil {
+					return nil, err
+				}
+			}
+			return artifacts, warmSHA256(r.Output)
+		})
+	}
+
+	// Build in parallel!
+	ui.Infof("Number of parallel builds: %d\n\n", parallel)
+	var resultLock, outputLock sync.Mutex
+	var wg sync.WaitGroup
+	errors := make([]string, 0)
+	var allowedErrors []string
+	results := make([]BuildResult, 0, len(builds))
+	var stripSizes []*StripSize
+	semaphore := make(chan int, parallel)
+
+	// The progress view has a line for each build, in place of the lines
+	// printed as each one starts
+	var view *ProgressView
+	if flagInteractive {
+		names := make([]string, len(builds))
+		for i, opts := range builds {
+			names[i] = fmt.Sprintf("%-15s %s", opts.Platform.String(), opts.PackagePath)
+			if opts.FIPS != "" && flagFIPSOutput != "" {
+				names[i] += " (fips)"
+			}
+		}
+		view = NewProgressView(names)
+		view.Color = ui.Color
+		if err := view.Run(); err != nil {
+			return ui.Fail(exitError, "%s\n", err)
+		}
+	}
+
+	// The progress line goes to stderr. When stdout is the same terminal,
+	// what is printed to it goes above the line.
+	var progress *ProgressLine
+	if flagProgress {
+		tty := isTerminal(os.Stderr)
+		_, cols := terminalSize()
+		progress = &ProgressLine{
+			Out:      os.Stderr,
+			Total:    len(builds),
+			Parallel: parallel,
+			TTY:      tty,
+			Capture:  tty && isTerminal(os.Stdout),
+			Width:    cols,
+		}
+		if err := progress.Run(); err != nil {
+			return ui.Fail(exitError, "%s\n", err)
+		}
+	}
+
+	tracer.Attribute("gox.builds", len(builds))
+	for i, opts := range builds {
+		// Start the goroutine that will do the actual build. It takes its
+		// slot first, so that the builds start in the order of -order.
+		semaphore <- 1
+		wg.Add(1)
+		go func(i int, opts *CompileOpts) {
+			defer wg.Done()
+			buildStart := time.Now()
+			platform, path := opts.Platform, opts.PackagePath
+			if progress != nil {
+				progress.Started(platform.String())
+			}
+			switch {
+			case view != nil:
+				view.Started(i)
+			case opts.FIPS != "" && flagFIPSOutput != "":
+				ui.Infof("--> %15s: %s (fips)\n", platform.String(), path)
+			default:
+				ui.Infof("--> %15s: %s\n", platform.String(), path)
+			}
+
+			// Stream the build output as it happens, if requested
+			var streamDone func()
+			if flagStream {
+				opts.Output, streamDone = streamLines(
+					os.Stdout, &outputLock, streamPrefix(platform, ui.Color))
+			} else if view != nil {
+				opts.Output = view.Writer(i)
+			}
+
+			result := BuildResult{
+				Platform:    platform,
+				Path:        path,
+				Annotations: config.ArtifactAnnotations(path),
+			}
+			if opts.FIPS != "" {
+				result.Variant = fipsVariant
+			}
+			result.AllowedFailure = allowFailures.Allowed(platform)
+			result.Output, result.Err = opts.OutputPath()
+
+			// Keep all of the output of the build, with -log-dir
+			var buildLog *os.File
+			if result.Err == nil && flagLogDir != "" {
+				result.Log = filepath.Join(flagLogDir, buildLogName(opts, len(mainDirs) > 1))
+				if buildLog, result.Err = os.Create(result.Log); result.Err == nil {
+					opts.Output = teeOutput(opts.Output, buildLog)
+				}
+			}
+
+			// Keep the output of failed builds for the triage bundle
+			var triageOutput *outputBuffer
+			if flagTriage != "" {
+				triageOutput = &outputBuffer{}
+				opts.Output = teeOutput(opts.Output, triageOutput)
+			}
+
+			if result.Err == nil && flagBuildID {
+				opts.BuildID, result.Err = NewBuildID(opts, versionStr)
+			}
+
+			// An error fingerprinting only means that we can't tell
+			// if the build is up to date, so build anyways.
+			var fingerprint string
+			if result.Err == nil && state != nil {
+				fingerprint, _ = opts.Fingerprint(versionStr)
+				result.UpToDate = fingerprint != "" && !flagRebuild &&
+					state.UpToDate(result.Output, fingerprint)
+			}
+			kept := result.Err == nil && skipExisting[result.Output]
+			if kept {
+				result.UpToDate = true
+			}
+			if result.Err == nil && !result.UpToDate {
+				start := time.Now()
+				result.Err = bootstrap.Retry(platform, func() error {
+					if !flagStrip {
+						return GoCrossCompile(opts)
+					}
+
+					size, err := StripBuild(opts, objcopy)
+					if size != nil {
+						resultLock.Lock()
+						stripSizes = append(stripSizes, size)
+						resultLock.Unlock()
+					}
+					return err
+				})
+				result.Duration = time.Since(start)
+				if result.Err == nil {
+					result.Err = CheckHeader(opts, result.Output)
+				}
+				if result.Err == nil && opts.Garble != "" {
+					_, result.Err = WriteGarbleMap(opts, result.Output)
+				}
+				if result.Err == nil && opts.BuildID != "" && opts.Trimpath {
+					if _, _, err := ReadBuildID(result.Output); err != nil {
+						ui.Warnf("--> %15s: %s has no build ID, since -reproducible leaves -ldflags out "+
+							"of its build info; package main can declare goxBuildID to keep it\n", platform.String(), path)
+					}
+				}
+				if result.Err == nil && flagReproducible {
+					result.Err = setArtifactTime(result.Output)
+				}
+				if result.Err == nil && fingerprint != "" {
+					state.Set(result.Output, fingerprint)
+				}
+			} else if kept && view == nil {
+				ui.Infof("--> %15s: %s already exists, keeping it\n", platform.String(), path)
+			} else if result.UpToDate && view == nil {
+				ui.Infof("--> %15s: %s is up to date\n", platform.String(), path)
+			}
+			if result.Err == nil && smoke != nil {
+				var runner string
+				runner, result.Err = smoke.Run(platform, result.Output)
+				switch {
+				case runner == "":
+					ui.Infof("--> %15s: nothing can run %s here, skipping its smoke test\n", platform.String(), path)
+				case result.Err == nil:
+					ui.Infof("--> %15s: %s passed its smoke test (%s)\n", platform.String(), path, runner)
+				}
+			}
+			if streamDone != nil {
+				streamDone()
+			}
+			if triageOutput != nil && result.Err != nil {
+				result.BuildOutput = triageOutput.String()
+			}
+			if buildLog != nil {
+				if result.Err != nil {
+					fmt.Fprintf(buildLog, "\nerror: %s\n", strings.SplitN(result.Err.Error(), "\n", 2)[0])
+				}
+				buildLog.Close()
+			}
+			if view != nil {
+				view.Finished(i, result)
+			}
+			if progress != nil {
+				progress.Finished(platform.String(), result)
+			}
+			tracer.Build(&result, buildStart)
+
+			resultLock.Lock()
+			defer resultLock.Unlock()
+			results = append(results, result)
+			if pipeline != nil {
+				pipeline.Add(result)
+			}
+			var msg string
+			switch {
+			case result.Err != nil && result.Log != "":
+				msg = fmt.Sprintf("%s error: %s\nThe full output is in %s",
+					ui.Failure(platform.String()), shortError(result.Err, buildLogTail), result.Log)
+			case result.Err != nil:
+				msg = fmt.Sprintf("%s error: %s", ui.Failure(platform.String()), result.Err)
+			}
+			switch {
+			case msg != "" && result.AllowedFailure:
+				allowedErrors = append(allowedErrors, msg)
+			case msg != "":
+				errors = append(errors, msg)
+			}
+			<-semaphore
+		}(i, opts)
+	}
+	wg.Wait()
+	packageFailed := pipeline.Wait()
+	if view != nil {
+		view.Stop()
+	}
+	if progress != nil {
+		progress.Stop()
+	}
+
+	// In a GitHub Actions workflow each platform gets a group of its own,
+	// and compiler errors are shown on the lines they are for
+	if actions := DetectGitHubActions(); actions != nil {
+		if err := actions.Report(results); err != nil {
+			ui.Errorf("Error writing the job summary: %s\n", err)
+		}
+	}
+
+	if flagShardTimings != "" {
+		timings.Record(results)
+		if err := timings.Save(flagShardTimings); err != nil {
+			return ui.Fail(exitError, "Error saving shard timings: %s\n", err)
+		}
+	}
+
+	if state != nil {
+		if err := state.Save(flagIncremental); err != nil {
+			return ui.Fail(exitError, "Error saving incremental state: %s\n", err)
+		}
+	}
+
+	if len(stripSizes) > 0 {
+		sort.Slice(stripSizes, func(i, j int) bool {
+			return stripSizes[i].Output < stripSizes[j].Output
+		})
+		printStripReport(os.Stdout, stripSizes)
+	}
+
+	summary = NewBuildSummary(results)
+
+	// The failures of -allow-failures are only reported, and the rest of
+	// the run goes on without their binaries
+	if len(allowedErrors) > 0 {
+		tracer.Attribute("gox.allowed_failures", len(allowedErrors))
+		ui.Errorf("\n%d allowed failures occurred:\n", len(allowedErrors))
+		for _, err := range allowedErrors {
+			ui.Errorf("--> %s\n", err)
+		}
+	}
+
+	if len(errors) > 0 {
+		tracer.Attribute("gox.errors", len(errors))
+		ui.Fail(exitPartial, "\n%d errors occurred:\n", len(errors))
+		for _, err := range errors {
+			ui.Errorf("--> %s\n", err)
+		}
+
+		status := exitPartial
+		if len(errors)+len(allowedErrors) == len(results) {
+			status = exitAllFailed
+		}
+		if flagTriage != "" {
+			failures := make([]BuildResult, 0, len(errors))
+			for _, r := range results {
+				if r.Err != nil {
+					failures = append(failures, r)
+				}
+			}
+
+			bundle := &TriageBundle{
+				GoCmd:     flagGoCmd,
+				GoVersion: versionStr,
+				Flags:     flags,
+				Platforms: platforms,
+				Packages:  mainDirs,
+				Failures:  failures,
+			}
+			if err := bundle.Write(flagTriage); err != nil {
+				ui.Errorf("\nError writing triage bundle: %s\n", err)
+			} else {
+				ui.Errorf("\nTriage bundle written to %s\n", flagTriage)
+			}
+		}
+		return status
+	}
+
+	if packageFailed > 0 {
+		return ui.Fail(exitError, "\n%d binaries failed to be packaged\n", packageFailed)
+	}
+
+	if len(allowedErrors) > 0 {
+		built := make([]BuildResult, 0, len(results))
+		for _, r := range results {
+			if r.Err == nil {
+				built = append(built, r)
+			}
+		}
+		results = built
+	}
+
+	if state != nil && summary.UpToDate {
+		ui.Printf("\nAll binaries are up to date\n")
+		return exitUpToDate
+	}
+
+	if flagDarwinUniversal {
+		tpl := flagDarwinUniversalOutput
+		if tpl == "" {
+			tpl = outputTpl
+		}
+
+		// Find the darwin/amd64 and darwin/arm64 binaries of each package.
+		// With both variants of -fips, they are the standard ones.
+		var variant string
+		if flagFIPS != "" && flagFIPSOutput == "" {
+			variant = fipsVariant
+		}
+		thin := make(map[string][]string)
+		rebuilt := make(map[string]bool)
+		for _, r := range results {
+			if r.Platform.OS == "darwin" && (r.Platform.Arch == "amd64" || r.Platform.Arch == "arm64") &&
+				r.Variant == variant {
+				thin[r.Path] = append(thin[r.Path], r.Output)
+				rebuilt[r.Path] = rebuilt[r.Path] || !r.UpToDate
+			}
+		}
+
+		ui.Infof("\nBuilding universal binaries:\n\n")
+		for _, path := range mainDirs {
+			if len(thin[path]) != 2 {
+				ui.Infof("--> Skipping %s: darwin/amd64 and darwin/arm64 weren't both built\n", path)
+				continue
+			}
+
+			opts := &CompileOpts{
+				PackagePath:  path,
+				Platform:     Platform{OS: "darwin", Arch: "universal"},
+				OutputTpl:    tpl,
+				OutputLayout: flagOutputLayout,
+				Version:      appVersion,
+				Commit:       commit,
+			}
+			output, err := opts.OutputPath()
+			if err != nil {
+				return ui.Fail(exitError, "--> darwin/universal error: %s\n", err)
+			}
+
+			// The universal binary is up to date if neither half was
+			// rebuilt since it was made.
+			_, statErr := os.Stat(output)
+			upToDate := !rebuilt[path] && statErr == nil
+			if upToDate {
+				ui.Infof("--> %15s: %s is up to date\n", opts.Platform.String(), path)
+			} else {
+				ui.Infof("--> %15s: %s\n", opts.Platform.String(), path)
+				err := MakeUniversal(output, thin[path]...)
+				if err == nil && flagReproducible {
+					err = setArtifactTime(output)
+				}
+				if err != nil {
+					return ui.Fail(exitError, "--> darwin/universal error: %s\n", err)
+				}
+			}
+
+			// Later stages treat the universal binary like any other
+			// darwin binary.
+			results = append(results, BuildResult{
+				Platform:    opts.Platform,
+				Path:        path,
+				Output:      output,
+				UpToDate:    upToDate,
+				Annotations: config.ArtifactAnnotations(path),
+				Variant:     variant,
+			})
+		}
+	}
+
+	// Everything that is built from here on is recorded in the manifest.
+	// The packages of up to date binaries aren't made again, so they are
+	// carried over from the last manifest, and so are the artifacts of the
+	// targets that this run didn't build.
+	manifest := NewArtifactManifest(outputDir)
+	manifest.Keep(previous)
+	manifest.Version = appVersion
+	manifest.Commit = commit
+	manifest.GoVersion = versionStr
+	manifest.Started = started.UTC().Format(time.RFC3339)
+	for _, r := range results {
+		manifest.AddResult(r, buildOpts[r.Output])
+		if r.UpToDate {
+			manifest.Carry(previous, r)
+		}
+		for _, a := range pipeline.Artifacts(r) {
+			manifest.Add(a.Kind, &r, a.Path)
+		}
+	}
+
+	if config.Codesign != nil {
+		limit := stageLimit(config.Concurrency.Sign, parallel)
+		if runStage("Signing darwin binaries", "signing", limit, "darwin", pipeline.Rest(results), func(r BuildResult) error {
+			return Codesign(config.Codesign, r.Output)
+		}) > 0 {
+			return exitError
+		}
+	}
+
+	if config.Authenticode != nil {
+		limit := stageLimit(config.Concurrency.Sign, parallel)
+		if runStage("Signing windows binaries", "signing", limit, "windows", pipeline.Rest(results), func(r BuildResult) error {
+			return Authenticode(config.Authenticode, r.Output)
+		}) > 0 {
+			return exitError
+		}
+	}
+
+	if flagBuildMode == "c-shared" {
+		cshared := config.CShared
+		if cshared == nil {
+			cshared = &CSharedConfig{}
+		}
+		if cshared.Version == "" && config.Version != nil {
+			cshared.Version = appVersion
+		}
+		cshared.resolveVersion()
+
+		limit := stageLimit(config.Concurrency.Package, parallel)
+		if runStage("Packaging shared libraries", "package", limit, "", results, func(r BuildResult) error {
+			path, err := CSharedPackage(cshared, r)
+			if err == nil {
+				manifest.Add(artifactPackage, &r, path)
+			}
+			return err
+		}) > 0 {
+			return exitError
+		}
+
+		if config.Wheel != nil {
+			if runStage("Building Python wheels", "wheel", limit, "", results, func(r BuildResult) error {
+				path, err := BuildWheel(config.Wheel, r)
+				if err == nil {
+					manifest.Add(artifactPackage, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+
+		if config.Npm != nil {
+			ui.Infof("\nBuilding npm packages:\n\n")
+			paths, err := BuildNpmPackages(config.Npm, results)
+			for _, path := range paths {
+				ui.Infof("--> %s\n", path)
+				manifest.Add(artifactPackage, nil, path)
+			}
+			if err != nil {
+				return ui.Fail(exitError, "--> npm error: %s\n", err)
+			}
+		}
+	}
+
+	if archives != nil || config.Checksums != nil {
+		if archives != nil {
+			limit := stageLimit(config.Concurrency.Archive, parallel)
+			if runStage("Building archives", "archive", limit, "", pipeline.Rest(results), func(r BuildResult) error {
+				path, err := archives.BuildArchive(r, appVersion, extra)
+				if err == nil {
+					manifest.Add(artifactArchive, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+
+		// The checksums cover the archives if there are any, which for
+		// up to date binaries are those of an earlier run.
+		dir := "."
+		files := make([]string, 0, len(results))
+		for _, r := range results {
+			path := r.Output
+			if archives != nil {
+				dir = archives.output()
+				path, _ = archives.Path(r, appVersion)
+			}
+			files = append(files, path)
+		}
+
+		if config.Checksums != nil && len(files) > 0 {
+			path, err := config.Checksums.WriteChecksums(dir, files, appVersion)
+			if err != nil {
+				return ui.Fail(exitError, "Error writing checksums: %s\n", err)
+			}
+			manifest.Add(artifactChecksums, nil, path)
+			ui.Printf("\nWrote checksums to %s\n", path)
+		}
+	}
+
+	// The manifests of package managers point at the archives, and with
+	// -publish are pushed to their repositories. The pushes wait until the
+	// uploads and the release have succeeded, so that a tap or bucket never
+	// points at archives that were not published.
+	var pushes []func() int
+	if archives != nil {
+		written := func(title string, paths []string, err error, repo *RepoConfig, dir, message string) int {
+			if err != nil {
+				return ui.Fail(exitError, "Error writing %s: %s\n", title, err)
+			}
+			for _, path := range paths {
+				manifest.Add(artifactPkgManifest, nil, path)
+			}
+			ui.Printf("\nWrote %s to %s\n", title, strings.Join(paths, ", "))
+			if !flagPublish || repo == nil {
+				return 0
+			}
+
+			pushes = append(pushes, func() int {
+				pushed, err := PushToRepo(repo, repo.directory(dir), paths, message)
+				if err != nil {
+					return ui.Fail(exitPublish, "Error pushing %s: %s\n", title, err)
+				}
+				if pushed {
+					ui.Printf("Pushed %s to %s\n", title, repo.Repository)
+				} else {
+					ui.Printf("%s in %s is up to date\n", title, repo.Repository)
+				}
+				return 0
+			})
+			return 0
+		}
+
+		if c := config.Homebrew; c != nil {
+			path, err := WriteHomebrewFormula(c, archives, results, appVersion)
+			name := strings.TrimSuffix(filepath.Base(path), ".rb")
+			if status := written("Homebrew formula", []string{path}, err, c.Tap, "Formula", name+" "+appVersion); status != 0 {
+				return status
+			}
+		}
+		if c := config.Scoop; c != nil {
+			path, err := WriteScoopManifest(c, archives, results, appVersion)
+			name := strings.TrimSuffix(filepath.Base(path), ".json")
+			if status := written("Scoop manifest", []string{path}, err, c.Bucket, "bucket", name+" "+appVersion); status != 0 {
+				return status
+			}
+		}
+		if c := config.Winget; c != nil {
+			paths, err := WriteWingetManifests(c, archives, results, appVersion)
+			if status := written("winget manifests", paths, err, c.Repository, c.directory(appVersion),
+				"New version: "+c.Identifier+" version "+appVersion); status != 0 {
+				return status
+			}
+		}
+		if c := config.Aur; c != nil {
+			paths, err := WriteAurPackage(c, archives, results, appVersion)
+			if status := written("AUR package", paths, err, c.Repository, ".",
+				fmt.Sprintf("Update to %s-%d", aurVersion(appVersion), c.release())); status != 0 {
+				return status
+			}
+		}
+		if c := config.Chocolatey; c != nil {
+			path, err := BuildChocolateyPackage(c, archives, results, appVersion)
+			if status := written("Chocolatey package", []string{path}, err, nil, "", ""); status != 0 {
+				return status
+			}
+		}
+	}
+
+	if flagTree != "" {
+		if err := InstallTree(flagTree, results); err != nil {
+			return ui.Fail(exitError, "Error installing to %s: %s\n", flagTree, err)
+		}
+		ui.Printf("\nInstalled binaries to %s\n", flagTree)
+	}
+
+	if flagFatArchive != "" {
+		if err := WriteFatArchive(flagFatArchive, results); err != nil {
+			return ui.Fail(exitError, "Error writing %s: %s\n", flagFatArchive, err)
+		}
+		manifest.Add(artifactFatArchive, nil, flagFatArchive)
+		ui.Printf("\nWrote all binaries to %s\n", flagFatArchive)
+	}
+
+	if config.Nfpm != nil {
+		limit := stageLimit(config.Concurrency.Package, parallel)
+		if runStage("Building packages", "package", limit, "linux", results, func(r BuildResult) error {
+			paths, err := NfpmPackage(config.Nfpm, r.Output, r.Platform)
+			for _, path := range paths {
+				manifest.Add(artifactPackage, &r, path)
+			}
+			return err
+		}) > 0 {
+			return exitError
+		}
+	}
+
+	// Snaps and AppImages are made for the linux arches that both run on
+	if config.Snap != nil || config.AppImage != nil {
+		var apps []BuildResult
+		for _, r := range results {
+			if r.Platform.OS == "linux" && (r.Platform.Arch == "amd64" || r.Platform.Arch == "arm64") {
+				apps = append(apps, r)
+			}
+		}
+
+		limit := stageLimit(config.Concurrency.Package, parallel)
+		if config.Snap != nil {
+			if runStage("Building snaps", "snap", limit, "linux", apps, func(r BuildResult) error {
+				path, err := SnapPackage(config.Snap, config.Desktop, r.Output, r.Platform, appVersion)
+				if err == nil {
+					manifest.Add(artifactPackage, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+		if config.AppImage != nil {
+			if runStage("Building AppImages", "appimage", limit, "linux", apps, func(r BuildResult) error {
+				path, err := AppImagePackage(config.AppImage, config.Desktop, r.Output, r.Platform, appVersion)
+				if err == nil {
+					manifest.Add(artifactPackage, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+	}
+
+	if installer := config.Installer; installer != nil {
+		limit := stageLimit(config.Concurrency.Package, parallel)
+		if installer.MSI != nil {
+			var windows []BuildResult
+			for _, r := range results {
+				if _, ok := msiArches[r.Platform.Arch]; ok && r.Platform.OS == "windows" {
+					windows = append(windows, r)
+				}
+			}
+			if runStage("Building MSIs", "msi", limit, "windows", windows, func(r BuildResult) error {
+				path, err := BuildMSI(installer, r.Output, r.Platform, appVersion)
+				if err == nil {
+					manifest.Add(artifactPackage, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+		if installer.DMG != nil {
+			if runStage("Building DMGs", "dmg", limit, "darwin", results, func(r BuildResult) error {
+				path, err := BuildDMG(installer, r.Output, r.Platform, appVersion)
+				if err == nil {
+					manifest.Add(artifactPackage, &r, path)
+				}
+				return err
+			}) > 0 {
+				return exitError
+			}
+		}
+	}
+
+	// The links are made last, once nothing else is going to change the
+	// binaries, for up to date ones too. With both variants of -fips
+	// they point at the standard binaries.
+	if flagLatestLink != "" {
+		ui.Infof("\nLinking latest binaries:\n\n")
+		for _, r := range results {
+			if r.Err != nil || r.Variant != "" && flagFIPSOutput != "" {
+				continue
+			}
+
+			opts := &CompileOpts{
+				PackagePath:  r.Path,
+				Platform:     r.Platform,
+				OutputTpl:    flagLatestLink,
+				OutputLayout: flagOutputLayout,
+				BuildMode:    platformBuildMode(flagBuildMode, r.Platform, flagTest),
+				Version:      appVersion,
+				Commit:       commit,
+			}
+			link, err := opts.OutputPath()
+			if err == nil {
+				err = LatestLink(link, r.Output)
+			}
+			if err != nil {
+				return ui.Fail(exitError, "--> %s latest link error: %s\n", ui.Failure(r.Platform.String()), err)
+			}
+			manifest.Add(artifactLink, &r, link)
+			ui.Infof("--> %15s: %s -> %s\n", r.Platform.String(), link, filepath.Base(r.Output))
+		}
+	}
+
+	// Signatures go after everything that they may be of
+	if c := config.Sign; c != nil {
+		artifacts, paths := c.Artifacts(manifest)
+		if len(artifacts) > 0 {
+			ui.Infof("\nSigning with %s:\n\n", c.Key)
+		}
+		var lock sync.Mutex
+		var failed int
+		runParallel(stageLimit(config.Concurrency.Sign, parallel), len(artifacts), func(i int) {
+			path, err := c.Sign(paths[i])
+			if err != nil {
+				lock.Lock()
+				defer lock.Unlock()
+				ui.Errorf("--> %s sign error: %s\n", ui.Failure(artifacts[i].Path), err)
+				failed++
+				return
+			}
+			manifest.AddFor(artifactSignature, artifacts[i], path)
+			ui.Infof("--> %s: %s\n", artifacts[i].Path, path)
+		})
+		if failed > 0 {
+			return ui.Fail(exitError, "%d artifacts failed to sign\n", failed)
+		}
+	}
+
+	manifest.Duration = float64(time.Since(started).Round(time.Millisecond)) / float64(time.Second)
+	if _, err := manifest.Write(); err != nil {
+		return ui.Fail(exitError, "Error writing %s: %s\n", manifestName, err)
+	}
+
+	// Uploads go last, once the manifest has the checksums of everything
+	if flagPublish {
+		for _, upload := range config.Uploads {
+			artifacts, paths := upload.Uploads(manifest)
+			if len(artifacts) == 0 {
+				continue
+			}
+
+			ui.Infof("\nUploading to %s:\n\n", upload.Name)
+			var lock sync.Mutex
+			var failed int
+			runParallel(stageLimit(config.Concurrency.Upload, parallel), len(artifacts), func(i int) {
+				url, err := upload.URLFor(artifacts[i], appVersion)
+				if err == nil && upload.Uploaded(paths[i], url) {
+					ui.Infof("--> %s: already uploaded\n", artifacts[i].Path)
+					return
+				}
+				if err == nil {
+					err = upload.Upload(paths[i], url)
+				}
+				if err != nil {
+					lock.Lock()
+					defer lock.Unlock()
+					ui.Errorf("--> %s upload error: %s\n", ui.Failure(artifacts[i].Path), err)
+					failed++
+					return
+				}
+				ui.Infof("--> %s: %s\n", artifacts[i].Path, url)
+			})
+			if failed > 0 {
+				return ui.Fail(exitPublish, "%d uploads to %s failed\n", failed, upload.Name)
+			}
+		}
+
+		if c := config.Release; c != nil {
+			ui.Infof("\nReleasing on %s:\n\n", c.Forge)
+			release, err := c.CreateRelease(appVersion, notes)
+			if err != nil {
+				return ui.Fail(exitPublish, "Error creating the release: %s\n", err)
+			}
+
+			artifacts, paths := c.Artifacts(manifest)
+			var lock sync.Mutex
+			var failed int
+			runParallel(stageLimit(config.Concurrency.Upload, parallel), len(artifacts), func(i int) {
+				uploaded, err := c.Uploaded(release, paths[i], appVersion)
+				if err == nil && uploaded {
+					ui.Infof("--> %s: already uploaded\n", artifacts[i].Path)
+					return
+				}
+				if err == nil {
+					err = c.UploadAsset(release, paths[i], appVersion)
+				}
+				if err != nil {
+					lock.Lock()
+					defer lock.Unlock()
+					ui.Errorf("--> %s release error: %s\n", ui.Failure(artifacts[i].Path), err)
+					failed++
+					return
+				}
+				ui.Infof("--> %s\n", artifacts[i].Path)
+			})
+			if failed > 0 {
+				return ui.Fail(exitPublish, "%d release assets failed to upload\n", failed)
+			}
+			ui.Printf("Released %s: %s\n", release.Tag, release.URL)
+		}
+
+		if len(pushes) > 0 {
+			ui.Printf("\n")
+		}
+		for _, push := range pushes {
+			if status := push(); status != 0 {
+				return status
+			}
+		}
+	}
+
+	return 0
+}
+
+func printUsage() {
+	ui.Errorf(helpText)
+}
+
+const helpText = `Usage: gox [options] [packages]
+       gox <command> [options] [args]
+
+  Gox cross-compiles Go applications in parallel.
+
+  If no specific operating systems or architectures are specified, Gox
+  will build for all pairs supported by your version of Go.
+
+Commands:
+
+  clean               Remove the binaries and artifacts of earlier builds
+  completion          Print a shell completion script for bash, zsh, fish or powershell
+  doctor              Check the environment before a build
+  image               Push linux binaries as a multi-platform container image
+  import              Translate a goreleaser config into a gox config file
+  init                Write a config file for a kind of release from a template
+  inspect             Print how binaries and archives of them were built
+  list                List the supported platforms, as text, JSON or CSV
+  matrix              Print the platforms to build as a CI matrix
+  promote             Copy a checked release from one channel to another
+  serve               Run an HTTP API that builds submitted modules (experimental)
+  sizes               Compare the sizes of a build with an earlier one or a release
+  toolchains          Bundle and restore toolchains for offline builds
+  verify              Check the build IDs of binaries against their manifest
+  verify-reproducible Build twice and check that the binaries are identical
+  worker              Run a worker for -builder=remote builds (experimental)
+
+  Run "gox <command> -h" for help with a command.
+
+Options:
+
+  -allow-failures=""  Comma-separated os/arch patterns, such as "android/*",
+                      whose failed builds don't fail the run
+  -android-api=21     Android API level of android builds with cgo (see below)
+  -arch=""            Space-separated list of architectures to build for
+  -bandwidth-limit="" Most bytes per second that -publish uploads with, all
+                      together, such as 512K or 10M, to "uploads" and the
+                      "release" (not git pushes or "gox image")
+  -build-id           Link a build ID into each binary, for "gox verify"
+                      (see below)
+  -build-toolchain    Build cross-compilation toolchain
+  -buildmode=""       Build mode: exe, pie, c-archive, c-shared or plugin
+  -builder="local"    Where to run builds: local, docker, podman, or remote
+  -builder-image=""   Container image for docker/podman builds, defaults to
+                      the official golang image for your Go version
+  -cgo                Sets CGO_ENABLED=1, requires proper C toolchain (advanced)
+  -require-cgo        Like -cgo, but fail first if a platform doesn't support it
+  -skip-cgo-unsupported
+                      With -cgo, skip the platforms that don't support it
+  -check-unsupported  Warn about platforms that the packages can't be built for
+  -clean              Remove what earlier builds wrote to the output dir first
+  -color              Colorize output even when stderr isn't a terminal
+  -compiler="gc"      Compiler to build with: gc, gccgo, or tinygo (see below)
+  -config=""          Config file, defaults to gox.json if it exists
+  -debug              Print every command that is run, and its environment
+  -darwin-universal   Merge darwin/amd64 and darwin/arm64 into a universal binary
+  -darwin-universal-output=""
+                      Output path template for universal binaries, defaults
+                      to "-output" with an Arch of "universal"
+  -enable-experimental=""
+                      Comma-separated list of experiments to enable
+  -fat-archive=""     Also write every binary with launchers to one archive
+  -fips=""            Build FIPS binaries: boringcrypto, or a GOFIPS140 value
+  -fips-output=""     Also build the standard binaries, with FIPS ones here
+  -gcflags=""         Additional '-gcflags' value to pass to go build, or
+                      os/arch=flags for one platform (see below)
+  -host=""            Host os/arch, overrides detection (see below)
+  -interactive        Pick the platforms and watch the builds in the terminal
+  -ios-version=12.0   Oldest iOS version that ios builds run on (see below)
+  -incremental=""     Skip binaries that are up to date, using this state file
+  -json               Write a JSON summary of the build to stdout
+  -latest-link=""     Also link each binary from this output path template,
+                      without {{.Version}}, for names that don't change
+  -ldflags=""         Additional '-ldflags' value to pass to go build
+  -log-dir=""         Write the full output of each build to a file in this dir
+  -asmflags=""        Additional '-asmflags' value to pass to go build
+  -strip              Strip symbols and debug info, reporting the size saved
+  -tags=""            Additional '-tags' value to pass to go build
+  -tier=0             Only build ports of this tier or better (see below)
+  -only-first-class   Only build first-class ports, like -tier=1
+  -test               Build test binaries with "go test -c" (see below)
+  -tree=""            Also install binaries into per-platform trees in this dir
+  -triage=""          On failure, write a triage.tar.gz bundle to this path
+  -mod=""             Additional '-mod' value to pass to go build: mod,
+                      readonly or vendor, which is the default when there
+                      is a vendor directory
+  -modcacherw         Leave the modules that builds download writable
+  -no-goenv           Ignore the settings of "go env -w" in the builds
+  -order=""           Order to start the builds in (see below)
+  -os=""              Space-separated list of operating systems to build for
+  -obfuscate          Obfuscate the binaries with garble (see below)
+  -obfuscate-flags="" Flags for garble, such as "-literals -tiny"
+  -obfuscate-seed=""  Base of the garble seed of each platform, random if unset
+  -osarch=""          Space-separated list of os/arch pairs to build for
+  -osarch-file=""     File of os/arch pairs to build for, one per line
+  -armarch=""         Space-separated list of GOARM versions to build for when
+                      arch is "arm", such as "6 7"
+  -osarch-list        List supported os/arch pairs for your Go version, see
+                      "gox list" for machine-readable output
+  -output="foo"       Output path template. See below for more info
+  -output-layout="flat"
+                      "dir" puts each platform in a directory of its own
+  -overwrite          Replace outputs that exist but weren't built by gox
+  -skip-existing      Keep outputs that exist but weren't built by gox, as
+                      if they were up to date
+  -otel               Export a trace of the builds with OTLP (see below)
+  -package-parallel=0 Sign and archive binaries N at a time as they are built,
+                      instead of after every build (see below)
+  -parallel=-1        Amount of parallelism, defaults to number of CPUs
+  -progress           Show how many builds are done and an ETA on stderr
+  -publish            Push package manager manifests and upload artifacts
+                      to the repositories, "uploads" and "release" of the
+                      config
+  -overlay=""         -overlay file of go build, to replace source files
+  -pgo=""             Profile for profile-guided optimization (see below)
+  -preflight          Vet and build on the host before building for every
+                      platform, and stop if that fails
+  -print-targets      Print the platforms that would be built, once each, and
+                      exit
+  -quiet              Only print failures and the final summary
+  -race               Build with the go race detector enabled, requires CGO
+  -gocmd="go"         Build command, defaults to Go
+  -goexperiment=""    GOEXPERIMENT of the builds, or os/arch=value for one
+  -goflags=""         GOFLAGS of the builds instead of the user's, "" clears
+                      it (see below)
+  -go-version=""      Build with this Go release, such as 1.22.4, downloading
+                      it if needed. "mod" reads it from go.mod (see below)
+  -rebuild            Force rebuilding of package that were up to date
+  -reproducible       Build bit-for-bit reproducible binaries (see below)
+  -shard=""           Only build this part of the platforms, such as 2/5
+  -shard-timings=""   Balance shards by the build times in this file
+  -skip-unsupported   Skip the platforms that the packages can't be built for
+  -smoke-test=""      Run each binary with these args after building (see below)
+  -split-debug        With -strip, keep ELF debug info in .debug files
+  -static             Link statically, failing binaries that aren't (see below)
+  -stream             Stream build output as it happens, prefixed by platform
+  -verbose            Verbose mode
+  -version=""         Release version, defaults to "git describe --tags
+                      --always --dirty" without the "v" (see below)
+  -workers=""         Comma-separated URLs of the workers of -builder=remote
+  -workspace-module=""
+                      In a go.work workspace, only build this module (repeatable)
+
+Output path template:
+
+  The output path for the compiled binaries is specified with the
+  "-output" flag. The value is a string that is a Go text template.
+  The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}". The variables and
+  their values should be self-explanatory: {{.Dir}}, {{.OS}}, {{.Arch}}
+  (with the GOARM or level, such as "armv7"), {{.ARM}} ("v7"),
+  {{.ARMVersion}} ("7"), {{.Level}}, {{.Version}}, the release version,
+  {{.Commit}}, the abbreviated git commit, and {{.Ext}}, the extension of
+  the binary, which is added unless the template ends with it.
+
+  The template can use these functions:
+
+    lower, upper          Change the case, as in {{.OS | upper}}
+    replace OLD NEW       Replace OLD, as in {{.OS | replace "darwin" "macos"}}
+    trimprefix, trimsuffix
+                          Trim a prefix or suffix, as in {{.Dir | trimsuffix "d"}}
+    date LAYOUT           The build time in a Go time layout, as in
+                          {{date "20060102"}}, from SOURCE_DATE_EPOCH if set
+    major, minor, patch   A part of a version, as in {{major .Version}}
+
+  So "dist/{{.Dir}}_v{{.Version}}_{{.OS}}_{{.Arch}}" names a binary
+  "dist/myapp_v1.2.3_linux_armv7".
+
+  "-output-layout=dir" gives each platform a directory of its own, named
+  after it, with the binaries in it under their own names: the template
+  "dist/{{.Dir}}_{{.OS}}_{{.Arch}}" writes "dist/linux_amd64/myapp" and
+  "dist/windows_amd64/myapp.exe". It applies to every output template,
+  including "-latest-link" and those of the config, unless the template
+  already has a directory per platform. Archives, packages and uploads
+  use the binaries wherever they are.
+
+  The release version is "git describe --tags --always --dirty" without
+  the "v", such as "1.2.3" on a tag, "1.2.3-4-gdeadbee-dirty" after it, or
+  the abbreviated commit without tags, unless the "version" section of the
+  config says otherwise, and "-version" overrides both. Outside of git it
+  is 0, and using {{.Version}} in a template is an error. It is the same
+  everywhere: the output templates, the archive names and the packages
+  publish it with. "-ldflags" are a template like the
+  output path, so the binaries can have it without a Makefile:
+
+    gox -ldflags="-X main.version={{.Version}} -X main.commit={{.Commit}}"
+
+  "-latest-link" is a second template, without the version, that each
+  binary is linked from once everything else is done, so that a download
+  endpoint can always use the same name:
+
+    gox -output="dist/{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}" \
+        -latest-link="dist/{{.Dir}}_{{.OS}}_{{.Arch}}"
+
+  The links are relative symlinks, or copies on Windows.
+
+  Every file that a build writes is recorded in gox-manifest.json, in the
+  fixed part of the output path before its first variable, such as "dist"
+  for "dist/{{.OS}}/{{.Dir}}", with its target, size and SHA-256, and for
+  binaries the flags they were built with and how long that took. The
+  version, commit and Go version of the build are at the top, so release
+  tooling can read what was built from the one file rather than look
+  through the directory. "gox clean" removes the files again, and with
+  "-clean" a build first wipes the directory, or if it is the current
+  directory or one of its parents, removes what the last build recorded.
+
+  Every build must have a path of its own. If two would write the same
+  one, such as a template without {{.Arch}} for more than one arch, gox
+  fails before building and lists them, rather than letting one overwrite
+  the other.
+
+  An output that already exists is only replaced if gox wrote it, as
+  recorded in gox-manifest.json or the "-incremental" state, so that a new
+  template can't clobber binaries that were published before. Otherwise
+  gox fails before building and lists them: "-overwrite" replaces them
+  anyway, and "-skip-existing" keeps them and treats their builds as up
+  to date, so that they are still archived and packaged.
+
+Platforms (OS/Arch):
+
+  The operating systems and architectures to cross-compile for may be
+  specified with the "-arch" and "-os" flags. These are space separated lists
+  of valid GOOS/GOARCH values to build for, respectively. You may prefix an
+  OS or Arch with "!" to negate and not build for that platform. If the list
+  is made up of only negations, then the negations will come from the default
+  list.
+
+  Additionally, the "-osarch" flag may be used to specify complete os/arch
+  pairs that should be built or ignored. The syntax for this is what you would
+  expect: "darwin/amd64" would be a valid osarch value. Multiple can be space
+  separated. An os/arch pair can begin with "!" to not build for that platform.
+
+  A long list of targets can be kept in a file in the repository instead,
+  and read with "-osarch-file=targets.txt". It has one pair of the
+  "-osarch" syntax per line, with micro-architecture levels (see below),
+  and anything after a "#" is a comment:
+
+    # Shipped to customers
+    linux/amd64v3
+    linux/arm64
+    linux/armv7        # Raspberry Pi 2 and up
+    windows/amd64
+    !windows/arm
+
+  The pairs are added to those of "-osarch", which can be given too.
+
+  An arm arch without a GOARM version, as in "linux/arm" or "-arch=arm",
+  stands for every version that Go supports on the OS, armv5 to armv7,
+  and "linux/armv6+" for armv6 and above. "-armarch" limits them, and the
+  default platforms, to the versions it lists, so that "-armarch=7" only
+  builds armv7. A pair with a version, such as "linux/armv5", is built as
+  given.
+
+  The "host" and "native" aliases may be used in "-osarch" to refer to the
+  platform Gox is running on. The host platform also decides whether cgo
+  is enabled by default. It is detected from the running Gox binary, which
+  is wrong under emulation (an amd64 container on an arm64 machine, say),
+  so it can be declared with "-host" or the GOX_HOST_PLATFORM environment
+  variable, in os/arch form.
+
+  An arch may end with a micro-architecture level, which sets GOAMD64,
+  GOARM64, GORISCV64, GO386, GOPPC64, GOMIPS or GOMIPS64 for the build and
+  is part of {{.Arch}} in output paths ({{.Level}} has the level alone):
+
+    linux/amd64v3       amd64 levels v1 to v4
+    linux/arm64v8.2     arm64 levels v8.0 to v9.5
+    linux/riscv64rva22u64
+                        riscv64 levels rva20u64, rva22u64 and rva23u64
+    linux/386sse2       386 levels sse2 and softfloat
+    linux/ppc64lepower9 ppc64 and ppc64le levels power8, power9 and power10
+    linux/mipsle-softfloat
+                        mips, mipsle, mips64 and mips64le hardfloat and
+                        softfloat, for routers without an FPU
+    linux/armv7-softfloat
+                        the float ABI of arm, hardfloat or softfloat, which
+                        is added to GOARM as in GOARM=7,softfloat (Go 1.22
+                        and later); "linux/armv7,softfloat" is the same
+
+  The "-osarch" flag has the highest precedent when determing whether to
+  build for a platform. If it is included in the "-osarch" list, it will be
+  built even if the specific os and arch is negated in "-os" and "-arch",
+  respectively.
+
+Port Tiers:
+
+  The Go porting policy splits ports into first-class ports, which the Go
+  team keeps working and releases are blocked on, and secondary ports,
+  which are kept working by their maintainers. "-tier=1", or
+  "-only-first-class", leaves out secondary ports, even if they are asked
+  for with "-os" or "-osarch", for releases that only ship what Go
+  supports officially. The first-class ports are darwin/amd64,
+  darwin/arm64, linux/386, linux/amd64, linux/arm, linux/arm64,
+  windows/386 and windows/amd64. "gox list" shows the tier of each port.
+
+Cgo Support:
+
+  Not every port supports cgo: js/wasm, plan9, wasip1 and a few others
+  don't. With "-cgo" such ports fail partway through the build, so
+  "-require-cgo" checks all of the platforms first and fails before
+  anything is built, and "-skip-cgo-unsupported" leaves them out with a
+  warning instead. "gox list -cgo-supported" shows the ports that do.
+
+Unsupported Platforms:
+
+  A package that imports one whose build constraints leave out all of its
+  files for a platform, or a package that doesn't exist there, can't be
+  built for it. "-check-unsupported" lists the packages and their imports
+  with "go list" for every platform before building, and warns about those
+  that can't be built, and "-skip-unsupported" leaves them out instead, so
+  that the rest of the platforms still build. Errors that only the
+  compiler finds, such as calling syscall.EpollWait on darwin, are still
+  left for the build to report.
+
+  Ports that are expected to break now and then, such as in nightly
+  builds, can be made best effort with "-allow-failures", a list of os/arch
+  patterns where "*" matches anything:
+
+    $ gox -allow-failures="android/*,plan9/*" ./...
+
+  Their failures are printed as allowed failures, have "allowed_failure"
+  in the "-json" summary and are left out of the packages, archives and
+  checksums, but the rest of the run goes on and exits with status 0.
+
+Platform Overrides:
+
+  The "-gcflags", "-ldflags" and "-asmflags" options can be overridden per-platform
+  by giving them again as "os/arch=flags". An arch with its GOARM or level,
+  such as linux/armv7, takes precedence over the arch alone:
+
+    $ gox -ldflags="-s -w" -ldflags="windows/amd64=-s -w -H windowsgui" \
+        -gcflags="linux/arm=-N -l"
+
+  They can also be overridden with environment variables. Gox will look for
+  environment variables in the following format and use those to override
+  values if they exist, unless the flag sets the platform too:
+
+    GOX_[OS]_[ARCH]_GCFLAGS
+    GOX_[OS]_[ARCH]_LDFLAGS
+    GOX_[OS]_[ARCH]_ASMFLAGS
+
+  GOX_[OS]_[ARCH]_CC and GOX_[OS]_[ARCH]_CXX set the C and C++ compilers
+  cgo uses for a platform, such as GOX_LINUX_ARM64_CC=aarch64-linux-gnu-gcc.
+
+  Without them, android builds with "-cgo" use the clang of the Android
+  NDK for their ABI and API level, such as aarch64-linux-android21-clang,
+  which needs no other CFLAGS. The NDK is ANDROID_NDK_HOME or
+  ANDROID_NDK_ROOT, or else the newest one in the ndk directory of
+  ANDROID_HOME. "-android-api" is the API level, 21 by default.
+
+  ios builds are linked by the clang of Xcode, so they are built on macOS
+  unless GOX_IOS_[ARCH]_CC is set. ios/arm64 uses the iphoneos SDK, for
+  devices, and ios/amd64 the iphonesimulator SDK. They are static libraries
+  to embed in an app, "-buildmode=c-archive", unless "-buildmode" is set,
+  and run on iOS "-ios-version" and up.
+
+Experiments:
+
+  Platforms and behaviors that aren't considered stable yet are off unless
+  enabled with "-enable-experimental" or the GOX_EXPERIMENTAL environment
+  variable, which take a comma-separated list of these names:
+
+    ios                 ios/arm64 and ios/amd64 (Go 1.16+, needs cgo and Xcode)
+    wasip1              wasip1/wasm for WASI runtimes (Go 1.21+)
+
+  Experimental platforms are never built by default; ask for them with
+  "-os" or "-osarch" as well. "-osarch-list" shows the enabled ones.
+
+Triage Bundles:
+
+  If any build fails and "-triage" is set, Gox writes a gzipped tarball
+  containing the error and the output of each failed build, the resolved
+  flag values, the Go version, the output of "go env" and a snapshot of
+  the environment. Environment variables that look like they hold
+  credentials (names containing TOKEN, SECRET, PASSWORD, KEY or AUTH) are
+  redacted, and so are such names' values in flags, such as the
+  "-X main.token=..." of "-ldflags". The bundle is meant to be attached
+  to bug reports as-is.
+
+Output:
+
+  Gox prints each build as it starts, and what failed once they are all
+  done. "-quiet" leaves out everything but failures and the final summary,
+  and "-debug" also prints every command that is run, with the directory
+  it runs in and the variables that it adds to the environment, so that
+  it can be run again by hand.
+
+  When stderr is a terminal, failed platforms and streamed prefixes are
+  colored, unless the NO_COLOR environment variable is set. "-color"
+  colors them anyways.
+
+Exit Statuses:
+
+  Gox exits with a status that tells why it failed, so that CI can branch
+  on it:
+
+    0  Everything was built, packaged and published
+    1  Any other error, such as a failed signing or packaging step
+    2  Bad flags or config file
+    3  An incremental build found every binary up to date (see below)
+    4  Go, or a tool that the flags need, is missing or too old
+    5  Some of the builds failed
+    6  Every build failed, or "-preflight" did
+    7  The builds worked but publishing them didn't
+
+  With "-json" the summary has an "error" object when gox fails, with the
+  "code" of the status ("error", "flags", "toolchain", "partial_failure",
+  "all_failed" or "publish"), the "exit_status" and the "message" of the
+  error, even when it fails before anything is built.
+
+Interactive Builds:
+
+  "-interactive" first shows a checklist of every platform that can be
+  built, with those that the flags or config file pick checked. Arrow keys
+  or j/k move, space toggles, a, n and d check all, none or the defaults
+  again, enter builds and q quits. The builds are then shown as they run:
+  a spinner for each one that is building, its duration once it is done,
+  and the end of the error of each one that failed. It needs a terminal
+  and the "stty" command, and can't be used with "-stream".
+
+  Without a checklist, "-progress" shows how many builds are done out of
+  all of them on stderr, the ones that are running, and an ETA from the
+  average of the latest build times. On a terminal it is one line that is
+  updated in place; otherwise a line is written as each build finishes.
+
+Build Logs:
+
+  With "-log-dir=logs", the full stdout and stderr of the compiler for each
+  build is written to a file in that directory, named for its platform,
+  such as "logs/linux_amd64.log" or "logs/linux_armv7.log". With more than
+  one package the package's name goes in front, as in
+  "logs/server_linux_amd64.log", and FIPS variants end in "_fips". Only
+  the end of the error of a failed build is printed, so that long cgo
+  errors don't drown out the rest; keep the directory as a CI artifact
+  for the whole of it. "-json" has the log of each target in "log".
+
+Tracing:
+
+  "-otel" exports the run as an OpenTelemetry trace once it is done: a
+  "gox" span with the version, the number of builds and of errors, and a
+  span under it for each build with its platform, package, output, how
+  long the compiler took and whether it was up to date, failed with the
+  first line of its error. It is sent with OTLP over HTTP to the collector
+  of OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT,
+  http://localhost:4318 by default, with the OTEL_EXPORTER_OTLP_HEADERS
+  and the OTEL_SERVICE_NAME of "gox". With TRACEPARENT set, as some CI
+  systems do, the run joins that trace. A collector that can't be reached
+  is a warning, not a failed build.
+
+GitHub Actions:
+
+  When GITHUB_ACTIONS is "true", Gox also prints a collapsed group with
+  the outcome of each platform once the builds are done, and an error
+  annotation for each error of the compiler that names a file, so that
+  they show up on the lines of the pull request. A table of the artifacts,
+  with their sizes, is added to the job summary in GITHUB_STEP_SUMMARY.
+
+Incremental Builds:
+
+  With "-incremental=.gox-state.json", Gox records a fingerprint of the
+  inputs of each binary in the given file: the Go version, the build
+  flags and environment, and the source files of the package and its
+  dependencies for that platform. Binaries whose fingerprint hasn't
+  changed and that still exist are not rebuilt, signed or packaged again.
+  "-rebuild" builds everything but still updates the state file.
+
+  If every binary is up to date, Gox exits with status 3 right after the
+  build, so CI can skip packaging and publishing jobs entirely.
+
+  "-json" writes a summary to stdout once gox is done, and all other
+  output goes to stderr. "up_to_date" is true when nothing was rebuilt,
+  and "targets" holds the platform, package, output, and status ("built",
+  "up-to-date" or "failed") of each binary.
+
+Stripping:
+
+  "-strip" links with "-s -w", leaving out the symbol table and DWARF
+  debug info, and then reports how much smaller each binary is. To find
+  that out each binary is also linked unstripped to a temporary directory,
+  which reuses the compiled packages from the build cache.
+
+  "-split-debug" keeps the debug info of ELF binaries (linux, the BSDs,
+  android and solaris) in a <binary>.debug file next to each binary, which
+  is linked to it with a .gnu_debuglink section so that gdb and delve find
+  it. This needs objcopy or llvm-objcopy. Other binaries are stripped as
+  with "-strip".
+
+Reproducible Builds:
+
+  "-reproducible" builds with "-trimpath" and an empty build ID, so that
+  binaries don't depend on where or when they were built. Timestamps of
+  binaries and of the entries of archives Gox writes come from the
+  SOURCE_DATE_EPOCH environment variable, which defaults to the time of
+  the last git commit (and is passed on to packaging tools). Outside of
+  git it has to be set, rather than dating everything to 1970. Archive
+  entries are always written in sorted order. Two reproducible builds of
+  the same commit with the same Go version produce identical artifacts;
+  "gox verify-reproducible" checks that they do.
+
+Build IDs:
+
+  "-build-id" links a build ID into each binary as the goxBuildID string
+  of package main, with "-X". It has a hash of the source files and
+  go.mod files the binary was built from, which is the same on every
+  machine, and the platform, package, version, commit, Go version and
+  settings of the build. The manifest records it with the binary, and
+  "gox verify" finds it in a binary and checks both against the
+  manifest. Go keeps it in the build info of the binary with the rest of
+  "-ldflags", except with "-reproducible", which drops "-ldflags" from
+  the build info; then package main has to declare goxBuildID and use
+  it, such as in its version output.
+
+Shared Libraries:
+
+  "-buildmode" is checked against the platforms that Go supports it on,
+  and platforms that don't are skipped: c-shared, for example, is only
+  supported on some linux, android, freebsd, darwin and windows platforms.
+  The output gets the extension of its kind, .a for c-archive and .so for
+  plugin.
+
+  With "-buildmode=c-shared", each library gets the right extension for
+  its platform (.so, .dylib or .dll) and cgo is enabled, so a C cross
+  compiler is needed for every platform (set it with GOX_[OS]_[ARCH]_CC
+  or use a container builder). Next to each library
+  Gox writes the header generated by cgo, a pkg-config .pc file and, for
+  windows, a .def file and an import .lib made with dlltool. These are
+  packaged together with the library in a .tar.gz (a .zip for windows) with
+  include/, lib/ and lib/pkgconfig/ directories that can be unpacked and
+  linked against as-is.
+
+  The optional "cshared" section of the config file sets the library
+  "name" (defaults to the package directory), the "version" and
+  "description" in the .pc file (the version defaults to "git describe
+  --tags", or 0 outside of git) and the "dlltool" command (defaults to
+  the MinGW dlltool for the arch, or llvm-dlltool).
+
+  The "wheel" section also wraps each library in a Python wheel tagged
+  for its platform (manylinux2014, macosx or win), with the library in
+  the "package" directory and the Python sources in "dir" at the root of
+  the wheel. "platform_tags" overrides the tag of an os/arch:
+
+    {
+      "wheel": {
+        "name": "mylib",
+        "version": "1.2.3",
+        "dir": "python",
+        "platform_tags": {"linux/amd64": "manylinux_2_28_x86_64"}
+      }
+    }
+
+  The "npm" section builds npm packages like napi-rs does, written to the
+  "output" directory (default "npm"): a <name>-<platform>-<cpu> package
+  for each library, limited to its platform with "os" and "cpu", and the
+  main package, made from "dir" and its package.json, which depends on
+  all of them optionally so npm installs only the right one:
+
+    {
+      "npm": {"name": "@example/mylib", "version": "1.2.3", "dir": "js"}
+    }
+
+Platform Trees:
+
+  With "-tree=dist", each binary is also copied to dist/<os>-<arch>/bin,
+  so that dist can be synced as-is onto machines of every platform. The
+  dist/bin directory gets launchers for each binary that run the right
+  binary for the machine they are run on: a shell script, a PowerShell
+  script, and a .cmd file if windows was built.
+
+  "-fat-archive=app.zip" writes the same layout to a single archive, for
+  shipping one download that works on every platform. The format is
+  chosen by the extension: .zip, .tar.gz, .tgz or .tar.
+
+Config File:
+
+  Settings for what happens after the build, such as packaging, are read
+  from a JSON config file. This is "gox.json" in the current directory if
+  it exists, or the file given with "-config". All sections are optional.
+
+  "gox init -template=cli" writes a starting config for a command line
+  tool; see "gox init -h" for the other templates.
+
+  The "osarch" list is the os/arch pairs to build when none of "-os",
+  "-arch" and "-osarch" are given.
+
+  The "archives" section packs each binary into its own archive in the
+  "output" directory (default "dist"). The "name" and "binary" templates
+  (defaults "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}" and "{{.Dir}}") name
+  the archive and the binary in it, with {{.Dir}}, {{.OS}}, {{.Arch}},
+  {{.GOARCH}} (without GOARM or level), {{.ARM}} and {{.Version}}, which is
+  "git describe --tags" without the "v". The "format" is tar.gz, zip or
+  tar, and "format_overrides" sets it per OS. The "files" go into every
+  archive with the binary: each "src" glob (matched directories go in
+  whole) into the "dst" directory of the archive, only for the "os" list
+  if set and never for "exclude_os". The "checksums" section writes the
+  SHA-256 of every archive (or binary, without archives) in sha256sum
+  format to "name" (default "SHA256SUMS") next to the archives:
+
+    {
+      "osarch": ["darwin/arm64", "linux/amd64", "windows/amd64"],
+      "archives": {
+        "format_overrides": {"windows": "zip"},
+        "files": [
+          {"src": "LICENSE"},
+          {"src": "completions"},
+          {"src": "deploy/*.service", "dst": "systemd", "os": ["linux"]}
+        ]
+      },
+      "checksums": {"name": "myapp_{{.Version}}_checksums.txt"}
+    }
+
+  The "homebrew" section writes a Homebrew formula, <name>.rb next to the
+  archives, that installs the darwin and linux archives of the binary with
+  the sha256 of each. The "url" template, with {{.Name}} (the archive file
+  name), {{.Version}}, {{.OS}} and {{.Arch}}, is where they are downloaded
+  from. "name" defaults to the package directory, and "package" picks the
+  package when several are built. With "-publish", the formula is
+  committed to the "tap" repository (in the "directory" Formula, on the
+  "branch" of its HEAD) and pushed:
+
+    {
+      "homebrew": {
+        "description": "Does things",
+        "homepage": "https://example.com",
+        "license": "MIT",
+        "url": "https://example.com/releases/{{.Version}}/{{.Name}}",
+        "tap": {"repository": "git@github.com:example/homebrew-tap.git"}
+      }
+    }
+
+  The "scoop" section does the same for the windows archives, with a
+  Scoop manifest <name>.json that -publish pushes to the "bucket" (in the
+  directory bucket). The "winget" section writes the version, installer
+  and locale manifests of the winget package "identifier", which needs
+  "publisher", "description", "license" and zip archives for windows, and
+  -publish pushes them to the "repository", usually a fork of winget-pkgs,
+  in manifests/<letter>/<publisher>/<package>/<version>:
+
+    {
+      "archives": {"format_overrides": {"windows": "zip"}},
+      "scoop": {
+        "url": "https://example.com/releases/{{.Version}}/{{.Name}}",
+        "bucket": {"repository": "git@github.com:example/scoop-bucket.git"}
+      },
+      "winget": {
+        "identifier": "Example.App",
+        "publisher": "Example",
+        "description": "Does things",
+        "license": "MIT",
+        "url": "https://example.com/releases/{{.Version}}/{{.Name}}"
+      }
+    }
+
+  The "aur" section writes the PKGBUILD and .SRCINFO of an AUR package
+  "name" (default <package directory>-bin) for the linux archives to
+  "output" (default aur next to the archives), with a source and
+  sha256sum for each of x86_64, i686, aarch64, armv7h and armv6h that
+  was built. -publish pushes them to the AUR git "repository", such as
+  ssh://aur@aur.archlinux.org/myapp-bin.git.
+
+  The tap, bucket and repository pushes of -publish run last, after the
+  uploads and the release have succeeded, so they never point at archives
+  that were not published.
+
+  The "chocolatey" section builds <id>.<version>.nupkg next to the
+  archives, a Chocolatey package whose install script downloads the zip
+  archive of windows/386 or windows/amd64 from "url" and checks its
+  sha256. It needs "authors" and a "description", and the "id" defaults
+  to the package directory. Push it with "choco push".
+
+  The "uploads" section lists HTTP endpoints, such as Artifactory, Nexus,
+  WebDAV or presigned S3 URLs, that -publish uploads artifacts to, at most
+  "upload" of the "concurrency" section at once. Each is PUT (or the
+  "method") to the "url" template, with {{.Name}} (the file name),
+  {{.Path}} (the path in gox-manifest.json), {{.Kind}}, {{.Version}},
+  {{.OS}} and {{.Arch}}, and X-Checksum-Md5, -Sha1 and -Sha256 headers.
+  "kinds" picks the kinds of artifacts of the manifest (default archive,
+  checksums, package and signature, or binary without archives).
+  Credentials come from the environment: "username" and "password_env"
+  for basic auth, or "token_env" for a bearer token, and otherwise from
+  the login of the host in ~/.netrc (or $NETRC). Failed uploads are
+  retried "retries" times (default 3). With "skip_existing", artifacts
+  that the server already has, by the X-Checksum-Sha256 or the MD5 ETag
+  of a HEAD request, aren't uploaded again, so a publish that failed part
+  way can be rerun. With "resumable", the "url" is the endpoint of a tus
+  server (https://tus.io) that the upload is created at, and the file is
+  sent in requests of "chunk_size" (default 8M), each retried from where
+  the server says it got to, so that a dropped connection doesn't start
+  the upload over:
+
+    {
+      "uploads": [{
+        "name": "artifactory",
+        "url": "https://example.jfrog.io/artifactory/generic/myapp/{{.Version}}/{{.Name}}",
+        "username": "ci",
+        "password_env": "ARTIFACTORY_PASSWORD"
+      }]
+    }
+
+  The "notes" section has where the release notes of the version come
+  from: the section of the version in the changelog "file" (the default
+  "source", with CHANGELOG.md as the default file) under a heading such as
+  "## [1.2.3] - 2024-05-01" or "## v1.2.3", or, with the "git" source, the
+  subjects of the commits since the previous tag. They are in every
+  archive as RELEASE_NOTES.txt and are the body of the "release".
+
+  The "release" section creates the release of the version on a forge
+  with -publish and attaches the artifacts of the "kinds" (as in
+  "uploads") to it. The "forge" is github, gitlab, gitea or forgejo, with
+  the "url" of a self-hosted instance, and the "repository" is owner/name.
+  The tag, "v{{.Version}}" by default, must have been pushed. The token
+  comes from "token_env", by default GITHUB_TOKEN, GITLAB_TOKEN (or the
+  CI_JOB_TOKEN of a pipeline) or GITEA_TOKEN, and without it from the
+  login of "gh auth login" or "glab auth login", or the password of the
+  host in ~/.netrc. GitLab assets are uploaded to the generic package
+  registry and linked from the release. When the release exists, the
+  assets that it has with the same SHA-256 (GitHub, and the package files
+  of GitLab) or size (Gitea and Forgejo) are kept, and the others are
+  replaced. The APIs of the forges take each asset in one request, so
+  those aren't resumable:
+
+    {
+      "release": {
+        "forge": "gitea",
+        "url": "https://gitea.example.com",
+        "repository": "example/myapp"
+      }
+    }
+
+  The "workers" section lists the "urls" of the workers of
+  "-builder=remote", how the source gets to them ("source", tarball or
+  git, with the "repository" to clone), and "token_env", the variable with
+  their token, GOX_WORKER_TOKEN by default (see Remote Builds below).
+
+  The "channels" section names the directories that releases are
+  published to, such as nightly and stable, for "gox promote".
+
+  The "version" section sets where {{.Version}} comes from with "source":
+  "git" (the default), "file" (the "file", default VERSION), "bazel" (the
+  "key", default STABLE_VERSION, of the stamp file "file", default
+  bazel-out/stable-status.txt), "env" (the variable "env") or "calver" (the
+  date as "format", default "YYYY.0M.MICRO", where MICRO counts past the
+  git tags with the same prefix). "require" is "semver" or "calver" to
+  fail the build if the version doesn't conform:
+
+    {"version": {"source": "env", "env": "CI_COMMIT_TAG", "require": "semver"}}
+
+  The "packages" section overrides the build of single main packages, for
+  building several binaries like ./cmd/... at once. Keys are import paths
+  or their last elements. "tags", "ldflags" and "gcflags" replace the flags,
+  "output" replaces the "-output" template and "osarch" limits the package
+  to some of the platforms. Builds that would write the same file are an
+  error:
+
+    {
+      "packages": {
+        "cmd/server": {"tags": "netgo", "osarch": ["linux/amd64", "linux/arm64"]},
+        "tools/server": {"output": "{{.Dir}}-tool_{{.OS}}_{{.Arch}}"}
+      }
+    }
+
+  The "annotations" are key/value pairs attached to every artifact, with
+  those of a package's "annotations" on top, for inventory systems that
+  classify binaries. They are in the "-json" summary and are set as OCI
+  annotations by "gox image":
+
+    {
+      "annotations": {"team": "payments", "support-tier": "1"},
+      "packages": {"cmd/debug": {"annotations": {"support-tier": "3"}}}
+    }
+
+  The "nfpm" section builds deb, rpm, and apk packages from each linux
+  binary using nfpm, which must be installed:
+
+    {
+      "nfpm": {
+        "version": "1.2.3",
+        "maintainer": "Jane Doe <jane@example.com>",
+        "description": "My tool",
+        "formats": ["deb", "rpm"],
+        "systemd_units": ["dist/mytool.service"],
+        "contents": [{"src": "mytool.conf", "dst": "/etc/mytool.conf", "type": "config"}]
+      }
+    }
+
+  Packages are named <name>_<version>_<os>_<arch>.<format> and written
+  next to the binary, or to the "output" directory if set.
+
+  The "snap" and "appimage" sections also pack the linux/amd64 and
+  linux/arm64 binaries into <name>_<version>_<arch>.snap, with mksquashfs,
+  and <name>-<version>-<arch>.AppImage, with appimagetool. Snaps need a
+  "summary", and take "base", "grade", "confinement" and "plugs" (default
+  core22, stable and strict). The "desktop" section is the desktop entry
+  of both, and AppImages need its "icon":
+
+    {
+      "snap": {"summary": "My tool", "plugs": ["network", "home"]},
+      "appimage": {},
+      "desktop": {"name": "My Tool", "icon": "assets/mytool.png", "categories": ["Development"]}
+    }
+
+  The "installer" section builds installers: with "msi", an MSI of each
+  windows/386 and windows/amd64 binary that installs it to Program Files
+  (and adds it to the PATH with "add_to_path"), built from WiX source
+  with wixl from msitools, and with "dmg", a compressed DMG of each darwin
+  binary, made with hdiutil on macOS. MSIs need a "manufacturer", an
+  "upgrade_code" GUID that stays the same across versions, and a numeric
+  version. Installers are named <name>_<version>_<os>_<arch>.msi or .dmg
+  and written next to the binary, or to the "output" directory if set:
+
+    {
+      "installer": {
+        "name": "MyTool",
+        "manufacturer": "Example Inc.",
+        "msi": {"upgrade_code": "5a1b7c4e-3d2f-4e6a-9b8c-1d2e3f4a5b6c", "add_to_path": true},
+        "dmg": {}
+      }
+    }
+
+  The "codesign" section signs every darwin binary with codesign, using
+  the hardened runtime and a secure timestamp, and can notarize them with
+  notarytool. This requires a macOS host. Notarization waits for Apple to
+  accept or reject each binary; rejections include notarytool's log.
+  Credentials are a keychain "profile", an API "key", "key_id" and
+  "issuer", or an "apple_id", "team_id" and "password":
+
+    {
+      "codesign": {
+        "identity": "Developer ID Application: Example, Inc. (ABCDE12345)",
+        "notarize": {"profile": "gox-notary"}
+      }
+    }
+
+  The "authenticode" section signs every windows binary, with
+  osslsigncode and a "pkcs12" file or "cert" and "key" files, or with a
+  custom "command" that signs {{.Path}} in place. The key password is read
+  from the environment variable named by "password_env", and "timestamp"
+  is an RFC 3161 timestamping server:
+
+    {
+      "authenticode": {
+        "pkcs12": "codesign.pfx",
+        "password_env": "CODESIGN_PASSWORD",
+        "timestamp": "http://timestamp.digicert.com"
+      }
+    }
+
+  The "vault" section fetches credentials from HashiCorp Vault when gox
+  starts, rather than keeping them in CI: "secrets" stands in for
+  environment variables, such as those of "token_env" and "password_env",
+  and "files" writes files, such as the "cert" and "key" of
+  "authenticode", which are removed when gox is done. Each is
+  "<path>#<field>" of a secret, such as secret/data/ci/github#token with
+  KV version 2. The variables are only given to the commands that sign
+  and push, never to builds, smoke tests or packaging tools. Variables
+  that are set and files that exist are kept as they are. Vault is at
+  "address" or $VAULT_ADDR, and gox logs in with $VAULT_TOKEN or
+  ~/.vault-token, or with the "auth" method: "jwt" with the OIDC token of
+  the job (from "token_env", or requested for the "audience" on GitHub
+  Actions) for the "role", or "approle" with "role_id_env" and
+  "secret_id_env":
+
+    {
+      "vault": {
+        "address": "https://vault.example.com",
+        "auth": {"method": "jwt", "role": "release"},
+        "secrets": {"GITHUB_TOKEN": "secret/data/ci/github#token"}
+      }
+    }
+
+  The "sign" section signs artifacts of the "kinds" (as in "uploads",
+  default checksums) with a key that stays in a cloud KMS, for runners
+  that mustn't hold private keys, and writes <name>.sig next to each: the
+  base64 DER signature of its SHA-256, as "cosign verify-blob" checks.
+  The "key" is awskms:///<key id, alias or ARN>, gcpkms://projects/...
+  /cryptoKeyVersions/<v> or azurekms://<vault>.vault.azure.net/<key>, and
+  the "algorithm" is ecdsa-sha256 (default), rsa-pkcs1-sha256 or
+  rsa-pss-sha256. The aws, gcloud or az CLI signs, with the credentials it
+  finds, such as the IAM role of the runner:
+
+    {
+      "sign": {"key": "awskms:///alias/release-signing"}
+    }
+
+  The "versioninfo" section embeds a version resource into every windows
+  binary, so that Explorer shows its version, product name, copyright and
+  so on, and optionally an "icon" from a .ico file. The version defaults
+  to "git describe --tags". The resources are written to the package
+  directory as zz_gox_windows_<arch>.syso before building and removed
+  afterwards. windows/arm binaries get no resources since the Go linker
+  can't read them for that arch:
+
+    {
+      "versioninfo": {
+        "product_name": "My Tool",
+        "company_name": "Example, Inc.",
+        "copyright": "Copyright (c) 2026 Example, Inc.",
+        "icon": "assets/mytool.ico"
+      }
+    }
+
+  The "concurrency" section caps how many operations of each stage run
+  at once, since each stage has a different bottleneck. The stages are
+  "build", "package", "archive", "sign", and "upload". A stage without a
+  limit uses the build parallelism, and "-parallel" takes precedence over
+  the build limit:
+
+    {
+      "concurrency": {"build": 8, "sign": 1, "upload": 4}
+    }
+
+  "-package-parallel=N" signs and archives each binary as soon as it is
+  built, N at a time, while the other builds go on, and works out the
+  checksums of the archives then too. The archives of the binaries that
+  were built are made even if other builds fail. Universal binaries, the
+  other packages and the uploads still wait for every build.
+
+Sharding:
+
+  "-shard=I/N" splits the platforms into N parts and builds only part I,
+  so that N CI jobs running the same command build everything between
+  them. With "-shard-timings=FILE" the parts are balanced by how long each
+  platform took to build, as recorded in FILE by earlier runs with the
+  same flag. Every job must start from the same copy of FILE, such as one
+  restored from the CI cache, to compute the same split. Without timings
+  every platform weighs the same. The two halves of a "-darwin-universal"
+  binary are always in the same part.
+
+    $ gox -shard=2/5 -shard-timings=.gox-timings.json ./...
+
+  Builds start in the order the platforms were selected in, unless
+  "-order" is a list of platforms to start first, such as
+  "-order=linux/amd64,darwin/arm64", where "linux/arm" is every GOARM
+  version. "-order=alphabetical" sorts them by name, and
+  "-order=fastest-first" by the times in "-shard-timings", so the most
+  builds are done, and smoke tested, early.
+
+Go Versions:
+
+  "-go-version=1.22.4" builds with exactly that Go release instead of the
+  go command on the PATH. It is downloaded from go.dev/dl the first time,
+  checked against its published SHA-256, and kept in $GOX_TOOLCHAIN_DIR,
+  which defaults to "gox/go" in the user cache directory. With
+  "-go-version=mod" the release is the "toolchain" line of go.work or
+  go.mod, or else the "go" line, as with GOTOOLCHAIN. Container builds use
+  the golang image of that release instead.
+
+GOFLAGS:
+
+  The builds keep the user's GOFLAGS, from the environment or set with
+  "go env -w", and container builds are passed them too. Remote builds
+  only get their "-tags", since workers refuse GOFLAGS. The "-tags" of
+  GOFLAGS are merged with those of "-tags", rather than being replaced by
+  them; other flags that gox passes to go build, such as "-mod" and
+  "-ldflags", take precedence over GOFLAGS as usual.
+
+  "-goflags" replaces GOFLAGS for the run, and "-goflags=" clears it.
+  "-no-goenv" builds with GOENV=off, leaving out everything that was set
+  with "go env -w". "-overlay=overlay.json" is passed on to go build, to
+  build with some source files replaced by others; the files are mounted
+  into container builds, and a change to any of them rebuilds with
+  "-incremental".
+
+  Modules are downloaded once with "go mod download" before the builds
+  start, rather than by every build at once. A module with a vendor
+  directory, or a workspace made with "go work vendor", is built with
+  "-mod=vendor" and nothing is downloaded, unless "-mod" or a "-mod" in
+  GOFLAGS says otherwise. "-modcacherw" leaves the downloaded modules
+  writable, so that the module cache can be removed without chmod.
+
+Obfuscation:
+
+  "-obfuscate" builds with "garble build" instead of "go build". Garble
+  is the garble on the PATH or, failing that, the garble tool of the
+  module ("go get -tool mvdan.cc/garble"). Each platform gets its own
+  seed, which is random unless "-obfuscate-seed" is given to derive them
+  from, as "-reproducible" and "-incremental" need. Next to every binary
+  Gox writes a .garble.json file with its seed, flags and the "garble
+  reverse" command that turns its obfuscated stack traces back into
+  readable ones. Keep these private, they undo the obfuscation:
+
+    $ gox -obfuscate -obfuscate-flags="-literals" -osarch="linux/amd64 windows/amd64"
+    $ garble -literals -seed=<seed> reverse . < crash.txt
+
+FIPS Builds:
+
+  "-goexperiment" sets GOEXPERIMENT for the builds and, like "-ldflags",
+  can be given again as "os/arch=experiments" for one platform.
+
+  "-fips=boringcrypto" builds every binary with GOEXPERIMENT=boringcrypto,
+  which links in BoringCrypto with cgo and is only supported on linux/amd64
+  and linux/arm64; other platforms are skipped. "-fips=latest", or a module
+  version such as "-fips=v1.0.0", sets GOFIPS140 to use the FIPS 140-3 Go
+  Cryptographic Module of Go 1.24 and later on every platform. With
+  "-fips-output", the standard binaries are built as well and the FIPS
+  ones are written to that output path template instead:
+
+    $ gox -osarch="linux/amd64 linux/arm64" -fips=boringcrypto \
+        -fips-output="{{.Dir}}_{{.OS}}_{{.Arch}}_fips"
+
+  FIPS binaries have a "variant" of "fips" in the -json summary. When both
+  are built, "-darwin-universal" merges the standard binaries.
+
+Profile-Guided Optimization:
+
+  "-pgo" is passed to go build: "auto" uses the default.pgo of each main
+  package, "off" turns it off, and anything else is the path of a CPU
+  profile. Like "-ldflags", it can be given again as "os/arch=profile" to
+  use a profile collected on that platform. This needs Go 1.21 or later.
+
+    $ gox -pgo=auto -pgo=linux/amd64=profiles/linux.pprof \
+        -pgo=linux/arm64=profiles/graviton.pprof
+
+Static Binaries:
+
+  "-static" builds binaries that don't need any shared library. Builds
+  run with CGO_ENABLED=0, even for the host, and with "-cgo" they are
+  linked externally with -extldflags "-static", using musl-gcc for the
+  host if it is on the PATH; set GOX_[OS]_[ARCH]_CC to a musl cross
+  compiler for other platforms. A linux, freebsd or netbsd binary that is
+  still dynamically linked fails its target. Other systems are always
+  dynamically linked to their C library. The "static" config section
+  lists the platforms that are excepted:
+
+    {"static": {"exceptions": ["linux/riscv64"]}}
+
+Binary Checks:
+
+  Every binary is checked once it is built: its ELF, PE, Mach-O or
+  WebAssembly header must be for the platform that was asked for, and
+  linux executables built with CGO_ENABLED=0 must not be dynamically
+  linked. A binary that fails the check fails its target.
+
+Smoke Tests:
+
+  "-smoke-test=--version" runs every binary with the given arguments once
+  it is built, and fails its target if it doesn't start or exits with an
+  error. This catches broken cross-builds, such as a GOARM that is too new,
+  before they are released. Binaries for the host run as they are, other
+  linux binaries run under qemu-user (qemu-aarch64 and so on, or its
+  binfmt_misc registration), with the ARM CPU of the build's GOARM, and
+  windows binaries run under wine. Binaries that nothing on this machine
+  can run are skipped. Dynamically linked binaries find their libraries
+  in QEMU_LD_PREFIX.
+
+    $ gox -smoke-test=--version -osarch="linux/arm linux/arm64 windows/amd64"
+
+Test Binaries:
+
+  "-test" builds the test binary of every package with tests, instead of
+  the main packages, with "go test -c". This gives test binaries for all
+  of the platforms, to copy to and run on real ARM or Windows machines.
+  They are named "{{.Dir}}_{{.OS}}_{{.Arch}}.test" unless "-output" is
+  given, and are built with the same flags and parallelism as binaries:
+
+    $ gox -test -osarch="linux/arm64 windows/amd64" ./...
+    $ scp foo_linux_arm64.test pi:
+    $ ssh pi ./foo_linux_arm64.test -test.v
+
+Compilers:
+
+  "-compiler=gccgo" builds with "go build -compiler gccgo", which adds
+  platforms such as linux/ppc and linux/sparc64. The cross gccgo of each
+  platform is set with GOX_[OS]_[ARCH]_GCCGO. "-gcflags" are passed as
+  "-gccgoflags", and of the "-ldflags" only -s and -w are supported.
+
+  "-compiler=tinygo" builds with "tinygo build" for its own set of
+  platforms, including WebAssembly. Microcontroller boards are platforms
+  with an OS of "target", built with "tinygo build -target":
+
+    $ gox -compiler=tinygo -osarch="target/pico target/microbit"
+
+  Options that a compiler doesn't support, such as "-race" or
+  "-reproducible" with TinyGo, fail before anything is built. Use
+  "-osarch-list" with "-compiler" to list the platforms of a compiler.
+
+Container Builds:
+
+  With "-builder=docker" or "-builder=podman", each platform's "go build"
+  runs in a fresh container from "-builder-image". The current directory
+  and the output directory are bind-mounted at the same paths inside the
+  container and only the build's GOOS, GOARCH, GOARM and CGO_ENABLED
+  settings are passed in, so the host environment does not leak into the
+  build. This is useful for cgo builds that need C toolchains which are
+  only installed in the image.
+
+Remote Builds:
+
+  EXPERIMENTAL. With "-builder=remote", each platform's "go build" runs on
+  one of the workers started with "gox worker" on other machines, given
+  with "-workers" or the "workers" section of the config file, and the
+  binary comes back into the output directory. A build goes to the worker
+  with the fewest builds running, and to another if a worker can't be
+  reached. The files of the current directory that git doesn't ignore are
+  uploaded to each worker as a tarball, or with "source": "git" the
+  workers clone the "repository" (the origin remote by default) at HEAD.
+  Workers get the platform, tags and flags of each build rather than its
+  command and environment, and refuse those that could run or write
+  anything else (see "gox worker -h"). The C cross compilers are those of
+  each worker's GOX_[OS]_[ARCH]_CC:
+
+    $ GOX_WORKER_TOKEN=secret gox -builder=remote \
+        -workers=http://build1:7878,http://build2:7878 -cgo ./...
+
+Workspaces:
+
+  Inside a go.work workspace, gox builds the current directory if it is in
+  one of the workspace's modules, and the main packages of every module
+  otherwise. Patterns such as "./..." cover all of the modules below their
+  directory. "-workspace-module" picks modules by module path or by
+  directory relative to go.work, and can be given more than once:
+
+    $ gox -workspace-module=./cmd/server -workspace-module=example.com/cli
+
+  Every build runs with GOWORK set to the workspace's go.work, and
+  container builds mount the workspace. Set GOWORK=off to build a module
+  on its own.
 
 `
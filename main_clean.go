@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The "main" method for `gox clean`.
+func mainClean(args []string) int {
+	var platformFlag PlatformFlag
+	var outputTpl, outputLayout, configPath, versionFlag string
+	var dryRun bool
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, cleanHelpText) }
+	flags.Var(platformFlag.ArchFlagValue(), "arch", "")
+	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "")
+	flags.Var(platformFlag.OSArchFileValue(), "osarch-file", "")
+	flags.Var(platformFlag.OSFlagValue(), "os", "")
+	flags.Var(platformFlag.ARMArchFlagValue(), "armarch", "")
+	flags.StringVar(&outputTpl, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "")
+	flags.StringVar(&outputLayout, "output-layout", outputLayoutFlat, "")
+	flags.StringVar(&configPath, "config", "", "")
+	flags.StringVar(&versionFlag, "version", "", "")
+	flags.BoolVar(&dryRun, "dry-run", false, "")
+	if err := flags.Parse(args); err != nil {
+		flags.Usage()
+		return 1
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+
+	// What the last build recorded, which has the targets that were
+	// since dropped
+	dir := outputTemplateDir(outputTpl)
+	manifest, err := LoadArtifactManifest(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", filepath.Join(dir, manifestName), err)
+		return 1
+	}
+	paths := append(manifest.Paths(), filepath.Join(dir, manifestName))
+
+	// What the output template names for the packages and platforms, for
+	// builds from before there was a manifest. Without platform flags
+	// every platform that Go supports is looked for.
+	packages := flags.Args()
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+	mainDirs, err := GoMainDirs(packages, "go")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading packages: %s\n", err)
+		return 1
+	}
+	var platforms []Platform
+	if len(platformFlag.OS) == 0 && len(platformFlag.Arch) == 0 && len(platformFlag.OSArch) == 0 {
+		versionStr, err := GoVersion()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading Go version: %s\n", err)
+			return 1
+		}
+		platforms = SupportedPlatforms(versionStr)
+	} else if platforms, err = resolvePlatforms(&platformFlag, "", compilerGc, "", configPath, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	appVersion, err := config.Version.Resolve(versionFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading version: %s\n", err)
+		return 1
+	}
+	commit := gitCommit()
+	for _, path := range mainDirs {
+		for _, platform := range platforms {
+			opts := &CompileOpts{
+				PackagePath:  path,
+				Platform:     platform,
+				OutputTpl:    outputTpl,
+				OutputLayout: outputLayout,
+				Version:      appVersion,
+				Commit:       commit,
+			}
+			packageConfig(config.Packages, path).apply(opts)
+			output, err := opts.OutputPath()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				return 1
+			}
+			paths = append(paths, output, output+".debug", output+garbleMapExt)
+		}
+	}
+
+	removed, err := CleanPaths(dir, paths, dryRun)
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	for _, path := range removed {
+		fmt.Printf("--> %s %s\n", verb, path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cleaning %s: %s\n", dir, err)
+		return 1
+	}
+	if len(removed) == 0 {
+		fmt.Printf("Nothing to clean in %s\n", dir)
+	}
+	return 0
+}
+
+const cleanHelpText = `Usage: gox clean [options] [packages]
+
+  Removes what earlier builds wrote: every artifact in the gox-manifest.json
+  of the output directory, which includes the archives, packages and links
+  of targets that are no longer built, and the binaries that the output
+  template names for the packages, by default on every platform that Go
+  supports. Directories that are left empty are removed too. Other files in
+  the output directory are left alone.
+
+  To start the output directory over on every build, build with -clean. If
+  the directory is one of its own it is wiped, and otherwise what the last
+  build wrote is removed from it first.
+
+Options:
+
+  -output="foo"       Output path template of the builds to clean
+  -output-layout="flat"
+                      -output-layout of the builds to clean
+  -config=""          Config file, defaults to gox.json if it exists
+  -version=""         Release version of the builds, as for gox -version
+  -os=""              Space-separated list of operating systems
+  -arch=""            Space-separated list of architectures
+  -osarch=""          Space-separated list of os/arch pairs
+  -osarch-file=""     File of os/arch pairs, one per line
+  -armarch=""         Space-separated list of GOARM versions
+  -dry-run            Print what would be removed, without removing it
+`
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The "main" method for `gox completion`.
+func mainCompletion(args []string) int {
+	var platforms string
+	flags := flag.NewFlagSet("completion", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, completionHelpText) }
+	flags.StringVar(&platforms, "platforms", "", "")
+	if err := flags.Parse(args); err != nil {
+		flags.Usage()
+		return 1
+	}
+
+	// The scripts call back with -platforms to complete the platform
+	// flags, for the Go installed when they do
+	if platforms != "" {
+		versionStr, _ := GoVersion()
+		values, err := completionPlatforms(platforms, SupportedPlatforms(versionStr))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		fmt.Println(strings.Join(values, "\n"))
+		return 0
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	if err := WriteCompletion(os.Stdout, flags.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+const completionHelpText = `Usage: gox completion [options] SHELL
+
+  Prints the completion script of gox for SHELL, one of bash, zsh, fish,
+  or powershell. The scripts complete the commands and their flags, and
+  the values of -osarch, -os and -arch from the platforms of the Go that is
+  installed when they are completed.
+
+    $ source <(gox completion bash)
+    $ gox completion zsh > "${fpath[1]}/_gox"
+    $ gox completion fish > ~/.config/fish/completions/gox.fish
+    PS> gox completion powershell | Out-String | Invoke-Expression
+
+Options:
+
+  -platforms=""       Print the values of the -osarch, -os or -arch flags,
+                      one per line, which is what the scripts run
+`
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// The "main" method for `gox doctor`.
+func mainDoctor(args []string) int {
+	var platformFlag PlatformFlag
+	var goVersion, goCmd, compiler, experimental, config, host, output string
+	var cgo, offline bool
+	var tier int
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, doctorHelpText) }
+	flags.Var(platformFlag.ArchFlagValue(), "arch", "")
+	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "")
+	flags.Var(platformFlag.OSFlagValue(), "os", "")
+	flags.Var(platformFlag.ARMArchFlagValue(), "armarch", "")
+	flags.StringVar(&goVersion, "go-version", "", "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.StringVar(&compiler, "compiler", compilerGc, "")
+	flags.StringVar(&experimental, "enable-experimental", "", "")
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&host, "host", "", "")
+	flags.StringVar(&output, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "")
+	flags.BoolVar(&cgo, "cgo", false, "")
+	flags.BoolVar(&offline, "offline", false, "")
+	flags.IntVar(&tier, "tier", 0, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	hostPlatform, err := HostPlatform(host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	d := &Doctor{
+		GoCmd:     goCmd,
+		Host:      hostPlatform,
+		Cgo:       cgo,
+		OutputDir: outputTemplateDir(output),
+		Offline:   offline,
+	}
+
+	// The platforms can't be worked out without a go command, which the
+	// first check reports
+	var checks []DoctorCheck
+	if d.Platforms, err = resolvePlatforms(&platformFlag, goVersion, compiler, experimental, config, host); err != nil {
+		checks = append(checks, DoctorCheck{Name: "Platforms", Status: doctorFail, Detail: err.Error()})
+	}
+	if tier > 0 {
+		d.Platforms = filterTier(d.Platforms, tier)
+	}
+
+	fmt.Printf("==> Checking the environment for %d platforms\n", len(d.Platforms))
+	checks = append(checks, d.Run()...)
+	if failed := WriteDoctor(os.Stdout, checks); failed > 0 {
+		fmt.Fprintf(os.Stderr, "\nChecks failed: %d\n", failed)
+		return 1
+	}
+	return 0
+}
+
+const doctorHelpText = `Usage: gox doctor [options]
+
+  Checks that the environment can build the platforms, before a long build
+  finds out partway through that it can't: that the go command runs and is
+  new enough for the module, that GOPATH can be written and GOBIN is on the
+  PATH, that gox is run from a module, that every platform has a C compiler
+  with -cgo, that there is space for the binaries, and that the module
+  proxy can be reached. The platforms are picked like they are for a build.
+
+  Each check is printed as ok, warn or FAIL, with what to do about it. It
+  exits with 1 if any check failed; warnings don't fail it.
+
+Options:
+
+  -os=""              Space-separated list of operating systems
+  -arch=""            Space-separated list of architectures
+  -osarch=""          Space-separated list of os/arch pairs
+  -armarch=""         Space-separated list of GOARM versions
+  -cgo                Check the C compiler of each platform, for a cgo build
+  -compiler="gc"      Compiler whose platforms to use: gc, gccgo, or tinygo
+  -config=""          Config file, defaults to gox.json if it exists
+  -enable-experimental=""
+                      Comma-separated list of experiments to enable
+  -go-version=""      Go version to check platforms against, such as 1.22,
+                      defaults to that of the go command on the PATH
+  -gocmd="go"         Go command to check
+  -host=""            Host os/arch for "host" in the platform flags
+  -offline            Don't check that the module proxy can be reached
+  -output="foo"       Output path template of the build, for the disk check
+  -tier=0             Only include the ports of this tier or better
+`
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The "main" method for `gox image`.
+func mainImage(args []string) int {
+	var repo, base, goCmd, configPath string
+	var insecure bool
+	var labels, annotations mapStringValue
+	flags := flag.NewFlagSet("image", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, imageHelpText) }
+	flags.StringVar(&repo, "repo", "", "")
+	flags.StringVar(&base, "base", "scratch", "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.StringVar(&configPath, "config", "", "")
+	flags.BoolVar(&insecure, "insecure", false, "")
+	flags.Var(&labels, "label", "")
+	flags.Var(&annotations, "annotation", "")
+	if err := flags.Parse(args); err != nil {
+		flags.Usage()
+		return 1
+	}
+
+	if repo == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	ref, err := ParseImageRef(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	// The credentials of the registry can come from Vault
+	cleanupSecrets, err := config.LoadSecrets()
+	defer cleanupSecrets()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	client := NewRegistryClient(ref.Registry, RegistryAuthFor(ref.Registry), insecure)
+
+	var baseRef *ImageRef
+	var baseClient *RegistryClient
+	if base != "scratch" {
+		r, err := ParseImageRef(base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		baseRef = &r
+		baseClient = NewRegistryClient(r.Registry, RegistryAuthFor(r.Registry), insecure)
+	}
+
+	// Honor SOURCE_DATE_EPOCH so the images are reproducible if asked for
+	created := artifactTime()
+
+	var manifests []Descriptor
+	for _, arg := range flags.Args() {
+		path, pkg, platform, err := imageBinaryPlatform(goCmd, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", arg, err)
+			return 1
+		}
+		if platform.OS != "linux" {
+			fmt.Printf("--> Skipping %s: images are only built for linux\n", path)
+			continue
+		}
+
+		variant := imageVariant(platform)
+		data := &ImageTemplateData{
+			Repo:    ref.Registry + "/" + ref.Repository,
+			Tag:     ref.Tag,
+			Name:    filepath.Base(path),
+			OS:      platform.OS,
+			Arch:    platform.Arch,
+			Variant: variant,
+			Date:    created.UTC().Format(time.RFC3339),
+		}
+		renderedLabels, err := renderImageTemplates(labels, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering labels: %s\n", err)
+			return 1
+		}
+		renderedAnnotations, err := renderImageTemplates(annotations, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering annotations: %s\n", err)
+			return 1
+		}
+		renderedAnnotations = mergeAnnotations(config.ArtifactAnnotations(pkg), renderedAnnotations)
+
+		fmt.Printf("--> %15s: %s\n", platform.String(), path)
+		desc, err := PushImage(client, &ImageOpts{
+			Ref:         ref,
+			Binary:      path,
+			Platform:    platform,
+			Labels:      renderedLabels,
+			Annotations: renderedAnnotations,
+			Created:     created,
+			Base:        baseRef,
+			BaseClient:  baseClient,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s error: %s\n", platform.String(), err)
+			return 1
+		}
+		manifests = append(manifests, *desc)
+	}
+
+	if len(manifests) == 0 {
+		fmt.Fprintf(os.Stderr, "No linux binaries to build images for.\n")
+		return 1
+	}
+
+	// The index annotations are rendered without a platform
+	indexAnnotations, err := renderImageTemplates(annotations, &ImageTemplateData{
+		Repo: ref.Registry + "/" + ref.Repository,
+		Tag:  ref.Tag,
+		Date: created.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering annotations: %s\n", err)
+		return 1
+	}
+	indexAnnotations = mergeAnnotations(config.Annotations, indexAnnotations)
+	digest, err := PushIndex(client, ref, manifests, indexAnnotations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pushing image index: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("\nPushed %s@%s\n", ref.String(), digest)
+	return 0
+}
+
+// imageBinaryPlatform parses an `gox image` argument, which is either a
+// path to a binary or "os/arch=path", and returns the path, the import
+// path of its main package and its platform. Without an explicit platform,
+// the platform is read from the binary's build information. With one, the
+// import path is empty if the binary has no build information.
+func imageBinaryPlatform(goCmd, arg string) (string, string, Platform, error) {
+	if idx := strings.Index(arg, "="); idx > 0 {
+		parts := strings.Split(arg[:idx], "/")
+		if len(parts) != 2 {
+			return "", "", Platform{}, fmt.Errorf(
+				"Invalid platform syntax: %s should be os/arch", arg[:idx])
+		}
+
+		path := arg[idx+1:]
+		var pkg string
+		if info, err := GoBinaryInfo(goCmd, path); err == nil {
+			pkg = info.Path
+		}
+		return path, pkg, PlatformFromString(parts[0], parts[1]), nil
+	}
+
+	info, err := GoBinaryInfo(goCmd, arg)
+	if err != nil {
+		return "", "", Platform{}, err
+	}
+	platform, err := info.Platform()
+	return arg, info.Path, platform, err
+}
+
+const imageHelpText = `Usage: gox image [options] -repo=REPO binary...
+
+  Packages linux binaries built by Gox into minimal container images and
+  pushes them to a registry as a single multi-platform image.
+
+  Each binary is put in its own layer at /<name> and is the image's
+  entrypoint. The platform of each binary is read from its embedded build
+  information, or may be given explicitly as "os/arch=path" (for example
+  "linux/armv6=./app_linux_armv6"). Non-linux binaries are skipped.
+
+Options:
+
+  -repo=""            Image reference to push to, such as ghcr.io/org/app:1.0
+  -base="scratch"     Base image, such as gcr.io/distroless/static
+  -label k=v          Label to set on each image, may be repeated
+  -annotation k=v     Annotation to set on each manifest, may be repeated
+  -insecure           Talk to the registry over plain HTTP
+  -gocmd="go"         Go command used to read binary build information
+  -config=""          Config file, defaults to gox.json if it exists
+
+Templates:
+
+  Label and annotation values are Go text templates. The fields {{.Repo}},
+  {{.Tag}}, {{.Name}}, {{.OS}}, {{.Arch}}, {{.Variant}} and {{.Date}} are
+  available. Index annotations only have {{.Repo}}, {{.Tag}} and {{.Date}}.
+
+  The "annotations" of the config file, and those of the binary's entry
+  in "packages", are set on each manifest too, and the former also on the
+  index. Flags take precedence over them.
+
+Authentication:
+
+  Credentials are read from the GOX_REGISTRY_USERNAME and
+  GOX_REGISTRY_PASSWORD environment variables, falling back to the "auths"
+  entries of the docker config file ($DOCKER_CONFIG/config.json or
+  ~/.docker/config.json), then its credential helpers ("credHelpers" and
+  "credsStore", such as those of "docker login" on macOS, or of ECR and
+  GCR), then the login of the registry in ~/.netrc (or $NETRC).
+
+`
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The "main" method for `gox import`.
+func mainImport(args []string) int {
+	var configPath string
+	var force bool
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, importHelpText) }
+	flags.StringVar(&configPath, "config", DefaultConfigFile, "")
+	flags.BoolVar(&force, "force", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 1
+	}
+	if flags.Arg(0) != "goreleaser" {
+		fmt.Fprintf(os.Stderr, "Unknown config to import %q, must be goreleaser\n", flags.Arg(0))
+		return 1
+	}
+
+	file := flags.Arg(1)
+	if file == "" {
+		for _, f := range goreleaserFiles {
+			if _, err := os.Stat(f); err == nil {
+				file = f
+				break
+			}
+		}
+		if file == "" {
+			fmt.Fprintf(os.Stderr, "No goreleaser config found, looked for %s\n", strings.Join(goreleaserFiles, ", "))
+			return 1
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	// Builds of the module's own directory are keyed by its path
+	module := "."
+	if output, err := execGo("go", nil, "", "list", "-m"); err == nil {
+		if mod := strings.TrimSpace(strings.SplitN(output, "\n", 2)[0]); mod != "" && mod != "command-line-arguments" {
+			module = mod
+		}
+	}
+	ports := make(map[string]bool)
+	if dist, err := DistPlatforms("go"); err == nil {
+		for p := range dist {
+			ports[p] = true
+		}
+	} else {
+		for _, p := range PlatformsLatest {
+			ports[p.OS+"/"+p.Arch] = true
+		}
+	}
+	config, warnings, err := importGoreleaser(data, projectName(), module, ports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", file, err)
+		return 1
+	}
+
+	fmt.Printf("--> Imported %s\n", file)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "    Warning: %s\n", w)
+	}
+	return writeInitConfig(config, nil, configPath, force)
+}
+
+const importHelpText = `Usage: gox import [options] goreleaser [FILE]
+
+  Translates the builds, archives and checksum sections of a goreleaser
+  config into a gox config file, for projects that use goreleaser only to
+  build and package. FILE defaults to the .goreleaser.yaml, or any of the
+  other names goreleaser reads, in the current directory.
+
+  Build platforms (goos, goarch, goarm and the other levels, ignore, and
+  targets) become "osarch", each build's main package, binary, ldflags
+  and tags an entry of "packages", the first archives entry "archives",
+  and checksum "checksums". Templates are translated to gox's fields,
+  such as {{ .Os }} to {{.OS}}. What has no equivalent in gox, such as
+  hooks, env, other sections and template functions, is listed as a
+  warning and left out, so check the config before the first release.
+
+Options:
+
+  -config="gox.json"  Path of the config file to write
+  -force              Overwrite an existing config file
+
+`
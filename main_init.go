@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The "main" method for `gox init`.
+func mainInit(args []string) int {
+	var tplName, name, configPath string
+	var force, interactive bool
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, initHelpText()) }
+	flags.StringVar(&tplName, "template", "cli", "")
+	flags.StringVar(&name, "name", "", "")
+	flags.StringVar(&configPath, "config", DefaultConfigFile, "")
+	flags.BoolVar(&force, "force", false, "")
+	flags.BoolVar(&interactive, "interactive", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	tpl, ok := initTemplates[tplName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown template %q, must be one of: %s\n",
+			tplName, strings.Join(initTemplateNames(), ", "))
+		return 1
+	}
+
+	var config *initConfig
+	var files map[string]string
+	if interactive {
+		insp := inspectModule("go")
+		if name != "" {
+			insp.Name = name
+		}
+		config, files = initWizard(os.Stdin, os.Stdout, insp)
+		fmt.Println()
+	} else {
+		if name == "" {
+			name = projectName()
+		}
+		config, files = tpl.Config(name)
+	}
+	return writeInitConfig(config, files, configPath, force)
+}
+
+// writeInitConfig writes config to configPath along with files, unless
+// any of them exists and force isn't set.
+func writeInitConfig(config *initConfig, files map[string]string, configPath string, force bool) int {
+	if files == nil {
+		files = make(map[string]string)
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	files[configPath] = string(data) + "\n"
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if !force {
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				fmt.Fprintf(os.Stderr, "%s already exists, use -force to overwrite it\n", p)
+				return 1
+			}
+		}
+	}
+
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		if err := ioutil.WriteFile(p, []byte(files[p]), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		fmt.Printf("--> Wrote %s\n", p)
+	}
+
+	return 0
+}
+
+// majorVersionRe matches the major version suffix of a module path.
+var majorVersionRe = regexp.MustCompile(`/v[0-9]+$`)
+
+// projectName is the last element of the module path of the current
+// directory, without a major version suffix, or the directory's name.
+func projectName() string {
+	if output, err := execGo("go", nil, "", "list", "-m"); err == nil {
+		mod := strings.TrimSpace(strings.SplitN(output, "\n", 2)[0])
+		if mod != "" && mod != "command-line-arguments" {
+			return path.Base(majorVersionRe.ReplaceAllString(mod, ""))
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "app"
+	}
+	return filepath.Base(wd)
+}
+
+func initHelpText() string {
+	var templates strings.Builder
+	for _, name := range initTemplateNames() {
+		fmt.Fprintf(&templates, "  %-20s%s\n", name, initTemplates[name].Description)
+	}
+
+	return fmt.Sprintf(`Usage: gox init [options]
+
+  Writes a config file for a common kind of release: the platforms to
+  build, per-platform archives named the way the ecosystem expects, and a
+  checksums file. Edit it to taste, then run "gox" to build the release
+  into dist/.
+
+  With -interactive, gox looks at the module first, for its main packages,
+  whether they use cgo and a goreleaser config, and then asks for the
+  project name, the kind of release (one of the templates), the platforms,
+  the archive format and directory, and the output path template of the
+  binaries, with defaults from what it found. Press enter to take them.
+
+Templates:
+
+%s
+Options:
+
+  -template="cli"     Template to use
+  -name=""            Project name, defaults to the last element of the
+                      module path
+  -config="gox.json"  Path of the config file to write
+  -force              Overwrite existing files
+  -interactive        Inspect the module and ask questions (see above)
+
+`, templates.String())
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The "main" method for `gox inspect`.
+func mainInspect(args []string) int {
+	var format, goCmd string
+	var deps bool
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, inspectHelpText) }
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.BoolVar(&deps, "deps", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown -format %q, must be text or json\n", format)
+		return 1
+	}
+
+	var inspections []*Inspection
+	status := 0
+	for _, path := range flags.Args() {
+		result, err := InspectArtifact(goCmd, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 1
+			continue
+		}
+		inspections = append(inspections, result...)
+	}
+
+	if format == "json" {
+		if inspections == nil {
+			inspections = []*Inspection{}
+		}
+		data, err := json.MarshalIndent(inspections, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		fmt.Printf("%s\n", data)
+		return status
+	}
+	for _, i := range inspections {
+		printInspection(os.Stdout, i, deps)
+	}
+	return status
+}
+
+// printInspection writes i as text, with the module dependencies if deps
+// is set.
+func printInspection(w io.Writer, i *Inspection, deps bool) {
+	line := func(name, value string) {
+		fmt.Fprintf(w, "    %-12s %s\n", name, value)
+	}
+
+	fmt.Fprintf(w, "--> %s\n", i.Path)
+	line("format", strings.TrimSpace(i.Format+" "+i.Arch))
+	if i.GoVersion == "" {
+		line("go", "no build info, not built by Go")
+	} else {
+		line("platform", strings.TrimSpace(i.Settings["GOOS"]+"/"+i.Settings["GOARCH"]))
+		line("go", i.GoVersion)
+		line("package", i.Package)
+		if i.Module != "" {
+			line("module", i.Module)
+		}
+	}
+	if i.BuildID != nil {
+		line("build id", "sources "+i.BuildID.Sources+", see gox verify")
+	}
+
+	switch {
+	case i.Format == "WebAssembly":
+	case len(i.Libraries) == 0 && i.Interpreter == "":
+		line("libraries", "none, statically linked")
+	default:
+		if i.Interpreter != "" {
+			line("interpreter", i.Interpreter)
+		}
+		for n, lib := range i.Libraries {
+			name := ""
+			if n == 0 {
+				name = "libraries"
+			}
+			line(name, lib)
+		}
+	}
+
+	line("size", formatSize(i.Size))
+	for _, s := range i.Sizes {
+		line("", fmt.Sprintf("%-8s %10s %5.1f%%", s.Kind, formatSize(s.Size), percent(s.Size, i.Size)))
+	}
+
+	if len(i.Settings) > 0 {
+		keys := make([]string, 0, len(i.Settings))
+		for k := range i.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for n, k := range keys {
+			name := ""
+			if n == 0 {
+				name = "settings"
+			}
+			line(name, k+"="+i.Settings[k])
+		}
+	}
+
+	if deps {
+		for n, d := range i.Deps {
+			name := ""
+			if n == 0 {
+				name = "deps"
+			}
+			line(name, d)
+		}
+	} else if len(i.Deps) > 0 {
+		line("deps", fmt.Sprintf("%d modules, listed with -deps", len(i.Deps)))
+	}
+	fmt.Fprintln(w)
+}
+
+const inspectHelpText = `Usage: gox inspect [options] artifact...
+
+  Prints what a binary was built as: the format and architecture of its
+  header, the platform, Go version, package, module version and build
+  settings that Go recorded in it (as "go version -m" does), the shared
+  libraries it is linked against, and how its size splits up between
+  code, read-only data, the pclntab, data, debug info and symbols. The
+  build ID of "-build-id" is shown too. Archives of binaries, .tar.gz,
+  .tar and .zip, have each binary in them inspected.
+
+  This is handy for reports of the wrong binary being downloaded, such as
+  one for another platform, or a dynamically linked one.
+
+    $ gox inspect dist/app_linux_amd64
+    $ gox inspect -format=json dist/app_windows_arm64.zip
+
+  If an artifact can't be inspected the exit status is 1.
+
+Options:
+
+  -format="text"      Output format: text or json
+  -deps               List the module dependencies too
+  -gocmd="go"         Go command that reads the build info
+`
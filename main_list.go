@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The "main" method for `gox list`.
+func mainList(args []string) int {
+	var format, goVersion, compiler, experimental string
+	var defaultOnly, cgoSupported bool
+	var tier int
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, listHelpText) }
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&goVersion, "go-version", "", "")
+	flags.StringVar(&compiler, "compiler", compilerGc, "")
+	flags.StringVar(&experimental, "enable-experimental", "", "")
+	flags.BoolVar(&defaultOnly, "default-only", false, "")
+	flags.BoolVar(&cgoSupported, "cgo-supported", false, "")
+	flags.IntVar(&tier, "tier", 0, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	experiments, err := EnabledExperiments(experimental)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if err := ValidateCompiler(compiler); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	versionStr := "go" + strings.TrimPrefix(goVersion, "go")
+	if goVersion == "" {
+		if versionStr, err = GoVersion(); err != nil {
+			fmt.Fprintf(os.Stderr, "error reading Go version: %s\n", err)
+			return 1
+		}
+	}
+
+	var platforms []ListedPlatform
+	for _, p := range ListPlatforms(versionStr, compiler, experiments) {
+		if defaultOnly && !p.Default {
+			continue
+		}
+		if cgoSupported && !p.Cgo {
+			continue
+		}
+		if tier > 0 && (p.Tier == 0 || p.Tier > tier) {
+			continue
+		}
+		platforms = append(platforms, p)
+	}
+
+	if err := WriteList(os.Stdout, format, platforms); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+const listHelpText = `Usage: gox list [options]
+
+  Prints the platforms that gox supports for a Go version, with whether
+  each is built by default, its tier, whether it supports cgo, and the experiment
+  that it comes from, if any. Use this rather than reading the output of
+  "gox -osarch-list".
+
+    $ gox list -default-only -format=json
+    $ gox list -cgo-supported -go-version=1.21
+
+Options:
+
+  -format="text"      Output format: text, json, or csv
+  -default-only       Only list the platforms that are built by default
+  -cgo-supported      Only list the platforms that support cgo
+  -tier=0             Only list the ports of this tier or better, 1 for the
+                      first-class ports of the Go porting policy
+  -go-version=""      Go version to list the platforms of, such as 1.22,
+                      defaults to that of the go command
+  -compiler="gc"      Compiler whose platforms to list: gc, gccgo, or tinygo
+  -enable-experimental=""
+                      Comma-separated list of experiments to enable
+`
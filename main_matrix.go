@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The "main" method for `gox matrix`.
+func mainMatrix(args []string) int {
+	var platformFlag PlatformFlag
+	var format, goVersion, compiler, experimental, config, host string
+	var tier int
+	flags := flag.NewFlagSet("matrix", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, matrixHelpText) }
+	flags.Var(platformFlag.ArchFlagValue(), "arch", "")
+	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "")
+	flags.Var(platformFlag.OSFlagValue(), "os", "")
+	flags.Var(platformFlag.ARMArchFlagValue(), "armarch", "")
+	flags.StringVar(&format, "format", "github", "")
+	flags.StringVar(&goVersion, "go-version", "", "")
+	flags.StringVar(&compiler, "compiler", compilerGc, "")
+	flags.StringVar(&experimental, "enable-experimental", "", "")
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&host, "host", "", "")
+	flags.IntVar(&tier, "tier", 0, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	platforms, err := resolvePlatforms(&platformFlag, goVersion, compiler, experimental, config, host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if tier > 0 {
+		platforms = filterTier(platforms, tier)
+	}
+	if len(platforms) == 0 {
+		fmt.Fprintf(os.Stderr, "No valid platforms to build for\n")
+		return 1
+	}
+
+	if err := WriteMatrix(os.Stdout, format, platforms); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// resolvePlatforms works out the platforms that gox would build, as it
+// does for a build: those of the flags, or else of the config file, that
+// goVersion and the compiler support. Without goVersion the version of
+// the go command on the PATH is used.
+func resolvePlatforms(platformFlag *PlatformFlag, goVersion, compiler, experimental, configPath, hostOverride string) ([]Platform, error) {
+	experiments, err := EnabledExperiments(experimental)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCompiler(compiler); err != nil {
+		return nil, err
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading config: %s", err)
+	}
+	host, err := HostPlatform(hostOverride)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(platformFlag.OS) == 0 && len(platformFlag.Arch) == 0 && len(platformFlag.OSArch) == 0 {
+		platformFlag.OSArchFlagValue().Set(strings.Join(config.OSArch, " "))
+	}
+	platformFlag.ResolveHost(host)
+
+	versionStr := "go" + strings.TrimPrefix(goVersion, "go")
+	if goVersion == "" {
+		if versionStr, err = GoVersion(); err != nil {
+			return nil, fmt.Errorf("error reading Go version: %s", err)
+		}
+	}
+
+	return platformFlag.Platforms(
+		experiments.Platforms(versionStr, CompilerPlatforms(compiler, versionStr))), nil
+}
+
+const matrixHelpText = `Usage: gox matrix [options]
+
+  Prints the platforms that gox would build as a CI matrix, so that a
+  pipeline with a job for each platform builds the same ones as gox. The
+  platforms are picked like they are for a build, by -os, -arch and -osarch
+  or else the config file, and left out if the Go version doesn't support
+  them.
+
+  Each entry has the os, arch and arm of its platform, and the osarch
+  that builds just it, as in "gox -osarch=${{ matrix.osarch }}".
+
+    jobs:
+      platforms:
+        steps:
+          - id: matrix
+            run: echo "matrix=$(gox matrix)" >> "$GITHUB_OUTPUT"
+        outputs:
+          matrix: ${{ steps.matrix.outputs.matrix }}
+      build:
+        needs: platforms
+        strategy:
+          matrix: ${{ fromJSON(needs.platforms.outputs.matrix) }}
+
+Options:
+
+  -format="github"    github for the "include" of a matrix on one line,
+                      gitlab for the parallel matrix of a job, with GOX_OS,
+                      GOX_ARCH, GOX_ARM and GOX_OSARCH, or json for a list
+  -os=""              Space-separated list of operating systems
+  -arch=""            Space-separated list of architectures
+  -osarch=""          Space-separated list of os/arch pairs
+  -armarch=""         Space-separated list of GOARM versions
+  -go-version=""      Go version to check platforms against, such as 1.22,
+                      defaults to that of the go command on the PATH
+  -compiler="gc"      Compiler whose platforms to use: gc, gccgo, or tinygo
+  -enable-experimental=""
+                      Comma-separated list of experiments to enable
+  -config=""          Config file, defaults to gox.json if it exists
+  -host=""            Host os/arch for "host" in the platform flags
+  -tier=0             Only include the ports of this tier or better
+`
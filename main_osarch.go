@@ -4,15 +4,19 @@ import (
 	"fmt"
 )
 
-func mainListOSArch(version string) int {
+func mainListOSArch(version, compiler string, experiments ExperimentSet) int {
 	fmt.Printf(
 		"Supported OS/Arch combinations for %s are shown below. The \"default\"\n"+
 			"boolean means that if you don't specify an OS/Arch, it will be\n"+
 			"included by default. If it isn't a default OS/Arch, you must explicitly\n"+
 			"specify that OS/Arch combo for Gox to use it.\n\n",
 		version)
-	for _, p := range SupportedPlatforms(version) {
-		fmt.Printf("%s\t(default: %v)\n", p.String(), p.Default)
+	for _, p := range ListPlatforms(version, compiler, experiments) {
+		if p.Experiment != "" {
+			fmt.Printf("%s\t(default: false, experimental: %s)\n", p.OSArch, p.Experiment)
+		} else {
+			fmt.Printf("%s\t(default: %v)\n", p.OSArch, p.Default)
+		}
 	}
 
 	return 0
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The "main" method for `gox promote`.
+func mainPromote(args []string) int {
+	var from, to, configPath, goCmd string
+	var force bool
+	flags := flag.NewFlagSet("promote", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, promoteHelpText) }
+	flags.StringVar(&from, "from", "", "")
+	flags.StringVar(&to, "to", "", "")
+	flags.StringVar(&configPath, "config", "", "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.BoolVar(&force, "force", false, "")
+	if err := flags.Parse(args); err != nil {
+		flags.Usage()
+		return 1
+	}
+	if from == "" || to == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	cleanupSecrets, err := config.LoadSecrets()
+	defer cleanupSecrets()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	// Releases are named without the "v" of their tag
+	version := strings.TrimPrefix(flags.Arg(0), "v")
+	paths, err := Promote(&PromoteOpts{
+		Config:  config,
+		From:    from,
+		To:      to,
+		Version: version,
+		Force:   force,
+		GoCmd:   goCmd,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	for _, path := range paths {
+		fmt.Printf("--> %s\n", path)
+	}
+
+	fmt.Printf("\nPromoted %s from %s to %s\n", version, from, to)
+	return 0
+}
+
+const promoteHelpText = `Usage: gox promote [options] -from=CHANNEL -to=CHANNEL VERSION
+
+  Copies a release that was already built from one channel of the config
+  file to another, without building it again, for releasing the same
+  artifacts as a nightly and then as stable.
+
+  Channels are directories given by the "channels" section of the config
+  file. Every file of the release must match the release's checksums file
+  (see the "checksums" section) before anything is copied. A channel with
+  "sign" set re-signs the darwin and windows binaries promoted into it with
+  the "codesign" and "authenticode" sections and writes the checksums
+  again, signed again with the "sign" section if it is set; archives are
+  copied as they are. The signature of the checksums is promoted with
+  them.
+
+    {
+      "channels": {
+        "nightly": {"dir": "/srv/releases/nightly/{{.Version}}"},
+        "stable": {"dir": "/srv/releases/stable/{{.Version}}", "sign": true}
+      }
+    }
+
+Options:
+
+  -from=""            Channel to promote the release from
+  -to=""              Channel to promote the release to
+  -config=""          Config file, defaults to gox.json if it exists
+  -force              Replace the release if it is already in the channel
+  -gocmd="go"         Go command used to read binary build information
+
+`
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// The "main" method for `gox serve`.
+func mainServe(args []string) int {
+	var listen, dir, goCmd, tokenEnv string
+	var parallel int
+	var otel bool
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, serveHelpText) }
+	flags.StringVar(&listen, "listen", ":7879", "")
+	flags.StringVar(&dir, "dir", filepath.Join(os.TempDir(), "gox-serve"), "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.StringVar(&tokenEnv, "token-env", "GOX_SERVE_TOKEN", "")
+	flags.IntVar(&parallel, "parallel", 1, "")
+	flags.BoolVar(&otel, "otel", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	goxCmd, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s isn't set, so anyone who can reach %s can run builds\n", tokenEnv, listen)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	server := newServeServer(dir, goxCmd, goCmd, token, parallel)
+	server.Log = os.Stdout
+	server.Otel = otel
+	fmt.Printf("--> Listening on %s with -parallel=%d, keeping jobs in %s\n", listen, parallel, dir)
+	if err := http.ListenAndServe(listen, server); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+const serveHelpText = `Usage: gox serve [options]
+
+  EXPERIMENTAL. Runs a build service with an HTTP API: a job names a git
+  repository and ref, or a module and version, and the platforms, packages
+  and gox flags to build it with. Jobs run one after another, or -parallel
+  at once, each with this gox in its own directory under -dir, and their
+  artifacts are kept there until the service is restarted.
+
+    POST /v1/jobs                    Submit a job, which returns it with 202:
+                                     {"repository": "https://...", "ref": "v1.2.0",
+                                      "targets": ["linux/amd64"], "flags": ["-ldflags=-s -w"]}
+                                     or {"module": "example.com/app", "version": "v1.2.0"}
+    GET  /v1/jobs                    List the jobs
+    GET  /v1/jobs/ID                 Get the status, error and artifacts of a job
+    GET  /v1/jobs/ID/log             Stream the output of a job until it is done
+    GET  /v1/jobs/ID/artifacts/NAME  Download an artifact of a job
+    GET  /metrics                    Metrics for Prometheus to scrape
+
+  Jobs can only set the flags that choose what is built and how: -os,
+  -arch, -osarch, -armarch, -tags, -buildmode, -mod, -goexperiment,
+  -allow-failures, -cgo, -race, -reproducible, -static, -strip, -build-id
+  and -verbose, with "-flag=value" for those with values. "-ldflags" can
+  only have -s, -w, -X and -buildid. The gox.json of the repository is
+  ignored, so that it can't run commands or read secrets with the
+  environment of the service, and refs, modules and versions can't start
+  with "-".
+
+  Set the token in the -token-env variable and send it as
+  "Authorization: Bearer TOKEN": without it anyone who reaches the service
+  can run builds on it. Serve it behind TLS outside of a trusted network.
+
+  The metrics are the jobs that are queued and running, the jobs that
+  finished and the builds of each platform by status, "built", "up-to-date"
+  or "failed", and histograms of how long jobs and compiles took. With
+  -otel each job is also exported as an OpenTelemetry trace, the way
+  "gox -otel" is, with the spans of its gox run under it (see "gox -h").
+
+Options:
+
+  -listen=":7879"     Address to listen on
+  -dir=""             Where jobs are built, defaults to gox-serve in the
+                      temporary directory
+  -gocmd="go"         Go command to download modules and build with
+  -parallel=1         Number of jobs to run at once
+  -otel               Export a trace of every job with OTLP
+  -token-env="GOX_SERVE_TOKEN"
+                      Environment variable with the token that requests
+                      must carry
+
+`
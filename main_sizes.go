@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The "main" method for `gox sizes`.
+func mainSizes(args []string) int {
+	var compare, threshold, outputTpl, configPath string
+	var warn bool
+	flags := flag.NewFlagSet("sizes", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, sizesHelpText) }
+	flags.StringVar(&compare, "compare", "", "")
+	flags.StringVar(&threshold, "threshold", "10%", "")
+	flags.BoolVar(&warn, "warn", false, "")
+	flags.StringVar(&outputTpl, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "")
+	flags.StringVar(&configPath, "config", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || compare == "" {
+		flags.Usage()
+		return 1
+	}
+
+	limit, err := parseSizeThreshold(threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -threshold: %s\n", err)
+		return 1
+	}
+
+	dir := outputTemplateDir(outputTpl)
+	m, err := LoadArtifactManifest(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", filepath.Join(dir, manifestName), err)
+		return 1
+	}
+	if len(m.Artifacts) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no artifacts, build first\n", filepath.Join(dir, manifestName))
+		return 1
+	}
+
+	// A path is a manifest, anything else the tag of a release
+	var changes []SizeChange
+	if _, err := os.Stat(compare); err == nil {
+		previous, err := findManifest("", compare)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading -compare: %s\n", err)
+			return 1
+		}
+		fmt.Printf("==> Comparing the sizes of the binaries with %s\n\n", compare)
+		changes = CompareManifestSizes(previous, m)
+	} else {
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+			return 1
+		}
+		if config.Release == nil {
+			fmt.Fprintf(os.Stderr, "-compare=%s isn't a manifest, and comparing with a release needs the \"release\" section of the config\n", compare)
+			return 1
+		}
+		cleanupSecrets, err := config.LoadSecrets()
+		defer cleanupSecrets()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		r, err := config.Release.FindRelease(compare)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding the release %s: %s\n", compare, err)
+			return 1
+		}
+		sizes, err := config.Release.AssetSizes(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the assets of %s: %s\n", compare, err)
+			return 1
+		}
+		fmt.Printf("==> Comparing the sizes of the artifacts with the release %s\n\n", compare)
+		artifacts, _ := config.Release.Artifacts(m)
+		changes = CompareReleaseSizes(sizes, config.Release.version(compare), artifacts, m.Version)
+	}
+
+	exceeded := 0
+	for _, c := range changes {
+		if c.Before == 0 {
+			fmt.Printf("--> %s: %s, new\n", c.Name, formatSize(c.After))
+			continue
+		}
+		msg := fmt.Sprintf("--> %s: %s -> %s (%s, %+.1f%%)", c.Name, formatSize(c.Before),
+			formatSize(c.After), formatGrowth(c.Growth()), percent(c.Growth(), c.Before))
+		if limit.Exceeded(c) {
+			exceeded++
+			msg += fmt.Sprintf(", grew more than %s", limit)
+		}
+		fmt.Println(msg)
+	}
+
+	if exceeded > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d of %d artifacts grew more than %s\n", exceeded, len(changes), limit)
+		if !warn {
+			return 1
+		}
+	}
+	return 0
+}
+
+// formatGrowth formats a change of size with its sign.
+func formatGrowth(n int64) string {
+	if n < 0 {
+		return formatSize(n)
+	}
+	return "+" + formatSize(n)
+}
+
+const sizesHelpText = `Usage: gox sizes -compare=<manifest or tag> [options]
+
+  Compares the sizes of what the last build wrote, according to the
+  gox-manifest.json of the output directory, with those of an earlier
+  build or release, and fails if any of them grew by more than the
+  threshold. This catches a dependency that doubles the size of the
+  binaries before it is released.
+
+  If -compare is the gox-manifest.json of an earlier build, or its
+  directory, the binary of each platform is compared with the one of the
+  same platform, package and variant. Otherwise it is the tag of a
+  release of the forge in the "release" section of the config, and the
+  artifacts attached to it, usually archives, are compared with those of
+  the same names, other than their versions.
+
+    $ gox sizes -compare=previous/gox-manifest.json
+    $ gox sizes -compare=v1.4.0 -threshold=512K -warn
+
+Options:
+
+  -compare=""         Manifest, its directory, or release tag to compare with
+  -threshold="10%"    Most an artifact may grow, a percentage of its earlier
+                      size or a size such as 512K
+  -warn               Only warn when an artifact grew more than -threshold,
+                      rather than exit with status 1
+  -output="foo"       Output path template of the build to compare
+  -config=""          Config file, defaults to gox.json if it exists
+`
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The "main" method for `gox toolchains`.
+func mainToolchains(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, toolchainsHelpText)
+		return 1
+	}
+
+	switch args[0] {
+	case "bundle":
+		return mainToolchainsBundle(args[1:])
+	case "restore":
+		return mainToolchainsRestore(args[1:])
+	}
+
+	fmt.Fprint(os.Stderr, toolchainsHelpText)
+	return 1
+}
+
+func mainToolchainsBundle(args []string) int {
+	var output string
+	var goCmds stringSliceValue
+	flags := flag.NewFlagSet("toolchains bundle", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, toolchainsHelpText) }
+	flags.StringVar(&output, "output", "gox-toolchains.tar.gz", "")
+	flags.Var(&goCmds, "gocmd", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+	if len(goCmds) == 0 {
+		goCmds = stringSliceValue{"go"}
+	}
+
+	fmt.Printf("==> Bundling toolchains into %s\n", output)
+	manifest, err := BundleToolchains(output, goCmds)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error bundling toolchains: %s\n", err)
+		return 1
+	}
+
+	for _, g := range manifest.Go {
+		fmt.Printf("--> %s\n", g.Version)
+	}
+	if manifest.ModCache != "" {
+		fmt.Printf("--> module cache\n")
+	}
+	for _, cc := range manifest.CC {
+		fmt.Printf("--> %s: %s\n", cc.Var, cc.Dir)
+	}
+	return 0
+}
+
+func mainToolchainsRestore(args []string) int {
+	var dir string
+	flags := flag.NewFlagSet("toolchains restore", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, toolchainsHelpText) }
+	flags.StringVar(&dir, "dir", "gox-toolchains", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	fmt.Printf("==> Restoring %s into %s\n", flags.Arg(0), dir)
+	if _, err := RestoreToolchains(flags.Arg(0), dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring toolchains: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("\nTo build with the restored toolchains, run:\n\n    . %s\n",
+		filepath.Join(dir, "env.sh"))
+	return 0
+}
+
+const toolchainsHelpText = `Usage: gox toolchains bundle [options]
+       gox toolchains restore [options] BUNDLE
+
+  Packs everything a build needs into a single archive, so that matrix
+  builds can run on machines without network access.
+
+  "bundle" is run on a connected machine, in the module to build. The
+  bundle holds the GOROOT of each Go toolchain, a module cache with every
+  module in the build list, downloaded through the usual GOPROXY, and the
+  C cross toolchain of each compiler set with GOX_[OS]_[ARCH]_CC or
+  GOX_[OS]_[ARCH]_CXX. A compiler's toolchain is the directory above its
+  bin directory, so compilers installed straight into /usr can't be
+  bundled.
+
+  "restore" unpacks a bundle and writes an env.sh into it that puts the
+  first Go toolchain on the PATH, points GOMODCACHE and the GOX_*_CC
+  variables at the restored copies and sets GOPROXY=off and
+  GOTOOLCHAIN=local. Source it before running Gox.
+
+Options for bundle:
+
+  -output="gox-toolchains.tar.gz"  Path of the bundle
+  -gocmd="go"                      Go toolchain to bundle, may be repeated
+
+Options for restore:
+
+  -dir="gox-toolchains"            Directory to restore the bundle into
+
+`
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The "main" method for `gox verify`.
+func mainVerify(args []string) int {
+	var manifestPath string
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, verifyHelpText) }
+	flags.StringVar(&manifestPath, "manifest", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		id, encoded, err := ReadBuildID(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--> %s: %s\n", path, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("--> %s\n", path)
+		for _, f := range id.Fields() {
+			fmt.Printf("    %-10s %s\n", f[0], f[1])
+		}
+
+		m, err := findManifest(path, manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "    %s\n", err)
+			failed++
+			continue
+		}
+		problems, err := VerifyBuildID(path, encoded, m)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "    %s\n", err)
+			failed++
+			continue
+		}
+		if len(problems) > 0 {
+			failed++
+			for _, p := range problems {
+				fmt.Printf("    MISMATCH: %s\n", p)
+			}
+			continue
+		}
+		fmt.Printf("    matches %s\n", filepath.Join(m.dir, manifestName))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d of %d binaries failed to verify\n", failed, flags.NArg())
+		return 1
+	}
+	return 0
+}
+
+// findManifest loads the manifest at path, the file or its directory, or
+// without a path the one in the directory of the binary or the nearest
+// directory above it.
+func findManifest(binary, path string) (*ArtifactManifest, error) {
+	if path != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if filepath.Base(path) != manifestName {
+				return nil, fmt.Errorf("-manifest must be a %s or its directory", manifestName)
+			}
+			path = filepath.Dir(path)
+		}
+		if _, err := os.Stat(filepath.Join(path, manifestName)); err != nil {
+			return nil, err
+		}
+		return LoadArtifactManifest(path)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(binary))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, manifestName)); err == nil {
+			return LoadArtifactManifest(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no %s in the directories of the binary, give it with -manifest", manifestName)
+		}
+		dir = parent
+	}
+}
+
+// The "main" method for `gox verify-reproducible`.
+func mainVerifyReproducible(args []string) int {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		fmt.Fprint(os.Stderr, verifyReproducibleHelpText)
+		return 1
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding gox executable: %s\n", err)
+		return 1
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	defer os.RemoveAll(td)
+
+	// Both builds must agree on the timestamps
+	if err := setSourceDateEpoch(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	outputTpl, args := splitOutputFlag(args)
+	if filepath.IsAbs(outputTpl) {
+		fmt.Fprintf(os.Stderr, "-output must be relative, since each build is written to its own directory\n")
+		return 1
+	}
+
+	dirs := []string{filepath.Join(td, "1"), filepath.Join(td, "2")}
+	for i, dir := range dirs {
+		fmt.Printf("==> Build %d of %d\n\n", i+1, len(dirs))
+		cmdArgs := append([]string{
+			"-reproducible",
+			"-output", filepath.ToSlash(filepath.Join(dir, outputTpl)),
+		}, args...)
+		cmd := exec.Command(self, cmdArgs...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = os.Environ()
+
+		// Build the second time with an empty build cache, so that
+		// nothing built the first time is reused.
+		if i > 0 {
+			cmd.Env = append(cmd.Env, "GOCACHE="+filepath.Join(td, "gocache"))
+		}
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nBuild %d failed: %s\n", i+1, err)
+			return 1
+		}
+		fmt.Println()
+	}
+
+	diffs, err := compareDirs(dirs[0], dirs[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing builds: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("==> Comparing builds\n\n")
+	failed := 0
+	for _, d := range diffs {
+		if d.A == d.B {
+			fmt.Printf("--> %s: %s\n", d.Name, d.A)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(os.Stderr, "--> %s differs: %s != %s\n", d.Name, orMissing(d.A), orMissing(d.B))
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d of %d files were not reproducible\n", failed, len(diffs))
+		return 1
+	}
+
+	fmt.Printf("\nAll %d files are reproducible\n", len(diffs))
+	return 0
+}
+
+// fileDiff is the digest of a file in each of two directories. A missing
+// file has an empty digest.
+type fileDiff struct {
+	Name string
+	A, B string
+}
+
+// compareDirs returns the digest of every file in either of a and b.
+func compareDirs(a, b string) ([]fileDiff, error) {
+	digestsA, err := dirDigests(a)
+	if err != nil {
+		return nil, err
+	}
+	digestsB, err := dirDigests(b)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(digestsA))
+	for name := range digestsA {
+		names = append(names, name)
+	}
+	for name := range digestsB {
+		if _, ok := digestsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]fileDiff, len(names))
+	for i, name := range names {
+		result[i] = fileDiff{Name: name, A: digestsA[name], B: digestsB[name]}
+	}
+
+	return result, nil
+}
+
+// dirDigests returns the digest of every file under dir, keyed by the
+// slash-separated path relative to dir.
+func dirDigests(dir string) (map[string]string, error) {
+	result := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(rel)] = sha256Digest(data)
+		return nil
+	})
+
+	return result, err
+}
+
+func orMissing(digest string) string {
+	if digest == "" {
+		return "missing"
+	}
+	return digest
+}
+
+// splitOutputFlag removes the -output flag from build arguments, returning
+// its value, or the default output template if it isn't set.
+func splitOutputFlag(args []string) (string, []string) {
+	value := "{{.Dir}}_{{.OS}}_{{.Arch}}"
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			result = append(result, args[i:]...)
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		switch {
+		case name == "output" && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(name, "output="):
+			value = name[len("output="):]
+		default:
+			result = append(result, arg)
+		}
+	}
+
+	return value, result
+}
+
+const verifyHelpText = `Usage: gox verify [options] binary...
+
+  Prints the build ID that "-build-id" linked into each binary, and checks
+  it against the gox-manifest.json of the build: the manifest must record
+  the binary, by its path or its checksum, with the same SHA-256 digest
+  and build ID. The manifest is looked for in the directory of the binary
+  and the directories above it.
+
+  If any binary has no build ID or doesn't match, the exit status is 1.
+
+Options:
+
+  -manifest=""        gox-manifest.json, or its directory, to check against
+`
+
+const verifyReproducibleHelpText = `Usage: gox verify-reproducible [options] [packages]
+
+  Builds the given packages twice with "-reproducible" and checks that
+  every file written is identical both times. This catches builds that
+  depend on the time, the build directory, the state of the build cache,
+  and so on.
+
+  The options are the same as for building. Each build is written to its
+  own temporary directory, using the "-output" template relative to it,
+  and the second build runs with an empty GOCACHE, so it takes longer
+  than a normal build.
+
+  The SHA-256 digest of each file is printed. If any files differ the
+  exit status is 1.
+
+`
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// The "main" method for `gox worker`.
+func mainWorker(args []string) int {
+	var listen, dir, goCmd, tokenEnv string
+	var parallel int
+	var insecure bool
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, workerHelpText) }
+	flags.StringVar(&listen, "listen", ":7878", "")
+	flags.StringVar(&dir, "dir", filepath.Join(os.TempDir(), "gox-worker"), "")
+	flags.StringVar(&goCmd, "gocmd", "go", "")
+	flags.StringVar(&tokenEnv, "token-env", "GOX_WORKER_TOKEN", "")
+	flags.IntVar(&parallel, "parallel", -1, "")
+	flags.BoolVar(&insecure, "insecure", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	if parallel < 1 {
+		parallel = runtime.NumCPU()
+	}
+	token := os.Getenv(tokenEnv)
+	switch {
+	case token == "" && !insecure:
+		fmt.Fprintf(os.Stderr, "%s isn't set, and without a token anyone who can reach %s can run builds; "+
+			"pass -insecure to run without one anyways\n", tokenEnv, listen)
+		return 1
+	case token == "":
+		fmt.Fprintf(os.Stderr, "Warning: %s isn't set, so anyone who can reach %s can run builds\n", tokenEnv, listen)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	server := newWorkerServer(dir, goCmd, token, parallel)
+	server.Log = os.Stdout
+	fmt.Printf("--> Listening on %s with -parallel=%d, keeping sources in %s\n", listen, parallel, dir)
+	if err := http.ListenAndServe(listen, server); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+const workerHelpText = `Usage: gox worker [options]
+
+  EXPERIMENTAL. Runs a build worker that "gox -builder=remote" sends the
+  builds of its platforms to, so that a large matrix, such as one with C
+  cross compilers for cgo, can be spread over several machines. Builds
+  run with the go command of the worker and the GOOS, GOARCH and other
+  settings of the build, and the C cross compilers that each worker has
+  in its own GOX_[OS]_[ARCH]_CC and _CXX.
+
+  The source of each build is a tarball that gox uploads once per worker,
+  or a git commit that the worker clones, and is kept in -dir. The worker
+  runs only "go build" and "go test -c", which it makes from the platform,
+  tags and flags of the build: linker flags other than -s, -w, -X,
+  -buildid, -linkmode and -extldflags "-static", compiler flags that write
+  files, and variables such as GOFLAGS are refused.
+
+  Set the token in the -token-env variable on both sides: the worker
+  won't start without it, unless -insecure is passed, since anyone who
+  reaches it could run builds on it. Serve it behind TLS outside of a
+  trusted network.
+
+Options:
+
+  -listen=":7878"     Address to listen on
+  -dir=""             Where sources are kept, defaults to gox-worker in the
+                      temporary directory
+  -gocmd="go"         Go command to build with
+  -parallel=-1        Number of builds to run at once, defaults to the
+                      number of CPUs
+  -token-env="GOX_WORKER_TOKEN"
+                      Environment variable with the token that requests
+                      must carry
+  -insecure           Run without a token
+
+`
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestName is the file in the output directory that records what a
+// run of gox wrote, so that release tooling downstream can read it rather
+// than look through the directory, and `gox clean` and -clean can remove
+// it again once the targets it was built for are gone.
+const manifestName = "gox-manifest.json"
+
+// The kinds of artifacts in an ArtifactManifest.
+const (
+	artifactBinary      = "binary"
+	artifactDebug       = "debug"
+	artifactGarbleMap   = "garble-map"
+	artifactArchive     = "archive"
+	artifactChecksums   = "checksums"
+	artifactPkgManifest = "package-manifest"
+	artifactPackage     = "package"
+	artifactLink        = "link"
+	artifactFatArchive  = "fat-archive"
+	artifactSignature   = "signature"
+)
+
+// ArtifactManifest lists the files that a run of gox wrote, with the
+// release version, commit and Go version they were built from. Started is
+// when the run started, in RFC 3339, and Duration how long it took in
+// seconds.
+type ArtifactManifest struct {
+	Version   string  `json:"version,omitempty"`
+	Commit    string  `json:"commit,omitempty"`
+	GoVersion string  `json:"go_version,omitempty"`
+	Started   string  `json:"started,omitempty"`
+	Duration  float64 `json:"duration"`
+
+	Artifacts []Artifact `json:"artifacts"`
+
+	dir  string
+	kept *ArtifactManifest
+	lock sync.Mutex
+}
+
+// Artifact is a file in an ArtifactManifest. Path is relative to the
+// directory of the manifest if it is inside of it. Size and SHA256 are
+// read when the manifest is written, once nothing changes the files.
+type Artifact struct {
+	Kind     string `json:"kind"`
+	Platform string `json:"platform,omitempty"`
+	Package  string `json:"package,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+
+	// Build is how a binary was built.
+	Build *ArtifactBuild `json:"build,omitempty"`
+}
+
+// ArtifactBuild is how a binary was built: the flags given to the go
+// command after the per-platform overrides, and how long the build took
+// in seconds. Up to date binaries weren't built by the run, so they have
+// no duration.
+type ArtifactBuild struct {
+	Ldflags      string  `json:"ldflags,omitempty"`
+	Gcflags      string  `json:"gcflags,omitempty"`
+	Asmflags     string  `json:"asmflags,omitempty"`
+	Tags         string  `json:"tags,omitempty"`
+	BuildMode    string  `json:"buildmode,omitempty"`
+	GoExperiment string  `json:"goexperiment,omitempty"`
+	FIPS         string  `json:"fips,omitempty"`
+	Cgo          bool    `json:"cgo"`
+	Race         bool    `json:"race,omitempty"`
+	Trimpath     bool    `json:"trimpath,omitempty"`
+	Static       bool    `json:"static,omitempty"`
+	Strip        bool    `json:"strip,omitempty"`
+	BuildID      string  `json:"build_id,omitempty"`
+	UpToDate     bool    `json:"up_to_date,omitempty"`
+	Duration     float64 `json:"duration"`
+}
+
+// NewArtifactManifest returns an empty manifest for the output directory
+// dir.
+func NewArtifactManifest(dir string) *ArtifactManifest {
+	return &ArtifactManifest{dir: dir}
+}
+
+// LoadArtifactManifest reads the manifest of the output directory dir.
+// Without one the manifest is empty.
+func LoadArtifactManifest(dir string) (*ArtifactManifest, error) {
+	m := NewArtifactManifest(dir)
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, json.Unmarshal(data, m)
+}
+
+// Add records the file at path, made for the build of r if it isn't nil.
+// It is safe to call from the builds and stages that run in parallel.
+func (m *ArtifactManifest) Add(kind string, r *BuildResult, path string) {
+	a := Artifact{Kind: kind, Path: path}
+	if r != nil {
+		a.Platform = r.Platform.String()
+		a.Package = r.Path
+		a.Variant = r.Variant
+	}
+	m.add(a)
+}
+
+// AddFor records the file at path, made from the artifact of, as being
+// for the same build, such as its signature.
+func (m *ArtifactManifest) AddFor(kind string, of Artifact, path string) {
+	m.add(Artifact{Kind: kind, Path: path, Platform: of.Platform, Package: of.Package, Variant: of.Variant})
+}
+
+func (m *ArtifactManifest) add(a Artifact) {
+	path := a.Path
+	if abs, err := filepath.Abs(path); err == nil {
+		a.Path = abs
+		if dir, err := filepath.Abs(m.dir); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !hasParentPrefix(rel) {
+				a.Path = filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Artifacts = append(m.Artifacts, a)
+}
+
+// AddResult records the binary of r, built with opts if it isn't nil, and
+// the debug info and garble map next to it if there are any.
+func (m *ArtifactManifest) AddResult(r BuildResult, opts *CompileOpts) {
+	m.Add(artifactBinary, &r, r.Output)
+	if opts != nil {
+		m.lock.Lock()
+		m.Artifacts[len(m.Artifacts)-1].Build = &ArtifactBuild{
+			Ldflags:      opts.Ldflags,
+			Gcflags:      opts.Gcflags,
+			Asmflags:     opts.Asmflags,
+			Tags:         opts.Tags,
+			BuildMode:    opts.BuildMode,
+			GoExperiment: opts.goExperiment(),
+			FIPS:         opts.FIPS,
+			Cgo:          opts.Cgo,
+			Race:         opts.Race,
+			Trimpath:     opts.Trimpath,
+			Static:       opts.Static,
+			Strip:        opts.Strip,
+			BuildID:      opts.BuildID,
+			UpToDate:     r.UpToDate,
+			Duration:     float64(r.Duration.Round(time.Millisecond)) / float64(time.Second),
+		}
+		m.lock.Unlock()
+	}
+	for kind, path := range map[string]string{
+		artifactDebug:     r.Output + ".debug",
+		artifactGarbleMap: r.Output + garbleMapExt,
+	} {
+		if _, err := os.Stat(path); err == nil {
+			m.Add(kind, &r, path)
+		}
+	}
+}
+
+// Carry records the artifacts of previous, other than those that
+// AddResult and the links record, that were made for the build of r.
+func (m *ArtifactManifest) Carry(previous *ArtifactManifest, r BuildResult) {
+	for _, a := range previous.Artifacts {
+		switch a.Kind {
+		case artifactBinary, artifactDebug, artifactGarbleMap, artifactLink, artifactSignature:
+			continue
+		}
+		if a.Platform == r.Platform.String() && a.Package == r.Path {
+			m.lock.Lock()
+			m.Artifacts = append(m.Artifacts, a)
+			m.lock.Unlock()
+		}
+	}
+}
+
+// Keep has Write record the artifacts of previous, the manifest of the
+// last run, for the targets that this run didn't build, and those of no
+// target that it didn't write again. The manifest then has everything
+// that gox wrote into the output directory, so that `gox clean` and
+// -overwrite still know about the targets that were built by an earlier
+// run. They aren't part of this run otherwise: they aren't signed,
+// uploaded or released again.
+func (m *ArtifactManifest) Keep(previous *ArtifactManifest) {
+	m.kept = previous
+}
+
+// keptArtifacts returns the artifacts of Keep that are to be recorded
+// along with those of the run, paths is the paths of the artifacts of the
+// run.
+func (m *ArtifactManifest) keptArtifacts(paths []string) ([]Artifact, []string) {
+	if m.kept == nil {
+		return nil, nil
+	}
+	key := func(a Artifact) string {
+		return a.Platform + " " + a.Package + " " + a.Variant
+	}
+	built := make(map[string]bool)
+	for _, a := range m.Artifacts {
+		if a.Platform != "" {
+			built[key(a)] = true
+		}
+	}
+	written := make(map[string]bool)
+	for _, path := range paths {
+		written[path] = true
+	}
+
+	var artifacts []Artifact
+	var keptPaths []string
+	for i, path := range m.kept.Paths() {
+		a := m.kept.Artifacts[i]
+		if written[path] || (a.Platform != "" && built[key(a)]) {
+			continue
+		}
+		written[path] = true
+		artifacts = append(artifacts, a)
+		keptPaths = append(keptPaths, path)
+	}
+	return artifacts, keptPaths
+}
+
+// Paths returns the paths of the artifacts, relative to the current
+// directory or absolute.
+func (m *ArtifactManifest) Paths() []string {
+	paths := make([]string, len(m.Artifacts))
+	for i, a := range m.Artifacts {
+		paths[i] = filepath.FromSlash(a.Path)
+		if !filepath.IsAbs(paths[i]) {
+			paths[i] = filepath.Join(m.dir, paths[i])
+		}
+	}
+	return paths
+}
+
+// Write writes the manifest to its output directory, sorted by path, and
+// returns the path of the file. The artifacts of Keep are written too,
+// but aren't added to m.
+func (m *ArtifactManifest) Write() (string, error) {
+	// Artifacts carried over from the last manifest may have been removed
+	// since
+	run, err := statArtifacts(m.Artifacts, m.Paths())
+	if err != nil {
+		return "", err
+	}
+	if run == nil {
+		run = []Artifact{}
+	}
+	sortArtifacts(run)
+	m.Artifacts = run
+	kept, err := statArtifacts(m.keptArtifacts(m.Paths()))
+	if err != nil {
+		return "", err
+	}
+
+	m.Artifacts = append(append([]Artifact{}, run...), kept...)
+	sortArtifacts(m.Artifacts)
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.Artifacts = run
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(m.dir, manifestName)
+	return path, ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// statArtifacts returns the artifacts at paths that are still there, with
+// their sizes and checksums.
+func statArtifacts(artifacts []Artifact, paths []string) ([]Artifact, error) {
+	var result []Artifact
+	for i, a := range artifacts {
+		info, err := os.Stat(paths[i])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if a.SHA256, err = fileSHA256(paths[i]); err != nil {
+			return nil, err
+		}
+		a.Size = info.Size()
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+func sortArtifacts(artifacts []Artifact) {
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].Path != artifacts[j].Path {
+			return artifacts[i].Path < artifacts[j].Path
+		}
+		return artifacts[i].Kind < artifacts[j].Kind
+	})
+}
+
+// hasParentPrefix reports whether the relative path rel starts with "..".
+func hasParentPrefix(rel string) bool {
+	return len(rel) > 2 && rel[:2] == ".." && os.IsPathSeparator(rel[2])
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifactManifest(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	binary := filepath.Join(td, "linux", "app")
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, path := range []string{binary, binary + ".debug"} {
+		if err := ioutil.WriteFile(path, []byte("x"), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	outside := filepath.Join(os.TempDir(), "gox-elsewhere.tar.gz")
+
+	if err := ioutil.WriteFile(outside, []byte("archive"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(outside)
+
+	r := BuildResult{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		Path:     "example.com/app",
+		Output:   binary,
+		Duration: 1500 * time.Millisecond,
+	}
+	m := NewArtifactManifest(td)
+	m.Version = "1.2.3"
+	m.AddResult(r, &CompileOpts{Ldflags: "-s -w", Tags: "netgo"})
+	m.Add(artifactArchive, &r, outside)
+	m.Add(artifactChecksums, nil, filepath.Join(td, "removed.txt"))
+	if _, err := m.Write(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	loaded, err := LoadArtifactManifest(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum := "2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881"
+	expected := []Artifact{
+		{Kind: artifactArchive, Platform: "linux/amd64", Package: "example.com/app", Path: outside,
+			Size: 7, SHA256: "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3"},
+		{Kind: artifactBinary, Platform: "linux/amd64", Package: "example.com/app", Path: "linux/app",
+			Size: 1, SHA256: sum, Build: &ArtifactBuild{Ldflags: "-s -w", Tags: "netgo", Duration: 1.5}},
+		{Kind: artifactDebug, Platform: "linux/amd64", Package: "example.com/app", Path: "linux/app.debug",
+			Size: 1, SHA256: sum},
+	}
+	if loaded.Version != "1.2.3" || !reflect.DeepEqual(loaded.Artifacts, expected) {
+		t.Fatalf("bad: %#v", loaded.Artifacts)
+	}
+	if paths := loaded.Paths(); paths[1] != binary {
+		t.Fatalf("bad: %#v", paths)
+	}
+
+	// Up to date binaries keep their archives, but not their links
+	next := NewArtifactManifest(td)
+	next.Carry(loaded, r)
+	if len(next.Artifacts) != 1 || next.Artifacts[0].Kind != artifactArchive {
+		t.Fatalf("bad: %#v", next.Artifacts)
+	}
+
+	if m, err := LoadArtifactManifest(filepath.Join(td, "missing")); err != nil || len(m.Artifacts) != 0 {
+		t.Fatalf("bad: %#v %v", m, err)
+	}
+}
+
+func TestArtifactManifest_keep(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// A build writes the binary and the -latest-link of each target
+	build := func(previous *ArtifactManifest, archs ...string) *ArtifactManifest {
+		m := NewArtifactManifest(td)
+		m.Keep(previous)
+		for _, arch := range archs {
+			r := BuildResult{
+				Platform: Platform{OS: "linux", Arch: arch},
+				Path:     "example.com/hello",
+				Output:   filepath.Join(td, "hello_1.2.3_linux_"+arch),
+			}
+			if err := ioutil.WriteFile(r.Output, []byte(arch), 0755); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			link := filepath.Join(td, "hello_linux_"+arch)
+			os.Remove(link)
+			if err := os.Symlink(filepath.Base(r.Output), link); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			m.AddResult(r, nil)
+			m.Add(artifactLink, &r, link)
+		}
+		m.Add(artifactChecksums, nil, filepath.Join(td, "SHA256SUMS"))
+		ioutil.WriteFile(filepath.Join(td, "SHA256SUMS"), []byte(strings.Join(archs, "\n")), 0644)
+		if _, err := m.Write(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(m.Artifacts) != 2*len(archs)+1 {
+			t.Fatalf("kept artifacts should only be written: %#v", m.Artifacts)
+		}
+		loaded, err := LoadArtifactManifest(td)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return loaded
+	}
+
+	m := build(NewArtifactManifest(td), "amd64", "arm64")
+	m = build(m, "amd64")
+	m = build(m, "arm64")
+
+	var paths []string
+	for _, a := range m.Artifacts {
+		paths = append(paths, a.Kind+" "+a.Path)
+	}
+	expected := []string{
+		"checksums SHA256SUMS",
+		"binary hello_1.2.3_linux_amd64",
+		"binary hello_1.2.3_linux_arm64",
+		"link hello_linux_amd64",
+		"link hello_linux_arm64",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("bad: %#v", paths)
+	}
+	for _, a := range m.Artifacts {
+		if a.Kind == artifactChecksums && a.Size != int64(len("arm64")) {
+			t.Fatalf("the checksums of the last run should be recorded: %#v", a)
+		}
+	}
+
+	// gox clean removes all of it, the links as well
+	if _, err := CleanPaths(td, append(m.Paths(), filepath.Join(td, manifestName)), false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if infos, _ := ioutil.ReadDir(td); len(infos) != 0 {
+		t.Fatalf("bad: %s", infos[0].Name())
+	}
+}
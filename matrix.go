@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MatrixEntry is a platform in a CI matrix, with what a job needs to build
+// it: its GOOS and GOARCH, its GOARM if any, and the value of -osarch that
+// builds just it.
+type MatrixEntry struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	ARM    string `json:"arm,omitempty"`
+	OSArch string `json:"osarch"`
+}
+
+// NewMatrix returns the matrix entries of platforms, in order.
+func NewMatrix(platforms []Platform) []MatrixEntry {
+	entries := make([]MatrixEntry, 0, len(platforms))
+	for _, p := range platforms {
+		entries = append(entries, MatrixEntry{
+			OS:     p.OS,
+			Arch:   p.Arch,
+			ARM:    p.ARM,
+			OSArch: p.String(),
+		})
+	}
+	return entries
+}
+
+// WriteMatrix writes the matrix of platforms in format: the "include" list
+// of a GitHub Actions matrix on one line, for fromJSON, the parallel
+// matrix of a GitLab CI job, or a JSON list.
+func WriteMatrix(w io.Writer, format string, platforms []Platform) error {
+	entries := NewMatrix(platforms)
+	switch format {
+	case "github":
+		data, err := json.Marshal(map[string][]MatrixEntry{"include": entries})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "gitlab":
+		fmt.Fprintf(w, "parallel:\n  matrix:\n")
+		for _, e := range entries {
+			fmt.Fprintf(w, "    - GOX_OS: %q\n      GOX_ARCH: %q\n", e.OS, e.Arch)
+			if e.ARM != "" {
+				fmt.Fprintf(w, "      GOX_ARM: %q\n", e.ARM)
+			}
+			fmt.Fprintf(w, "      GOX_OSARCH: %q\n", e.OSArch)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	return fmt.Errorf("Invalid -format value %q: must be github, gitlab, or json", format)
+}
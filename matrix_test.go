@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteMatrix(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+	}
+
+	cases := map[string]string{
+		"github": `{"include":[{"os":"linux","arch":"amd64","osarch":"linux/amd64"},` +
+			`{"os":"linux","arch":"arm","arm":"7","osarch":"linux/armv7"}]}` + "\n",
+		"gitlab": "parallel:\n  matrix:\n" +
+			"    - GOX_OS: \"linux\"\n      GOX_ARCH: \"amd64\"\n      GOX_OSARCH: \"linux/amd64\"\n" +
+			"    - GOX_OS: \"linux\"\n      GOX_ARCH: \"arm\"\n      GOX_ARM: \"7\"\n      GOX_OSARCH: \"linux/armv7\"\n",
+	}
+
+	for format, expected := range cases {
+		var b strings.Builder
+		if err := WriteMatrix(&b, format, platforms); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if b.String() != expected {
+			t.Fatalf("%s: bad: %s", format, b.String())
+		}
+	}
+
+	if err := WriteMatrix(&strings.Builder{}, "circle", platforms); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestResolvePlatforms(t *testing.T) {
+	var platformFlag PlatformFlag
+	platformFlag.OSArchFlagValue().Set("linux/amd64 linux/loong64 windows/arm64")
+
+	platforms, err := resolvePlatforms(&platformFlag, "1.16", compilerGc, "", "", "linux/amd64")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// loong64 and windows/arm64 came after Go 1.16
+	if len(platforms) != 1 || platforms[0].String() != "linux/amd64" {
+		t.Fatalf("bad: %#v", platforms)
+	}
+}
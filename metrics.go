@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricsBuckets are the upper bounds, in seconds, of the histograms of
+// job and build durations.
+var metricsBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// metricsHistogram is a Prometheus histogram of durations in seconds.
+type metricsHistogram struct {
+	counts []int
+	sum    float64
+	count  int
+}
+
+func (h *metricsHistogram) Observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]int, len(metricsBuckets))
+	}
+	for i, le := range metricsBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// serveMetrics are the metrics of `gox serve`, written in the Prometheus
+// text format by Write.
+type serveMetrics struct {
+	lock sync.Mutex
+
+	// jobs counts the finished jobs by status.
+	jobs        map[string]int
+	jobDuration metricsHistogram
+
+	// builds counts the builds of the jobs by platform and then status,
+	// "built", "up-to-date" or "failed".
+	builds        map[string]map[string]int
+	buildDuration map[string]*metricsHistogram
+}
+
+func newServeMetrics() *serveMetrics {
+	return &serveMetrics{
+		jobs:          map[string]int{},
+		builds:        map[string]map[string]int{},
+		buildDuration: map[string]*metricsHistogram{},
+	}
+}
+
+// Job records the finished job, which took seconds, and its builds: the
+// targets of its summary and the compile times of the binaries of its
+// manifest.
+func (m *serveMetrics) Job(status string, seconds float64, summary *BuildSummary, manifest *ArtifactManifest) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.jobs[status]++
+	m.jobDuration.Observe(seconds)
+	if summary != nil {
+		for _, t := range summary.Targets {
+			if m.builds[t.Platform] == nil {
+				m.builds[t.Platform] = map[string]int{}
+			}
+			m.builds[t.Platform][t.Status]++
+		}
+	}
+	if manifest != nil {
+		for _, a := range manifest.Artifacts {
+			if a.Kind != artifactBinary || a.Build == nil || a.Build.UpToDate {
+				continue
+			}
+			h := m.buildDuration[a.Platform]
+			if h == nil {
+				h = &metricsHistogram{}
+				m.buildDuration[a.Platform] = h
+			}
+			h.Observe(a.Build.Duration)
+		}
+	}
+}
+
+// Write writes the metrics to w, with the number of jobs that are queued
+// and running now.
+func (m *serveMetrics) Write(w io.Writer, queued, running int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	metricsHeader(w, "gox_jobs_queued", "gauge", "Jobs waiting to run.")
+	fmt.Fprintf(w, "gox_jobs_queued %d\n", queued)
+	metricsHeader(w, "gox_jobs_running", "gauge", "Jobs running now.")
+	fmt.Fprintf(w, "gox_jobs_running %d\n", running)
+
+	metricsHeader(w, "gox_jobs_total", "counter", "Jobs that finished, by status.")
+	for _, status := range []string{"succeeded", "failed"} {
+		fmt.Fprintf(w, "gox_jobs_total{status=%q} %d\n", status, m.jobs[status])
+	}
+	metricsHeader(w, "gox_job_duration_seconds", "histogram", "How long jobs took, from fetching the source to the last artifact.")
+	writeHistogram(w, "gox_job_duration_seconds", "", &m.jobDuration)
+
+	// Up to date builds are the hits of -incremental, so the hit rate is
+	// the rate of status="up-to-date" over all of them
+	metricsHeader(w, "gox_builds_total", "counter", "Builds of the jobs, by platform and status.")
+	platforms := make([]string, 0, len(m.builds))
+	for p := range m.builds {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+	for _, p := range platforms {
+		for _, status := range []string{"built", "up-to-date", "failed"} {
+			fmt.Fprintf(w, "gox_builds_total{platform=%q,status=%q} %d\n", p, status, m.builds[p][status])
+		}
+	}
+	metricsHeader(w, "gox_build_duration_seconds", "histogram", "How long the compiler took for the binaries that were built, by platform.")
+	platforms = platforms[:0]
+	for p := range m.buildDuration {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+	for _, p := range platforms {
+		writeHistogram(w, "gox_build_duration_seconds", fmt.Sprintf("platform=%q,", p), m.buildDuration[p])
+	}
+}
+
+func metricsHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *metricsHistogram) {
+	for i, le := range metricsBuckets {
+		count := 0
+		if h.counts != nil {
+			count = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%g\"} %d\n", name, labels, le, count)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %d\n", name, labels, h.sum, name, labels, h.count)
+}
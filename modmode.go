@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DetectModMode returns the -mod of the builds: modMode if it is set, and
+// otherwise "vendor" when the module in the current directory, or the
+// workspace, has a vendor directory, so that the builds don't download
+// anything. A -mod in goFlags is left to go build.
+func DetectModMode(modMode, goFlags string, workspace *Workspace) string {
+	if modMode != "" {
+		return modMode
+	}
+	for _, f := range strings.Fields(goFlags) {
+		if strings.HasPrefix(f, "-mod=") || strings.HasPrefix(f, "--mod=") {
+			return ""
+		}
+	}
+
+	dir := "."
+	if workspace != nil {
+		dir = filepath.Dir(workspace.File)
+	} else if _, err := os.Stat("go.mod"); err != nil {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err != nil {
+		return ""
+	}
+	return "vendor"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectModMode(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if actual := DetectModMode("", "", nil); actual != "" {
+		t.Fatalf("bad: %s", actual)
+	}
+	ioutil.WriteFile("go.mod", []byte("module ex.com/a\n"), 0644)
+	if actual := DetectModMode("", "", nil); actual != "" {
+		t.Fatalf("bad: %s", actual)
+	}
+	os.Mkdir("vendor", 0755)
+	ioutil.WriteFile(filepath.Join("vendor", "modules.txt"), nil, 0644)
+
+	cases := []struct {
+		ModMode string
+		GoFlags string
+		Result  string
+	}{
+		{"", "", "vendor"},
+		{"", "-trimpath", "vendor"},
+		{"mod", "", "mod"},
+		{"readonly", "", "readonly"},
+		{"", "-mod=mod", ""},
+	}
+	for _, tc := range cases {
+		if actual := DetectModMode(tc.ModMode, tc.GoFlags, nil); actual != tc.Result {
+			t.Fatalf("bad: %#v: %s", tc, actual)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NfpmConfig is the "nfpm" section of the config file. It describes the
+// deb, rpm, and apk packages to build from each linux binary using nfpm
+// (https://nfpm.goreleaser.com), which must be installed.
+type NfpmConfig struct {
+	// Command is the nfpm executable, defaults to "nfpm".
+	Command string `json:"command,omitempty"`
+
+	// Formats are the package formats to build, defaults to deb, rpm,
+	// and apk.
+	Formats []string `json:"formats,omitempty"`
+
+	// Output is the directory packages are written to, defaults to the
+	// directory of each binary.
+	Output string `json:"output,omitempty"`
+
+	// Name is the package name, defaults to the name of the binary.
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version"`
+	Release     string `json:"release,omitempty"`
+	Maintainer  string `json:"maintainer,omitempty"`
+	Description string `json:"description,omitempty"`
+	Vendor      string `json:"vendor,omitempty"`
+	Homepage    string `json:"homepage,omitempty"`
+	License     string `json:"license,omitempty"`
+	Section     string `json:"section,omitempty"`
+
+	Depends    []string `json:"depends,omitempty"`
+	Recommends []string `json:"recommends,omitempty"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+
+	// Bindir is where the binary is installed, defaults to /usr/bin.
+	Bindir string `json:"bindir,omitempty"`
+
+	// Contents are additional files to put in the package and
+	// SystemdUnits are unit files installed to /lib/systemd/system.
+	Contents     []NfpmContent `json:"contents,omitempty"`
+	SystemdUnits []string      `json:"systemd_units,omitempty"`
+
+	Scripts NfpmScripts `json:"scripts,omitempty"`
+}
+
+// NfpmContent is a file to include in the package.
+type NfpmContent struct {
+	Src  string `json:"src"`
+	Dst  string `json:"dst"`
+	Type string `json:"type,omitempty"`
+	Mode int    `json:"mode,omitempty"`
+}
+
+// NfpmScripts are the package lifecycle scripts.
+type NfpmScripts struct {
+	PreInstall  string `json:"preinstall,omitempty"`
+	PostInstall string `json:"postinstall,omitempty"`
+	PreRemove   string `json:"preremove,omitempty"`
+	PostRemove  string `json:"postremove,omitempty"`
+}
+
+// nfpmFileInfo and nfpmFile mirror nfpm's own config format for contents.
+type nfpmFileInfo struct {
+	Mode int `json:"mode,omitempty"`
+}
+
+type nfpmFile struct {
+	Src      string        `json:"src"`
+	Dst      string        `json:"dst"`
+	Type     string        `json:"type,omitempty"`
+	FileInfo *nfpmFileInfo `json:"file_info,omitempty"`
+}
+
+// nfpmSpec is the config file given to nfpm. nfpm reads YAML, and JSON is
+// valid YAML, so we don't need a YAML encoder.
+type nfpmSpec struct {
+	Name        string      `json:"name"`
+	Arch        string      `json:"arch"`
+	Platform    string      `json:"platform"`
+	Version     string      `json:"version"`
+	Release     string      `json:"release,omitempty"`
+	Maintainer  string      `json:"maintainer,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Vendor      string      `json:"vendor,omitempty"`
+	Homepage    string      `json:"homepage,omitempty"`
+	License     string      `json:"license,omitempty"`
+	Section     string      `json:"section,omitempty"`
+	Depends     []string    `json:"depends,omitempty"`
+	Recommends  []string    `json:"recommends,omitempty"`
+	Conflicts   []string    `json:"conflicts,omitempty"`
+	Contents    []nfpmFile  `json:"contents"`
+	Scripts     NfpmScripts `json:"scripts,omitempty"`
+}
+
+// Validate checks that there is a version and the formats are known.
+func (c *NfpmConfig) Validate() error {
+	if c.Version == "" {
+		return fmt.Errorf("nfpm: version is required")
+	}
+	for _, f := range c.formats() {
+		switch f {
+		case "deb", "rpm", "apk":
+		default:
+			return fmt.Errorf("nfpm: unknown format %q", f)
+		}
+	}
+
+	return nil
+}
+
+func (c *NfpmConfig) command() string {
+	if c.Command == "" {
+		return "nfpm"
+	}
+	return c.Command
+}
+
+func (c *NfpmConfig) formats() []string {
+	if len(c.Formats) == 0 {
+		return []string{"deb", "rpm", "apk"}
+	}
+	return c.Formats
+}
+
+// spec returns the nfpm configuration for packaging the given binary.
+func (c *NfpmConfig) spec(binary string, platform Platform) *nfpmSpec {
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(binary)
+	}
+	bindir := c.Bindir
+	if bindir == "" {
+		bindir = "/usr/bin"
+	}
+
+	// nfpm names arm variants by their GOARM version, such as "arm7",
+	// and mips variants by their GOMIPS value, such as "mipsle_softfloat"
+	arch := platform.Arch + platform.ARM
+	if strings.HasPrefix(platform.Arch, "mips") && platform.Level != "" {
+		arch += "_" + platform.Level
+	}
+	spec := &nfpmSpec{
+		Name:        name,
+		Arch:        arch,
+		Platform:    platform.OS,
+		Version:     c.Version,
+		Release:     c.Release,
+		Maintainer:  c.Maintainer,
+		Description: c.Description,
+		Vendor:      c.Vendor,
+		Homepage:    c.Homepage,
+		License:     c.License,
+		Section:     c.Section,
+		Depends:     c.Depends,
+		Recommends:  c.Recommends,
+		Conflicts:   c.Conflicts,
+		Scripts:     c.Scripts,
+	}
+
+	spec.Contents = append(spec.Contents, nfpmFile{
+		Src:      binary,
+		Dst:      bindir + "/" + filepath.Base(binary),
+		FileInfo: &nfpmFileInfo{Mode: 0755},
+	})
+	for _, unit := range c.SystemdUnits {
+		spec.Contents = append(spec.Contents, nfpmFile{
+			Src:  unit,
+			Dst:  "/lib/systemd/system/" + filepath.Base(unit),
+			Type: "config",
+		})
+	}
+	for _, f := range c.Contents {
+		file := nfpmFile{Src: f.Src, Dst: f.Dst, Type: f.Type}
+		if f.Mode != 0 {
+			file.FileInfo = &nfpmFileInfo{Mode: f.Mode}
+		}
+		spec.Contents = append(spec.Contents, file)
+	}
+
+	return spec
+}
+
+// NfpmPackage builds the configured packages for a linux binary and
+// returns the paths to them.
+func NfpmPackage(c *NfpmConfig, binary string, platform Platform) ([]string, error) {
+	spec := c.spec(binary, platform)
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(td)
+	specPath := filepath.Join(td, "nfpm.yaml")
+	if err := ioutil.WriteFile(specPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	outDir := c.Output
+	if outDir == "" {
+		outDir = filepath.Dir(binary)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	cmd := c.command()
+	var result []string
+	for _, format := range c.formats() {
+		target := filepath.Join(outDir, fmt.Sprintf("%s_%s_%s_%s.%s",
+			spec.Name, c.Version, platform.OS, platform.GetArch(), format))
+		if _, err := execGo(cmd, nil, "", "package",
+			"-f", specPath, "-p", format, "-t", target); err != nil {
+			return result, fmt.Errorf("%s: %s",
+				format, strings.TrimSpace(err.Error()))
+		}
+		result = append(result, target)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNfpmConfigValidate(t *testing.T) {
+	if err := (&NfpmConfig{}).Validate(); err == nil {
+		t.Fatal("should err without version")
+	}
+	if err := (&NfpmConfig{Version: "1.0", Formats: []string{"msi"}}).Validate(); err == nil {
+		t.Fatal("should err on unknown format")
+	}
+	if err := (&NfpmConfig{Version: "1.0"}).Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestNfpmConfigSpec(t *testing.T) {
+	c := &NfpmConfig{
+		Version:      "1.0",
+		SystemdUnits: []string{"dist/foo.service"},
+	}
+	spec := c.spec("/out/foo", Platform{OS: "linux", Arch: "arm", ARM: "7"})
+	if spec.Name != "foo" || spec.Arch != "arm7" || spec.Platform != "linux" {
+		t.Fatalf("bad: %#v", spec)
+	}
+
+	expected := []nfpmFile{
+		{Src: "/out/foo", Dst: "/usr/bin/foo", FileInfo: &nfpmFileInfo{Mode: 0755}},
+		{Src: "dist/foo.service", Dst: "/lib/systemd/system/foo.service", Type: "config"},
+	}
+	if !reflect.DeepEqual(spec.Contents, expected) {
+		t.Fatalf("bad: %#v", spec.Contents)
+	}
+
+	spec = c.spec("/out/foo", Platform{OS: "linux", Arch: "mipsle", Level: "softfloat"})
+	if spec.Arch != "mipsle_softfloat" {
+		t.Fatalf("bad: %#v", spec)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// notesName is the name of the release notes in archives.
+const notesName = "RELEASE_NOTES.txt"
+
+// NotesConfig is the "notes" section of the config file. It has where
+// the release notes of the version come from, which are the body of the
+// release that -publish creates and RELEASE_NOTES.txt in every archive.
+type NotesConfig struct {
+	// Source is "changelog", the section of the version in File, the
+	// default, or "git", the subjects of the commits since the previous
+	// tag.
+	Source string `json:"source,omitempty"`
+
+	// File is the changelog, defaults to "CHANGELOG.md".
+	File string `json:"file,omitempty"`
+}
+
+// Validate checks the source.
+func (c *NotesConfig) Validate() error {
+	switch c.Source {
+	case "", "changelog", "git":
+	default:
+		return fmt.Errorf("notes: unknown source %q, must be changelog or git", c.Source)
+	}
+
+	return nil
+}
+
+// Notes returns the release notes of version.
+func (c *NotesConfig) Notes(version string) (string, error) {
+	if c.Source == "git" {
+		return gitChanges(gitPreviousTag(version))
+	}
+
+	file := c.File
+	if file == "" {
+		file = "CHANGELOG.md"
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	notes, ok := changelogSection(string(data), version)
+	if !ok {
+		return "", fmt.Errorf("%s has no section for %s", file, version)
+	}
+	return notes, nil
+}
+
+// changelogSection returns the body of the section of a Markdown
+// changelog whose heading has version, with or without a "v", such as
+// "## [1.2.3] - 2024-05-01" in the format of keepachangelog.com or
+// "## v1.2.3", up to the next heading of the same level.
+func changelogSection(changelog, version string) (string, bool) {
+	var lines []string
+	level := 0
+	for _, line := range strings.Split(changelog, "\n") {
+		if strings.HasPrefix(line, "#") {
+			n := len(line) - len(strings.TrimLeft(line, "#"))
+			if level > 0 && n <= level {
+				break
+			}
+			if level == 0 {
+				if changelogHeading(line[n:], version) {
+					level = n
+				}
+				continue
+			}
+		}
+		if level > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), level > 0
+}
+
+func changelogHeading(heading, version string) bool {
+	fields := strings.FieldsFunc(heading, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '[' || r == ']' || r == '(' || r == ')' || r == ','
+	})
+	for _, f := range fields {
+		if strings.TrimPrefix(f, "v") == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testChangelog = `# Changelog
+
+## [Unreleased]
+
+- Nothing yet
+
+## [1.2.3] - 2024-05-01
+
+### Fixed
+
+- Builds for windows/arm64
+
+## [1.2.2] - 2024-04-01
+
+- First release
+
+## v1.0.0-rc.1
+
+- Preview
+`
+
+func TestChangelogSection(t *testing.T) {
+	cases := []struct {
+		Version string
+		Notes   string
+		OK      bool
+	}{
+		{"1.2.3", "### Fixed\n\n- Builds for windows/arm64", true},
+		{"1.2.2", "- First release", true},
+		{"1.0.0-rc.1", "- Preview", true},
+		{"1.2", "", false},
+	}
+
+	for _, tc := range cases {
+		notes, ok := changelogSection(testChangelog, tc.Version)
+		if ok != tc.OK || tc.Notes != "" && notes != tc.Notes {
+			t.Fatalf("bad: %s: %q %v", tc.Version, notes, ok)
+		}
+	}
+}
+
+func TestNotesConfigNotes(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	file := filepath.Join(td, "CHANGES.md")
+	ioutil.WriteFile(file, []byte(testChangelog), 0644)
+
+	c := &NotesConfig{File: file}
+	notes, err := c.Notes("1.2.2")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if notes != "- First release" {
+		t.Fatalf("bad: %q", notes)
+	}
+
+	if _, err := c.Notes("3.0.0"); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NpmConfig is the "npm" section of the config file. It wraps the c-shared
+// libraries in npm packages the way napi-rs does: one package per platform
+// holding that platform's library, restricted with "os" and "cpu" so npm
+// only installs the right one, and a main package that depends on all of
+// them optionally.
+type NpmConfig struct {
+	// Name and Version are the name of the main package, such as
+	// "@example/core", and the version of every package.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// Dir, if set, is the directory with the contents of the main
+	// package, such as the JavaScript that loads the library. A
+	// package.json in it is used as the base of the generated one.
+	Dir string `json:"dir,omitempty"`
+
+	// Output is the directory the package tarballs are written to.
+	// Defaults to "npm".
+	Output string `json:"output,omitempty"`
+}
+
+// npmOS and npmCPU map GOOS and GOARCH to the values of process.platform
+// and process.arch in Node.js. Node.js only runs on little endian ppc64,
+// which it calls "ppc64".
+var npmOS = map[string]string{
+	"aix":     "aix",
+	"android": "android",
+	"darwin":  "darwin",
+	"freebsd": "freebsd",
+	"linux":   "linux",
+	"netbsd":  "netbsd",
+	"openbsd": "openbsd",
+	"solaris": "sunos",
+	"windows": "win32",
+}
+
+var npmCPU = map[string]string{
+	"386":     "ia32",
+	"amd64":   "x64",
+	"arm":     "arm",
+	"arm64":   "arm64",
+	"loong64": "loong64",
+	"mips":    "mips",
+	"mipsle":  "mipsel",
+	"ppc64le": "ppc64",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// Validate checks that the package has a name and a version.
+func (c *NpmConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("npm: name is required")
+	}
+	if c.Version == "" {
+		return fmt.Errorf("npm: version is required")
+	}
+
+	return nil
+}
+
+func (c *NpmConfig) output() string {
+	if c.Output == "" {
+		return "npm"
+	}
+	return c.Output
+}
+
+// npmPlatform returns the suffix that names the package for platform, such
+// as "linux-x64-gnu", and its "os" and "cpu" values. Linux libraries built
+// with cgo link against glibc, so they are marked as such like napi-rs
+// does to keep them apart from musl builds.
+func npmPlatform(platform Platform) (string, string, string, error) {
+	goos, ok := npmOS[platform.OS]
+	if !ok {
+		return "", "", "", fmt.Errorf("npm has no platform for %s", platform.OS)
+	}
+	cpu, ok := npmCPU[platform.Arch]
+	if !ok {
+		return "", "", "", fmt.Errorf("npm has no cpu for %s", platform.Arch)
+	}
+
+	suffix := goos + "-" + cpu
+	if platform.Arch == "arm" && platform.ARM != "" {
+		suffix += "-v" + platform.ARM
+	}
+	if platform.OS == "linux" {
+		suffix += "-gnu"
+	}
+	return suffix, goos, cpu, nil
+}
+
+// npmTarball is the file name `npm pack` would give the package name at
+// version.
+func npmTarball(name, version string) string {
+	name = strings.Replace(strings.TrimPrefix(name, "@"), "/", "-", -1)
+	return name + "-" + version + ".tgz"
+}
+
+// BuildNpmPackages writes a package for each of the c-shared libraries in
+// results and the main package depending on them, returning the paths to
+// the tarballs. They can be published with `npm publish <tarball>`, the
+// platform packages first.
+func BuildNpmPackages(c *NpmConfig, results []BuildResult) ([]string, error) {
+	var paths []string
+	optional := make(map[string]string)
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+
+		suffix, goos, cpu, err := npmPlatform(r.Platform)
+		if err != nil {
+			return paths, fmt.Errorf("%s: %s", r.Platform.String(), err)
+		}
+		libName := sharedLibName(filepath.Base(r.Path), r.Platform.OS)
+		pkg := map[string]interface{}{
+			"name":    c.Name + "-" + suffix,
+			"version": c.Version,
+			"os":      []string{goos},
+			"cpu":     []string{cpu},
+			"main":    libName,
+			"files":   []string{libName},
+		}
+		if r.Platform.OS == "linux" {
+			pkg["libc"] = []string{"glibc"}
+		}
+
+		path, err := c.writePackage(pkg, []archiveFile{
+			{Name: libName, Src: r.Output, Mode: 0755},
+		})
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+		optional[c.Name+"-"+suffix] = c.Version
+	}
+
+	// The main package is based on the package.json in Dir, if any
+	pkg := make(map[string]interface{})
+	var files []archiveFile
+	if c.Dir != "" {
+		var err error
+		files, err = dirFiles(c.Dir, "")
+		if err != nil {
+			return paths, err
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(c.Dir, "package.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return paths, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &pkg); err != nil {
+				return paths, fmt.Errorf("%s: %s", filepath.Join(c.Dir, "package.json"), err)
+			}
+		}
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if f.Name != "package.json" {
+			kept = append(kept, f)
+		}
+	}
+	pkg["name"] = c.Name
+	pkg["version"] = c.Version
+	pkg["optionalDependencies"] = optional
+
+	path, err := c.writePackage(pkg, kept)
+	if err != nil {
+		return paths, err
+	}
+	return append(paths, path), nil
+}
+
+// writePackage writes an npm tarball with the given package.json and
+// files, all under the "package" directory as npm expects.
+func (c *NpmConfig) writePackage(pkg map[string]interface{}, files []archiveFile) (string, error) {
+	data, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	files = append(files, archiveFile{
+		Name: "package.json",
+		Data: append(data, '\n'),
+		Mode: 0644,
+	})
+
+	path := filepath.Join(c.output(), npmTarball(pkg["name"].(string), c.Version))
+	if err := writeArchive(path, "package", files); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNpmPlatform(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Suffix   string
+		Err      bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "linux-x64-gnu", false},
+		{Platform{OS: "darwin", Arch: "arm64"}, "darwin-arm64", false},
+		{Platform{OS: "windows", Arch: "386"}, "win32-ia32", false},
+		{Platform{OS: "linux", Arch: "arm", ARM: "7"}, "linux-arm-v7-gnu", false},
+		{Platform{OS: "plan9", Arch: "amd64"}, "", true},
+	}
+
+	for _, tc := range cases {
+		suffix, _, _, err := npmPlatform(tc.Platform)
+		if (err != nil) != tc.Err || suffix != tc.Suffix {
+			t.Fatalf("%#v: bad: %s %s", tc.Platform, suffix, err)
+		}
+	}
+}
+
+func TestBuildNpmPackages(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "core.so")
+	if err := ioutil.WriteFile(output, []byte("lib"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	jsDir := filepath.Join(td, "js")
+	os.MkdirAll(jsDir, 0755)
+	ioutil.WriteFile(filepath.Join(jsDir, "index.js"), []byte("module.exports = {}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(jsDir, "package.json"), []byte(`{"main": "index.js", "license": "MIT"}`), 0644)
+
+	c := &NpmConfig{Name: "@example/core", Version: "1.0.0", Dir: jsDir, Output: filepath.Join(td, "npm")}
+	paths, err := BuildNpmPackages(c, []BuildResult{
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, Path: "example.com/core", Output: output},
+		{Platform: Platform{OS: "darwin", Arch: "arm64"}, Path: "example.com/core", Output: output},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var names []string
+	for _, p := range paths {
+		names = append(names, filepath.Base(p))
+	}
+	expected := []string{
+		"example-core-linux-x64-gnu-1.0.0.tgz",
+		"example-core-darwin-arm64-1.0.0.tgz",
+		"example-core-1.0.0.tgz",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	files := readTarGz(t, paths[2])
+	if _, ok := files["package/index.js"]; !ok {
+		t.Fatalf("bad: %#v", files)
+	}
+	var pkg struct {
+		Main                 string
+		License              string
+		OptionalDependencies map[string]string
+	}
+	if err := json.Unmarshal(files["package/package.json"], &pkg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pkg.Main != "index.js" || pkg.License != "MIT" || pkg.OptionalDependencies["@example/core-darwin-arm64"] != "1.0.0" {
+		t.Fatalf("bad: %#v", pkg)
+	}
+
+	files = readTarGz(t, paths[0])
+	if _, ok := files["package/libcore.so"]; !ok {
+		t.Fatalf("bad: %#v", files)
+	}
+}
+
+func readTarGz(t *testing.T, path string) map[string][]byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(tr)
+		result[hdr.Name] = data
+	}
+	return result
+}
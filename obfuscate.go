@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// garbleMapExt is the extension of the file next to an obfuscated binary
+// that has what `garble reverse` needs to read its stack traces.
+const garbleMapExt = ".garble.json"
+
+// GarbleMap is what an obfuscated binary was built with. Given the same
+// sources, `garble <flags> -seed=<seed> reverse <package>` turns the
+// obfuscated names of its panics and stack traces back into the real ones.
+type GarbleMap struct {
+	Package  string   `json:"package"`
+	Platform string   `json:"platform"`
+	Seed     string   `json:"seed"`
+	Flags    []string `json:"flags,omitempty"`
+	Reverse  string   `json:"reverse"`
+}
+
+// FindGarble returns the garble command to obfuscate with: garble on the
+// PATH, or else the garble tool of the module, from a "tool" line in
+// go.mod.
+func FindGarble(GoCmd string) (string, error) {
+	if path, err := exec.LookPath("garble"); err == nil {
+		return path, nil
+	}
+
+	output, err := execGo(GoCmd, nil, "", "tool", "-n", "garble")
+	if path := strings.TrimSpace(output); err == nil && path != "" {
+		return path, nil
+	}
+
+	return "", fmt.Errorf("garble must be on the PATH, or a tool of the module, to use -obfuscate")
+}
+
+// garbleSeed returns the seed for platform. With a base seed every
+// platform gets its own seed made from it, so builds can be repeated;
+// without one the seed is random.
+func garbleSeed(base string, platform Platform) (string, error) {
+	var seed []byte
+	if base != "" {
+		sum := sha256.Sum256([]byte(base + "\n" + platform.String()))
+		seed = sum[:16]
+	} else {
+		seed = make([]byte, 16)
+		if _, err := rand.Read(seed); err != nil {
+			return "", err
+		}
+	}
+
+	return base64.RawStdEncoding.EncodeToString(seed), nil
+}
+
+// garbleArgs are the arguments of garble before those of go build.
+func (opts *CompileOpts) garbleArgs() []string {
+	return append(strings.Fields(opts.GarbleFlags), "-seed="+opts.GarbleSeed)
+}
+
+// WriteGarbleMap writes the GarbleMap of the obfuscated binary at output
+// next to it, and returns its path.
+func WriteGarbleMap(opts *CompileOpts, output string) (string, error) {
+	_, pkg := splitPackagePath(opts.PackagePath)
+	if pkg == "" {
+		pkg = "."
+	}
+	args := opts.garbleArgs()
+	m := &GarbleMap{
+		Package:  pkg,
+		Platform: opts.Platform.String(),
+		Seed:     opts.GarbleSeed,
+		Flags:    strings.Fields(opts.GarbleFlags),
+		Reverse: fmt.Sprintf("GOOS=%s GOARCH=%s garble %s reverse %s",
+			opts.Platform.OS, opts.Platform.Arch, strings.Join(args, " "), pkg),
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := output + garbleMapExt
+	return path, ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGarbleSeed(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	windows := Platform{OS: "windows", Arch: "amd64"}
+
+	a, err := garbleSeed("base", linux)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b, _ := garbleSeed("base", linux); b != a {
+		t.Fatalf("bad: %s != %s", b, a)
+	}
+	if b, _ := garbleSeed("base", windows); b == a {
+		t.Fatal("platforms should have their own seeds")
+	}
+	if b, _ := garbleSeed("", linux); b == a || b == "" {
+		t.Fatalf("bad: %s", b)
+	}
+}
+
+func TestGoCrossCompile_garble(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as garble")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// The fake garble records its arguments
+	garble := filepath.Join(td, "garble")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(td, "args") + "\n"
+	if err := ioutil.WriteFile(garble, []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := &CompileOpts{
+		PackagePath: "example.com/app",
+		Platform:    Platform{OS: "linux", Arch: "arm64"},
+		OutputTpl:   filepath.Join(td, "app"),
+		GoCmd:       "go",
+		Garble:      garble,
+		GarbleFlags: "-literals -tiny",
+		GarbleSeed:  "c2VlZA",
+	}
+	if err := GoCrossCompile(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(td, "args"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(string(args), "-literals -tiny -seed=c2VlZA build ") {
+		t.Fatalf("bad: %s", args)
+	}
+
+	path, err := WriteGarbleMap(opts, filepath.Join(td, "app"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var m GarbleMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := GarbleMap{
+		Package:  "example.com/app",
+		Platform: "linux/arm64",
+		Seed:     "c2VlZA",
+		Flags:    []string{"-literals", "-tiny"},
+		Reverse:  "GOOS=linux GOARCH=arm64 garble -literals -tiny -seed=c2VlZA reverse example.com/app",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("bad: %#v", m)
+	}
+}
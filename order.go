@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	orderAlphabetical = "alphabetical"
+	orderFastestFirst = "fastest-first"
+)
+
+// BuildOrder is the -order that the builds are started in: a preset, or
+// the platforms to start first, in that order.
+type BuildOrder struct {
+	Preset    string
+	Platforms []string
+}
+
+// ParseBuildOrder parses a value of -order: "alphabetical",
+// "fastest-first", or a comma or space-separated list of platforms, where
+// an os/arch such as "linux/arm" stands for all of its variants.
+func ParseBuildOrder(value string) (*BuildOrder, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "", orderAlphabetical, orderFastestFirst:
+		return &BuildOrder{Preset: value}, nil
+	}
+
+	o := &BuildOrder{}
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		parts := strings.Split(name, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid -order %q: %q isn't a platform; must be %s, %s, "+
+				"or a list of platforms such as linux/amd64,darwin/arm64", value, name, orderAlphabetical, orderFastestFirst)
+		}
+		o.Platforms = append(o.Platforms, name)
+	}
+	return o, nil
+}
+
+// rank returns where platform goes in the order of a list: the index of
+// the first entry that names it, or the length of the list, after them.
+func (o *BuildOrder) rank(p Platform) int {
+	for i, name := range o.Platforms {
+		if name == p.String() || name == p.OS+"/"+p.Arch {
+			return i
+		}
+	}
+	return len(o.Platforms)
+}
+
+// Sort sorts the builds into the order, keeping the order that they were
+// selected in otherwise. fastest-first is by the times of timings, which
+// come from -shard-timings.
+func (o *BuildOrder) Sort(builds []*CompileOpts, timings *ShardTimings) {
+	if less := o.less(timings); less != nil {
+		sort.SliceStable(builds, func(i, j int) bool {
+			return less(builds[i].Platform, builds[j].Platform)
+		})
+	}
+}
+
+// SortPlatforms sorts the platforms into the order, as Sort does their
+// builds, for -print-targets.
+func (o *BuildOrder) SortPlatforms(platforms []Platform, timings *ShardTimings) {
+	if less := o.less(timings); less != nil {
+		sort.SliceStable(platforms, func(i, j int) bool {
+			return less(platforms[i], platforms[j])
+		})
+	}
+}
+
+// less returns how the order compares platforms, or nil if it keeps them
+// in the order that they were selected in.
+func (o *BuildOrder) less(timings *ShardTimings) func(a, b Platform) bool {
+	switch o.Preset {
+	case orderAlphabetical:
+		return func(a, b Platform) bool { return a.String() < b.String() }
+	case orderFastestFirst:
+		return func(a, b Platform) bool { return timings.weight(a) < timings.weight(b) }
+	}
+	if len(o.Platforms) == 0 {
+		return nil
+	}
+	return func(a, b Platform) bool { return o.rank(a) < o.rank(b) }
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildOrder(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected *BuildOrder
+		Err      bool
+	}{
+		{"", &BuildOrder{}, false},
+		{"alphabetical", &BuildOrder{Preset: orderAlphabetical}, false},
+		{"fastest-first", &BuildOrder{Preset: orderFastestFirst}, false},
+		{"linux/amd64, darwin/arm64", &BuildOrder{Platforms: []string{"linux/amd64", "darwin/arm64"}}, false},
+		{"linux", nil, true},
+		{"linux/amd64,/arm64", nil, true},
+	}
+	for _, tc := range cases {
+		actual, err := ParseBuildOrder(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%q: bad: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestBuildOrderSort(t *testing.T) {
+	platforms := []Platform{
+		{OS: "windows", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "6"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+	}
+	timings := &ShardTimings{Platforms: map[string]float64{
+		"windows/amd64": 30,
+		"linux/armv6":   10,
+		"linux/amd64":   5,
+		"linux/armv7":   40,
+	}}
+	cases := []struct {
+		Order    string
+		Expected []string
+	}{
+		{"", []string{"windows/amd64", "linux/armv6", "darwin/arm64", "linux/amd64", "linux/armv7"}},
+		{"alphabetical", []string{"darwin/arm64", "linux/amd64", "linux/armv6", "linux/armv7", "windows/amd64"}},
+		{"fastest-first", []string{"linux/amd64", "linux/armv6", "darwin/arm64", "windows/amd64", "linux/armv7"}},
+		{"linux/amd64,darwin/arm64", []string{"linux/amd64", "darwin/arm64", "windows/amd64", "linux/armv6", "linux/armv7"}},
+		{"linux/arm linux/armv7", []string{"linux/armv6", "linux/armv7", "windows/amd64", "darwin/arm64", "linux/amd64"}},
+	}
+	for _, tc := range cases {
+		order, err := ParseBuildOrder(tc.Order)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		builds := make([]*CompileOpts, len(platforms))
+		for i, p := range platforms {
+			builds[i] = &CompileOpts{Platform: p}
+		}
+		order.Sort(builds, timings)
+
+		var actual []string
+		for _, opts := range builds {
+			actual = append(actual, opts.Platform.String())
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%q: bad: %#v", tc.Order, actual)
+		}
+
+		// -print-targets lists them in the same order
+		sorted := append([]Platform(nil), platforms...)
+		order.SortPlatforms(sorted, timings)
+		actual = nil
+		for _, p := range sorted {
+			actual = append(actual, p.String())
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%q: bad: %#v", tc.Order, actual)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otelTraceparentRe matches a W3C traceparent, such as the TRACEPARENT
+// that a CI system or `gox serve` sets for the spans of a run to join its
+// trace.
+var otelTraceparentRe = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// otelTracer records the spans of a run of gox, a root span with a span
+// for every build under it, and exports them with OTLP over HTTP in JSON
+// to the collector of the standard OTEL_EXPORTER_OTLP_* variables. A nil
+// tracer records nothing, so a run without -otel doesn't have to check.
+type otelTracer struct {
+	Endpoint string
+	Headers  map[string]string
+	Service  string
+
+	root  *otelSpan
+	lock  sync.Mutex
+	spans []*otelSpan
+}
+
+// otelSpan is a span, with its attributes in OTLP's JSON form.
+type otelSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otelAttribute `json:"attributes,omitempty"`
+	Status       otelStatus      `json:"status"`
+}
+
+type otelAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// The span status codes of OTLP.
+const (
+	otelStatusOK    = 1
+	otelStatusError = 2
+)
+
+// newOtelTracer returns a tracer whose root span, name, started at start.
+// The root span is a child of the span of TRACEPARENT, if it is set.
+func newOtelTracer(name string, start time.Time) *otelTracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	headers := map[string]string{}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "gox"
+	}
+
+	root := &otelSpan{TraceID: otelID(16), SpanID: otelID(8), Name: name, Kind: 1}
+	if m := otelTraceparentRe.FindStringSubmatch(os.Getenv("TRACEPARENT")); m != nil {
+		root.TraceID, root.ParentSpanID = m[1], m[2]
+	}
+	root.Start = otelTime(start)
+	return &otelTracer{
+		Endpoint: endpoint,
+		Headers:  headers,
+		Service:  service,
+		root:     root,
+	}
+}
+
+func otelID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func otelTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// Traceparent returns the W3C traceparent of the root span, for the runs
+// that it starts to join the trace.
+func (t *otelTracer) Traceparent() string {
+	if t == nil {
+		return ""
+	}
+	return "00-" + t.root.TraceID + "-" + t.root.SpanID + "-01"
+}
+
+// Attribute sets an attribute of the root span.
+func (t *otelTracer) Attribute(key string, value interface{}) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.root.Attributes = append(t.root.Attributes, otelAttr(key, value))
+}
+
+// Span records a span under the root span from start until now, which
+// failed with err if it isn't nil. The attributes are strings, bools,
+// ints or float64s.
+func (t *otelTracer) Span(name string, start time.Time, err error, attrs map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	span := &otelSpan{
+		TraceID:      t.root.TraceID,
+		SpanID:       otelID(8),
+		ParentSpanID: t.root.SpanID,
+		Name:         name,
+		Kind:         1,
+		Start:        otelTime(start),
+		End:          otelTime(time.Now()),
+		Status:       otelStatus{Code: otelStatusOK},
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		span.Attributes = append(span.Attributes, otelAttr(key, attrs[key]))
+	}
+	if err != nil {
+		span.Status = otelStatus{Code: otelStatusError, Message: strings.SplitN(err.Error(), "\n", 2)[0]}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.spans = append(t.spans, span)
+}
+
+// Build records the span of the build of r, which started at start.
+func (t *otelTracer) Build(r *BuildResult, start time.Time) {
+	if t == nil {
+		return
+	}
+	attrs := map[string]interface{}{
+		"gox.platform":   r.Platform.String(),
+		"gox.package":    r.Path,
+		"gox.up_to_date": r.UpToDate,
+		"gox.duration":   r.Duration.Seconds(),
+	}
+	if r.Variant != "" {
+		attrs["gox.variant"] = r.Variant
+	}
+	if r.Output != "" {
+		attrs["gox.output"] = r.Output
+	}
+	t.Span("build "+r.Platform.String(), start, r.Err, attrs)
+}
+
+// Export ends the root span, failed with err if it isn't nil, and sends
+// the spans to the collector.
+func (t *otelTracer) Export(err error) error {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.root.End = otelTime(time.Now())
+	t.root.Status = otelStatus{Code: otelStatusOK}
+	if err != nil {
+		t.root.Status = otelStatus{Code: otelStatusError, Message: err.Error()}
+	}
+
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otelAttribute{otelAttr("service.name", t.Service)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "gox"},
+				"spans": append([]*otelSpan{t.root}, t.spans...),
+			}},
+		}},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", t.Endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func otelAttr(key string, value interface{}) otelAttribute {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	return otelAttribute{Key: key, Value: v}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOtelTracerExport(t *testing.T) {
+	var body struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otelSpan
+			}
+		}
+	}
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		data, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/v1/traces" || json.Unmarshal(data, &body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	for k, v := range map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT":        server.URL,
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "",
+		"OTEL_EXPORTER_OTLP_HEADERS":         "X-Token=secret",
+		"TRACEPARENT":                        "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	tracer := newOtelTracer("gox", time.Now())
+	tracer.Attribute("gox.builds", 2)
+	tracer.Build(&BuildResult{Platform: Platform{OS: "linux", Arch: "amd64"}, Path: "."}, time.Now())
+	tracer.Build(&BuildResult{Platform: Platform{OS: "windows", Arch: "arm64"}, Path: ".", Err: errors.New("boom\nmore")}, time.Now())
+	if err := tracer.Export(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if header != "secret" {
+		t.Fatalf("bad: %q", header)
+	}
+
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("bad: %#v", spans)
+	}
+	root := spans[0]
+	if root.TraceID != "0af7651916cd43dd8448eb211c80319c" || root.ParentSpanID != "b7ad6b7169203331" || root.Status.Code != otelStatusOK {
+		t.Fatalf("bad: %#v", root)
+	}
+	for _, span := range spans[1:] {
+		if span.TraceID != root.TraceID || span.ParentSpanID != root.SpanID {
+			t.Fatalf("bad: %#v", span)
+		}
+	}
+	if spans[2].Name != "build windows/arm64" || spans[2].Status.Code != otelStatusError || spans[2].Status.Message != "boom" {
+		t.Fatalf("bad: %#v", spans[2])
+	}
+
+	// A nil tracer is a run without -otel
+	var none *otelTracer
+	none.Build(&BuildResult{}, time.Now())
+	if err := none.Export(nil); err != nil || none.Traceparent() != "" {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// outputFuncs are the functions of the output templates, so that names
+// such as "myapp_v1.2.3_linux_armv7" can be made without renaming the
+// binaries afterwards:
+//
+//	lower, upper          change the case of a string
+//	replace OLD NEW S     replace every OLD in S with NEW
+//	trimprefix P S        S without the prefix P, trimsuffix likewise
+//	date LAYOUT           the build time, SOURCE_DATE_EPOCH if it is set,
+//	                      in a time.Format layout such as "20060102"
+//	major, minor, patch   a part of a version such as {{.Version}}
+var outputFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimprefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimsuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace": func(old, new, s string) string {
+		return strings.Replace(s, old, new, -1)
+	},
+	"date": func(layout string) string {
+		return artifactTime().UTC().Format(layout)
+	},
+	"major": func(v string) (int, error) { return versionSegment(v, 0) },
+	"minor": func(v string) (int, error) { return versionSegment(v, 1) },
+	"patch": func(v string) (int, error) { return versionSegment(v, 2) },
+}
+
+// parseOutputTemplate parses an output template with outputFuncs.
+func parseOutputTemplate(tpl string) (*template.Template, error) {
+	return template.New("output").Funcs(outputFuncs).Parse(tpl)
+}
+
+// versionSegment is the ith number of the version v, where 1.2 has a
+// patch of 0.
+func versionSegment(v string, i int) (int, error) {
+	parsed, err := version.NewVersion(strings.TrimPrefix(v, "v"))
+	if err != nil {
+		return 0, err
+	}
+	return parsed.Segments()[i], nil
+}
+
+// outputTemplateDir is the directory that the -output template writes to,
+// the fixed part of it before the first template action.
+func outputTemplateDir(tpl string) string {
+	if i := strings.Index(tpl, "{{"); i >= 0 {
+		tpl = tpl[:i]
+		if !strings.HasSuffix(tpl, "/") {
+			tpl = filepath.Dir(tpl)
+		}
+	}
+	if tpl == "" {
+		return "."
+	}
+	return filepath.Clean(tpl)
+}
+
+// The -output-layout of the binaries: flat names them after their
+// platforms, and dir puts each platform in a directory of its own.
+const (
+	outputLayoutFlat = "flat"
+	outputLayoutDir  = "dir"
+)
+
+// outputLayoutTemplate returns the output template tpl laid out with
+// layout. With outputLayoutDir the name of the binary moves into a
+// directory for its platform, without the _{{.OS}}_{{.Arch}} suffix, so
+// that "dist/{{.Dir}}_{{.OS}}_{{.Arch}}" becomes
+// "dist/{{.OS}}_{{.Arch}}/{{.Dir}}". A template that already has a
+// directory per platform is kept as it is.
+func outputLayoutTemplate(tpl, layout string) string {
+	i := strings.Index(tpl, "{{")
+	if layout != outputLayoutDir || i < 0 {
+		return tpl
+	}
+	dir := tpl[:strings.LastIndex(tpl[:i], "/")+1]
+	name := tpl[len(dir):]
+	if strings.Contains(name, "/") {
+		return tpl
+	}
+	return dir + "{{.OS}}_{{.Arch}}/" + strings.Replace(name, "_{{.OS}}_{{.Arch}}", "", 1)
+}
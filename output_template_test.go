@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputPath_template(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	cases := []struct {
+		Tpl      string
+		Platform Platform
+		Expected string
+	}{
+		{
+			"/out/{{.Dir}}_v{{.Version}}_{{.OS}}_{{.Arch}}",
+			Platform{OS: "linux", Arch: "arm", ARM: "7"},
+			"/out/myapp_v1.2.3_linux_armv7",
+		},
+		{
+			"/out/{{.Dir | upper}}_{{.OS | replace \"darwin\" \"macos\"}}_{{.ARMVersion}}",
+			Platform{OS: "darwin", Arch: "arm64"},
+			"/out/MYAPP_macos_",
+		},
+		{
+			"/out/{{major .Version}}.{{minor .Version}}/{{.Dir}}-{{.Commit}}{{.Ext}}",
+			Platform{OS: "windows", Arch: "amd64"},
+			"/out/1.2/myapp-deadbee.exe",
+		},
+		{
+			"/out/{{date \"20060102\"}}/{{.Dir | trimprefix \"my\"}}",
+			Platform{OS: "windows", Arch: "amd64"},
+			"/out/20231114/app.exe",
+		},
+	}
+	for _, tc := range cases {
+		opts := &CompileOpts{
+			PackagePath: "example.com/myapp",
+			Platform:    tc.Platform,
+			OutputTpl:   tc.Tpl,
+			Version:     "1.2.3",
+			Commit:      "deadbee",
+		}
+		path, err := opts.OutputPath()
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Tpl, err)
+		}
+		if path != filepath.FromSlash(tc.Expected) {
+			t.Fatalf("%s: bad: %s", tc.Tpl, path)
+		}
+	}
+
+	opts := &CompileOpts{OutputTpl: "{{major .Version}}", Version: "unknown"}
+	if _, err := opts.OutputPath(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestOutputTemplateDir(t *testing.T) {
+	cases := map[string]string{
+		"{{.Dir}}_{{.OS}}_{{.Arch}}":      ".",
+		"dist/{{.OS}}_{{.Arch}}/{{.Dir}}": "dist",
+		"dist/{{.OS}}/":                   "dist",
+		"build/bin":                       "build/bin",
+	}
+	for tpl, expected := range cases {
+		if dir := outputTemplateDir(tpl); dir != expected {
+			t.Fatalf("%s: bad: %s", tpl, dir)
+		}
+	}
+}
+
+func TestOutputLayoutTemplate(t *testing.T) {
+	cases := map[string]string{
+		"{{.Dir}}_{{.OS}}_{{.Arch}}":                   "{{.OS}}_{{.Arch}}/{{.Dir}}",
+		"{{.Dir}}_{{.OS}}_{{.Arch}}.test":              "{{.OS}}_{{.Arch}}/{{.Dir}}.test",
+		"dist/{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}": "dist/{{.OS}}_{{.Arch}}/{{.Dir}}_{{.Version}}",
+		"dist/{{.Dir}}-{{.OS}}":                        "dist/{{.OS}}_{{.Arch}}/{{.Dir}}-{{.OS}}",
+		"dist/{{.OS}}_{{.Arch}}/{{.Dir}}":              "dist/{{.OS}}_{{.Arch}}/{{.Dir}}",
+		"build/bin":                                    "build/bin",
+	}
+	for tpl, expected := range cases {
+		if actual := outputLayoutTemplate(tpl, outputLayoutDir); actual != expected {
+			t.Fatalf("%s: bad: %s", tpl, actual)
+		}
+		if actual := outputLayoutTemplate(tpl, outputLayoutFlat); actual != tpl {
+			t.Fatalf("%s: bad: %s", tpl, actual)
+		}
+	}
+
+	opts := &CompileOpts{
+		PackagePath:  "example.com/myapp",
+		Platform:     Platform{OS: "windows", Arch: "amd64"},
+		OutputTpl:    "/out/{{.Dir}}_{{.OS}}_{{.Arch}}",
+		OutputLayout: outputLayoutDir,
+	}
+	path, err := opts.OutputPath()
+	if err != nil || path != filepath.FromSlash("/out/windows_amd64/myapp.exe") {
+		t.Fatalf("bad: %s %v", path, err)
+	}
+}
+
+func TestCompileOptsExpandLdflags(t *testing.T) {
+	cases := []struct {
+		Ldflags  string
+		Expected string
+		Err      bool
+	}{
+		{"-s -w", "-s -w", false},
+		{"-X main.version={{.Version}} -X main.commit={{.Commit}}", "-X main.version=1.2.3 -X main.commit=deadbee", false},
+		{"-X main.target={{.OS}}/{{.Arch}}", "-X main.target=linux/armv7", false},
+		{"-X main.version={{.Version", "", true},
+	}
+	for _, tc := range cases {
+		opts := &CompileOpts{
+			PackagePath: "example.com/myapp",
+			Platform:    Platform{OS: "linux", Arch: "arm", ARM: "7"},
+			Ldflags:     tc.Ldflags,
+			Version:     "1.2.3",
+			Commit:      "deadbee",
+		}
+		err := opts.expandLdflags()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Ldflags, err)
+		}
+		if err == nil && opts.Ldflags != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Ldflags, opts.Ldflags)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageConfig is an entry of the "packages" section of the config file,
+// which overrides the build of the main packages its key matches. A key is
+// an import path, or the trailing elements of one such as "cmd/server" or
+// "server", so that building ./cmd/... can give each binary its own flags.
+type PackageConfig struct {
+	// Tags, Ldflags and Gcflags replace the values of the flags for the
+	// package when set. The GOX_[OS]_[ARCH] overrides still apply on top.
+	Tags    string `json:"tags,omitempty"`
+	Ldflags string `json:"ldflags,omitempty"`
+	Gcflags string `json:"gcflags,omitempty"`
+
+	// Output replaces the -output template for the package.
+	Output string `json:"output,omitempty"`
+
+	// OSArch, if set, limits the package to these of the platforms being
+	// built, such as ["linux/amd64", "windows/amd64"].
+	OSArch []string `json:"osarch,omitempty"`
+
+	// Annotations are added to those of the config file for the
+	// package's artifacts.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Validate checks the entry for the package key: its output template,
+// platforms and annotations.
+func (c *PackageConfig) Validate(key string) error {
+	if strings.Trim(key, "/") == "" {
+		return fmt.Errorf("packages: empty package name")
+	}
+	if c.Output != "" {
+		if _, err := parseOutputTemplate(c.Output); err != nil {
+			return fmt.Errorf("packages: %s: output: %s", key, err)
+		}
+	}
+	for _, v := range c.OSArch {
+		if len(strings.Split(v, "/")) != 2 {
+			return fmt.Errorf("packages: %s: osarch %s should be os/arch", key, v)
+		}
+	}
+
+	return validateAnnotations("packages: "+key, c.Annotations)
+}
+
+// builds reports whether the package is built for platform.
+func (c *PackageConfig) builds(platform Platform) bool {
+	if c == nil || len(c.OSArch) == 0 {
+		return true
+	}
+	for _, v := range c.OSArch {
+		if strings.ToLower(v) == platform.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply sets the overrides of the package config on opts.
+func (c *PackageConfig) apply(opts *CompileOpts) {
+	if c == nil {
+		return
+	}
+	if c.Tags != "" {
+		opts.Tags = c.Tags
+	}
+	if c.Ldflags != "" {
+		opts.Ldflags = c.Ldflags
+	}
+	if c.Gcflags != "" {
+		opts.Gcflags = c.Gcflags
+	}
+	if c.Output != "" {
+		opts.OutputTpl = c.Output
+	}
+}
+
+// packageConfig returns the entry of the "packages" section for the main
+// package with the import path, or nil if there is none. The longest
+// matching key wins, so an exact match always does.
+func packageConfig(packages map[string]*PackageConfig, path string) *PackageConfig {
+	var result *PackageConfig
+	var matched int
+	for key, c := range packages {
+		key = strings.Trim(key, "/")
+		if (path == key || strings.HasSuffix(path, "/"+key)) && len(key) > matched {
+			result, matched = c, len(key)
+		}
+	}
+
+	return result
+}
+
+// checkOutputs returns an error if any two builds would write the same
+// file, such as two packages named "server" in different directories
+// with an output template that only tells them apart by {{.Dir}}, or
+// a template without {{.Arch}} that builds more than one arch. The builds
+// run in parallel, so which of them would be left is down to chance.
+func checkOutputs(builds []*CompileOpts) error {
+	var paths []string
+	byPath := make(map[string][]*CompileOpts)
+	for _, opts := range builds {
+		path, err := opts.OutputPath()
+		if err != nil {
+			// Reported by the build itself
+			continue
+		}
+
+		if _, ok := byPath[path]; !ok {
+			paths = append(paths, path)
+		}
+		byPath[path] = append(byPath[path], opts)
+	}
+
+	var conflicts []string
+	missing := make(map[string]bool)
+	for _, path := range paths {
+		same := byPath[path]
+		if len(same) < 2 {
+			continue
+		}
+
+		names := make([]string, len(same))
+		for i, opts := range same {
+			names[i] = buildName(opts)
+			for field, differs := range outputDifferences(same[0], opts) {
+				missing[field] = missing[field] || differs
+			}
+		}
+		verb := "both"
+		if len(names) > 2 {
+			verb = "all"
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s and %s %s write %s",
+			strings.Join(names[:len(names)-1], ", "), names[len(names)-1], verb, path))
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	sort.Strings(conflicts)
+
+	var fixes []string
+	for _, field := range []string{"Dir", "OS", "Arch"} {
+		if missing[field] {
+			fixes = append(fixes, "{{."+field+"}}")
+		}
+	}
+	var fix []string
+	if len(fixes) > 0 {
+		fix = append(fix, fmt.Sprintf("add %s to the output template", strings.Join(fixes, " and ")))
+	}
+	if missing["Package"] || len(fix) == 0 && !missing["FIPS"] {
+		fix = append(fix, "set a distinct output for the packages in the \"packages\" section of the config file")
+	}
+	if missing["FIPS"] {
+		fix = append(fix, "set -fips-output to a template other than that of -output")
+	}
+
+	return fmt.Errorf("Builds would overwrite each other, %s:\n\n  %s",
+		strings.Join(fix, ", and "), strings.Join(conflicts, "\n  "))
+}
+
+// buildName is how a build is named in errors: its package and platform,
+// and the variant it is.
+func buildName(opts *CompileOpts) string {
+	name := fmt.Sprintf("%s (%s)", opts.PackagePath, opts.Platform.String())
+	if opts.FIPS != "" {
+		name = fmt.Sprintf("%s (%s, %s)", opts.PackagePath, opts.Platform.String(), fipsVariant)
+	}
+	return name
+}
+
+// outputDifferences reports which of the fields of the output template
+// tell a and b apart, Package if they are packages of the same name, and
+// FIPS if one is the FIPS variant of the other. The ARM version and level
+// are a part of {{.Arch}}.
+func outputDifferences(a, b *CompileOpts) map[string]bool {
+	dirA, dirB := filepath.Base(a.PackagePath), filepath.Base(b.PackagePath)
+	return map[string]bool{
+		"Dir":     dirA != dirB,
+		"Package": dirA == dirB && a.PackagePath != b.PackagePath,
+		"OS":      a.Platform.OS != b.Platform.OS,
+		"Arch":    a.Platform.GetArch() != b.Platform.GetArch(),
+		"FIPS":    a.FIPS != b.FIPS,
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackageConfigValidate(t *testing.T) {
+	cases := []struct {
+		Key    string
+		Config PackageConfig
+		Err    bool
+	}{
+		{"cmd/server", PackageConfig{Tags: "netgo"}, false},
+		{"/", PackageConfig{}, true},
+		{"server", PackageConfig{Output: "{{.Dir"}, true},
+		{"server", PackageConfig{OSArch: []string{"linux"}}, true},
+		{"server", PackageConfig{OSArch: []string{"linux/amd64"}}, false},
+	}
+
+	for _, tc := range cases {
+		err := tc.Config.Validate(tc.Key)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: %#v: err: %s", tc.Key, tc.Config, err)
+		}
+	}
+}
+
+func TestPackageConfigLookup(t *testing.T) {
+	server := &PackageConfig{Tags: "server"}
+	cmdServer := &PackageConfig{Tags: "cmd/server"}
+	exact := &PackageConfig{Tags: "exact"}
+	packages := map[string]*PackageConfig{
+		"server":                      server,
+		"cmd/server":                  cmdServer,
+		"example.com/app/cmd/server/": exact,
+	}
+
+	cases := []struct {
+		Path   string
+		Output *PackageConfig
+	}{
+		{"example.com/app/cmd/server", exact},
+		{"example.com/other/cmd/server", cmdServer},
+		{"example.com/app/tools/server", server},
+		{"example.com/app/tools/myserver", nil},
+		{"example.com/app/server/cli", nil},
+	}
+
+	for _, tc := range cases {
+		if actual := packageConfig(packages, tc.Path); actual != tc.Output {
+			t.Fatalf("%s: bad: %#v", tc.Path, actual)
+		}
+	}
+}
+
+func TestPackageConfigApply(t *testing.T) {
+	opts := &CompileOpts{Tags: "a", Ldflags: "-X main.v=1", OutputTpl: "{{.Dir}}"}
+	c := &PackageConfig{Tags: "b", Output: "bin/{{.Dir}}"}
+	c.apply(opts)
+	if opts.Tags != "b" || opts.Ldflags != "-X main.v=1" || opts.OutputTpl != "bin/{{.Dir}}" {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	var none *PackageConfig
+	none.apply(opts)
+	if !none.builds(Platform{OS: "linux", Arch: "amd64"}) {
+		t.Fatal("should build")
+	}
+
+	c = &PackageConfig{OSArch: []string{"linux/amd64", "linux/armv7"}}
+	for _, tc := range []struct {
+		Platform Platform
+		Builds   bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, true},
+		{Platform{OS: "linux", Arch: "arm", ARM: "7"}, true},
+		{Platform{OS: "linux", Arch: "arm", ARM: "6"}, false},
+	} {
+		if c.builds(tc.Platform) != tc.Builds {
+			t.Fatalf("%s: bad", tc.Platform.String())
+		}
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	builds := []*CompileOpts{
+		{PackagePath: "example.com/app/cmd/server", Platform: linux, OutputTpl: "/out/{{.Dir}}"},
+		{PackagePath: "example.com/app/cmd/client", Platform: linux, OutputTpl: "/out/{{.Dir}}"},
+	}
+	if err := checkOutputs(builds); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	builds = append(builds, &CompileOpts{
+		PackagePath: "example.com/app/tools/server", Platform: linux, OutputTpl: "/out/{{.Dir}}",
+	})
+	err := checkOutputs(builds)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "example.com/app/cmd/server (linux/amd64) and example.com/app/tools/server (linux/amd64)") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCheckOutputs_template(t *testing.T) {
+	var builds []*CompileOpts
+	for _, p := range []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm64"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "darwin", Arch: "arm64"},
+	} {
+		builds = append(builds, &CompileOpts{
+			PackagePath: "example.com/app", Platform: p, OutputTpl: "/out/{{.OS}}/{{.Dir}}",
+		})
+	}
+
+	err := checkOutputs(builds)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	expected := "Builds would overwrite each other, add {{.Arch}} to the output template:\n\n" +
+		"  example.com/app (linux/amd64), example.com/app (linux/arm64) and " +
+		"example.com/app (linux/armv7) all write /out/linux/app"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+
+	variant := *builds[3]
+	variant.FIPS = fipsBoring
+	err = checkOutputs([]*CompileOpts{builds[3], &variant})
+	if err == nil || !strings.Contains(err.Error(), "set -fips-output") ||
+		!strings.Contains(err.Error(), "example.com/app (darwin/arm64, fips)") {
+		t.Fatalf("bad: %v", err)
+	}
+}
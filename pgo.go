@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// pgoProfile checks a value of -pgo, which is "auto", "off" or the path
+// to a CPU profile. Paths are made absolute, since go build runs in the
+// directory of each package.
+func pgoProfile(v string) (string, error) {
+	switch v {
+	case "", "auto", "off":
+		return v, nil
+	}
+
+	info, err := os.Stat(v)
+	if err != nil {
+		return "", fmt.Errorf("-pgo profile: %s", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("-pgo profile %s is a directory", v)
+	}
+	return filepath.Abs(v)
+}
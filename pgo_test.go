@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPgoProfile(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	profile := filepath.Join(td, "cpu.pprof")
+	if err := ioutil.WriteFile(profile, []byte("profile"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Input    string
+		Expected string
+		Err      bool
+	}{
+		{"", "", false},
+		{"auto", "auto", false},
+		{"off", "off", false},
+		{profile, profile, false},
+		{filepath.Join(td, "missing.pprof"), "", true},
+		{td, "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := pgoProfile(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Input, actual)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// pipelineArtifact is an artifact that the package pipeline made for a
+// binary, to be added to the manifest once there is one.
+type pipelineArtifact struct {
+	Kind string
+	Path string
+}
+
+// PackagePipeline signs and archives each binary as soon as its build
+// finishes, at most limit at a time, while the other builds go on. The
+// stages of a release after the builds skip the binaries that it did.
+// Binaries that failed or were up to date aren't packaged, like in the
+// stages.
+type PackagePipeline struct {
+	// Package packages one binary and returns the artifacts it made.
+	Package func(r BuildResult) ([]pipelineArtifact, error)
+
+	semaphore chan int
+	wg        sync.WaitGroup
+	lock      sync.Mutex
+	done      map[string][]pipelineArtifact
+	failed    int
+}
+
+// NewPackagePipeline returns a pipeline that runs fn on at most limit
+// binaries at once.
+func NewPackagePipeline(limit int, fn func(r BuildResult) ([]pipelineArtifact, error)) *PackagePipeline {
+	return &PackagePipeline{
+		Package:   fn,
+		semaphore: make(chan int, stageLimit(limit, 1)),
+		done:      make(map[string][]pipelineArtifact),
+	}
+}
+
+// Add starts packaging the binary of r, if it was built.
+func (p *PackagePipeline) Add(r BuildResult) {
+	if r.Err != nil || r.UpToDate {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.semaphore <- 1
+		defer func() { <-p.semaphore }()
+
+		artifacts, err := p.Package(r)
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if err != nil {
+			ui.Errorf("--> %s package error: %s\n", ui.Failure(r.Platform.String()), err)
+			p.failed++
+			return
+		}
+		p.done[r.Output] = artifacts
+		ui.Infof("--> %15s: packaged %s\n", r.Platform.String(), r.Output)
+	}()
+}
+
+// Wait waits for the binaries that were added to be packaged, and returns
+// the number that failed.
+func (p *PackagePipeline) Wait() int {
+	if p == nil {
+		return 0
+	}
+	p.wg.Wait()
+	return p.failed
+}
+
+// Artifacts returns the artifacts that were made for the binary of r.
+func (p *PackagePipeline) Artifacts(r BuildResult) []pipelineArtifact {
+	if p == nil {
+		return nil
+	}
+	return p.done[r.Output]
+}
+
+// Rest returns the results whose binaries weren't packaged, such as the
+// universal binaries that are made after the builds, for the stages to
+// do. It is all of them without a pipeline.
+func (p *PackagePipeline) Rest(results []BuildResult) []BuildResult {
+	if p == nil {
+		return results
+	}
+	rest := make([]BuildResult, 0, len(results))
+	for _, r := range results {
+		if _, ok := p.done[r.Output]; !ok {
+			rest = append(rest, r)
+		}
+	}
+	return rest
+}
+
+// sha256Cache holds the SHA-256 of the files that the pipeline made, so
+// that the checksums and the manifest don't read them again. An entry is
+// only used while the file has the same size and modification time.
+var sha256Cache = struct {
+	sync.Mutex
+	m map[string]sha256Entry
+}{m: make(map[string]sha256Entry)}
+
+type sha256Entry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// warmSHA256 computes the SHA-256 of the file at path ahead of time.
+func warmSHA256(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	sha256Cache.Lock()
+	defer sha256Cache.Unlock()
+	sha256Cache.m[path] = sha256Entry{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	return nil
+}
+
+// cachedSHA256 returns the SHA-256 that warmSHA256 computed for path, if
+// the file hasn't changed since.
+func cachedSHA256(path string) (string, bool) {
+	sha256Cache.Lock()
+	e, ok := sha256Cache.m[path]
+	sha256Cache.Unlock()
+	if !ok {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != e.size || !info.ModTime().Equal(e.modTime) {
+		return "", false
+	}
+	return e.sum, true
+}
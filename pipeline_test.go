@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackagePipeline(t *testing.T) {
+	built := BuildResult{Platform: Platform{OS: "linux", Arch: "amd64"}, Output: "a_linux_amd64"}
+	failed := BuildResult{Platform: Platform{OS: "linux", Arch: "arm64"}, Output: "a_linux_arm64"}
+	upToDate := BuildResult{Platform: Platform{OS: "darwin", Arch: "arm64"}, Output: "a_darwin_arm64", UpToDate: true}
+	broken := BuildResult{Platform: Platform{OS: "windows", Arch: "amd64"}, Output: "a_windows_amd64.exe",
+		Err: errors.New("build failed")}
+
+	p := NewPackagePipeline(2, func(r BuildResult) ([]pipelineArtifact, error) {
+		if r.Output == failed.Output {
+			return nil, errors.New("archive failed")
+		}
+		return []pipelineArtifact{{Kind: artifactArchive, Path: r.Output + ".tar.gz"}}, nil
+	})
+	for _, r := range []BuildResult{built, failed, upToDate, broken} {
+		p.Add(r)
+	}
+	if n := p.Wait(); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	expected := []pipelineArtifact{{Kind: artifactArchive, Path: "a_linux_amd64.tar.gz"}}
+	if v := p.Artifacts(built); !reflect.DeepEqual(v, expected) {
+		t.Fatalf("bad: %#v", v)
+	}
+	rest := p.Rest([]BuildResult{built, failed, upToDate})
+	if len(rest) != 2 || rest[0].Output != failed.Output || rest[1].Output != upToDate.Output {
+		t.Fatalf("bad: %#v", rest)
+	}
+
+	var nilPipeline *PackagePipeline
+	if nilPipeline.Wait() != 0 || nilPipeline.Artifacts(built) != nil || len(nilPipeline.Rest(rest)) != 2 {
+		t.Fatal("a nil pipeline should do nothing")
+	}
+}
+
+func TestWarmSHA256(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "a.tar.gz")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := warmSHA256(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum, ok := cachedSHA256(path)
+	if !ok || sum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("bad: %s %v", sum, ok)
+	}
+
+	// A file that changed is read again
+	if err := ioutil.WriteFile(path, []byte("hello, world"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := cachedSHA256(path); ok {
+		t.Fatal("should not be cached")
+	}
+	if sum, err := fileSHA256(path); err != nil || sum == "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("bad: %s %v", sum, err)
+	}
+}
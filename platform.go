@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	version "github.com/hashicorp/go-version"
 )
@@ -20,15 +22,126 @@ type Platform struct {
 	// something to Android AND something like Linux.
 	Default bool
 	ARM     string
+
+	// Level is the micro-architecture level to build for, such as "v3"
+	// for amd64 or "softfloat" for mips. It is written after the arch, as
+	// in "linux/amd64v3" or "linux/mipsle-softfloat", and sets the arch's
+	// variable from archLevels. For arm it is the float ABI, which goes
+	// into GOARM after the version, as in "linux/armv7-softfloat".
+	Level string
+
+	// Tier is the tier of the port under the Go porting policy: 1 for the
+	// first-class ports that the Go team keeps working, and 2 for the
+	// secondary ports that are kept working by their maintainers. It is 0
+	// for platforms that aren't Go ports, such as TinyGo targets.
+	Tier int
+
+	// Cgo is whether the port supports cgo, from cgoPorts.
+	Cgo bool
+}
+
+// firstClassPorts are the first-class ports of the Go porting policy, at
+// https://go.dev/wiki/PortingPolicy. Every other port is secondary.
+var firstClassPorts = map[string]bool{
+	"darwin/amd64":  true,
+	"darwin/arm64":  true,
+	"linux/386":     true,
+	"linux/amd64":   true,
+	"linux/arm":     true,
+	"linux/arm64":   true,
+	"windows/386":   true,
+	"windows/amd64": true,
+}
+
+// portTier returns the tier of the Go port of goos and goarch.
+func portTier(goos, goarch string) int {
+	if firstClassPorts[goos+"/"+goarch] {
+		return 1
+	}
+	return 2
+}
+
+// setPortInfo sets the Tier and Cgo of each of platforms.
+func setPortInfo(platforms []Platform) {
+	for i := range platforms {
+		if !isTinygoTarget(platforms[i]) {
+			platforms[i].Tier = portTier(platforms[i].OS, platforms[i].Arch)
+			platforms[i].Cgo = portCgo(platforms[i].OS, platforms[i].Arch)
+		}
+	}
+}
+
+// filterTier returns the platforms that are ports of tier or better.
+// Platforms that were given as flags don't have their tier set yet.
+func filterTier(platforms []Platform, tier int) []Platform {
+	var result []Platform
+	for _, p := range platforms {
+		t := p.Tier
+		if t == 0 {
+			t = portTier(p.OS, p.Arch)
+		}
+		if t <= tier {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// archLevel is the variable that sets the micro-architecture level of an
+// arch, and the levels it can be set to. The first level is the default.
+// Sep goes between the arch and the level, as in "mipsle-softfloat".
+type archLevel struct {
+	Env    string
+	Levels []string
+	Sep    string
+}
+
+var archLevels = map[string]archLevel{
+	"386":   {"GO386", []string{"sse2", "softfloat"}, ""},
+	"amd64": {"GOAMD64", []string{"v1", "v2", "v3", "v4"}, ""},
+	"arm":   {"GOARM", []string{"hardfloat", "softfloat"}, "-"},
+	"arm64": {"GOARM64", []string{
+		"v8.0", "v8.1", "v8.2", "v8.3", "v8.4", "v8.5", "v8.6", "v8.7", "v8.8", "v8.9",
+		"v9.0", "v9.1", "v9.2", "v9.3", "v9.4", "v9.5",
+	}, ""},
+	"mips":     {"GOMIPS", []string{"hardfloat", "softfloat"}, "-"},
+	"mipsle":   {"GOMIPS", []string{"hardfloat", "softfloat"}, "-"},
+	"mips64":   {"GOMIPS64", []string{"hardfloat", "softfloat"}, "-"},
+	"mips64le": {"GOMIPS64", []string{"hardfloat", "softfloat"}, "-"},
+	"ppc64":    {"GOPPC64", []string{"power8", "power9", "power10"}, ""},
+	"ppc64le":  {"GOPPC64", []string{"power8", "power9", "power10"}, ""},
+	"riscv64":  {"GORISCV64", []string{"rva20u64", "rva22u64", "rva23u64"}, ""},
 }
 
+// PlatformFromString returns the platform of os and arch, where arch may
+// have a GOARM version, as in "armv7", or a micro-architecture level, as
+// in "amd64v3". An arm arch can also be a range of GOARM versions: "arm"
+// for all of them and "armv6+" for 6 and above, which the platform flags
+// expand into each version. Its float ABI is written as in GOARM, as in
+// "armv7,softfloat", or like the other levels, as in "armv7-softfloat".
 func PlatformFromString(os, arch string) Platform {
 	if strings.HasPrefix(arch, "armv") && len(arch) >= 5 {
-		return Platform{
+		p := Platform{
 			OS:   os,
 			Arch: "arm",
 			ARM:  arch[4:],
 		}
+		if i := strings.IndexAny(p.ARM, ",-"); i >= 0 {
+			for _, level := range archLevels["arm"].Levels {
+				if p.ARM[i+1:] == level {
+					p.ARM, p.Level = p.ARM[:i], level
+					break
+				}
+			}
+		}
+		return p
+	}
+	if base, level, ok := splitArchLevel(arch); ok {
+		return Platform{
+			OS:    os,
+			Arch:  base,
+			Level: level,
+		}
 	}
 	return Platform{
 		OS:   os,
@@ -36,12 +149,92 @@ func PlatformFromString(os, arch string) Platform {
 	}
 }
 
+// isARMRange returns whether the GOARM version arm of a platform stands
+// for more than one version: "" for all of them, or "6+" for 6 and above.
+func isARMRange(arm string) bool {
+	return arm == "" || strings.HasSuffix(arm, "+")
+}
+
+// armInRange returns whether the GOARM version arm is in the range of
+// spec, which is "", a version such as "6+" and above, or a version.
+func armInRange(spec, arm string) bool {
+	switch {
+	case spec == "":
+		return true
+	case strings.HasSuffix(spec, "+"):
+		min, err := strconv.Atoi(strings.TrimSuffix(spec, "+"))
+		v, err2 := strconv.Atoi(arm)
+		return err == nil && err2 == nil && v >= min
+	default:
+		return spec == arm
+	}
+}
+
+// splitArchLevel splits an arch such as "amd64v3" into the arch and its
+// micro-architecture level, if it ends with a known level.
+func splitArchLevel(arch string) (string, string, bool) {
+	for base, l := range archLevels {
+		if !strings.HasPrefix(arch, base) {
+			continue
+		}
+		for _, level := range l.Levels {
+			if arch == base+l.Sep+level {
+				return base, level, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
 func (p *Platform) String() string {
 	return fmt.Sprintf("%s/%s", p.OS, p.GetArch())
 }
 
 func (p *Platform) GetArch() string {
-	return fmt.Sprintf("%s%s", p.Arch, p.GetARMVersion())
+	var level string
+	if p.Level != "" {
+		level = archLevels[p.Arch].Sep + p.Level
+	}
+	return fmt.Sprintf("%s%s%s", p.Arch, p.GetARMVersion(), level)
+}
+
+// LevelEnv returns the variable that sets the micro-architecture level of
+// the platform, such as "GOAMD64=v3", or "" if it has no level.
+func (p *Platform) LevelEnv() string {
+	l, ok := archLevels[p.Arch]
+	if !ok || p.Level == "" || p.Arch == "arm" {
+		// The float ABI of arm is part of GOARM, see ARMEnv
+		return ""
+	}
+	return l.Env + "=" + p.Level
+}
+
+// ARMEnv returns the GOARM of the platform, such as "GOARM=7" or, with a
+// float ABI, "GOARM=7,softfloat", or "" if it has no GOARM version.
+func (p *Platform) ARMEnv() string {
+	switch {
+	case p.ARM == "":
+		return ""
+	case p.Arch == "arm" && p.Level != "":
+		return "GOARM=" + p.ARM + "," + p.Level
+	default:
+		return "GOARM=" + p.ARM
+	}
+}
+
+// canonicalPlatform returns p without a float ABI that is the one its
+// GOARM version uses anyway, softfloat for GOARM=5 and hardfloat for the
+// others, so that "linux/armv7-hardfloat" is the same build as
+// "linux/armv7".
+func canonicalPlatform(p Platform) Platform {
+	if p.Arch != "arm" || p.ARM == "" {
+		return p
+	}
+	if p.ARM == "5" && p.Level == "softfloat" || p.ARM != "5" && p.Level == "hardfloat" {
+		p.Level = ""
+	}
+	return p
 }
 
 func (p *Platform) GetARMVersion() string {
@@ -51,36 +244,6 @@ func (p *Platform) GetARMVersion() string {
 	return ""
 }
 
-// addDrop appends all of the "add" entries and drops the "drop" entries, ignoring
-// the "Default" parameter.
-func addDrop(base []Platform, add []Platform, drop []Platform) []Platform {
-	newPlatforms := make([]Platform, len(base)+len(add))
-	copy(newPlatforms, base)
-	copy(newPlatforms[len(base):], add)
-
-	// slow, but we only do this during initialization at most once per version
-	for _, platform := range drop {
-		found := -1
-		for i := range newPlatforms {
-			if newPlatforms[i].Arch == platform.Arch && newPlatforms[i].OS == platform.OS {
-				found = i
-				break
-			}
-		}
-		if found < 0 {
-			panic(fmt.Sprintf("Expected to remove %+v but not found in list %+v", platform, newPlatforms))
-		}
-		if found == len(newPlatforms)-1 {
-			newPlatforms = newPlatforms[:found]
-		} else if found == 0 {
-			newPlatforms = newPlatforms[found:]
-		} else {
-			newPlatforms = append(newPlatforms[:found], newPlatforms[found+1:]...)
-		}
-	}
-	return newPlatforms
-}
-
 var (
 	Platforms_1_0 = []Platform{
 		{OS: "darwin", Arch: "386", Default: true},
@@ -98,7 +261,7 @@ var (
 		{OS: "windows", Arch: "amd64", Default: true},
 	}
 
-	Platforms_1_1 = addDrop(Platforms_1_0, []Platform{
+	Platforms_1_1 = platformTable(Platforms_1_0, []Platform{
 		{OS: "freebsd", Arch: "arm", Default: true, ARM: "5"},
 		{OS: "freebsd", Arch: "arm", Default: true, ARM: "6"},
 		{OS: "freebsd", Arch: "arm", Default: true, ARM: "7"},
@@ -110,7 +273,7 @@ var (
 		{OS: "plan9", Arch: "386", Default: false},
 	}, nil)
 
-	Platforms_1_3 = addDrop(Platforms_1_1, []Platform{
+	Platforms_1_3 = platformTable(Platforms_1_1, []Platform{
 		{OS: "dragonfly", Arch: "386", Default: false},
 		{OS: "dragonfly", Arch: "amd64", Default: false},
 		{OS: "nacl", Arch: "amd64", Default: false},
@@ -121,14 +284,14 @@ var (
 		{OS: "solaris", Arch: "amd64", Default: false},
 	}, nil)
 
-	Platforms_1_4 = addDrop(Platforms_1_3, []Platform{
+	Platforms_1_4 = platformTable(Platforms_1_3, []Platform{
 		{OS: "android", Arch: "arm", Default: false, ARM: "5"},
 		{OS: "android", Arch: "arm", Default: false, ARM: "6"},
 		{OS: "android", Arch: "arm", Default: false, ARM: "7"},
 		{OS: "plan9", Arch: "amd64", Default: false},
 	}, nil)
 
-	Platforms_1_5 = addDrop(Platforms_1_4, []Platform{
+	Platforms_1_5 = platformTable(Platforms_1_4, []Platform{
 		{OS: "darwin", Arch: "arm", Default: false, ARM: "5"},
 		{OS: "darwin", Arch: "arm", Default: false, ARM: "6"},
 		{OS: "darwin", Arch: "arm", Default: false, ARM: "7"},
@@ -136,9 +299,11 @@ var (
 		{OS: "linux", Arch: "arm64", Default: false},
 		{OS: "linux", Arch: "ppc64", Default: false},
 		{OS: "linux", Arch: "ppc64le", Default: false},
-	}, nil)
+	}, []Platform{
+		{OS: "dragonfly", Arch: "386", Default: false},
+	})
 
-	Platforms_1_6 = addDrop(Platforms_1_5, []Platform{
+	Platforms_1_6 = platformTable(Platforms_1_5, []Platform{
 		{OS: "android", Arch: "386", Default: false},
 		{OS: "android", Arch: "amd64", Default: false},
 		{OS: "linux", Arch: "mips64", Default: false},
@@ -149,7 +314,7 @@ var (
 		{OS: "openbsd", Arch: "arm", Default: true, ARM: "7"},
 	}, nil)
 
-	Platforms_1_7 = addDrop(Platforms_1_5, []Platform{
+	Platforms_1_7 = platformTable(Platforms_1_5, []Platform{
 		// While not fully supported s390x is generally useful
 		{OS: "linux", Arch: "s390x", Default: true},
 		{OS: "plan9", Arch: "arm", Default: false, ARM: "5"},
@@ -166,7 +331,7 @@ var (
 		{OS: "openbsd", Arch: "arm", Default: true, ARM: "7"},
 	}, nil)
 
-	Platforms_1_8 = addDrop(Platforms_1_7, []Platform{
+	Platforms_1_8 = platformTable(Platforms_1_7, []Platform{
 		{OS: "linux", Arch: "mips", Default: true},
 		{OS: "linux", Arch: "mipsle", Default: true},
 	}, nil)
@@ -175,26 +340,26 @@ var (
 	Platforms_1_9 = Platforms_1_8
 
 	// unannounced, but dropped support for android/amd64
-	Platforms_1_10 = addDrop(Platforms_1_9, nil, []Platform{{OS: "android", Arch: "amd64", Default: false}})
+	Platforms_1_10 = platformTable(Platforms_1_9, nil, []Platform{{OS: "android", Arch: "amd64", Default: false}})
 
-	Platforms_1_11 = addDrop(Platforms_1_10, []Platform{
+	Platforms_1_11 = platformTable(Platforms_1_10, []Platform{
 		{OS: "js", Arch: "wasm", Default: true},
 	}, nil)
 
-	Platforms_1_12 = addDrop(Platforms_1_11, []Platform{
+	Platforms_1_12 = platformTable(Platforms_1_11, []Platform{
 		{OS: "aix", Arch: "ppc64", Default: false},
 		{OS: "windows", Arch: "arm", Default: true, ARM: "5"},
 		{OS: "windows", Arch: "arm", Default: true, ARM: "6"},
 		{OS: "windows", Arch: "arm", Default: true, ARM: "7"},
 	}, nil)
 
-	Platforms_1_13 = addDrop(Platforms_1_12, []Platform{
+	Platforms_1_13 = platformTable(Platforms_1_12, []Platform{
 		{OS: "illumos", Arch: "amd64", Default: false},
 		{OS: "netbsd", Arch: "arm64", Default: true},
 		{OS: "openbsd", Arch: "arm64", Default: true},
 	}, nil)
 
-	Platforms_1_14 = addDrop(Platforms_1_13, []Platform{
+	Platforms_1_14 = platformTable(Platforms_1_13, []Platform{
 		{OS: "freebsd", Arch: "arm64", Default: true},
 		{OS: "linux", Arch: "arm64", Default: true},
 		{OS: "linux", Arch: "riscv64", Default: true},
@@ -202,34 +367,163 @@ var (
 		// drop nacl
 		{OS: "nacl", Arch: "386", Default: false},
 		{OS: "nacl", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "amd64p32", Default: false},
 		{OS: "nacl", Arch: "arm", Default: false, ARM: "5"},
 		{OS: "nacl", Arch: "arm", Default: false, ARM: "6"},
 		{OS: "nacl", Arch: "arm", Default: false, ARM: "7"},
 	})
 
-	Platforms_1_15 = addDrop(Platforms_1_14, []Platform{
+	Platforms_1_15 = platformTable(Platforms_1_14, []Platform{
 		{OS: "android", Arch: "arm64", Default: false},
 	}, []Platform{
-		// drop i386 macos
+		// drop i386 and 32-bit arm macos
 		{OS: "darwin", Arch: "386", Default: false},
+		{OS: "darwin", Arch: "arm", Default: false, ARM: "5"},
+		{OS: "darwin", Arch: "arm", Default: false, ARM: "6"},
+		{OS: "darwin", Arch: "arm", Default: false, ARM: "7"},
 	})
 
-	Platforms_1_16 = addDrop(Platforms_1_15, []Platform{
+	Platforms_1_16 = platformTable(Platforms_1_15, []Platform{
 		{OS: "android", Arch: "amd64", Default: false},
 		{OS: "darwin", Arch: "arm64", Default: true},
 		{OS: "openbsd", Arch: "mips64", Default: false},
 	}, nil)
 
-	Platforms_1_17 = addDrop(Platforms_1_16, []Platform{
+	Platforms_1_17 = platformTable(Platforms_1_16, []Platform{
 		{OS: "windows", Arch: "arm64", Default: true},
 	}, nil)
 
 	// no new platforms in 1.18
 	Platforms_1_18 = Platforms_1_17
 
-	PlatformsLatest = Platforms_1_18
+	Platforms_1_19 = platformTable(Platforms_1_18, []Platform{
+		{OS: "linux", Arch: "loong64", Default: false},
+	}, nil)
+
+	Platforms_1_20 = platformTable(Platforms_1_19, []Platform{
+		{OS: "freebsd", Arch: "riscv64", Default: false},
+	}, nil)
+
+	// wasip1/wasm is added by its experiment
+	Platforms_1_21 = Platforms_1_20
+
+	// openbsd/ppc64 was in 1.21 already, but marked broken
+	Platforms_1_22 = platformTable(Platforms_1_21, []Platform{
+		{OS: "openbsd", Arch: "ppc64", Default: false},
+	}, nil)
+
+	Platforms_1_23 = platformTable(Platforms_1_22, []Platform{
+		{OS: "openbsd", Arch: "riscv64", Default: false},
+	}, nil)
+
+	Platforms_1_24 = platformTable(Platforms_1_23, nil, []Platform{
+		// windows/arm is marked broken, and dropped in 1.26
+		{OS: "windows", Arch: "arm", Default: true, ARM: "5"},
+		{OS: "windows", Arch: "arm", Default: true, ARM: "6"},
+		{OS: "windows", Arch: "arm", Default: true, ARM: "7"},
+	})
+
+	// no new platforms in 1.25
+	Platforms_1_25 = Platforms_1_24
+
+	Platforms_1_26 = platformTable(Platforms_1_25, nil, []Platform{
+		{OS: "openbsd", Arch: "mips64", Default: false},
+		// marked broken
+		{OS: "freebsd", Arch: "riscv64", Default: false},
+	})
+
+	PlatformsLatest = Platforms_1_26
 )
 
+// platformsLatestMinor is the Go 1.x release of PlatformsLatest.
+const platformsLatestMinor = 26
+
+// newerPlatformsCache holds the platforms of the Go versions that are newer
+// than PlatformsLatest, so that each is only looked up and warned about
+// once.
+var newerPlatformsCache = struct {
+	sync.Mutex
+	m map[string][]Platform
+}{m: make(map[string][]Platform)}
+
+// newerPlatforms returns the platforms of v, a Go version newer than
+// PlatformsLatest: those of PlatformsLatest, and the ports that `go tool
+// dist list` has beyond them when the go on the PATH is v. Ports of the
+// experiments are left to them.
+func newerPlatforms(v string) []Platform {
+	newerPlatformsCache.Lock()
+	defer newerPlatformsCache.Unlock()
+	if platforms, ok := newerPlatformsCache.m[v]; ok {
+		return platforms
+	}
+
+	platforms := PlatformsLatest
+	tc, err := LoadGoToolchain("go")
+	var dist map[string]distPlatform
+	if err == nil && tc.Env["GOVERSION"] == v {
+		dist, err = DistPlatforms("go")
+	}
+	if dist == nil {
+		ui.Warnf("gox only knows the platforms of Go 1.%d and older, so any new ones of %s are missing\n",
+			platformsLatestMinor, v)
+		newerPlatformsCache.m[v] = platforms
+		return platforms
+	}
+
+	added := unknownPlatforms(dist)
+	if len(added) == 0 {
+		// Most releases add no ports, which isn't worth a warning
+		ui.Debugf("gox only knows the platforms of Go 1.%d and older, and %s has no new ones",
+			platformsLatestMinor, v)
+	} else {
+		setPortInfo(added)
+		ui.Warnf("gox only knows the platforms of Go 1.%d and older, so these of %s come from go tool dist list: %s\n",
+			platformsLatestMinor, v, platformNames(added))
+		if merged, err := PlatformSet(PlatformsLatest).Merge(added...); err == nil {
+			platforms = merged
+		}
+	}
+	newerPlatformsCache.m[v] = platforms
+	return platforms
+}
+
+// unknownPlatforms returns the ports of dist, the platforms of `go tool
+// dist list`, that aren't in PlatformsLatest or an experiment, sorted.
+func unknownPlatforms(dist map[string]distPlatform) []Platform {
+	known := make(map[string]bool)
+	for _, p := range PlatformsLatest {
+		known[p.OS+"/"+p.Arch] = true
+	}
+	var added []Platform
+	for name, p := range dist {
+		platform := Platform{OS: p.GOOS, Arch: p.GOARCH}
+		if known[name] || platformExperiment(platform) != nil {
+			continue
+		}
+		if platform.Arch == "arm" {
+			platform.ARM = "7"
+		}
+		added = append(added, platform)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].String() < added[j].String() })
+	return added
+}
+
+// The tiers and cgo support of the ports are set once rather than in
+// every table.
+func init() {
+	for _, platforms := range [][]Platform{
+		Platforms_1_0, Platforms_1_1, Platforms_1_3, Platforms_1_4, Platforms_1_5,
+		Platforms_1_6, Platforms_1_7, Platforms_1_8, Platforms_1_10, Platforms_1_11,
+		Platforms_1_12, Platforms_1_13, Platforms_1_14, Platforms_1_15, Platforms_1_16,
+		Platforms_1_17, Platforms_1_19, Platforms_1_20, Platforms_1_22, Platforms_1_23,
+		Platforms_1_24, Platforms_1_26,
+		gccgoPlatforms, tinygoPlatforms,
+	} {
+		setPortInfo(platforms)
+	}
+}
+
 // SupportedPlatforms returns the full list of supported platforms for
 // the version of Go that is
 func SupportedPlatforms(v string) []Platform {
@@ -242,7 +536,7 @@ func SupportedPlatforms(v string) []Platform {
 
 	current, err := version.NewVersion(v)
 	if err != nil {
-		log.Printf("Unable to parse current go version: %s\n%s", v, err.Error())
+		ui.Warnf("Unable to parse current go version: %s\n%s\n", v, err.Error())
 
 		// Default to latest
 		return PlatformsLatest
@@ -270,6 +564,14 @@ func SupportedPlatforms(v string) []Platform {
 		{">= 1.16, < 1.17", Platforms_1_16},
 		{">= 1.17, < 1.18", Platforms_1_17},
 		{">= 1.18, < 1.19", Platforms_1_18},
+		{">= 1.19, < 1.20", Platforms_1_19},
+		{">= 1.20, < 1.21", Platforms_1_20},
+		{">= 1.21, < 1.22", Platforms_1_21},
+		{">= 1.22, < 1.23", Platforms_1_22},
+		{">= 1.23, < 1.24", Platforms_1_23},
+		{">= 1.24, < 1.25", Platforms_1_24},
+		{">= 1.25, < 1.26", Platforms_1_25},
+		{">= 1.26, < 1.27", Platforms_1_26},
 	}
 
 	for _, p := range platforms {
@@ -282,6 +584,10 @@ func SupportedPlatforms(v string) []Platform {
 		}
 	}
 
+	if segments := current.Segments(); segments[0] == 1 && segments[1] > platformsLatestMinor || segments[0] > 1 {
+		return newerPlatforms("go" + v)
+	}
+
 	// Assume latest
 	return PlatformsLatest
 }
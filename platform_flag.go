@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"strings"
 )
 
@@ -29,6 +30,8 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	includeOS := make(map[string]struct{})
 	ignoreOSArch := make(map[string]Platform)
 	includeOSArch := make(map[string]Platform)
+	var includeOSArchKeys []string
+	osarch := expandARM(p.OSArch, supported, p.ARMArch)
 	for _, v := range p.Arch {
 		if v[0] == '!' {
 			ignoreArch[v[1:]] = struct{}{}
@@ -43,15 +46,23 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 			includeOS[v] = struct{}{}
 		}
 	}
-	for _, v := range p.OSArch {
+	for _, v := range osarch {
+		// The same platform can be written in more than one way, such as
+		// "linux/armv7,softfloat" and "linux/armv7-softfloat"
+		v = canonicalPlatform(PlatformFromString(v.OS, v.GetArch()))
 		if v.OS[0] == '!' {
 			v = Platform{
-				OS:   v.OS[1:],
-				Arch: v.Arch,
+				OS:    v.OS[1:],
+				Arch:  v.Arch,
+				ARM:   v.ARM,
+				Level: v.Level,
 			}
 
 			ignoreOSArch[v.String()] = v
 		} else {
+			if _, ok := includeOSArch[v.String()]; !ok {
+				includeOSArchKeys = append(includeOSArchKeys, v.String())
+			}
 			includeOSArch[v.String()] = v
 		}
 	}
@@ -61,8 +72,8 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	var prefilter []Platform = nil
 	if len(includeOSArch) > 0 {
 		prefilter = make([]Platform, 0, len(p.Arch)*len(p.OS)+len(includeOSArch))
-		for _, v := range includeOSArch {
-			prefilter = append(prefilter, v)
+		for _, k := range includeOSArchKeys {
+			prefilter = append(prefilter, includeOSArch[k])
 		}
 	}
 
@@ -81,7 +92,8 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 				if _, ok := includeArch[arch]; !ok {
 					continue
 				}
-				prefilter = append(prefilter, PlatformFromString(os, arch))
+				prefilter = append(prefilter,
+					expandARM([]Platform{PlatformFromString(os, arch)}, supported, p.ARMArch)...)
 			}
 		}
 	} else if len(includeOS) > 0 {
@@ -103,10 +115,16 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 		// Remove any that aren't supported
 		result := make([]Platform, 0, len(prefilter))
 		for _, pending := range prefilter {
+			// A micro-architecture level is supported wherever its
+			// arch is, so it is compared without it and kept.
+			pending = canonicalPlatform(PlatformFromString(pending.OS, pending.GetArch()))
+			base := pending
+			base.Level = ""
 			for _, platform := range supported {
-				if pending.String() == platform.String() {
+				if base.String() == platform.String() {
 					add := platform
 					add.Default = false
+					add.Level = pending.Level
 					result = append(result, add)
 					break
 				}
@@ -127,9 +145,15 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 		}
 	}
 
-	// Go through each default platform and filter out the bad ones
+	// Go through each default platform and filter out the bad ones. The
+	// flags can name a platform more than once, such as with both -osarch
+	// and -os and -arch, but it is only built once.
 	result := make([]Platform, 0, len(prefilter))
+	seen := make(map[string]bool, len(prefilter))
 	for _, platform := range prefilter {
+		if seen[platformKey(platform)] {
+			continue
+		}
 		if len(ignoreOSArch) > 0 {
 			if _, ok := ignoreOSArch[platform.String()]; ok {
 				continue
@@ -146,20 +170,20 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 		}
 
 		if checkComponents {
-			if len(ignoreArch) > 0 {
-				if _, ok := ignoreArch[platform.GetArch()]; ok {
-					continue
-				}
+			if len(ignoreArch) > 0 && archIn(ignoreArch, platform) {
+				continue
 			}
 			if len(ignoreOS) > 0 {
 				if _, ok := ignoreOS[platform.OS]; ok {
 					continue
 				}
 			}
-			if len(includeArch) > 0 {
-				if _, ok := includeArch[platform.GetArch()]; !ok {
-					continue
-				}
+			if len(includeArch) > 0 && !archIn(includeArch, platform) {
+				continue
+			}
+			if len(p.ARMArch) > 0 && platform.Arch == "arm" && platform.ARM != "" &&
+				!stringIn(p.ARMArch, platform.ARM) {
+				continue
 			}
 			if len(includeOS) > 0 {
 				if _, ok := includeOS[platform.OS]; !ok {
@@ -168,12 +192,71 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 			}
 		}
 
+		seen[platformKey(platform)] = true
 		result = append(result, platform)
 	}
 
 	return result
 }
 
+// expandARM returns platforms with each arm platform that doesn't name
+// one GOARM version, such as "linux/arm" or "linux/armv6+", replaced by
+// the versions of it that are supported, and are in armarch if it is set.
+// Anything that matches no version is kept, to be reported as invalid.
+func expandARM(platforms []Platform, supported []Platform, armarch []string) []Platform {
+	result := make([]Platform, 0, len(platforms))
+	for _, v := range platforms {
+		spec := PlatformFromString(v.OS, v.GetArch())
+		if spec.Arch != "arm" || !isARMRange(spec.ARM) {
+			result = append(result, v)
+			continue
+		}
+
+		found := false
+		for _, s := range supported {
+			if s.OS != strings.TrimPrefix(v.OS, "!") || s.Arch != "arm" || s.ARM == "" ||
+				!armInRange(spec.ARM, s.ARM) || (len(armarch) > 0 && !stringIn(armarch, s.ARM)) {
+				continue
+			}
+			result = append(result, Platform{OS: v.OS, Arch: "arm", ARM: s.ARM, Level: spec.Level})
+			found = true
+		}
+		if !found {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// archIn returns whether the arch of platform is in the -arch values of
+// set, where "arm" and "armv6+" stand for the GOARM versions they match.
+func archIn(set map[string]struct{}, platform Platform) bool {
+	if _, ok := set[platform.GetArch()]; ok {
+		return true
+	}
+	if platform.Arch != "arm" || platform.ARM == "" {
+		return false
+	}
+	for arch := range set {
+		v := PlatformFromString("", arch)
+		if v.GetArch() == platform.GetArch() ||
+			v.Arch == "arm" && isARMRange(v.ARM) && armInRange(v.ARM, platform.ARM) && v.Level == platform.Level {
+			return true
+		}
+	}
+	return false
+}
+
+func stringIn(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // ArchFlagValue returns a flag.Value that can be used with the flag
 // package to collect the arches for the flag.
 func (p *PlatformFlag) ArchFlagValue() flag.Value {
@@ -192,6 +275,12 @@ func (p *PlatformFlag) OSArchFlagValue() flag.Value {
 	return (*appendPlatformValue)(&p.OSArch)
 }
 
+// OSArchFileValue returns a flag.Value that can be used with the flag
+// package to collect complete os and arch pairs from a file.
+func (p *PlatformFlag) OSArchFileValue() flag.Value {
+	return (*osarchFileValue)(&p.OSArch)
+}
+
 // ARMArchFlagValue returns a flag.Value that can be used with the flag
 // package to collect the arm arches for the flag.
 func (p *PlatformFlag) ARMArchFlagValue() flag.Value {
@@ -213,8 +302,15 @@ func (s *appendPlatformValue) Set(value string) error {
 	}
 
 	for _, v := range strings.Split(value, " ") {
+		// The host aliases are resolved to a real platform by ResolveHost
+		// once the host platform is known.
+		if _, ok := hostAliases[strings.TrimPrefix(strings.ToLower(v), "!")]; ok {
+			s.appendIfMissing(&Platform{OS: strings.ToLower(v)})
+			continue
+		}
+
 		parts := strings.Split(v, "/")
-		if len(parts) != 2 {
+		if len(parts) != 2 || strings.TrimPrefix(parts[0], "!") == "" || parts[1] == "" {
 			return fmt.Errorf(
 				"Invalid platform syntax: %s should be os/arch", v)
 		}
@@ -240,6 +336,42 @@ func (s *appendPlatformValue) appendIfMissing(value *Platform) {
 	*s = append(*s, *value)
 }
 
+// osarchFileValue is a flag.Value that appends the platforms of a file to
+// the list, one os/arch pair of the -osarch syntax per line, such as
+// "linux/armv7", "linux/amd64v3" or "!windows/arm". Blank lines and
+// everything after a "#" are ignored. This is used to satisfy the
+// -osarch-file flag.
+type osarchFileValue []Platform
+
+func (s *osarchFileValue) String() string {
+	return ""
+}
+
+func (s *osarchFileValue) Set(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		for _, v := range strings.Fields(line) {
+			if err := (*appendPlatformValue)(s).Set(v); err != nil {
+				return fmt.Errorf("%s:%d: %s", path, i+1, err)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s has no platforms", path)
+	}
+
+	return nil
+}
+
 // appendStringValue is a flag.Value that appends values to the list,
 // where the values come from space-separated lines. This is used to
 // satisfy the -os="windows linux" flag to become []string{"windows", "linux"}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -174,6 +177,25 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			},
 		},
 
+		// Micro-architecture levels
+		{
+			[]string{},
+			[]string{},
+			[]Platform{
+				{OS: "linux", Arch: "amd64v3", Default: true},
+				{OS: "linux", Arch: "arm64v8.2", Default: true},
+				{OS: "linux", Arch: "amd64v9", Default: true},
+			},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: true},
+				{OS: "linux", Arch: "arm64", Default: true},
+			},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: false, Level: "v3"},
+				{OS: "linux", Arch: "arm64", Default: false, Level: "v8.2"},
+			},
+		},
+
 		// Adds non-default by both
 		{
 			[]string{"bar"},
@@ -204,6 +226,93 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 	}
 }
 
+func TestPlatformFlagPlatforms_arm(t *testing.T) {
+	supported := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true},
+		{OS: "linux", Arch: "arm", ARM: "5", Default: true},
+		{OS: "linux", Arch: "arm", ARM: "6", Default: true},
+		{OS: "linux", Arch: "arm", ARM: "7", Default: true},
+		{OS: "android", Arch: "arm", Default: false},
+	}
+	cases := []struct {
+		Flags  []string
+		Result []string
+	}{
+		{[]string{"-osarch", "linux/arm"}, []string{"linux/armv5", "linux/armv6", "linux/armv7"}},
+		{[]string{"-osarch", "linux/armv6+"}, []string{"linux/armv6", "linux/armv7"}},
+		{[]string{"-osarch", "linux/arm", "-armarch", "5 7"}, []string{"linux/armv5", "linux/armv7"}},
+		{[]string{"-osarch", "linux/arm !linux/armv6"}, []string{"linux/armv5", "linux/armv7"}},
+		{[]string{"-osarch", "linux/armv5 linux/amd64", "-armarch", "7"}, []string{"linux/armv5", "linux/amd64"}},
+		{[]string{"-osarch", "android/arm"}, []string{"android/arm"}},
+		{[]string{"-osarch", "linux/armv7,softfloat linux/armv7-softfloat"}, []string{"linux/armv7-softfloat"}},
+		{[]string{"-osarch", "linux/arm-softfloat", "-armarch", "6"}, []string{"linux/armv6-softfloat"}},
+		{[]string{"-osarch", "linux/armv7-fast"}, nil},
+		{[]string{"-os", "linux", "-arch", "armv7+"}, []string{"linux/armv7"}},
+		{[]string{"-arch", "!arm"}, []string{"linux/amd64"}},
+		{[]string{"-armarch", "6"}, []string{"linux/amd64", "linux/armv6"}},
+	}
+
+	for _, tc := range cases {
+		var f PlatformFlag
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Var(f.OSFlagValue(), "os", "")
+		flags.Var(f.ArchFlagValue(), "arch", "")
+		flags.Var(f.OSArchFlagValue(), "osarch", "")
+		flags.Var(f.ARMArchFlagValue(), "armarch", "")
+		if err := flags.Parse(tc.Flags); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var result []string
+		for _, p := range f.Platforms(supported) {
+			result = append(result, p.String())
+		}
+		if !reflect.DeepEqual(result, tc.Result) {
+			t.Fatalf("bad: %v: %#v", tc.Flags, result)
+		}
+	}
+}
+
+func TestPlatformFlagPlatforms_dedupe(t *testing.T) {
+	supported := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true},
+		{OS: "linux", Arch: "arm", ARM: "5", Default: true},
+		{OS: "linux", Arch: "arm", ARM: "7", Default: true},
+		{OS: "darwin", Arch: "arm64", Default: true},
+	}
+	cases := []struct {
+		Flags  []string
+		Result []string
+	}{
+		{[]string{"-os", "linux", "-arch", "amd64", "-osarch", "linux/amd64"}, []string{"linux/amd64"}},
+		{[]string{"-os", "linux linux"}, []string{"linux/amd64", "linux/armv5", "linux/armv7"}},
+		{[]string{"-os", "linux", "-arch", "arm armv7"}, []string{"linux/armv5", "linux/armv7"}},
+		{[]string{"-osarch", "linux/arm linux/armv7 linux/armv7"}, []string{"linux/armv5", "linux/armv7"}},
+		{[]string{"-osarch", "linux/armv7-hardfloat linux/armv7"}, []string{"linux/armv7"}},
+		{[]string{"-osarch", "linux/armv5-softfloat linux/armv5,hardfloat"}, []string{"linux/armv5", "linux/armv5-hardfloat"}},
+		{[]string{"-osarch", "linux/arm !linux/armv7-hardfloat"}, []string{"linux/armv5"}},
+	}
+
+	for _, tc := range cases {
+		var f PlatformFlag
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Var(f.OSFlagValue(), "os", "")
+		flags.Var(f.ArchFlagValue(), "arch", "")
+		flags.Var(f.OSArchFlagValue(), "osarch", "")
+		if err := flags.Parse(tc.Flags); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var result []string
+		for _, p := range f.Platforms(supported) {
+			result = append(result, p.String())
+		}
+		if !reflect.DeepEqual(result, tc.Result) {
+			t.Fatalf("bad: %v: %#v", tc.Flags, result)
+		}
+	}
+}
+
 func TestPlatformFlagArchFlagValue(t *testing.T) {
 	var f PlatformFlag
 	val := f.ArchFlagValue()
@@ -266,6 +375,12 @@ func TestAppendPlatformValue(t *testing.T) {
 		t.Fatal("should err")
 	}
 
+	for _, v := range []string{"/amd64", "linux/", "!/amd64", "/"} {
+		if err := value.Set(v); err == nil {
+			t.Fatalf("should err: %s", v)
+		}
+	}
+
 	if err := value.Set("windows/arm windows/386"); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -321,3 +436,44 @@ func TestAppendStringValue(t *testing.T) {
 		t.Fatalf("bad: %#v", value)
 	}
 }
+
+func TestPlatformFlagOSArchFileValue(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "targets.txt")
+	data := "# Shipped\nlinux/amd64v3\n\n  linux/armv7 # pi\n!windows/arm\nlinux/amd64v3\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var f PlatformFlag
+	f.OSArchFlagValue().Set("darwin/arm64")
+	if err := f.OSArchFileValue().Set(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64v3"},
+		{OS: "linux", Arch: "armv7"},
+		{OS: "!windows", Arch: "arm"},
+	}
+	if !reflect.DeepEqual(f.OSArch, expected) {
+		t.Fatalf("bad: %#v", f.OSArch)
+	}
+
+	for _, data := range []string{"linux/amd64\nlinux\n", "/amd64\n", "linux/ # no arch\n", "# nothing\n"} {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := f.OSArchFileValue().Set(path); err == nil {
+			t.Fatalf("should fail: %q", data)
+		}
+	}
+	if err := f.OSArchFileValue().Set(filepath.Join(td, "none.txt")); err == nil {
+		t.Fatal("should fail")
+	}
+}
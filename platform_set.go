@@ -0,0 +1,97 @@
+package main
+
+import "fmt"
+
+// PlatformSet is an ordered list of platforms in which each OS, arch, ARM
+// version and level is only once. Its methods return new sets and leave
+// the one they are called on as it is, so that the tables of one Go
+// version can be built from those of the version before.
+type PlatformSet []Platform
+
+// platformKey is what makes a platform unique in a PlatformSet: Default
+// and the port info aren't part of it.
+func platformKey(p Platform) string {
+	return p.OS + "/" + p.Arch + "/" + p.ARM + "/" + p.Level
+}
+
+// Add returns the set with the platforms added at the end. A platform
+// that is already in the set replaces it where it is, so a port can be
+// made a default in a later version.
+func (s PlatformSet) Add(platforms ...Platform) (PlatformSet, error) {
+	return s.add(platforms, true)
+}
+
+// Merge returns the set with the platforms added at the end, except those
+// that are already in the set, which are kept as they are.
+func (s PlatformSet) Merge(platforms ...Platform) (PlatformSet, error) {
+	return s.add(platforms, false)
+}
+
+func (s PlatformSet) add(platforms []Platform, replace bool) (PlatformSet, error) {
+	result := make(PlatformSet, len(s), len(s)+len(platforms))
+	copy(result, s)
+	index := make(map[string]int, len(result))
+	for i, p := range result {
+		index[platformKey(p)] = i
+	}
+
+	for _, p := range platforms {
+		if p.OS == "" || p.Arch == "" {
+			return nil, fmt.Errorf("platform %q needs both an OS and an arch", p.String())
+		}
+		key := platformKey(p)
+		if i, ok := index[key]; ok {
+			if replace {
+				result[i] = p
+			}
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// Drop returns the set without the platforms, which must all be in it.
+func (s PlatformSet) Drop(platforms ...Platform) (PlatformSet, error) {
+	drop := make(map[string]bool, len(platforms))
+	for _, p := range platforms {
+		drop[platformKey(p)] = true
+	}
+
+	result := make(PlatformSet, 0, len(s))
+	for _, p := range s {
+		key := platformKey(p)
+		if drop[key] {
+			delete(drop, key)
+			continue
+		}
+		result = append(result, p)
+	}
+	for _, p := range platforms {
+		if drop[platformKey(p)] {
+			return nil, fmt.Errorf("can't drop %s: it isn't in the set", p.String())
+		}
+	}
+	return result, nil
+}
+
+// platformTableErrors are the errors of building the platform tables,
+// which are recorded rather than panicking, since gox may be embedded.
+// The tests check that there are none.
+var platformTableErrors []error
+
+// platformTable returns the table of a Go version: base, the table of the
+// version before, with the platforms of add added and those of drop
+// dropped. If that fails, the error is recorded and base is returned.
+func platformTable(base []Platform, add []Platform, drop []Platform) []Platform {
+	result, err := PlatformSet(base).Add(add...)
+	if err == nil {
+		result, err = result.Drop(drop...)
+	}
+	if err != nil {
+		platformTableErrors = append(platformTableErrors, err)
+		return base
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformSet(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64", Default: true}
+	arm64 := Platform{OS: "linux", Arch: "arm64", Default: false}
+	armv6 := Platform{OS: "linux", Arch: "arm", ARM: "6"}
+	armv7 := Platform{OS: "linux", Arch: "arm", ARM: "7"}
+	base := PlatformSet{linux, arm64}
+
+	// Adding one that is there replaces it in place
+	arm64Default := arm64
+	arm64Default.Default = true
+	s, err := base.Add(armv6, arm64Default, armv7, armv6)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(s, PlatformSet{linux, arm64Default, armv6, armv7}) {
+		t.Fatalf("bad: %#v", s)
+	}
+	if !reflect.DeepEqual(base, PlatformSet{linux, arm64}) {
+		t.Fatalf("the set should not change: %#v", base)
+	}
+
+	// Merging one that is there keeps it
+	s, err = base.Merge(arm64Default, armv7)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(s, PlatformSet{linux, arm64, armv7}) {
+		t.Fatalf("bad: %#v", s)
+	}
+
+	s, err = s.Drop(linux, armv7)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(s, PlatformSet{arm64}) {
+		t.Fatalf("bad: %#v", s)
+	}
+
+	if _, err := base.Drop(armv6); err == nil {
+		t.Fatal("should err")
+	}
+	if _, err := base.Add(Platform{OS: "linux"}); err == nil {
+		t.Fatal("should err")
+	}
+	if _, err := base.Merge(Platform{Arch: "amd64"}); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestPlatformTable(t *testing.T) {
+	if len(platformTableErrors) > 0 {
+		t.Fatalf("err: %v", platformTableErrors)
+	}
+
+	// Every table has each platform once
+	for _, v := range []string{"go1.5", "go1.14", "go1.17", "go1.26"} {
+		seen := make(map[string]bool)
+		for _, p := range SupportedPlatforms(v) {
+			if seen[platformKey(p)] {
+				t.Fatalf("%s: %s is in the table twice", v, p.String())
+			}
+			seen[platformKey(p)] = true
+		}
+	}
+
+	defer func() { platformTableErrors = nil }()
+	base := []Platform{{OS: "linux", Arch: "amd64"}}
+	if v := platformTable(base, nil, []Platform{{OS: "plan9", Arch: "386"}}); !reflect.DeepEqual(v, base) {
+		t.Fatalf("bad: %#v", v)
+	}
+	if len(platformTableErrors) != 1 {
+		t.Fatalf("bad: %v", platformTableErrors)
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -108,10 +112,36 @@ func TestSupportedPlatforms(t *testing.T) {
 		t.Fatalf("bad: %#v", ps)
 	}
 
+	ps = SupportedPlatforms("go1.19")
+	if !reflect.DeepEqual(ps, Platforms_1_19) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.21.5")
+	if !reflect.DeepEqual(ps, Platforms_1_21) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.23.0")
+	if !reflect.DeepEqual(ps, Platforms_1_23) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.26.1")
+	if !reflect.DeepEqual(ps, Platforms_1_26) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
 	ps = SupportedPlatforms("go1.10")
 	if !reflect.DeepEqual(ps, Platforms_1_10) {
 		t.Fatalf("bad: %#v", ps)
 	}
+	// Newer than the tables, and not the go on the PATH
+	ps = SupportedPlatforms("go1.99.0")
+	if !reflect.DeepEqual(ps, PlatformsLatest) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
 	// Unknown
 	ps = SupportedPlatforms("foo")
 	if !reflect.DeepEqual(ps, PlatformsLatest) {
@@ -119,6 +149,67 @@ func TestSupportedPlatforms(t *testing.T) {
 	}
 }
 
+func TestSupportedPlatforms_dist(t *testing.T) {
+	// The output of `go tool dist list` of each modeled version, so that
+	// the tables are checked without the toolchains installed
+	files, err := filepath.Glob(filepath.Join("testdata", "dist", "go*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("bad: %#v %v", files, err)
+	}
+
+	all := make(ExperimentSet)
+	for i := range Experiments {
+		all[Experiments[i].Name] = &Experiments[i]
+	}
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		dist := make(map[string]bool)
+		for _, name := range strings.Fields(string(data)) {
+			dist[name] = true
+		}
+
+		// The platforms of the table, with those of every experiment,
+		// should be the ports of the go command
+		v := strings.TrimSuffix(filepath.Base(path), ".txt")
+		modeled := make(map[string]bool)
+		for _, p := range all.Platforms(v, SupportedPlatforms(v)) {
+			if !dist[p.OS+"/"+p.Arch] {
+				t.Fatalf("%s: %s isn't a port", v, p.String())
+			}
+			modeled[p.OS+"/"+p.Arch] = true
+		}
+		for name := range dist {
+			if !modeled[name] {
+				t.Fatalf("%s: %s isn't in the platform tables", v, name)
+			}
+		}
+	}
+}
+
+func TestUnknownPlatforms(t *testing.T) {
+	// A newer Go with the ports of the latest table, and one more
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "dist", fmt.Sprintf("go1.%d.0.txt", platformsLatestMinor)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dist := make(map[string]distPlatform)
+	for _, name := range strings.Fields(string(data)) {
+		parts := strings.Split(name, "/")
+		dist[name] = distPlatform{GOOS: parts[0], GOARCH: parts[1]}
+	}
+	if added := unknownPlatforms(dist); len(added) != 0 {
+		t.Fatalf("bad: %#v", added)
+	}
+
+	dist["linux/sparc64"] = distPlatform{GOOS: "linux", GOARCH: "sparc64"}
+	if added := unknownPlatforms(dist); len(added) != 1 || added[0].String() != "linux/sparc64" {
+		t.Fatalf("bad: %#v", added)
+	}
+}
+
 func TestMIPS(t *testing.T) {
 	g16 := SupportedPlatforms("go1.6")
 	found := false
@@ -148,3 +239,107 @@ func TestMIPS(t *testing.T) {
 		t.Fatal("Expected to find linux/mips64/true in go1.7 supported platforms")
 	}
 }
+
+func TestPlatformFromString(t *testing.T) {
+	cases := []struct {
+		Arch   string
+		Output Platform
+	}{
+		{"amd64", Platform{OS: "linux", Arch: "amd64"}},
+		{"armv7", Platform{OS: "linux", Arch: "arm", ARM: "7"}},
+		{"armv7-softfloat", Platform{OS: "linux", Arch: "arm", ARM: "7", Level: "softfloat"}},
+		{"armv6-hardfloat", Platform{OS: "linux", Arch: "arm", ARM: "6", Level: "hardfloat"}},
+		{"amd64v3", Platform{OS: "linux", Arch: "amd64", Level: "v3"}},
+		{"arm64v8.2", Platform{OS: "linux", Arch: "arm64", Level: "v8.2"}},
+		{"386sse2", Platform{OS: "linux", Arch: "386", Level: "sse2"}},
+		{"ppc64power9", Platform{OS: "linux", Arch: "ppc64", Level: "power9"}},
+		{"ppc64lepower10", Platform{OS: "linux", Arch: "ppc64le", Level: "power10"}},
+		{"riscv64rva22u64", Platform{OS: "linux", Arch: "riscv64", Level: "rva22u64"}},
+		{"mipsle-softfloat", Platform{OS: "linux", Arch: "mipsle", Level: "softfloat"}},
+		{"mips64-hardfloat", Platform{OS: "linux", Arch: "mips64", Level: "hardfloat"}},
+		{"mipslesoftfloat", Platform{OS: "linux", Arch: "mipslesoftfloat"}},
+		{"amd64v9", Platform{OS: "linux", Arch: "amd64v9"}},
+	}
+
+	for _, tc := range cases {
+		actual := PlatformFromString("linux", tc.Arch)
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("%s: bad: %#v", tc.Arch, actual)
+		}
+		if actual.GetArch() != tc.Arch {
+			t.Fatalf("%s: bad arch: %s", tc.Arch, actual.GetArch())
+		}
+	}
+
+	for arch, expected := range map[string]string{
+		"ppc64lepower9":      "GOPPC64=power9",
+		"mips-softfloat":     "GOMIPS=softfloat",
+		"mips64le-softfloat": "GOMIPS64=softfloat",
+		"amd64":              "",
+	} {
+		p := PlatformFromString("linux", arch)
+		if env := p.LevelEnv(); env != expected {
+			t.Fatalf("%s: bad: %s", arch, env)
+		}
+	}
+
+	for arch, expected := range map[string]string{
+		"armv7":           "GOARM=7",
+		"armv7,softfloat": "GOARM=7,softfloat",
+		"armv5-hardfloat": "GOARM=5,hardfloat",
+		"armv7-fast":      "GOARM=7-fast",
+		"amd64v3":         "",
+	} {
+		p := PlatformFromString("linux", arch)
+		if env := p.ARMEnv(); env != expected || p.LevelEnv() != "" && p.Arch == "arm" {
+			t.Fatalf("%s: bad: %s", arch, env)
+		}
+	}
+}
+
+func TestFilterTier(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64", Tier: 1},
+		{OS: "linux", Arch: "riscv64", Tier: 2},
+		PlatformFromString("windows", "arm64"),
+		PlatformFromString("darwin", "arm64"),
+		{OS: "target", Arch: "pico"},
+	}
+
+	var actual []string
+	for _, p := range filterTier(platforms, 1) {
+		actual = append(actual, p.String())
+	}
+	if !reflect.DeepEqual(actual, []string{"linux/amd64", "darwin/arm64"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if len(filterTier(platforms, 2)) != len(platforms) {
+		t.Fatal("tier 2 should have every platform")
+	}
+
+	for _, p := range SupportedPlatforms("go1.21") {
+		if p.Tier != portTier(p.OS, p.Arch) {
+			t.Fatalf("bad: %#v", p)
+		}
+	}
+}
+
+func TestArmInRange(t *testing.T) {
+	cases := []struct {
+		Spec, ARM string
+		Result    bool
+	}{
+		{"", "5", true},
+		{"6+", "5", false},
+		{"6+", "6", true},
+		{"6+", "7", true},
+		{"7", "7", true},
+		{"7", "6", false},
+		{"x+", "7", false},
+	}
+	for _, tc := range cases {
+		if actual := armInRange(tc.Spec, tc.ARM); actual != tc.Result {
+			t.Fatalf("bad: %#v", tc)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Preflight checks the packages on the host before they are built for
+// every platform: go vet, then a go build whose binaries are thrown away.
+// Both take seconds, so code that can't build anywhere fails before the
+// whole matrix of cross compiles runs. The build settings, such as the
+// tags and -mod, are those of opts. Test packages are only vetted, since
+// go build has nothing to build in a package with only tests.
+func Preflight(opts *CompileOpts, packages []string) error {
+	// Packages outside of a module or GOPATH are run from their own
+	// directories, like their builds
+	var dirs []string
+	byDir := make(map[string][]string)
+	for _, path := range packages {
+		chdir, pkg := splitPackagePath(path)
+		if pkg == "" {
+			pkg = "."
+		}
+		if _, ok := byDir[chdir]; !ok {
+			dirs = append(dirs, chdir)
+		}
+		byDir[chdir] = append(byDir[chdir], pkg)
+	}
+
+	env := append(os.Environ(), opts.goFlagsEnv()...)
+	if opts.GoWork != "" {
+		env = append(env, "GOWORK="+opts.GoWork)
+	}
+	for _, dir := range dirs {
+		if _, err := execGo(opts.GoCmd, env, dir, opts.preflightArgs("vet", byDir[dir])...); err != nil {
+			return fmt.Errorf("go vet failed: %s", err)
+		}
+		if opts.Test {
+			continue
+		}
+		if _, err := execGo(opts.GoCmd, env, dir, opts.preflightArgs("build", byDir[dir])...); err != nil {
+			return fmt.Errorf("go build failed: %s", err)
+		}
+	}
+	return nil
+}
+
+func (opts *CompileOpts) preflightArgs(cmd string, packages []string) []string {
+	args := []string{cmd, "-tags", opts.buildTags()}
+	if cmd == "build" {
+		args = append(args, "-o", os.DevNull)
+	}
+	if opts.ModMode != "" {
+		args = append(args, "-mod", opts.ModMode)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay", opts.Overlay)
+	}
+	return append(args, packages...)
+}
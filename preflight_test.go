@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.17\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	opts := &CompileOpts{GoCmd: "go", Tags: "broken"}
+	if err := Preflight(opts, []string{"example.com/app"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	write("vet.go", "package main\n\nimport \"fmt\"\n\nfunc f() { fmt.Printf(\"%d\", \"s\") }\n")
+	err = Preflight(opts, []string{"example.com/app"})
+	if err == nil || !strings.Contains(err.Error(), "go vet failed") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	os.Remove(filepath.Join(td, "vet.go"))
+	write("broken.go", "//go:build broken\n\npackage main\n\nvar x int = \"s\"\n")
+	if err := Preflight(opts, []string{"example.com/app"}); err == nil {
+		t.Fatal("should fail")
+	}
+}
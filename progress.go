@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressWindow is how many of the latest build times the ETA of
+// -progress is averaged over, so that it follows builds getting faster or
+// slower as the platforms change.
+const progressWindow = 8
+
+// progressBarWidth is the width of the bar of -progress, in characters.
+const progressBarWidth = 20
+
+// ProgressLine is the progress of -progress: how many builds are done out
+// of all of them, which are running, and when they should all be done. On
+// a terminal it is a single line that is redrawn in place, under what is
+// printed to stdout; otherwise a line is written as each build finishes.
+type ProgressLine struct {
+	Out      io.Writer
+	Total    int
+	Parallel int
+
+	// TTY redraws the line in place, and Capture also takes over stdout
+	// so that it is printed above the line rather than over it.
+	TTY     bool
+	Capture bool
+	Width   int
+
+	lock      sync.Mutex
+	start     time.Time
+	done      int
+	failed    int
+	running   map[string]int
+	durations []time.Duration
+	restore   func()
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+// Run starts showing the progress.
+func (p *ProgressLine) Run() error {
+	p.start = time.Now()
+	p.running = make(map[string]int)
+	p.stopCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	if !p.TTY {
+		close(p.doneCh)
+		return nil
+	}
+
+	if p.Capture {
+		restore, err := captureStdout(func(line string) {
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			fmt.Fprintf(p.Out, "\r\x1b[K%s\n", line)
+			p.draw()
+		})
+		if err != nil {
+			return err
+		}
+		p.restore = restore
+	}
+
+	// The ETA counts down between builds
+	go func() {
+		defer close(p.doneCh)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.lock.Lock()
+				p.draw()
+				p.lock.Unlock()
+			case <-p.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops showing the progress, and clears the line from the terminal.
+func (p *ProgressLine) Stop() {
+	if p.restore != nil {
+		p.restore()
+	}
+	close(p.stopCh)
+	<-p.doneCh
+
+	if p.TTY {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		fmt.Fprint(p.Out, "\r\x1b[K")
+	}
+}
+
+// Started marks the build of name as running.
+func (p *ProgressLine) Started(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running[name]++
+	if p.TTY {
+		p.draw()
+	}
+}
+
+// Finished marks the build of name as done with result.
+func (p *ProgressLine) Finished(name string, result BuildResult) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.running[name]--; p.running[name] <= 0 {
+		delete(p.running, name)
+	}
+	p.done++
+	if result.Err != nil {
+		p.failed++
+	}
+
+	// Up to date binaries take no time to build, and would make the
+	// others look faster than they are
+	if result.Duration > 0 {
+		p.durations = append(p.durations, result.Duration)
+		if len(p.durations) > progressWindow {
+			p.durations = p.durations[1:]
+		}
+	}
+
+	if p.TTY {
+		p.draw()
+	} else {
+		fmt.Fprintf(p.Out, "%s\n", p.line(time.Now()))
+	}
+}
+
+// draw redraws the line in place. The lock must be held.
+func (p *ProgressLine) draw() {
+	fmt.Fprintf(p.Out, "\r\x1b[K%s", truncateLine(p.line(time.Now()), p.Width))
+}
+
+// line returns the progress as of now.
+func (p *ProgressLine) line(now time.Time) string {
+	filled := 0
+	if p.Total > 0 {
+		filled = p.done * progressBarWidth / p.Total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	line := fmt.Sprintf("[%s] %d/%d", bar, p.done, p.Total)
+	if p.failed > 0 {
+		line += fmt.Sprintf(", %d failed", p.failed)
+	}
+
+	elapsed := now.Sub(p.start).Round(time.Second)
+	if remaining := p.Total - p.done; remaining > 0 {
+		if eta, ok := progressETA(p.durations, remaining, p.Parallel); ok {
+			line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	} else {
+		line += fmt.Sprintf(", done in %s", elapsed)
+	}
+
+	if len(p.running) > 0 && p.TTY {
+		names := make([]string, 0, len(p.running))
+		for name := range p.running {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		line += fmt.Sprintf(", building %s", strings.Join(names, ", "))
+	}
+
+	return line
+}
+
+// progressETA estimates how long the remaining builds will take, from the
+// average of the latest build times and how many run at once. It returns
+// false until a build has finished.
+func progressETA(durations []time.Duration, remaining, parallel int) (time.Duration, bool) {
+	if len(durations) == 0 {
+		return 0, false
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	average := total / time.Duration(len(durations))
+
+	// Builds run in rounds of up to parallel at a time
+	rounds := (remaining + parallel - 1) / parallel
+	return average * time.Duration(rounds), true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressETA(t *testing.T) {
+	cases := []struct {
+		Durations []time.Duration
+		Remaining int
+		Parallel  int
+		Expected  time.Duration
+		OK        bool
+	}{
+		{nil, 4, 2, 0, false},
+		{[]time.Duration{2 * time.Second, 4 * time.Second}, 4, 2, 6 * time.Second, true},
+		{[]time.Duration{2 * time.Second}, 5, 2, 6 * time.Second, true},
+		{[]time.Duration{2 * time.Second}, 3, 0, 6 * time.Second, true},
+	}
+
+	for _, tc := range cases {
+		actual, ok := progressETA(tc.Durations, tc.Remaining, tc.Parallel)
+		if actual != tc.Expected || ok != tc.OK {
+			t.Fatalf("bad: %#v %s %t", tc, actual, ok)
+		}
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	var out strings.Builder
+	p := &ProgressLine{Out: &out, Total: 4, Parallel: 2}
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p.Started("linux/amd64")
+	p.Started("linux/arm64")
+	p.Finished("linux/amd64", BuildResult{Duration: 3 * time.Second})
+	p.Finished("linux/arm64", BuildResult{Duration: time.Second, Err: errors.New("exit status 1")})
+	p.Stop()
+
+	expected := "[=====               ] 1/4, ETA 6s\n" +
+		"[==========          ] 2/4, 1 failed, ETA 2s\n"
+	if out.String() != expected {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	p.start = time.Now().Add(-5 * time.Second)
+	p.TTY = true
+	p.Finished("windows/amd64", BuildResult{UpToDate: true})
+	p.running["darwin/arm64"] = 1
+	line := p.line(time.Now())
+	if line != "[===============     ] 3/4, 1 failed, ETA 2s, building darwin/arm64" {
+		t.Fatalf("bad: %q", line)
+	}
+}
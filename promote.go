@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ChannelConfig is an entry of the "channels" section of the config file,
+// keyed by name such as "nightly" or "stable". A channel is a place that
+// releases are published to, and `gox promote` copies a release that was
+// built and checked once from one channel to another.
+type ChannelConfig struct {
+	// Dir is the template for the directory of a release in the channel,
+	// with {{.Channel}} and {{.Version}}, such as
+	// "/srv/releases/{{.Channel}}/{{.Version}}".
+	Dir string `json:"dir"`
+
+	// Sign re-signs the darwin and windows binaries of a release promoted
+	// into the channel, with the "codesign" and "authenticode" sections.
+	Sign bool `json:"sign,omitempty"`
+}
+
+// Validate checks the dir template of the channel name.
+func (c *ChannelConfig) Validate(name string) error {
+	if c.Dir == "" {
+		return fmt.Errorf("channels: %s: dir is required", name)
+	}
+	if _, err := template.New("dir").Parse(c.Dir); err != nil {
+		return fmt.Errorf("channels: %s: dir: %s", name, err)
+	}
+
+	return nil
+}
+
+// ReleaseDir returns the directory of version in the channel name.
+func (c *ChannelConfig) ReleaseDir(name, version string) (string, error) {
+	t, err := template.New("dir").Parse(c.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]string{"Channel": name, "Version": version}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// PromoteOpts are the options of a promotion of a release between two
+// channels of Config.
+type PromoteOpts struct {
+	Config  *Config
+	From    string
+	To      string
+	Version string
+
+	// Force replaces a release that is already in the target channel.
+	Force bool
+
+	// GoCmd reads the platform of binaries that are re-signed.
+	GoCmd string
+}
+
+// Promote copies the release from one channel to another without building
+// it again. Every file of the release is checked against the release's
+// checksums file first, so only what was built and checked is promoted.
+// It returns the paths of the promoted files.
+func Promote(opts *PromoteOpts) ([]string, error) {
+	from, to, err := opts.channels()
+	if err != nil {
+		return nil, err
+	}
+	src, err := from.ReleaseDir(opts.From, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := to.ReleaseDir(opts.To, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	sumsName, err := opts.Config.Checksums.FileName(opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	names, err := verifyChecksums(filepath.Join(src, sumsName))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s can't be promoted: %s", opts.From, opts.Version, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, sumsName)); err == nil && !opts.Force {
+		return nil, fmt.Errorf("%s already has %s in %s, use -force to replace it", opts.To, opts.Version, dst)
+	}
+
+	var paths []string
+	for _, name := range append(names, sumsName) {
+		path := filepath.Join(dst, name)
+		info, err := os.Stat(filepath.Join(src, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := copyFile(filepath.Join(src, name), path, info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	// Signing changes the binaries, so the checksums are written again
+	rewritten := false
+	if to.Sign {
+		signed, err := opts.sign(paths[:len(names)])
+		if err != nil {
+			return nil, err
+		}
+		if signed > 0 {
+			sums := &ChecksumConfig{Name: sumsName}
+			if _, err := sums.WriteChecksums(dst, paths[:len(names)], opts.Version); err != nil {
+				return nil, err
+			}
+			rewritten = true
+		}
+	}
+
+	// The signature of the checksums of the "sign" section goes with
+	// them, and is made again if they were written again
+	sigName := sumsName + signatureExt
+	sigInfo, sigErr := os.Stat(filepath.Join(src, sigName))
+	switch {
+	case rewritten && opts.Config.Sign != nil:
+		path, err := opts.Config.Sign.Sign(filepath.Join(dst, sumsName))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	case rewritten:
+		os.Remove(filepath.Join(dst, sigName))
+	case sigErr == nil:
+		path := filepath.Join(dst, sigName)
+		if err := copyFile(filepath.Join(src, sigName), path, sigInfo.Mode().Perm()); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func (opts *PromoteOpts) channels() (*ChannelConfig, *ChannelConfig, error) {
+	var names []string
+	for name := range opts.Config.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	from, to := opts.Config.Channels[opts.From], opts.Config.Channels[opts.To]
+	switch {
+	case len(names) == 0:
+		return nil, nil, fmt.Errorf("The config file has no \"channels\" section")
+	case from == nil:
+		return nil, nil, fmt.Errorf("Unknown channel %q, must be one of: %s", opts.From, strings.Join(names, ", "))
+	case to == nil:
+		return nil, nil, fmt.Errorf("Unknown channel %q, must be one of: %s", opts.To, strings.Join(names, ", "))
+	case opts.From == opts.To:
+		return nil, nil, fmt.Errorf("Can't promote %s to itself", opts.From)
+	case to.Sign && opts.Config.Codesign == nil && opts.Config.Authenticode == nil:
+		return nil, nil, fmt.Errorf("Channel %s signs releases, but there is no \"codesign\" or \"authenticode\" section", opts.To)
+	}
+
+	return from, to, nil
+}
+
+// sign signs the darwin and windows binaries among paths and returns how
+// many it signed. Files that aren't Go binaries, such as archives, are
+// left as they are.
+func (opts *PromoteOpts) sign(paths []string) (int, error) {
+	signed := 0
+	for _, path := range paths {
+		info, err := GoBinaryInfo(opts.GoCmd, path)
+		if err != nil {
+			continue
+		}
+		platform, err := info.Platform()
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case platform.OS == "darwin" && opts.Config.Codesign != nil:
+			err = Codesign(opts.Config.Codesign, path)
+		case platform.OS == "windows" && opts.Config.Authenticode != nil:
+			err = Authenticode(opts.Config.Authenticode, path)
+		default:
+			continue
+		}
+		if err != nil {
+			return signed, fmt.Errorf("%s: %s", filepath.Base(path), err)
+		}
+		ui.Infof("--> %15s: signed %s\n", platform.String(), filepath.Base(path))
+		signed++
+	}
+
+	return signed, nil
+}
+
+// verifyChecksums checks every file listed in the sha256sum file at path,
+// which must all be next to it, and returns their names.
+func verifyChecksums(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: invalid line %q", path, scanner.Text())
+		}
+
+		// sha256sum marks binary mode with a "*" before the name
+		name := strings.TrimPrefix(fields[1], "*")
+		if name != filepath.Base(name) {
+			return nil, fmt.Errorf("%s: %s is not in the same directory", path, name)
+		}
+		sum, err := fileSHA256(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			return nil, err
+		}
+		if sum != fields[0] {
+			return nil, fmt.Errorf("%s doesn't match its checksum", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s lists no files", path)
+	}
+
+	return names, nil
+}
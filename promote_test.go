@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChannelConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config ChannelConfig
+		Err    bool
+	}{
+		{ChannelConfig{Dir: "releases/{{.Channel}}/{{.Version}}"}, false},
+		{ChannelConfig{}, true},
+		{ChannelConfig{Dir: "{{.Version"}, true},
+	}
+
+	for _, tc := range cases {
+		if err := tc.Config.Validate("stable"); (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestPromote(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "nightly", "1.5.0")
+	var files []string
+	for _, name := range []string{"app_1.5.0_linux_amd64.tar.gz", "app_1.5.0_windows_amd64.zip"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(src, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		files = append(files, path)
+	}
+	sums := &ChecksumConfig{Name: "app_{{.Version}}_SHA256SUMS"}
+	if _, err := sums.WriteChecksums(src, files, "1.5.0"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := &Config{
+		Checksums: sums,
+		Channels: map[string]*ChannelConfig{
+			"nightly": {Dir: filepath.Join(td, "{{.Channel}}", "{{.Version}}")},
+			"stable":  {Dir: filepath.Join(td, "{{.Channel}}", "{{.Version}}")},
+			"signed":  {Dir: filepath.Join(td, "signed"), Sign: true},
+		},
+	}
+	opts := &PromoteOpts{Config: config, From: "nightly", To: "stable", Version: "1.5.0", GoCmd: "go"}
+	paths, err := Promote(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dst := filepath.Join(td, "stable", "1.5.0")
+	expected := []string{
+		filepath.Join(dst, "app_1.5.0_linux_amd64.tar.gz"),
+		filepath.Join(dst, "app_1.5.0_windows_amd64.zip"),
+		filepath.Join(dst, "app_1.5.0_SHA256SUMS"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("bad: %#v", paths)
+	}
+	if _, err := verifyChecksums(expected[2]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Promoting again needs -force
+	if _, err := Promote(opts); err == nil {
+		t.Fatal("should error")
+	}
+	opts.Force = true
+	if _, err := Promote(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Unknown channels, and signing without signing sections, are errors
+	for _, to := range []string{"beta", "nightly", "signed"} {
+		if _, err := Promote(&PromoteOpts{Config: config, From: "nightly", To: to, Version: "1.5.0"}); err == nil {
+			t.Fatalf("%s: should error", to)
+		}
+	}
+
+	// Files that don't match their checksums aren't promoted
+	if err := ioutil.WriteFile(files[0], []byte("tampered"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	opts.To = "stable"
+	if _, err := Promote(opts); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestPromote_signature(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "nightly")
+	path := filepath.Join(src, "app_linux_amd64.tar.gz")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ioutil.WriteFile(path, []byte("archive"), 0644)
+	sums := &ChecksumConfig{Name: "SHA256SUMS"}
+	if _, err := sums.WriteChecksums(src, []string{path}, "1.5.0"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ioutil.WriteFile(filepath.Join(src, "SHA256SUMS.sig"), []byte("ZGVy"), 0644)
+
+	config := &Config{
+		Checksums: sums,
+		Channels: map[string]*ChannelConfig{
+			"nightly": {Dir: filepath.Join(td, "{{.Channel}}")},
+			"stable":  {Dir: filepath.Join(td, "{{.Channel}}")},
+		},
+	}
+	paths, err := Promote(&PromoteOpts{Config: config, From: "nightly", To: "stable", Version: "1.5.0", GoCmd: "go"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sig := filepath.Join(td, "stable", "SHA256SUMS.sig")
+	if len(paths) != 3 || paths[2] != sig {
+		t.Fatalf("bad: %#v", paths)
+	}
+	if data, _ := ioutil.ReadFile(sig); string(data) != "ZGVy" {
+		t.Fatalf("bad: %q", data)
+	}
+}
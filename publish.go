@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RepoConfig is a git repository that -publish commits the manifests of
+// a package manager to, such as a Homebrew tap or a Scoop bucket.
+type RepoConfig struct {
+	// Repository is what git clones, such as
+	// "git@github.com:example/homebrew-tap.git".
+	Repository string `json:"repository"`
+
+	// Branch defaults to that of the remote HEAD. Directory is where the
+	// manifests are written, and has a default for each package manager.
+	Branch    string `json:"branch,omitempty"`
+	Directory string `json:"directory,omitempty"`
+}
+
+// Validate checks that the repository is set; section names the config
+// section in errors.
+func (c *RepoConfig) Validate(section string) error {
+	if c.Repository == "" {
+		return fmt.Errorf("%s: repository is required", section)
+	}
+
+	return nil
+}
+
+func (c *RepoConfig) directory(def string) string {
+	if c.Directory == "" {
+		return def
+	}
+	return c.Directory
+}
+
+// PushToRepo copies the files at paths into the directory of the
+// repository, commits them with message and pushes. It returns false if
+// the repository already had the same files.
+func PushToRepo(repo *RepoConfig, directory string, paths []string, message string) (bool, error) {
+	dir, err := ioutil.TempDir("", "gox-publish")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--depth", "1"}
+	if repo.Branch != "" {
+		args = append(args, "--branch", repo.Branch)
+	}
+	if _, err := execGo("git", secretEnviron(), "", append(args, repo.Repository, dir)...); err != nil {
+		return false, fmt.Errorf("git clone failed: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, directory), 0755); err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		rel := filepath.Join(directory, filepath.Base(path))
+		if err := ioutil.WriteFile(filepath.Join(dir, rel), data, 0644); err != nil {
+			return false, err
+		}
+		if _, err := execGo("git", nil, dir, "add", rel); err != nil {
+			return false, fmt.Errorf("git add failed: %s", err)
+		}
+	}
+
+	status, err := execGo("git", nil, dir, "status", "--porcelain")
+	if err != nil {
+		return false, fmt.Errorf("git status failed: %s", err)
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+
+	if _, err := execGo("git", nil, dir, "commit", "-m", message); err != nil {
+		return false, fmt.Errorf("git commit failed: %s", err)
+	}
+	if _, err := execGo("git", secretEnviron(), dir, "push", "origin", "HEAD"); err != nil {
+		return false, fmt.Errorf("git push failed: %s", err)
+	}
+
+	return true, nil
+}
+
+// releaseURLData is what the URL templates of package managers are
+// executed with.
+type releaseURLData struct {
+	Name    string
+	Version string
+	OS      string
+	Arch    string
+}
+
+// validateURLTemplate checks the URL template of section.
+func validateURLTemplate(section, tpl string) error {
+	if _, err := template.New("url").Parse(tpl); err != nil {
+		return fmt.Errorf("%s: %s", section, err)
+	}
+
+	return nil
+}
+
+// releaseURL executes the URL template tpl for the archive of r at path.
+func releaseURL(tpl, path string, r BuildResult, version string) (string, error) {
+	t, err := template.New("url").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, &releaseURLData{
+		Name:    filepath.Base(path),
+		Version: version,
+		OS:      r.Platform.OS,
+		Arch:    r.Platform.GetArch(),
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// releaseBuilds returns the successful standard builds of results for
+// the operating systems oses, of the package pkg if it is set. It is an
+// error if there are none, or if they are of several packages.
+func releaseBuilds(pkg string, results []BuildResult, oses ...string) ([]BuildResult, error) {
+	wanted := make(map[string]bool)
+	for _, goos := range oses {
+		wanted[goos] = true
+	}
+
+	var builds []BuildResult
+	pkgs := make(map[string]bool)
+	for _, r := range results {
+		if r.Err != nil || r.Variant != "" || !wanted[r.Platform.OS] {
+			continue
+		}
+		if pkg != "" && r.Path != pkg && filepath.Base(r.Path) != pkg {
+			continue
+		}
+		builds = append(builds, r)
+		pkgs[r.Path] = true
+	}
+	if len(builds) == 0 {
+		return nil, fmt.Errorf("no %s binaries to publish", strings.Join(oses, " or "))
+	}
+	if len(pkgs) > 1 {
+		return nil, fmt.Errorf("package is required when more than one package is built")
+	}
+
+	return builds, nil
+}
+
+// pickBuilds picks one of builds for each of arches of goos, in the order
+// of arches. Of several builds of an arch, the lowest micro-architecture
+// level is used, which runs on the most machines, and the highest GOARM.
+func pickBuilds(goos string, arches []string, builds []BuildResult) []BuildResult {
+	byArch := make(map[string][]BuildResult)
+	for _, r := range builds {
+		if r.Platform.OS == goos {
+			byArch[r.Platform.Arch] = append(byArch[r.Platform.Arch], r)
+		}
+	}
+
+	var picked []BuildResult
+	for _, arch := range arches {
+		rs := byArch[arch]
+		if len(rs) == 0 {
+			continue
+		}
+		sort.Slice(rs, func(i, j int) bool {
+			if rs[i].Platform.ARM != rs[j].Platform.ARM {
+				return rs[i].Platform.ARM > rs[j].Platform.ARM
+			}
+			return rs[i].Platform.Level < rs[j].Platform.Level
+		})
+		picked = append(picked, rs[0])
+	}
+	return picked
+}
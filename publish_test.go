@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPickBuilds(t *testing.T) {
+	builds := []BuildResult{
+		{Platform: Platform{OS: "linux", Arch: "amd64", Level: "v3"}},
+		{Platform: Platform{OS: "linux", Arch: "amd64"}},
+		{Platform: Platform{OS: "linux", Arch: "arm", ARM: "6"}},
+		{Platform: Platform{OS: "linux", Arch: "arm", ARM: "7"}},
+		{Platform: Platform{OS: "darwin", Arch: "arm64"}},
+	}
+
+	picked := pickBuilds("linux", []string{"arm", "arm64", "amd64"}, builds)
+	var actual []string
+	for _, r := range picked {
+		actual = append(actual, r.Platform.GetArch())
+	}
+	if len(actual) != 2 || actual[0] != "armv7" || actual[1] != "amd64" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestPushToRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, "gox")
+	}
+
+	remote := filepath.Join(td, "tap.git")
+	if _, err := execGo("git", nil, "", "init", "--bare", remote); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(td, "app.rb")
+	if err := ioutil.WriteFile(path, []byte("class App < Formula\nend\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	repo := &RepoConfig{Repository: remote}
+	for i, expected := range []bool{true, false} {
+		pushed, err := PushToRepo(repo, "Formula", []string{path}, "app 1.0.0")
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if pushed != expected {
+			t.Fatalf("%d: bad: %t", i, pushed)
+		}
+	}
+
+	output, err := execGo("git", nil, "", "--git-dir", remote, "log", "--format=%s", "--name-only")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output != "app 1.0.0\n\nFormula/app.rb\n" {
+		t.Fatalf("bad: %q", output)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// ImageRef is a parsed container image reference, such as
+// "ghcr.io/mitchellh/gox:1.0".
+type ImageRef struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseImageRef parses a reference in the same way docker does: a first
+// path component that contains a "." or ":" (or is "localhost") is the
+// registry, otherwise the image is on Docker Hub.
+func ParseImageRef(v string) (ImageRef, error) {
+	ref := ImageRef{Tag: "latest"}
+	if v == "" {
+		return ref, fmt.Errorf("empty image reference")
+	}
+
+	if idx := strings.LastIndex(v, ":"); idx > strings.LastIndex(v, "/") {
+		ref.Tag = v[idx+1:]
+		v = v[:idx]
+	}
+
+	parts := strings.SplitN(v, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = "registry-1.docker.io"
+		ref.Repository = v
+		if len(parts) == 1 {
+			ref.Repository = "library/" + v
+		}
+	}
+
+	if ref.Repository == "" || ref.Tag == "" {
+		return ref, fmt.Errorf("invalid image reference: %s", v)
+	}
+
+	return ref, nil
+}
+
+func (r ImageRef) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// Descriptor is an OCI content descriptor.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ImagePlatform    `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ImagePlatform is the platform of an image in an index.
+type ImagePlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest is an OCI image manifest or index. Only the fields gox needs
+// are modeled.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        *Descriptor       `json:"config,omitempty"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// RegistryAuth holds the credentials used to talk to a registry.
+type RegistryAuth struct {
+	Username string
+	Password string
+}
+
+// RegistryClient is a minimal client for the OCI distribution API,
+// enough to pull base images and push new ones.
+type RegistryClient struct {
+	Registry string
+	Auth     RegistryAuth
+	Insecure bool
+
+	client *http.Client
+	token  string
+}
+
+// NewRegistryClient returns a client for the given registry host.
+func NewRegistryClient(registry string, auth RegistryAuth, insecure bool) *RegistryClient {
+	return &RegistryClient{
+		Registry: registry,
+		Auth:     auth,
+		Insecure: insecure,
+		client:   &http.Client{},
+	}
+}
+
+// RegistryAuthFor determines the credentials for a registry. Explicit
+// credentials from the GOX_REGISTRY_USERNAME and GOX_REGISTRY_PASSWORD
+// environment variables are used first, then the docker config file: the
+// "auths" section, then the credential helper of the registry in
+// "credHelpers" or the "credsStore" of every registry. The .netrc file
+// comes last.
+func RegistryAuthFor(registry string) RegistryAuth {
+	auth := RegistryAuth{
+		Username: getenvSecret("GOX_REGISTRY_USERNAME"),
+		Password: getenvSecret("GOX_REGISTRY_PASSWORD"),
+	}
+	if auth.Username != "" {
+		return auth
+	}
+	if a, ok := dockerAuthFor(registry); ok {
+		return a
+	}
+	if login, password, ok := netrcLogin(registry); ok {
+		return RegistryAuth{Username: login, Password: password}
+	}
+
+	return auth
+}
+
+// dockerAuthFor returns the credentials of the registry in the docker
+// config file.
+func dockerAuthFor(registry string) (RegistryAuth, bool) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return RegistryAuth{}, false
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return RegistryAuth{}, false
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredHelpers map[string]string `json:"credHelpers"`
+		CredsStore  string            `json:"credsStore"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return RegistryAuth{}, false
+	}
+
+	keys := []string{registry, "https://" + registry}
+	if registry == "registry-1.docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "docker.io")
+	}
+	for _, k := range keys {
+		entry, ok := config.Auths[k]
+		if !ok || entry.Auth == "" {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		parts := strings.SplitN(string(raw), ":", 2)
+		if len(parts) == 2 {
+			return RegistryAuth{Username: parts[0], Password: parts[1]}, true
+		}
+	}
+
+	// Docker keeps the credentials of Docker Hub under its old URL
+	serverURL := registry
+	if registry == "registry-1.docker.io" {
+		serverURL = "https://index.docker.io/v1/"
+	}
+	helper := config.CredsStore
+	for _, k := range keys {
+		if h, ok := config.CredHelpers[k]; ok {
+			helper = h
+			break
+		}
+	}
+	if helper == "" {
+		return RegistryAuth{}, false
+	}
+	return dockerCredentialHelper(helper, serverURL)
+}
+
+func (c *RegistryClient) url(repo string, suffix string) string {
+	scheme := "https"
+	if c.Insecure {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, c.Registry, repo, suffix)
+}
+
+// do performs the request, authenticating and retrying once if the
+// registry challenges us. body must be re-readable, so it is a byte slice.
+func (c *RegistryClient) do(method, u string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, u, r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.Auth.Username != "" {
+			req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authenticate handles a WWW-Authenticate challenge. Basic challenges are
+// answered by the basic auth header we already send, bearer challenges
+// require fetching a token from the realm.
+func (c *RegistryClient) authenticate(challenge string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		if c.Auth.Username == "" {
+			return fmt.Errorf("registry %s requires authentication", c.Registry)
+		}
+		return nil
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("registry %s sent a bearer challenge without a realm", c.Registry)
+	}
+
+	q := url.Values{}
+	if v := params["service"]; v != "" {
+		q.Set("service", v)
+	}
+	if v := params["scope"]; v != "" {
+		q.Set("scope", v)
+	}
+	req, err := http.NewRequest("GET", realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.Auth.Username != "" {
+		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching registry token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+
+	return nil
+}
+
+// GetManifest fetches a manifest or index by tag or digest.
+func (c *RegistryClient) GetManifest(repo, ref string) (*Manifest, []byte, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join([]string{
+		mediaTypeOCIIndex, mediaTypeOCIManifest,
+		mediaTypeDockerList, mediaTypeDockerManifest,
+	}, ", "))
+	resp, err := c.do("GET", c.url(repo, "manifests/"+ref), header, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("error fetching manifest %s:%s: %s", repo, ref, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, err
+	}
+	if m.MediaType == "" {
+		m.MediaType = resp.Header.Get("Content-Type")
+	}
+
+	return &m, data, nil
+}
+
+// GetBlob fetches a blob by digest.
+func (c *RegistryClient) GetBlob(repo, digest string) ([]byte, error) {
+	resp, err := c.do("GET", c.url(repo, "blobs/"+digest), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching blob %s: %s", digest, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// PutBlob uploads a blob unless the registry already has it.
+func (c *RegistryClient) PutBlob(repo string, data []byte) (string, error) {
+	digest := sha256Digest(data)
+
+	resp, err := c.do("HEAD", c.url(repo, "blobs/"+digest), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return digest, nil
+	}
+
+	resp, err = c.do("POST", c.url(repo, "blobs/uploads/"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("error starting blob upload: %s", resp.Status)
+	}
+
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err = c.do("PUT", loc.String(), header, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("error uploading blob %s: %s", digest, resp.Status)
+	}
+
+	return digest, nil
+}
+
+// PutManifest uploads a manifest or index under the given tag or digest.
+func (c *RegistryClient) PutManifest(repo, ref, mediaType string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	resp, err := c.do("PUT", c.url(repo, "manifests/"+ref), header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("error uploading manifest %s: %s\n%s", ref, resp.Status, msg)
+	}
+
+	return nil
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
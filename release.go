@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ReleaseConfig is the "release" section of the config file. With
+// -publish it creates the release of the version on a forge, GitHub,
+// GitLab, or a Gitea or Forgejo instance, and attaches the artifacts to
+// it. The tag of the release must have been pushed.
+type ReleaseConfig struct {
+	// Forge is "github", "gitlab", "gitea" or "forgejo".
+	Forge string `json:"forge"`
+
+	// URL is the address of a self-hosted instance, such as
+	// "https://gitea.example.com", and is required for Gitea and
+	// Forgejo. It defaults to https://github.com and https://gitlab.com.
+	URL string `json:"url,omitempty"`
+
+	// Repository is the "owner/name" of the repository. On GitLab it is
+	// the path of the project, which can be in subgroups.
+	Repository string `json:"repository"`
+
+	// TokenEnv is the environment variable with the access token,
+	// defaults to GITHUB_TOKEN, GITLAB_TOKEN or GITEA_TOKEN. On GitLab
+	// the CI_JOB_TOKEN of a pipeline is used when it isn't set.
+	TokenEnv string `json:"token_env,omitempty"`
+
+	// Tag and Name are templates with {{.Version}}. Tag defaults to
+	// "v{{.Version}}" and Name to the tag.
+	Tag  string `json:"tag,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Draft and Prerelease mark the release as such on GitHub, Gitea and
+	// Forgejo.
+	Draft      bool `json:"draft,omitempty"`
+	Prerelease bool `json:"prerelease,omitempty"`
+
+	// Package is the generic package that GitLab assets are uploaded to
+	// and linked from, defaults to the name of the repository.
+	Package string `json:"package,omitempty"`
+
+	// Kinds are the kinds of artifacts in the manifest to attach, as in
+	// UploadConfig.
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// forgeRelease is a release that assets are attached to.
+type forgeRelease struct {
+	ID        int64
+	Tag       string
+	URL       string
+	UploadURL string
+
+	// Assets are the assets that the release already had, by name.
+	Assets map[string]forgeAsset
+
+	// packageSums are the SHA-256 of the files of the generic package of
+	// GitLab, by name, once Uploaded has read them.
+	packageSums map[string]string
+	lock        sync.Mutex
+}
+
+// forgeAsset is an asset of a release. GitHub has the Digest of assets,
+// "sha256:" and their SHA-256, and Gitea and Forgejo only their Size.
+// GitLab has neither, only the URL that its links point to, and the
+// SHA-256 of the files of its packages.
+type forgeAsset struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+	URL    string `json:"url"`
+}
+
+// releaseJSON is a release as the API of the forge returns it.
+type releaseJSON struct {
+	ID        int64  `json:"id"`
+	HTMLURL   string `json:"html_url"`
+	UploadURL string `json:"upload_url"`
+	Links     struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+	Assets json.RawMessage `json:"assets"`
+}
+
+// Validate checks the forge, its url and the repository, and parses the
+// tag and name templates.
+func (c *ReleaseConfig) Validate() error {
+	switch c.Forge {
+	case "github", "gitlab":
+	case "gitea", "forgejo":
+		if c.URL == "" {
+			return fmt.Errorf("release: url is required for %s", c.Forge)
+		}
+	case "":
+		return fmt.Errorf("release: forge is required")
+	default:
+		return fmt.Errorf("release: unknown forge %q, must be github, gitlab, gitea or forgejo", c.Forge)
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || u.Host == "" {
+			return fmt.Errorf("release: url must be an absolute URL, not %q", c.URL)
+		}
+	}
+	if parts := strings.Split(c.Repository, "/"); len(parts) < 2 || c.Forge != "gitlab" && len(parts) != 2 {
+		return fmt.Errorf("release: repository must be owner/name, not %q", c.Repository)
+	}
+	for _, tpl := range []string{c.Tag, c.Name} {
+		if _, err := template.New("release").Parse(tpl); err != nil {
+			return fmt.Errorf("release: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Artifacts returns the artifacts of m that are attached to the release,
+// with their paths.
+func (c *ReleaseConfig) Artifacts(m *ArtifactManifest) ([]Artifact, []string) {
+	return selectArtifacts(m, c.Kinds)
+}
+
+// apiURL returns the base URL of the REST API of the forge.
+func (c *ReleaseConfig) apiURL() string {
+	base := strings.TrimSuffix(c.URL, "/")
+	switch c.Forge {
+	case "github":
+		if base == "" || base == "https://github.com" {
+			return "https://api.github.com"
+		}
+		// GitHub Enterprise Server
+		return base + "/api/v3"
+	case "gitlab":
+		if base == "" {
+			base = "https://gitlab.com"
+		}
+		return base + "/api/v4"
+	default:
+		return base + "/api/v1"
+	}
+}
+
+// repoURL returns the API URL of the repository, followed by parts.
+func (c *ReleaseConfig) repoURL(parts ...string) string {
+	if c.Forge == "gitlab" {
+		parts = append([]string{"projects", url.PathEscape(c.Repository)}, parts...)
+	} else {
+		parts = append([]string{"repos", c.Repository}, parts...)
+	}
+	return c.apiURL() + "/" + strings.Join(parts, "/")
+}
+
+// tag executes the Tag and Name templates with version.
+func (c *ReleaseConfig) tag(version string) (string, string, error) {
+	var values [2]string
+	for i, tpl := range []string{c.Tag, c.Name} {
+		if tpl == "" {
+			tpl = "v{{.Version}}"
+			if i == 1 {
+				tpl = values[0]
+			}
+		}
+		t, err := template.New("release").Parse(tpl)
+		if err != nil {
+			return "", "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, map[string]string{"Version": version}); err != nil {
+			return "", "", err
+		}
+		values[i] = buf.String()
+	}
+	return values[0], values[1], nil
+}
+
+// header sets the authentication of the forge on req. Without a token in
+// the environment (or the CI_JOB_TOKEN of GitLab), the one that gh or
+// glab logged in with, or the password of the host in .netrc, is used.
+func (c *ReleaseConfig) header(req *http.Request) {
+	env := c.TokenEnv
+	if env == "" {
+		env = map[string]string{
+			"github":  "GITHUB_TOKEN",
+			"gitlab":  "GITLAB_TOKEN",
+			"gitea":   "GITEA_TOKEN",
+			"forgejo": "GITEA_TOKEN",
+		}[c.Forge]
+	}
+	token := getenvSecret(env)
+	jobToken := c.Forge == "gitlab" && token == "" && c.TokenEnv == "" && os.Getenv("CI_JOB_TOKEN") != ""
+	if token == "" && !jobToken {
+		host := urlHost(c.URL)
+		if host == "" {
+			host = c.Forge + ".com"
+		}
+		token = storedForgeToken(c.Forge, host, urlHost(c.apiURL()))
+	}
+
+	switch c.Forge {
+	case "github":
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	case "gitlab":
+		if jobToken {
+			req.Header.Set("JOB-TOKEN", os.Getenv("CI_JOB_TOKEN"))
+		} else {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		}
+	default:
+		req.Header.Set("Authorization", "token "+token)
+	}
+}
+
+// request makes a request to the API of the forge and decodes the JSON
+// response into out, if it isn't nil.
+func (c *ReleaseConfig) request(method, u, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	return c.do(req, contentType, out)
+}
+
+// upload is a request with a body of size bytes, which it streams at most
+// as fast as -bandwidth-limit, as GitHub needs the Content-Length of
+// uploads. The JSON response is decoded into out, if it isn't nil.
+func (c *ReleaseConfig) upload(method, u, contentType string, body io.Reader, size int64, out interface{}) error {
+	req, err := http.NewRequest(method, u, limitUpload(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	return c.do(req, contentType, out)
+}
+
+func (c *ReleaseConfig) do(req *http.Request, contentType string, out interface{}) error {
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.header(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &httpStatusError{resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *ReleaseConfig) requestJSON(method, u string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.request(method, u, "application/json", bytes.NewReader(data), out)
+}
+
+// CreateRelease creates the release of version with the notes as its
+// body, or returns the one of its tag that already exists, with its
+// assets, so that a failed publish can be run again.
+func (c *ReleaseConfig) CreateRelease(version, notes string) (*forgeRelease, error) {
+	tag, name, err := c.tag(version)
+	if err != nil {
+		return nil, err
+	}
+
+	var release releaseJSON
+	err = c.request("GET", c.releaseURL(tag), "", nil, &release)
+	if se, ok := err.(*httpStatusError); ok && se.Code == http.StatusNotFound {
+		var in interface{} = map[string]interface{}{
+			"tag_name":   tag,
+			"name":       name,
+			"body":       notes,
+			"draft":      c.Draft,
+			"prerelease": c.Prerelease,
+		}
+		if c.Forge == "gitlab" {
+			in = map[string]string{"tag_name": tag, "name": name, "description": notes}
+		}
+		err = c.requestJSON("POST", c.repoURL("releases"), in, &release)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.newRelease(tag, &release)
+}
+
+// FindRelease returns the release of tag, with its assets.
+func (c *ReleaseConfig) FindRelease(tag string) (*forgeRelease, error) {
+	var release releaseJSON
+	if err := c.request("GET", c.releaseURL(tag), "", nil, &release); err != nil {
+		return nil, err
+	}
+	return c.newRelease(tag, &release)
+}
+
+// releaseURL returns the API URL of the release of tag.
+func (c *ReleaseConfig) releaseURL(tag string) string {
+	if c.Forge == "gitlab" {
+		return c.repoURL("releases", url.PathEscape(tag))
+	}
+	return c.repoURL("releases", "tags", url.PathEscape(tag))
+}
+
+func (c *ReleaseConfig) newRelease(tag string, release *releaseJSON) (*forgeRelease, error) {
+	r := &forgeRelease{ID: release.ID, Tag: tag, URL: release.HTMLURL, UploadURL: release.UploadURL}
+	if c.Forge == "gitlab" {
+		r.URL = release.Links.Self
+	}
+	var err error
+	if r.Assets, err = c.assets(release.Assets); err != nil {
+		return nil, err
+	}
+	// The upload_url of GitHub is a URI template: .../assets{?name,label}
+	if i := strings.Index(r.UploadURL, "{"); i >= 0 {
+		r.UploadURL = r.UploadURL[:i]
+	}
+	return r, nil
+}
+
+// AssetSizes returns the size of each asset of r, by name. The links of
+// GitLab have no size, so their URLs are asked for it.
+func (c *ReleaseConfig) AssetSizes(r *forgeRelease) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(r.Assets))
+	for name, a := range r.Assets {
+		if c.Forge == "gitlab" && a.URL != "" {
+			req, err := http.NewRequest("HEAD", a.URL, nil)
+			if err != nil {
+				return nil, err
+			}
+			c.header(req)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				return nil, fmt.Errorf("%s: %s", a.URL, resp.Status)
+			}
+			a.Size = resp.ContentLength
+		}
+		sizes[name] = a.Size
+	}
+	return sizes, nil
+}
+
+// version returns the version that the Tag template made tag of, or tag
+// itself if it doesn't fit the template.
+func (c *ReleaseConfig) version(tag string) string {
+	const placeholder = "\x00"
+	t, _, err := c.tag(placeholder)
+	if i := strings.Index(t, placeholder); err == nil && i >= 0 {
+		prefix, suffix := t[:i], t[i+len(placeholder):]
+		if len(tag) > len(prefix)+len(suffix) && strings.HasPrefix(tag, prefix) && strings.HasSuffix(tag, suffix) {
+			return tag[len(prefix) : len(tag)-len(suffix)]
+		}
+	}
+	return tag
+}
+
+// assets decodes the assets of a release, which GitLab has as the links
+// of an object rather than a list.
+func (c *ReleaseConfig) assets(data json.RawMessage) (map[string]forgeAsset, error) {
+	var assets []forgeAsset
+	if len(data) > 0 && string(data) != "null" {
+		var err error
+		if c.Forge == "gitlab" {
+			var gitlab struct {
+				Links []forgeAsset `json:"links"`
+			}
+			err = json.Unmarshal(data, &gitlab)
+			assets = gitlab.Links
+		} else {
+			err = json.Unmarshal(data, &assets)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding the assets of the release: %s", err)
+		}
+	}
+
+	result := make(map[string]forgeAsset, len(assets))
+	for _, a := range assets {
+		result[a.Name] = a
+	}
+	return result, nil
+}
+
+// Uploaded reports whether file is already attached to the release r of
+// version, as it is when a publish that failed part way is run again.
+// GitHub assets must have the SHA-256 of the file, and those of Gitea and
+// Forgejo its size. GitLab links have neither, so the file of the generic
+// package of the version that they go to must have its SHA-256.
+func (c *ReleaseConfig) Uploaded(r *forgeRelease, file, version string) (bool, error) {
+	a, ok := r.Assets[filepath.Base(file)]
+	switch {
+	case !ok:
+		return false, nil
+	case c.Forge == "gitlab":
+		sums, err := c.packageSums(r, version)
+		if err != nil {
+			return false, err
+		}
+		sum, err := fileSHA256(file)
+		if err != nil {
+			return false, err
+		}
+		return sums[filepath.Base(file)] == sum, nil
+	case a.Digest != "":
+		sum, err := fileSHA256(file)
+		if err != nil {
+			return false, err
+		}
+		return a.Digest == "sha256:"+sum, nil
+	default:
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		return info.Size() == a.Size, nil
+	}
+}
+
+// packageSums returns the SHA-256 of the files of the generic package of
+// version on GitLab, by name, reading them the first time. A file that was
+// uploaded more than once is downloaded as the last one.
+func (c *ReleaseConfig) packageSums(r *forgeRelease, version string) (map[string]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.packageSums != nil {
+		return r.packageSums, nil
+	}
+
+	var packages []struct {
+		ID      int64  `json:"id"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	u := c.repoURL("packages") + "?package_type=generic&package_name=" + url.QueryEscape(c.packageName()) +
+		"&package_version=" + url.QueryEscape(version)
+	if err := c.request("GET", u, "", nil, &packages); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	for _, p := range packages {
+		// package_name matches part of the name
+		if p.Name != c.packageName() || p.Version != version {
+			continue
+		}
+		for page := 1; ; page++ {
+			var files []struct {
+				FileName string `json:"file_name"`
+				SHA256   string `json:"file_sha256"`
+			}
+			u := c.repoURL("packages", fmt.Sprint(p.ID), "package_files") + fmt.Sprintf("?per_page=100&page=%d", page)
+			if err := c.request("GET", u, "", nil, &files); err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				sums[f.FileName] = f.SHA256
+			}
+			if len(files) < 100 {
+				break
+			}
+		}
+	}
+	r.packageSums = sums
+	return sums, nil
+}
+
+// packageName returns the name of the generic package of GitLab.
+func (c *ReleaseConfig) packageName() string {
+	if c.Package == "" {
+		return path.Base(c.Repository)
+	}
+	return c.Package
+}
+
+// UploadAsset attaches file to the release r, replacing an asset of the
+// same name that it had. On GitHub and Gitea a replacement is uploaded
+// under a temporary name first, and only takes over the name once the
+// old asset is deleted, so that a failed upload leaves the old one in
+// place. On GitLab it is uploaded to the generic package of the version
+// and linked from the release.
+func (c *ReleaseConfig) UploadAsset(r *forgeRelease, file, version string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file)
+	existing, replace := r.Assets[name]
+
+	if c.Forge == "gitlab" {
+		u := c.repoURL("packages", "generic", url.PathEscape(c.packageName()), url.PathEscape(version), url.PathEscape(name))
+		if err := c.upload("PUT", u, "application/octet-stream", f, info.Size(), nil); err != nil {
+			return err
+		}
+		if replace {
+			// The link already goes to the package file
+			return nil
+		}
+		return c.requestJSON("POST", c.repoURL("releases", url.PathEscape(r.Tag), "assets", "links"),
+			map[string]string{"name": name, "url": u, "link_type": "package"}, nil)
+	}
+
+	uploadName := name
+	if replace {
+		uploadName = name + ".new"
+		// A failed run can have left one behind
+		if stale, ok := r.Assets[uploadName]; ok {
+			if err := c.request("DELETE", c.assetURL(r, stale.ID), "", nil, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	var asset forgeAsset
+	if c.Forge == "github" {
+		err = c.upload("POST", r.UploadURL+"?name="+url.QueryEscape(uploadName), "application/octet-stream", f, info.Size(), &asset)
+	} else {
+		// The form is streamed as the header of the file part, the file,
+		// and the closing boundary
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		if _, err := w.CreateFormFile("attachment", uploadName); err != nil {
+			return err
+		}
+		head := append([]byte(nil), buf.Bytes()...)
+		buf.Reset()
+		if err := w.Close(); err != nil {
+			return err
+		}
+		size := int64(len(head)) + info.Size() + int64(buf.Len())
+
+		u := c.repoURL("releases", fmt.Sprint(r.ID), "assets") + "?name=" + url.QueryEscape(uploadName)
+		err = c.upload("POST", u, w.FormDataContentType(), io.MultiReader(bytes.NewReader(head), f, &buf), size, &asset)
+	}
+	if err != nil || !replace {
+		return err
+	}
+
+	if err := c.request("DELETE", c.assetURL(r, existing.ID), "", nil, nil); err != nil {
+		return err
+	}
+	return c.requestJSON("PATCH", c.assetURL(r, asset.ID), map[string]string{"name": name}, nil)
+}
+
+// assetURL returns the API URL of the asset id of r on GitHub or Gitea.
+func (c *ReleaseConfig) assetURL(r *forgeRelease, id int64) string {
+	if c.Forge == "github" {
+		return c.repoURL("releases", "assets", fmt.Sprint(id))
+	}
+	return c.repoURL("releases", fmt.Sprint(r.ID), "assets", fmt.Sprint(id))
+}
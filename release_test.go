@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReleaseConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config ReleaseConfig
+		Err    bool
+	}{
+		{ReleaseConfig{Forge: "github", Repository: "example/app"}, false},
+		{ReleaseConfig{Forge: "gitlab", Repository: "group/sub/app"}, false},
+		{ReleaseConfig{Forge: "github", Repository: "group/sub/app"}, true},
+		{ReleaseConfig{Forge: "gitea", Repository: "example/app"}, true},
+		{ReleaseConfig{Forge: "forgejo", URL: "https://codeberg.org", Repository: "example/app"}, false},
+		{ReleaseConfig{Forge: "gitea", URL: "gitea.example.com", Repository: "example/app"}, true},
+		{ReleaseConfig{Forge: "bitbucket", Repository: "example/app"}, true},
+		{ReleaseConfig{Repository: "example/app"}, true},
+		{ReleaseConfig{Forge: "github", Repository: "app"}, true},
+		{ReleaseConfig{Forge: "github", Repository: "example/app", Tag: "{{.Version"}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Config.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestReleaseConfigTag(t *testing.T) {
+	c := &ReleaseConfig{}
+	tag, name, err := c.tag("1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tag != "v1.2.3" || name != "v1.2.3" {
+		t.Fatalf("bad: %s %s", tag, name)
+	}
+
+	c = &ReleaseConfig{Tag: "app-{{.Version}}", Name: "App {{.Version}}"}
+	if tag, name, _ := c.tag("1.2.3"); tag != "app-1.2.3" || name != "App 1.2.3" {
+		t.Fatalf("bad: %s %s", tag, name)
+	}
+}
+
+// testForge records the requests of a release and returns what the API
+// of the forge would.
+func testForge(t *testing.T, requests *[]string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body string
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			f, header, err := r.FormFile("attachment")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			data, _ := ioutil.ReadAll(f)
+			body = header.Filename + "=" + string(data)
+		} else {
+			data, _ := ioutil.ReadAll(r.Body)
+			body = string(data)
+		}
+		auth := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		*requests = append(*requests, fmt.Sprintf("%s %s %s %s", r.Method, r.URL.RequestURI(), auth, body))
+
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         7,
+			"html_url":   "https://example.com/releases/v1.0.0",
+			"upload_url": server.URL + "/uploads/7/assets{?name,label}",
+			"_links":     map[string]string{"self": "https://gitlab.example.com/releases/v1.0.0"},
+		})
+	}))
+	return server
+}
+
+func TestReleaseConfigPublish(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "app.zip")
+	ioutil.WriteFile(path, []byte("zip"), 0644)
+
+	defer os.Setenv("GOX_TEST_TOKEN", os.Getenv("GOX_TEST_TOKEN"))
+	os.Setenv("GOX_TEST_TOKEN", "secret")
+
+	cases := []struct {
+		Forge    string
+		URL      string
+		Requests []string
+	}{
+		{
+			"github",
+			"https://example.com/releases/v1.0.0",
+			[]string{
+				"GET /api/v3/repos/example/app/releases/tags/v1.0.0 Bearer secret ",
+				`POST /api/v3/repos/example/app/releases Bearer secret {"body":"Fixes","draft":false,"name":"v1.0.0","prerelease":false,"tag_name":"v1.0.0"}`,
+				"POST /uploads/7/assets?name=app.zip Bearer secret zip",
+			},
+		},
+		{
+			"gitlab",
+			"https://gitlab.example.com/releases/v1.0.0",
+			[]string{
+				"GET /api/v4/projects/example%2Fapp/releases/v1.0.0 secret ",
+				`POST /api/v4/projects/example%2Fapp/releases secret {"description":"Fixes","name":"v1.0.0","tag_name":"v1.0.0"}`,
+				"PUT /api/v4/projects/example%2Fapp/packages/generic/app/1.0.0/app.zip secret zip",
+				"POST /api/v4/projects/example%2Fapp/releases/v1.0.0/assets/links secret " +
+					`{"link_type":"package","name":"app.zip","url":"URL/api/v4/projects/example%2Fapp/packages/generic/app/1.0.0/app.zip"}`,
+			},
+		},
+		{
+			"gitea",
+			"https://example.com/releases/v1.0.0",
+			[]string{
+				"GET /api/v1/repos/example/app/releases/tags/v1.0.0 token secret ",
+				`POST /api/v1/repos/example/app/releases token secret {"body":"Fixes","draft":false,"name":"v1.0.0","prerelease":false,"tag_name":"v1.0.0"}`,
+				"POST /api/v1/repos/example/app/releases/7/assets?name=app.zip token secret app.zip=zip",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var requests []string
+		server := testForge(t, &requests)
+
+		c := &ReleaseConfig{Forge: tc.Forge, URL: server.URL, Repository: "example/app", TokenEnv: "GOX_TEST_TOKEN"}
+		release, err := c.CreateRelease("1.0.0", "Fixes")
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Forge, err)
+		}
+		if err := c.UploadAsset(release, path, "1.0.0"); err != nil {
+			t.Fatalf("%s: err: %s", tc.Forge, err)
+		}
+		server.Close()
+
+		for i := range tc.Requests {
+			tc.Requests[i] = strings.Replace(tc.Requests[i], "URL", server.URL, 1)
+		}
+		if release.URL != tc.URL || strings.Join(requests, "\n") != strings.Join(tc.Requests, "\n") {
+			t.Fatalf("%s: bad: %s\n%s", tc.Forge, release.URL, strings.Join(requests, "\n"))
+		}
+	}
+}
+
+func TestReleaseConfigUploaded(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	var paths []string
+	for _, name := range []string{"same.zip", "changed.zip", "new.zip"} {
+		path := filepath.Join(td, name)
+		ioutil.WriteFile(path, []byte(name), 0644)
+		paths = append(paths, path)
+	}
+	sum, _ := fileSHA256(paths[0])
+
+	cases := []struct {
+		Forge    string
+		Assets   interface{}
+		Requests []string
+	}{
+		{
+			"github",
+			[]map[string]interface{}{
+				{"id": 1, "name": "same.zip", "size": 8, "digest": "sha256:" + sum},
+				{"id": 2, "name": "changed.zip", "size": 11, "digest": "sha256:0000"},
+				{"id": 3, "name": "changed.zip.new", "size": 4},
+			},
+			[]string{
+				"GET /api/v3/repos/example/app/releases/tags/v1.0.0 Bearer secret ",
+				"DELETE /api/v3/repos/example/app/releases/assets/3 Bearer secret ",
+				"POST /uploads/7/assets?name=changed.zip.new Bearer secret changed.zip",
+				"DELETE /api/v3/repos/example/app/releases/assets/2 Bearer secret ",
+				`PATCH /api/v3/repos/example/app/releases/assets/7 Bearer secret {"name":"changed.zip"}`,
+				"POST /uploads/7/assets?name=new.zip Bearer secret new.zip",
+			},
+		},
+		{
+			"gitea",
+			[]map[string]interface{}{
+				{"id": 1, "name": "same.zip", "size": 8},
+				{"id": 2, "name": "changed.zip", "size": 3},
+			},
+			[]string{
+				"GET /api/v1/repos/example/app/releases/tags/v1.0.0 token secret ",
+				"POST /api/v1/repos/example/app/releases/7/assets?name=changed.zip.new token secret changed.zip.new=changed.zip",
+				"DELETE /api/v1/repos/example/app/releases/7/assets/2 token secret ",
+				`PATCH /api/v1/repos/example/app/releases/7/assets/7 token secret {"name":"changed.zip"}`,
+				"POST /api/v1/repos/example/app/releases/7/assets?name=new.zip token secret new.zip=new.zip",
+			},
+		},
+		{
+			"gitlab",
+			map[string]interface{}{"links": []map[string]interface{}{
+				{"id": 1, "name": "same.zip"},
+				{"id": 2, "name": "changed.zip"},
+			}},
+			[]string{
+				"GET /api/v4/projects/example%2Fapp/releases/v1.0.0 secret ",
+				"GET /api/v4/projects/example%2Fapp/packages?package_type=generic&package_name=app&package_version=1.0.0 secret ",
+				"GET /api/v4/projects/example%2Fapp/packages/3/package_files?per_page=100&page=1 secret ",
+				"PUT /api/v4/projects/example%2Fapp/packages/generic/app/1.0.0/changed.zip secret changed.zip",
+				"PUT /api/v4/projects/example%2Fapp/packages/generic/app/1.0.0/new.zip secret new.zip",
+				"POST /api/v4/projects/example%2Fapp/releases/v1.0.0/assets/links secret " +
+					`{"link_type":"package","name":"new.zip","url":"URL/api/v4/projects/example%2Fapp/packages/generic/app/1.0.0/new.zip"}`,
+			},
+		},
+	}
+
+	defer os.Setenv("GOX_TEST_TOKEN", os.Getenv("GOX_TEST_TOKEN"))
+	os.Setenv("GOX_TEST_TOKEN", "secret")
+	for _, tc := range cases {
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body string
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+				f, header, err := r.FormFile("attachment")
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				data, _ := ioutil.ReadAll(f)
+				body = header.Filename + "=" + string(data)
+			} else {
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+			}
+			auth := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+			requests = append(requests, fmt.Sprintf("%s %s %s %s", r.Method, r.URL.RequestURI(), auth, body))
+
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/packages"):
+				// Of the packages whose names have app in them, only app
+				// has the files
+				json.NewEncoder(w).Encode([]map[string]interface{}{
+					{"id": 2, "name": "app-docs", "version": "1.0.0"},
+					{"id": 3, "name": "app", "version": "1.0.0"},
+				})
+			case strings.HasSuffix(r.URL.Path, "/package_files"):
+				json.NewEncoder(w).Encode([]map[string]interface{}{
+					{"file_name": "same.zip", "file_sha256": "0000"},
+					{"file_name": "changed.zip", "file_sha256": "0000"},
+					{"file_name": "same.zip", "file_sha256": sum},
+				})
+			default:
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"id":         7,
+					"upload_url": "http://" + r.Host + "/uploads/7/assets{?name,label}",
+					"assets":     tc.Assets,
+				})
+			}
+		}))
+
+		c := &ReleaseConfig{Forge: tc.Forge, URL: server.URL, Repository: "example/app", TokenEnv: "GOX_TEST_TOKEN"}
+		release, err := c.CreateRelease("1.0.0", "Fixes")
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Forge, err)
+		}
+		for i, path := range paths {
+			uploaded, err := c.Uploaded(release, path, "1.0.0")
+			if err != nil {
+				t.Fatalf("%s: err: %s", tc.Forge, err)
+			}
+			if uploaded != (i == 0) {
+				t.Fatalf("%s: bad: %s: %t", tc.Forge, path, uploaded)
+			}
+			if !uploaded {
+				if err := c.UploadAsset(release, path, "1.0.0"); err != nil {
+					t.Fatalf("%s: err: %s", tc.Forge, err)
+				}
+			}
+		}
+		server.Close()
+
+		for i := range tc.Requests {
+			tc.Requests[i] = strings.Replace(tc.Requests[i], "URL", server.URL, 1)
+		}
+		if strings.Join(requests, "\n") != strings.Join(tc.Requests, "\n") {
+			t.Fatalf("%s: bad:\n%s", tc.Forge, strings.Join(requests, "\n"))
+		}
+	}
+}
+
+func TestReleaseConfigVersion(t *testing.T) {
+	cases := []struct {
+		Tag      string
+		Template string
+		Version  string
+	}{
+		{"v1.2.0", "", "1.2.0"},
+		{"app-1.2.0", "app-{{.Version}}", "1.2.0"},
+		{"1.2.0", "", "1.2.0"},
+		{"v", "", "v"},
+	}
+	for _, tc := range cases {
+		c := &ReleaseConfig{Tag: tc.Template}
+		if actual := c.version(tc.Tag); actual != tc.Version {
+			t.Fatalf("%s: bad: %s", tc.Tag, actual)
+		}
+	}
+}
+
+func TestReleaseConfigAssetSizes(t *testing.T) {
+	defer os.Setenv("GOX_TEST_TOKEN", os.Getenv("GOX_TEST_TOKEN"))
+	os.Setenv("GOX_TEST_TOKEN", "secret")
+
+	for _, forge := range []string{"github", "gitlab"} {
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+			requests = append(requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.RequestURI(), auth))
+			if r.Method == "HEAD" {
+				w.Header().Set("Content-Length", "2048")
+				return
+			}
+
+			var assets interface{} = []map[string]interface{}{{"id": 1, "name": "app_1.0.0_linux_amd64.tar.gz", "size": 1024}}
+			if forge == "gitlab" {
+				assets = map[string]interface{}{"links": []map[string]interface{}{
+					{"id": 1, "name": "app_1.0.0_linux_amd64.tar.gz", "url": "http://" + r.Host + "/files/app.tar.gz"},
+				}}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": 7, "assets": assets})
+		}))
+
+		c := &ReleaseConfig{Forge: forge, URL: server.URL, Repository: "example/app", TokenEnv: "GOX_TEST_TOKEN"}
+		release, err := c.FindRelease("v1.0.0")
+		if err != nil {
+			t.Fatalf("%s: err: %s", forge, err)
+		}
+		sizes, err := c.AssetSizes(release)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: err: %s", forge, err)
+		}
+
+		expected := map[string]int64{"github": 1024, "gitlab": 2048}[forge]
+		if len(sizes) != 1 || sizes["app_1.0.0_linux_amd64.tar.gz"] != expected {
+			t.Fatalf("%s: bad: %#v", forge, sizes)
+		}
+		if forge == "gitlab" && requests[1] != "HEAD /files/app.tar.gz secret" {
+			t.Fatalf("bad: %#v", requests)
+		}
+	}
+}
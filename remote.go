@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// remoteSourceVar stands for the directory of the source in the paths of
+// remote builds, which each worker replaces with its own.
+const remoteSourceVar = "${GOX_SOURCE}"
+
+// WorkersConfig is the "workers" section of the config file: the remote
+// build workers, started with `gox worker`, that -builder=remote sends
+// the builds of each platform to. It is experimental.
+type WorkersConfig struct {
+	// URLs are the addresses of the workers, such as
+	// "http://build1.example.com:7878". -workers replaces them.
+	URLs []string `json:"urls"`
+
+	// Source is how the source gets to the workers: "tarball", the
+	// default, uploads the files of the current directory, uncommitted
+	// changes and all, and "git" has the workers fetch Repository at the
+	// commit of HEAD, which must have been pushed.
+	Source string `json:"source,omitempty"`
+
+	// Repository is what the workers clone for the "git" source, defaults
+	// to the URL of the origin remote.
+	Repository string `json:"repository,omitempty"`
+
+	// TokenEnv is the environment variable with the token of the workers,
+	// defaults to GOX_WORKER_TOKEN.
+	TokenEnv string `json:"token_env,omitempty"`
+}
+
+// Validate checks that the workers are absolute URLs and the source.
+func (c *WorkersConfig) Validate() error {
+	for _, u := range c.URLs {
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			return fmt.Errorf("workers: url must be an absolute URL, not %q", u)
+		}
+	}
+	switch c.Source {
+	case "", "tarball", "git":
+	default:
+		return fmt.Errorf("workers: unknown source %q, must be tarball or git", c.Source)
+	}
+
+	return nil
+}
+
+func (c *WorkersConfig) token() string {
+	if c.TokenEnv != "" {
+		return getenvSecret(c.TokenEnv)
+	}
+	return getenvSecret("GOX_WORKER_TOKEN")
+}
+
+// remoteBuild is a build that is sent to a worker: Package for Platform,
+// in Dir of the source, which is either the tarball with the SHA-256
+// Source, or Repository at Ref. The worker makes the go command from the
+// rest itself, and only takes the variables of workerEnv from Env, so
+// that a client can't have it run anything but the build.
+type remoteBuild struct {
+	Source     string `json:"source,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	Package    string `json:"package"`
+	Platform   string `json:"platform"`
+
+	Test      bool   `json:"test,omitempty"`
+	Rebuild   bool   `json:"rebuild,omitempty"`
+	Race      bool   `json:"race,omitempty"`
+	Trimpath  bool   `json:"trimpath,omitempty"`
+	Mod       string `json:"mod,omitempty"`
+	BuildMode string `json:"buildmode,omitempty"`
+	PGO       string `json:"pgo,omitempty"`
+	Ldflags   string `json:"ldflags,omitempty"`
+	Gcflags   string `json:"gcflags,omitempty"`
+	Asmflags  string `json:"asmflags,omitempty"`
+	Tags      string `json:"tags,omitempty"`
+
+	Env []string `json:"env,omitempty"`
+}
+
+// newRemoteBuild returns the remote build of pkg for opts, with the env
+// and ldflags that GoCrossCompile worked out. What only exists on this
+// machine, such as -overlay, can't be sent.
+func newRemoteBuild(opts *CompileOpts, env []string, ldflags, pkg string) (*remoteBuild, error) {
+	switch {
+	case opts.Compiler == compilerGccgo:
+		return nil, fmt.Errorf("-builder=remote can't build with -compiler=gccgo")
+	case opts.Garble != "":
+		return nil, fmt.Errorf("-builder=remote can't build with -obfuscate")
+	case opts.Overlay != "":
+		return nil, fmt.Errorf("-builder=remote can't build with -overlay")
+	}
+
+	build := &remoteBuild{
+		Package:   pkg,
+		Platform:  opts.Platform.OS + "/" + opts.Platform.Arch,
+		Test:      opts.Test,
+		Rebuild:   opts.Rebuild,
+		Race:      opts.Race,
+		Trimpath:  opts.Trimpath,
+		Mod:       opts.ModMode,
+		BuildMode: opts.BuildMode,
+		PGO:       opts.PGO,
+		Ldflags:   ldflags,
+		Gcflags:   opts.Gcflags,
+		Asmflags:  opts.Asmflags,
+		Tags:      opts.buildTags(),
+	}
+	for _, kv := range env {
+		if workerEnv[strings.SplitN(kv, "=", 2)[0]] {
+			build.Env = append(build.Env, kv)
+		}
+	}
+	return build, nil
+}
+
+// remoteBuildError is a build that failed on a worker, as opposed to a
+// worker that couldn't be reached, which the build is tried elsewhere for.
+type remoteBuildError struct {
+	Worker string
+	Output string
+}
+
+func (e *remoteBuildError) Error() string {
+	return fmt.Sprintf("build failed on %s:\n%s", e.Worker, e.Output)
+}
+
+// remotePool sends builds to the workers, each to the one with the fewest
+// builds running, and leaves out workers that stop answering.
+type remotePool struct {
+	config *WorkersConfig
+
+	// root is the directory that gox runs in, which the tarball is of.
+	root string
+
+	prepareOnce sync.Once
+	prepareErr  error
+	tarball     string
+	digest      string
+	repository  string
+	ref         string
+	dir         string
+
+	lock     sync.Mutex
+	active   map[string]int
+	down     map[string]bool
+	uploaded map[string]bool
+}
+
+func newRemotePool(config *WorkersConfig) (*remotePool, error) {
+	if len(config.URLs) == 0 {
+		return nil, fmt.Errorf("-builder=remote needs workers, from -workers or the workers section of the config file")
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return &remotePool{
+		config:   config,
+		root:     root,
+		active:   make(map[string]int),
+		down:     make(map[string]bool),
+		uploaded: make(map[string]bool),
+	}, nil
+}
+
+// prepare packs the source into a tarball, or finds the commit that the
+// workers check out, the first time that it is called.
+func (p *remotePool) prepare() error {
+	p.prepareOnce.Do(func() {
+		if p.config.Source == "git" {
+			p.prepareErr = p.prepareGit()
+		} else {
+			p.prepareErr = p.prepareTarball()
+		}
+	})
+	return p.prepareErr
+}
+
+func (p *remotePool) prepareGit() error {
+	p.repository = p.config.Repository
+	if p.repository == "" {
+		output, err := execGo("git", nil, "", "remote", "get-url", "origin")
+		if err != nil {
+			return fmt.Errorf("workers: repository is required without an origin remote")
+		}
+		p.repository = strings.TrimSpace(output)
+	}
+	output, err := execGo("git", nil, "", "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("git rev-parse failed: %s", strings.TrimSpace(err.Error()))
+	}
+	p.ref = strings.TrimSpace(output)
+
+	// The module may be below the top of the repository
+	output, err = execGo("git", nil, "", "rev-parse", "--show-prefix")
+	if err != nil {
+		return fmt.Errorf("git rev-parse failed: %s", strings.TrimSpace(err.Error()))
+	}
+	p.dir = strings.TrimSuffix(strings.TrimSpace(output), "/")
+
+	if status, err := execGo("git", nil, "", "status", "--porcelain", "--untracked-files=no"); err == nil && strings.TrimSpace(status) != "" {
+		ui.Warnf("The workers build %s, which doesn't have the uncommitted changes\n", p.ref)
+	}
+	return nil
+}
+
+func (p *remotePool) prepareTarball() error {
+	files, err := remoteSourceFiles(p.root)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "gox-source")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	p.tarball = f.Name() + ".tar.gz"
+	os.Remove(f.Name())
+	if err := writeArchive(p.tarball, "", files); err != nil {
+		return err
+	}
+	p.digest, err = fileSHA256(p.tarball)
+	return err
+}
+
+// Close removes the tarball of the source.
+func (p *remotePool) Close() {
+	if p.tarball != "" {
+		os.Remove(p.tarball)
+	}
+}
+
+// remoteSourceFiles returns the files of the source in dir: those that git
+// doesn't ignore, or everything but .git outside of git.
+func remoteSourceFiles(dir string) ([]archiveFile, error) {
+	output, err := execGo("git", nil, dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		var files []archiveFile
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, archiveFile{Name: filepath.ToSlash(rel), Src: path, Mode: info.Mode().Perm()})
+			return nil
+		})
+		return files, err
+	}
+
+	var files []archiveFile
+	for _, name := range strings.Split(output, "\x00") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		// Files that are deleted but not yet staged are left out
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, archiveFile{Name: name, Src: path, Mode: info.Mode().Perm()})
+	}
+	return files, nil
+}
+
+// acquire returns the worker with the fewest builds running of those that
+// are up.
+func (p *remotePool) acquire() (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	worker := ""
+	for _, u := range p.config.URLs {
+		if !p.down[u] && (worker == "" || p.active[u] < p.active[worker]) {
+			worker = u
+		}
+	}
+	if worker == "" {
+		return "", false
+	}
+	p.active[worker]++
+	return worker, true
+}
+
+func (p *remotePool) release(worker string, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.active[worker]--
+	if _, ok := err.(*remoteBuildError); err != nil && !ok {
+		p.down[worker] = true
+	}
+}
+
+// Build runs the build on a worker, of the source that the pool sends,
+// and writes the binary to output. The output of a failed build is copied
+// to w, if it isn't nil.
+func (p *remotePool) Build(build *remoteBuild, output string, w io.Writer) error {
+	if err := p.prepare(); err != nil {
+		return err
+	}
+
+	// Paths in the source are relative to where each worker puts it
+	relative := func(v string) string {
+		return strings.Replace(v, p.root, remoteSourceVar, -1)
+	}
+	build.Source, build.Repository, build.Ref, build.Dir = p.digest, p.repository, p.ref, p.dir
+	build.PGO = relative(build.PGO)
+	for i, kv := range build.Env {
+		build.Env[i] = relative(kv)
+	}
+
+	var lastErr error
+	for {
+		worker, ok := p.acquire()
+		if !ok {
+			return fmt.Errorf("no remote worker is available, the last error was: %s", lastErr)
+		}
+		err := p.buildOn(worker, build, output)
+		p.release(worker, err)
+		if be, ok := err.(*remoteBuildError); ok && w != nil {
+			io.WriteString(w, be.Output)
+		}
+		if _, ok := err.(*remoteBuildError); err == nil || ok {
+			return err
+		}
+
+		ui.Warnf("Worker %s failed, trying another: %s\n", worker, err)
+		lastErr = err
+	}
+}
+
+func (p *remotePool) buildOn(worker string, build *remoteBuild, output string) error {
+	base := strings.TrimSuffix(worker, "/")
+	if err := p.upload(base); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(build)
+	if err != nil {
+		return err
+	}
+	resp, err := p.request("POST", base+"/v1/builds", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnprocessableEntity:
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &remoteBuildError{Worker: worker, Output: string(msg)}
+	default:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &httpStatusError{resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+	}
+
+	// The binary is written next to where it goes, so that a broken
+	// download doesn't leave half of one
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(output), ".gox-remote")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), output)
+}
+
+// upload uploads the tarball to the worker at base, unless it has it.
+func (p *remotePool) upload(base string) error {
+	if p.digest == "" {
+		return nil
+	}
+	p.lock.Lock()
+	done := p.uploaded[base]
+	p.lock.Unlock()
+	if done {
+		return nil
+	}
+
+	u := base + "/v1/sources/" + p.digest
+	resp, err := p.request("HEAD", u, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		f, err := os.Open(p.tarball)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if resp, err = p.request("PUT", u, "application/gzip", f); err != nil {
+			return err
+		}
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return &httpStatusError{resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+		}
+	} else if resp.StatusCode/100 != 2 {
+		return &httpStatusError{resp.StatusCode, resp.Status, ""}
+	}
+
+	p.lock.Lock()
+	p.uploaded[base] = true
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *remotePool) request(method, u, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token := p.config.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return remoteClient.Do(req)
+}
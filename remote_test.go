@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWorkersConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config WorkersConfig
+		Err    bool
+	}{
+		{WorkersConfig{URLs: []string{"http://build1:7878"}}, false},
+		{WorkersConfig{URLs: []string{"http://build1:7878"}, Source: "git"}, false},
+		{WorkersConfig{URLs: []string{"build1:7878"}}, true},
+		{WorkersConfig{Source: "rsync"}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Config.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestRemotePoolBuild(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "src")
+	os.MkdirAll(filepath.Join(src, "broken"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "broken", "main.go"), []byte("package main\n\nfunc main() { x }\n"), 0644)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	defer os.Setenv("GOX_WORKER_TOKEN", os.Getenv("GOX_WORKER_TOKEN"))
+	os.Setenv("GOX_WORKER_TOKEN", "secret")
+	worker := httptest.NewServer(newWorkerServer(filepath.Join(td, "worker"), "go", "secret", 2))
+	defer worker.Close()
+
+	// The first worker is down, so the builds go to the second
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	pool, err := newRemotePool(&WorkersConfig{URLs: []string{down.URL, worker.URL}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer pool.Close()
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	output := filepath.Join(td, "dist", "app")
+	build := &remoteBuild{Package: ".", Platform: platform, Ldflags: "-s -w", Env: []string{"CGO_ENABLED=0"}}
+	if err := pool.Build(build, output, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info, err := os.Stat(output); err != nil || info.Size() == 0 {
+		t.Fatalf("bad: %v %s", info, err)
+	}
+	if !pool.down[down.URL] || pool.down[worker.URL] || !pool.uploaded[worker.URL] {
+		t.Fatalf("bad: %#v %#v", pool.down, pool.uploaded)
+	}
+
+	build = &remoteBuild{Package: "./broken", Platform: platform, Env: []string{"CGO_ENABLED=0"}}
+	err = pool.Build(build, filepath.Join(td, "dist", "broken"), nil)
+	if be, ok := err.(*remoteBuildError); !ok || !strings.Contains(be.Output, "main.go") {
+		t.Fatalf("bad: %#v", err)
+	}
+	if pool.down[worker.URL] {
+		t.Fatal("a failed build shouldn't take the worker down")
+	}
+}
+
+func TestWorkerServer(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	server := httptest.NewServer(newWorkerServer(td, "go", "secret", 1))
+	defer server.Close()
+
+	digest := strings.Repeat("0", 64)
+	cases := []struct {
+		Method, Path, Token, Body string
+		Code                      int
+	}{
+		{"HEAD", "/v1/sources/" + digest, "", "", http.StatusUnauthorized},
+		{"HEAD", "/v1/sources/" + digest, "secret", "", http.StatusNotFound},
+		{"HEAD", "/v1/sources/../../etc", "secret", "", http.StatusBadRequest},
+		{"PUT", "/v1/sources/" + digest, "secret", "not the tarball", http.StatusBadRequest},
+		{"POST", "/v1/builds", "secret", `{"source": "` + digest + `", "platform": "linux/amd64"}`, http.StatusNotFound},
+		{"POST", "/v1/builds", "secret", `{"platform": "linux/amd64"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.Method, server.URL+tc.Path, strings.NewReader(tc.Body))
+		if tc.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.Token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.Code {
+			t.Fatalf("bad: %s %s: %d", tc.Method, tc.Path, resp.StatusCode)
+		}
+	}
+}
+
+func TestRemoteBuildValidate(t *testing.T) {
+	src := filepath.Join(os.TempDir(), "src")
+	cases := []struct {
+		Build remoteBuild
+		Err   bool
+	}{
+		{remoteBuild{Package: ".", Platform: "linux/amd64"}, false},
+		{remoteBuild{Package: "./cmd/app", Platform: "linux/arm", Env: []string{"GOARM=7", "CGO_ENABLED=1"},
+			Ldflags: `-s -w -X main.version=1.0 -linkmode external -extldflags "-static"`,
+			Gcflags: "all=-N -l", Mod: "readonly", PGO: remoteSourceVar + "/default.pgo"}, false},
+		{remoteBuild{Package: "-toolexec=/bin/sh", Platform: "linux/amd64"}, true},
+		{remoteBuild{Package: ".", Platform: "linux"}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Env: []string{"GOFLAGS=-toolexec=/bin/sh"}}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Env: []string{"CC=/bin/sh"}}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Env: []string{"GOWORK=/etc/go.work"}}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Ldflags: "-extld=/bin/sh"}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Ldflags: "-extldflags -fplugin=x.so"}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Gcflags: "-cpuprofile=/etc/passwd"}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", PGO: "/etc/default.pgo"}, true},
+		{remoteBuild{Package: ".", Platform: "linux/amd64", Mod: "-toolexec"}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Build.validate(src)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %v", tc.Build, err)
+		}
+	}
+}
+
+func TestRemoteBuildArgs(t *testing.T) {
+	b := &remoteBuild{Package: ".", Platform: "linux/arm64", Test: true, Trimpath: true,
+		Ldflags: "-s -w", Tags: "netgo", PGO: remoteSourceVar + "/default.pgo",
+		Env: []string{"CGO_ENABLED=0", "GOWORK=" + remoteSourceVar + "/go.work"}}
+	args := strings.Join(b.args("/src", "/out/app"), " ")
+	expected := "test -c -trimpath -pgo /src/default.pgo -gcflags  -ldflags -s -w -asmflags  -tags netgo -o /out/app ."
+	if args != expected {
+		t.Fatalf("bad: %s", args)
+	}
+
+	defer os.Unsetenv("GOX_LINUX_ARM64_CC")
+	os.Setenv("GOX_LINUX_ARM64_CC", "aarch64-linux-gnu-gcc")
+	env := strings.Join(b.env("/src"), "\n")
+	for _, kv := range []string{"GOOS=linux", "GOARCH=arm64", "GOWORK=/src/go.work", "CC=aarch64-linux-gnu-gcc"} {
+		if !strings.Contains(env, "\n"+kv+"\n") && !strings.HasSuffix(env, "\n"+kv) {
+			t.Fatalf("no %s: %s", kv, env)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH
+// environment variable, if it is set. See
+// https://reproducible-builds.org/specs/source-date-epoch/.
+func sourceDateEpoch() (time.Time, bool) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	epoch, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(epoch, 0).UTC(), true
+}
+
+// artifactTime is the timestamp given to files we write: SOURCE_DATE_EPOCH
+// if it is set, and the current time otherwise.
+func artifactTime() time.Time {
+	if t, ok := sourceDateEpoch(); ok {
+		return t
+	}
+
+	// Archive formats can't all store sub-second times
+	return time.Now().Truncate(time.Second)
+}
+
+// setSourceDateEpoch sets SOURCE_DATE_EPOCH, if it isn't already set, to
+// the time of the last commit, so that every timestamp in a reproducible
+// build comes from the source. Tools we run, such as nfpm, honor the
+// variable as well. Outside of a git repository it has to be set, since
+// any other default would date the artifacts to whenever it was chosen.
+func setSourceDateEpoch() error {
+	if _, ok := sourceDateEpoch(); ok {
+		return nil
+	}
+
+	epoch, err := gitCommitTime()
+	if err != nil {
+		return fmt.Errorf("SOURCE_DATE_EPOCH isn't set, and there is no git commit to take it from, "+
+			"so set it to the Unix time of the source: %s", gitReason(err))
+	}
+	return os.Setenv("SOURCE_DATE_EPOCH", epoch)
+}
+
+// reproducibleLdflags adds the linker flags for a reproducible build to
+// ldflags. An empty build ID keeps the binary from depending on the
+// build cache.
+func reproducibleLdflags(ldflags string) string {
+	return strings.TrimSpace(ldflags + " -buildid=")
+}
+
+// setArtifactTime sets the modification time of path to artifactTime.
+func setArtifactTime(path string) error {
+	t := artifactTime()
+	if err := os.Chtimes(path, t, t); err != nil {
+		return fmt.Errorf("setting timestamp of %s: %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	v, ok := sourceDateEpoch()
+	if !ok || !v.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("bad: %s", v)
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, ok := sourceDateEpoch(); ok {
+		t.Fatal("should not be set")
+	}
+}
+
+func TestWriteArchive_reproducible(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := []archiveFile{
+		{Name: "b", Data: []byte("b"), Mode: 0644},
+		{Name: "a", Data: []byte("a"), Mode: 0755},
+	}
+	reversed := []archiveFile{files[1], files[0]}
+	for _, ext := range []string{".zip", ".tar.gz", ".tar"} {
+		first := filepath.Join(td, "first"+ext)
+		second := filepath.Join(td, "second"+ext)
+		if err := writeArchive(first, "root", files); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := writeArchive(second, "root", reversed); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		a, _ := ioutil.ReadFile(first)
+		b, _ := ioutil.ReadFile(second)
+		if !bytes.Equal(a, b) {
+			t.Fatalf("%s: archives differ", ext)
+		}
+	}
+}
+
+func TestSplitOutputFlag(t *testing.T) {
+	cases := []struct {
+		Input  []string
+		Output string
+		Args   []string
+	}{
+		{
+			[]string{"-os", "linux", "./..."},
+			"{{.Dir}}_{{.OS}}_{{.Arch}}",
+			[]string{"-os", "linux", "./..."},
+		},
+		{
+			[]string{"-output", "dist/{{.OS}}", "-os=linux"},
+			"dist/{{.OS}}",
+			[]string{"-os=linux"},
+		},
+		{
+			[]string{"--output=x", ".", "-output", "y"},
+			"x",
+			[]string{".", "-output", "y"},
+		},
+	}
+
+	for _, tc := range cases {
+		output, args := splitOutputFlag(tc.Input)
+		if output != tc.Output || !reflect.DeepEqual(args, tc.Args) {
+			t.Fatalf("%#v: bad: %s %#v", tc.Input, output, args)
+		}
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(path, data string) {
+		path = filepath.Join(td, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	write("1/same", "same")
+	write("2/same", "same")
+	write("1/sub/differs", "a")
+	write("2/sub/differs", "b")
+	write("2/extra", "extra")
+
+	diffs, err := compareDirs(filepath.Join(td, "1"), filepath.Join(td, "2"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	names := make([]string, len(diffs))
+	for i, d := range diffs {
+		names[i] = d.Name
+	}
+	if !reflect.DeepEqual(names, []string{"extra", "same", "sub/differs"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+	if diffs[0].A != "" || diffs[1].A != diffs[1].B || diffs[2].A == diffs[2].B {
+		t.Fatalf("bad: %#v", diffs)
+	}
+}
+
+func TestSetSourceDateEpoch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+	os.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(td))
+	defer os.Unsetenv("GIT_CEILING_DIRECTORIES")
+
+	// Outside of git there is nothing to default to
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	if err := setSourceDateEpoch(); err == nil {
+		t.Fatal("should fail without SOURCE_DATE_EPOCH")
+	}
+	if _, ok := sourceDateEpoch(); ok {
+		t.Fatal("should not be set")
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if err := setSourceDateEpoch(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "1700000000" {
+		t.Fatalf("bad: %s", v)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ScoopConfig is the "scoop" section of the config file. It writes a
+// Scoop manifest that installs the windows archives of a binary, with the
+// URL and hash of the archive for each arch, and can push it to a bucket.
+type ScoopConfig struct {
+	// Name is the name of the app, defaults to the directory of the
+	// package. Package picks the main package when several are built.
+	Name    string `json:"name,omitempty"`
+	Package string `json:"package,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	Homepage    string `json:"homepage,omitempty"`
+	License     string `json:"license,omitempty"`
+
+	// URL is the template for where each archive is downloaded from, as
+	// in HomebrewConfig.
+	URL string `json:"url"`
+
+	// Output is the directory the manifest is written to, defaults to
+	// that of the archives.
+	Output string `json:"output,omitempty"`
+
+	// Bucket, if set, is the bucket that -publish pushes the manifest
+	// to, in the directory "bucket" by default.
+	Bucket *RepoConfig `json:"bucket,omitempty"`
+}
+
+// scoopArches maps GOARCH to the architectures of Scoop manifests.
+var scoopArches = map[string]string{
+	"amd64": "64bit",
+	"386":   "32bit",
+	"arm64": "arm64",
+}
+
+// scoopManifest is the manifest of an app, in the fields that Scoop
+// documents at https://github.com/ScoopInstaller/Scoop/wiki/App-Manifests.
+type scoopManifest struct {
+	Version      string                   `json:"version"`
+	Description  string                   `json:"description,omitempty"`
+	Homepage     string                   `json:"homepage,omitempty"`
+	License      string                   `json:"license,omitempty"`
+	Architecture map[string]*scoopArchive `json:"architecture"`
+	Bin          string                   `json:"bin"`
+}
+
+type scoopArchive struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// Validate checks the url template and the bucket, if any.
+func (c *ScoopConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("scoop: url is required")
+	}
+	if err := validateURLTemplate("scoop", c.URL); err != nil {
+		return err
+	}
+	if c.Bucket != nil {
+		if err := c.Bucket.Validate("scoop: bucket"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteScoopManifest writes the manifest for the windows archives of
+// results and returns its path.
+func WriteScoopManifest(c *ScoopConfig, archives *ArchiveConfig, results []BuildResult, version string) (string, error) {
+	builds, err := releaseBuilds(c.Package, results, "windows")
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := archives.binaryName(builds[0], version)
+	if err != nil {
+		return "", err
+	}
+	m := &scoopManifest{
+		Version:      version,
+		Description:  c.Description,
+		Homepage:     c.Homepage,
+		License:      c.License,
+		Architecture: make(map[string]*scoopArchive),
+		Bin:          binary + ".exe",
+	}
+	for _, r := range pickBuilds("windows", []string{"amd64", "386", "arm64"}, builds) {
+		path, err := archives.Path(r, version)
+		if err != nil {
+			return "", err
+		}
+		a := &scoopArchive{}
+		if a.Hash, err = fileSHA256(path); err != nil {
+			return "", err
+		}
+		if a.URL, err = releaseURL(c.URL, path, r, version); err != nil {
+			return "", err
+		}
+		m.Architecture[scoopArches[r.Platform.Arch]] = a
+	}
+	if len(m.Architecture) == 0 {
+		return "", fmt.Errorf("no windows/amd64, windows/386 or windows/arm64 binaries to publish")
+	}
+
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	dir := c.Output
+	if dir == "" {
+		dir = archives.output()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(builds[0].Path)
+	}
+	path := filepath.Join(dir, name+".json")
+	return path, ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteScoopManifest(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td, Format: "zip"}
+	var results []BuildResult
+	for _, p := range []Platform{
+		{OS: "windows", Arch: "amd64"},
+		{OS: "windows", Arch: "amd64", Level: "v3"},
+		{OS: "windows", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+	} {
+		r := BuildResult{Platform: p, Path: "example.com/app"}
+		path, _ := archives.Path(r, "1.2.3")
+		if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, r)
+	}
+
+	c := &ScoopConfig{License: "MIT", URL: "https://example.com/{{.Version}}/{{.Name}}"}
+	path, err := WriteScoopManifest(c, archives, results, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != filepath.Join(td, "app.json") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var m scoopManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum, _ := fileSHA256(filepath.Join(td, "app_1.2.3_windows_amd64.zip"))
+	expected := scoopManifest{
+		Version: "1.2.3",
+		License: "MIT",
+		Architecture: map[string]*scoopArchive{
+			"64bit": {URL: "https://example.com/1.2.3/app_1.2.3_windows_amd64.zip", Hash: sum},
+			"arm64": {URL: "https://example.com/1.2.3/app_1.2.3_windows_arm64.zip", Hash: sum},
+		},
+		Bin: "app.exe",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("bad: %s", data)
+	}
+}
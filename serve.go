@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveFlags are the flags that jobs can pass to gox, and whether they
+// take a value, which must come after an "=". None of them read or write
+// anything outside of the job, or run anything but the build.
+var serveFlags = map[string]bool{
+	"os": true, "arch": true, "osarch": true, "armarch": true,
+	"ldflags": true, "tags": true, "buildmode": true, "mod": true, "goexperiment": true,
+	"allow-failures": true,
+	"cgo":            false, "race": false, "reproducible": false, "static": false, "strip": false,
+	"build-id": false, "verbose": false,
+}
+
+// serveLdflags are the linker flags that jobs can set. Others, such as
+// -extld, run commands or write files of their choosing.
+var serveLdflags = map[string]bool{"-s": true, "-w": true, "-X": true, "-buildid": true}
+
+// serveRequest is a build that is submitted to `gox serve`: the packages
+// of Repository at Ref, or of Module at Version, built for Targets with
+// Flags.
+type serveRequest struct {
+	Repository string   `json:"repository,omitempty"`
+	Ref        string   `json:"ref,omitempty"`
+	Module     string   `json:"module,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Packages   []string `json:"packages,omitempty"`
+	Targets    []string `json:"targets,omitempty"`
+	Flags      []string `json:"flags,omitempty"`
+}
+
+// Validate checks the request for required values.
+func (r *serveRequest) Validate() error {
+	switch {
+	case r.Repository != "" && r.Module != "":
+		return fmt.Errorf("only one of repository and module can be set")
+	case r.Repository != "":
+	case r.Module != "":
+		if r.Version == "" {
+			return fmt.Errorf("version is required with module")
+		}
+	default:
+		return fmt.Errorf("repository or module is required")
+	}
+	for _, t := range r.Targets {
+		if len(strings.Split(t, "/")) != 2 {
+			return fmt.Errorf("target %s should be os/arch", t)
+		}
+	}
+	for _, f := range r.Flags {
+		if !strings.HasPrefix(f, "-") {
+			return fmt.Errorf("flag %q should start with -", f)
+		}
+		parts := strings.SplitN(strings.TrimLeft(f, "-"), "=", 2)
+		value, ok := serveFlags[parts[0]]
+		switch {
+		case !ok:
+			return fmt.Errorf("flag -%s can't be set by a job", parts[0])
+		case value && len(parts) != 2:
+			return fmt.Errorf("flag -%s needs a value, as -%s=value", parts[0], parts[0])
+		case parts[0] == "ldflags":
+			if err := validateServeLdflags(parts[1]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range []struct{ Key, Value string }{{"ref", r.Ref}, {"module", r.Module}, {"version", r.Version}} {
+		if strings.HasPrefix(v.Value, "-") {
+			return fmt.Errorf("%s %q can't start with -", v.Key, v.Value)
+		}
+	}
+	for _, p := range r.Packages {
+		if strings.HasPrefix(p, "-") {
+			return fmt.Errorf("package %q can't start with -", p)
+		}
+	}
+
+	return nil
+}
+
+// validateServeLdflags checks that the -ldflags of a job, for every
+// platform or for one of them, only have serveLdflags.
+func validateServeLdflags(value string) error {
+	if m := buildFlagPlatformRe.FindStringSubmatch(value); m != nil {
+		value = m[2]
+	}
+	fields := strings.Fields(value)
+	for i := 0; i < len(fields); i++ {
+		name := strings.SplitN(fields[i], "=", 2)[0]
+		if !serveLdflags[name] {
+			return fmt.Errorf("-ldflags %s can't be set by a job", name)
+		}
+		// The value of -X can be the next field
+		if name == "-X" && !strings.Contains(fields[i], "=") {
+			i++
+		}
+	}
+	return nil
+}
+
+// serveArtifact is a file that a job built, which is downloaded from URL.
+type serveArtifact struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+}
+
+// serveJob is a submitted build and how it is doing. Status is "queued",
+// "running", "succeeded" or "failed".
+type serveJob struct {
+	ID        string          `json:"id"`
+	Status    string          `json:"status"`
+	Request   serveRequest    `json:"request"`
+	Error     string          `json:"error,omitempty"`
+	Created   time.Time       `json:"created"`
+	Started   *time.Time      `json:"started,omitempty"`
+	Finished  *time.Time      `json:"finished,omitempty"`
+	Builds    []TargetSummary `json:"builds,omitempty"`
+	Artifacts []serveArtifact `json:"artifacts,omitempty"`
+
+	dir  string
+	log  bytes.Buffer
+	done chan struct{}
+}
+
+// serveServer is the HTTP API of `gox serve`, a build service that runs
+// gox for the jobs submitted to it, one queue for all of them:
+//
+//	POST /v1/jobs                        submits a serveRequest, returns the job
+//	GET  /v1/jobs                        lists the jobs
+//	GET  /v1/jobs/ID                     returns the job
+//	GET  /v1/jobs/ID/log                 streams the output of the job until it is done
+//	GET  /v1/jobs/ID/artifacts/NAME      downloads an artifact
+//	GET  /metrics                        the serveMetrics, for Prometheus
+type serveServer struct {
+	// Dir is where the jobs are built and their artifacts kept.
+	Dir string
+
+	// GoxCmd is the gox that jobs run, and GoCmd the go command that
+	// downloads modules.
+	GoxCmd string
+	GoCmd  string
+
+	// Token, if set, is the bearer token that requests must have.
+	Token string
+
+	// Log, if set, gets a line for every job that starts or finishes.
+	Log io.Writer
+
+	// Otel exports a trace of every job, with the spans of its gox run
+	// under it.
+	Otel bool
+
+	queue   chan *serveJob
+	metrics *serveMetrics
+
+	// lock guards the jobs and their status and logs.
+	lock sync.Mutex
+	jobs map[string]*serveJob
+}
+
+// newServeServer returns a server that builds parallel jobs at once.
+func newServeServer(dir, goxCmd, goCmd, token string, parallel int) *serveServer {
+	s := &serveServer{
+		Dir:     dir,
+		GoxCmd:  goxCmd,
+		GoCmd:   goCmd,
+		Token:   token,
+		queue:   make(chan *serveJob, 1024),
+		metrics: newServeMetrics(),
+		jobs:    make(map[string]*serveJob),
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	for i := 0; i < parallel; i++ {
+		go func() {
+			for job := range s.queue {
+				s.run(job)
+			}
+		}()
+	}
+	return s
+}
+
+func (s *serveServer) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		fmt.Fprintf(s.Log, format, args...)
+	}
+}
+
+func (s *serveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/metrics" && r.Method == "GET" {
+		var queued, running int
+		s.lock.Lock()
+		for _, job := range s.jobs {
+			switch job.Status {
+			case "queued":
+				queued++
+			case "running":
+				running++
+			}
+		}
+		s.lock.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.metrics.Write(w, queued, running)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/jobs"), "/", 4)
+	if !strings.HasPrefix(r.URL.Path, "/v1/jobs") || parts[0] != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case "POST":
+			s.submit(w, r)
+		case "GET":
+			s.lock.Lock()
+			jobs := make([]*serveJob, 0, len(s.jobs))
+			for _, job := range s.jobs {
+				jobs = append(jobs, job)
+			}
+			sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+			data, err := json.Marshal(jobs)
+			s.lock.Unlock()
+			writeServeJSON(w, http.StatusOK, data, err)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	s.lock.Lock()
+	job := s.jobs[parts[1]]
+	s.lock.Unlock()
+	if job == nil || r.Method != "GET" {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(parts) == 2:
+		s.lock.Lock()
+		data, err := json.Marshal(job)
+		s.lock.Unlock()
+		writeServeJSON(w, http.StatusOK, data, err)
+	case len(parts) == 3 && parts[2] == "log":
+		s.streamLog(w, job)
+	case len(parts) == 4 && parts[2] == "artifacts":
+		path, ok := bundlePath(job.dir, parts[3])
+		if !ok || !s.isArtifact(job, parts[3]) {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeServeJSON(w http.ResponseWriter, code int, data []byte, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
+
+// submit queues the job of the request in r.
+func (s *serveServer) submit(w http.ResponseWriter, r *http.Request) {
+	var req serveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job := &serveJob{
+		ID:      hex.EncodeToString(id),
+		Status:  "queued",
+		Request: req,
+		Created: time.Now().UTC(),
+		done:    make(chan struct{}),
+	}
+	job.dir = filepath.Join(s.Dir, job.ID)
+
+	s.lock.Lock()
+	s.jobs[job.ID] = job
+	data, err := json.Marshal(job)
+	s.lock.Unlock()
+	select {
+	case s.queue <- job:
+	default:
+		s.finish(job, "", nil, fmt.Errorf("the queue is full"))
+	}
+
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	writeServeJSON(w, http.StatusAccepted, data, err)
+}
+
+// streamLog writes the output of the job to w as it comes, until the job
+// is done.
+func (s *serveServer) streamLog(w http.ResponseWriter, job *serveJob) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		s.lock.Lock()
+		chunk := append([]byte(nil), job.log.Bytes()[offset:]...)
+		s.lock.Unlock()
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			offset += len(chunk)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		select {
+		case <-job.done:
+			s.lock.Lock()
+			rest := job.log.Bytes()[offset:]
+			s.lock.Unlock()
+			w.Write(rest)
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// serveLog appends what a job writes to its log.
+type serveLog struct {
+	s   *serveServer
+	job *serveJob
+}
+
+func (l *serveLog) Write(p []byte) (int, error) {
+	l.s.lock.Lock()
+	defer l.s.lock.Unlock()
+	return l.job.log.Write(p)
+}
+
+// run fetches the source of the job and builds it with gox.
+func (s *serveServer) run(job *serveJob) {
+	start := time.Now()
+	started := start.UTC()
+	s.lock.Lock()
+	job.Started = &started
+	job.Status = "running"
+	s.lock.Unlock()
+	s.logf("--> Job %s: running\n", job.ID)
+
+	req := job.Request
+	var tracer *otelTracer
+	if s.Otel {
+		tracer = newOtelTracer("gox serve job", start)
+		tracer.Attribute("gox.job", job.ID)
+		if req.Repository != "" {
+			tracer.Attribute("gox.repository", req.Repository)
+			tracer.Attribute("gox.ref", req.Ref)
+		} else {
+			tracer.Attribute("gox.module", req.Module)
+			tracer.Attribute("gox.module_version", req.Version)
+		}
+	}
+
+	log := &serveLog{s, job}
+	src := filepath.Join(job.dir, "src")
+	dist := filepath.Join(job.dir, "dist")
+	err := s.fetch(job, src, log)
+	tracer.Span("fetch", start, err, nil)
+
+	// The summary of -json has the outcome of every build, and what gox
+	// prints goes to stderr instead. The config of the repository is
+	// replaced with an empty one, since its hooks and secrets would run
+	// with the server's environment.
+	var summary *BuildSummary
+	config := filepath.Join(job.dir, "gox.json")
+	if err == nil {
+		err = ioutil.WriteFile(config, []byte("{}\n"), 0644)
+	}
+	if err == nil {
+		args := []string{
+			"-gocmd=" + s.GoCmd,
+			"-config=" + config,
+			"-output=" + filepath.Join(dist, "{{.Dir}}_{{.OS}}_{{.Arch}}"),
+			"-json",
+		}
+		if s.Otel {
+			args = append(args, "-otel")
+		}
+		if len(req.Targets) > 0 {
+			args = append(args, "-osarch="+strings.Join(req.Targets, " "))
+		}
+		args = append(args, req.Flags...)
+		args = append(args, req.Packages...)
+
+		fmt.Fprintf(log, "$ gox %s\n", strings.Join(args, " "))
+		var stdout bytes.Buffer
+		cmd := exec.Command(s.GoxCmd, args...)
+		cmd.Dir = src
+		cmd.Stdout = &stdout
+		cmd.Stderr = log
+		if tracer != nil {
+			cmd.Env = append(os.Environ(), "TRACEPARENT="+tracer.Traceparent())
+		}
+		err = cmd.Run()
+		summary = &BuildSummary{}
+		if json.Unmarshal(stdout.Bytes(), summary) != nil {
+			summary = nil
+		}
+	}
+	s.finish(job, dist, summary, err)
+	if exportErr := tracer.Export(err); exportErr != nil {
+		s.logf("--> Job %s: error exporting the trace: %s\n", job.ID, exportErr)
+	}
+}
+
+// fetch puts the source of the job in src: a clone of its repository at
+// its ref, or a copy of its module at its version.
+func (s *serveServer) fetch(job *serveJob, src string, log io.Writer) error {
+	req := job.Request
+	if err := os.MkdirAll(job.dir, 0755); err != nil {
+		return err
+	}
+	if req.Repository != "" {
+		fmt.Fprintf(log, "$ git clone %s\n", req.Repository)
+		if _, err := execGoOutput("git", nil, "", log, "clone", "--quiet", "--", req.Repository, src); err != nil {
+			return err
+		}
+		if req.Ref != "" {
+			if _, err := execGoOutput("git", nil, src, log, "checkout", "--quiet", "--detach", req.Ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The module cache is read-only, so the build gets a copy
+	fmt.Fprintf(log, "$ go mod download %s@%s\n", req.Module, req.Version)
+	output, err := execGo(s.GoCmd, append(os.Environ(), "GOFLAGS=-mod=mod"), job.dir,
+		"mod", "download", "-json", req.Module+"@"+req.Version)
+	if err != nil {
+		return err
+	}
+	var mod struct{ Dir, Error string }
+	if err := json.Unmarshal([]byte(output), &mod); err != nil {
+		return err
+	}
+	if mod.Error != "" {
+		return fmt.Errorf("%s", mod.Error)
+	}
+	files, err := dirFiles(mod.Dir, "")
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		files[i].Mode |= 0200
+	}
+	return writeFiles(src, files)
+}
+
+// artifacts returns the files of m, the manifest in dist, that are in the
+// directory of the job, or else every file in dist.
+func (s *serveServer) artifacts(job *serveJob, dist string, m *ArtifactManifest) []serveArtifact {
+	var paths []string
+	if m != nil && len(m.Artifacts) > 0 {
+		paths = append(m.Paths(), filepath.Join(dist, manifestName))
+	} else {
+		files, _ := dirFiles(dist, "")
+		for _, f := range files {
+			paths = append(paths, f.Src)
+		}
+	}
+
+	var result []serveArtifact
+	for _, path := range paths {
+		rel, err := filepath.Rel(job.dir, path)
+		if err != nil || hasParentPrefix(rel) || rel == ".." {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		sum, _ := fileSHA256(path)
+		name := filepath.ToSlash(rel)
+		result = append(result, serveArtifact{
+			Name:   name,
+			Size:   info.Size(),
+			SHA256: sum,
+			URL:    "/v1/jobs/" + job.ID + "/artifacts/" + name,
+		})
+	}
+	return result
+}
+
+func (s *serveServer) isArtifact(job *serveJob, name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, a := range job.Artifacts {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// finish records the outcome of the job, with the artifacts in dist and
+// the summary of its builds, if it got that far.
+func (s *serveServer) finish(job *serveJob, dist string, summary *BuildSummary, err error) {
+	var manifest *ArtifactManifest
+	var artifacts []serveArtifact
+	if dist != "" {
+		manifest, _ = LoadArtifactManifest(dist)
+		artifacts = s.artifacts(job, dist, manifest)
+	}
+
+	now := time.Now().UTC()
+	var seconds float64
+	s.lock.Lock()
+	job.Finished = &now
+	job.Artifacts = artifacts
+	if summary != nil {
+		job.Builds = summary.Targets
+	}
+	if job.Started != nil {
+		seconds = now.Sub(*job.Started).Seconds()
+	}
+	job.Status = "succeeded"
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		fmt.Fprintf(&job.log, "\n%s\n", err)
+	}
+	s.lock.Unlock()
+	s.metrics.Job(job.Status, seconds, summary, manifest)
+	close(job.done)
+	s.logf("--> Job %s: %s\n", job.ID, job.Status)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestServeRequestValidate(t *testing.T) {
+	cases := []struct {
+		Request serveRequest
+		Err     bool
+	}{
+		{serveRequest{Repository: "https://example.com/app.git", Ref: "v1.0.0"}, false},
+		{serveRequest{Module: "example.com/app", Version: "v1.0.0", Targets: []string{"linux/amd64"}}, false},
+		{serveRequest{Repository: "https://example.com/app.git", Flags: []string{"-tags=netgo", "-cgo"}}, false},
+		{serveRequest{Repository: "a", Flags: []string{"-ldflags=-s -w -X main.version=1.0", "--race"}}, false},
+		{serveRequest{Repository: "a", Flags: []string{"-ldflags=linux/amd64=-X main.a=b"}}, false},
+		{serveRequest{}, true},
+		{serveRequest{Module: "example.com/app"}, true},
+		{serveRequest{Repository: "a", Module: "example.com/app", Version: "v1.0.0"}, true},
+		{serveRequest{Repository: "a", Targets: []string{"linux"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-output=/etc/passwd"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"--publish"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"trimpath"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-trimpath"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-triage=/tmp/x"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-overlay=/etc/overlay.json"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-tags", "netgo"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-ldflags=-s -extld=/bin/sh"}}, true},
+		{serveRequest{Repository: "a", Flags: []string{"-ldflags=-extldflags=-fplugin=x"}}, true},
+		{serveRequest{Repository: "a", Ref: "--upload-pack=x"}, true},
+		{serveRequest{Module: "-modfile=x", Version: "v1.0.0"}, true},
+		{serveRequest{Repository: "a", Packages: []string{"-config=x"}}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Request.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %s", tc.Request, err)
+		}
+	}
+}
+
+func TestServeServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake gox is a shell script")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	repo := filepath.Join(td, "repo")
+	os.MkdirAll(repo, 0755)
+	ioutil.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=gox", "GIT_AUTHOR_EMAIL=gox@example.com",
+		"GIT_COMMITTER_NAME=gox", "GIT_COMMITTER_EMAIL=gox@example.com")
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"commit", "--quiet", "-m", "initial"},
+		{"tag", "v1.0.0"},
+	} {
+		if _, err := execGo("git", env, repo, args...); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The fake gox writes where -output points, with the OS and arch of
+	// -osarch filled in, and the summary of -json
+	gox := filepath.Join(td, "gox")
+	script := `#!/bin/sh
+osarch=linux/amd64
+for arg; do
+	case "$arg" in
+	-output=*) output="${arg#-output=}" ;;
+	-osarch=*) osarch="${arg#-osarch=}" ;;
+	-tags=fail)
+		echo "build failed" >&2
+		echo '{"targets": [{"platform": "'$osarch'", "package": ".", "status": "failed"}]}'
+		exit 1 ;;
+	esac
+done
+output=$(echo "$output" | sed -e 's/{{.Dir}}/repo/' -e "s|{{.OS}}|${osarch%/*}|" -e "s|{{.Arch}}|${osarch#*/}|")
+mkdir -p "$(dirname "$output")"
+echo binary > "$output"
+echo "built $output" >&2
+echo '{"targets": [{"platform": "'$osarch'", "package": ".", "status": "built"}]}'
+`
+	ioutil.WriteFile(gox, []byte(script), 0755)
+
+	s := newServeServer(filepath.Join(td, "jobs"), gox, "go", "secret", 1)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	do := func(method, path, body string) (int, []byte) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+	submit := func(body string) *serveJob {
+		code, data := do("POST", "/v1/jobs", body)
+		if code != http.StatusAccepted {
+			t.Fatalf("bad: %d %s", code, data)
+		}
+		var job serveJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		// The log is streamed until the job is done
+		if code, data := do("GET", "/v1/jobs/"+job.ID+"/log", ""); code != http.StatusOK || len(data) == 0 {
+			t.Fatalf("bad: %d %s", code, data)
+		}
+		_, data = do("GET", "/v1/jobs/"+job.ID, "")
+		job = serveJob{}
+		if err := json.Unmarshal(data, &job); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return &job
+	}
+
+	job := submit(`{"repository": "` + repo + `", "ref": "v1.0.0", "targets": ["linux/arm64"]}`)
+	if job.Status != "succeeded" || len(job.Artifacts) != 1 || len(job.Builds) != 1 || job.Started == nil {
+		t.Fatalf("bad: %#v", job)
+	}
+	artifact := job.Artifacts[0]
+	if artifact.Name != "dist/repo_linux_arm64" || artifact.Size != 7 {
+		t.Fatalf("bad: %#v", artifact)
+	}
+	if code, data := do("GET", artifact.URL, ""); code != http.StatusOK || string(data) != "binary\n" {
+		t.Fatalf("bad: %d %q", code, data)
+	}
+	if code, _ := do("GET", "/v1/jobs/"+job.ID+"/artifacts/src/main.go", ""); code != http.StatusNotFound {
+		t.Fatalf("bad: %d", code)
+	}
+
+	// The config of the repository is replaced with an empty one
+	_, data := do("GET", "/v1/jobs/"+job.ID+"/log", "")
+	if !strings.Contains(string(data), "-config="+filepath.Join(td, "jobs", job.ID, "gox.json")) {
+		t.Fatalf("bad: %s", data)
+	}
+
+	job = submit(`{"repository": "` + repo + `", "flags": ["-tags=fail"]}`)
+	if job.Status != "failed" || job.Error == "" || job.Finished == nil {
+		t.Fatalf("bad: %#v", job)
+	}
+	_, data = do("GET", "/v1/jobs/"+job.ID+"/log", "")
+	if !strings.Contains(string(data), "build failed") {
+		t.Fatalf("bad: %s", data)
+	}
+
+	if code, data := do("GET", "/v1/jobs", ""); code != http.StatusOK || strings.Count(string(data), `"id"`) != 2 {
+		t.Fatalf("bad: %d %s", code, data)
+	}
+
+	_, data = do("GET", "/metrics", "")
+	for _, metric := range []string{
+		`gox_jobs_total{status="succeeded"} 1`,
+		`gox_jobs_total{status="failed"} 1`,
+		`gox_jobs_running 0`,
+		`gox_job_duration_seconds_count 2`,
+		`gox_builds_total{platform="linux/arm64",status="built"} 1`,
+		`gox_builds_total{platform="linux/amd64",status="failed"} 1`,
+	} {
+		if !strings.Contains(string(data), metric+"\n") {
+			t.Fatalf("bad: %s", data)
+		}
+	}
+
+	cases := []struct {
+		Method, Path, Body string
+		Code               int
+	}{
+		{"POST", "/v1/jobs", `{"module": "example.com/app"}`, http.StatusBadRequest},
+		{"POST", "/v1/jobs", `not json`, http.StatusBadRequest},
+		{"GET", "/v1/jobs/unknown", "", http.StatusNotFound},
+		{"DELETE", "/v1/jobs", "", http.StatusMethodNotAllowed},
+		{"GET", "/v1/jobsx", "", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if code, _ := do(tc.Method, tc.Path, tc.Body); code != tc.Code {
+			t.Fatalf("bad: %s %s: %d", tc.Method, tc.Path, code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/v1/jobs", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad: %d", resp.StatusCode)
+	}
+}
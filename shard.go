@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shard is the part of the platforms that one of several CI jobs builds,
+// from -shard=Index/Count. Index counts from 1.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// ParseShard parses a value of -shard, such as "2/5".
+func ParseShard(v string) (*Shard, error) {
+	parts := strings.Split(v, "/")
+	if len(parts) == 2 {
+		index, err1 := strconv.Atoi(parts[0])
+		count, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && count > 0 && index >= 1 && index <= count {
+			return &Shard{Index: index, Count: count}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Invalid -shard %q, should be like 2/5 with 1 <= 2 <= 5", v)
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Platforms returns the platforms of the shard. Every job computes the
+// same partition from the same inputs: platforms are handed out longest
+// first, by timings, to the shard with the least work so far. Platforms
+// with the same group key, such as the halves of a universal binary, stay
+// in the same shard.
+func (s *Shard) Platforms(platforms []Platform, timings *ShardTimings, group func(Platform) string) []Platform {
+	type unit struct {
+		Key    string
+		Weight float64
+	}
+
+	weights := make(map[string]float64)
+	var keys []string
+	for _, p := range platforms {
+		key := group(p)
+		if _, ok := weights[key]; !ok {
+			keys = append(keys, key)
+		}
+		weights[key] += timings.weight(p)
+	}
+
+	units := make([]unit, 0, len(keys))
+	for _, key := range keys {
+		units = append(units, unit{Key: key, Weight: weights[key]})
+	}
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].Weight != units[j].Weight {
+			return units[i].Weight > units[j].Weight
+		}
+		return units[i].Key < units[j].Key
+	})
+
+	loads := make([]float64, s.Count)
+	assigned := make(map[string]int)
+	for _, u := range units {
+		min := 0
+		for i := range loads {
+			if loads[i] < loads[min] {
+				min = i
+			}
+		}
+		loads[min] += u.Weight
+		assigned[u.Key] = min + 1
+	}
+
+	var result []Platform
+	for _, p := range platforms {
+		if assigned[group(p)] == s.Index {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ShardTimings records how long each platform took to build, in seconds,
+// so that shards can be balanced by it.
+type ShardTimings struct {
+	Platforms map[string]float64 `json:"platforms"`
+}
+
+// LoadShardTimings reads the timings file at path. A missing file has no
+// timings, which balances the shards by the number of platforms.
+func LoadShardTimings(path string) (*ShardTimings, error) {
+	t := &ShardTimings{Platforms: make(map[string]float64)}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if t.Platforms == nil {
+		t.Platforms = make(map[string]float64)
+	}
+
+	return t, nil
+}
+
+// weight is the time the platform is expected to take. Platforms without
+// a timing take the average of the others.
+func (t *ShardTimings) weight(p Platform) float64 {
+	if v, ok := t.Platforms[p.String()]; ok && v > 0 {
+		return v
+	}
+
+	var sum float64
+	var n int
+	for _, v := range t.Platforms {
+		if v > 0 {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return 1
+	}
+	return sum / float64(n)
+}
+
+// Record sets the timings of the platforms that were built from results,
+// which add up the builds of every package of a platform. Up to date and
+// failed builds don't say how long a build takes, so they are left out.
+func (t *ShardTimings) Record(results []BuildResult) {
+	totals := make(map[string]time.Duration)
+	for _, r := range results {
+		if r.Err == nil && !r.UpToDate {
+			totals[r.Platform.String()] += r.Duration
+		}
+	}
+	for p, d := range totals {
+		t.Platforms[p] = float64(d.Round(time.Millisecond)) / float64(time.Second)
+	}
+}
+
+// Save writes the timings to path.
+func (t *ShardTimings) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
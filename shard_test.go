@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseShard(t *testing.T) {
+	cases := []struct {
+		Input string
+		Shard *Shard
+	}{
+		{"2/5", &Shard{Index: 2, Count: 5}},
+		{"1/1", &Shard{Index: 1, Count: 1}},
+		{"0/5", nil},
+		{"6/5", nil},
+		{"2", nil},
+		{"a/b", nil},
+	}
+
+	for _, tc := range cases {
+		shard, err := ParseShard(tc.Input)
+		if (err != nil) != (tc.Shard == nil) {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(shard, tc.Shard) {
+			t.Fatalf("%s: bad: %#v", tc.Input, shard)
+		}
+	}
+}
+
+func TestShardPlatforms(t *testing.T) {
+	var platforms []Platform
+	for _, s := range []string{
+		"darwin/amd64", "darwin/arm64", "linux/386", "linux/amd64",
+		"linux/arm64", "windows/amd64", "windows/arm64",
+	} {
+		parts := strings.Split(s, "/")
+		platforms = append(platforms, Platform{OS: parts[0], Arch: parts[1]})
+	}
+	byPlatform := func(p Platform) string { return p.String() }
+
+	// Every platform is in exactly one shard, and the shards are even
+	timings := &ShardTimings{}
+	seen := make(map[string]int)
+	for i := 1; i <= 3; i++ {
+		shard := &Shard{Index: i, Count: 3}
+		part := shard.Platforms(platforms, timings, byPlatform)
+		if len(part) < 2 || len(part) > 3 {
+			t.Fatalf("%d: bad: %#v", i, part)
+		}
+		for _, p := range part {
+			seen[p.String()]++
+		}
+
+		// The same inputs always give the same shard
+		if again := shard.Platforms(platforms, timings, byPlatform); !reflect.DeepEqual(again, part) {
+			t.Fatalf("%d: bad: %#v", i, again)
+		}
+	}
+	for _, p := range platforms {
+		if seen[p.String()] != 1 {
+			t.Fatalf("bad: %#v", seen)
+		}
+	}
+
+	// A slow platform gets a shard to itself
+	timings = &ShardTimings{Platforms: map[string]float64{"windows/amd64": 60}}
+	for _, p := range platforms[:5] {
+		timings.Platforms[p.String()] = 5
+	}
+	part := (&Shard{Index: 1, Count: 2}).Platforms(platforms, timings, byPlatform)
+	if len(part) != 1 || part[0].String() != "windows/amd64" {
+		t.Fatalf("bad: %#v", part)
+	}
+
+	// Grouped platforms stay together
+	universal := func(p Platform) string {
+		if p.OS == "darwin" {
+			return "darwin/universal"
+		}
+		return p.String()
+	}
+	for i := 1; i <= 7; i++ {
+		part := (&Shard{Index: i, Count: 7}).Platforms(platforms, &ShardTimings{}, universal)
+		darwin := 0
+		for _, p := range part {
+			if p.OS == "darwin" {
+				darwin++
+			}
+		}
+		if darwin != 0 && darwin != 2 {
+			t.Fatalf("%d: bad: %#v", i, part)
+		}
+	}
+}
+
+func TestShardTimings(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "timings.json")
+	timings, err := LoadShardTimings(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(timings.Platforms) != 0 {
+		t.Fatalf("bad: %#v", timings)
+	}
+
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	windows := Platform{OS: "windows", Arch: "amd64"}
+	timings.Platforms["darwin/arm64"] = 4
+	timings.Record([]BuildResult{
+		{Platform: linux, Duration: 2 * time.Second},
+		{Platform: linux, Duration: 1500 * time.Millisecond},
+		{Platform: windows, Duration: time.Second, Err: fmt.Errorf("boom")},
+		{Platform: windows, UpToDate: true},
+	})
+	if err := timings.Save(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	timings, err = LoadShardTimings(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]float64{"darwin/arm64": 4, "linux/amd64": 3.5}
+	if !reflect.DeepEqual(timings.Platforms, expected) {
+		t.Fatalf("bad: %#v", timings.Platforms)
+	}
+
+	// Platforms without timings weigh the average
+	if w := timings.weight(windows); w != 3.75 {
+		t.Fatalf("bad: %f", w)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignConfig is the "sign" section of the config file. It signs
+// artifacts with a key that never leaves a cloud KMS, AWS KMS, Google
+// Cloud KMS or Azure Key Vault, for CI runners that mustn't hold private
+// keys. The signature of each artifact is written next to it as
+// <name>.sig, the base64 of the DER signature of its SHA-256, the format
+// that "cosign verify-blob" and "openssl dgst -verify" check.
+//
+// The CLI of the cloud, aws, gcloud or az, does the signing, so it
+// authenticates with whatever credentials it finds: the IAM role of the
+// instance or of the CI job with OIDC, workload identity, or a managed
+// identity.
+type SignConfig struct {
+	// Key is the URI of the key, as cosign takes them:
+	//
+	//   awskms:///<key ID, alias or ARN>, or awskms://<endpoint>/<key>
+	//   gcpkms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>
+	//   azurekms://<vault>.vault.azure.net/<key>[/<version>]
+	Key string `json:"key"`
+
+	// Algorithm is the signing algorithm of the key, "ecdsa-sha256" (the
+	// default), "rsa-pkcs1-sha256" or "rsa-pss-sha256". Google Cloud KMS
+	// keys only have the one they were created with.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Kinds are the kinds of artifacts in the manifest to sign, as in
+	// UploadConfig, and default to checksums.
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+const signatureExt = ".sig"
+
+// The signing algorithms of SignConfig, with their names in AWS KMS and
+// Azure Key Vault.
+var signAlgorithms = map[string][2]string{
+	"ecdsa-sha256":     {"ECDSA_SHA_256", "ES256"},
+	"rsa-pkcs1-sha256": {"RSASSA_PKCS1_V1_5_SHA_256", "RS256"},
+	"rsa-pss-sha256":   {"RSASSA_PSS_SHA_256", "PS256"},
+}
+
+// kmsKey is a parsed key URI of SignConfig.
+type kmsKey struct {
+	// Scheme is awskms, gcpkms or azurekms.
+	Scheme string
+
+	// Host is the endpoint of AWS KMS, if not the one of the region, or
+	// the vault of Azure.
+	Host string
+
+	// ID is the key ID, alias or ARN of AWS KMS, the resource name of the
+	// key version of Google Cloud KMS, or the name and version of the key
+	// in the vault of Azure.
+	ID string
+}
+
+// parseKMSKey parses the URI of a key.
+func parseKMSKey(uri string) (*kmsKey, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("sign: key %q isn't a URI: %s", uri, err)
+	}
+	k := &kmsKey{Scheme: u.Scheme, Host: u.Host, ID: strings.Trim(u.Path, "/")}
+	if k.Scheme == "gcpkms" {
+		// The resource name starts at the host
+		k.Host, k.ID = "", strings.Trim(u.Host+u.Path, "/")
+	}
+
+	switch k.Scheme {
+	case "awskms":
+		if k.ID == "" {
+			return nil, fmt.Errorf("sign: key %q has no key ID, alias or ARN", uri)
+		}
+	case "gcpkms":
+		parts := strings.Split(k.ID, "/")
+		if len(parts) != 10 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" ||
+			parts[6] != "cryptoKeys" || parts[8] != "cryptoKeyVersions" {
+			return nil, fmt.Errorf("sign: key %q must be projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>", uri)
+		}
+	case "azurekms":
+		if parts := strings.Split(k.ID, "/"); k.Host == "" || k.ID == "" || len(parts) > 2 {
+			return nil, fmt.Errorf("sign: key %q must be azurekms://<vault>.vault.azure.net/<key>[/<version>]", uri)
+		}
+	default:
+		return nil, fmt.Errorf("sign: key %q must be an awskms://, gcpkms:// or azurekms:// URI", uri)
+	}
+	return k, nil
+}
+
+// command is the CLI that signs with the key.
+func (k *kmsKey) command() string {
+	return map[string]string{"awskms": "aws", "gcpkms": "gcloud", "azurekms": "az"}[k.Scheme]
+}
+
+// Validate checks the key URI and the algorithm.
+func (c *SignConfig) Validate() error {
+	if c.Key == "" {
+		return fmt.Errorf("sign: key is required")
+	}
+	if _, err := parseKMSKey(c.Key); err != nil {
+		return err
+	}
+	if _, ok := signAlgorithms[c.algorithm()]; !ok {
+		return fmt.Errorf("sign: unknown algorithm %q, must be ecdsa-sha256, rsa-pkcs1-sha256 or rsa-pss-sha256", c.Algorithm)
+	}
+
+	return nil
+}
+
+func (c *SignConfig) algorithm() string {
+	if c.Algorithm == "" {
+		return "ecdsa-sha256"
+	}
+	return c.Algorithm
+}
+
+// command is the CLI that signs, which must be on the PATH.
+func (c *SignConfig) command() string {
+	k, err := parseKMSKey(c.Key)
+	if err != nil {
+		return ""
+	}
+	return k.command()
+}
+
+// Artifacts returns the artifacts of m that are signed, with their paths.
+func (c *SignConfig) Artifacts(m *ArtifactManifest) ([]Artifact, []string) {
+	kinds := c.Kinds
+	if len(kinds) == 0 {
+		kinds = []string{artifactChecksums}
+	}
+	return selectArtifacts(m, kinds)
+}
+
+// Sign signs the file at path with the key and writes the signature to
+// path.sig, whose path it returns.
+func (c *SignConfig) Sign(path string) (string, error) {
+	k, err := parseKMSKey(c.Key)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch k.Scheme {
+	case "awskms":
+		signature, err = c.signAWS(k, digest)
+	case "gcpkms":
+		signature, err = c.signGCP(k, path)
+	default:
+		signature, err = c.signAzure(k, digest)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", k.command(), err)
+	}
+
+	sigPath := path + signatureExt
+	return sigPath, ioutil.WriteFile(sigPath, []byte(base64.StdEncoding.EncodeToString(signature)), 0644)
+}
+
+// signAWS signs the digest with "aws kms sign", which takes it from a
+// file and prints the base64 DER signature.
+func (c *SignConfig) signAWS(k *kmsKey, digest []byte) ([]byte, error) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(td)
+	digestPath := filepath.Join(td, "digest")
+	if err := ioutil.WriteFile(digestPath, digest, 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"kms", "sign",
+		"--key-id", k.ID,
+		"--message", "fileb://" + digestPath,
+		"--message-type", "DIGEST",
+		"--signing-algorithm", signAlgorithms[c.algorithm()][0],
+		"--output", "text", "--query", "Signature",
+	}
+	if k.Host != "" {
+		args = append(args, "--endpoint-url", "https://"+k.Host)
+	}
+	output, err := execGo("aws", secretEnviron(), "", args...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSignature(output)
+}
+
+// signGCP signs the file with "gcloud kms asymmetric-sign", which hashes
+// it and writes the DER signature to a file.
+func (c *SignConfig) signGCP(k *kmsKey, path string) ([]byte, error) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(td)
+	sigPath := filepath.Join(td, "signature")
+
+	parts := strings.Split(k.ID, "/")
+	if _, err := execGo("gcloud", secretEnviron(), "", "kms", "asymmetric-sign",
+		"--project", parts[1],
+		"--location", parts[3],
+		"--keyring", parts[5],
+		"--key", parts[7],
+		"--version", parts[9],
+		"--digest-algorithm", "sha256",
+		"--input-file", path,
+		"--signature-file", sigPath,
+	); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(sigPath)
+}
+
+// signAzure signs the digest with "az keyvault key sign", which prints
+// the key operation result, with the signature in base64url as its
+// "result". Key Vault signs with ECDSA as JWS does, with the two numbers
+// of the signature one after the other, so they are turned into DER like
+// those of the other clouds.
+func (c *SignConfig) signAzure(k *kmsKey, digest []byte) ([]byte, error) {
+	algorithm := signAlgorithms[c.algorithm()][1]
+	output, err := execGo("az", secretEnviron(), "", "keyvault", "key", "sign",
+		"--id", "https://"+k.Host+"/keys/"+k.ID,
+		"--algorithm", algorithm,
+		"--digest", base64.StdEncoding.EncodeToString(digest),
+		"--output", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil || result.Result == "" {
+		return nil, fmt.Errorf("unexpected output: %s", strings.TrimSpace(output))
+	}
+	signature, err := decodeSignature(result.Result)
+	if err != nil || algorithm != "ES256" {
+		return signature, err
+	}
+	if len(signature) != 64 {
+		return nil, fmt.Errorf("ES256 signature is %d bytes, not 64", len(signature))
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(signature[:32]),
+		new(big.Int).SetBytes(signature[32:]),
+	})
+}
+
+// decodeSignature decodes a signature that a CLI printed in base64, with
+// or without padding and in either alphabet.
+func decodeSignature(output string) ([]byte, error) {
+	s := strings.TrimSpace(output)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if signature, err := enc.DecodeString(s); err == nil && len(signature) > 0 {
+			return signature, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected output: %s", s)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseKMSKey(t *testing.T) {
+	cases := []struct {
+		URI string
+		Key kmsKey
+		Err bool
+	}{
+		{"awskms:///alias/release", kmsKey{Scheme: "awskms", ID: "alias/release"}, false},
+		{
+			"awskms:///arn:aws:kms:us-east-1:111122223333:key/1234abcd",
+			kmsKey{Scheme: "awskms", ID: "arn:aws:kms:us-east-1:111122223333:key/1234abcd"},
+			false,
+		},
+		{"awskms://localhost:4566/1234abcd", kmsKey{Scheme: "awskms", Host: "localhost:4566", ID: "1234abcd"}, false},
+		{"awskms:///", kmsKey{}, true},
+		{
+			"gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+			kmsKey{Scheme: "gcpkms", ID: "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"},
+			false,
+		},
+		{"gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k", kmsKey{}, true},
+		{"azurekms://example.vault.azure.net/release", kmsKey{Scheme: "azurekms", Host: "example.vault.azure.net", ID: "release"}, false},
+		{"azurekms://example.vault.azure.net/release/0123", kmsKey{Scheme: "azurekms", Host: "example.vault.azure.net", ID: "release/0123"}, false},
+		{"azurekms://example.vault.azure.net", kmsKey{}, true},
+		{"hashivault://release", kmsKey{}, true},
+		{"release.pem", kmsKey{}, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := parseKMSKey(tc.URI)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.URI, err)
+		}
+		if err == nil && *actual != tc.Key {
+			t.Fatalf("%s: bad: %#v", tc.URI, actual)
+		}
+	}
+}
+
+func TestSignConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config SignConfig
+		Err    bool
+	}{
+		{SignConfig{Key: "awskms:///alias/release"}, false},
+		{SignConfig{Key: "awskms:///alias/release", Algorithm: "rsa-pss-sha256"}, false},
+		{SignConfig{Key: "awskms:///alias/release", Algorithm: "ed25519"}, true},
+		{SignConfig{Key: "gcpkms://projects/p"}, true},
+		{SignConfig{}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Config.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestSignConfigArtifacts(t *testing.T) {
+	m := NewArtifactManifest("dist")
+	m.Artifacts = []Artifact{
+		{Kind: artifactArchive, Path: "app_linux_amd64.tar.gz", Platform: "linux/amd64"},
+		{Kind: artifactChecksums, Path: "SHA256SUMS"},
+	}
+
+	c := &SignConfig{}
+	if artifacts, _ := c.Artifacts(m); len(artifacts) != 1 || artifacts[0].Kind != artifactChecksums {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+	c.Kinds = []string{artifactArchive, artifactChecksums}
+	if artifacts, _ := c.Artifacts(m); len(artifacts) != 2 {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+
+	m.AddFor(artifactSignature, m.Artifacts[0], filepath.Join("dist", "app_linux_amd64.tar.gz.sig"))
+	if a := m.Artifacts[2]; a.Kind != artifactSignature || a.Platform != "linux/amd64" || a.Path != "app_linux_amd64.tar.gz.sig" {
+		t.Fatalf("bad: %#v", a)
+	}
+}
+
+func TestSignConfigSign(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts as the CLIs")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "SHA256SUMS")
+	ioutil.WriteFile(path, []byte("sums"), 0644)
+
+	// The fake CLIs record their arguments and print what the real ones
+	// do: aws the signature only when queried for it, gcloud nothing, as
+	// it writes the signature to a file, and az the key operation result.
+	// They sign with "der", or, as Key Vault does for ES256, 64 bytes of r
+	// and s. aws keeps the digest it was given.
+	rs := make([]byte, 64)
+	rs[31], rs[63] = 1, 2
+	args := filepath.Join(td, "args")
+	message := filepath.Join(td, "message")
+	azResult := func(signature []byte) string {
+		return "printf '{\"kid\": \"https://example.vault.azure.net/keys/release/1\", \"result\": \"" +
+			base64.RawURLEncoding.EncodeToString(signature) + "\"}\\n'\n"
+	}
+	scripts := map[string]string{
+		"aws": "echo \"$@\" > " + args + "\n" +
+			"for arg in \"$@\"; do case \"$arg\" in fileb://*) cp \"${arg#fileb://}\" " + message + ";; esac; done\n" +
+			"case \"$*\" in *\"--output text --query Signature\"*) echo ZGVy;; " +
+			"*) echo '{\"KeyId\": \"alias/release\", \"Signature\": \"ZGVy\"}';; esac\n",
+		"gcloud": "echo \"$@\" > " + args + "\n" +
+			"while [ $# -gt 0 ]; do [ \"$1\" = --signature-file ] && printf der > \"$2\"; shift; done\n",
+		"az": "echo \"$@\" > " + args + "\n" +
+			"case \"$*\" in *ES256*) " + azResult(rs) + ";; *) " + azResult([]byte("der")) + ";; esac\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", td+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	der, _ := asn1.Marshal(struct{ R, S *big.Int }{big.NewInt(1), big.NewInt(2)})
+	digest := sha256.Sum256([]byte("sums"))
+	cases := []struct {
+		Config    SignConfig
+		Args      []string
+		Signature []byte
+	}{
+		{
+			SignConfig{Key: "awskms://localhost:4566/alias/release", Algorithm: "rsa-pkcs1-sha256"},
+			[]string{
+				"kms sign --key-id alias/release --message fileb://",
+				"--signing-algorithm RSASSA_PKCS1_V1_5_SHA_256",
+				"--endpoint-url https://localhost:4566",
+			},
+			[]byte("der"),
+		},
+		{
+			SignConfig{Key: "gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"},
+			[]string{"kms asymmetric-sign --project p --location global --keyring r --key k --version 1 " +
+				"--digest-algorithm sha256 --input-file " + path},
+			[]byte("der"),
+		},
+		{
+			SignConfig{Key: "azurekms://example.vault.azure.net/release"},
+			[]string{"keyvault key sign --id https://example.vault.azure.net/keys/release --algorithm ES256 " +
+				"--digest " + base64.StdEncoding.EncodeToString(digest[:])},
+			der,
+		},
+		{
+			SignConfig{Key: "azurekms://example.vault.azure.net/release/1", Algorithm: "rsa-pss-sha256"},
+			[]string{"keyvault key sign --id https://example.vault.azure.net/keys/release/1 --algorithm PS256"},
+			[]byte("der"),
+		},
+	}
+
+	for _, tc := range cases {
+		sigPath, err := tc.Config.Sign(path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Config.Key, err)
+		}
+		if sigPath != path+".sig" {
+			t.Fatalf("%s: bad: %s", tc.Config.Key, sigPath)
+		}
+		data, _ := ioutil.ReadFile(sigPath)
+		if signature, err := base64.StdEncoding.DecodeString(string(data)); err != nil || string(signature) != string(tc.Signature) {
+			t.Fatalf("%s: bad: %q", tc.Config.Key, data)
+		}
+		actual, _ := ioutil.ReadFile(args)
+		for _, arg := range tc.Args {
+			if !strings.Contains(string(actual), arg) {
+				t.Fatalf("%s: bad: %s", tc.Config.Key, actual)
+			}
+		}
+	}
+
+	// aws signs the digest of the file, not the file
+	if actual, _ := ioutil.ReadFile(message); string(actual) != string(digest[:]) {
+		t.Fatalf("bad digest: %x", actual)
+	}
+}
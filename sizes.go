@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SizeChange is the size of an artifact in an earlier build, 0 if it
+// wasn't in it, and now.
+type SizeChange struct {
+	Name   string
+	Before int64
+	After  int64
+}
+
+// Growth returns how many bytes bigger the artifact got.
+func (c SizeChange) Growth() int64 {
+	return c.After - c.Before
+}
+
+// SizeThreshold is how much an artifact may grow: by Percent of its
+// earlier size, or by Bytes.
+type SizeThreshold struct {
+	Percent float64
+	Bytes   int64
+}
+
+// parseSizeThreshold parses a -threshold, a percentage such as "10%" or a
+// size such as "512K".
+func parseSizeThreshold(value string) (SizeThreshold, error) {
+	s := strings.TrimSpace(value)
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p < 0 {
+			return SizeThreshold{}, fmt.Errorf("%q isn't a percentage such as 10%%", value)
+		}
+		return SizeThreshold{Percent: p}, nil
+	}
+	n, err := parseSize(s)
+	if err != nil || s == "" {
+		return SizeThreshold{}, fmt.Errorf("%q isn't a percentage such as 10%% or a size such as 512K", value)
+	}
+	return SizeThreshold{Bytes: n}, nil
+}
+
+func (t SizeThreshold) String() string {
+	if t.Bytes > 0 {
+		return formatSize(t.Bytes)
+	}
+	return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+}
+
+// Exceeded reports whether c grew by more than the threshold. New
+// artifacts have nothing to grow from.
+func (t SizeThreshold) Exceeded(c SizeChange) bool {
+	if c.Before == 0 {
+		return false
+	}
+	if t.Bytes > 0 {
+		return c.Growth() > t.Bytes
+	}
+	return percent(c.Growth(), c.Before) > t.Percent
+}
+
+// CompareManifestSizes returns how the binaries of m changed in size
+// since the build of previous, matched by their platform, package and
+// variant. Packages are only named when m has more than one.
+func CompareManifestSizes(previous, m *ArtifactManifest) []SizeChange {
+	key := func(a Artifact) string {
+		return a.Platform + " " + a.Package + " " + a.Variant
+	}
+	before := make(map[string]int64)
+	for _, a := range previous.Artifacts {
+		if a.Kind == artifactBinary {
+			before[key(a)] = a.Size
+		}
+	}
+	packages := make(map[string]bool)
+	for _, a := range m.Artifacts {
+		if a.Kind == artifactBinary {
+			packages[a.Package] = true
+		}
+	}
+
+	var changes []SizeChange
+	for _, a := range m.Artifacts {
+		if a.Kind != artifactBinary {
+			continue
+		}
+		name := a.Platform
+		if len(packages) > 1 {
+			name += " " + a.Package
+		}
+		if a.Variant != "" {
+			name += " (" + a.Variant + ")"
+		}
+		changes = append(changes, SizeChange{Name: name, Before: before[key(a)], After: a.Size})
+	}
+	sortSizeChanges(changes)
+	return changes
+}
+
+// CompareReleaseSizes returns how the artifacts with a platform, of the
+// build of version, changed in size since the release of previousVersion,
+// whose assets have the sizes. Artifacts and assets are matched by their
+// names with the versions left out.
+func CompareReleaseSizes(sizes map[string]int64, previousVersion string, artifacts []Artifact, version string) []SizeChange {
+	before := make(map[string]int64)
+	for name, size := range sizes {
+		before[sizeName(name, previousVersion)] = size
+	}
+
+	var changes []SizeChange
+	for _, a := range artifacts {
+		if a.Platform == "" || a.Kind == artifactSignature {
+			continue
+		}
+		name := filepath.Base(filepath.FromSlash(a.Path))
+		changes = append(changes, SizeChange{Name: name, Before: before[sizeName(name, version)], After: a.Size})
+	}
+	sortSizeChanges(changes)
+	return changes
+}
+
+// sizeName returns the name of an artifact of version with the version
+// left out. Builds without a version are "0", which can be anywhere.
+func sizeName(name, version string) string {
+	if version == "" || version == "0" {
+		return name
+	}
+	return strings.Replace(name, version, "{{.Version}}", -1)
+}
+
+func sortSizeChanges(changes []SizeChange) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+}
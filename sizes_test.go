@@ -0,0 +1,108 @@
+package main
+
+import "testing"
+
+func TestParseSizeThreshold(t *testing.T) {
+	cases := []struct {
+		Input     string
+		Threshold SizeThreshold
+		Err       bool
+	}{
+		{"10%", SizeThreshold{Percent: 10}, false},
+		{"2.5%", SizeThreshold{Percent: 2.5}, false},
+		{"512K", SizeThreshold{Bytes: 512 << 10}, false},
+		{"1M", SizeThreshold{Bytes: 1 << 20}, false},
+		{"-1%", SizeThreshold{}, true},
+		{"much", SizeThreshold{}, true},
+		{"", SizeThreshold{}, true},
+	}
+	for _, tc := range cases {
+		actual, err := parseSizeThreshold(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if actual != tc.Threshold {
+			t.Fatalf("%s: bad: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestSizeThresholdExceeded(t *testing.T) {
+	cases := []struct {
+		Threshold SizeThreshold
+		Change    SizeChange
+		Exceeded  bool
+	}{
+		{SizeThreshold{Percent: 10}, SizeChange{Before: 1000, After: 1100}, false},
+		{SizeThreshold{Percent: 10}, SizeChange{Before: 1000, After: 1101}, true},
+		{SizeThreshold{Percent: 10}, SizeChange{Before: 1000, After: 500}, false},
+		{SizeThreshold{Percent: 10}, SizeChange{After: 5000}, false},
+		{SizeThreshold{Bytes: 100}, SizeChange{Before: 1000, After: 1101}, true},
+		{SizeThreshold{Bytes: 200}, SizeChange{Before: 1000, After: 1101}, false},
+	}
+	for _, tc := range cases {
+		if actual := tc.Threshold.Exceeded(tc.Change); actual != tc.Exceeded {
+			t.Fatalf("bad: %#v %#v: %t", tc.Threshold, tc.Change, actual)
+		}
+	}
+}
+
+func TestCompareManifestSizes(t *testing.T) {
+	previous := NewArtifactManifest("old")
+	previous.Artifacts = []Artifact{
+		{Kind: artifactBinary, Platform: "linux/amd64", Package: "ex.com/a", Size: 1000},
+		{Kind: artifactBinary, Platform: "linux/amd64", Package: "ex.com/a", Variant: fipsVariant, Size: 1200},
+		{Kind: artifactArchive, Platform: "linux/amd64", Package: "ex.com/a", Size: 400},
+	}
+	m := NewArtifactManifest("dist")
+	m.Artifacts = []Artifact{
+		{Kind: artifactBinary, Platform: "linux/amd64", Package: "ex.com/a", Size: 1500},
+		{Kind: artifactBinary, Platform: "linux/amd64", Package: "ex.com/a", Variant: fipsVariant, Size: 1100},
+		{Kind: artifactBinary, Platform: "darwin/arm64", Package: "ex.com/a", Size: 900},
+		{Kind: artifactArchive, Platform: "linux/amd64", Package: "ex.com/a", Size: 600},
+	}
+
+	expected := []SizeChange{
+		{"darwin/arm64", 0, 900},
+		{"linux/amd64", 1000, 1500},
+		{"linux/amd64 (fips)", 1200, 1100},
+	}
+	actual := CompareManifestSizes(previous, m)
+	if len(actual) != len(expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+
+	// Packages are named when there is more than one
+	m.Artifacts = append(m.Artifacts, Artifact{Kind: artifactBinary, Platform: "linux/amd64", Package: "ex.com/b", Size: 10})
+	if actual := CompareManifestSizes(previous, m); actual[1].Name != "linux/amd64 ex.com/a" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestCompareReleaseSizes(t *testing.T) {
+	sizes := map[string]int64{
+		"app_1.2.0_linux_amd64.tar.gz": 1000,
+		"app_1.2.0_windows_arm64.zip":  2000,
+		"SHA256SUMS":                   100,
+	}
+	artifacts := []Artifact{
+		{Kind: artifactArchive, Platform: "linux/amd64", Path: "app_1.3.0_linux_amd64.tar.gz", Size: 1300},
+		{Kind: artifactArchive, Platform: "darwin/arm64", Path: "app_1.3.0_darwin_arm64.tar.gz", Size: 900},
+		{Kind: artifactSignature, Platform: "linux/amd64", Path: "app_1.3.0_linux_amd64.tar.gz.sig", Size: 64},
+		{Kind: artifactChecksums, Path: "SHA256SUMS", Size: 120},
+	}
+
+	expected := []SizeChange{
+		{"app_1.3.0_darwin_arm64.tar.gz", 0, 900},
+		{"app_1.3.0_linux_amd64.tar.gz", 1000, 1300},
+	}
+	actual := CompareReleaseSizes(sizes, "1.2.0", artifacts, "1.3.0")
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// smokeTimeout is how long a smoke test may run before it fails.
+const smokeTimeout = 30 * time.Second
+
+// qemuArchs maps GOARCH to the name of its qemu-user emulator.
+var qemuArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// qemuARMCPUs are the CPUs that qemu-arm emulates for each GOARM, so that
+// a binary built for too new an ARM fails instead of running anyways.
+var qemuARMCPUs = map[string]string{
+	"5": "arm926",
+	"6": "arm1176",
+	"7": "cortex-a8",
+}
+
+// SmokeTest is a run of a built binary with some arguments, to check that
+// it starts at all on its platform.
+type SmokeTest struct {
+	Args []string
+	Host Platform
+
+	// LookPath finds emulators, exec.LookPath if nil.
+	LookPath func(string) (string, error)
+
+	// BinfmtDir is where binfmt_misc registrations are looked for, which
+	// let the kernel run foreign binaries with qemu directly.
+	BinfmtDir string
+}
+
+// command returns the command line that runs the binary at path, built
+// for platform, the environment it adds, and the name of what runs it.
+// The runner is "" when nothing on this machine can run the platform, and
+// the binary isn't tested.
+func (s *SmokeTest) command(platform Platform, path string) ([]string, []string, string) {
+	lookPath := s.LookPath
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+	binfmt := s.BinfmtDir
+	if binfmt == "" {
+		binfmt = "/proc/sys/fs/binfmt_misc"
+	}
+
+	native := platform.OS == s.Host.OS && platform.Arch == s.Host.Arch
+	var args []string
+	var env []string
+	var runner string
+	switch {
+	case native:
+		args, runner = []string{path}, "native"
+	case platform.OS == "linux" && s.Host.OS == "linux":
+		qemu, ok := qemuArchs[platform.Arch]
+		if !ok {
+			return nil, nil, ""
+		}
+		if cpu := qemuARMCPUs[platform.ARM]; cpu != "" && platform.Arch == "arm" {
+			env = append(env, "QEMU_CPU="+cpu)
+		}
+		if emulator, err := lookPath("qemu-" + qemu); err == nil {
+			args, runner = []string{emulator, path}, "qemu-"+qemu
+		} else if _, err := os.Stat(filepath.Join(binfmt, "qemu-"+qemu)); err == nil {
+			args, runner = []string{path}, "binfmt qemu-"+qemu
+		} else {
+			return nil, nil, ""
+		}
+	case platform.OS == "windows" && s.Host.OS != "windows":
+		for _, wine := range []string{"wine64", "wine"} {
+			if emulator, err := lookPath(wine); err == nil {
+				args, runner = []string{emulator, path}, wine
+				break
+			}
+		}
+		if runner == "" {
+			return nil, nil, ""
+		}
+
+		// Keep wine from asking to set up a prefix in a window
+		env = append(env, "WINEDEBUG=-all", "WINEDLLOVERRIDES=mscoree,mshtml=")
+	default:
+		return nil, nil, ""
+	}
+
+	return append(args, s.Args...), env, runner
+}
+
+// Run runs the smoke test of the binary at path. It returns the name of
+// what ran it, or "" if nothing could, and an error with the binary's
+// output if it failed or didn't exit in time.
+func (s *SmokeTest) Run(platform Platform, path string) (string, error) {
+	args, env, runner := s.command(platform, path)
+	if runner == "" {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), smokeTimeout)
+	defer cancel()
+	ui.Command("", env, args[0], args[1:]...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", smokeTimeout)
+	}
+	if err != nil {
+		return runner, fmt.Errorf("smoke test under %s failed: %s\n%s",
+			runner, err, strings.TrimSpace(output.String()))
+	}
+
+	return runner, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSmokeTestCommand(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	if err := ioutil.WriteFile(filepath.Join(td, "qemu-riscv64"), nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := &SmokeTest{
+		Args: []string{"--version"},
+		Host: Platform{OS: "linux", Arch: "amd64"},
+		LookPath: func(name string) (string, error) {
+			if name == "qemu-aarch64" || name == "qemu-arm" || name == "wine" {
+				return "/usr/bin/" + name, nil
+			}
+			return "", fmt.Errorf("not found")
+		},
+		BinfmtDir: td,
+	}
+
+	cases := []struct {
+		Platform Platform
+		Args     []string
+		Env      []string
+		Runner   string
+	}{
+		{
+			Platform{OS: "linux", Arch: "amd64"},
+			[]string{"app", "--version"}, nil, "native",
+		},
+		{
+			Platform{OS: "linux", Arch: "arm64"},
+			[]string{"/usr/bin/qemu-aarch64", "app", "--version"}, nil, "qemu-aarch64",
+		},
+		{
+			Platform{OS: "linux", Arch: "arm", ARM: "6"},
+			[]string{"/usr/bin/qemu-arm", "app", "--version"}, []string{"QEMU_CPU=arm1176"}, "qemu-arm",
+		},
+		{
+			Platform{OS: "linux", Arch: "riscv64"},
+			[]string{"app", "--version"}, nil, "binfmt qemu-riscv64",
+		},
+		{
+			Platform{OS: "windows", Arch: "amd64"},
+			[]string{"/usr/bin/wine", "app", "--version"},
+			[]string{"WINEDEBUG=-all", "WINEDLLOVERRIDES=mscoree,mshtml="}, "wine",
+		},
+		{Platform{OS: "linux", Arch: "s390x"}, nil, nil, ""},
+		{Platform{OS: "darwin", Arch: "arm64"}, nil, nil, ""},
+	}
+
+	for _, tc := range cases {
+		args, env, runner := s.command(tc.Platform, "app")
+		if !reflect.DeepEqual(args, tc.Args) || !reflect.DeepEqual(env, tc.Env) || runner != tc.Runner {
+			t.Fatalf("%s: bad: %#v %#v %q", tc.Platform.String(), args, env, runner)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SnapConfig is the "snap" section of the config file. It packs each
+// linux/amd64 and linux/arm64 binary into a snap, the way `snap pack`
+// does: a squashfs of the binary and meta/snap.yaml, made with mksquashfs,
+// which must be installed.
+type SnapConfig struct {
+	// Command is the mksquashfs executable, defaults to "mksquashfs".
+	Command string `json:"command,omitempty"`
+
+	// Output is the directory snaps are written to, defaults to the
+	// directory of each binary.
+	Output string `json:"output,omitempty"`
+
+	// Name is the name of the snap and of its app, defaults to the name
+	// of the binary. Version defaults to the release version.
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	License     string `json:"license,omitempty"`
+
+	// Base, Grade and Confinement default to "core22", "stable" and
+	// "strict". Plugs are the interfaces the app connects to, such as
+	// "network" or "home".
+	Base        string   `json:"base,omitempty"`
+	Grade       string   `json:"grade,omitempty"`
+	Confinement string   `json:"confinement,omitempty"`
+	Plugs       []string `json:"plugs,omitempty"`
+}
+
+// snapNameRe matches the names that the snap store allows.
+var snapNameRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Validate checks the summary, and the name, grade and confinement if
+// they are set, against what snapcraft accepts.
+func (c *SnapConfig) Validate() error {
+	if c.Summary == "" {
+		return fmt.Errorf("snap: summary is required")
+	}
+	if len(c.Summary) > 78 {
+		return fmt.Errorf("snap: summary must be at most 78 characters")
+	}
+	if c.Name != "" && (!snapNameRe.MatchString(c.Name) || len(c.Name) > 40) {
+		return fmt.Errorf("snap: invalid name %q: must be lowercase letters, digits and hyphens", c.Name)
+	}
+	switch c.Grade {
+	case "", "stable", "devel":
+	default:
+		return fmt.Errorf("snap: grade must be stable or devel")
+	}
+	switch c.Confinement {
+	case "", "strict", "classic", "devmode":
+	default:
+		return fmt.Errorf("snap: confinement must be strict, classic or devmode")
+	}
+
+	return nil
+}
+
+func (c *SnapConfig) command() string {
+	if c.Command == "" {
+		return "mksquashfs"
+	}
+	return c.Command
+}
+
+// name returns the name of the snap of binary.
+func (c *SnapConfig) name(binary string) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(binary), filepath.Ext(binary)))
+}
+
+// snapYAML returns the meta/snap.yaml of the snap of binary for goarch.
+func (c *SnapConfig) snapYAML(binary, goarch, version string) []byte {
+	name := c.name(binary)
+	values := map[string]string{
+		"base":        c.Base,
+		"grade":       c.Grade,
+		"confinement": c.Confinement,
+	}
+	defaults := map[string]string{"base": "core22", "grade": "stable", "confinement": "strict"}
+	for k, v := range values {
+		if v == "" {
+			values[k] = defaults[k]
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "name: %s\nversion: %s\nsummary: %s\n", name, strconv.Quote(version), strconv.Quote(c.Summary))
+	if c.Description != "" {
+		fmt.Fprintf(&buf, "description: %s\n", strconv.Quote(c.Description))
+	}
+	if c.License != "" {
+		fmt.Fprintf(&buf, "license: %s\n", strconv.Quote(c.License))
+	}
+	fmt.Fprintf(&buf, "architectures: [%s]\n", goarch)
+	for _, k := range []string{"base", "grade", "confinement"} {
+		fmt.Fprintf(&buf, "%s: %s\n", k, values[k])
+	}
+	fmt.Fprintf(&buf, "apps:\n  %s:\n    command: bin/%s\n", name, filepath.Base(binary))
+	if len(c.Plugs) > 0 {
+		fmt.Fprintf(&buf, "    plugs: [%s]\n", strings.Join(c.Plugs, ", "))
+	}
+	return buf.Bytes()
+}
+
+// SnapPackage packs binary into a snap and returns its path. If desktop
+// is set, its entry and icon are in meta/gui.
+func SnapPackage(c *SnapConfig, desktop *DesktopConfig, binary string, platform Platform, version string) (string, error) {
+	if c.Version != "" {
+		version = c.Version
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(td)
+
+	name := c.name(binary)
+	files := map[string][]byte{
+		"meta/snap.yaml": c.snapYAML(binary, platform.Arch, version),
+	}
+	if desktop != nil {
+		var icon string
+		if desktop.Icon != "" {
+			icon = "${SNAP}/meta/gui/icon" + filepath.Ext(desktop.Icon)
+			if err := copyFile(desktop.Icon, filepath.Join(td, "meta", "gui", filepath.Base(icon)), 0644); err != nil {
+				return "", err
+			}
+		}
+		files["meta/gui/"+name+".desktop"] = desktop.entry(name, name, icon)
+	}
+	for path, data := range files {
+		path = filepath.Join(td, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := copyFile(binary, filepath.Join(td, "bin", filepath.Base(binary)), 0755); err != nil {
+		return "", err
+	}
+
+	outDir := c.Output
+	if outDir == "" {
+		outDir = filepath.Dir(binary)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(outDir, fmt.Sprintf("%s_%s_%s.snap", name, version, platform.Arch))
+
+	// These are the options that snap pack runs mksquashfs with
+	if _, err := execGo(c.command(), nil, "", td, target,
+		"-noappend", "-comp", "xz", "-all-root", "-no-xattrs", "-no-fragments"); err != nil {
+		return "", fmt.Errorf("mksquashfs failed: %s", strings.TrimSpace(err.Error()))
+	}
+
+	return target, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSnapConfigSnapYAML(t *testing.T) {
+	c := &SnapConfig{Summary: "My tool", Grade: "devel", Plugs: []string{"network", "home"}}
+	actual := string(c.snapYAML("/dist/linux_amd64/MyTool", "amd64", "1.2.3"))
+	expected := `name: mytool
+version: "1.2.3"
+summary: "My tool"
+architectures: [amd64]
+base: core22
+grade: devel
+confinement: strict
+apps:
+  mytool:
+    command: bin/MyTool
+    plugs: [network, home]
+`
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestSnapConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config SnapConfig
+		Err    bool
+	}{
+		{SnapConfig{Summary: "tool"}, false},
+		{SnapConfig{}, true},
+		{SnapConfig{Summary: "tool", Name: "My_Tool"}, true},
+		{SnapConfig{Summary: "tool", Confinement: "loose"}, true},
+	}
+
+	for i, tc := range cases {
+		if err := tc.Config.Validate(); (err != nil) != tc.Err {
+			t.Fatalf("%d: bad: %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ConcurrencyConfig is the "concurrency" section of the config file. It
+// caps how many operations of each stage run at once, since each stage is
+// bound by something different: CPU for builds, disk for archives, the
+// signing device for signatures, and the network for uploads. Zero means
+// the stage uses the build parallelism.
+type ConcurrencyConfig struct {
+	Build   int `json:"build,omitempty"`
+	Package int `json:"package,omitempty"`
+	Archive int `json:"archive,omitempty"`
+	Sign    int `json:"sign,omitempty"`
+	Upload  int `json:"upload,omitempty"`
+}
+
+// Validate checks that no limit is negative.
+func (c *ConcurrencyConfig) Validate() error {
+	limits := map[string]int{
+		"build":   c.Build,
+		"package": c.Package,
+		"archive": c.Archive,
+		"sign":    c.Sign,
+		"upload":  c.Upload,
+	}
+	for name, v := range limits {
+		if v < 0 {
+			return fmt.Errorf("concurrency: %s must not be negative", name)
+		}
+	}
+
+	return nil
+}
+
+// stageLimit returns limit if it is set, and the fallback otherwise.
+func stageLimit(limit int, fallback int) int {
+	if limit > 0 {
+		return limit
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return 1
+}
+
+// runParallel calls fn for every index in [0, n), with at most limit
+// calls running at once, and waits for all of them to finish.
+func runParallel(limit int, n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	semaphore := make(chan int, stageLimit(limit, 1))
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			semaphore <- 1
+			defer func() { <-semaphore }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// runStage runs fn, at most limit at a time, on each successful result
+// built for the given OS, or for any OS if goos is empty, that wasn't up
+// to date, printing progress as it goes. It returns the
+// number of results that fn failed for. title is the heading printed
+// before the stage starts, and name describes the stage in errors.
+func runStage(title, name string, limit int, goos string, results []BuildResult, fn func(r BuildResult) error) int {
+	matched := make([]BuildResult, 0, len(results))
+	for _, r := range results {
+		if r.Err == nil && !r.UpToDate && (goos == "" || r.Platform.OS == goos) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) == 0 {
+		return 0
+	}
+
+	ui.Infof("\n%s:\n\n", title)
+	var lock sync.Mutex
+	var failed int
+	runParallel(limit, len(matched), func(i int) {
+		r := matched[i]
+		ui.Infof("--> %15s: %s\n", r.Platform.String(), r.Output)
+		if err := fn(r); err != nil {
+			lock.Lock()
+			defer lock.Unlock()
+			ui.Errorf("--> %s %s error: %s\n", ui.Failure(r.Platform.String()), name, err)
+			failed++
+		}
+	})
+
+	return failed
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStageLimit(t *testing.T) {
+	cases := []struct {
+		Limit, Fallback, Result int
+	}{
+		{0, 4, 4},
+		{2, 4, 2},
+		{0, 0, 1},
+		{-1, 3, 3},
+	}
+
+	for _, tc := range cases {
+		if actual := stageLimit(tc.Limit, tc.Fallback); actual != tc.Result {
+			t.Errorf("stageLimit(%d, %d) = %d", tc.Limit, tc.Fallback, actual)
+		}
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	var lock sync.Mutex
+	var running, max, count int
+	runParallel(2, 10, func(i int) {
+		lock.Lock()
+		running++
+		count++
+		if running > max {
+			max = running
+		}
+		lock.Unlock()
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+	})
+
+	if count != 10 {
+		t.Fatalf("bad count: %d", count)
+	}
+	if max > 2 {
+		t.Fatalf("bad max: %d", max)
+	}
+}
+
+func TestConcurrencyConfigValidate(t *testing.T) {
+	if err := (&ConcurrencyConfig{Sign: -1}).Validate(); err == nil {
+		t.Fatal("should err")
+	}
+	if err := (&ConcurrencyConfig{Sign: 1}).Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
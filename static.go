@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StaticConfig is the "static" section of the config file, for -static.
+type StaticConfig struct {
+	// Exceptions are the os/arch pairs that may link dynamically with
+	// -static, such as those that need a system library through cgo.
+	// They are built as they would be without -static.
+	Exceptions []string `json:"exceptions,omitempty"`
+}
+
+// Validate checks the exceptions.
+func (c *StaticConfig) Validate() error {
+	for _, v := range c.Exceptions {
+		if len(strings.Split(v, "/")) != 2 {
+			return fmt.Errorf("static: exception %s should be os/arch", v)
+		}
+	}
+
+	return nil
+}
+
+// allowsDynamic reports whether platform is one of the exceptions.
+func (c *StaticConfig) allowsDynamic(platform Platform) bool {
+	if c == nil {
+		return false
+	}
+	for _, v := range c.Exceptions {
+		if strings.ToLower(v) == platform.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canLinkStatic reports whether Go can link static binaries for goos.
+// Elsewhere the system's C library is how Go talks to the kernel, so its
+// binaries are always dynamically linked, and -static only turns off cgo.
+func canLinkStatic(goos string) bool {
+	switch goos {
+	case "freebsd", "linux", "netbsd":
+		return true
+	}
+
+	return false
+}
+
+// staticLdflags adds the flags that make the external linker of a cgo
+// build link statically.
+func staticLdflags(ldflags string) string {
+	return strings.TrimSpace(ldflags + ` -linkmode external -extldflags "-static"`)
+}
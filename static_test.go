@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestStaticConfig(t *testing.T) {
+	c := &StaticConfig{Exceptions: []string{"linux/riscv64"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.allowsDynamic(Platform{OS: "linux", Arch: "riscv64"}) {
+		t.Fatal("should allow dynamic")
+	}
+	if c.allowsDynamic(Platform{OS: "linux", Arch: "amd64"}) {
+		t.Fatal("should not allow dynamic")
+	}
+
+	var nilConfig *StaticConfig
+	if nilConfig.allowsDynamic(Platform{OS: "linux", Arch: "riscv64"}) {
+		t.Fatal("should not allow dynamic")
+	}
+
+	c = &StaticConfig{Exceptions: []string{"linux"}}
+	if err := c.Validate(); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestCompileOptsBuildEnv_static(t *testing.T) {
+	host := Platform{OS: "linux", Arch: "amd64"}
+	opts := &CompileOpts{Platform: host, Host: host, Static: true}
+	found := false
+	for _, e := range opts.buildEnv() {
+		found = found || e == "CGO_ENABLED=0"
+	}
+	if !found || opts.Cgo {
+		t.Fatal("static builds for the host should not use cgo")
+	}
+
+	if v := staticLdflags("-s"); v != `-s -linkmode external -extldflags "-static"` {
+		t.Fatalf("bad: %s", v)
+	}
+}
+
+func TestCheckHeader_static(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgo binaries are only checked on linux")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\n// int two() { return 2; }\nimport \"C\"\n\nfunc main() { println(C.two()) }\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	output := filepath.Join(td, "app")
+	cmd := exec.Command("go", "build", "-o", output, ".")
+	cmd.Dir = td
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("err: %s\n%s", err, out)
+	}
+
+	platform := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if err := CheckHeader(&CompileOpts{Platform: platform, Cgo: true}, output); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := CheckHeader(&CompileOpts{Platform: platform, Cgo: true, Static: true}, output); err == nil {
+		t.Fatal("a dynamically linked binary should fail -static")
+	}
+}
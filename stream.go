@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/iochan"
+)
+
+// platformColors are the ANSI colors platform prefixes cycle through.
+// Red is left out so that it can be kept for errors.
+var platformColors = []string{
+	"\x1b[32m", // green
+	"\x1b[33m", // yellow
+	"\x1b[34m", // blue
+	"\x1b[35m", // magenta
+	"\x1b[36m", // cyan
+	"\x1b[92m", // bright green
+	"\x1b[94m", // bright blue
+	"\x1b[96m", // bright cyan
+}
+
+// streamPrefix returns the prefix put in front of each streamed line
+// of output for a platform.
+func streamPrefix(platform Platform, color bool) string {
+	prefix := "[" + platform.String() + "]"
+	if !color {
+		return prefix + " "
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(platform.String()))
+	c := platformColors[int(h.Sum32()%uint32(len(platformColors)))]
+	return c + prefix + "\x1b[0m "
+}
+
+// streamLines returns a writer that copies each line written to it to out,
+// prefixed with prefix. Whole lines are written while holding lock so that
+// output from builds running in parallel doesn't interleave mid-line. The
+// returned function must be called once writing is done; it blocks until
+// all of the output has been copied.
+func streamLines(out io.Writer, lock *sync.Mutex, prefix string) (io.Writer, func()) {
+	r, w := io.Pipe()
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for line := range iochan.DelimReader(r, '\n') {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+
+			lock.Lock()
+			fmt.Fprintf(out, "%s%s", prefix, line)
+			lock.Unlock()
+		}
+	}()
+
+	return w, func() {
+		w.Close()
+		<-doneCh
+	}
+}
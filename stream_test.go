@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStreamLines(t *testing.T) {
+	var buf bytes.Buffer
+	var lock sync.Mutex
+	w, done := streamLines(&buf, &lock, "[linux/amd64] ")
+	w.Write([]byte("foo\nb"))
+	w.Write([]byte("ar\nbaz"))
+	done()
+
+	expected := "[linux/amd64] foo\n[linux/amd64] bar\n[linux/amd64] baz\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestStreamPrefix(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "arm", ARM: "7"}
+	if actual := streamPrefix(p, false); actual != "[linux/armv7] " {
+		t.Fatalf("bad: %q", actual)
+	}
+
+	actual := streamPrefix(p, true)
+	if !strings.HasPrefix(actual, "\x1b[") || !strings.Contains(actual, "[linux/armv7]") {
+		t.Fatalf("bad: %q", actual)
+	}
+	if actual != streamPrefix(p, true) {
+		t.Fatal("color should be stable for a platform")
+	}
+}
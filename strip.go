@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stripLdflags adds the linker flags that leave out the symbol table and
+// DWARF debug info to ldflags.
+func stripLdflags(ldflags string) string {
+	return strings.TrimSpace(ldflags + " -s -w")
+}
+
+// canSplitDebug reports whether binaries for goos are ELF files, which
+// objcopy can split the debug info out of.
+func canSplitDebug(goos string) bool {
+	switch goos {
+	case "android", "dragonfly", "freebsd", "illumos", "linux", "netbsd", "openbsd", "solaris":
+		return true
+	}
+
+	return false
+}
+
+// splitsDebug reports whether opts keeps the debug info to split it out
+// after linking rather than stripping it while linking.
+func (opts *CompileOpts) splitsDebug() bool {
+	return opts.Strip && opts.SplitDebug && canSplitDebug(opts.Platform.OS)
+}
+
+// objcopyCommand returns the objcopy to split debug info with, preferring
+// GNU objcopy and falling back to llvm-objcopy.
+func objcopyCommand() (string, error) {
+	for _, cmd := range []string{"objcopy", "llvm-objcopy"} {
+		if _, err := exec.LookPath(cmd); err == nil {
+			return cmd, nil
+		}
+	}
+
+	return "", fmt.Errorf("objcopy or llvm-objcopy must be on the PATH to split debug info")
+}
+
+// StripSize is how much smaller stripping made a binary.
+type StripSize struct {
+	Platform Platform
+	Output   string
+	Before   int64
+	After    int64
+}
+
+// StripBuild builds opts, which must have Strip set, and returns the size
+// of the binary before and after stripping.
+//
+// When the debug info is split, the binary is linked with it, then objcopy
+// moves it to a .debug file next to the binary and links the two with a
+// .gnu_debuglink section so debuggers find it. Otherwise the unstripped
+// size comes from linking a copy to a temporary directory first, which
+// reuses everything else from the build cache.
+func StripBuild(opts *CompileOpts, objcopy string) (*StripSize, error) {
+	output, err := opts.OutputPath()
+	if err != nil {
+		return nil, err
+	}
+	size := &StripSize{Platform: opts.Platform, Output: output}
+
+	if !opts.splitsDebug() {
+		td, err := ioutil.TempDir("", "gox")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(td)
+
+		unstripped := *opts
+		unstripped.Strip = false
+		unstripped.Output = ioutil.Discard
+		unstripped.OutputTpl = filepath.Join(td, "unstripped")
+		if err := GoCrossCompile(&unstripped); err != nil {
+			return nil, err
+		}
+		unstrippedPath, err := unstripped.OutputPath()
+		if err != nil {
+			return nil, err
+		}
+		if size.Before, err = fileSize(unstrippedPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := GoCrossCompile(opts); err != nil {
+		return nil, err
+	}
+
+	if opts.splitsDebug() {
+		if size.Before, err = fileSize(output); err != nil {
+			return nil, err
+		}
+		if err := splitDebug(objcopy, output); err != nil {
+			return nil, err
+		}
+	}
+
+	if size.After, err = fileSize(output); err != nil {
+		return nil, err
+	}
+	return size, nil
+}
+
+// splitDebug moves the debug info of the ELF binary at path to path.debug.
+func splitDebug(objcopy string, path string) error {
+	debug := path + ".debug"
+	if _, err := execGo(objcopy, nil, "", "--only-keep-debug", path, debug); err != nil {
+		return fmt.Errorf("%s: %s", objcopy, err)
+	}
+
+	// The debug link is looked up by its base name, so it has to be
+	// added from the directory of the binary.
+	if _, err := execGo(objcopy, nil, filepath.Dir(path), "--strip-all",
+		"--add-gnu-debuglink="+filepath.Base(debug), filepath.Base(path)); err != nil {
+		return fmt.Errorf("%s: %s", objcopy, err)
+	}
+
+	return nil
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// printStripReport writes a table of the size saved for each binary.
+func printStripReport(w io.Writer, sizes []*StripSize) {
+	fmt.Fprintf(w, "\nSize saved by stripping:\n\n")
+	var before, after int64
+	for _, s := range sizes {
+		fmt.Fprintf(w, "--> %15s: %s -> %s (saved %s, %.1f%%)\n",
+			s.Platform.String(), formatSize(s.Before), formatSize(s.After),
+			formatSize(s.Before-s.After), percent(s.Before-s.After, s.Before))
+		before += s.Before
+		after += s.After
+	}
+	if len(sizes) > 1 {
+		fmt.Fprintf(w, "--> %15s: %s -> %s (saved %s, %.1f%%)\n",
+			"total", formatSize(before), formatSize(after),
+			formatSize(before-after), percent(before-after, before))
+	}
+}
+
+// formatSize formats a number of bytes with a binary unit.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v := float64(n)
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		v /= unit
+		if v < unit && v > -unit {
+			return fmt.Sprintf("%.1f %s", v, suffix)
+		}
+	}
+	return fmt.Sprintf("%.1f TiB", v/unit)
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		Input  int64
+		Output string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+	}
+
+	for _, tc := range cases {
+		if v := formatSize(tc.Input); v != tc.Output {
+			t.Fatalf("%d: bad: %s", tc.Input, v)
+		}
+	}
+}
+
+func TestStripBuild(t *testing.T) {
+	objcopy, err := objcopyCommand()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	for _, split := range []bool{false, true} {
+		opts := &CompileOpts{
+			PackagePath: "example.com/app",
+			Platform:    Platform{OS: "linux", Arch: "amd64"},
+			OutputTpl:   filepath.Join(td, "app"),
+			GoCmd:       "go",
+			Strip:       true,
+			SplitDebug:  split,
+		}
+		size, err := StripBuild(opts, objcopy)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if size.After >= size.Before {
+			t.Fatalf("bad: %#v", size)
+		}
+
+		f, err := elf.Open(size.Output)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if f.Section(".debug_info") != nil {
+			t.Fatal("debug info should be stripped")
+		}
+		if split != (f.Section(".gnu_debuglink") != nil) {
+			t.Fatalf("split %t: bad debug link", split)
+		}
+		f.Close()
+	}
+
+	if _, err := os.Stat(filepath.Join(td, "app.debug")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
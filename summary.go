@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// BuildSummary is the machine-readable outcome of a run, written to
+// stdout with -json.
+type BuildSummary struct {
+	// UpToDate is true when incremental mode found that nothing needed
+	// to be rebuilt.
+	UpToDate bool            `json:"up_to_date"`
+	Targets  []TargetSummary `json:"targets"`
+
+	// Error is why the run failed, if it did.
+	Error *RunError `json:"error,omitempty"`
+}
+
+// TargetSummary is the outcome of building one package for one platform.
+// Status is "built", "up-to-date" or "failed".
+type TargetSummary struct {
+	Platform string `json:"platform"`
+	Package  string `json:"package"`
+	Output   string `json:"output,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+	Log      string `json:"log,omitempty"`
+
+	// AllowedFailure is true for the failures of -allow-failures.
+	AllowedFailure bool `json:"allowed_failure,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewBuildSummary summarizes the given build results.
+func NewBuildSummary(results []BuildResult) *BuildSummary {
+	s := &BuildSummary{
+		UpToDate: len(results) > 0,
+		Targets:  make([]TargetSummary, 0, len(results)),
+	}
+	for _, r := range results {
+		t := TargetSummary{
+			Platform: r.Platform.String(),
+			Package:  r.Path,
+			Output:   r.Output,
+			Variant:  r.Variant,
+			Log:      r.Log,
+
+			Annotations: r.Annotations,
+		}
+		switch {
+		case r.Err != nil:
+			t.Status = "failed"
+			t.Error = r.Err.Error()
+			t.AllowedFailure = r.AllowedFailure
+		case r.UpToDate:
+			t.Status = "up-to-date"
+		default:
+			t.Status = "built"
+		}
+		if t.Status != "up-to-date" {
+			s.UpToDate = false
+		}
+		s.Targets = append(s.Targets, t)
+	}
+
+	return s
+}
+
+// Write writes the summary to w as JSON.
+func (s *BuildSummary) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewBuildSummary(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	cases := []struct {
+		Results  []BuildResult
+		UpToDate bool
+		Statuses []string
+	}{
+		{
+			nil,
+			false,
+			[]string{},
+		},
+		{
+			[]BuildResult{
+				{Platform: linux, UpToDate: true},
+				{Platform: linux, UpToDate: true},
+			},
+			true,
+			[]string{"up-to-date", "up-to-date"},
+		},
+		{
+			[]BuildResult{
+				{Platform: linux, UpToDate: true},
+				{Platform: linux},
+				{Platform: linux, Err: fmt.Errorf("boom")},
+			},
+			false,
+			[]string{"up-to-date", "built", "failed"},
+		},
+	}
+
+	for _, tc := range cases {
+		s := NewBuildSummary(tc.Results)
+		if s.UpToDate != tc.UpToDate {
+			t.Fatalf("bad: %#v", s)
+		}
+		if len(s.Targets) != len(tc.Statuses) {
+			t.Fatalf("bad: %#v", s.Targets)
+		}
+		for i, status := range tc.Statuses {
+			if s.Targets[i].Status != status {
+				t.Fatalf("bad: %#v", s.Targets)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// Resource types used in windows resources.
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+)
+
+// langEnUS is the language our resources are stored under.
+const langEnUS = 0x0409
+
+// winResource is a single resource to embed in a windows binary.
+type winResource struct {
+	Type uint16
+	ID   uint16
+	Data []byte
+}
+
+// sysoMachine is the COFF machine and the relocation type for a 32-bit
+// image-relative address, for each GOARCH that the Go linker can read
+// resources for.
+var sysoMachine = map[string]struct {
+	Machine uint16
+	Reloc   uint16
+}{
+	"386":   {0x14c, 0x7},  // IMAGE_REL_I386_DIR32NB
+	"amd64": {0x8664, 0x3}, // IMAGE_REL_AMD64_ADDR32NB
+	"arm64": {0xaa64, 0x2}, // IMAGE_REL_ARM64_ADDR32NB
+}
+
+// WriteSyso writes a COFF object file to path holding the given resources
+// in a .rsrc section, for linking into windows binaries of the given
+// GOARCH. The Go linker picks up .syso files in a package directory
+// automatically, and Windows reads the resources from the binary.
+func WriteSyso(path string, arch string, resources []winResource) error {
+	data, err := sysoObject(arch, resources)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func sysoObject(arch string, resources []winResource) ([]byte, error) {
+	machine, ok := sysoMachine[arch]
+	if !ok {
+		return nil, fmt.Errorf("windows resources are not supported on %s", arch)
+	}
+
+	rsrc, relocs := resourceSection(resources)
+
+	// The file is the header, the only section header, the section data,
+	// its relocations, and a symbol table with just the section symbol.
+	const fileHeaderSize, sectionHeaderSize = 20, 40
+	dataOffset := uint32(fileHeaderSize + sectionHeaderSize)
+	relocOffset := dataOffset + uint32(len(rsrc))
+	symbolOffset := relocOffset + uint32(10*len(relocs))
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&buf, le, struct {
+		Machine              uint16
+		NumberOfSections     uint16
+		TimeDateStamp        uint32
+		PointerToSymbolTable uint32
+		NumberOfSymbols      uint32
+		SizeOfOptionalHeader uint16
+		Characteristics      uint16
+	}{machine.Machine, 1, 0, symbolOffset, 1, 0, 0})
+
+	binary.Write(&buf, le, struct {
+		Name                 [8]byte
+		VirtualSize          uint32
+		VirtualAddress       uint32
+		SizeOfRawData        uint32
+		PointerToRawData     uint32
+		PointerToRelocations uint32
+		PointerToLineNumbers uint32
+		NumberOfRelocations  uint16
+		NumberOfLineNumbers  uint16
+		Characteristics      uint32
+	}{
+		Name:                 [8]byte{'.', 'r', 's', 'r', 'c'},
+		SizeOfRawData:        uint32(len(rsrc)),
+		PointerToRawData:     dataOffset,
+		PointerToRelocations: relocOffset,
+		NumberOfRelocations:  uint16(len(relocs)),
+		// IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+		Characteristics: 0x40000040,
+	})
+
+	buf.Write(rsrc)
+	for _, off := range relocs {
+		binary.Write(&buf, le, struct {
+			VirtualAddress   uint32
+			SymbolTableIndex uint32
+			Type             uint16
+		}{off, 0, machine.Reloc})
+	}
+
+	binary.Write(&buf, le, struct {
+		Name               [8]byte
+		Value              uint32
+		SectionNumber      int16
+		Type               uint16
+		StorageClass       uint8
+		NumberOfAuxSymbols uint8
+	}{
+		Name:          [8]byte{'.', 'r', 's', 'r', 'c'},
+		SectionNumber: 1,
+		StorageClass:  3, // IMAGE_SYM_CLASS_STATIC
+	})
+
+	// An empty string table is just its own size
+	binary.Write(&buf, le, uint32(4))
+
+	return buf.Bytes(), nil
+}
+
+// resourceSection lays out the contents of a .rsrc section: a three level
+// directory of type, ID and language, then a data entry per resource and
+// finally the resource data. It returns the section and the offsets of
+// the data entry addresses, which need relocating to image-relative
+// addresses by the linker.
+func resourceSection(resources []winResource) ([]byte, []uint32) {
+	resources = append([]winResource(nil), resources...)
+	sort.SliceStable(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].ID < resources[j].ID
+	})
+
+	var types []uint16
+	byType := make(map[uint16][]int)
+	for i, r := range resources {
+		if _, ok := byType[r.Type]; !ok {
+			types = append(types, r.Type)
+		}
+		byType[r.Type] = append(byType[r.Type], i)
+	}
+
+	// A directory is a 16 byte header followed by 8 byte entries. Work out
+	// where everything goes before writing anything.
+	dirSize := func(n int) uint32 { return 16 + 8*uint32(n) }
+	typeDirs := make(map[uint16]uint32)
+	langDirs := make([]uint32, len(resources))
+	offset := dirSize(len(types))
+	for _, t := range types {
+		typeDirs[t] = offset
+		offset += dirSize(len(byType[t]))
+	}
+	for i := range resources {
+		langDirs[i] = offset
+		offset += dirSize(1)
+	}
+	entries := make([]uint32, len(resources))
+	for i := range resources {
+		entries[i] = offset
+		offset += 16
+	}
+	datas := make([]uint32, len(resources))
+	for i, r := range resources {
+		offset = uint32(alignUp(uint64(offset), 8))
+		datas[i] = offset
+		offset += uint32(len(r.Data))
+	}
+
+	section := make([]byte, offset)
+	le := binary.LittleEndian
+	writeDir := func(at uint32, ids []uint16, targets []uint32, subdir bool) {
+		le.PutUint16(section[at+14:], uint16(len(ids)))
+		for i, id := range ids {
+			e := at + dirSize(i)
+			le.PutUint32(section[e:], uint32(id))
+			target := targets[i]
+			if subdir {
+				target |= 0x80000000
+			}
+			le.PutUint32(section[e+4:], target)
+		}
+	}
+
+	typeTargets := make([]uint32, len(types))
+	for i, t := range types {
+		typeTargets[i] = typeDirs[t]
+	}
+	writeDir(0, types, typeTargets, true)
+	for _, t := range types {
+		idx := byType[t]
+		ids := make([]uint16, len(idx))
+		targets := make([]uint32, len(idx))
+		for i, ri := range idx {
+			ids[i] = resources[ri].ID
+			targets[i] = langDirs[ri]
+		}
+		writeDir(typeDirs[t], ids, targets, true)
+	}
+
+	relocs := make([]uint32, len(resources))
+	for i, r := range resources {
+		writeDir(langDirs[i], []uint16{langEnUS}, []uint32{entries[i]}, false)
+
+		// OffsetToData is relative to the section here, and the
+		// relocation adds the address of the section to it.
+		le.PutUint32(section[entries[i]:], datas[i])
+		le.PutUint32(section[entries[i]+4:], uint32(len(r.Data)))
+		relocs[i] = entries[i]
+		copy(section[datas[i]:], r.Data)
+	}
+
+	return section, relocs
+}
@@ -106,6 +106,8 @@ func buildToolchain(wg *sync.WaitGroup, semaphore chan int, root string, platfor
 	var stdout bytes.Buffer
 	scriptDir := filepath.Join(root, "src")
 	scriptPath := filepath.Join(scriptDir, scriptName)
+	ui.Command(scriptDir, append(os.Environ(), "GOARCH="+platform.Arch, "GOOS="+platform.OS),
+		scriptPath, "--no-clean")
 	cmd := exec.Command(scriptPath, "--no-clean")
 	cmd.Dir = scriptDir
 	cmd.Env = append(os.Environ(),
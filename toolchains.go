@@ -0,0 +1,518 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A toolchains bundle is a .tar.gz holding everything a matrix build needs
+// without network access:
+//
+//	manifest.json        what is in the bundle
+//	go/<version>/        the GOROOT of each Go toolchain
+//	modcache/cache/      the downloads of every module in the build list
+//	cc/<name>/           the C cross toolchains of the GOX_*_CC variables
+//
+// Restoring it writes an env.sh next to these that points the go command,
+// the module cache and the compilers at the restored copies.
+
+// toolchainManifest is the manifest.json of a toolchains bundle. The
+// directories in it are relative to the root of the bundle.
+type toolchainManifest struct {
+	Go       []bundledGo `json:"go"`
+	ModCache string      `json:"modcache,omitempty"`
+	CC       []bundledCC `json:"cc,omitempty"`
+}
+
+// bundledGo is a Go toolchain in the bundle.
+type bundledGo struct {
+	Version string `json:"version"`
+	Dir     string `json:"dir"`
+}
+
+// bundledCC is a C compiler in the bundle, set with the variable Var. The
+// Command is relative to Dir, followed by any arguments it is run with.
+type bundledCC struct {
+	Var     string `json:"var"`
+	Dir     string `json:"dir"`
+	Command string `json:"command"`
+}
+
+// ccVarRe matches the variables that set a C compiler for a platform.
+var ccVarRe = regexp.MustCompile(`^GOX_[A-Z0-9]+_[A-Z0-9]+_(CC|CXX)$`)
+
+// systemPrefixes are the directories shared by everything installed on the
+// system, which can't be bundled as the toolchain of one compiler.
+var systemPrefixes = []string{"/", "/usr", "/usr/local", "/bin", "/usr/bin", "/usr/local/bin"}
+
+// ccRoot returns the directory a C compiler at the absolute path cc is
+// installed in: the parent of its bin directory, or otherwise the directory
+// it is in, as for a zig download.
+func ccRoot(cc string) (string, error) {
+	dir := filepath.Dir(cc)
+	if filepath.Base(dir) == "bin" {
+		dir = filepath.Dir(dir)
+	}
+
+	for _, prefix := range systemPrefixes {
+		if filepath.ToSlash(dir) == prefix {
+			return "", fmt.Errorf("%s is installed in %s, which can't be bundled by itself; "+
+				"install the toolchain in its own directory", cc, dir)
+		}
+	}
+	return dir, nil
+}
+
+// bundleCompilers finds the toolchain of each compiler set with a GOX_*_CC
+// or GOX_*_CXX variable in env. It returns the compilers and the source
+// directory of each of their Dirs.
+func bundleCompilers(env []string) ([]bundledCC, map[string]string, error) {
+	var result []bundledCC
+	dirs := make(map[string]string)
+	roots := make(map[string]string)
+	for _, kv := range env {
+		idx := strings.Index(kv, "=")
+		if idx <= 0 || !ccVarRe.MatchString(kv[:idx]) {
+			continue
+		}
+		key, fields := kv[:idx], strings.Fields(kv[idx+1:])
+		if len(fields) == 0 {
+			continue
+		}
+
+		cc, err := exec.LookPath(fields[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", key, err)
+		}
+		if cc, err = filepath.Abs(cc); err != nil {
+			return nil, nil, err
+		}
+		root, err := ccRoot(cc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", key, err)
+		}
+
+		// Compilers from the same toolchain share one copy of it
+		dir, ok := roots[root]
+		if !ok {
+			dir = "cc/" + filepath.Base(root)
+			for i := 2; dirs[dir] != ""; i++ {
+				dir = fmt.Sprintf("cc/%s-%d", filepath.Base(root), i)
+			}
+			roots[root] = dir
+			dirs[dir] = root
+		}
+
+		rel, err := filepath.Rel(root, cc)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[0] = filepath.ToSlash(rel)
+		result = append(result, bundledCC{
+			Var:     key,
+			Dir:     dir,
+			Command: strings.Join(fields, " "),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Var < result[j].Var })
+	return result, dirs, nil
+}
+
+// downloadModules downloads every module in the build list of the module
+// in the current directory into a new module cache in dir, which then holds
+// nothing but what the build needs.
+func downloadModules(GoCmd string, dir string) error {
+	env := append(os.Environ(),
+		"GOMODCACHE="+dir,
+		"GOFLAGS=-modcacherw")
+	if _, err := execGo(GoCmd, env, "", "mod", "download", "all"); err != nil {
+		return fmt.Errorf("downloading modules: %s", err)
+	}
+
+	return nil
+}
+
+// BundleToolchains writes a toolchains bundle to output holding the
+// GOROOT of each of the goCmds, the modules of the module in the current
+// directory (if it is one), and the C toolchains set in the environment.
+func BundleToolchains(output string, goCmds []string) (*toolchainManifest, error) {
+	var manifest toolchainManifest
+	dirs := make(map[string]string)
+	for _, goCmd := range goCmds {
+		root, err := goEnv(goCmd, "GOROOT")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", goCmd, err)
+		}
+		version, err := goEnv(goCmd, "GOVERSION")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", goCmd, err)
+		}
+
+		dir := "go/" + version
+		if dirs[dir] == "" {
+			dirs[dir] = root
+			manifest.Go = append(manifest.Go, bundledGo{Version: version, Dir: dir})
+		}
+	}
+
+	if _, err := os.Stat("go.mod"); err == nil {
+		td, err := ioutil.TempDir("", "gox")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(td)
+
+		if err := downloadModules(goCmds[0], td); err != nil {
+			return nil, err
+		}
+
+		// A module without dependencies has nothing to download
+		download := filepath.Join(td, "cache", "download")
+		if _, err := os.Stat(download); err == nil {
+			manifest.ModCache = "modcache"
+			dirs["modcache/cache/download"] = download
+		}
+	}
+
+	ccs, ccDirs, err := bundleCompilers(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	manifest.CC = ccs
+	for dir, src := range ccDirs {
+		dirs[dir] = src
+	}
+
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeBundle(output, append(data, '\n'), dirs); err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// writeBundle writes a .tar.gz to path with the manifest and each source
+// directory of dirs under its name in the bundle.
+func writeBundle(path string, manifest []byte, dirs map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    "manifest.json",
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: artifactTime(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := tarTree(tw, dirs[name], name); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// tarTree writes the directory tree at root to tw under prefix, keeping
+// symlinks as they are, which toolchains are full of.
+func tarTree(tw *tar.Writer, root string, prefix string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			// Sockets and the like aren't part of a toolchain
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// RestoreToolchains unpacks the bundle at path into dir and writes the
+// env.sh that sets up the environment to build offline with it.
+func RestoreToolchains(path string, dir string) (*toolchainManifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := extractBundle(path, dir); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest toolchainManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest.json: %s", err)
+	}
+
+	env := toolchainEnv(&manifest, dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "env.sh"), env, 0644); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// toolchainEnv returns the shell script that sets the environment to build
+// with the toolchains restored to dir, with the first Go toolchain on the
+// PATH and the network turned off for modules and toolchain downloads.
+func toolchainEnv(manifest *toolchainManifest, dir string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by gox toolchains restore\n")
+	for i, g := range manifest.Go {
+		bin := filepath.ToSlash(filepath.Join(dir, g.Dir, "bin"))
+		if i == 0 {
+			fmt.Fprintf(&buf, "export PATH=\"%s:$PATH\"\n", bin)
+		} else {
+			fmt.Fprintf(&buf, "# %s: -gocmd %s/go\n", g.Version, bin)
+		}
+	}
+	if manifest.ModCache != "" {
+		fmt.Fprintf(&buf, "export GOMODCACHE=\"%s\"\n",
+			filepath.ToSlash(filepath.Join(dir, manifest.ModCache)))
+	}
+	buf.WriteString("export GOPROXY=off\n")
+	buf.WriteString("export GOTOOLCHAIN=local\n")
+	for _, cc := range manifest.CC {
+		fmt.Fprintf(&buf, "export %s=\"%s/%s\"\n",
+			cc.Var, filepath.ToSlash(filepath.Join(dir, cc.Dir)), cc.Command)
+	}
+
+	return buf.Bytes()
+}
+
+// extractBundle unpacks the .tar.gz at path into dir. Entries and symlinks
+// that would point outside of dir are refused, and so are entries inside
+// the symlinks, so that no chain of links leads out either.
+func extractBundle(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return extractTar(gr, path, dir)
+}
+
+// extractTar unpacks the tar that r reads, of the file at path, into dir,
+// as extractBundle does.
+func extractTar(r io.Reader, path string, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		target, ok := bundlePath(dir, hdr.Name)
+		if !ok {
+			return fmt.Errorf("%s: entry %s is outside of the bundle", path, hdr.Name)
+		}
+		if link := bundleLink(dir, target, hdr.Typeflag == tar.TypeDir); link != "" {
+			return fmt.Errorf("%s: entry %s is inside the link %s", path, hdr.Name, link)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// Directories stay writable, the module cache's included,
+			// so that the rest of the bundle can be unpacked into them
+			// and they can be removed again.
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if !bundleLinkTarget(dir, target, hdr.Linkname) {
+				return fmt.Errorf("%s: link %s points outside of the bundle", path, hdr.Name)
+			}
+			os.Remove(target)
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeReg:
+			err = extractFile(tr, target, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// bundlePath returns where the entry name goes in dir, and false if that
+// is outside of dir.
+func bundlePath(dir string, name string) (string, bool) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if filepath.IsAbs(name) {
+		target = filepath.Clean(name)
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return target, true
+}
+
+// bundleLink returns the first of the directories between dir and target,
+// or target itself if self is true, that is a symlink, or "" if there is
+// none. Nothing is created or written through a link of the bundle.
+func bundleLink(dir string, target string, self bool) string {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == "." {
+		return ""
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if !self {
+		parts = parts[:len(parts)-1]
+	}
+
+	p := dir
+	for _, part := range parts {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return ""
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return p
+		}
+	}
+	return ""
+}
+
+// bundleLinkTarget reports whether the link at target to linkname stays
+// in dir. The link's directory is resolved with the links extracted so
+// far, and linkname may only go up with a leading "..", so that a link to
+// another link, such as b/.. with b pointing to ., can't go up from
+// wherever that one points.
+func bundleLinkTarget(dir string, target string, linkname string) bool {
+	if filepath.IsAbs(linkname) || linkname == "" {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	p, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return false
+	}
+
+	names := false
+	for _, part := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if names {
+				return false
+			}
+			p = filepath.Dir(p)
+		default:
+			names = true
+			p = filepath.Join(p, part)
+		}
+	}
+	_, ok := bundlePath(root, p)
+	return ok
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Files of the module cache are read-only, so replace rather than
+	// overwrite when restoring into the same directory twice.
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
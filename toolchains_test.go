@@ -0,0 +1,241 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCCRoot(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"/opt/x-tools/aarch64-linux-gnu/bin/aarch64-linux-gnu-gcc", "/opt/x-tools/aarch64-linux-gnu", false},
+		{"/opt/zig/zig", "/opt/zig", false},
+		{"/usr/bin/aarch64-linux-gnu-gcc", "", true},
+		{"/usr/local/bin/cc", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ccRoot(filepath.FromSlash(tc.Input))
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if filepath.ToSlash(actual) != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, actual)
+		}
+	}
+}
+
+func TestBundleCompilers(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	root := filepath.Join(td, "aarch64")
+	for _, name := range []string{"gcc", "g++"} {
+		path := filepath.Join(root, "bin", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	ccs, dirs, err := bundleCompilers([]string{
+		"HOME=/root",
+		"GOX_LINUX_ARM64_CXX=" + filepath.Join(root, "bin", "g++"),
+		"GOX_LINUX_ARM64_CC=" + filepath.Join(root, "bin", "gcc") + " -static",
+		"GOX_LINUX_ARM64_LDFLAGS=-s",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []bundledCC{
+		{Var: "GOX_LINUX_ARM64_CC", Dir: "cc/aarch64", Command: "bin/gcc -static"},
+		{Var: "GOX_LINUX_ARM64_CXX", Dir: "cc/aarch64", Command: "bin/g++"},
+	}
+	if !reflect.DeepEqual(ccs, expected) {
+		t.Fatalf("bad: %#v", ccs)
+	}
+	if !reflect.DeepEqual(dirs, map[string]string{"cc/aarch64": root}) {
+		t.Fatalf("bad: %#v", dirs)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "src")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "bin", "gcc-12"), []byte("gcc"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Symlink("gcc-12", filepath.Join(src, "bin", "gcc")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	manifest := &toolchainManifest{
+		Go: []bundledGo{{Version: "go1.22.0", Dir: "go/go1.22.0"}},
+		CC: []bundledCC{{Var: "GOX_LINUX_ARM64_CC", Dir: "cc/src", Command: "bin/gcc"}},
+	}
+	bundle := filepath.Join(td, "bundle.tar.gz")
+	if err := writeBundle(bundle, []byte(`{"go":[{"version":"go1.22.0","dir":"go/go1.22.0"}],`+
+		`"cc":[{"var":"GOX_LINUX_ARM64_CC","dir":"cc/src","command":"bin/gcc"}]}`),
+		map[string]string{"cc/src": src}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := filepath.Join(td, "restored")
+	actual, err := RestoreToolchains(bundle, dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, manifest) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cc", "src", "bin", "gcc"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "gcc" {
+		t.Fatalf("bad: %s", data)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "cc", "src", "bin", "gcc")); err != nil || link != "gcc-12" {
+		t.Fatalf("bad: %s %v", link, err)
+	}
+
+	env, err := ioutil.ReadFile(filepath.Join(dir, "env.sh"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	slash := filepath.ToSlash(dir)
+	for _, line := range []string{
+		`export PATH="` + slash + `/go/go1.22.0/bin:$PATH"`,
+		`export GOPROXY=off`,
+		`export GOX_LINUX_ARM64_CC="` + slash + `/cc/src/bin/gcc"`,
+	} {
+		if !strings.Contains(string(env), line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, env)
+		}
+	}
+}
+
+func TestExtractBundle_outside(t *testing.T) {
+	cases := [][]tar.Header{
+		{{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		{{Name: "/evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		{{Name: "cc/evil", Typeflag: tar.TypeSymlink, Linkname: "../../.."}},
+		{{Name: "cc/evil", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+
+		// A link through another link, which looks like it stays inside
+		{
+			{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "b/.."},
+			{Name: "a/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		},
+
+		// Writing through a link, even one that points inside
+		{
+			{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+			{Name: "l/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		},
+		{
+			{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+			{Name: "l/", Typeflag: tar.TypeDir, Mode: 0755},
+		},
+	}
+
+	for _, hdrs := range cases {
+		td, err := ioutil.TempDir("", "gox")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+
+		bundle := filepath.Join(td, "bundle.tar.gz")
+		f, err := os.Create(bundle)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		gw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gw)
+		for i := range hdrs {
+			if err := tw.WriteHeader(&hdrs[i]); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if hdrs[i].Size > 0 {
+				tw.Write([]byte("evil"))
+			}
+		}
+		tw.Close()
+		gw.Close()
+		f.Close()
+
+		name := hdrs[len(hdrs)-1].Name
+		if err := extractBundle(bundle, filepath.Join(td, "restored")); err == nil {
+			t.Fatalf("%s: should refuse", name)
+		}
+		if _, err := os.Stat(filepath.Join(td, "evil")); err == nil {
+			t.Fatalf("%s: wrote outside of the bundle", name)
+		}
+	}
+}
+
+func TestExtractBundle_links(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	bundle := filepath.Join(td, "bundle.tar.gz")
+	f, err := os.Create(bundle)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range []tar.Header{
+		{Name: "cc/lib/libc.so", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		{Name: "cc/bin/lib", Typeflag: tar.TypeSymlink, Linkname: "../lib"},
+		{Name: "cc/bin/libc.so", Typeflag: tar.TypeSymlink, Linkname: "lib/libc.so"},
+	} {
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("libc"))
+		}
+	}
+	tw.Close()
+	gw.Close()
+	f.Close()
+
+	restored := filepath.Join(td, "restored")
+	if err := extractBundle(bundle, restored); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(restored, "cc", "bin", "libc.so")); err != nil || string(data) != "libc" {
+		t.Fatalf("bad: %q %v", data, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// treePlatformDir is the name of the directory a platform's binaries are
+// installed to within a tree, such as "linux-armv7".
+func treePlatformDir(p Platform) string {
+	return p.OS + "-" + p.GetArch()
+}
+
+// launcher is a launcher script to render for a tree. Scripts with an
+// extension are for Windows and get CRLF line endings.
+type launcher struct {
+	Tpl  string
+	Ext  string
+	Data *LauncherData
+}
+
+// treeFiles returns the files making up a GOBIN-style tree of the
+// successfully built binaries: each binary at <os>-<arch>/bin/<name>, and
+// launchers in bin/ that run the right binary for the machine.
+func treeFiles(results []BuildResult) ([]archiveFile, error) {
+	var files []archiveFile
+	var names []string
+	seen := make(map[string]struct{})
+	hasUnix, hasWindows := false, false
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+
+		name := filepath.Base(r.Output)
+		files = append(files, archiveFile{
+			Name: treePlatformDir(r.Platform) + "/bin/" + name,
+			Src:  r.Output,
+			Mode: 0755,
+		})
+
+		name = strings.TrimSuffix(name, ".exe")
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+		if r.Platform.OS == "windows" {
+			hasWindows = true
+		} else {
+			hasUnix = true
+		}
+	}
+
+	for _, name := range names {
+		unixData := &LauncherData{Name: name, Path: "../$os-$arch/bin/" + name}
+		launchers := []launcher{{ps1LauncherTpl, ".ps1", unixData}}
+		if hasUnix {
+			launchers = append(launchers, launcher{shLauncherTpl, "", unixData})
+		}
+		if hasWindows {
+			launchers = append(launchers, launcher{cmdLauncherTpl, ".cmd", &LauncherData{
+				Name: name,
+				Path: `..\windows-%arch%\bin\` + name,
+			}})
+		}
+
+		for _, l := range launchers {
+			contents, err := renderLauncher(l.Tpl, l.Data)
+			if err != nil {
+				return nil, err
+			}
+			if l.Ext != "" {
+				contents = []byte(strings.Replace(string(contents), "\n", "\r\n", -1))
+			}
+
+			files = append(files, archiveFile{
+				Name: "bin/" + name + l.Ext,
+				Data: contents,
+				Mode: 0755,
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// InstallTree copies the successfully built binaries into a tree under
+// dir (see treeFiles). The result can be copied as-is onto machines of
+// any platform in the tree.
+func InstallTree(dir string, results []BuildResult) error {
+	files, err := treeFiles(results)
+	if err != nil {
+		return err
+	}
+
+	return writeFiles(dir, files)
+}
+
+// WriteFatArchive writes the tree of all successfully built binaries
+// (see treeFiles) to a single archive at path, so that one download
+// works on every platform through its launchers.
+func WriteFatArchive(path string, results []BuildResult) error {
+	files, err := treeFiles(results)
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Base(path)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		root = strings.TrimSuffix(root, ext)
+	}
+
+	return writeArchive(path, root, files)
+}
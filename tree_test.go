@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstallTree(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var results []BuildResult
+	for _, p := range []Platform{
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "windows", Arch: "amd64"},
+	} {
+		name := "app"
+		if p.OS == "windows" {
+			name += ".exe"
+		}
+		output := filepath.Join(td, treePlatformDir(p), name)
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(output, []byte(p.String()), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, BuildResult{Platform: p, Output: output})
+	}
+
+	dir := filepath.Join(td, "dist")
+	if err := InstallTree(dir, results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, path := range []string{
+		"linux-armv7/bin/app",
+		"windows-amd64/bin/app.exe",
+		"bin/app",
+		"bin/app.cmd",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "bin", "app"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(data), `bin="$dir/../$os-$arch/bin/app"`) {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestWriteFatArchive(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "app")
+	if err := ioutil.WriteFile(output, []byte("app"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	results := []BuildResult{
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, Output: output},
+		{Platform: Platform{OS: "darwin", Arch: "arm64"}, Output: output},
+	}
+
+	path := filepath.Join(td, "app-all.zip")
+	if err := WriteFatArchive(path, results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Mode()&0100 == 0 {
+			t.Fatalf("%s should be executable: %s", f.Name, f.Mode())
+		}
+	}
+	expected := []string{
+		"app-all/bin/app",
+		"app-all/bin/app.ps1",
+		"app-all/darwin-arm64/bin/app",
+		"app-all/linux-amd64/bin/app",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad: %#v", names)
+	}
+}
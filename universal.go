@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fatAlign is the alignment of each architecture in a universal binary,
+// as a power of two. This is the page size on arm64, which lipo also
+// uses for all architectures in new binaries.
+const fatAlign = 14
+
+// MakeUniversal writes a universal (fat) Mach-O binary to output made up
+// of the given thin Mach-O binaries. This is the pure Go equivalent of
+// `lipo -create`, so universal binaries can be built from any host.
+func MakeUniversal(output string, inputs ...string) error {
+	if len(inputs) < 2 {
+		return fmt.Errorf("a universal binary needs at least two architectures")
+	}
+
+	type thin struct {
+		hdr  macho.FatArchHeader
+		data []byte
+	}
+	thins := make([]thin, len(inputs))
+	seen := make(map[macho.Cpu]string)
+	for i, input := range inputs {
+		data, err := ioutil.ReadFile(input)
+		if err != nil {
+			return err
+		}
+
+		f, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %s", input, err)
+		}
+		if other, ok := seen[f.Cpu]; ok {
+			return fmt.Errorf("%s and %s have the same architecture (%s)", other, input, f.Cpu)
+		}
+		seen[f.Cpu] = input
+
+		thins[i] = thin{
+			hdr: macho.FatArchHeader{
+				Cpu:    f.Cpu,
+				SubCpu: f.SubCpu,
+				Size:   uint32(len(data)),
+				Align:  fatAlign,
+			},
+			data: data,
+		}
+		f.Close()
+	}
+
+	// The header is the magic and count followed by one entry per
+	// architecture, then each binary at an aligned offset.
+	offset := uint64(8 + 20*len(thins))
+	for i := range thins {
+		offset = alignUp(offset, 1<<fatAlign)
+		if offset+uint64(len(thins[i].data)) > 1<<32 {
+			return fmt.Errorf("universal binary would exceed 4GB")
+		}
+		thins[i].hdr.Offset = uint32(offset)
+		offset += uint64(len(thins[i].data))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, macho.MagicFat)
+	binary.Write(&buf, binary.BigEndian, uint32(len(thins)))
+	for _, t := range thins {
+		binary.Write(&buf, binary.BigEndian, &t.hdr)
+	}
+	for _, t := range thins {
+		buf.Write(make([]byte, int(t.hdr.Offset)-buf.Len()))
+		buf.Write(t.data)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, buf.Bytes(), 0755)
+}
+
+func alignUp(v uint64, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMachO writes a minimal 64-bit Mach-O executable with no load
+// commands for the given CPU.
+func testMachO(t *testing.T, path string, cpu macho.Cpu) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &struct {
+		Magic, Cpu, SubCpu, Type, Ncmd, Cmdsz, Flags, Reserved uint32
+	}{macho.Magic64, uint32(cpu), 3, uint32(macho.TypeExec), 0, 0, 0, 0})
+	buf.WriteString("payload")
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestMakeUniversal(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	amd64 := filepath.Join(td, "amd64")
+	arm64 := filepath.Join(td, "arm64")
+	testMachO(t, amd64, macho.CpuAmd64)
+	testMachO(t, arm64, macho.CpuArm64)
+
+	output := filepath.Join(td, "universal")
+	if err := MakeUniversal(output, amd64, arm64); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := macho.OpenFat(output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	if len(f.Arches) != 2 {
+		t.Fatalf("bad: %#v", f.Arches)
+	}
+	if f.Arches[0].Cpu != macho.CpuAmd64 || f.Arches[1].Cpu != macho.CpuArm64 {
+		t.Fatalf("bad: %#v", f.Arches)
+	}
+	for _, a := range f.Arches {
+		if a.Offset%(1<<fatAlign) != 0 {
+			t.Fatalf("unaligned: %#v", a.FatArchHeader)
+		}
+	}
+
+	// The same architecture twice is an error
+	if err := MakeUniversal(output, amd64, amd64); err == nil {
+		t.Fatal("should err")
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// UploadConfig is an entry of the "uploads" section of the config file.
+// With -publish every artifact of the kinds it lists is uploaded with an
+// HTTP PUT, as Artifactory, Nexus, WebDAV servers and presigned S3 or
+// MinIO URLs take them.
+type UploadConfig struct {
+	// Name names the upload in the output.
+	Name string `json:"name"`
+
+	// URL is the template of where each artifact is uploaded to, with
+	// {{.Name}} (its file name), {{.Path}} (its path in the manifest),
+	// {{.Kind}}, {{.Version}}, {{.OS}} and {{.Arch}}.
+	URL string `json:"url"`
+
+	// Method defaults to PUT.
+	Method string `json:"method,omitempty"`
+
+	// Username and PasswordEnv, the environment variable with the
+	// password, authenticate with basic auth, and TokenEnv, the variable
+	// with a token, as a bearer. Headers are added to every request.
+	Username    string            `json:"username,omitempty"`
+	PasswordEnv string            `json:"password_env,omitempty"`
+	TokenEnv    string            `json:"token_env,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+
+	// Kinds are the kinds of artifacts in the manifest to upload.
+	// Defaults to archives, checksums, packages and signatures, or
+	// binaries when there are no archives.
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Retries is how many times a failed upload is tried again, with a
+	// growing delay, defaults to 3. Uploads are retried when the request
+	// fails or the server returns 429 or a 5xx status.
+	Retries int `json:"retries,omitempty"`
+
+	// SkipExisting asks the server with a HEAD first, and skips artifacts
+	// that are already there with the same SHA-256 or MD5, so that a
+	// publish that failed part way can be run again without uploading
+	// everything again.
+	SkipExisting bool `json:"skip_existing,omitempty"`
+
+	// Resumable uploads with the tus protocol (https://tus.io), which
+	// tusd and the storage of Cloudflare and Supabase speak: the upload is
+	// created with a POST to the URL, and its file sent in PATCH requests
+	// of ChunkSize, "8M" by default. A request that fails is resumed from
+	// where the server says it got to, rather than started over.
+	Resumable bool   `json:"resumable,omitempty"`
+	ChunkSize string `json:"chunk_size,omitempty"`
+}
+
+// uploadData is what the URL template of an upload is executed with.
+type uploadData struct {
+	Name    string
+	Path    string
+	Kind    string
+	Version string
+	OS      string
+	Arch    string
+}
+
+// uploadBackoff is the delay before the first retry of an upload, which
+// doubles with every retry after it.
+var uploadBackoff = time.Second
+
+// Validate checks the name, the url template, that at most one kind of
+// credentials is set, and the settings of resumable uploads.
+func (c *UploadConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("uploads: name is required")
+	}
+	if c.URL == "" {
+		return fmt.Errorf("uploads: %s: url is required", c.Name)
+	}
+	if err := validateURLTemplate("uploads: "+c.Name, c.URL); err != nil {
+		return err
+	}
+	if c.PasswordEnv != "" && c.TokenEnv != "" {
+		return fmt.Errorf("uploads: %s: only one of password_env and token_env can be set", c.Name)
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("uploads: %s: retries must not be negative", c.Name)
+	}
+	if c.Resumable {
+		if c.Method != "" {
+			return fmt.Errorf("uploads: %s: method can't be set for resumable uploads", c.Name)
+		}
+		// The URL is where uploads are created, not where the file ends up
+		if c.SkipExisting {
+			return fmt.Errorf("uploads: %s: skip_existing can't be set for resumable uploads", c.Name)
+		}
+	}
+	if c.ChunkSize != "" {
+		if !c.Resumable {
+			return fmt.Errorf("uploads: %s: chunk_size is only for resumable uploads", c.Name)
+		}
+		if n, err := parseSize(c.ChunkSize); err != nil || n <= 0 {
+			return fmt.Errorf("uploads: %s: chunk_size must be a size such as 8M, not %q", c.Name, c.ChunkSize)
+		}
+	}
+
+	return nil
+}
+
+func (c *UploadConfig) retries() int {
+	if c.Retries == 0 {
+		return 3
+	}
+	return c.Retries
+}
+
+func (c *UploadConfig) chunkSize() int64 {
+	if n, err := parseSize(c.ChunkSize); err == nil && n > 0 {
+		return n
+	}
+	return 8 << 20
+}
+
+// Uploads returns the artifacts of m that c uploads, with their paths.
+func (c *UploadConfig) Uploads(m *ArtifactManifest) ([]Artifact, []string) {
+	return selectArtifacts(m, c.Kinds)
+}
+
+// selectArtifacts returns the artifacts of m of the given kinds, with
+// their paths. Without kinds they are the archives, checksums, packages
+// and signatures, or the binaries when there are no archives.
+func selectArtifacts(m *ArtifactManifest, kinds []string) ([]Artifact, []string) {
+	selected := make(map[string]bool)
+	for _, k := range kinds {
+		selected[k] = true
+	}
+	if len(selected) == 0 {
+		selected = map[string]bool{artifactArchive: true, artifactChecksums: true, artifactPackage: true, artifactSignature: true}
+		archived := false
+		for _, a := range m.Artifacts {
+			archived = archived || a.Kind == artifactArchive
+		}
+		selected[artifactBinary] = !archived
+	}
+
+	var artifacts []Artifact
+	var paths []string
+	for i, p := range m.Paths() {
+		if selected[m.Artifacts[i].Kind] {
+			artifacts = append(artifacts, m.Artifacts[i])
+			paths = append(paths, p)
+		}
+	}
+	return artifacts, paths
+}
+
+// URLFor returns where the artifact a is uploaded to.
+func (c *UploadConfig) URLFor(a Artifact, version string) (string, error) {
+	t, err := template.New("url").Parse(c.URL)
+	if err != nil {
+		return "", err
+	}
+
+	data := &uploadData{
+		Name:    path.Base(a.Path),
+		Path:    a.Path,
+		Kind:    a.Kind,
+		Version: version,
+	}
+	if parts := strings.SplitN(a.Platform, "/", 2); len(parts) == 2 {
+		data.OS, data.Arch = parts[0], parts[1]
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Uploaded reports whether the file at path is already at url, with
+// SkipExisting. The server has it if it answers a HEAD with the SHA-256
+// of the file in X-Checksum-Sha256, as Artifactory and Nexus do, or its
+// MD5 as the ETag, as S3 and MinIO do for files that weren't uploaded in
+// parts. Servers that don't answer HEAD requests, such as presigned PUT
+// URLs, never have it.
+func (c *UploadConfig) Uploaded(path, url string) bool {
+	if !c.SkipExisting {
+		return false
+	}
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false
+	}
+	c.header(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return false
+	}
+
+	sums, _, err := uploadSums(path)
+	if err != nil {
+		return false
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	return resp.Header.Get("X-Checksum-Sha256") == sums["X-Checksum-Sha256"] || etag == sums["X-Checksum-Md5"]
+}
+
+// Upload uploads the file at path to url, with the MD5, SHA-1 and SHA-256
+// of the file in the X-Checksum headers that Artifactory and Nexus check
+// it against, retrying failed uploads. The file is streamed from disk,
+// at most as fast as -bandwidth-limit.
+func (c *UploadConfig) Upload(path, url string) error {
+	sums, size, err := uploadSums(path)
+	if err != nil {
+		return err
+	}
+	if c.Resumable {
+		return c.uploadResumable(path, url, size, sums)
+	}
+
+	method := c.Method
+	if method == "" {
+		method = "PUT"
+	}
+	return c.retry(path, func() error {
+		return c.put(method, url, path, size, sums)
+	})
+}
+
+// retry runs upload until it succeeds, up to Retries more times with a
+// growing delay, for as long as it fails in a way that may succeed when
+// it is tried again.
+func (c *UploadConfig) retry(path string, upload func() error) error {
+	delay := uploadBackoff
+	for attempt := 0; ; attempt++ {
+		err := upload()
+		if err == nil || attempt >= c.retries() {
+			return err
+		}
+		if se, ok := err.(*httpStatusError); ok && !se.retry() {
+			return err
+		}
+
+		ui.Debugf("retrying upload of %s in %s: %s", path, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// uploadResumable uploads the file at path, of size bytes, with the tus
+// protocol: a POST to url creates the upload, at the Location that the
+// server answers with, and the file is sent to it in PATCH requests of
+// chunkSize. Each of them is retried on its own, from the offset that a
+// HEAD of the upload has, so a connection that drops only loses the
+// request it dropped in.
+func (c *UploadConfig) uploadResumable(path, url string, size int64, sums map[string]string) error {
+	var location string
+	err := c.retry(path, func() error {
+		var err error
+		location, err = c.createUpload(url, path, size, sums)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	known := true
+	for offset < size {
+		err := c.retry(path, func() error {
+			var err error
+			if !known {
+				if offset, err = c.uploadOffset(location); err != nil {
+					return err
+				}
+				known = true
+			}
+			next, err := c.patch(location, path, offset, size)
+			if se, ok := err.(*httpStatusError); ok && se.Code == http.StatusConflict {
+				// The server got further than the response of the last
+				// request said
+				err = fmt.Errorf("upload offset %d: %s", offset, se)
+			}
+			if err != nil {
+				known = false
+				return err
+			}
+			offset = next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUpload creates the tus upload of the file at path, of size bytes,
+// at url and returns its URL. Its name and SHA-256 are in the metadata.
+func (c *UploadConfig) createUpload(url, path string, size int64, sums map[string]string) (string, error) {
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filepath.Base(path)))+
+		",sha256 "+base64.StdEncoding.EncodeToString([]byte(sums["X-Checksum-Sha256"])))
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", fmt.Errorf("%s: the server didn't answer with the Location of the upload", url)
+	}
+	return location.String(), nil
+}
+
+// uploadOffset returns how much of the tus upload at location the server
+// has.
+func (c *UploadConfig) uploadOffset(location string) (int64, error) {
+	req, err := http.NewRequest("HEAD", location, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	return parseUploadOffset(resp)
+}
+
+// patch sends the chunk of the file at path, of size bytes, from offset
+// to the tus upload at location, and returns the offset that the server
+// got to.
+func (c *UploadConfig) patch(location, path string, offset, size int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := c.chunkSize()
+	if size-offset < n {
+		n = size - offset
+	}
+	req, err := http.NewRequest("PATCH", location, limitUpload(io.NewSectionReader(f, offset, n)))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	next, err := parseUploadOffset(resp)
+	if err == nil && next <= offset {
+		err = fmt.Errorf("the upload is still at offset %d", next)
+	}
+	return next, err
+}
+
+// parseUploadOffset returns the Upload-Offset of a tus response.
+func parseUploadOffset(resp *http.Response) (int64, error) {
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("the server answered with an invalid Upload-Offset %q", resp.Header.Get("Upload-Offset"))
+	}
+	return offset, nil
+}
+
+// do makes the request with the headers of c, and returns the response,
+// whose body is closed, if the server accepted it.
+func (c *UploadConfig) do(req *http.Request) (*http.Response, error) {
+	c.header(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &httpStatusError{resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+func (c *UploadConfig) put(method, url, path string, size int64, sums map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequest(method, url, limitUpload(f))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for k, v := range sums {
+		req.Header.Set(k, v)
+	}
+	_, err = c.do(req)
+	return err
+}
+
+// header sets the headers and the authentication of c on req. Without
+// credentials in the config, the login of the host in .netrc is used.
+func (c *UploadConfig) header(req *http.Request) {
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case c.TokenEnv != "":
+		req.Header.Set("Authorization", "Bearer "+getenvSecret(c.TokenEnv))
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, getenvSecret(c.PasswordEnv))
+	case req.Header.Get("Authorization") == "":
+		if login, password, ok := netrcLogin(req.URL.Hostname()); ok {
+			req.SetBasicAuth(login, password)
+		}
+	}
+}
+
+// httpStatusError is a request that the server didn't accept.
+type httpStatusError struct {
+	Code    int
+	Status  string
+	Message string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Message
+}
+
+// retry reports whether the request may succeed if it is tried again.
+func (e *httpStatusError) retry() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// uploadSums returns the X-Checksum headers of the file at path and its
+// size, reading it once.
+func uploadSums(path string) (map[string]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	hashes := map[string]hash.Hash{
+		"X-Checksum-Md5":    md5.New(),
+		"X-Checksum-Sha1":   sha1.New(),
+		"X-Checksum-Sha256": sha256.New(),
+	}
+	var writers []io.Writer
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sums := make(map[string]string, len(hashes))
+	for k, h := range hashes {
+		sums[k] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, size, nil
+}
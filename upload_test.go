@@ -0,0 +1,244 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadConfigUploads(t *testing.T) {
+	m := NewArtifactManifest("dist")
+	m.Artifacts = []Artifact{
+		{Kind: artifactBinary, Path: "linux_amd64/app"},
+		{Kind: artifactArchive, Path: "app_linux_amd64.tar.gz"},
+		{Kind: artifactChecksums, Path: "SHA256SUMS"},
+		{Kind: artifactLink, Path: "app"},
+	}
+
+	c := &UploadConfig{}
+	artifacts, paths := c.Uploads(m)
+	if len(artifacts) != 2 || !reflect.DeepEqual(paths, []string{
+		filepath.Join("dist", "app_linux_amd64.tar.gz"),
+		filepath.Join("dist", "SHA256SUMS"),
+	}) {
+		t.Fatalf("bad: %#v", paths)
+	}
+
+	c.Kinds = []string{artifactBinary}
+	if artifacts, _ := c.Uploads(m); len(artifacts) != 1 || artifacts[0].Path != "linux_amd64/app" {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+
+	m.Artifacts = m.Artifacts[:1]
+	c.Kinds = nil
+	if artifacts, _ := c.Uploads(m); len(artifacts) != 1 || artifacts[0].Kind != artifactBinary {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+}
+
+func TestUploadConfigURLFor(t *testing.T) {
+	c := &UploadConfig{URL: "https://example.com/{{.Version}}/{{.OS}}-{{.Arch}}/{{.Kind}}/{{.Name}}"}
+	url, err := c.URLFor(Artifact{Kind: "archive", Platform: "linux/arm64", Path: "pkg/app.tar.gz"}, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if url != "https://example.com/1.2.3/linux-arm64/archive/app.tar.gz" {
+		t.Fatalf("bad: %s", url)
+	}
+}
+
+func TestUploadConfigUpload(t *testing.T) {
+	defer func(d time.Duration) { uploadBackoff = d }(uploadBackoff)
+	uploadBackoff = 0
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "app.tar.gz")
+	ioutil.WriteFile(path, []byte("archive"), 0644)
+
+	defer os.Setenv("GOX_TEST_PASSWORD", os.Getenv("GOX_TEST_PASSWORD"))
+	os.Setenv("GOX_TEST_PASSWORD", "secret")
+
+	var requests int
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ci" || pass != "secret" || r.Method != "PUT" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	c := &UploadConfig{Username: "ci", PasswordEnv: "GOX_TEST_PASSWORD", Headers: map[string]string{"X-Extra": "1"}}
+	if err := c.Upload(path, server.URL+"/app.tar.gz"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum, _ := fileSHA256(path)
+	if requests != 2 || string(body) != "archive" || header.Get("X-Checksum-Sha256") != sum ||
+		header.Get("X-Checksum-Md5") == "" || header.Get("X-Extra") != "1" {
+		t.Fatalf("bad: %d %q %#v", requests, body, header)
+	}
+
+	// Errors other than those of the server aren't retried
+	requests = 0
+	c.Username = "someone"
+	if err := c.Upload(path, server.URL+"/app.tar.gz"); err == nil || requests != 2 {
+		t.Fatalf("bad: %d %s", requests, err)
+	}
+}
+
+func TestUploadConfigUpload_resumable(t *testing.T) {
+	defer func(d time.Duration) { uploadBackoff = d }(uploadBackoff)
+	uploadBackoff = 0
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "app.tar.gz")
+	ioutil.WriteFile(path, []byte("0123456789"), 0644)
+
+	// The server only gets part of the second chunk before it fails
+	var received []byte
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Upload-Offset"))
+		if r.Header.Get("Tus-Resumable") != "1.0.0" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		switch r.Method {
+		case "POST":
+			if r.Header.Get("Upload-Length") != "10" || !strings.HasPrefix(r.Header.Get("Upload-Metadata"), "filename YXBwLnRhci5neg==,sha256 ") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", "/files/1")
+			w.WriteHeader(http.StatusCreated)
+		case "HEAD":
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(received)))
+		case "PATCH":
+			if r.Header.Get("Upload-Offset") != strconv.Itoa(len(received)) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			if len(requests) == 3 {
+				received = append(received, data[:2]...)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			received = append(received, data...)
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(received)))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	c := &UploadConfig{Resumable: true, ChunkSize: "4"}
+	if err := c.Upload(path, server.URL+"/files/"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{
+		"POST /files/ ",
+		"PATCH /files/1 0",
+		"PATCH /files/1 4",
+		"HEAD /files/1 ",
+		"PATCH /files/1 6",
+	}
+	if string(received) != "0123456789" || !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("bad: %q\n%s", received, strings.Join(requests, "\n"))
+	}
+}
+
+func TestUploadConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config UploadConfig
+		Err    bool
+	}{
+		{UploadConfig{Name: "a", URL: "https://example.com/{{.Name}}"}, false},
+		{UploadConfig{Name: "a", URL: "https://example.com/files/", Resumable: true, ChunkSize: "16M"}, false},
+		{UploadConfig{Name: "a", URL: "https://example.com/files/", Resumable: true, SkipExisting: true}, true},
+		{UploadConfig{Name: "a", URL: "https://example.com/files/", Resumable: true, Method: "POST"}, true},
+		{UploadConfig{Name: "a", URL: "https://example.com/files/", Resumable: true, ChunkSize: "0"}, true},
+		{UploadConfig{Name: "a", URL: "https://example.com/{{.Name}}", ChunkSize: "16M"}, true},
+	}
+	for i, tc := range cases {
+		if err := tc.Config.Validate(); (err != nil) != tc.Err {
+			t.Fatalf("%d: bad: %s", i, err)
+		}
+	}
+}
+
+func TestUploadConfigUploaded(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "app.tar.gz")
+	ioutil.WriteFile(path, []byte("archive"), 0644)
+	sums, _, err := uploadSums(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var head http.Header
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != "HEAD" || head == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range head {
+			w.Header()[k] = v
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		Header   http.Header
+		Uploaded bool
+	}{
+		{nil, false},
+		{http.Header{"X-Checksum-Sha256": {sums["X-Checksum-Sha256"]}}, true},
+		{http.Header{"Etag": {`"` + sums["X-Checksum-Md5"] + `"`}}, true},
+		{http.Header{"X-Checksum-Sha256": {"0000"}, "Etag": {`"0000-2"`}}, false},
+	}
+
+	c := &UploadConfig{SkipExisting: true}
+	for _, tc := range cases {
+		head = tc.Header
+		if actual := c.Uploaded(path, server.URL+"/app.tar.gz"); actual != tc.Uploaded {
+			t.Fatalf("bad: %#v: %t", tc.Header, actual)
+		}
+	}
+
+	// Without skip_existing the server isn't asked
+	requests = 0
+	c.SkipExisting = false
+	if c.Uploaded(path, server.URL+"/app.tar.gz") || requests != 0 {
+		t.Fatalf("bad: %d", requests)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VaultConfig is the "vault" section of the config file. It fetches the
+// credentials of publishing and signing from HashiCorp Vault when gox
+// starts, so that CI doesn't have to keep them as long-lived secrets.
+// Secrets stand in for the environment variables that the other sections
+// read them from, such as the "token_env" of "release" and the
+// "password_env" of "authenticode", and Files are written for those that
+// take files, such as the "cert" and "key" of "authenticode".
+//
+// Variables that are already set and files that already exist are left
+// as they are, and Vault isn't asked at all when nothing is missing, so
+// that they can be given locally instead.
+type VaultConfig struct {
+	// Address is the URL of Vault, defaults to $VAULT_ADDR.
+	Address string `json:"address,omitempty"`
+
+	// Namespace is the namespace of Vault Enterprise, defaults to
+	// $VAULT_NAMESPACE.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Auth is how gox logs in to Vault. Without it, the token is
+	// $VAULT_TOKEN or the one of `vault login` in ~/.vault-token.
+	Auth *VaultAuthConfig `json:"auth,omitempty"`
+
+	// Secrets are the environment variables to set, and Files the paths
+	// to write, to secrets, each "<path>#<field>". The path is that of the
+	// API, such as "secret/data/ci/github" for the "ci/github" secret of
+	// a KV version 2 engine mounted at "secret".
+	Secrets map[string]string `json:"secrets,omitempty"`
+	Files   map[string]string `json:"files,omitempty"`
+}
+
+// VaultAuthConfig is a method of logging in to Vault.
+type VaultAuthConfig struct {
+	// Method is "jwt", to log in with the OIDC token of the CI job, or
+	// "approle".
+	Method string `json:"method"`
+
+	// Mount is where the method is mounted, defaults to its name.
+	Mount string `json:"mount,omitempty"`
+
+	// Role is the role of jwt to log in as.
+	Role string `json:"role,omitempty"`
+
+	// TokenEnv is the environment variable with the JWT, such as one of
+	// the id_tokens of a GitLab CI job. On GitHub Actions, without it, a
+	// token for Audience is requested from the OIDC provider of the
+	// workflow, which needs the "id-token: write" permission.
+	TokenEnv string `json:"token_env,omitempty"`
+	Audience string `json:"audience,omitempty"`
+
+	// RoleIDEnv and SecretIDEnv are the environment variables with the
+	// role ID and secret ID of approle.
+	RoleIDEnv   string `json:"role_id_env,omitempty"`
+	SecretIDEnv string `json:"secret_id_env,omitempty"`
+}
+
+// Validate checks the address, the references to secrets and what the
+// auth method needs.
+func (c *VaultConfig) Validate() error {
+	if c.Address != "" {
+		if u, err := url.Parse(c.Address); err != nil || u.Host == "" {
+			return fmt.Errorf("vault: address must be an absolute URL, not %q", c.Address)
+		}
+	}
+	for _, refs := range []map[string]string{c.Secrets, c.Files} {
+		for name, ref := range refs {
+			if name == "" {
+				return fmt.Errorf("vault: empty secret name")
+			}
+			if _, _, err := parseVaultRef(ref); err != nil {
+				return fmt.Errorf("vault: %s: %s", name, err)
+			}
+		}
+	}
+	if a := c.Auth; a != nil {
+		switch a.Method {
+		case "jwt":
+			if a.Role == "" {
+				return fmt.Errorf("vault: auth: role is required for jwt")
+			}
+		case "approle":
+			if a.RoleIDEnv == "" || a.SecretIDEnv == "" {
+				return fmt.Errorf("vault: auth: role_id_env and secret_id_env are required for approle")
+			}
+		default:
+			return fmt.Errorf("vault: auth: unknown method %q, must be jwt or approle", a.Method)
+		}
+	}
+
+	return nil
+}
+
+// vaultSecrets are the environment variables that were fetched from
+// Vault. They are kept out of the environment of gox, so that the go
+// commands, smoke tests and packaging tools that it runs don't inherit
+// them: gox reads them with getenvSecret, and only the signing and
+// publishing commands are given them, with secretEnviron.
+var vaultSecrets = map[string]string{}
+
+// getenvSecret returns the environment variable name, or the secret of
+// Vault that stands in for it.
+func getenvSecret(name string) string {
+	if v, ok := vaultSecrets[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// secretEnviron returns the environment with the secrets of Vault, for
+// the commands that sign and publish, or nil to run them in that of gox.
+func secretEnviron() []string {
+	if len(vaultSecrets) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for name, value := range vaultSecrets {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// parseVaultRef splits a reference to a secret into its path and field.
+func parseVaultRef(ref string) (string, string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", fmt.Errorf("%q must be <path>#<field>", ref)
+	}
+	return strings.Trim(ref[:i], "/"), ref[i+1:], nil
+}
+
+// Load fetches the environment variables of Secrets, into vaultSecrets,
+// and writes the Files that are missing, and returns the paths of the files that it wrote, to
+// be removed once gox is done.
+func (c *VaultConfig) Load() ([]string, error) {
+	var envs, files []string
+	for name := range c.Secrets {
+		if getenvSecret(name) == "" {
+			envs = append(envs, name)
+		}
+	}
+	for path := range c.Files {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			files = append(files, path)
+		}
+	}
+	if len(envs) == 0 && len(files) == 0 {
+		return nil, nil
+	}
+	sort.Strings(envs)
+	sort.Strings(files)
+
+	if c.address() == "" {
+		return nil, fmt.Errorf("vault: address or VAULT_ADDR is required")
+	}
+	token, err := c.login()
+	if err != nil {
+		return nil, fmt.Errorf("vault: logging in: %s", err)
+	}
+
+	secrets := make(map[string]map[string]interface{})
+	read := func(ref string) (string, error) {
+		path, field, _ := parseVaultRef(ref)
+		data, ok := secrets[path]
+		if !ok {
+			if data, err = c.read(token, path); err != nil {
+				return "", fmt.Errorf("vault: reading %s: %s", path, err)
+			}
+			secrets[path] = data
+		}
+		switch v := data[field].(type) {
+		case string:
+			return v, nil
+		case nil:
+			return "", fmt.Errorf("vault: %s has no field %s", path, field)
+		default:
+			// Fields can hold JSON, such as a service account key
+			value, err := json.Marshal(v)
+			return string(value), err
+		}
+	}
+
+	for _, name := range envs {
+		value, err := read(c.Secrets[name])
+		if err != nil {
+			return nil, err
+		}
+		vaultSecrets[name] = value
+	}
+	var written []string
+	for _, path := range files {
+		value, err := read(c.Files[path])
+		if err == nil {
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				err = ioutil.WriteFile(path, []byte(value), 0600)
+			}
+		}
+		if err != nil {
+			removeFiles(written)
+			return nil, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// removeFiles removes the files that Load wrote.
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+func (c *VaultConfig) address() string {
+	if c.Address != "" {
+		return strings.TrimSuffix(c.Address, "/")
+	}
+	return strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+}
+
+// login returns the token to read the secrets with.
+func (c *VaultConfig) login() (string, error) {
+	a := c.Auth
+	if a == nil {
+		if token := os.Getenv("VAULT_TOKEN"); token != "" {
+			return token, nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("no VAULT_TOKEN, auth or ~/.vault-token")
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	in := map[string]string{"role_id": os.Getenv(a.RoleIDEnv), "secret_id": os.Getenv(a.SecretIDEnv)}
+	if a.Method == "jwt" {
+		jwt, err := a.jwt()
+		if err != nil {
+			return "", err
+		}
+		in = map[string]string{"role": a.Role, "jwt": jwt}
+	}
+	mount := a.Mount
+	if mount == "" {
+		mount = a.Method
+	}
+
+	var out struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	if err := c.request("POST", "auth/"+strings.Trim(mount, "/")+"/login", "", bytes.NewReader(data), &out); err != nil {
+		return "", err
+	}
+	if out.Auth.ClientToken == "" {
+		return "", fmt.Errorf("Vault returned no token")
+	}
+	return out.Auth.ClientToken, nil
+}
+
+// jwt returns the token of the CI job to log in with.
+func (a *VaultAuthConfig) jwt() (string, error) {
+	if a.TokenEnv != "" {
+		if jwt := os.Getenv(a.TokenEnv); jwt != "" {
+			return jwt, nil
+		}
+		return "", fmt.Errorf("%s isn't set", a.TokenEnv)
+	}
+
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", fmt.Errorf("token_env is required outside of GitHub Actions jobs with the id-token: write permission")
+	}
+	if a.Audience != "" {
+		requestURL += "&audience=" + url.QueryEscape(a.Audience)
+	}
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := doJSON(req, &out); err != nil {
+		return "", fmt.Errorf("requesting the OIDC token of the job: %s", err)
+	}
+	return out.Value, nil
+}
+
+// read reads the data of the secret at path. The data of KV version 2
+// secrets is in the data of the response, next to their metadata.
+func (c *VaultConfig) read(token, path string) (map[string]interface{}, error) {
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.request("GET", path, token, nil, &out); err != nil {
+		return nil, err
+	}
+	if inner, ok := out.Data["data"].(map[string]interface{}); ok {
+		if _, ok := out.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return out.Data, nil
+}
+
+// request makes a request to the API of Vault and decodes the JSON
+// response into out.
+func (c *VaultConfig) request(method, path, token string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.address()+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	return doJSON(req, out)
+}
+
+// doJSON makes the request and decodes the JSON response into out.
+func doJSON(req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &httpStatusError{resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionConfig is the "version" section of the config file. It sets
+// where the release version that archives, checksums and packages are
+// named with comes from, instead of `git describe --tags`.
+type VersionConfig struct {
+	// Source is one of:
+	//
+	//   "git"    `git describe --tags`, the default
+	//   "file"   the contents of File, "VERSION" by default
+	//   "bazel"  the value of Key in the Bazel stamp file File, by default
+	//            STABLE_VERSION in bazel-out/stable-status.txt
+	//   "env"    the environment variable Env, such as CI_COMMIT_TAG
+	//   "calver" generated from the date with Format
+	//
+	// A leading "v" is removed from all of them.
+	Source string `json:"source,omitempty"`
+	File   string `json:"file,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Env    string `json:"env,omitempty"`
+
+	// Format is the CalVer format, made of the tokens YYYY, YY, 0Y, MM,
+	// 0M, DD, 0D and MICRO separated by "." or "-". MICRO counts up from
+	// 0 past the git tags that already have the same prefix, and is 0
+	// outside of git. Defaults to "YYYY.0M.MICRO".
+	Format string `json:"format,omitempty"`
+
+	// Require is "semver" or "calver" to fail the build when the version
+	// doesn't conform to it, for packaging that needs one or the other.
+	Require string `json:"require,omitempty"`
+}
+
+// semverRe matches a semantic version 2.0.0.
+var semverRe = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+	`(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// calverRe matches a calendar version such as 2024.06.1 or 24.6.
+var calverRe = regexp.MustCompile(`^[0-9]{2,4}([.-][0-9]{1,2}){1,2}([.-][0-9]+)?(-[0-9A-Za-z.-]+)?$`)
+
+// versionTemplateRe matches the use of the release version in a template.
+var versionTemplateRe = regexp.MustCompile(`{{[^}]*\.Version\b`)
+
+// calverTokenRe matches the tokens of a CalVer format.
+var calverTokenRe = regexp.MustCompile(`YYYY|YY|0Y|MM|0M|DD|0D|MICRO`)
+
+// Validate checks the source and the settings it needs.
+func (c *VersionConfig) Validate() error {
+	switch c.Source {
+	case "", "git", "file", "bazel", "calver":
+	case "env":
+		if c.Env == "" {
+			return fmt.Errorf("version: the env source needs an env variable")
+		}
+	default:
+		return fmt.Errorf("version: unknown source %q, must be git, file, bazel, env or calver", c.Source)
+	}
+	if c.Source == "calver" && c.Format != "" && !calverTokenRe.MatchString(c.Format) {
+		return fmt.Errorf("version: format %q has no CalVer tokens", c.Format)
+	}
+
+	switch c.Require {
+	case "", "semver", "calver":
+	default:
+		return fmt.Errorf("version: require must be semver or calver, not %q", c.Require)
+	}
+
+	return nil
+}
+
+// Resolve returns the release version from the configured source, or
+// flag, the value of -version, if it is set. Without a version section it
+// is releaseVersion.
+func (c *VersionConfig) Resolve(flag string) (string, error) {
+	if c == nil {
+		if flag != "" {
+			return strings.TrimPrefix(flag, "v"), nil
+		}
+		return releaseVersion(), nil
+	}
+
+	var v string
+	var err error
+	source := c.Source
+	if flag != "" {
+		source = "flag"
+	}
+	switch source {
+	case "flag":
+		v = flag
+	case "", "git":
+		v = releaseVersion()
+	case "file":
+		v, err = c.fileVersion()
+	case "bazel":
+		v, err = c.bazelVersion()
+	case "env":
+		if v = os.Getenv(c.Env); v == "" {
+			err = fmt.Errorf("%s is not set", c.Env)
+		}
+	case "calver":
+		v = c.calver(artifactTime(), gitTags)
+	}
+	if err != nil {
+		return "", err
+	}
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+
+	switch {
+	case c.Require == "semver" && !semverRe.MatchString(v):
+		return "", fmt.Errorf("version %q from %s is not a semantic version", v, c.source(flag))
+	case c.Require == "calver" && !calverRe.MatchString(v):
+		return "", fmt.Errorf("version %q from %s is not a calendar version", v, c.source(flag))
+	}
+
+	return v, nil
+}
+
+// GitFallback returns why the version is 0 when it comes from git, but git
+// has none, such as outside of a repository. It is nil if the version
+// came from elsewhere or git has one.
+func (c *VersionConfig) GitFallback(flag string) error {
+	if flag != "" || (c != nil && c.Source != "" && c.Source != "git") {
+		return nil
+	}
+	if _, err := gitDescribe(); err != nil {
+		return fmt.Errorf("%s", gitReason(err))
+	}
+	return nil
+}
+
+// usesVersion reports whether any of the templates uses {{.Version}}.
+func usesVersion(templates ...string) bool {
+	for _, tpl := range templates {
+		if versionTemplateRe.MatchString(tpl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *VersionConfig) source(flag string) string {
+	if flag != "" {
+		return "-version"
+	}
+	if c.Source == "" {
+		return "git"
+	}
+	return c.Source
+}
+
+func (c *VersionConfig) fileVersion() (string, error) {
+	path := c.File
+	if path == "" {
+		path = "VERSION"
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return v, nil
+}
+
+// bazelVersion reads the version from a Bazel workspace status file, which
+// has a "KEY value" pair on each line.
+func (c *VersionConfig) bazelVersion() (string, error) {
+	path, key := c.File, c.Key
+	if path == "" {
+		path = "bazel-out/stable-status.txt"
+	}
+	if key == "" {
+		key = "STABLE_VERSION"
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) == 2 && parts[0] == key {
+			return parts[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("%s has no %s", path, key)
+}
+
+// calver generates the version for the date t. tags lists the git tags
+// that start with a prefix, for MICRO.
+func (c *VersionConfig) calver(t time.Time, tags func(prefix string) []string) string {
+	format := c.Format
+	if format == "" {
+		format = "YYYY.0M.MICRO"
+	}
+
+	t = t.UTC()
+	v := calverTokenRe.ReplaceAllStringFunc(format, func(token string) string {
+		switch token {
+		case "YYYY":
+			return strconv.Itoa(t.Year())
+		case "YY":
+			return strconv.Itoa(t.Year() % 100)
+		case "0Y":
+			return fmt.Sprintf("%02d", t.Year()%100)
+		case "MM":
+			return strconv.Itoa(int(t.Month()))
+		case "0M":
+			return fmt.Sprintf("%02d", int(t.Month()))
+		case "DD":
+			return strconv.Itoa(t.Day())
+		case "0D":
+			return fmt.Sprintf("%02d", t.Day())
+		}
+		return token
+	})
+
+	idx := strings.Index(v, "MICRO")
+	if idx < 0 {
+		return v
+	}
+
+	// MICRO is one past the highest of the tags with the same prefix
+	prefix := v[:idx]
+	micro := 0
+	for _, tag := range tags(prefix) {
+		rest := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), prefix)
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		if n, err := strconv.Atoi(rest[:end]); err == nil && n >= micro {
+			micro = n + 1
+		}
+	}
+
+	return prefix + strconv.Itoa(micro) + v[idx+len("MICRO"):]
+}
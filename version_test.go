@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config VersionConfig
+		Err    bool
+	}{
+		{VersionConfig{}, false},
+		{VersionConfig{Source: "file", Require: "semver"}, false},
+		{VersionConfig{Source: "env"}, true},
+		{VersionConfig{Source: "env", Env: "CI_COMMIT_TAG"}, false},
+		{VersionConfig{Source: "svn"}, true},
+		{VersionConfig{Source: "calver", Format: "1.2.3"}, true},
+		{VersionConfig{Require: "pep440"}, true},
+	}
+
+	for _, tc := range cases {
+		if err := tc.Config.Validate(); (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestVersionConfigResolve(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	versionFile := filepath.Join(td, "VERSION")
+	if err := ioutil.WriteFile(versionFile, []byte("v1.2.3\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	stampFile := filepath.Join(td, "stable-status.txt")
+	stamp := "BUILD_SCM_REVISION deadbeef\nSTABLE_VERSION 2.0.0-rc.1\n"
+	if err := ioutil.WriteFile(stampFile, []byte(stamp), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Setenv("GOX_TEST_VERSION", "v3.1.0")
+	defer os.Unsetenv("GOX_TEST_VERSION")
+
+	cases := []struct {
+		Config VersionConfig
+		Output string
+		Err    bool
+	}{
+		{VersionConfig{Source: "file", File: versionFile}, "1.2.3", false},
+		{VersionConfig{Source: "file", File: versionFile, Require: "calver"}, "", true},
+		{VersionConfig{Source: "file", File: filepath.Join(td, "missing")}, "", true},
+		{VersionConfig{Source: "bazel", File: stampFile, Require: "semver"}, "2.0.0-rc.1", false},
+		{VersionConfig{Source: "bazel", File: stampFile, Key: "STABLE_OTHER"}, "", true},
+		{VersionConfig{Source: "env", Env: "GOX_TEST_VERSION"}, "3.1.0", false},
+		{VersionConfig{Source: "env", Env: "GOX_TEST_UNSET"}, "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := tc.Config.Resolve("")
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Config, err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%#v: bad: %s", tc.Config, actual)
+		}
+	}
+}
+
+func TestVersionConfigResolve_flag(t *testing.T) {
+	var c *VersionConfig
+	if v, err := c.Resolve("v2.0.0"); err != nil || v != "2.0.0" {
+		t.Fatalf("bad: %s %s", v, err)
+	}
+
+	c = &VersionConfig{Source: "env", Env: "GOX_TEST_UNSET", Require: "semver"}
+	if v, err := c.Resolve("2.0.0"); err != nil || v != "2.0.0" {
+		t.Fatalf("bad: %s %s", v, err)
+	}
+	if _, err := c.Resolve("nightly"); err == nil || !strings.Contains(err.Error(), "-version") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestVersionConfigCalver(t *testing.T) {
+	date := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	tags := func(prefix string) []string {
+		if prefix != "2024.06." {
+			return nil
+		}
+		return []string{"2024.06.0", "v2024.06.3", "2024.06.1-rc1", "2024.06.x"}
+	}
+
+	cases := []struct {
+		Format string
+		Output string
+	}{
+		{"", "2024.06.4"},
+		{"YY.MM.DD", "24.6.5"},
+		{"0Y.0M.0D-MICRO", "24.06.05-0"},
+		{"YYYY.MM", "2024.6"},
+	}
+
+	for _, tc := range cases {
+		c := &VersionConfig{Source: "calver", Format: tc.Format}
+		actual := c.calver(date, tags)
+		if actual != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Format, actual)
+		}
+		if !calverRe.MatchString(actual) {
+			t.Fatalf("%s: not calver: %s", tc.Format, actual)
+		}
+	}
+}
+
+func TestVersionConfigGitFallback(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+	os.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(td))
+	defer os.Unsetenv("GIT_CEILING_DIRECTORIES")
+
+	var none *VersionConfig
+	if err := none.GitFallback(""); err == nil {
+		t.Fatal("should have no version outside of git")
+	}
+	if err := (&VersionConfig{Source: "git"}).GitFallback(""); err == nil {
+		t.Fatal("should have no version outside of git")
+	}
+	if err := none.GitFallback("1.0.0"); err != nil {
+		t.Fatalf("-version: err: %s", err)
+	}
+	if err := (&VersionConfig{Source: "file"}).GitFallback(""); err != nil {
+		t.Fatalf("file: err: %s", err)
+	}
+}
+
+func TestUsesVersion(t *testing.T) {
+	cases := []struct {
+		Templates []string
+		Expected  bool
+	}{
+		{[]string{"{{.Dir}}_{{.OS}}_{{.Arch}}"}, false},
+		{[]string{"{{.Dir}}_{{.OS}}_{{.Arch}}", "-X main.version={{.Version}}"}, true},
+		{[]string{"dist/{{ .Version }}/{{.Dir}}"}, true},
+		{[]string{"{{.Dir}}_{{.VersionName}}"}, false},
+		{[]string{"-X main.version=Version"}, false},
+	}
+
+	for _, tc := range cases {
+		if actual := usesVersion(tc.Templates...); actual != tc.Expected {
+			t.Fatalf("%#v: bad: %v", tc.Templates, actual)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// VersionInfoConfig is the "versioninfo" section of the config file. It
+// embeds a version resource, and optionally an icon, into windows
+// binaries so that Explorer shows their details.
+type VersionInfoConfig struct {
+	// Version is the file and product version, such as "1.2.3". It
+	// defaults to `git describe --tags` of the current directory.
+	Version string `json:"version,omitempty"`
+
+	ProductName     string `json:"product_name,omitempty"`
+	CompanyName     string `json:"company_name,omitempty"`
+	FileDescription string `json:"file_description,omitempty"`
+	Copyright       string `json:"copyright,omitempty"`
+	Trademarks      string `json:"trademarks,omitempty"`
+	Comments        string `json:"comments,omitempty"`
+
+	// Icon is the path to a .ico file to use as the icon of the binary.
+	Icon string `json:"icon,omitempty"`
+}
+
+// vsFixedFileInfo is the VS_FIXEDFILEINFO structure.
+type vsFixedFileInfo struct {
+	Signature        uint32
+	StrucVersion     uint32
+	FileVersionMS    uint32
+	FileVersionLS    uint32
+	ProductVersionMS uint32
+	ProductVersionLS uint32
+	FileFlagsMask    uint32
+	FileFlags        uint32
+	FileOS           uint32
+	FileType         uint32
+	FileSubtype      uint32
+	FileDateMS       uint32
+	FileDateLS       uint32
+}
+
+// fileVersionRe matches up to four numbers at the start of a version,
+// such as the "1.2.3" and "4" of "v1.2.3-4-gdeadbee" from git describe.
+var fileVersionRe = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:[.-](\d+))?`)
+
+// Validate checks that the icon, if any, can be read.
+func (c *VersionInfoConfig) Validate() error {
+	if c.Icon != "" {
+		if _, err := os.Stat(c.Icon); err != nil {
+			return fmt.Errorf("versioninfo: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// resolveVersion fills in the version from git if it isn't configured.
+func (c *VersionInfoConfig) resolveVersion() error {
+	if c.Version != "" {
+		return nil
+	}
+
+	v, err := gitDescribe()
+	if err != nil {
+		return fmt.Errorf("versioninfo: version isn't set and %s", err)
+	}
+	c.Version = v
+	return nil
+}
+
+// parseFileVersion returns the four numbers of a windows file version
+// from a version string. Missing numbers are zero.
+func parseFileVersion(v string) [4]uint16 {
+	var result [4]uint16
+	m := fileVersionRe.FindStringSubmatch(v)
+	for i := 1; i < len(m); i++ {
+		n, _ := strconv.ParseUint(m[i], 10, 16)
+		result[i-1] = uint16(n)
+	}
+
+	return result
+}
+
+// Resources returns the windows resources for a binary named name.
+func (c *VersionInfoConfig) Resources(name string) ([]winResource, error) {
+	resources := []winResource{
+		{Type: rtVersion, ID: 1, Data: c.versionResource(name)},
+	}
+	if c.Icon != "" {
+		data, err := ioutil.ReadFile(c.Icon)
+		if err != nil {
+			return nil, err
+		}
+		icons, err := iconResources(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", c.Icon, err)
+		}
+		resources = append(resources, icons...)
+	}
+
+	return resources, nil
+}
+
+// versionResource builds the VS_VERSIONINFO resource.
+func (c *VersionInfoConfig) versionResource(name string) []byte {
+	v := parseFileVersion(c.Version)
+	fixed := vsFixedFileInfo{
+		Signature:        0xfeef04bd,
+		StrucVersion:     0x00010000,
+		FileVersionMS:    uint32(v[0])<<16 | uint32(v[1]),
+		FileVersionLS:    uint32(v[2])<<16 | uint32(v[3]),
+		ProductVersionMS: uint32(v[0])<<16 | uint32(v[1]),
+		ProductVersionLS: uint32(v[2])<<16 | uint32(v[3]),
+		FileFlagsMask:    0x3f,
+		FileOS:           0x40004, // VOS_NT_WINDOWS32
+		FileType:         1,       // VFT_APP
+	}
+	var fixedBuf bytes.Buffer
+	binary.Write(&fixedBuf, binary.LittleEndian, &fixed)
+
+	product := c.ProductName
+	if product == "" {
+		product = strings.TrimSuffix(name, ".exe")
+	}
+	strs := map[string]string{
+		"CompanyName":      c.CompanyName,
+		"FileDescription":  c.FileDescription,
+		"FileVersion":      c.Version,
+		"InternalName":     strings.TrimSuffix(name, ".exe"),
+		"LegalCopyright":   c.Copyright,
+		"LegalTrademarks":  c.Trademarks,
+		"OriginalFilename": name,
+		"ProductName":      product,
+		"ProductVersion":   c.Version,
+		"Comments":         c.Comments,
+	}
+	keys := make([]string, 0, len(strs))
+	for k, v := range strs {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		value := utf16Bytes(strs[k])
+		values[i] = versionBlock(k, 1, value, uint16(len(value)/2), nil)
+	}
+
+	// U.S. English with the Unicode code page
+	table := versionBlock("040904B0", 1, nil, 0, values)
+	stringInfo := versionBlock("StringFileInfo", 1, nil, 0, [][]byte{table})
+	translation := []byte{0x09, 0x04, 0xb0, 0x04}
+	varInfo := versionBlock("VarFileInfo", 1, nil, 0, [][]byte{
+		versionBlock("Translation", 0, translation, uint16(len(translation)), nil),
+	})
+
+	return versionBlock("VS_VERSION_INFO", 0, fixedBuf.Bytes(), uint16(fixedBuf.Len()),
+		[][]byte{stringInfo, varInfo})
+}
+
+// versionBlock encodes one of the nested structures of a version
+// resource: its length, value length and type, its key, its value and
+// then its children, each aligned to 32 bits. valueLen is in bytes for
+// binary values and in characters for text.
+func versionBlock(key string, typ uint16, value []byte, valueLen uint16, children [][]byte) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 6)
+	buf.Write(header)
+	buf.Write(utf16Bytes(key))
+	pad32(&buf)
+	buf.Write(value)
+	for _, child := range children {
+		pad32(&buf)
+		buf.Write(child)
+	}
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[0:], uint16(len(data)))
+	binary.LittleEndian.PutUint16(data[2:], valueLen)
+	binary.LittleEndian.PutUint16(data[4:], typ)
+	return data
+}
+
+// utf16Bytes encodes s as null-terminated UTF-16LE.
+func utf16Bytes(s string) []byte {
+	codes := utf16.Encode([]rune(s + "\x00"))
+	data := make([]byte, 2*len(codes))
+	for i, c := range codes {
+		binary.LittleEndian.PutUint16(data[2*i:], c)
+	}
+
+	return data
+}
+
+func pad32(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// iconResources splits a .ico file into an icon resource per image and
+// the icon group resource that refers to them.
+func iconResources(ico []byte) ([]winResource, error) {
+	le := binary.LittleEndian
+	if len(ico) < 6 || le.Uint16(ico[0:]) != 0 || le.Uint16(ico[2:]) != 1 {
+		return nil, fmt.Errorf("not an icon file")
+	}
+	count := int(le.Uint16(ico[4:]))
+	if count == 0 || len(ico) < 6+16*count {
+		return nil, fmt.Errorf("icon file is truncated")
+	}
+
+	// The group is the same header, with entries that refer to icons by
+	// ID rather than file offset.
+	group := make([]byte, 6+14*count)
+	copy(group, ico[:6])
+	resources := make([]winResource, 0, count+1)
+	for i := 0; i < count; i++ {
+		entry := ico[6+16*i : 6+16*(i+1)]
+		size := le.Uint32(entry[8:])
+		offset := le.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(ico)) {
+			return nil, fmt.Errorf("icon file is truncated")
+		}
+
+		id := uint16(i + 1)
+		g := group[6+14*i:]
+		copy(g, entry[:12])
+		le.PutUint16(g[12:], id)
+		resources = append(resources, winResource{
+			Type: rtIcon,
+			ID:   id,
+			Data: ico[offset : offset+size],
+		})
+	}
+
+	return append(resources, winResource{Type: rtGroupIcon, ID: 1, Data: group}), nil
+}
+
+// sysoName is the name of the resource object we write for an arch. The
+// name restricts it to windows builds of that arch.
+func sysoName(arch string) string {
+	return "zz_gox_windows_" + arch + ".syso"
+}
+
+// WriteVersionInfo writes resource objects for every given arch into the
+// directory of each package, returning the paths written so they can be
+// removed after the build.
+func WriteVersionInfo(c *VersionInfoConfig, GoCmd string, packages []string, archs []string) ([]string, error) {
+	if err := c.resolveVersion(); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, pkg := range packages {
+		output, err := execGo(GoCmd, nil, "", "list", "-f", "{{.Dir}}", pkg)
+		if err != nil {
+			return written, err
+		}
+		dir := strings.TrimSpace(output)
+
+		resources, err := c.Resources(filepath.Base(dir) + ".exe")
+		if err != nil {
+			return written, err
+		}
+		for _, arch := range archs {
+			path := filepath.Join(dir, sysoName(arch))
+			if err := WriteSyso(path, arch, resources); err != nil {
+				return written, err
+			}
+			written = append(written, path)
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFileVersion(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output [4]uint16
+	}{
+		{"1.2.3", [4]uint16{1, 2, 3, 0}},
+		{"v1.2.3-4-gdeadbee-dirty", [4]uint16{1, 2, 3, 4}},
+		{"1.2.3.4", [4]uint16{1, 2, 3, 4}},
+		{"v2", [4]uint16{2, 0, 0, 0}},
+		{"deadbee", [4]uint16{0, 0, 0, 0}},
+	}
+
+	for _, tc := range cases {
+		if v := parseFileVersion(tc.Input); v != tc.Output {
+			t.Fatalf("%s: bad: %#v", tc.Input, v)
+		}
+	}
+}
+
+func TestIconResources(t *testing.T) {
+	// Two images of 4 and 2 bytes
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, []uint16{0, 1, 2})
+	binary.Write(&ico, binary.LittleEndian, []byte{16, 16, 0, 0})
+	binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&ico, binary.LittleEndian, []uint32{4, 38})
+	binary.Write(&ico, binary.LittleEndian, []byte{32, 32, 0, 0})
+	binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&ico, binary.LittleEndian, []uint32{2, 42})
+	ico.Write([]byte{1, 2, 3, 4, 5, 6})
+
+	resources, err := iconResources(ico.Bytes())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(resources) != 3 {
+		t.Fatalf("bad: %#v", resources)
+	}
+	if !bytes.Equal(resources[0].Data, []byte{1, 2, 3, 4}) || resources[0].ID != 1 {
+		t.Fatalf("bad: %#v", resources[0])
+	}
+	if !bytes.Equal(resources[1].Data, []byte{5, 6}) || resources[1].ID != 2 {
+		t.Fatalf("bad: %#v", resources[1])
+	}
+
+	group := resources[2]
+	if group.Type != rtGroupIcon || len(group.Data) != 6+14*2 {
+		t.Fatalf("bad: %#v", group)
+	}
+	if id := binary.LittleEndian.Uint16(group.Data[6+14+12:]); id != 2 {
+		t.Fatalf("bad: %d", id)
+	}
+
+	if _, err := iconResources([]byte("not an icon")); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestWriteSyso_link(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	c := &VersionInfoConfig{Version: "1.2.3", ProductName: "My App"}
+	resources, err := c.Resources("app.exe")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := WriteSyso(filepath.Join(td, sysoName("amd64")), "amd64", resources); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	output := filepath.Join(td, "app.exe")
+	cmd := exec.Command("go", "build", "-o", output, ".")
+	cmd.Dir = td
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("err: %s\n%s", err, out)
+	}
+
+	f, err := pe.Open(output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	rsrc := f.Section(".rsrc")
+	if rsrc == nil {
+		t.Fatal("no .rsrc section")
+	}
+	data, err := rsrc.Data()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Contains(data, utf16Bytes("My App")) {
+		t.Fatal("product name not found")
+	}
+
+	// The resource directory must point at the section
+	dir := f.OptionalHeader.(*pe.OptionalHeader64).DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+	if dir.VirtualAddress != rsrc.VirtualAddress {
+		t.Fatalf("bad: %#v", dir)
+	}
+
+	// Follow the first entry of each level down to the version resource,
+	// whose address must have been relocated into the image.
+	le := binary.LittleEndian
+	off := uint32(0)
+	for i := 0; i < 3; i++ {
+		off = le.Uint32(data[off+16+4:]) &^ 0x80000000
+	}
+	rva := le.Uint32(data[off:])
+	start := rva - rsrc.VirtualAddress
+	if !bytes.HasPrefix(data[start+6:], utf16Bytes("VS_VERSION_INFO")) {
+		t.Fatalf("bad: %x", data[start:start+32])
+	}
+}
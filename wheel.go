@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WheelConfig is the "wheel" section of the config file. It wraps each
+// c-shared library in a platform-tagged Python wheel, so that the library
+// can be installed with pip and loaded with ctypes or cffi.
+type WheelConfig struct {
+	// Name and Version are the distribution name and PEP 440 version.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Summary string `json:"summary,omitempty"`
+
+	// Package is the import package the library is installed into,
+	// defaults to the name with dashes replaced by underscores.
+	Package string `json:"package,omitempty"`
+
+	// Dir, if set, is a directory of Python sources, such as the
+	// package's __init__.py that loads the library, copied to the root
+	// of each wheel.
+	Dir string `json:"dir,omitempty"`
+
+	// PlatformTags overrides the wheel platform tag for an os/arch,
+	// such as {"linux/amd64": "manylinux_2_28_x86_64"}.
+	PlatformTags map[string]string `json:"platform_tags,omitempty"`
+
+	// Output is the directory wheels are written to, defaults to the
+	// directory of each library.
+	Output string `json:"output,omitempty"`
+}
+
+// wheelPlatformTags are the default platform tags for each platform. The
+// linux tags assume the glibc of the manylinux2014 baseline.
+var wheelPlatformTags = map[string]string{
+	"darwin/amd64":  "macosx_10_12_x86_64",
+	"darwin/arm64":  "macosx_11_0_arm64",
+	"linux/386":     "manylinux2014_i686",
+	"linux/amd64":   "manylinux2014_x86_64",
+	"linux/arm64":   "manylinux2014_aarch64",
+	"linux/armv7":   "manylinux2014_armv7l",
+	"linux/ppc64le": "manylinux2014_ppc64le",
+	"linux/s390x":   "manylinux2014_s390x",
+	"windows/386":   "win32",
+	"windows/amd64": "win_amd64",
+	"windows/arm64": "win_arm64",
+}
+
+// wheelNameRe matches valid distribution names.
+var wheelNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// wheelSeparatorRe matches the runs of separators that are normalized to
+// an underscore in wheel file names.
+var wheelSeparatorRe = regexp.MustCompile(`[-_.]+`)
+
+// Validate checks the distribution name and that there is a version.
+func (c *WheelConfig) Validate() error {
+	if !wheelNameRe.MatchString(c.Name) {
+		return fmt.Errorf("wheel: invalid name %q", c.Name)
+	}
+	if c.Version == "" {
+		return fmt.Errorf("wheel: version is required")
+	}
+
+	return nil
+}
+
+// distName is the name as used in wheel file names.
+func (c *WheelConfig) distName() string {
+	return wheelSeparatorRe.ReplaceAllString(c.Name, "_")
+}
+
+func (c *WheelConfig) pkg() string {
+	if c.Package != "" {
+		return c.Package
+	}
+	return strings.Replace(c.Name, "-", "_", -1)
+}
+
+// platformTag returns the wheel platform tag for platform.
+func (c *WheelConfig) platformTag(platform Platform) (string, error) {
+	key := platform.String()
+	if tag, ok := c.PlatformTags[key]; ok {
+		return tag, nil
+	}
+	if tag, ok := wheelPlatformTags[key]; ok {
+		return tag, nil
+	}
+
+	return "", fmt.Errorf("no wheel platform tag for %s, set one in platform_tags", key)
+}
+
+// BuildWheel writes a wheel holding the c-shared library built for r, and
+// returns its path.
+func BuildWheel(c *WheelConfig, r BuildResult) (string, error) {
+	tag, err := c.platformTag(r.Platform)
+	if err != nil {
+		return "", err
+	}
+
+	pkg := c.pkg()
+	var files []archiveFile
+	if c.Dir != "" {
+		files, err = dirFiles(c.Dir, "")
+		if err != nil {
+			return "", err
+		}
+	}
+	files = append(files, archiveFile{
+		Name: pkg + "/" + sharedLibName(filepath.Base(r.Path), r.Platform.OS),
+		Src:  r.Output,
+		Mode: 0755,
+	})
+
+	distInfo := c.distName() + "-" + c.Version + ".dist-info/"
+	metadata := fmt.Sprintf("Metadata-Version: 2.1\nName: %s\nVersion: %s\n", c.Name, c.Version)
+	if c.Summary != "" {
+		metadata += "Summary: " + c.Summary + "\n"
+	}
+	wheel := fmt.Sprintf("Wheel-Version: 1.0\nGenerator: gox\nRoot-Is-Purelib: false\nTag: py3-none-%s\n", tag)
+	files = append(files,
+		archiveFile{Name: distInfo + "METADATA", Data: []byte(metadata), Mode: 0644},
+		archiveFile{Name: distInfo + "WHEEL", Data: []byte(wheel), Mode: 0644})
+
+	record, err := wheelRecord(files, distInfo+"RECORD")
+	if err != nil {
+		return "", err
+	}
+	files = append(files, archiveFile{Name: distInfo + "RECORD", Data: record, Mode: 0644})
+
+	outDir := c.Output
+	if outDir == "" {
+		outDir = filepath.Dir(r.Output)
+	}
+	path := filepath.Join(outDir, fmt.Sprintf("%s-%s-py3-none-%s.whl", c.distName(), c.Version, tag))
+	if err := writeArchive(path, "", files); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// wheelRecord returns the RECORD file listing the digest and size of every
+// file in the wheel, and the RECORD itself without either.
+func wheelRecord(files []archiveFile, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, f := range files {
+		data := f.Data
+		if f.Src != "" {
+			var err error
+			data, err = ioutil.ReadFile(f.Src)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&buf, "%s,sha256=%s,%d\n",
+			f.Name, base64.RawURLEncoding.EncodeToString(sum[:]), len(data))
+	}
+	fmt.Fprintf(&buf, "%s,,\n", name)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWheelConfigValidate(t *testing.T) {
+	cases := []struct {
+		Config WheelConfig
+		Err    bool
+	}{
+		{WheelConfig{Name: "my-lib", Version: "1.0"}, false},
+		{WheelConfig{Name: "my-lib"}, true},
+		{WheelConfig{Name: "-bad", Version: "1.0"}, true},
+	}
+
+	for _, tc := range cases {
+		if err := tc.Config.Validate(); (err != nil) != tc.Err {
+			t.Fatalf("%#v: bad: %s", tc.Config, err)
+		}
+	}
+}
+
+func TestBuildWheel(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "core_linux_amd64.so")
+	if err := ioutil.WriteFile(output, []byte("lib"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pyDir := filepath.Join(td, "python", "my_lib")
+	os.MkdirAll(pyDir, 0755)
+	if err := ioutil.WriteFile(filepath.Join(pyDir, "__init__.py"), []byte("import ctypes\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := &WheelConfig{Name: "my-lib", Version: "1.0", Dir: filepath.Join(td, "python")}
+	path, err := BuildWheel(c, BuildResult{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		Path:     "example.com/core",
+		Output:   output,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filepath.Base(path) != "my_lib-1.0-py3-none-manylinux2014_x86_64.whl" {
+		t.Fatalf("bad: %s", path)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	var names []string
+	var record string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if strings.HasSuffix(f.Name, "RECORD") {
+			rc, _ := f.Open()
+			data, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			record = string(data)
+		}
+	}
+	expected := []string{
+		"my_lib-1.0.dist-info/METADATA",
+		"my_lib-1.0.dist-info/RECORD",
+		"my_lib-1.0.dist-info/WHEEL",
+		"my_lib/__init__.py",
+		"my_lib/libcore.so",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad: %#v", names)
+	}
+	if !strings.Contains(record, "my_lib/libcore.so,sha256=") || !strings.HasSuffix(record, "RECORD,,\n") {
+		t.Fatalf("bad: %s", record)
+	}
+}
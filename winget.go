@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// wingetManifestVersion is the version of the manifest schema that is
+// written.
+const wingetManifestVersion = "1.6.0"
+
+// WingetConfig is the "winget" section of the config file. It writes the
+// winget manifests of a package whose installers are the windows zip
+// archives of a binary, and can push them to a fork of winget-pkgs.
+type WingetConfig struct {
+	// Identifier is the PackageIdentifier, such as "Example.App".
+	// Publisher and Name are the publisher and the name of the package,
+	// which defaults to the directory of the main package. Package picks
+	// the main package when several are built.
+	Identifier string `json:"identifier"`
+	Publisher  string `json:"publisher"`
+	Name       string `json:"name,omitempty"`
+	Package    string `json:"package,omitempty"`
+
+	// Description is the ShortDescription, and License is required by
+	// winget too.
+	Description string `json:"description"`
+	Homepage    string `json:"homepage,omitempty"`
+	License     string `json:"license"`
+
+	// URL is the template for where each archive is downloaded from, as
+	// in HomebrewConfig.
+	URL string `json:"url"`
+
+	// Output is the directory the manifests are written to, defaults to
+	// that of the archives.
+	Output string `json:"output,omitempty"`
+
+	// Repository, if set, is where -publish pushes the manifests to, in
+	// the directory manifests/<letter>/<identifier>/<version> that
+	// winget-pkgs uses by default.
+	Repository *RepoConfig `json:"repository,omitempty"`
+}
+
+// wingetArches maps GOARCH to the architectures of winget installers.
+var wingetArches = map[string]string{
+	"amd64": "x64",
+	"386":   "x86",
+	"arm64": "arm64",
+	"arm":   "arm",
+}
+
+// Validate checks the identifier, the fields the manifests must have, the
+// url template and the repository, if any.
+func (c *WingetConfig) Validate() error {
+	if len(strings.Split(c.Identifier, ".")) < 2 {
+		return fmt.Errorf("winget: identifier should be Publisher.Package")
+	}
+	for _, v := range []struct{ Key, Value string }{
+		{"publisher", c.Publisher},
+		{"description", c.Description},
+		{"license", c.License},
+		{"url", c.URL},
+	} {
+		if v.Value == "" {
+			return fmt.Errorf("winget: %s is required", v.Key)
+		}
+	}
+	if err := validateURLTemplate("winget", c.URL); err != nil {
+		return err
+	}
+	if c.Repository != nil {
+		if err := c.Repository.Validate("winget: repository"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// directory is where the manifests of version go in winget-pkgs.
+func (c *WingetConfig) directory(version string) string {
+	parts := append([]string{"manifests", strings.ToLower(c.Identifier[:1])},
+		strings.Split(c.Identifier, ".")...)
+	return path.Join(append(parts, version)...)
+}
+
+// WriteWingetManifests writes the version, installer and default locale
+// manifests for the windows archives of results and returns their paths.
+func WriteWingetManifests(c *WingetConfig, archives *ArchiveConfig, results []BuildResult, version string) ([]string, error) {
+	builds, err := releaseBuilds(c.Package, results, "windows")
+	if err != nil {
+		return nil, err
+	}
+
+	binary, err := archives.binaryName(builds[0], version)
+	if err != nil {
+		return nil, err
+	}
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(builds[0].Path)
+	}
+
+	var installers bytes.Buffer
+	for _, r := range pickBuilds("windows", []string{"amd64", "386", "arm64", "arm"}, builds) {
+		path, err := archives.Path(r, version)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		url, err := releaseURL(c.URL, path, r, version)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&installers, "- Architecture: %s\n", wingetArches[r.Platform.Arch])
+		fmt.Fprintf(&installers, "  InstallerUrl: %s\n", strconv.Quote(url))
+		fmt.Fprintf(&installers, "  InstallerSha256: %s\n", strings.ToUpper(sum))
+	}
+
+	head := fmt.Sprintf("# Generated by gox, do not edit.\nPackageIdentifier: %s\nPackageVersion: %s\n",
+		c.Identifier, strconv.Quote(version))
+	tail := "ManifestVersion: " + wingetManifestVersion + "\n"
+	manifests := map[string]string{
+		"": head + "DefaultLocale: en-US\nManifestType: version\n" + tail,
+
+		".installer": head +
+			"InstallerType: zip\nNestedInstallerType: portable\nNestedInstallerFiles:\n" +
+			fmt.Sprintf("- RelativeFilePath: %s\n  PortableCommandAlias: %s\n",
+				strconv.Quote(binary+".exe"), strconv.Quote(binary)) +
+			"Installers:\n" + installers.String() +
+			"ManifestType: installer\n" + tail,
+
+		".locale.en-US": head + "PackageLocale: en-US\n" +
+			wingetFields("Publisher", c.Publisher, "PackageName", name, "PackageUrl", c.Homepage,
+				"License", c.License, "ShortDescription", c.Description) +
+			"ManifestType: defaultLocale\n" + tail,
+	}
+
+	dir := c.Output
+	if dir == "" {
+		dir = archives.output()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, suffix := range []string{"", ".installer", ".locale.en-US"} {
+		path := filepath.Join(dir, c.Identifier+suffix+".yaml")
+		if err := ioutil.WriteFile(path, []byte(manifests[suffix]), 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// wingetFields writes the pairs of keys and values that have a value as
+// YAML.
+func wingetFields(pairs ...string) string {
+	var buf bytes.Buffer
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			fmt.Fprintf(&buf, "%s: %s\n", pairs[i], strconv.Quote(pairs[i+1]))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWingetConfigDirectory(t *testing.T) {
+	c := &WingetConfig{Identifier: "Example.App"}
+	if actual := c.directory("1.2.3"); actual != "manifests/e/Example/App/1.2.3" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestWriteWingetManifests(t *testing.T) {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	archives := &ArchiveConfig{Output: td, Format: "zip"}
+	var results []BuildResult
+	for _, arch := range []string{"amd64", "arm64"} {
+		r := BuildResult{Platform: Platform{OS: "windows", Arch: arch}, Path: "example.com/app"}
+		path, _ := archives.Path(r, "1.2.3")
+		if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		results = append(results, r)
+	}
+
+	c := &WingetConfig{
+		Identifier:  "Example.App",
+		Publisher:   "Example",
+		Description: "Does things",
+		License:     "MIT",
+		URL:         "https://example.com/{{.Name}}",
+	}
+	paths, err := WriteWingetManifests(c, archives, results, "1.2.3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(paths) != 3 || paths[1] != filepath.Join(td, "Example.App.installer.yaml") {
+		t.Fatalf("bad: %#v", paths)
+	}
+
+	data, err := ioutil.ReadFile(paths[1])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum, _ := fileSHA256(filepath.Join(td, "app_1.2.3_windows_amd64.zip"))
+	for _, expected := range []string{
+		"PackageIdentifier: Example.App\nPackageVersion: \"1.2.3\"\n",
+		"- RelativeFilePath: \"app.exe\"\n  PortableCommandAlias: \"app\"\n",
+		"- Architecture: x64\n  InstallerUrl: \"https://example.com/app_1.2.3_windows_amd64.zip\"\n" +
+			"  InstallerSha256: " + strings.ToUpper(sum) + "\n- Architecture: arm64\n",
+		"ManifestType: installer\nManifestVersion: 1.6.0\n",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, data)
+		}
+	}
+
+	data, err = ioutil.ReadFile(paths[2])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(data), "PackageName: \"app\"\nLicense: \"MIT\"\n") ||
+		strings.Contains(string(data), "PackageUrl") {
+		t.Fatalf("bad:\n%s", data)
+	}
+}
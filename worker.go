@@ -0,0 +1,419 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// workerDigestRe matches the SHA-256 that a source tarball is stored by.
+var workerDigestRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// workerEnv are the variables of a build that a worker takes from the
+// client. The C compilers come from the GOX_[OS]_[ARCH]_CC of the worker's
+// own environment instead, and GOFLAGS would let -toolexec in.
+var workerEnv = map[string]bool{
+	"CGO_ENABLED": true, "GOARM": true, "GOARM64": true, "GOAMD64": true, "GO386": true,
+	"GOPPC64": true, "GORISCV64": true, "GOMIPS": true, "GOMIPS64": true,
+	"GOEXPERIMENT": true, "GOFIPS140": true, "GOWORK": true, "GOENV": true,
+}
+
+// workerFlag is a flag of the compiler or linker that builds on a worker
+// can have. A value comes after "=", or is the next field if it is
+// Separate, and is one of Values if there are any.
+type workerFlag struct {
+	Separate bool
+	Values   []string
+}
+
+// The compiler, assembler and linker flags that builds on a worker can
+// have. Those that write files, such as -cpuprofile, or run commands, such
+// as -extld, are left out.
+var (
+	workerGcflags = map[string]workerFlag{
+		"-N": {}, "-l": {}, "-m": {}, "-B": {}, "-C": {}, "-S": {}, "-c": {}, "-d": {},
+		"-dwarf": {}, "-dwarflocationlists": {}, "-smallframes": {}, "-spectre": {}, "-trimpath": {},
+	}
+	workerAsmflags = map[string]workerFlag{
+		"-D": {Separate: true}, "-S": {}, "-shared": {}, "-dynlink": {}, "-spectre": {}, "-trimpath": {},
+	}
+	workerLdflags = map[string]workerFlag{
+		"-s": {}, "-w": {}, "-X": {Separate: true}, "-buildid": {},
+		"-linkmode":   {Separate: true, Values: []string{"internal", "external", "auto"}},
+		"-extldflags": {Separate: true, Values: []string{"-static", `"-static"`, "'-static'"}},
+	}
+)
+
+// workerFlagPatternRe matches the package pattern in front of -gcflags
+// and -asmflags, such as the all= of "all=-N -l".
+var workerFlagPatternRe = regexp.MustCompile(`^[^-\s][^=\s]*=`)
+
+// checkWorkerFlags checks that the value of the flag name only has the
+// allowed flags.
+func checkWorkerFlags(name, value string, allowed map[string]workerFlag) error {
+	fields := strings.Fields(workerFlagPatternRe.ReplaceAllString(value, ""))
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "=", 2)
+		f, ok := allowed[parts[0]]
+		if !ok {
+			return fmt.Errorf("%s %s isn't allowed on a worker", name, parts[0])
+		}
+		if len(parts) == 1 && f.Separate {
+			if i++; i == len(fields) {
+				return fmt.Errorf("%s %s needs a value", name, parts[0])
+			}
+			parts = append(parts, fields[i])
+		}
+		known := len(f.Values) == 0
+		for _, v := range f.Values {
+			known = known || len(parts) == 2 && parts[1] == v
+		}
+		if !known {
+			return fmt.Errorf("%s %s can only be %s", name, parts[0], strings.Join(f.Values, " or "))
+		}
+	}
+	return nil
+}
+
+// validate checks the build before the worker runs it in src.
+func (b *remoteBuild) validate(src string) error {
+	if strings.HasPrefix(b.Package, "-") {
+		return fmt.Errorf("package %q can't start with -", b.Package)
+	}
+	if parts := strings.Split(b.Platform, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("platform %q should be os/arch", b.Platform)
+	}
+	switch b.Mod {
+	case "", "mod", "readonly", "vendor":
+	default:
+		return fmt.Errorf("unknown -mod %q", b.Mod)
+	}
+	if err := ValidateBuildMode(b.BuildMode); err != nil {
+		return err
+	}
+	switch b.PGO {
+	case "", "auto", "off":
+	default:
+		if _, ok := bundlePath(src, b.local(b.PGO, src)); !ok || !strings.HasPrefix(b.PGO, remoteSourceVar) {
+			return fmt.Errorf("-pgo %s isn't in the source", b.PGO)
+		}
+	}
+	for _, f := range []struct {
+		Name, Value string
+		Allowed     map[string]workerFlag
+	}{
+		{"-gcflags", b.Gcflags, workerGcflags},
+		{"-asmflags", b.Asmflags, workerAsmflags},
+		{"-ldflags", b.Ldflags, workerLdflags},
+	} {
+		if err := checkWorkerFlags(f.Name, f.Value, f.Allowed); err != nil {
+			return err
+		}
+	}
+	for _, kv := range b.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		switch {
+		case !workerEnv[parts[0]] || len(parts) != 2:
+			return fmt.Errorf("%s can't be set on a worker", parts[0])
+		case parts[0] == "GOENV" && parts[1] != "off":
+			return fmt.Errorf("GOENV can only be off")
+		case parts[0] == "GOWORK" && parts[1] != "off":
+			if _, ok := bundlePath(src, b.local(parts[1], src)); !ok || !strings.HasPrefix(parts[1], remoteSourceVar) {
+				return fmt.Errorf("GOWORK %s isn't in the source", parts[1])
+			}
+		}
+	}
+	return nil
+}
+
+// local replaces remoteSourceVar in v with src.
+func (b *remoteBuild) local(v, src string) string {
+	return strings.Replace(v, remoteSourceVar, src, -1)
+}
+
+// args returns the go command of the build, writing to output, for src.
+func (b *remoteBuild) args(src, output string) []string {
+	args := []string{"build"}
+	if b.Test {
+		args = []string{"test", "-c"}
+	}
+	if b.Rebuild {
+		args = append(args, "-a")
+	}
+	if b.Mod != "" {
+		args = append(args, "-mod", b.Mod)
+	}
+	if b.Race {
+		args = append(args, "-race")
+	}
+	if b.Trimpath {
+		args = append(args, "-trimpath")
+	}
+	if b.BuildMode != "" {
+		args = append(args, "-buildmode", b.BuildMode)
+	}
+	if b.PGO != "" {
+		args = append(args, "-pgo", b.local(b.PGO, src))
+	}
+	return append(args,
+		"-gcflags", b.Gcflags,
+		"-ldflags", b.Ldflags,
+		"-asmflags", b.Asmflags,
+		"-tags", b.Tags,
+		"-o", output, b.Package)
+}
+
+// env returns the environment of the build in src: the worker's own, with
+// the platform, the variables of the build and the C compilers that the
+// worker has for the platform.
+func (b *remoteBuild) env(src string) []string {
+	parts := strings.Split(b.Platform, "/")
+	platform := Platform{OS: parts[0], Arch: parts[1]}
+	env := append(os.Environ(), "GOOS="+platform.OS, "GOARCH="+platform.Arch)
+	for _, kv := range b.Env {
+		env = append(env, b.local(kv, src))
+	}
+	for _, key := range []string{"CC", "CXX"} {
+		var v string
+		envOverride(&v, platform, key)
+		if v != "" {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
+
+// workerServer is the HTTP API of `gox worker`, which builds what a
+// -builder=remote gox sends it:
+//
+//	GET  /v1/info              the Go version and platform of the worker
+//	HEAD /v1/sources/SHA256    whether the worker has the source tarball
+//	PUT  /v1/sources/SHA256    uploads the source tarball
+//	POST /v1/builds            runs a remoteBuild and returns the binary,
+//	                           or 422 with the output of the failed build
+type workerServer struct {
+	// Dir is where the sources and builds are kept.
+	Dir string
+
+	// GoCmd is the go command that builds run.
+	GoCmd string
+
+	// Token, if set, is the bearer token that requests must have.
+	Token string
+
+	// Log, if set, gets a line for every build.
+	Log io.Writer
+
+	// builds limits how many builds run at once.
+	builds chan struct{}
+
+	// lock is held while sources are unpacked or cloned.
+	lock sync.Mutex
+}
+
+func newWorkerServer(dir, goCmd, token string, parallel int) *workerServer {
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &workerServer{
+		Dir:    dir,
+		GoCmd:  goCmd,
+		Token:  token,
+		builds: make(chan struct{}, parallel),
+	}
+}
+
+func (s *workerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/info" && r.Method == "GET":
+		version, _ := execGo(s.GoCmd, nil, "", "env", "GOVERSION", "GOHOSTOS", "GOHOSTARCH")
+		fields := strings.Fields(version)
+		info := map[string]string{}
+		if len(fields) == 3 {
+			info["go"], info["host"] = fields[0], fields[1]+"/"+fields[2]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+
+	case strings.HasPrefix(r.URL.Path, "/v1/sources/"):
+		digest := strings.TrimPrefix(r.URL.Path, "/v1/sources/")
+		if !workerDigestRe.MatchString(digest) {
+			http.Error(w, "bad digest", http.StatusBadRequest)
+			return
+		}
+		dir := filepath.Join(s.Dir, "sources", digest)
+		switch r.Method {
+		case "HEAD":
+			if _, err := os.Stat(dir); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "PUT":
+			if err := s.putSource(digest, dir, r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case r.URL.Path == "/v1/builds" && r.Method == "POST":
+		var build remoteBuild
+		if err := json.NewDecoder(r.Body).Decode(&build); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.build(w, &build)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// putSource unpacks the tarball in body into dir, if its SHA-256 is
+// digest.
+func (s *workerServer) putSource(digest, dir string, body io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.Dir, "source")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != digest {
+		return fmt.Errorf("the tarball's SHA-256 is %s, not %s", sum, digest)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	tmp := dir + ".tmp"
+	os.RemoveAll(tmp)
+	if err := extractBundle(f.Name(), tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// checkout returns the directory of the repository at ref, cloning it the
+// first time.
+func (s *workerServer) checkout(repository, ref string) (string, error) {
+	sum := sha256.Sum256([]byte(repository + "\x00" + ref))
+	dir := filepath.Join(s.Dir, "git", hex.EncodeToString(sum[:16]))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	tmp := dir + ".tmp"
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	if _, err := execGo("git", nil, "", "clone", "--quiet", "--no-checkout", "--", repository, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if _, err := execGo("git", nil, tmp, "checkout", "--quiet", "--detach", ref); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return dir, os.Rename(tmp, dir)
+}
+
+// build runs the build and writes the binary, or the output of the failed
+// build with 422, to w.
+func (s *workerServer) build(w http.ResponseWriter, build *remoteBuild) {
+	var root string
+	var err error
+	switch {
+	case build.Source != "":
+		if !workerDigestRe.MatchString(build.Source) {
+			http.Error(w, "bad source", http.StatusBadRequest)
+			return
+		}
+		root = filepath.Join(s.Dir, "sources", build.Source)
+		if _, err := os.Stat(root); err != nil {
+			http.Error(w, "unknown source "+build.Source, http.StatusNotFound)
+			return
+		}
+	case build.Repository != "" && build.Ref != "":
+		if root, err = s.checkout(build.Repository, build.Ref); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	default:
+		http.Error(w, "a source or repository and ref is required", http.StatusBadRequest)
+		return
+	}
+	src, ok := bundlePath(root, build.Dir)
+	if !ok || filepath.IsAbs(build.Dir) {
+		http.Error(w, "bad dir "+build.Dir, http.StatusBadRequest)
+		return
+	}
+	if err := build.validate(src); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.builds <- struct{}{}
+	defer func() { <-s.builds }()
+
+	out, err := ioutil.TempDir(s.Dir, "build")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(out)
+	output := filepath.Join(out, "out")
+
+	_, err = execGo(s.GoCmd, build.env(src), src, build.args(src, output)...)
+	if s.Log != nil {
+		result := "built"
+		if err != nil {
+			result = "failed"
+		}
+		fmt.Fprintf(s.Log, "--> %s %s: %s\n", build.Platform, build.Package, result)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, f)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace is the go.work workspace that gox is run in.
+type Workspace struct {
+	// File is the absolute path of the go.work file. Every build runs with
+	// GOWORK set to it, so that builds that run elsewhere, such as in a
+	// container, still resolve the workspace's modules.
+	File string
+
+	// Modules are the modules of the workspace. Only those in Filtered are
+	// built, if Filter was called.
+	Modules  []WorkspaceModule
+	Filtered []WorkspaceModule
+}
+
+// WorkspaceModule is a module that is used by a workspace.
+type WorkspaceModule struct {
+	Path string
+	Dir  string
+}
+
+// FindWorkspace returns the workspace of the current directory, or nil if
+// there is none or it is disabled with GOWORK=off.
+func FindWorkspace(GoCmd string) (*Workspace, error) {
+	file, err := goEnv(GoCmd, "GOWORK")
+	if err != nil {
+		return nil, err
+	}
+	if file == "" || file == "off" {
+		return nil, nil
+	}
+
+	output, err := execGo(GoCmd, nil, "", "list", "-m", "-f", "{{.Path}}|{{.Dir}}")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Workspace{File: file}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+
+		w.Modules = append(w.Modules, WorkspaceModule{Path: parts[0], Dir: parts[1]})
+	}
+
+	return w, nil
+}
+
+// Dir is the directory of the go.work file.
+func (w *Workspace) Dir() string {
+	return filepath.Dir(w.File)
+}
+
+// Filter limits the modules that are built to those matching filters. A
+// filter is a module path, or a module's directory relative to the
+// workspace, such as "./cmd/server".
+func (w *Workspace) Filter(filters []string) error {
+	if len(filters) == 0 {
+		return nil
+	}
+
+	for _, f := range filters {
+		found := false
+		for _, m := range w.Modules {
+			if w.matches(m, f) {
+				w.Filtered = append(w.Filtered, m)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("-workspace-module %s is not a module of %s", f, w.File)
+		}
+	}
+
+	return nil
+}
+
+func (w *Workspace) matches(m WorkspaceModule, filter string) bool {
+	if m.Path == filter {
+		return true
+	}
+
+	dir := filter
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(w.Dir(), dir)
+	}
+	return filepath.Clean(dir) == filepath.Clean(m.Dir)
+}
+
+// Patterns returns the package patterns to build. With none given, the
+// current directory is built if it is in one of the modules, and every
+// module otherwise. A pattern such as "./..." also covers the modules of
+// the workspace below its directory, since the Go command only matches
+// the packages of the module that a directory is in.
+func (w *Workspace) Patterns(packages []string) ([]string, error) {
+	if w == nil {
+		if len(packages) == 0 {
+			packages = []string{"."}
+		}
+		return packages, nil
+	}
+
+	if len(packages) == 0 && len(w.Filtered) > 0 {
+		var result []string
+		for _, m := range w.Filtered {
+			result = append(result, filepath.Join(m.Dir, "..."))
+		}
+		return result, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		if w.module(wd) != nil {
+			return []string{"."}, nil
+		}
+		packages = []string{"./..."}
+	}
+
+	var result []string
+	for _, p := range packages {
+		if !strings.HasSuffix(p, "/...") || !(strings.HasPrefix(p, ".") || filepath.IsAbs(p)) {
+			result = append(result, p)
+			continue
+		}
+
+		dir := strings.TrimSuffix(p, "/...")
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(wd, dir)
+		}
+		n := len(result)
+		outer := w.module(dir)
+		if outer != nil {
+			result = append(result, p)
+		}
+		for _, m := range w.Modules {
+			if withinDir(dir, m.Dir) && (outer == nil || m.Dir != outer.Dir) {
+				result = append(result, filepath.Join(m.Dir, "..."))
+			}
+		}
+		if len(result) == n {
+			// Left for the Go command to report
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
+
+// Packages drops the import paths that aren't in the modules kept by
+// Filter.
+func (w *Workspace) Packages(paths []string) []string {
+	if w == nil || len(w.Filtered) == 0 {
+		return paths
+	}
+
+	var result []string
+	for _, path := range paths {
+		for _, m := range w.Filtered {
+			if path == m.Path || strings.HasPrefix(path, m.Path+"/") {
+				result = append(result, path)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// module returns the innermost module of the workspace that dir is in, or
+// nil if it is in none.
+func (w *Workspace) module(dir string) *WorkspaceModule {
+	var result *WorkspaceModule
+	for i, m := range w.Modules {
+		if withinDir(m.Dir, dir) && (result == nil || len(m.Dir) > len(result.Dir)) {
+			result = &w.Modules[i]
+		}
+	}
+
+	return result
+}
+
+// withinDir reports whether path is dir or inside of it.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
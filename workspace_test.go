@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testWorkspace() *Workspace {
+	return &Workspace{
+		File: "/ws/go.work",
+		Modules: []WorkspaceModule{
+			{Path: "example.com/app", Dir: "/ws"},
+			{Path: "example.com/server", Dir: "/ws/server"},
+			{Path: "example.com/cli", Dir: "/ws/tools/cli"},
+		},
+	}
+}
+
+func TestWorkspaceFilter(t *testing.T) {
+	cases := []struct {
+		Filters []string
+		Output  []string
+		Err     bool
+	}{
+		{nil, nil, false},
+		{[]string{"example.com/cli"}, []string{"example.com/cli"}, false},
+		{[]string{"./server", "tools/cli"}, []string{"example.com/server", "example.com/cli"}, false},
+		{[]string{"/ws"}, []string{"example.com/app"}, false},
+		{[]string{"./tools"}, nil, true},
+	}
+
+	for _, tc := range cases {
+		w := testWorkspace()
+		err := w.Filter(tc.Filters)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Filters, err)
+		}
+
+		var paths []string
+		for _, m := range w.Filtered {
+			paths = append(paths, m.Path)
+		}
+		if !reflect.DeepEqual(paths, tc.Output) && !tc.Err {
+			t.Fatalf("%#v: bad: %#v", tc.Filters, paths)
+		}
+	}
+}
+
+func TestWorkspacePatterns(t *testing.T) {
+	w := &Workspace{
+		File: "/ws/go.work",
+		Modules: []WorkspaceModule{
+			{Path: "example.com/server", Dir: "/ws/server"},
+			{Path: "example.com/cli", Dir: "/ws/tools/cli"},
+			{Path: "example.com/nested", Dir: "/ws/server/nested"},
+		},
+	}
+
+	cases := []struct {
+		Input  []string
+		Output []string
+	}{
+		{[]string{"/ws/..."}, []string{"/ws/server/...", "/ws/tools/cli/...", "/ws/server/nested/..."}},
+		{[]string{"/ws/server/..."}, []string{"/ws/server/...", "/ws/server/nested/..."}},
+		{[]string{"/ws/tools/cli/cmd/..."}, []string{"/ws/tools/cli/cmd/..."}},
+		{[]string{"example.com/cli/..."}, []string{"example.com/cli/..."}},
+		{[]string{"/other/..."}, []string{"/other/..."}},
+	}
+
+	for _, tc := range cases {
+		actual, err := w.Patterns(tc.Input)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		for i := range tc.Output {
+			tc.Output[i] = filepath.FromSlash(tc.Output[i])
+		}
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("%#v: bad: %#v", tc.Input, actual)
+		}
+	}
+
+	if err := w.Filter([]string{"./tools/cli"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual, err := w.Patterns(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, []string{filepath.FromSlash("/ws/tools/cli/...")}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Without a workspace, the current directory is the default
+	actual, err = (*Workspace)(nil).Patterns(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, []string{"."}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestWorkspacePackages(t *testing.T) {
+	w := testWorkspace()
+	paths := []string{"example.com/app", "example.com/server/cmd/a", "example.com/serverless", "example.com/cli"}
+	if actual := w.Packages(paths); !reflect.DeepEqual(actual, paths) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if err := w.Filter([]string{"example.com/server"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{"example.com/server/cmd/a"}
+	if actual := w.Packages(paths); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that goreleaser configs are written
+// in: block mappings and sequences, flow sequences and mappings on one
+// line, plain and quoted scalars, literal and folded block scalars, and
+// comments. Mappings are map[string]interface{}, sequences []interface{}
+// and scalars strings; empty values are nil. Only the first document is
+// read, and anchors, aliases and tags are errors.
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+	if p.next() && strings.TrimSpace(p.lines[p.i]) == "---" {
+		p.i++
+	}
+	if !p.next() {
+		return nil, nil
+	}
+
+	v, err := p.node(p.indent())
+	if err != nil {
+		return nil, err
+	}
+	if p.next() && strings.TrimSpace(p.lines[p.i]) != "---" && strings.TrimSpace(p.lines[p.i]) != "..." {
+		return nil, p.errorf("unexpected %q", strings.TrimSpace(p.lines[p.i]))
+	}
+	return v, nil
+}
+
+// yamlParser parses lines from i.
+type yamlParser struct {
+	lines []string
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.i+1, fmt.Sprintf(format, args...))
+}
+
+// next skips blank and comment lines and reports whether there is a line
+// left.
+func (p *yamlParser) next() bool {
+	for ; p.i < len(p.lines); p.i++ {
+		if yamlStrip(p.lines[p.i]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// indent is the indentation of the current line.
+func (p *yamlParser) indent() int {
+	line := p.lines[p.i]
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// text is the current line without its indentation and comment.
+func (p *yamlParser) text() string {
+	return strings.TrimSpace(yamlStrip(p.lines[p.i]))
+}
+
+// node parses the mapping, sequence or scalar at indent.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	text := p.text()
+	switch {
+	case text == "-" || strings.HasPrefix(text, "- "):
+		return p.sequence(indent)
+	case yamlKey(text) >= 0:
+		return p.mapping(indent)
+	}
+
+	p.i++
+	return yamlInline(text)
+}
+
+// mapping parses the keys at indent.
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.next() && p.indent() == indent {
+		text := p.text()
+		i := yamlKey(text)
+		if text == "-" || strings.HasPrefix(text, "- ") {
+			return nil, p.errorf("unexpected sequence item: %q", text)
+		}
+		if i < 0 {
+			return nil, p.errorf("expected a key: %q", text)
+		}
+		key, err := yamlScalar(strings.TrimSpace(text[:i]))
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if key == "<<" {
+			return nil, p.errorf("merge keys are not supported")
+		}
+		if _, ok := m[key]; ok {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		value := strings.TrimSpace(text[i+1:])
+		p.i++
+
+		switch {
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			m[key] = p.block(indent, value)
+		case value != "":
+			if m[key], err = yamlInline(value); err != nil {
+				return nil, p.errorf("%s", err)
+			}
+		case !p.next():
+			m[key] = nil
+		case p.indent() > indent:
+			if m[key], err = p.node(p.indent()); err != nil {
+				return nil, err
+			}
+		case p.indent() == indent && (p.text() == "-" || strings.HasPrefix(p.text(), "- ")):
+			// Sequences may be at the same indentation as their key
+			if m[key], err = p.sequence(indent); err != nil {
+				return nil, err
+			}
+		default:
+			m[key] = nil
+		}
+	}
+	if p.next() && p.indent() > indent {
+		return nil, p.errorf("bad indentation: %q", p.text())
+	}
+	return m, nil
+}
+
+// sequence parses the items at indent.
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	var s []interface{}
+	for p.next() && p.indent() == indent {
+		text := p.text()
+		if text != "-" && !strings.HasPrefix(text, "- ") {
+			break
+		}
+		item := strings.TrimSpace(text[1:])
+		if item == "" {
+			p.i++
+			if !p.next() || p.indent() <= indent {
+				s = append(s, nil)
+				continue
+			}
+			v, err := p.node(p.indent())
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+
+		// The item is a node that starts after the "- ", so the line is
+		// parsed again with the dash blanked out
+		line := p.lines[p.i]
+		col := indent + 1 + len(line[indent+1:]) - len(strings.TrimLeft(line[indent+1:], " "))
+		p.lines[p.i] = strings.Repeat(" ", col) + line[col:]
+		v, err := p.node(col)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+// block parses the lines of a block scalar under a key at indent, after
+// its "|" or ">" header.
+func (p *yamlParser) block(indent int, header string) string {
+	var lines []string
+	blockIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if n <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = n
+		}
+		if n < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	// Trailing blank lines belong to the chomping, not the content
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var s string
+	if header[0] == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		// Folded lines are joined with spaces, and blank lines between
+		// them are newlines
+		for i, line := range lines {
+			switch {
+			case line == "":
+				s += "\n"
+				continue
+			case i > 0 && lines[i-1] != "":
+				s += " "
+			}
+			s += line
+		}
+	}
+	if s != "" && !strings.Contains(header, "-") {
+		s += "\n"
+	}
+	return s
+}
+
+// yamlStrip returns line without its comment.
+func yamlStrip(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t[{,:-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// yamlKey returns the index of the colon after the key of a mapping line,
+// or -1 if the line isn't a key.
+func yamlKey(text string) int {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return -1
+	}
+	start := 0
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return -1
+		}
+		start = end + 2
+	}
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlInline parses a value on the line of its key or dash.
+func yamlInline(text string) (interface{}, error) {
+	if text == "" {
+		return nil, nil
+	}
+	switch text[0] {
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported: %q", text)
+	case '[', '{':
+		v, rest, err := yamlFlow(text)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after %q", rest, text)
+		}
+		return v, nil
+	}
+	if text == "~" || text == "null" {
+		return nil, nil
+	}
+	return yamlScalar(text)
+}
+
+// yamlFlow parses the flow sequence or mapping at the start of s and
+// returns what follows it.
+func yamlFlow(s string) (interface{}, string, error) {
+	open := s[0]
+	end := byte(']')
+	if open == '{' {
+		end = '}'
+	}
+	var seq []interface{}
+	m := make(map[string]interface{})
+
+	s = strings.TrimSpace(s[1:])
+	for {
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated %c", open)
+		}
+		if s[0] == end {
+			s = s[1:]
+			break
+		}
+
+		var key string
+		if open == '{' {
+			i := strings.IndexByte(s, ':')
+			if i < 0 {
+				return nil, "", fmt.Errorf("expected a key in %q", s)
+			}
+			var err error
+			if key, err = yamlScalar(strings.TrimSpace(s[:i])); err != nil {
+				return nil, "", err
+			}
+			s = strings.TrimSpace(s[i+1:])
+		}
+
+		var v interface{}
+		if s != "" && (s[0] == '[' || s[0] == '{') {
+			var err error
+			if v, s, err = yamlFlow(s); err != nil {
+				return nil, "", err
+			}
+		} else {
+			i := yamlFlowEnd(s)
+			text := strings.TrimSpace(s[:i])
+			if text == "~" || text == "null" || text == "" {
+				v = nil
+			} else {
+				scalar, err := yamlScalar(text)
+				if err != nil {
+					return nil, "", err
+				}
+				v = scalar
+			}
+			s = s[i:]
+		}
+		if open == '{' {
+			m[key] = v
+		} else {
+			seq = append(seq, v)
+		}
+
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+
+	if open == '{' {
+		return m, s, nil
+	}
+	return seq, s, nil
+}
+
+// yamlFlowEnd returns the end of the scalar at the start of s in a flow.
+func yamlFlowEnd(s string) int {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ',' || c == ']' || c == '}':
+			return i
+		}
+	}
+	return len(s)
+}
+
+// yamlScalar unquotes a scalar.
+func yamlScalar(text string) (string, error) {
+	if len(text) == 0 {
+		return "", nil
+	}
+	switch text[0] {
+	case '"':
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", text)
+		}
+		return s, nil
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return "", fmt.Errorf("bad string %s", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	return text, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output interface{}
+	}{
+		{"", nil},
+		{
+			"a: 1\nb: 'it''s' # comment\nc: \"x\\ty\"\nd:\n",
+			map[string]interface{}{"a": "1", "b": "it's", "c": "x\ty", "d": nil},
+		},
+		{
+			"---\n# comment\nlist:\n  - a\n  - b # c\nsame:\n- x\nflow: [a, \"b, c\", {k: v}]\n",
+			map[string]interface{}{
+				"list": []interface{}{"a", "b"},
+				"same": []interface{}{"x"},
+				"flow": []interface{}{"a", "b, c", map[string]interface{}{"k": "v"}},
+			},
+		},
+		{
+			"builds:\n  - id: app\n    goos:\n      - linux\n    ignore:\n      - goos: windows\n        goarch: arm\n  -\n    id: other\n",
+			map[string]interface{}{
+				"builds": []interface{}{
+					map[string]interface{}{
+						"id":     "app",
+						"goos":   []interface{}{"linux"},
+						"ignore": []interface{}{map[string]interface{}{"goos": "windows", "goarch": "arm"}},
+					},
+					map[string]interface{}{"id": "other"},
+				},
+			},
+		},
+		{
+			"lit: |\n  a\n    b\n\n  c\nfold: >-\n  x_\n  {{- y }}\n\n  z\nurl: https://example.com/#x\n",
+			map[string]interface{}{
+				"lit":  "a\n  b\n\nc\n",
+				"fold": "x_ {{- y }}\nz",
+				"url":  "https://example.com/#x",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := parseYAML([]byte(tc.Input))
+		if err != nil {
+			t.Fatalf("err: %s: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("bad: %q\n%#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestParseYAML_errors(t *testing.T) {
+	cases := []string{
+		"a: &anchor 1\n",
+		"a: *anchor\n",
+		"<<: {}\n",
+		"a: 1\na: 2\n",
+		"a: [1, 2\n",
+		"a:\n  b: 1\n c: 2\n",
+		"a: 1\n- b\n",
+	}
+
+	for _, input := range cases {
+		if _, err := parseYAML([]byte(input)); err == nil {
+			t.Fatalf("should error: %q", input)
+		}
+	}
+}